@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// baselineResult is the subset of a result file used for comparison,
+// histograms are written as strings and cannot be read back.
+type baselineResult struct {
+	ScanResults []struct {
+		Id          uint64
+		Percentiles map[string]int64
+	}
+	MutationResults []struct {
+		Bucket      string
+		Percentiles map[string]int64
+	}
+}
+
+func readBaseline(filepath string) (*baselineResult, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	var b baselineResult
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// printPercentiles prints latency percentiles of the run and, if a
+// baseline is given, their change relative to the baseline.
+func printPercentiles(res *Result, base *baselineResult) {
+	for _, sr := range res.ScanResults {
+		var prev map[string]int64
+		if base != nil {
+			for _, b := range base.ScanResults {
+				if b.Id == sr.Id {
+					prev = b.Percentiles
+				}
+			}
+		}
+		fmt.Printf("Scan id:%d requests:%d latency %s\n", sr.Id, sr.Requests,
+			formatPercentiles(sr.Percentiles, prev))
+	}
+
+	for _, mr := range res.MutationResults {
+		var prev map[string]int64
+		if base != nil {
+			for _, b := range base.MutationResults {
+				if b.Bucket == mr.Bucket {
+					prev = b.Percentiles
+				}
+			}
+		}
+		fmt.Printf("Mutations bucket:%s sets:%d deletes:%d latency %s\n",
+			mr.Bucket, mr.Mutations, mr.Deletes, formatPercentiles(mr.Percentiles, prev))
+	}
+}
+
+func formatPercentiles(curr, prev map[string]int64) string {
+	keys := make([]string, 0, len(curr))
+	for k := range curr {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	s := ""
+	for _, k := range keys {
+		s += fmt.Sprintf("%s:%s", k, humanizeDuration(curr[k]))
+		if p, ok := prev[k]; ok && p > 0 {
+			s += fmt.Sprintf("(%+.1f%%)", float64(curr[k]-p)*100/float64(p))
+		}
+		s += " "
+	}
+	return s
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/couchbase/indexing/secondary/stats"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 type ScanConfig struct {
@@ -20,11 +21,34 @@ type ScanConfig struct {
 	Lookups     []c.SecondaryKey
 	High        c.SecondaryKey
 	Inclusion   int
+	Scans       []*ScanSpan // for Type "Scans"
+	Offset      int64
+	Reverse     bool
+	Distinct    bool
 	Repeat      uint32
 	NInterval   uint32 // Stats dump nrequests interval
 	Consistency bool   // Use session consistency
 
+	// Generate Low/High or Lookups for every request, instead of using
+	// the static keys specified above.
+	KeyGen *KeyGenConfig
+
 	iteration uint32
+	keygen    *KeyGenerator
+	delay     time.Duration // replay delay before issuing this request
+}
+
+// ScanSpan is a span of a multi-scan request. A nil Low or High in filter
+// is treated as unbounded.
+type ScanSpan struct {
+	Seek   c.SecondaryKey
+	Filter []*ScanFilter
+}
+
+type ScanFilter struct {
+	Low       interface{}
+	High      interface{}
+	Inclusion uint32
 }
 
 type Config struct {
@@ -33,6 +57,33 @@ type Config struct {
 	Concurrency    int
 	Clients        int
 	ClientBootTime int
+
+	// Replay scan requests captured by indexer (scan_capture.file),
+	// instead of ScanSpecs. ReplayPacing scales the captured inter-arrival
+	// time, 1.0 replays at the captured rate and 0 replays as fast as
+	// possible.
+	ReplayFile   string
+	ReplayPacing float64
+
+	// Concurrent mutation load while scans are running. With mutations,
+	// scans run against a local cluster booted in-process, instead of
+	// -cluster, on which Indexes are created before the scans start.
+	Mutations   []*MutationConfig
+	Indexes     []*IndexConfig
+	StorageMode string // of the local indexer, empty for the default
+
+	// Percentiles reported for request latency, default is
+	// 50, 90, 95, 99 and 99.9
+	Percentiles []float64
+}
+
+// IndexConfig of an index created on the local cluster.
+type IndexConfig struct {
+	Bucket    string
+	Name      string
+	SecExprs  []string
+	WhereExpr string
+	IsPrimary bool
 }
 
 type ScanResult struct {
@@ -42,6 +93,11 @@ type ScanResult struct {
 	LatencyHisto stats.Histogram
 	ErrorCount   platform.AlignedUint64
 
+	// Per request latency, from which Percentiles are computed.
+	RequestLatencyHisto stats.Histogram
+	Requests            uint64
+	Percentiles         map[string]int64
+
 	// periodic stats
 	iter          uint32
 	statsRows     uint64
@@ -49,10 +105,11 @@ type ScanResult struct {
 }
 
 type Result struct {
-	ScanResults    []*ScanResult
-	Rows           uint64
-	Duration       float64
-	WarmupDuration float64
+	ScanResults     []*ScanResult
+	MutationResults []*MutationResult `json:",omitempty"`
+	Rows            uint64
+	Duration        float64
+	WarmupDuration  float64
 }
 
 func parseConfig(filepath string) (*Config, error) {
@@ -5,8 +5,8 @@ import (
 	c "github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/platform"
 	qclient "github.com/couchbase/indexing/secondary/queryport/client"
+	"github.com/couchbase/indexing/secondary/stats"
 	"io"
-	"math"
 	"os"
 	"sync"
 	"time"
@@ -21,6 +21,8 @@ var (
 
 	clientBootTime = 5 // Seconds
 
+	defaultPercentiles = []float64{50, 90, 95, 99, 99.9}
+
 	requestCounter = platform.NewAlignedUint64(0)
 )
 
@@ -77,6 +79,17 @@ func RunJob(client *qclient.GsiClient, job *Job, aggrQ chan *JobResult) {
 		cons = c.AnyConsistency
 	}
 
+	low, high, lookups := spec.Low, spec.High, spec.Lookups
+	if spec.keygen != nil {
+		switch spec.Type {
+		case "Range":
+			l, h := spec.keygen.NextRange()
+			low, high = c.SecondaryKey{l}, c.SecondaryKey{h}
+		case "Lookup":
+			lookups = []c.SecondaryKey{c.SecondaryKey{spec.keygen.Next()}}
+		}
+	}
+
 	startTime := time.Now()
 	uuid := fmt.Sprintf("%d", platform.AddUint64(&requestCounter, 1))
 	switch spec.Type {
@@ -85,12 +98,17 @@ func RunJob(client *qclient.GsiClient, job *Job, aggrQ chan *JobResult) {
 		err = client.ScanAll(spec.DefnId, requestID, spec.Limit, cons, nil, callb)
 	case "Range":
 		requestID := os.Args[0] + uuid
-		err = client.Range(spec.DefnId, requestID, spec.Low, spec.High,
+		err = client.Range(spec.DefnId, requestID, low, high,
 			qclient.Inclusion(spec.Inclusion), false, spec.Limit, cons, nil, callb)
 	case "Lookup":
 		requestID := os.Args[0] + uuid
-		err = client.Lookup(spec.DefnId, requestID, spec.Lookups, false,
+		err = client.Lookup(spec.DefnId, requestID, lookups, false,
 			spec.Limit, cons, nil, callb)
+	case "Scans":
+		requestID := os.Args[0] + uuid
+		err = client.MultiScan(spec.DefnId, requestID, spans2scans(spec.Scans),
+			spec.Reverse, spec.Distinct, &qclient.IndexProjection{PrimaryKey: true},
+			spec.Offset, spec.Limit, cons, nil, callb)
 	}
 
 	if err != nil {
@@ -133,6 +151,8 @@ func ResultAggregator(ch chan *JobResult, sw io.Writer, wg *sync.WaitGroup) {
 			lat = jr.dur / jr.rows
 		}
 		result.LatencyHisto.Add(lat)
+		result.RequestLatencyHisto.Add(jr.dur)
+		result.Requests++
 
 		result.iter++
 		if sw != nil && spec.NInterval > 0 &&
@@ -145,7 +165,9 @@ func ResultAggregator(ch chan *JobResult, sw io.Writer, wg *sync.WaitGroup) {
 	}
 }
 
-func RunCommands(cluster string, cfg *Config, statsW io.Writer) (*Result, error) {
+// RunCommands of cfg against cluster. Mutations apply to buckets of the
+// local cluster, to which cluster shall point.
+func RunCommands(cluster string, local *localCluster, cfg *Config, statsW io.Writer) (*Result, error) {
 	t0 := time.Now()
 	var result Result
 
@@ -162,6 +184,18 @@ func RunCommands(cluster string, cfg *Config, statsW io.Writer) (*Result, error)
 		cfg.ClientBootTime = clientBootTime
 	}
 
+	if len(cfg.Percentiles) == 0 {
+		cfg.Percentiles = defaultPercentiles
+	}
+
+	if cfg.ReplayFile != "" {
+		specs, err := loadReplaySpecs(cfg.ReplayFile, cfg.ReplayPacing)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ScanSpecs = specs
+	}
+
 	config := c.SystemConfig.SectionConfig("queryport.client.", true)
 	config.SetValue("settings.poolSize", int(cfg.Concurrency))
 	config.SetValue("readDeadline", 0)
@@ -201,8 +235,11 @@ func RunCommands(cluster string, cfg *Config, statsW io.Writer) (*Result, error)
 	wg2.Add(1)
 	go ResultAggregator(aggrQ, statsW, &wg2)
 
+	// Replayed requests of the same Id aggregate into the same result.
+	results := make([]*ScanResult, len(cfg.ScanSpecs))
+	replayResults := make(map[uint64]*ScanResult)
 	for i, spec := range cfg.ScanSpecs {
-		if spec.Id == 0 {
+		if spec.Id == 0 && cfg.ReplayFile == "" {
 			spec.Id = uint64(i)
 		}
 
@@ -213,22 +250,41 @@ func RunCommands(cluster string, cfg *Config, statsW io.Writer) (*Result, error)
 			}
 		}
 
-		hFn := func(v int64) string {
-			if v == math.MinInt64 {
-				return "0"
-			} else if v == math.MaxInt64 {
-				return "inf"
+		if spec.KeyGen != nil {
+			if spec.keygen, err = NewKeyGenerator(spec.KeyGen); err != nil {
+				return nil, err
 			}
-			return fmt.Sprint(time.Nanosecond * time.Duration(v))
 		}
 
+		if res, ok := replayResults[spec.Id]; ok {
+			results[i] = res
+			continue
+		}
 		res := new(ScanResult)
 		res.ErrorCount = platform.NewAlignedUint64(0)
-		res.LatencyHisto.Init(cfg.LatencyBuckets, hFn)
+		res.LatencyHisto.Init(cfg.LatencyBuckets, humanizeDuration)
+		res.RequestLatencyHisto.Init(cfg.LatencyBuckets, humanizeDuration)
 		res.Id = spec.Id
+		if cfg.ReplayFile != "" {
+			replayResults[spec.Id] = res
+		}
+		results[i] = res
 		result.ScanResults = append(result.ScanResults, res)
 	}
 
+	var loads []*mutationLoad
+	if len(cfg.Mutations) > 0 && local == nil {
+		return nil, fmt.Errorf("Mutations need a local cluster")
+	}
+	for _, mcfg := range cfg.Mutations {
+		load, err := newMutationLoad(mcfg, cfg.LatencyBuckets)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, load)
+		result.MutationResults = append(result.MutationResults, load.result)
+	}
+
 	// warming up GsiClient
 	for _, client := range clients {
 		for _, spec := range cfg.ScanSpecs {
@@ -241,27 +297,50 @@ func RunCommands(cluster string, cfg *Config, statsW io.Writer) (*Result, error)
 	fmt.Println("GsiClients warmed up ...")
 	result.WarmupDuration = float64(time.Since(t0).Nanoseconds()) / float64(time.Second)
 
-	// Round robin scheduling of jobs
-	var allFinished bool
+	// Mutations run concurrently until the scans are complete.
+	var wg3 sync.WaitGroup
+	mutStopCh := make(chan bool)
+	for _, load := range loads {
+		wg3.Add(1)
+		go func(load *mutationLoad) {
+			defer wg3.Done()
+			if err := load.run(local.Bucket(load.cfg.Bucket), mutStopCh); err != nil {
+				fmt.Printf("Mutation load on %v failed: %v\n", load.cfg.Bucket, err)
+			}
+		}(load)
+	}
 
-loop:
-	for {
-		allFinished = true
+	if cfg.ReplayFile != "" {
+		// Replay jobs in captured order
 		for i, spec := range cfg.ScanSpecs {
-			if iter := platform.LoadUint32(&spec.iteration); iter < spec.Repeat+1 {
-				j := &Job{
-					spec:   spec,
-					result: result.ScanResults[i],
-				}
-
-				jobQ <- j
-				platform.AddUint32(&spec.iteration, 1)
-				allFinished = false
+			if spec.delay > 0 {
+				time.Sleep(spec.delay)
 			}
+			jobQ <- &Job{spec: spec, result: results[i]}
 		}
+	} else {
+		// Round robin scheduling of jobs
+		var allFinished bool
+
+	loop:
+		for {
+			allFinished = true
+			for i, spec := range cfg.ScanSpecs {
+				if iter := platform.LoadUint32(&spec.iteration); iter < spec.Repeat+1 {
+					j := &Job{
+						spec:   spec,
+						result: results[i],
+					}
+
+					jobQ <- j
+					platform.AddUint32(&spec.iteration, 1)
+					allFinished = false
+				}
+			}
 
-		if allFinished {
-			break loop
+			if allFinished {
+				break loop
+			}
 		}
 	}
 
@@ -269,6 +348,46 @@ loop:
 	wg1.Wait()
 	close(aggrQ)
 	wg2.Wait()
+	close(mutStopCh)
+	wg3.Wait()
+
+	for _, res := range result.ScanResults {
+		res.Percentiles = percentiles(&res.RequestLatencyHisto, cfg.Percentiles)
+	}
+	for _, res := range result.MutationResults {
+		res.Percentiles = percentiles(&res.LatencyHisto, cfg.Percentiles)
+	}
 
 	return &result, err
 }
+
+func spans2scans(spans []*ScanSpan) qclient.Scans {
+	scans := make(qclient.Scans, 0, len(spans))
+	for _, span := range spans {
+		scan := &qclient.Scan{Seek: span.Seek}
+		for _, f := range span.Filter {
+			filter := &qclient.CompositeElementFilter{
+				Low:       f.Low,
+				High:      f.High,
+				Inclusion: qclient.Inclusion(f.Inclusion),
+			}
+			if filter.Low == nil {
+				filter.Low = c.MinUnbounded
+			}
+			if filter.High == nil {
+				filter.High = c.MaxUnbounded
+			}
+			scan.Filter = append(scan.Filter, filter)
+		}
+		scans = append(scans, scan)
+	}
+	return scans
+}
+
+func percentiles(h *stats.Histogram, ps []float64) map[string]int64 {
+	m := make(map[string]int64)
+	for _, p := range ps {
+		m[fmt.Sprintf("p%v", p)] = h.Percentile(p)
+	}
+	return m
+}
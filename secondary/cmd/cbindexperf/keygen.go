@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// KeyGenConfig describes how keys are picked from a numeric key space
+// [Min, Max] for every request.
+//
+//   uniform    - every key is equally likely.
+//   zipf       - key Min+k is picked with probability proportional to
+//                (ZipfV+k)^(-ZipfS), small keys are hot.
+//   sequential - keys are picked in order, wrapping around at Max.
+//   hotspot    - HotRatio of the requests go to the first HotFraction of
+//                the key space, rest go to remaining keys uniformly.
+//
+// If Format is specified, keys are rendered as strings using it, for
+// eg. "user-%08d". Width is the span of a generated range scan, ie.
+// High = Low + Width.
+type KeyGenConfig struct {
+	Distribution string
+	Min          int64
+	Max          int64
+	ZipfS        float64
+	ZipfV        float64
+	HotFraction  float64
+	HotRatio     float64
+	Width        int64
+	Format       string
+	Seed         int64
+}
+
+type KeyGenerator struct {
+	cfg  KeyGenConfig
+	mu   sync.Mutex
+	rnd  *rand.Rand
+	zipf *rand.Zipf
+	next int64
+}
+
+func NewKeyGenerator(cfg *KeyGenConfig) (*KeyGenerator, error) {
+	g := &KeyGenerator{cfg: *cfg}
+	if g.cfg.Max < g.cfg.Min {
+		return nil, fmt.Errorf("keygen: Max %v less than Min %v", g.cfg.Max, g.cfg.Min)
+	}
+
+	seed := g.cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	g.rnd = rand.New(rand.NewSource(seed))
+	g.next = g.cfg.Min
+
+	switch g.cfg.Distribution {
+	case "", "uniform", "sequential":
+	case "zipf":
+		if g.cfg.ZipfS <= 1 {
+			g.cfg.ZipfS = 1.1
+		}
+		if g.cfg.ZipfV < 1 {
+			g.cfg.ZipfV = 1
+		}
+		imax := uint64(g.cfg.Max - g.cfg.Min)
+		g.zipf = rand.NewZipf(g.rnd, g.cfg.ZipfS, g.cfg.ZipfV, imax)
+	case "hotspot":
+		if g.cfg.HotFraction <= 0 || g.cfg.HotFraction >= 1 {
+			g.cfg.HotFraction = 0.2
+		}
+		if g.cfg.HotRatio <= 0 || g.cfg.HotRatio > 1 {
+			g.cfg.HotRatio = 0.8
+		}
+	default:
+		return nil, fmt.Errorf("keygen: unknown distribution %q", g.cfg.Distribution)
+	}
+	return g, nil
+}
+
+// NextInt returns the next key from the key space.
+func (g *KeyGenerator) NextInt() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.cfg.Max - g.cfg.Min + 1
+	switch g.cfg.Distribution {
+	case "zipf":
+		return g.cfg.Min + int64(g.zipf.Uint64())
+
+	case "sequential":
+		k := g.next
+		if g.next++; g.next > g.cfg.Max {
+			g.next = g.cfg.Min
+		}
+		return k
+
+	case "hotspot":
+		hot := int64(float64(n) * g.cfg.HotFraction)
+		if hot < 1 {
+			hot = 1
+		}
+		if g.rnd.Float64() < g.cfg.HotRatio || hot >= n {
+			return g.cfg.Min + g.rnd.Int63n(hot)
+		}
+		return g.cfg.Min + hot + g.rnd.Int63n(n-hot)
+	}
+	return g.cfg.Min + g.rnd.Int63n(n)
+}
+
+// Value renders a key from the key space as an index key value.
+func (g *KeyGenerator) Value(k int64) interface{} {
+	if g.cfg.Format != "" {
+		return fmt.Sprintf(g.cfg.Format, k)
+	}
+	return k
+}
+
+// Next returns the next key rendered as an index key value.
+func (g *KeyGenerator) Next() interface{} {
+	return g.Value(g.NextInt())
+}
+
+// NextRange returns low and high value of the next range scan.
+func (g *KeyGenerator) NextRange() (interface{}, interface{}) {
+	k := g.NextInt()
+	return g.Value(k), g.Value(k + g.cfg.Width)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+func newTestKeyGenerator(t *testing.T, cfg KeyGenConfig) *KeyGenerator {
+	cfg.Seed = 1
+	g, err := NewKeyGenerator(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// drawKeys returns number of times each key is picked in n draws,
+// failing if a key is out of the key space.
+func drawKeys(t *testing.T, g *KeyGenerator, n int) map[int64]int {
+	counts := make(map[int64]int)
+	for i := 0; i < n; i++ {
+		k := g.NextInt()
+		if k < g.cfg.Min || k > g.cfg.Max {
+			t.Fatalf("%v: key %v out of [%v, %v]", g.cfg.Distribution, k, g.cfg.Min, g.cfg.Max)
+		}
+		counts[k]++
+	}
+	return counts
+}
+
+func TestKeyGeneratorConfig(t *testing.T) {
+	if _, err := NewKeyGenerator(&KeyGenConfig{Min: 10, Max: 5}); err == nil {
+		t.Errorf("expected error for Max less than Min")
+	}
+	if _, err := NewKeyGenerator(&KeyGenConfig{Distribution: "pareto", Max: 5}); err == nil {
+		t.Errorf("expected error for unknown distribution")
+	}
+
+	g := newTestKeyGenerator(t, KeyGenConfig{Min: 100, Max: 100, Format: "user-%04d", Width: 5})
+	if v := g.Next(); v != "user-0100" {
+		t.Errorf("expected formatted key, got %v", v)
+	}
+	if low, high := g.NextRange(); low != "user-0100" || high != "user-0105" {
+		t.Errorf("unexpected range %v-%v", low, high)
+	}
+	g = newTestKeyGenerator(t, KeyGenConfig{Min: 7, Max: 7})
+	if v := g.Next(); v != int64(7) {
+		t.Errorf("expected numeric key, got %v", v)
+	}
+}
+
+func TestKeyGeneratorSequential(t *testing.T) {
+	g := newTestKeyGenerator(t, KeyGenConfig{Distribution: "sequential", Min: 3, Max: 5})
+	expected := []int64{3, 4, 5, 3, 4, 5, 3}
+	for i, e := range expected {
+		if k := g.NextInt(); k != e {
+			t.Fatalf("expected key %v at %v, got %v", e, i, k)
+		}
+	}
+}
+
+func TestKeyGeneratorUniform(t *testing.T) {
+	g := newTestKeyGenerator(t, KeyGenConfig{Min: 10, Max: 19})
+	counts := drawKeys(t, g, 10000)
+	for k := int64(10); k <= 19; k++ {
+		if counts[k] < 800 || counts[k] > 1200 {
+			t.Errorf("uniform: key %v picked %v times out of 10000", k, counts[k])
+		}
+	}
+}
+
+func TestKeyGeneratorZipf(t *testing.T) {
+	g := newTestKeyGenerator(t, KeyGenConfig{Distribution: "zipf", Min: 1000, Max: 1999, ZipfS: 1.5})
+	counts := drawKeys(t, g, 10000)
+	if counts[1000] <= counts[1001] || counts[1001] <= counts[1010] {
+		t.Errorf("zipf: expected small keys to be hot, got %v %v %v",
+			counts[1000], counts[1001], counts[1010])
+	}
+	hot := 0
+	for k := int64(1000); k < 1010; k++ {
+		hot += counts[k]
+	}
+	if hot < 5000 {
+		t.Errorf("zipf: expected most keys in first 1%%, got %v out of 10000", hot)
+	}
+}
+
+func TestKeyGeneratorHotspot(t *testing.T) {
+	g := newTestKeyGenerator(t, KeyGenConfig{Distribution: "hotspot", Min: 0, Max: 999,
+		HotFraction: 0.1, HotRatio: 0.9})
+	counts := drawKeys(t, g, 10000)
+	hot := 0
+	for k, n := range counts {
+		if k < 100 {
+			hot += n
+		}
+	}
+	if hot < 8700 || hot > 9300 {
+		t.Errorf("hotspot: expected 90%% of keys in first 10%%, got %v out of 10000", hot)
+	}
+
+	// defaults for invalid fraction and ratio
+	g = newTestKeyGenerator(t, KeyGenConfig{Distribution: "hotspot", Max: 9, HotFraction: 2})
+	if g.cfg.HotFraction != 0.2 || g.cfg.HotRatio != 0.8 {
+		t.Errorf("unexpected hotspot defaults %v, %v", g.cfg.HotFraction, g.cfg.HotRatio)
+	}
+}
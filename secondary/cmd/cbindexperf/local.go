@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	c "github.com/couchbase/indexing/secondary/common"
+	qclient "github.com/couchbase/indexing/secondary/queryport/client"
+	"github.com/couchbase/indexing/secondary/tests/framework/fakecluster"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// Timeout for an index on the local cluster to become active.
+var indexActiveTimeout = 5 * time.Minute
+
+// localCluster is a fake cluster, with projector and indexer booted
+// in-process, for a mixed scan and mutation workload. The process has to
+// be started by fakecluster.Run.
+type localCluster struct {
+	*fakecluster.Cluster
+	dir string
+}
+
+// startLocalCluster with every bucket of cfg and create cfg.Indexes.
+func startLocalCluster(cfg *Config) (*localCluster, error) {
+	buckets := make(map[string]bool)
+	for _, mcfg := range cfg.Mutations {
+		buckets[mcfg.Bucket] = true
+	}
+	for _, spec := range cfg.ScanSpecs {
+		buckets[spec.Bucket] = true
+	}
+	for _, icfg := range cfg.Indexes {
+		buckets[icfg.Bucket] = true
+	}
+	var names []string
+	for name := range buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dir, err := ioutil.TempDir("", "cbindexperf")
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := fakecluster.New(fakecluster.Config{Buckets: names})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	local := &localCluster{Cluster: cluster, dir: dir}
+
+	if err := local.StartProjector(dir); err != nil {
+		local.Close()
+		return nil, err
+	}
+	if err := local.StartIndexer(dir, cfg.StorageMode); err != nil {
+		local.Close()
+		return nil, err
+	}
+	if err := local.createIndexes(cfg.Indexes); err != nil {
+		local.Close()
+		return nil, err
+	}
+	fmt.Printf("Local cluster started at %v\n", local.ClusterAddr())
+	return local, nil
+}
+
+func (local *localCluster) createIndexes(indexes []*IndexConfig) error {
+	config := c.SystemConfig.SectionConfig("queryport.client.", true)
+	client, err := qclient.NewGsiClient(local.ClusterAddr(), config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, icfg := range indexes {
+		defnID, err := client.CreateIndex(icfg.Name, icfg.Bucket, "gsi", "N1QL", "",
+			icfg.WhereExpr, icfg.SecExprs, icfg.IsPrimary, nil)
+		if err != nil {
+			return fmt.Errorf("create index %v: %v", icfg.Name, err)
+		}
+		if err := waitForIndexActive(client, defnID); err != nil {
+			return fmt.Errorf("index %v: %v", icfg.Name, err)
+		}
+	}
+	return nil
+}
+
+func waitForIndexActive(client *qclient.GsiClient, defnID uint64) error {
+	deadline := time.Now().Add(indexActiveTimeout)
+	for {
+		state, err := client.IndexState(defnID)
+		if err != nil {
+			return err
+		} else if state == c.INDEX_STATE_ACTIVE {
+			return nil
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("not active after %v, state %v", indexActiveTimeout, state)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Close the cluster and remove its index files.
+func (local *localCluster) Close() {
+	local.Cluster.Close()
+	os.RemoveAll(local.dir)
+}
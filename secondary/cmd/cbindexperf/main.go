@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/couchbase/cbauth"
 	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/tests/framework/fakecluster"
 	"io"
 	"os"
 	"runtime"
@@ -31,6 +32,7 @@ func main() {
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
 	memprofile := flag.String("memprofile", "", "write mem profile to file")
 	logLevel := flag.String("logLevel", "error", "Log Level")
+	compare := flag.String("compare", "", "Baseline result file to compare latency percentiles")
 
 	flag.Parse()
 
@@ -42,63 +44,85 @@ func main() {
 		os.Exit(0)
 	}
 
-	if *cpuprofile != "" {
-		fd, err := os.Create(*cpuprofile)
-		if err != nil {
-			fmt.Println("Failed create cpu profile file")
-			os.Exit(1)
-		}
-		pprof.StartCPUProfile(fd)
-		defer pprof.StopCPUProfile()
-	}
-	if *memprofile != "" {
-		fd, err := os.Create(*memprofile)
-		if err != nil {
-			fmt.Println("Failed create mem profile file")
-			os.Exit(1)
-		}
-		defer pprof.WriteHeapProfile(fd)
-	}
-
 	runtime.GOMAXPROCS(*cpus)
-	up := strings.Split(*auth, ":")
-	_, err := cbauth.InternalRetryDefaultInit(*cluster, up[0], up[1])
-	if err != nil {
-		fmt.Printf("Failed to initialize cbauth: %s\n", err)
-		os.Exit(1)
-	}
-
 	cfg, err := parseConfig(*config)
 	handleError(err)
 
-	var statsW io.Writer
-	if *statsfile != "" {
-		if f, err := os.Create(*statsfile); err != nil {
+	run := func(cluster string, local *localCluster) {
+		if *cpuprofile != "" {
+			fd, err := os.Create(*cpuprofile)
+			if err != nil {
+				fmt.Println("Failed create cpu profile file")
+				os.Exit(1)
+			}
+			pprof.StartCPUProfile(fd)
+			defer pprof.StopCPUProfile()
+		}
+		if *memprofile != "" {
+			fd, err := os.Create(*memprofile)
+			if err != nil {
+				fmt.Println("Failed create mem profile file")
+				os.Exit(1)
+			}
+			defer pprof.WriteHeapProfile(fd)
+		}
+
+		var baseline *baselineResult
+		if *compare != "" {
+			baseline, err = readBaseline(*compare)
 			handleError(err)
-		} else {
-			statsW = f
-			defer f.Close()
 		}
-	}
 
-	t0 := time.Now()
-	res, err := RunCommands(*cluster, cfg, statsW)
-	handleError(err)
-	dur := time.Now().Sub(t0)
+		var statsW io.Writer
+		if *statsfile != "" {
+			if f, err := os.Create(*statsfile); err != nil {
+				handleError(err)
+			} else {
+				statsW = f
+				defer f.Close()
+			}
+		}
 
-	totalRows := uint64(0)
-	for _, result := range res.ScanResults {
-		totalRows += result.Rows
-	}
-	res.Rows = totalRows
-	res.Duration = dur.Seconds() - res.WarmupDuration
+		t0 := time.Now()
+		res, err := RunCommands(cluster, local, cfg, statsW)
+		handleError(err)
+		dur := time.Now().Sub(t0)
 
-	rate := int(float64(totalRows) / res.Duration)
+		totalRows := uint64(0)
+		for _, result := range res.ScanResults {
+			totalRows += result.Rows
+		}
+		res.Rows = totalRows
+		res.Duration = dur.Seconds() - res.WarmupDuration
 
-	fmt.Printf("Throughput = %d rows/sec\n", rate)
+		rate := int(float64(totalRows) / res.Duration)
 
-	os.Remove(*outfile)
-	err = writeResults(res, *outfile)
-	handleError(err)
+		fmt.Printf("Throughput = %d rows/sec\n", rate)
+		printPercentiles(res, baseline)
+
+		os.Remove(*outfile)
+		err = writeResults(res, *outfile)
+		handleError(err)
+	}
+
+	if len(cfg.Mutations) == 0 {
+		up := strings.Split(*auth, ":")
+		_, err := cbauth.InternalRetryDefaultInit(*cluster, up[0], up[1])
+		if err != nil {
+			fmt.Printf("Failed to initialize cbauth: %s\n", err)
+			os.Exit(1)
+		}
+		run(*cluster, nil)
+		return
+	}
 
+	// Mutations and scans run against a local cluster, booted in a
+	// re-executed process that has cbauth set up for it.
+	fakecluster.Run(func() int {
+		local, err := startLocalCluster(cfg)
+		handleError(err)
+		defer local.Close()
+		run(local.ClusterAddr(), local)
+		return 0
+	})
 }
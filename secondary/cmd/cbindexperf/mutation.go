@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/indexing/secondary/platform"
+	"github.com/couchbase/indexing/secondary/stats"
+	"github.com/couchbase/indexing/secondary/tests/framework/fakecluster"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// MutationConfig describes a mutation load applied to a bucket while the
+// scans are running. Documents are written to the bucket of a local fake
+// cluster, that streams them to projector and indexer booted in-process,
+// so that mutations reach indexer through projector like in production.
+//
+// Document ids are picked by DocIds, and every document has one field per
+// entry in Fields whose value is picked by the corresponding generator.
+// DeleteRatio of the mutations are deletes.
+type MutationConfig struct {
+	Bucket      string
+	Workers     int
+	Rate        int   // mutations per second across workers, 0 is unthrottled
+	Count       int64 // total mutations, 0 runs until scans complete
+	DeleteRatio float64
+	DocIdFormat string // default "doc-%d"
+	DocIds      *KeyGenConfig
+	Fields      map[string]*KeyGenConfig
+}
+
+type MutationResult struct {
+	Bucket       string
+	Mutations    uint64
+	Deletes      uint64
+	Duration     int64
+	LatencyHisto stats.Histogram
+	ErrorCount   platform.AlignedUint64
+	Percentiles  map[string]int64
+}
+
+type mutationLoad struct {
+	cfg    *MutationConfig
+	result *MutationResult
+	docids *KeyGenerator
+	fields map[string]*KeyGenerator
+	issued platform.AlignedInt64
+}
+
+func newMutationLoad(cfg *MutationConfig, buckets []int64) (*mutationLoad, error) {
+	var err error
+
+	if cfg.Workers == 0 {
+		cfg.Workers = 1
+	}
+	if cfg.DocIdFormat == "" {
+		cfg.DocIdFormat = "doc-%d"
+	}
+	if cfg.DocIds == nil {
+		cfg.DocIds = &KeyGenConfig{Min: 0, Max: 100000}
+	}
+
+	m := &mutationLoad{
+		cfg:    cfg,
+		result: &MutationResult{Bucket: cfg.Bucket},
+		fields: make(map[string]*KeyGenerator),
+		issued: platform.NewAlignedInt64(0),
+	}
+	m.result.ErrorCount = platform.NewAlignedUint64(0)
+	m.result.LatencyHisto.Init(buckets, humanizeDuration)
+
+	if m.docids, err = NewKeyGenerator(cfg.DocIds); err != nil {
+		return nil, err
+	}
+	for field, kcfg := range cfg.Fields {
+		if m.fields[field], err = NewKeyGenerator(kcfg); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// run applies mutations to bucket until Count mutations are issued or
+// stopch is closed.
+func (m *mutationLoad) run(bucket *fakecluster.Bucket, stopch chan bool) error {
+	if bucket == nil {
+		return fmt.Errorf("bucket %v not found in local cluster", m.cfg.Bucket)
+	}
+
+	var tick <-chan time.Time
+	if m.cfg.Rate > 0 {
+		interval := time.Second / time.Duration(m.cfg.Rate)
+		if interval <= 0 {
+			interval = time.Nanosecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	t0 := time.Now()
+	for i := 0; i < m.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+			for {
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-stopch:
+						return
+					}
+				} else {
+					select {
+					case <-stopch:
+						return
+					default:
+					}
+				}
+
+				n := platform.AddInt64(&m.issued, 1)
+				if m.cfg.Count > 0 && n > m.cfg.Count {
+					return
+				}
+
+				docid := fmt.Sprintf(m.cfg.DocIdFormat, m.docids.NextInt())
+				isDelete := rnd.Float64() < m.cfg.DeleteRatio
+
+				var merr error
+				start := time.Now()
+				if isDelete {
+					_, merr = bucket.Delete(docid)
+				} else {
+					doc := make(map[string]interface{})
+					for field, g := range m.fields {
+						doc[field] = g.Next()
+					}
+					var value []byte
+					if value, merr = json.Marshal(doc); merr == nil {
+						_, merr = bucket.Set(docid, value)
+					}
+				}
+				m.result.LatencyHisto.Add(time.Since(start).Nanoseconds())
+
+				mu.Lock()
+				if merr != nil {
+					platform.AddUint64(&m.result.ErrorCount, 1)
+				} else if isDelete {
+					m.result.Deletes++
+				} else {
+					m.result.Mutations++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	m.result.Duration = time.Since(t0).Nanoseconds()
+	return nil
+}
+
+func humanizeDuration(v int64) string {
+	if v == math.MinInt64 {
+		return "0"
+	} else if v == math.MaxInt64 {
+		return "inf"
+	}
+	return fmt.Sprint(time.Nanosecond * time.Duration(v))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	c "github.com/couchbase/indexing/secondary/common"
+	"os"
+	"time"
+)
+
+// captureRecord is a scan request captured by indexer, see
+// indexer.ScanCaptureRecord.
+type captureRecord struct {
+	Time        int64
+	Bucket      string
+	Index       string
+	Type        string
+	Limit       int64
+	Low         json.RawMessage
+	High        json.RawMessage
+	Lookups     []json.RawMessage
+	Inclusion   int
+	Scans       []*ScanSpan
+	Offset      int64
+	Reverse     bool
+	Distinct    bool
+	Consistency bool
+}
+
+// loadReplaySpecs reads a capture file and returns one scan spec per
+// captured request, in arrival order. Requests on the same index and of
+// the same type share a spec Id, so that their results are aggregated.
+func loadReplaySpecs(filepath string, pacing float64) ([]*ScanConfig, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ids := make(map[string]uint64)
+	specs := make([]*ScanConfig, 0)
+	skipped, prevTime := 0, int64(0)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec captureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			skipped++
+			continue
+		}
+
+		spec := &ScanConfig{
+			Bucket:      rec.Bucket,
+			Index:       rec.Index,
+			Type:        rec.Type,
+			Limit:       rec.Limit,
+			Inclusion:   rec.Inclusion,
+			Scans:       rec.Scans,
+			Offset:      rec.Offset,
+			Reverse:     rec.Reverse,
+			Distinct:    rec.Distinct,
+			Consistency: rec.Consistency,
+		}
+		if spec.Low, err = raw2key(rec.Low); err == nil {
+			spec.High, err = raw2key(rec.High)
+		}
+		for _, lookup := range rec.Lookups {
+			if err != nil {
+				break
+			}
+			var key c.SecondaryKey
+			key, err = raw2key(lookup)
+			spec.Lookups = append(spec.Lookups, key)
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		if pacing > 0 && prevTime > 0 && rec.Time > prevTime {
+			spec.delay = time.Duration(float64(rec.Time-prevTime) / pacing)
+		}
+		prevTime = rec.Time
+
+		group := fmt.Sprintf("%s/%s/%s", rec.Bucket, rec.Index, rec.Type)
+		id, ok := ids[group]
+		if !ok {
+			id = uint64(len(ids))
+			ids[group] = id
+			fmt.Printf("Replay id:%d => %s\n", id, group)
+		}
+		spec.Id = id
+		specs = append(specs, spec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Replay skipped %d unreadable records\n", skipped)
+	}
+	return specs, nil
+}
+
+// Primary index keys are captured as plain strings.
+func raw2key(raw json.RawMessage) (c.SecondaryKey, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var key c.SecondaryKey
+	if err := json.Unmarshal(raw, &key); err == nil {
+		return key, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return c.SecondaryKey{s}, nil
+}
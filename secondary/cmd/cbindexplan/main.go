@@ -10,6 +10,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/couchbase/cbauth"
@@ -17,6 +19,7 @@ import (
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/planner"
+	"io"
 	"os"
 	"strings"
 )
@@ -40,6 +43,8 @@ func usage() {
     cbindexplan -command=plan -indexes="indexes.json" -memQuota="10G" -cpuQuota=16 -output="saved-plan.json"
     cbindexplan -command=plan -plan="saved-plan.json" -indexes="indexes.json"
     cbindexplan -command=plan -plan="saved-plan.json" -indexes="indexes.json" -memQuota="10G" -cpuQuota=16 -output="newplan.json"
+    cbindexplan -command=plan -workload="workload.json" -memQuota="10G" -cpuQuota=16 -format=json
+    cbindexplan -command=plan -indexes="indexes.json" -memQuota="10G" -cpuQuota=16 -diskQuota="500G" -format=text
 - Rebalance 
     cbindexplan -command=rebalance-cluster="127.0.0.1:8091" -username="<user>" -password="<pwd>"
     cbindexplan -command=rebalance-cluster="127.0.0.1:8091" -username="<user>" -password="<pwd>" -addNode=3 -output="saved-plan.json"
@@ -47,6 +52,10 @@ func usage() {
     cbindexplan -command=rebalance -plan="saved-plan.json" -output="newplan.json"
     cbindexplan -command=rebalance -plan="saved-plan.json" -allowUnpin
     cbindexplan -command=rebalance -plan="saved-plan.json" -addNode=1
+    cbindexplan -command=rebalance -plan="saved-plan.json" -format=json
+- Simulate
+    cbindexplan -command=simulate -workload="workload.json" -iteration=100
+    cbindexplan -command=simulate -workload="workload.json" -plan="saved-plan.json" -iteration=10 -format=json
     `)
 	fmt.Fprintln(os.Stderr, `Usage Note:
 1) cbindexplan should only be used with MOI clsuter.
@@ -68,6 +77,14 @@ func usage() {
 6) For placement, cbindexplan can generate create-index and build-index statmeents for new indexes when using -ddl option.
 7) For placement, cbindexplan will recalculate the size for all indexes using MOI sizing equation.   Besides new indexes to be replaced,
    cbindexplan will also recaculate size for indexes retrived from a saved plan or live cluster before placement algorithm is run.
+    `)
+	fmt.Fprintln(os.Stderr, `Output Note:
+1) By default, cbindexplan logs its progress and outcome.  With -format=json or -format=text, the resulting placement, violations,
+   run stats and create-index statements for new indexes are written to stdout, in json or text format respectively.
+2) Workload specification (using -workload option) generates a random set of indexes for placement.  Example of workload json file
+   is under https://github.com/couchbase/indexing/blob/master/secondary/planner/sample/uniformWorkload.json
+3) The simulate command runs placement repeatedly (using -iteration option) with indexes from workload specification or index json
+   file.   By default, aggregated result is logged.  With -format option, the result of each run is written to stdout.
     `)
 	fmt.Fprintln(os.Stderr, `Rebalancing Note:
 1) cbindex can be used to simulate index rebalancing by using the rebalance command.   When rebalancing from a live cluster, cbindexplan
@@ -86,6 +103,7 @@ var gDetail bool
 var gGenStmt string
 var gPlan string
 var gIndexSpecs string
+var gWorkloadSpec string
 var gClusterUrl string
 var gUsername string
 var gPassword string
@@ -96,6 +114,9 @@ var gCommand string
 var gAddNode int
 var gMemQuota string
 var gCpuQuota int
+var gDiskQuota string
+var gIteration int
+var gFormat string
 var gEjectedNode string
 
 //////////////////////////////////////////////////////////////
@@ -108,18 +129,24 @@ func init() {
 	flag.StringVar(&gLogLevel, "logLevel", "INFO", "log level")
 	flag.StringVar(&gOutput, "output", "", "save index layout plan to a file after planning")
 	flag.StringVar(&gGenStmt, "ddl", "", "generate DDL statement after planning for new/moved indexes")
+	flag.StringVar(&gFormat, "format", "", "write placement, violations, stats and DDL to stdout in format = {json | text}")
 
 	// command + index specification
-	flag.StringVar(&gCommand, "command", "", "command = {plan | rebalance}")
+	flag.StringVar(&gCommand, "command", "", "command = {plan | rebalance | simulate}")
 	flag.StringVar(&gClusterUrl, "cluster", "", "fetch existing index layout plan from cluster url")
 	flag.StringVar(&gUsername, "username", "", "admin user for the cluster")
 	flag.StringVar(&gPassword, "password", "", "admin password for the cluster")
 	flag.StringVar(&gIndexSpecs, "indexes", "", "list of indexes for placement")
+	flag.StringVar(&gWorkloadSpec, "workload", "", "workload specification for generating indexes for placement (in place of specifying indexes)")
 	flag.StringVar(&gPlan, "plan", "", "fetch existing index layout from a saved plan file  (in place of specifying cluster url)")
 
 	// quota
 	flag.StringVar(&gMemQuota, "memQuota", "", "memory quota per indexer node (e.g. 100M, 1G)")
 	flag.IntVar(&gCpuQuota, "cpuQuota", -1, "cpu quota per indexer node")
+	flag.StringVar(&gDiskQuota, "diskQuota", "", "disk quota per indexer node (e.g. 100M, 1G)")
+
+	// simulation
+	flag.IntVar(&gIteration, "iteration", 1, "number of simulation runs")
 
 	// cluster size
 	flag.IntVar(&gAddNode, "addNode", 0, "number of indexer to add before running the planner")
@@ -140,6 +167,12 @@ func main() {
 		return
 	}
 
+	if gFormat != "" && gFormat != "json" && gFormat != "text" {
+		logging.Fatalf("Invalid argument: Invalid value for 'format' : %v", gFormat)
+		usage()
+		return
+	}
+
 	if gPlan != "" && gClusterUrl != "" {
 		logging.Fatalf("Invalid argument: Cannot specify both 'plan' and 'cluster'.")
 		usage()
@@ -179,6 +212,31 @@ func main() {
 		return
 	}
 
+	diskQuota, err := planner.ParseMemoryStr(gDiskQuota)
+	if err != nil {
+		logging.Fatalf("%v", err)
+		return
+	}
+
+	sim := planner.NewSimulator()
+
+	workload, err := sim.ReadWorkloadSpec(gWorkloadSpec)
+	if err != nil {
+		logging.Fatalf("%v", err)
+		return
+	}
+
+	config := planner.DefaultRunConfig()
+	config.Detail = gDetail
+	config.GenStmt = gGenStmt
+	config.Resize = plan == nil
+	config.Output = gOutput
+	config.AddNode = gAddNode
+	config.MemQuota = memQuota
+	config.CpuQuota = gCpuQuota
+	config.DiskQuota = diskQuota
+	config.AllowUnpin = gAllowUnpin
+
 	if gCommand == string(planner.CommandPlan) {
 
 		indexSpecs, err := planner.ReadIndexSpecs(gIndexSpecs)
@@ -187,13 +245,19 @@ func main() {
 			return
 		}
 
-		if indexSpecs == nil {
-			logging.Fatalf("Invalid argument: argument 'indexes' is required to specify indexes to be placed.")
+		if indexSpecs == nil && workload == nil {
+			logging.Fatalf("Invalid argument: argument 'indexes' or 'workload' is required to specify indexes to be placed.")
 			usage()
 			return
 		}
 
-		err = planner.ExecutePlanWithOptions(plan, indexSpecs, gDetail, gGenStmt, gOutput, gAddNode, gCpuQuota, memQuota, gAllowUnpin)
+		var result *planner.PlanResult
+		if workload != nil {
+			result, err = sim.Simulate(config, planner.CommandPlan, workload, plan, nil)
+		} else {
+			result, err = planner.ExecuteWithResult(config, planner.CommandPlan, plan, indexSpecs, nil)
+		}
+		reportResult(result)
 		if err != nil {
 			logging.Fatalf("Planner error: %v.", err)
 			return
@@ -205,12 +269,55 @@ func main() {
 			logging.Fatalf("Invalid argument: option 'ddl' is not supported for rebalancing.")
 		}
 
-		err := planner.ExecuteRebalanceWithOptions(plan, nil, gDetail, gGenStmt, gOutput, gAddNode, gCpuQuota, memQuota, gAllowUnpin, nil)
+		config.Resize = false
+
+		result, err := planner.ExecuteWithResult(config, planner.CommandRebalance, plan, nil, nil)
+		reportResult(result)
 		if err != nil {
 			logging.Fatalf("Planner error: %v.", err)
 			return
 		}
 
+	} else if gCommand == "simulate" {
+
+		indexSpecs, err := planner.ReadIndexSpecs(gIndexSpecs)
+		if err != nil {
+			logging.Fatalf("%v", err)
+			return
+		}
+
+		if indexSpecs == nil && workload == nil {
+			logging.Fatalf("Invalid argument: argument 'indexes' or 'workload' is required for simulation.")
+			usage()
+			return
+		}
+
+		if gIteration <= 0 {
+			logging.Fatalf("Invalid argument: Invalid value for 'iteration' : %v", gIteration)
+			return
+		}
+
+		if gFormat == "" {
+			if err := sim.RunSimulation(gIteration, config, planner.CommandPlan, workload, plan, indexSpecs); err != nil {
+				logging.Fatalf("Planner error: %v.", err)
+			}
+			return
+		}
+
+		var results []*planner.PlanResult
+		for i := 0; i < gIteration; i++ {
+			result, err := sim.Simulate(config, planner.CommandPlan, workload, plan, indexSpecs)
+			if result != nil {
+				results = append(results, result)
+			}
+			if err != nil {
+				writeResults(os.Stdout, results...)
+				logging.Fatalf("Planner error: %v.", err)
+				return
+			}
+		}
+		writeResults(os.Stdout, results...)
+
 	} else if gCommand == string(planner.CommandSwap) {
 
 		logging.Infof("CommandSwap is used.  This is for internal testing only.  Some optional arguments could be ignored.")
@@ -276,3 +383,63 @@ func main() {
 		return
 	}
 }
+
+//////////////////////////////////////////////////////////////
+// Output
+/////////////////////////////////////////////////////////////
+
+// reportResult writes the result to stdout in the requested format.  Without format,
+// the planner logs its outcome, and the index layout is logged if requested.
+func reportResult(result *planner.PlanResult) {
+
+	if gFormat != "" {
+		writeResults(os.Stdout, result)
+		return
+	}
+
+	if gDetail && result != nil {
+		var buf bytes.Buffer
+		result.WriteText(&buf)
+
+		logging.Infof("************ Indexer Layout *************")
+		for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+			logging.Infof("%v", line)
+		}
+		logging.Infof("****************************************")
+	}
+}
+
+func writeResults(w io.Writer, results ...*planner.PlanResult) {
+
+	if gFormat == "" || len(results) == 0 || results[0] == nil {
+		return
+	}
+
+	if gFormat == "json" {
+		var data []byte
+		var err error
+
+		if len(results) == 1 {
+			data, err = json.MarshalIndent(results[0], "", "	")
+		} else {
+			data, err = json.MarshalIndent(results, "", "	")
+		}
+
+		if err != nil {
+			logging.Fatalf("Unable to write result. err = %v", err)
+			return
+		}
+
+		w.Write(data)
+		fmt.Fprintln(w)
+		return
+	}
+
+	for i, result := range results {
+		if len(results) > 1 {
+			fmt.Fprintf(w, "************ Result for Simulation %v *************\n", i)
+		}
+		result.WriteText(w)
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/planner"
+)
+
+func TestReadSampleSpecs(t *testing.T) {
+
+	sim := planner.NewSimulator()
+	for _, file := range []string{"uniformWorkload.json", "mixedWorkload.json"} {
+		spec, err := sim.ReadWorkloadSpec("../../planner/sample/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(spec.Workload) == 0 || spec.MinNumIndex == 0 || spec.MaxNumIndex < spec.MinNumIndex {
+			t.Errorf("%v: unexpected workload spec %+v", file, spec)
+		}
+	}
+
+	specs, err := planner.ReadIndexSpecs("../../planner/sample/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 || specs[0].Name != "index1" || specs[0].Replica != 3 || specs[0].NumDoc != 5000 {
+		t.Errorf("unexpected index specs %+v", specs)
+	}
+
+	plan, err := planner.ReadPlan("../../planner/sample/uniformPlan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Placement) != 18 || plan.MemQuota == 0 || plan.CpuQuota == 0 {
+		t.Errorf("unexpected plan of %v nodes, mem quota %v, cpu quota %v",
+			len(plan.Placement), plan.MemQuota, plan.CpuQuota)
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+
+	specs, err := planner.ReadIndexSpecs("sample/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := planner.DefaultRunConfig()
+	config.MemQuota = 10 * 1024 * 1024 * 1024
+	config.CpuQuota = 16
+	result, err := planner.ExecuteWithResult(config, planner.CommandPlan, nil, specs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numIndexes := 0
+	for _, indexer := range result.Placement {
+		numIndexes += len(indexer.Indexes)
+	}
+	if numIndexes != 6 || len(result.Placement) < 2 || result.Violations != nil {
+		t.Fatalf("expected 3 indexes with 2 replicas each, got %v on %v nodes, violations %v",
+			numIndexes, len(result.Placement), result.Violations)
+	}
+	if !strings.Contains(result.DDL, "CREATE INDEX") {
+		t.Errorf("expected create index statements, got %q", result.DDL)
+	}
+
+	defer func(format string) { gFormat = format }(gFormat)
+
+	var buf bytes.Buffer
+	gFormat = "json"
+	writeResults(&buf, result)
+	var decoded planner.PlanResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json output: %v\n%s", err, buf.String())
+	}
+	if len(decoded.Placement) != len(result.Placement) || decoded.MemQuota != result.MemQuota ||
+		decoded.DDL != result.DDL {
+		t.Errorf("unexpected json output\n%s", buf.String())
+	}
+
+	buf.Reset()
+	gFormat = "text"
+	writeResults(&buf, result, result)
+	text := buf.String()
+	for _, s := range []string{"Result for Simulation 1", "--- Placement", "Index name:index1,", "--- DDL"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("expected %q in text output\n%s", s, text)
+		}
+	}
+
+	buf.Reset()
+	gFormat = ""
+	writeResults(&buf, result)
+	if buf.Len() != 0 {
+		t.Errorf("unexpected output without format\n%s", buf.String())
+	}
+}
@@ -262,6 +262,86 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.dcp.xattrs": ConfigValue{
+		true,
+		"negotiate xattrs with KV, so that documents are streamed along " +
+			"with their extended attributes, changing this value does " +
+			"not affect existing feeds.",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.snappy": ConfigValue{
+		true,
+		"negotiate snappy with KV, so that documents can be streamed " +
+			"compressed, changing this value does not affect existing feeds.",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.collections": ConfigValue{
+		true,
+		"negotiate collections with KV, so that mutations are streamed " +
+			"along with their collection-id and filtered for indexes on " +
+			"collections, changing this value does not affect existing feeds.",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.enabled": ConfigValue{
+		true,
+		"adapt DCP connection buffer size and buffer-ack cadence " +
+			"to the feedback from indexer",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.minBufferSize": ConfigValue{
+		1024 * 1024,
+		"in bytes, lower bound for DCP connection buffer size",
+		1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.maxBufferSize": ConfigValue{
+		64 * 1024 * 1024,
+		"in bytes, upper bound for DCP connection buffer size",
+		64 * 1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.bufferStep": ConfigValue{
+		2 * 1024 * 1024,
+		"in bytes, DCP connection buffer size is grown by this step " +
+			"when indexer is well below its targets",
+		2 * 1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.maxAckThreshold": ConfigValue{
+		0.5,
+		"upper bound for fraction of connection buffer read before " +
+			"sending a buffer-ack, when indexer is above its targets",
+		0.5,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.targetQueueDepth": ConfigValue{
+		100000,
+		"mutations queued in indexer for a bucket, beyond which " +
+			"DCP connection buffer is shrunk",
+		100000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.flowControl.targetFlushLatency": ConfigValue{
+		1000,
+		"in milliseconds, indexer flush latency for a bucket, beyond " +
+			"which DCP connection buffer is shrunk",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector adminport parameters
 	"projector.adminport.name": ConfigValue{
 		"projector.adminport",
@@ -573,6 +653,23 @@ var SystemConfig = Config{
 		false,    // mutable
 		false,    // case-insensitive
 	},
+	"queryport.client.getseqnosWindow": ConfigValue{
+		0,
+		"window, in microseconds, for which concurrent requests for " +
+			"kv seqnos are gathered to be served by a single round to kv, " +
+			"if ZERO only outstanding requests are served together.",
+		0,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.scanStaleness": ConfigValue{
+		0,
+		"staleness bound, in milliseconds, for n1ql scans that do not " +
+			"request consistency, if ZERO such scans use any consistency.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector's adminport client, can be used by indexer.
 	"indexer.projectorclient.retryInterval": ConfigValue{
 		16,
@@ -907,6 +1004,124 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.bucket_pressure.enabled": ConfigValue{
+		true,
+		"Slow down the streams of buckets filling the mutation queues " +
+			"instead of pausing the Indexer at high_mem_mark. Indexer " +
+			"goes to Paused state only when memory_quota is exhausted(moi only)",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.high_mark": ConfigValue{
+		0.8,
+		"Fraction of its share of mutation queue memory above which " +
+			"the stream of a bucket is throttled",
+		0.8,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.low_mark": ConfigValue{
+		0.5,
+		"Fraction of its share of mutation queue memory below which " +
+			"a throttled stream of a bucket is released. Above high_mem_mark, " +
+			"streams are throttled from this mark as well",
+		0.5,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.check_interval": ConfigValue{
+		1000, // in milliseconds
+		"Interval at which mutation queue memory of buckets is checked",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.ack_delay": ConfigValue{
+		100, // in milliseconds
+		"Delay between DCP buffer acks when a stream is throttled, " +
+			"doubled at every check while its queue keeps growing",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.max_ack_delay": ConfigValue{
+		3200, // in milliseconds
+		"Maximum delay between DCP buffer acks for a throttled stream",
+		3200,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.scan_policy": ConfigValue{
+		"queue",
+		"Scans with session or query consistency on a bucket under " +
+			"pressure are either held until released(queue) or " +
+			"rejected(shed). stale=ok scans are always allowed",
+		"queue",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bucket_pressure.scan_wait_timeout": ConfigValue{
+		5000, // in milliseconds
+		"Max time a scan is held on a bucket under pressure before " +
+			"it is rejected",
+		5000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.flow_control.enabled": ConfigValue{
+		true,
+		"Periodically report mutation queue depth and flush latency " +
+			"of buckets to projectors, to adapt DCP connection buffers",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.flow_control.feedback_interval": ConfigValue{
+		1000, // in milliseconds
+		"Interval at which mutation queue depth and flush latency of " +
+			"buckets are reported to projectors",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan_cursor_ttl": ConfigValue{
+		300000,
+		"time, in milliseconds, a paged scan cursor and its pinned " +
+			"snapshot are retained after the last page was read",
+		300000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan_cursor_max": ConfigValue{
+		1000,
+		"maximum number of open paged scan cursors, 0 means no limit",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan_capture.file": ConfigValue{
+		"",
+		"file to capture sampled scan requests into, for replay by " +
+			"cbindexperf. Empty string disables capture",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.scan_capture.sample_rate": ConfigValue{
+		0.0,
+		"fraction of scan requests, between 0 and 1, to capture",
+		0.0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan_capture.max_records": ConfigValue{
+		1000000,
+		"maximum number of scan requests to capture into a file",
+		1000000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.force_gc_mem_frac": ConfigValue{
 		0.1,
 		"Fraction of memory_quota left after which GC is forced " +
@@ -1060,6 +1275,28 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.log_format": ConfigValue{
+		"text",
+		"Indexer log format, text or json",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.log_sampling.first": ConfigValue{
+		0,
+		"Number of messages per second logged from hot paths, " +
+			"before sampling kicks in. 0 disables sampling",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.log_sampling.thereafter": ConfigValue{
+		100,
+		"Once sampling kicks in, log every n-th message from hot paths",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.scan_timeout": ConfigValue{
 		120000,
 		"timeout, in milliseconds, timeout for index scan processing",
@@ -1067,6 +1304,15 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"indexer.settings.getseqnos_window": ConfigValue{
+		0,
+		"window, in microseconds, for which concurrent requests for " +
+			"kv seqnos are gathered to be served by a single round to kv, " +
+			"if ZERO only outstanding requests are served together.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.max_array_seckey_size": ConfigValue{
 		10240,
 		"Maximum size of secondary index key size for array index",
@@ -1192,6 +1438,14 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.on_demand_snapshot": ConfigValue{
+		true,
+		"Create snapshot as soon as flushed mutations satisfy a waiting " +
+			"consistent scan, without waiting for the next snapshot interval",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
 
 	//fdb specific settings
 	"indexer.settings.persisted_snapshot.fdb.interval": ConfigValue{
@@ -1267,6 +1521,37 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.build_queue.bucket_limit": ConfigValue{
+		0,
+		"Maximum number of queued indexes of a bucket that are built " +
+			"together in one initial build stream, 0 for no limit",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.build_queue.node_limit": ConfigValue{
+		0,
+		"Maximum number of indexes built concurrently on this node, " +
+			"queued builds wait for capacity, 0 for no limit",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scrub.rate": ConfigValue{
+		1000,
+		"Documents per second read from KV by the index scrubber, " +
+			"0 for no limit",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scrub.max_report_entries": ConfigValue{
+		100,
+		"Maximum number of discrepancies listed in a scrub report",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.settings.log_level": ConfigValue{
 		"info",
 		"Projector logging level",
@@ -1274,6 +1559,28 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.settings.log_format": ConfigValue{
+		"text",
+		"Projector log format, text or json",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.settings.log_sampling.first": ConfigValue{
+		0,
+		"Number of messages per second logged from hot paths, " +
+			"before sampling kicks in. 0 disables sampling",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.settings.log_sampling.thereafter": ConfigValue{
+		100,
+		"Once sampling kicks in, log every n-th message from hot paths",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.diagnostics_dir": ConfigValue{
 		"./",
 		"Projector diagnostics information directory",
@@ -48,3 +48,10 @@ var ErrIndexNotReady = errors.New("Index not ready for serving queries")
 var ErrClientCancel = errors.New("Client requested cancel")
 
 var ErrIndexerInBootstrap = errors.New("Indexer In Bootstrap State. Please retry the request later.")
+
+// ErrIndexBuildInProgress when another index of the bucket is being built.
+var ErrIndexBuildInProgress = errors.New("Build Already In Progress")
+
+// ErrIndexBuildNotInProgress when pausing or cancelling the build of an index
+// that is not being built.
+var ErrIndexBuildNotInProgress = errors.New("Index Build Not In Progress")
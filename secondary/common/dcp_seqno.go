@@ -1,6 +1,7 @@
 package common
 
 import "sync"
+import "sync/atomic"
 import "time"
 import "fmt"
 import "sort"
@@ -16,6 +17,22 @@ const seqsBufSize = 64 * 1024
 
 var errConnClosed = errors.New("dcpSeqnos - conn closed already")
 
+// coalescing window, in nanoseconds, for GET_SEQNOS requests.
+var seqnosWindow int64
+
+// SetBucketSeqnosWindow sets the window for which a bucket's seqnos
+// reader waits, after receiving a request, to gather concurrent requests
+// before issuing a single GET_SEQNOS round for all of them. Zero window
+// batches only the requests that are already outstanding. Requests made
+// with BucketSeqnosWithWindow use their own window instead.
+func SetBucketSeqnosWindow(window time.Duration) {
+	atomic.StoreInt64(&seqnosWindow, int64(window))
+}
+
+func getBucketSeqnosWindow() time.Duration {
+	return time.Duration(atomic.LoadInt64(&seqnosWindow))
+}
+
 // cache Bucket{} and DcpFeed{} objects, its underlying connections
 // to make Stats-Seqnos fast.
 var dcp_buckets_seqnos struct {
@@ -49,33 +66,44 @@ func newKVConn(mc *memcached.Client) *kvConn {
 	return &kvConn{mc: mc, seqsbuf: make([]uint64, 1024), tmpbuf: make([]byte, seqsBufSize)}
 }
 
-type vbSeqnosRequest chan *vbSeqnosResponse
+type vbSeqnosRequest struct {
+	window time.Duration // coalescing window, negative for the default
+	respch chan *vbSeqnosResponse
+}
 
-func (ch *vbSeqnosRequest) Reply(response *vbSeqnosResponse) {
-	*ch <- response
+func (req *vbSeqnosRequest) Reply(response *vbSeqnosResponse) {
+	req.respch <- response
 }
 
-func (ch *vbSeqnosRequest) Response() ([]uint64, error) {
-	response := <-*ch
+func (req *vbSeqnosRequest) Response() ([]uint64, error) {
+	response := <-req.respch
 	return response.seqnos, response.err
 }
 
 // Bucket level seqnos reader for the cluster
 type vbSeqnosReader struct {
-	bucket     string
-	kvfeeds    map[string]*kvConn
-	requestCh  chan vbSeqnosRequest
-	seqsTiming stats.TimingStat
+	bucket      string
+	kvfeeds     map[string]*kvConn
+	requestCh   chan vbSeqnosRequest
+	seqsTiming  stats.TimingStat
+	numRequests stats.Int64Val
+	numRounds   stats.Int64Val
+
+	// GET_SEQNOS round on kvfeeds, CollectSeqnos
+	collectSeqnos func(map[string]*kvConn) ([]uint64, error)
 }
 
 func newVbSeqnosReader(bucket string, kvfeeds map[string]*kvConn) *vbSeqnosReader {
 	r := &vbSeqnosReader{
-		bucket:    bucket,
-		kvfeeds:   kvfeeds,
-		requestCh: make(chan vbSeqnosRequest, seqsReqChanSize),
+		bucket:        bucket,
+		kvfeeds:       kvfeeds,
+		requestCh:     make(chan vbSeqnosRequest, seqsReqChanSize),
+		collectSeqnos: CollectSeqnos,
 	}
 
 	r.seqsTiming.Init()
+	r.numRequests.Init()
+	r.numRounds.Init()
 
 	go r.Routine()
 	return r
@@ -86,30 +114,52 @@ func (r *vbSeqnosReader) Close() {
 }
 
 func (r *vbSeqnosReader) GetSeqnos() (seqs []uint64, err error) {
+	return r.GetSeqnosWithWindow(-1)
+}
+
+// GetSeqnosWithWindow gets the seqnos gathering concurrent requests for
+// window, if the request starts a round. Negative window is the default
+// set by SetBucketSeqnosWindow.
+func (r *vbSeqnosReader) GetSeqnosWithWindow(
+	window time.Duration) (seqs []uint64, err error) {
+
 	defer func() {
 		if r := recover(); r != nil {
 			err = errConnClosed
 		}
 	}()
 
-	req := make(vbSeqnosRequest, 1)
+	req := vbSeqnosRequest{window: window, respch: make(chan *vbSeqnosResponse, 1)}
 	r.requestCh <- req
 	seqs, err = req.Response()
 	return
 }
 
 // This routine is responsible for computing request batches on the fly
-// and issue single 'dcp seqno' per batch.
+// and issue single 'dcp seqno' per batch. Only requests received before
+// a round is issued are batched into it, so that every request gets
+// seqnos that are atleast as recent as the time it was made.
 func (r *vbSeqnosReader) Routine() {
 	for req := range r.requestCh {
+		// Let concurrent requests join this round
+		window := req.window
+		if window < 0 {
+			window = getBucketSeqnosWindow()
+		}
+		if window > 0 {
+			time.Sleep(window)
+		}
+
 		l := len(r.requestCh)
 		t0 := time.Now()
-		seqnos, err := CollectSeqnos(r.kvfeeds)
+		seqnos, err := r.collectSeqnos(r.kvfeeds)
 		response := &vbSeqnosResponse{
 			seqnos: seqnos,
 			err:    err,
 		}
 		r.seqsTiming.Put(time.Since(t0))
+		r.numRequests.Add(int64(l + 1))
+		r.numRounds.Add(1)
 		if err != nil {
 			dcp_buckets_seqnos.rw.Lock()
 			dcp_buckets_seqnos.errors[r.bucket] = err
@@ -233,6 +283,53 @@ func BucketSeqsTiming(bucket string) *stats.TimingStat {
 	return nil
 }
 
+// SeqnosStats of GET_SEQNOS requests made for a bucket.
+type SeqnosStats struct {
+	Requests int64 // requests for seqnos
+	Rounds   int64 // GET_SEQNOS rounds made to kv-nodes
+}
+
+// Saved returns the number of rounds saved by coalescing requests.
+func (s SeqnosStats) Saved() int64 {
+	return s.Requests - s.Rounds
+}
+
+// CoalescingRatio returns the average number of requests per round.
+func (s SeqnosStats) CoalescingRatio() float64 {
+	if s.Rounds == 0 {
+		return 0
+	}
+	return float64(s.Requests) / float64(s.Rounds)
+}
+
+// BucketSeqsStats returns GET_SEQNOS statistics for bucket, stats are
+// reset when the bucket's connections are re-established.
+func BucketSeqsStats(bucket string) (SeqnosStats, bool) {
+	dcp_buckets_seqnos.rw.RLock()
+	defer dcp_buckets_seqnos.rw.RUnlock()
+	if reader, ok := dcp_buckets_seqnos.readerMap[bucket]; ok {
+		return SeqnosStats{
+			Requests: reader.numRequests.Value(),
+			Rounds:   reader.numRounds.Value(),
+		}, true
+	}
+	return SeqnosStats{}, false
+}
+
+// AllBucketSeqsStats returns GET_SEQNOS statistics for all buckets.
+func AllBucketSeqsStats() map[string]SeqnosStats {
+	dcp_buckets_seqnos.rw.RLock()
+	defer dcp_buckets_seqnos.rw.RUnlock()
+	m := make(map[string]SeqnosStats, len(dcp_buckets_seqnos.readerMap))
+	for bucket, reader := range dcp_buckets_seqnos.readerMap {
+		m[bucket] = SeqnosStats{
+			Requests: reader.numRequests.Value(),
+			Rounds:   reader.numRounds.Value(),
+		}
+	}
+	return m
+}
+
 // BucketSeqnos return list of {{vbno,seqno}..} for all vbuckets.
 // this call might fail due to,
 // - concurrent access that can preserve a deleted/failed bucket object.
@@ -241,6 +338,14 @@ func BucketSeqsTiming(bucket string) *stats.TimingStat {
 // in both the cases if the call is retried it should get fixed, provided
 // a valid bucket exists.
 func BucketSeqnos(cluster, pooln, bucketn string) (l_seqnos []uint64, err error) {
+	return BucketSeqnosWithWindow(cluster, pooln, bucketn, -1)
+}
+
+// BucketSeqnosWithWindow is BucketSeqnos with the coalescing window of
+// the caller, negative window is the default set by SetBucketSeqnosWindow.
+func BucketSeqnosWithWindow(cluster, pooln, bucketn string,
+	window time.Duration) (l_seqnos []uint64, err error) {
+
 	// any type of error will cleanup the bucket and its kvfeeds.
 	defer func() {
 		if err != nil {
@@ -274,7 +379,7 @@ func BucketSeqnos(cluster, pooln, bucketn string) (l_seqnos []uint64, err error)
 		return nil, err
 	}
 
-	l_seqnos, err = reader.GetSeqnos()
+	l_seqnos, err = reader.GetSeqnosWithWindow(window)
 	return
 }
 
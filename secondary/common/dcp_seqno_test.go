@@ -0,0 +1,99 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBucketSeqnosCoalescing(t *testing.T) {
+	SetBucketSeqnosWindow(200 * time.Millisecond)
+	defer SetBucketSeqnosWindow(0)
+
+	var rounds int64
+	r := &vbSeqnosReader{
+		bucket:    "default",
+		kvfeeds:   map[string]*kvConn{},
+		requestCh: make(chan vbSeqnosRequest, seqsReqChanSize),
+		collectSeqnos: func(map[string]*kvConn) ([]uint64, error) {
+			n := atomic.AddInt64(&rounds, 1)
+			return []uint64{uint64(n), uint64(n)}, nil
+		},
+	}
+	r.seqsTiming.Init()
+	r.numRequests.Init()
+	r.numRounds.Init()
+	go r.Routine()
+	defer r.Close()
+
+	// concurrent callers within the window share a single round
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([][]uint64, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = r.GetSeqnos()
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&rounds); n != 1 {
+		t.Fatalf("expected 1 round for %v callers, got %v", callers, n)
+	}
+	for i := range results {
+		if errs[i] != nil || len(results[i]) != 2 || results[i][0] != 1 {
+			t.Errorf("unexpected result of caller %v: %v, %v", i, results[i], errs[i])
+		}
+	}
+	if r.numRequests.Value() != callers || r.numRounds.Value() != 1 {
+		t.Errorf("unexpected stats, requests %v, rounds %v",
+			r.numRequests.Value(), r.numRounds.Value())
+	}
+
+	// request after the round gets seqnos of a new round
+	if seqnos, err := r.GetSeqnos(); err != nil || seqnos[0] != 2 {
+		t.Errorf("expected seqnos of second round, got %v, %v", seqnos, err)
+	}
+	if n := atomic.LoadInt64(&rounds); n != 2 {
+		t.Errorf("expected 2 rounds, got %v", n)
+	}
+}
+
+func TestBucketSeqnosWindowOfRequest(t *testing.T) {
+	// default window of the process, as set by indexer
+	SetBucketSeqnosWindow(time.Hour)
+	defer SetBucketSeqnosWindow(0)
+
+	r := &vbSeqnosReader{
+		bucket:    "default",
+		kvfeeds:   map[string]*kvConn{},
+		requestCh: make(chan vbSeqnosRequest, seqsReqChanSize),
+		collectSeqnos: func(map[string]*kvConn) ([]uint64, error) {
+			return []uint64{1}, nil
+		},
+	}
+	r.seqsTiming.Init()
+	r.numRequests.Init()
+	r.numRounds.Init()
+	go r.Routine()
+	defer r.Close()
+
+	// a client with its own window does not wait for the default
+	donech := make(chan error, 1)
+	go func() {
+		_, err := r.GetSeqnosWithWindow(0)
+		donech <- err
+	}()
+	select {
+	case err := <-donech:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected request with own window not to wait for default window")
+	}
+}
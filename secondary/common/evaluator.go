@@ -23,4 +23,7 @@ type Evaluator interface {
 	// TransformRoute will transform document consumable by
 	// downstream, returns data to be published to endpoints.
 	TransformRoute(vbuuid uint64, m *mc.DcpEvent, data map[string]interface{}, encodeBuf []byte) error
+
+	// GetStatistics return statistics of this evaluator.
+	GetStatistics() map[string]interface{}
 }
@@ -12,6 +12,7 @@ package common
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -152,6 +153,12 @@ const (
 	// and make sure to return a stable data-set that is atleast as
 	// recent as the timestamp-vector.
 	QueryConsistency
+
+	// BoundedStalenessConsistency indexer would accept a staleness
+	// bound, and make sure to return a data-set from a snapshot that
+	// is no older than the bound. This option avoids the round-trip
+	// to KV paid by SessionConsistency.
+	BoundedStalenessConsistency
 )
 
 func (cons Consistency) String() string {
@@ -162,6 +169,8 @@ func (cons Consistency) String() string {
 		return "SESSION_CONSISTENCY"
 	case QueryConsistency:
 		return "QUERY_CONSISTENCY"
+	case BoundedStalenessConsistency:
+		return "BOUNDED_STALENESS_CONSISTENCY"
 	default:
 		return "UNKNOWN_CONSISTENCY"
 	}
@@ -183,8 +192,58 @@ type IndexDefn struct {
 	WhereExpr       string          `json:"where,omitempty"`
 	Deferred        bool            `json:"deferred,omitempty"`
 	Immutable       bool            `json:"immutable,omitempty"`
+	WhereImmutable  bool            `json:"whereImmutable,omitempty"`
 	Nodes           []string        `json:"nodes,omitempty"`
 	IsArrayIndex    bool            `json:"isArrayIndex,omitempty"`
+	BuildPriority   int             `json:"buildPriority,omitempty"`
+	Scope           string          `json:"scope,omitempty"`
+	Collection      string          `json:"collection,omitempty"`
+	ScopeId         string          `json:"scopeId,omitempty"`
+	CollectionId    string          `json:"collectionId,omitempty"`
+	//adaptive index, indexing [fieldpath, value] for each field of the
+	//documents matching one of FieldPrefixes, no more than MaxFields
+	//fields per document and values no larger than MaxValueSize bytes.
+	IsAdaptive    bool     `json:"isAdaptive,omitempty"`
+	FieldPrefixes []string `json:"fieldPrefixes,omitempty"`
+	MaxFields     int      `json:"maxFields,omitempty"`
+	MaxValueSize  int      `json:"maxValueSize,omitempty"`
+}
+
+//Indexes created without a scope and collection, including the ones
+//created before collections, are on the default collection of the
+//default scope. Scope and collection ids are hex strings, as listed in
+//the bucket manifest.
+const (
+	DEFAULT_SCOPE         = "_default"
+	DEFAULT_COLLECTION    = "_default"
+	DEFAULT_SCOPE_ID      = "0"
+	DEFAULT_COLLECTION_ID = "0"
+)
+
+//Keyspace returns bucket.scope.collection, with defaults for empty
+//scope and collection, so that index names can be compared across
+//definitions with and without scope and collection.
+func Keyspace(bucket, scope, collection string) string {
+	if scope == "" {
+		scope = DEFAULT_SCOPE
+	}
+	if collection == "" {
+		collection = DEFAULT_COLLECTION
+	}
+	return bucket + "." + scope + "." + collection
+}
+
+//ParseCollectionId returns the numeric collection id, as sent with
+//DCP mutations, for a hex collection id.
+func ParseCollectionId(id string) (uint32, error) {
+	if id == "" {
+		return 0, nil
+	}
+	cid, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(cid), nil
 }
 
 //IndexInst is an instance of an Index(aka replica)
@@ -207,11 +266,22 @@ func (idx IndexDefn) String() string {
 	str += fmt.Sprintf("Name: %v ", idx.Name)
 	str += fmt.Sprintf("Using: %v ", idx.Using)
 	str += fmt.Sprintf("Bucket: %v ", idx.Bucket)
+	str += fmt.Sprintf("Scope: %v ", idx.Scope)
+	str += fmt.Sprintf("Collection: %v ", idx.Collection)
 	str += fmt.Sprintf("IsPrimary: %v ", idx.IsPrimary)
 	str += fmt.Sprintf("\n\t\tSecExprs: %v ", idx.SecExprs)
 	str += fmt.Sprintf("\n\t\tPartitionScheme: %v ", idx.PartitionScheme)
 	str += fmt.Sprintf("PartitionKey: %v ", idx.PartitionKey)
 	str += fmt.Sprintf("WhereExpr: %v ", idx.WhereExpr)
+	if idx.WhereImmutable {
+		str += fmt.Sprintf("WhereImmutable: %v ", idx.WhereImmutable)
+	}
+	if idx.IsAdaptive {
+		str += fmt.Sprintf("\n\t\tIsAdaptive: %v ", idx.IsAdaptive)
+		str += fmt.Sprintf("FieldPrefixes: %v ", idx.FieldPrefixes)
+		str += fmt.Sprintf("MaxFields: %v ", idx.MaxFields)
+		str += fmt.Sprintf("MaxValueSize: %v ", idx.MaxValueSize)
+	}
 	return str
 
 }
@@ -0,0 +1,134 @@
+package common
+
+import (
+	"sort"
+	"time"
+)
+
+// IndexUsage is the scan activity and storage cost of an index instance
+// as seen by the indexer hosting it.
+type IndexUsage struct {
+	DefnId    IndexDefnId `json:"defnId"`
+	Bucket    string      `json:"bucket"`
+	Name      string      `json:"name"`
+	Node      string      `json:"node,omitempty"`
+	IsPrimary bool        `json:"isPrimary,omitempty"`
+	SecExprs  []string    `json:"secExprs,omitempty"`
+	WhereExpr string      `json:"where,omitempty"`
+
+	// LastScanTime is unix time in nanoseconds of the last scan, zero if
+	// the index was not scanned since the indexer started or stats were
+	// reset.
+	LastScanTime int64 `json:"lastScanTime"`
+	NumRequests  int64 `json:"numRequests"`
+
+	// scan requests by request type, scan, scanAll, count and stats.
+	NumRequestsByType map[string]int64 `json:"numRequestsByType"`
+
+	// NumFullKeyScans counts requests whose spans constrained every key of
+	// the index, NumPrefixScans requests that constrained only a leading
+	// subset of them or scanned the whole index.
+	NumFullKeyScans int64 `json:"numFullKeyScans"`
+	NumPrefixScans  int64 `json:"numPrefixScans"`
+
+	MemorySize int64 `json:"memorySize"`
+	DataSize   int64 `json:"dataSize"`
+	DiskSize   int64 `json:"diskSize"`
+}
+
+// RedundantIndex pairs an index with another index on the same bucket and
+// WHERE clause whose keys it is a prefix of, hence can serve its scans.
+type RedundantIndex struct {
+	Index     *IndexUsage `json:"index"`
+	CoveredBy *IndexUsage `json:"coveredBy"`
+}
+
+// IndexUsageReport lists unused and redundant indexes, along with the
+// storage they would free.
+type IndexUsageReport struct {
+	Indexes   []*IndexUsage    `json:"indexes"`
+	Unused    []*IndexUsage    `json:"unused"`
+	Redundant []RedundantIndex `json:"redundant"`
+
+	UnusedMemorySize    int64 `json:"unusedMemorySize"`
+	UnusedDiskSize      int64 `json:"unusedDiskSize"`
+	RedundantMemorySize int64 `json:"redundantMemorySize"`
+	RedundantDiskSize   int64 `json:"redundantDiskSize"`
+}
+
+// NewIndexUsageReport computes the report over usages. An index is unused
+// if it was never scanned, or, for a non-zero unusedFor, not scanned in
+// the last unusedFor duration.
+func NewIndexUsageReport(usages []*IndexUsage, unusedFor time.Duration) *IndexUsageReport {
+	report := &IndexUsageReport{
+		Indexes:   usages,
+		Unused:    make([]*IndexUsage, 0),
+		Redundant: make([]RedundantIndex, 0),
+	}
+
+	sorted := make([]*IndexUsage, len(usages))
+	copy(sorted, usages)
+	sort.Sort(indexUsages(sorted))
+
+	now := time.Now().UnixNano()
+	for _, u := range sorted {
+		if u.LastScanTime == 0 ||
+			(unusedFor != 0 && now-u.LastScanTime > unusedFor.Nanoseconds()) {
+			report.Unused = append(report.Unused, u)
+			report.UnusedMemorySize += u.MemorySize
+			report.UnusedDiskSize += u.DiskSize
+		}
+	}
+
+	for _, u := range sorted {
+		for _, other := range sorted {
+			if u.DefnId == other.DefnId || !isKeyPrefixOf(u, other) {
+				continue
+			}
+			// of two indexes on identical keys report only the newer one.
+			if len(u.SecExprs) == len(other.SecExprs) && u.DefnId < other.DefnId {
+				continue
+			}
+			report.Redundant = append(report.Redundant, RedundantIndex{u, other})
+			report.RedundantMemorySize += u.MemorySize
+			report.RedundantDiskSize += u.DiskSize
+			break
+		}
+	}
+	return report
+}
+
+// isKeyPrefixOf tells whether the keys of index u are a leading subset of
+// the keys of index other, both being on the same bucket and WHERE clause.
+func isKeyPrefixOf(u, other *IndexUsage) bool {
+	if u.IsPrimary || other.IsPrimary {
+		return false
+	}
+	if u.Bucket != other.Bucket || u.WhereExpr != other.WhereExpr {
+		return false
+	}
+	if len(u.SecExprs) == 0 || len(u.SecExprs) > len(other.SecExprs) {
+		return false
+	}
+	for i, expr := range u.SecExprs {
+		if expr != other.SecExprs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sort by bucket, name and node.
+type indexUsages []*IndexUsage
+
+func (s indexUsages) Len() int      { return len(s) }
+func (s indexUsages) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s indexUsages) Less(i, j int) bool {
+	if s[i].Bucket != s[j].Bucket {
+		return s[i].Bucket < s[j].Bucket
+	}
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return s[i].Node < s[j].Node
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexUsageReport(t *testing.T) {
+	recent := time.Now().UnixNano()
+	old := time.Now().Add(-48 * time.Hour).UnixNano()
+
+	usages := []*IndexUsage{
+		{DefnId: 1, Bucket: "default", Name: "idx_ab", SecExprs: []string{"a", "b"},
+			LastScanTime: recent, MemorySize: 10, DiskSize: 100},
+		{DefnId: 2, Bucket: "default", Name: "idx_a", SecExprs: []string{"a"},
+			LastScanTime: old, MemorySize: 20, DiskSize: 200},
+		{DefnId: 3, Bucket: "default", Name: "idx_a_where", SecExprs: []string{"a"},
+			WhereExpr: "type = \"x\"", LastScanTime: recent},
+		{DefnId: 4, Bucket: "other", Name: "idx_a", SecExprs: []string{"a"},
+			LastScanTime: recent},
+		{DefnId: 5, Bucket: "default", Name: "idx_ab_dup", SecExprs: []string{"a", "b"},
+			MemorySize: 5, DiskSize: 50},
+		{DefnId: 6, Bucket: "default", Name: "#primary", IsPrimary: true},
+	}
+
+	report := NewIndexUsageReport(usages, 0)
+	if len(report.Unused) != 2 {
+		t.Fatalf("expected 2 unused indexes, got %v", len(report.Unused))
+	}
+	if report.UnusedMemorySize != 5 || report.UnusedDiskSize != 50 {
+		t.Fatalf("unexpected unused cost %v %v",
+			report.UnusedMemorySize, report.UnusedDiskSize)
+	}
+
+	report = NewIndexUsageReport(usages, 24*time.Hour)
+	if len(report.Unused) != 3 {
+		t.Fatalf("expected 3 unused indexes, got %v", len(report.Unused))
+	}
+
+	redundant := make(map[IndexDefnId]IndexDefnId)
+	for _, r := range report.Redundant {
+		redundant[r.Index.DefnId] = r.CoveredBy.DefnId
+	}
+	if len(redundant) != 2 {
+		t.Fatalf("expected 2 redundant indexes, got %v", redundant)
+	}
+	if _, ok := redundant[2]; !ok {
+		t.Fatalf("expected idx_a to be redundant, got %v", redundant)
+	}
+	if by, ok := redundant[5]; !ok || by != 1 {
+		t.Fatalf("expected idx_ab_dup to be covered by idx_ab, got %v", redundant)
+	}
+	if report.RedundantMemorySize != 25 || report.RedundantDiskSize != 250 {
+		t.Fatalf("unexpected redundant cost %v %v",
+			report.RedundantMemorySize, report.RedundantDiskSize)
+	}
+}
@@ -186,6 +186,8 @@ type KeyVersions struct {
 	Oldkeys   [][]byte // previous key-versions, if available
 	Partnkeys [][]byte // partition key for each key-version
 	Ctime     int64
+	// collection of the document, 0 is the default collection
+	CollectionId uint32
 }
 
 // NewKeyVersions return a reference KeyVersions for a single mutation.
@@ -1,5 +1,6 @@
 package common
 
+import "encoding/json"
 import "errors"
 import "fmt"
 import "io"
@@ -569,12 +570,18 @@ func SetNumCPUs(percent int) int {
 
 func IndexStatement(def IndexDefn) string {
 	var stmt string
-	primCreate := "CREATE PRIMARY INDEX `%s` ON `%s`"
-	secCreate := "CREATE INDEX `%s` ON `%s`(%s)"
+	primCreate := "CREATE PRIMARY INDEX `%s` ON %s"
+	secCreate := "CREATE INDEX `%s` ON %s(%s)"
 	where := " WHERE %s"
 
+	keyspace := fmt.Sprintf("`%s`", def.Bucket)
+	if Keyspace(def.Bucket, def.Scope, def.Collection) !=
+		Keyspace(def.Bucket, "", "") {
+		keyspace = fmt.Sprintf("`%s`.`%s`.`%s`", def.Bucket, def.Scope, def.Collection)
+	}
+
 	if def.IsPrimary {
-		stmt = fmt.Sprintf(primCreate, def.Name, def.Bucket)
+		stmt = fmt.Sprintf(primCreate, def.Name, keyspace)
 	} else {
 		exprs := ""
 		for _, exp := range def.SecExprs {
@@ -583,7 +590,7 @@ func IndexStatement(def IndexDefn) string {
 			}
 			exprs += exp
 		}
-		stmt = fmt.Sprintf(secCreate, def.Name, def.Bucket, exprs)
+		stmt = fmt.Sprintf(secCreate, def.Name, keyspace, exprs)
 		if def.WhereExpr != "" {
 			stmt += fmt.Sprintf(where, def.WhereExpr)
 		}
@@ -594,6 +601,14 @@ func IndexStatement(def IndexDefn) string {
 		withExpr += "\"immutable\":true"
 	}
 
+	if def.WhereImmutable {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+
+		withExpr += " \"where_immutable\":true"
+	}
+
 	if def.Deferred {
 		if len(withExpr) != 0 {
 			withExpr += ","
@@ -610,6 +625,32 @@ func IndexStatement(def IndexDefn) string {
 		withExpr += " \"nodes\":\"" + def.Nodes[0] + "\""
 	}
 
+	if def.BuildPriority != 0 {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+
+		withExpr += fmt.Sprintf(" \"build_priority\":%d", def.BuildPriority)
+	}
+
+	if def.IsAdaptive {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+
+		withExpr += " \"adaptive\":true"
+		if len(def.FieldPrefixes) != 0 {
+			prefixes, _ := json.Marshal(def.FieldPrefixes)
+			withExpr += fmt.Sprintf(", \"field_prefixes\":%s", prefixes)
+		}
+		if def.MaxFields != 0 {
+			withExpr += fmt.Sprintf(", \"max_fields\":%d", def.MaxFields)
+		}
+		if def.MaxValueSize != 0 {
+			withExpr += fmt.Sprintf(", \"max_value_size\":%d", def.MaxValueSize)
+		}
+	}
+
 	if len(withExpr) != 0 {
 		stmt += fmt.Sprintf(" WITH { %s }", withExpr)
 	}
@@ -632,6 +673,30 @@ func LogOs() string {
 	return fmt.Sprintf("uid: %v; gid: %v; hostname: %v", uid, gid, hostname)
 }
 
+//
+// This method fetch the scope and collection ids of a collection from the
+// bucket manifest.  Default collection is always available, without a
+// manifest, so that clusters without collections can be indexed.
+//
+func GetCollectionId(cluster, bucket, scope, collection string) (string, string, error) {
+
+	if Keyspace(bucket, scope, collection) == Keyspace(bucket, "", "") {
+		return DEFAULT_SCOPE_ID, DEFAULT_COLLECTION_ID, nil
+	}
+
+	b, err := ConnectBucket(cluster, "default", bucket)
+	if err != nil {
+		return "", "", err
+	}
+	defer b.Close()
+
+	manifest, err := b.GetCollectionsManifest()
+	if err != nil {
+		return "", "", err
+	}
+	return manifest.GetCollectionId(scope, collection)
+}
+
 //
 // This method fetch the bucket UUID.  If this method return an error,
 // then it means that the node is not able to connect in order to fetch
@@ -39,6 +39,9 @@ func protobufEncode(payload interface{}) (data []byte, err error) {
 				if kv.Docid != nil && len(kv.Docid) > 0 {
 					pkv.Docid = kv.Docid
 				}
+				if kv.CollectionId != 0 {
+					pkv.CollectionID = proto.Uint32(kv.CollectionId)
+				}
 				if len(kv.Uuids) == 0 {
 					continue
 				}
@@ -108,12 +111,13 @@ func protobuf2KeyVersions(keys []*protobuf.KeyVersions) []*c.KeyVersions {
 	size := 4 // To avoid reallocs
 	for _, key := range keys {
 		kv := &c.KeyVersions{
-			Seqno:    key.GetSeqno(),
-			Docid:    key.GetDocid(),
-			Uuids:    make([]uint64, 0, size),
-			Commands: make([]byte, 0, size),
-			Keys:     make([][]byte, 0, size),
-			Oldkeys:  make([][]byte, 0, size),
+			Seqno:        key.GetSeqno(),
+			Docid:        key.GetDocid(),
+			Uuids:        make([]uint64, 0, size),
+			Commands:     make([]byte, 0, size),
+			Keys:         make([][]byte, 0, size),
+			Oldkeys:      make([][]byte, 0, size),
+			CollectionId: key.GetCollectionID(),
 		}
 		commands := key.GetCommands()
 		newkeys := key.GetKeys()
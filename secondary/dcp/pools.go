@@ -611,6 +611,53 @@ func (p *Pool) GetBucket(name string) (*Bucket, error) {
 	return &rv, nil
 }
 
+// Manifest of scopes and collections in a bucket, scope and collection
+// ids are hex strings.
+type Manifest struct {
+	UID    string          `json:"uid"`
+	Scopes []ManifestScope `json:"scopes"`
+}
+
+// ManifestScope is a scope and its collections in a Manifest.
+type ManifestScope struct {
+	Name        string               `json:"name"`
+	UID         string               `json:"uid"`
+	Collections []ManifestCollection `json:"collections"`
+}
+
+// ManifestCollection is a collection in a Manifest.
+type ManifestCollection struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// GetCollectionsManifest gets the current manifest of the bucket.
+func (b *Bucket) GetCollectionsManifest() (*Manifest, error) {
+	manifest := &Manifest{}
+	err := b.parseURLResponse("/pools/default/buckets/"+b.Name+"/scopes", manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// GetCollectionId gets the scope id and collection id of a collection
+// in the manifest.
+func (m *Manifest) GetCollectionId(scope, collection string) (string, string, error) {
+	for _, s := range m.Scopes {
+		if s.Name != scope {
+			continue
+		}
+		for _, c := range s.Collections {
+			if c.Name == collection {
+				return s.UID, c.UID, nil
+			}
+		}
+		return "", "", errors.New("No collection named " + collection)
+	}
+	return "", "", errors.New("No scope named " + scope)
+}
+
 // GetPool gets the pool to which this bucket belongs.
 func (b *Bucket) GetPool() *Pool {
 	return b.pool
@@ -289,6 +289,43 @@ func TestPool(t *testing.T) {
 	assert(t, "len(pools)", 5, len(res.Nodes))
 }
 
+var sampleManifest = `{
+    "uid": "2",
+    "scopes": [
+        {
+            "name": "_default",
+            "uid": "0",
+            "collections": [{"name": "_default", "uid": "0"}]
+        },
+        {
+            "name": "tenant1",
+            "uid": "8",
+            "collections": [
+                {"name": "users", "uid": "8"},
+                {"name": "orders", "uid": "a"}
+            ]
+        }
+    ]
+}`
+
+func TestManifest(t *testing.T) {
+	res := Manifest{}
+	testParse(t, sampleManifest, &res)
+
+	scopeId, collectionId, err := res.GetCollectionId("tenant1", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "scope id", scopeId, "8")
+	assert(t, "collection id", collectionId, "a")
+	if _, _, err := res.GetCollectionId("tenant1", "missing"); err == nil {
+		t.Errorf("expected error for missing collection")
+	}
+	if _, _, err := res.GetCollectionId("missing", "users"); err == nil {
+		t.Errorf("expected error for missing scope")
+	}
+}
+
 func TestCommonAddressSuffixEmpty(t *testing.T) {
 	b := Bucket{nodeList: mkNL([]Node{})}
 	assert(t, "empty", "", b.CommonAddressSuffix())
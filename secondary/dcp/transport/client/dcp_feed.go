@@ -4,11 +4,13 @@
 package memcached
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/dcp/transport"
 	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/golang/snappy"
 	"io"
 	"strconv"
 	"time"
@@ -19,6 +21,11 @@ const bufferAckThreshold = 0.2
 const opaqueOpen = 0xBEAF0001
 const opaqueFailover = 0xDEADBEEF
 const opaqueGetseqno = 0xDEADBEEF
+const opaqueControl = 0xBEAF0002
+const opaqueHello = 0xBEAF0003
+
+// interval at which delayed buffer-acks are checked for
+const ackDelayTick = 100 * time.Millisecond
 
 // error codes
 var ErrorInvalidLog = errors.New("couchbase.errorInvalidLog")
@@ -29,6 +36,12 @@ var ErrorConnection = errors.New("dcp.connection")
 // ErrorInvalidFeed
 var ErrorInvalidFeed = errors.New("dcp.invalidFeed")
 
+// ErrorInvalidXattrs
+var ErrorInvalidXattrs = errors.New("dcp.invalidXattrs")
+
+// ErrorInvalidCollectionID
+var ErrorInvalidCollectionID = errors.New("dcp.invalidCollectionID")
+
 // DcpFeed represents an DCP feed. A feed contains a connection to a single
 // host and multiple vBuckets
 type DcpFeed struct {
@@ -45,6 +58,14 @@ type DcpFeed struct {
 	maxAckBytes uint32   // Max buffer control ack bytes
 	stats       DcpStats // Stats for dcp client
 	dcplatency  *Average
+	// flow control
+	ackDelay     time.Duration // min. interval between buffer-acks
+	lastAck      time.Time     // time of the last buffer-ack sent
+	bufsize      uint32        // connection buffer size, 0 if not enabled
+	ackThreshold float32       // fraction of bufsize read before buffer-ack
+	// datatype
+	hello    []transport.Feature        // features to negotiate
+	features map[transport.Feature]bool // features enabled by producer
 }
 
 // NewDcpFeed creates a new DCP Feed.
@@ -61,8 +82,24 @@ func NewDcpFeed(
 		reqch:     make(chan []interface{}, genChanSize),
 		finch:     make(chan bool),
 		// TODO: would be nice to add host-addr as part of prefix.
-		logPrefix:  fmt.Sprintf("DCPT[%s]", name),
-		dcplatency: &Average{},
+		logPrefix:    fmt.Sprintf("DCPT[%s]", name),
+		dcplatency:   &Average{},
+		ackThreshold: bufferAckThreshold,
+		features:     make(map[transport.Feature]bool),
+	}
+	// optional features, values are decoded by newDcpEvent().
+	if val, ok := config["xattrs"]; ok && val.(bool) {
+		feed.hello = append(feed.hello, transport.FeatureXattr)
+	}
+	if val, ok := config["snappy"]; ok && val.(bool) {
+		feed.hello = append(feed.hello, transport.FeatureSnappy)
+	}
+	// keys are decoded by handlePacket().
+	if val, ok := config["collections"]; ok && val.(bool) {
+		feed.hello = append(feed.hello, transport.FeatureCollections)
+	}
+	if len(feed.hello) > 0 {
+		feed.hello = append(feed.hello, transport.FeatureJSON)
 	}
 
 	mc.Hijack()
@@ -133,6 +170,39 @@ func (feed *DcpFeed) CloseStream(vbno, opaqueMSB uint16) error {
 	return opError(err, resp, 0)
 }
 
+// SetAckDelay throttles the feed by sending buffer-acks to the producer
+// no more often than once every `delay`. The producer stops sending once
+// its buffer is full, so a consumer under memory pressure can slow down
+// the feed without closing it. Zero delay removes the throttle.
+func (feed *DcpFeed) SetAckDelay(delay time.Duration) error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{dfCmdSetAckDelay, delay, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return opError(err, resp, 0)
+}
+
+// SetBufferSize changes the flow control buffer size of this connection
+// at runtime to `bufsize` bytes, and sends buffer-acks once `ackThreshold`
+// fraction of the buffer is read. Ignored if flow control was not enabled
+// when the connection was opened.
+func (feed *DcpFeed) SetBufferSize(bufsize uint32, ackThreshold float32) error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{dfCmdSetBufferSize, bufsize, ackThreshold, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return opError(err, resp, 0)
+}
+
+// GetStats returns a copy of the stats for this connection.
+func (feed *DcpFeed) GetStats() (DcpStats, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{dfCmdGetStats, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	if err != nil {
+		return DcpStats{}, err
+	}
+	return resp[0].(DcpStats), nil
+}
+
 // Close this DcpFeed.
 func (feed *DcpFeed) Close() error {
 	respch := make(chan []interface{}, 1)
@@ -147,6 +217,9 @@ const (
 	dfCmdGetSeqnos
 	dfCmdRequestStream
 	dfCmdCloseStream
+	dfCmdSetAckDelay
+	dfCmdSetBufferSize
+	dfCmdGetStats
 	dfCmdClose
 )
 
@@ -172,8 +245,10 @@ func (feed *DcpFeed) genServer(
 		latencyTick = int64(val.(int)) // in milli-seconds
 	}
 	latencyTm := time.NewTicker(time.Duration(latencyTick) * time.Millisecond)
+	ackTm := time.NewTicker(ackDelayTick)
 	defer func() {
 		latencyTm.Stop()
+		ackTm.Stop()
 	}()
 
 loop:
@@ -183,6 +258,12 @@ loop:
 			fmsg := "%v dcp latency stats %v\n"
 			logging.Infof(fmsg, prefix, feed.dcplatency)
 
+		case <-ackTm.C:
+			// send buffer-ack held back by a throttle.
+			if feed.toAckBytes > feed.maxAckBytes {
+				feed.sendBufferAck(true, 0)
+			}
+
 		case msg := <-reqch:
 			cmd := msg[0].(byte)
 			switch cmd {
@@ -226,6 +307,28 @@ loop:
 				err := feed.doDcpCloseStream(vbno, opaqueMSB)
 				respch <- []interface{}{err}
 
+			case dfCmdSetAckDelay:
+				delay := msg[1].(time.Duration)
+				respch := msg[2].(chan []interface{})
+				if delay != feed.ackDelay {
+					fmsg := "%v buffer-ack delay %v -> %v\n"
+					logging.Infof(fmsg, prefix, feed.ackDelay, delay)
+				}
+				feed.ackDelay = delay
+				respch <- []interface{}{nil}
+
+			case dfCmdSetBufferSize:
+				bufsize, ackThreshold := msg[1].(uint32), msg[2].(float32)
+				respch := msg[3].(chan []interface{})
+				respch <- []interface{}{feed.doDcpSetBufferSize(bufsize, ackThreshold)}
+
+			case dfCmdGetStats:
+				respch := msg[1].(chan []interface{})
+				stats := feed.stats
+				stats.BufferSize = uint64(feed.bufsize)
+				stats.MaxAckBytes = uint64(feed.maxAckBytes)
+				respch <- []interface{}{stats}
+
 			case dfCmdClose:
 				feed.sendStreamEnd(feed.outch)
 				respch := msg[1].(chan []interface{})
@@ -274,6 +377,15 @@ func (feed *DcpFeed) handlePacket(
 
 	sendAck := false
 	prefix := feed.logPrefix
+	if pkt.Opcode == transport.DCP_CONTROL && pkt.Opaque == opaqueControl {
+		// response to a DCP_CONTROL sent by doDcpSetBufferSize()
+		if res.Status != transport.SUCCESS {
+			feed.stats.TotalControlFailed++
+			fmsg := "%v DCP_CONTROL received status %v\n"
+			logging.Errorf(fmsg, prefix, res.Status)
+		}
+		return "ok"
+	}
 	stream := feed.vbstreams[vb]
 	defer func() { feed.dcplatency.Add(computeLatency(stream)) }()
 	if stream == nil {
@@ -290,10 +402,39 @@ func (feed *DcpFeed) handlePacket(
 	case transport.DCP_MUTATION, transport.DCP_DELETION,
 		transport.DCP_EXPIRATION:
 		event = newDcpEvent(pkt, stream)
+		if feed.features[transport.FeatureCollections] {
+			if err := event.decodeCollectionID(); err != nil {
+				fmsg := "%v ##%x vb %d key %q: %v\n"
+				logging.Errorf(fmsg, prefix, stream.AppOpaque, vb, pkt.Key, err)
+			}
+		}
 		stream.Seqno = event.Seqno
 		feed.stats.TotalMutation++
 		sendAck = true
 
+	case transport.DCP_SYSTEM_EVENT, transport.DCP_SEQNO_ADVANCED:
+		// collections are filtered downstream, by collection-id of the
+		// mutations, only the seqno of the event is passed on so that
+		// a snapshot ending with it can be completed downstream.
+		if len(pkt.Extras) < 8 {
+			fmsg := "%v ##%x %v for vb %d without seqno\n"
+			logging.Errorf(fmsg, prefix, stream.AppOpaque, pkt.Opcode, vb)
+			break
+		}
+		event = &DcpEvent{
+			Opcode:  transport.DCP_SEQNO_ADVANCED, // opcode re-write !!
+			VBucket: stream.Vbucket,
+			VBuuid:  stream.Vbuuid,
+			Opaque:  appOpaque(pkt.Opaque),
+			Seqno:   binary.BigEndian.Uint64(pkt.Extras[:8]),
+			Ctime:   time.Now().UnixNano(),
+		}
+		stream.Seqno = event.Seqno
+		if pkt.Opcode == transport.DCP_SYSTEM_EVENT {
+			feed.stats.TotalSystemEvent++
+		}
+		sendAck = true
+
 	case transport.DCP_STREAMEND:
 		event = newDcpEvent(pkt, stream)
 		sendAck = true
@@ -472,6 +613,17 @@ func (feed *DcpFeed) doDcpOpen(
 	opaque uint16,
 	rcvch chan []interface{}) error {
 
+	prefix := feed.logPrefix
+	if len(feed.hello) > 0 {
+		if err := feed.doDcpHello(name, opaque, rcvch); err != nil {
+			return err
+		}
+	}
+
+	flags := transport.DCP_OPEN_PRODUCER // we are consumer
+	if feed.features[transport.FeatureXattr] {
+		flags |= transport.DCP_OPEN_INCLUDE_XATTRS
+	}
 	rq := &transport.MCRequest{
 		Opcode: transport.DCP_OPEN,
 		Key:    []byte(name),
@@ -479,9 +631,8 @@ func (feed *DcpFeed) doDcpOpen(
 	}
 	rq.Extras = make([]byte, 8)
 	binary.BigEndian.PutUint32(rq.Extras[:4], sequence)
-	binary.BigEndian.PutUint32(rq.Extras[4:], 1) // we are consumer
+	binary.BigEndian.PutUint32(rq.Extras[4:], flags)
 
-	prefix := feed.logPrefix
 	if err := feed.conn.Transmit(rq); err != nil {
 		return err
 	}
@@ -551,8 +702,92 @@ func (feed *DcpFeed) doDcpOpen(
 			logging.Errorf(fmsg, prefix, opaque, req.Status)
 			return ErrorConnection
 		}
-		feed.maxAckBytes = uint32(bufferAckThreshold * float32(bufsize))
+		feed.bufsize = bufsize
+		feed.maxAckBytes = uint32(feed.ackThreshold * float32(bufsize))
+	}
+	return nil
+}
+
+// negotiate datatype features with producer, before opening the
+// connection. Producers that do not know HELLO enable no features.
+func (feed *DcpFeed) doDcpHello(
+	name string, opaque uint16, rcvch chan []interface{}) error {
+
+	rq := &transport.MCRequest{
+		Opcode: transport.HELLO,
+		Key:    []byte(name),
+		Opaque: opaqueHello,
+		Body:   make([]byte, 2*len(feed.hello)),
+	}
+	for i, feature := range feed.hello {
+		binary.BigEndian.PutUint16(rq.Body[2*i:], uint16(feature))
+	}
+
+	prefix := feed.logPrefix
+	if err := feed.conn.Transmit(rq); err != nil {
+		fmsg := "%v ##%x doDcpHello.Transmit(): %v"
+		logging.Errorf(fmsg, prefix, opaque, err)
+		return err
+	}
+	msg, ok := <-rcvch
+	if !ok {
+		logging.Errorf("%v ##%x doDcpHello.rcvch closed", prefix, opaque)
+		return ErrorConnection
+	}
+	pkt := msg[0].(*transport.MCRequest)
+	status := transport.Status(pkt.VBucket)
+	if pkt.Opcode != transport.HELLO {
+		logging.Errorf("%v ##%x unexpected #%v", prefix, opaque, pkt.Opcode)
+		return ErrorConnection
+	} else if status == transport.UNKNOWN_COMMAND {
+		fmsg := "%v ##%x HELLO not supported, no datatype features"
+		logging.Warnf(fmsg, prefix, opaque)
+		return nil
+	} else if status != transport.SUCCESS {
+		fmsg := "%v ##%x doDcpHello response status %v"
+		logging.Errorf(fmsg, prefix, opaque, status)
+		return ErrorConnection
+	}
+	for i := 0; i+2 <= len(pkt.Body); i += 2 {
+		feature := transport.Feature(binary.BigEndian.Uint16(pkt.Body[i:]))
+		feed.features[feature] = true
+	}
+	fmsg := "%v ##%x HELLO requested %v enabled %v"
+	logging.Infof(fmsg, prefix, opaque, feed.hello, feed.features)
+	return nil
+}
+
+// send a DCP control message to resize the window for this connection.
+// Response is handled asynchronously by handlePacket(), after the
+// mutations already in flight.
+func (feed *DcpFeed) doDcpSetBufferSize(
+	bufsize uint32, ackThreshold float32) error {
+
+	prefix := feed.logPrefix
+	if feed.bufsize == 0 || bufsize == 0 {
+		return nil // flow control not enabled for this connection
+	}
+	if bufsize != feed.bufsize {
+		rq := &transport.MCRequest{
+			Opcode: transport.DCP_CONTROL,
+			Key:    []byte("connection_buffer_size"),
+			Body:   []byte(strconv.Itoa(int(bufsize))),
+			Opaque: opaqueControl,
+		}
+		if err := feed.conn.Transmit(rq); err != nil {
+			fmsg := "%v doDcpSetBufferSize.DCP_CONTROL.Transmit(): %v"
+			logging.Errorf(fmsg, prefix, err)
+			return err
+		}
+		fmsg := "%v buffer size %v -> %v, ack threshold %v -> %v\n"
+		logging.Infof(
+			fmsg, prefix, feed.bufsize, bufsize, feed.ackThreshold,
+			ackThreshold)
+		feed.bufsize = bufsize
+		feed.stats.TotalBufferResize++
 	}
+	feed.ackThreshold = ackThreshold
+	feed.maxAckBytes = uint32(ackThreshold * float32(bufsize))
 	return nil
 }
 
@@ -672,8 +907,14 @@ func (feed *DcpFeed) sendBufferAck(sendAck bool, bytes uint32) {
 	prefix := feed.logPrefix
 	if sendAck {
 		totalBytes := feed.toAckBytes + bytes
-		if totalBytes > feed.maxAckBytes {
+		if totalBytes > feed.maxAckBytes && feed.ackDelay > 0 &&
+			time.Since(feed.lastAck) < feed.ackDelay {
+			// throttled, hold back the ack until ackDelay elapses.
+			feed.stats.TotalBufferAckDelayed++
+
+		} else if totalBytes > feed.maxAckBytes {
 			feed.toAckBytes = 0
+			feed.lastAck = time.Now()
 			bufferAck := &transport.MCRequest{
 				Opcode: transport.DCP_BUFFERACK,
 			}
@@ -728,6 +969,10 @@ type DcpEvent struct {
 	Key, Value []byte                // Item key/value
 	OldValue   []byte                // TODO: TBD: old document value
 	Cas        uint64                // CAS value of the item
+	Datatype   uint8                 // datatype of Value, once decoded
+	Xattrs     map[string][]byte     // extended attributes of the item
+	// collection of the item, 0 is the default collection
+	CollectionID uint32
 	// meta fields
 	Seqno uint64 // seqno. of the mutation, doubles as rollback-seqno
 	// https://issues.couchbase.com/browse/MB-15333,
@@ -742,7 +987,7 @@ type DcpEvent struct {
 	SnapshotType uint32 // 0: disk 1: memory
 	// failoverlog
 	FailoverLog *FailoverLog // Failover log containing vvuid and sequnce number
-	Error       error        // Error value in case of a failure
+	Error       error        // Error value in case of a failure, like undecodable value
 	// stats
 	Ctime int64
 }
@@ -757,8 +1002,14 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) *DcpEvent {
 	}
 	event.Key = make([]byte, len(rq.Key))
 	copy(event.Key, rq.Key)
-	event.Value = make([]byte, len(rq.Body))
-	copy(event.Value, rq.Body)
+	if err := event.decodeValue(rq.DataType, rq.Body); err != nil {
+		fmsg := "DCPT vb %d key %q datatype %x: %v\n"
+		logging.Errorf(fmsg, stream.Vbucket, rq.Key, rq.DataType, err)
+		// pass on the value as received, with the error, so that it is
+		// not taken for an empty document downstream.
+		event.Datatype, event.Value = rq.DataType, append([]byte(nil), rq.Body...)
+		event.Xattrs, event.Error = nil, err
+	}
 
 	// 16 LSBits are used by client library to encode vbucket number.
 	// 16 MSBits are left for application to multiplex on opaque value.
@@ -792,6 +1043,80 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) *DcpEvent {
 	return event
 }
 
+// decodeCollectionID strips the unsigned LEB128 collection-id prefixing
+// the key of a mutation, when collections are negotiated.
+func (event *DcpEvent) decodeCollectionID() error {
+	var cid uint32
+	for i, b := range event.Key {
+		if i >= 5 {
+			break
+		}
+		cid |= uint32(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			event.CollectionID, event.Key = cid, event.Key[i+1:]
+			return nil
+		}
+	}
+	return ErrorInvalidCollectionID
+}
+
+// decodeValue uncompresses a snappy compressed value and splits the
+// xattrs section from the document.
+func (event *DcpEvent) decodeValue(datatype uint8, body []byte) error {
+	if datatype&transport.DatatypeSnappy != 0 {
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			return err
+		}
+		body = decoded
+		datatype &^= transport.DatatypeSnappy
+	} else {
+		body = append([]byte(nil), body...)
+	}
+	if datatype&transport.DatatypeXattr != 0 {
+		xattrs, doc, err := parseXattrs(body)
+		if err != nil {
+			return err
+		}
+		event.Xattrs, body = xattrs, doc
+		datatype &^= transport.DatatypeXattr
+	}
+	event.Datatype, event.Value = datatype, body
+	return nil
+}
+
+// parse xattrs section prefixing a value, 4 byte length of the section
+// followed by pairs of 4 byte length, key, 0x00, value, 0x00. Return
+// xattrs and the document following the section.
+func parseXattrs(body []byte) (map[string][]byte, []byte, error) {
+	if len(body) < 4 {
+		return nil, nil, ErrorInvalidXattrs
+	}
+	end := 4 + int(binary.BigEndian.Uint32(body[:4]))
+	if end > len(body) {
+		return nil, nil, ErrorInvalidXattrs
+	}
+	xattrs := make(map[string][]byte)
+	for pos := 4; pos < end; {
+		if pos+4 > end {
+			return nil, nil, ErrorInvalidXattrs
+		}
+		plen := int(binary.BigEndian.Uint32(body[pos:]))
+		pos += 4
+		if plen < 2 || pos+plen > end {
+			return nil, nil, ErrorInvalidXattrs
+		}
+		pair := body[pos : pos+plen]
+		i := bytes.IndexByte(pair, 0)
+		if i < 0 || i == plen-1 || pair[plen-1] != 0 {
+			return nil, nil, ErrorInvalidXattrs
+		}
+		xattrs[string(pair[:i])] = pair[i+1 : plen-1]
+		pos += plen
+	}
+	return xattrs, body[end:], nil
+}
+
 func (event *DcpEvent) String() string {
 	name := transport.CommandNames[event.Opcode]
 	if name == "" {
@@ -806,6 +1131,16 @@ type DcpStats struct {
 	TotalMutation      uint64
 	TotalBufferAckSent uint64
 	TotalSnapShot      uint64
+	// buffer-acks held back by SetAckDelay()
+	TotalBufferAckDelayed uint64
+	// connection buffer resized by SetBufferSize()
+	TotalBufferResize  uint64
+	TotalControlFailed uint64
+	// DCP_SYSTEM_EVENT for collections
+	TotalSystemEvent uint64
+	// current flow control settings
+	BufferSize  uint64
+	MaxAckBytes uint64
 }
 
 // FailoverLog containing vvuid and sequnce number
@@ -0,0 +1,101 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+)
+
+func TestSnapshotEndingWithSystemEvent(t *testing.T) {
+	outch := make(chan *DcpEvent, 10)
+	feed := &DcpFeed{
+		outch:       outch,
+		vbstreams:   map[uint16]*DcpStream{5: {AppOpaque: 0xa, Vbucket: 5, Vbuuid: 100}},
+		maxAckBytes: 1 << 20,
+		dcplatency:  &Average{},
+		features:    map[transport.Feature]bool{},
+	}
+	opaque := uint32(0xa<<16 | 5)
+
+	extras := make([]byte, 20)
+	binary.BigEndian.PutUint64(extras[0:8], 10)
+	binary.BigEndian.PutUint64(extras[8:16], 12)
+	feed.handlePacket(&transport.MCRequest{
+		Opcode: transport.DCP_SNAPSHOT, Opaque: opaque, Extras: extras}, 20)
+
+	extras = make([]byte, 31)
+	binary.BigEndian.PutUint64(extras[0:8], 11)
+	feed.handlePacket(&transport.MCRequest{
+		Opcode: transport.DCP_MUTATION, Opaque: opaque, Extras: extras,
+		Key: []byte("doc"), Body: []byte(`{}`)}, 40)
+
+	// collection created, extras are seqno, event-id and version.
+	extras = make([]byte, 13)
+	binary.BigEndian.PutUint64(extras[0:8], 12)
+	feed.handlePacket(&transport.MCRequest{
+		Opcode: transport.DCP_SYSTEM_EVENT, Opaque: opaque, Extras: extras,
+		Key: []byte("collection")}, 40)
+
+	var events []*DcpEvent
+	for len(outch) > 0 {
+		events = append(events, <-outch)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", len(events))
+	}
+	snapshot, last := events[0], events[2]
+	if last.Opcode != transport.DCP_SEQNO_ADVANCED {
+		t.Fatalf("expected %v, got %v", transport.DCP_SEQNO_ADVANCED, last.Opcode)
+	}
+	if last.Seqno != snapshot.SnapendSeq {
+		t.Errorf("expected seqno %v, got %v", snapshot.SnapendSeq, last.Seqno)
+	}
+	if last.VBucket != 5 || last.VBuuid != 100 || last.Opaque != 0xa {
+		t.Errorf("unexpected event %v", last)
+	}
+	if feed.vbstreams[5].Seqno != 12 || feed.stats.TotalSystemEvent != 1 {
+		t.Errorf("unexpected stream seqno %v, system events %v",
+			feed.vbstreams[5].Seqno, feed.stats.TotalSystemEvent)
+	}
+}
+
+func TestMutationWithUndecodableValue(t *testing.T) {
+	outch := make(chan *DcpEvent, 10)
+	feed := &DcpFeed{
+		outch:       outch,
+		vbstreams:   map[uint16]*DcpStream{5: {AppOpaque: 0xa, Vbucket: 5, Vbuuid: 100}},
+		maxAckBytes: 1 << 20,
+		dcplatency:  &Average{},
+		features:    map[transport.Feature]bool{},
+	}
+	opaque := uint32(0xa<<16 | 5)
+
+	tests := []struct {
+		name     string
+		datatype uint8
+		body     []byte
+	}{
+		{"bad snappy", transport.DatatypeSnappy, []byte{0xff, 0xff, 0xff}},
+		{"bad xattrs", transport.DatatypeXattr, []byte{0, 0, 0, 10, '{', '}'}},
+	}
+	for i, test := range tests {
+		extras := make([]byte, 31)
+		binary.BigEndian.PutUint64(extras[0:8], uint64(i+1))
+		feed.handlePacket(&transport.MCRequest{
+			Opcode: transport.DCP_MUTATION, Opaque: opaque, Extras: extras,
+			DataType: test.datatype, Key: []byte("doc"), Body: test.body}, 40)
+
+		e := <-outch
+		if e.Error == nil {
+			t.Errorf("%v: expected decode error", test.name)
+		}
+		// value is passed on as received, not as an empty document.
+		if string(e.Value) != string(test.body) || e.Datatype != test.datatype {
+			t.Errorf("%v: unexpected value %v datatype %x", test.name, e.Value, e.Datatype)
+		}
+		if e.Seqno != uint64(i+1) || feed.vbstreams[5].Seqno != uint64(i+1) {
+			t.Errorf("%v: unexpected seqno %v", test.name, e.Seqno)
+		}
+	}
+}
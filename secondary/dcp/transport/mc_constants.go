@@ -55,6 +55,8 @@ const (
 	RDECR      = CommandCode(0x3b)
 	RDECRQ     = CommandCode(0x3c)
 
+	HELLO = CommandCode(0x1f) // Negotiate features with the server
+
 	SASL_LIST_MECHS = CommandCode(0x20)
 	SASL_AUTH       = CommandCode(0x21)
 	SASL_STEP       = CommandCode(0x22)
@@ -84,11 +86,37 @@ const (
 	DCP_BUFFERACK   = CommandCode(0x5d) // DCP Buffer Acknowledgement
 	DCP_CONTROL     = CommandCode(0x5e) // Set flow control params
 
+	DCP_SYSTEM_EVENT   = CommandCode(0x5f) // Collection created or dropped
+	DCP_SEQNO_ADVANCED = CommandCode(0x64) // Seqno moved past filtered events
+
 	SELECT_BUCKET = CommandCode(0x89) // Select bucket
 
 	OBSERVE = CommandCode(0x92)
 )
 
+// Datatype bits of a document value, refer MCRequest.DataType.
+const (
+	DatatypeJSON   = uint8(0x01) // value is a JSON document
+	DatatypeSnappy = uint8(0x02) // value is snappy compressed
+	DatatypeXattr  = uint8(0x04) // value is prefixed by an xattrs section
+)
+
+// Feature negotiated with HELLO.
+type Feature uint16
+
+const (
+	FeatureXattr       = Feature(0x06)
+	FeatureSnappy      = Feature(0x0a)
+	FeatureJSON        = Feature(0x0b)
+	FeatureCollections = Feature(0x12) // keys are prefixed by collection id
+)
+
+// DCP_OPEN flags.
+const (
+	DCP_OPEN_PRODUCER       = uint32(0x01)
+	DCP_OPEN_INCLUDE_XATTRS = uint32(0x04)
+)
+
 // Status field for memcached response.
 type Status uint16
 
@@ -167,6 +195,8 @@ func init() {
 	CommandNames[RDECR] = "RDECR"
 	CommandNames[RDECRQ] = "RDECRQ"
 
+	CommandNames[HELLO] = "HELLO"
+
 	CommandNames[SASL_LIST_MECHS] = "SASL_LIST_MECHS"
 	CommandNames[SASL_AUTH] = "SASL_AUTH"
 	CommandNames[SASL_STEP] = "SASL_STEP"
@@ -194,6 +224,8 @@ func init() {
 	CommandNames[DCP_NOOP] = "DCP_NOOP"
 	CommandNames[DCP_BUFFERACK] = "DCP_BUFFERACK"
 	CommandNames[DCP_CONTROL] = "DCP_CONTROL"
+	CommandNames[DCP_SYSTEM_EVENT] = "DCP_SYSTEM_EVENT"
+	CommandNames[DCP_SEQNO_ADVANCED] = "DCP_SEQNO_ADVANCED"
 	CommandNames[DCP_GET_SEQNO] = "DCP_GET_SEQNO"
 
 	StatusNames = make(map[Status]string)
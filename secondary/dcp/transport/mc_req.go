@@ -22,6 +22,8 @@ type MCRequest struct {
 	Opaque uint32
 	// The vbucket to which this command belongs
 	VBucket uint16
+	// Datatype of the body, refer Datatype* bits
+	DataType uint8
 	// Command extras, key, and body
 	Extras, Key, Body []byte
 }
@@ -51,7 +53,7 @@ func (req *MCRequest) fillHeaderBytes(data []byte) int {
 	// 4
 	data[pos] = byte(len(req.Extras))
 	pos++
-	// data[pos] = 0
+	data[pos] = req.DataType
 	pos++
 	binary.BigEndian.PutUint16(data[pos:pos+2], req.VBucket)
 	pos += 2
@@ -142,6 +144,7 @@ func (req *MCRequest) Receive(r io.Reader, hdrBytes []byte) (int, error) {
 	elen := int(hdrBytes[4])
 
 	req.Opcode = CommandCode(hdrBytes[1])
+	req.DataType = hdrBytes[5]
 	// Vbucket at 6:7
 	req.VBucket = binary.BigEndian.Uint16(hdrBytes[6:])
 	bodyLen := int(binary.BigEndian.Uint32(hdrBytes[8:]) -
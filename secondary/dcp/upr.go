@@ -170,6 +170,9 @@ const (
 	ufCmdRequestStream byte = iota + 1
 	ufCmdCloseStream
 	ufCmdGetSeqnos
+	ufCmdSetAckDelay
+	ufCmdSetBufferSize
+	ufCmdGetStats
 	ufCmdClose
 )
 
@@ -211,6 +214,36 @@ func (feed *DcpFeed) DcpGetSeqnos() (map[uint16]uint64, error) {
 	return resp[0].(map[uint16]uint64), nil
 }
 
+// SetAckDelay throttles buffer-acks on connections with all nodes,
+// refer memcached.DcpFeed.SetAckDelay(). Synchronous call.
+func (feed *DcpFeed) SetAckDelay(delay time.Duration) error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{ufCmdSetAckDelay, delay, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return opError(err, resp, 0)
+}
+
+// SetBufferSize resizes the flow control buffer on connections with all
+// nodes, refer memcached.DcpFeed.SetBufferSize(). Synchronous call.
+func (feed *DcpFeed) SetBufferSize(bufsize uint32, ackThreshold float32) error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{ufCmdSetBufferSize, bufsize, ackThreshold, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return opError(err, resp, 0)
+}
+
+// GetStats returns the stats of connections with all nodes, added
+// together. Synchronous call.
+func (feed *DcpFeed) GetStats() (memcached.DcpStats, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{ufCmdGetStats, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	if err = opError(err, resp, 1); err != nil {
+		return memcached.DcpStats{}, err
+	}
+	return resp[0].(memcached.DcpStats), nil
+}
+
 // Close DcpFeed. Synchronous call.
 func (feed *DcpFeed) Close() error {
 	respch := make(chan []interface{}, 1)
@@ -267,6 +300,22 @@ loop:
 				seqnos, err := feed.dcpGetSeqnos()
 				respch <- []interface{}{seqnos, err}
 
+			case ufCmdSetAckDelay:
+				delay := msg[1].(time.Duration)
+				respch := msg[2].(chan []interface{})
+				respch <- []interface{}{feed.dcpSetAckDelay(delay)}
+
+			case ufCmdSetBufferSize:
+				bufsize, ackThreshold := msg[1].(uint32), msg[2].(float32)
+				respch := msg[3].(chan []interface{})
+				err := feed.dcpSetBufferSize(bufsize, ackThreshold)
+				respch <- []interface{}{err}
+
+			case ufCmdGetStats:
+				respch := msg[1].(chan []interface{})
+				stats, err := feed.dcpGetStats()
+				respch <- []interface{}{stats, err}
+
 			case ufCmdClose:
 				closeNodeFeeds()
 				respch := msg[1].(chan []interface{})
@@ -407,6 +456,54 @@ func (feed *DcpFeed) dcpCloseStream(vb, opaqueMSB uint16) error {
 	return nil
 }
 
+func (feed *DcpFeed) dcpSetAckDelay(delay time.Duration) (err error) {
+	for _, nodeFeeds := range feed.nodeFeeds {
+		for _, singleFeed := range nodeFeeds {
+			if e := singleFeed.dcpFeed.SetAckDelay(delay); e != nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (feed *DcpFeed) dcpSetBufferSize(
+	bufsize uint32, ackThreshold float32) (err error) {
+
+	for _, nodeFeeds := range feed.nodeFeeds {
+		for _, singleFeed := range nodeFeeds {
+			e := singleFeed.dcpFeed.SetBufferSize(bufsize, ackThreshold)
+			if e != nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (feed *DcpFeed) dcpGetStats() (memcached.DcpStats, error) {
+	var stats memcached.DcpStats
+	for _, nodeFeeds := range feed.nodeFeeds {
+		for _, singleFeed := range nodeFeeds {
+			s, err := singleFeed.dcpFeed.GetStats()
+			if err != nil {
+				return stats, err
+			}
+			stats.TotalBytes += s.TotalBytes
+			stats.TotalMutation += s.TotalMutation
+			stats.TotalBufferAckSent += s.TotalBufferAckSent
+			stats.TotalSnapShot += s.TotalSnapShot
+			stats.TotalBufferAckDelayed += s.TotalBufferAckDelayed
+			stats.TotalBufferResize += s.TotalBufferResize
+			stats.TotalControlFailed += s.TotalControlFailed
+			stats.TotalSystemEvent += s.TotalSystemEvent
+			stats.BufferSize += s.BufferSize
+			stats.MaxAckBytes += s.MaxAckBytes
+		}
+	}
+	return stats, nil
+}
+
 func (feed *DcpFeed) dcpGetSeqnos() (map[uint16]uint64, error) {
 	count := len(feed.nodeFeeds)
 	ch := make(chan []interface{}, count)
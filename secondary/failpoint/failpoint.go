@@ -0,0 +1,195 @@
+// Package failpoint injects faults at named points in the code, so that
+// tests can fail and crash components deterministically.
+//
+// A failpoint is a call to Inject with the name of the point. It is a
+// no-op unless the point is enabled, by Enable or by listing it in the
+// INDEXER_FAILPOINTS environment variable of the process, like,
+//
+//	INDEXER_FAILPOINTS="indexer.slice.write=exit@100;indexer.kvsender.request=error"
+//
+// An enabled point fires on its n-th hit, `@n` in the specification,
+// and on every hit after that, till it is disabled. Hits are counted
+// from the time a point is enabled.
+package failpoint
+
+import "errors"
+import "fmt"
+import "os"
+import "strconv"
+import "strings"
+import "sync"
+import "sync/atomic"
+
+import "github.com/couchbase/indexing/secondary/logging"
+
+// EnvFailpoints lists failpoints to enable on process start.
+const EnvFailpoints = "INDEXER_FAILPOINTS"
+
+// ExitCode of a process exiting at a failpoint.
+const ExitCode = 86
+
+// ErrorInjected is returned by Inject for points with action Error.
+var ErrorInjected = errors.New("failpoint.injected")
+
+// Action taken when an enabled failpoint fires.
+type Action int
+
+const (
+	// Off does nothing, the point only counts its hits.
+	Off Action = iota
+	// Error returns ErrorInjected to the caller, to be handled like any
+	// other error at that point.
+	Error
+	// Panic with ErrorInjected.
+	Panic
+	// Exit the process with ExitCode, as if it crashed at that point.
+	Exit
+	// Hang blocks the calling goroutine forever, as if the process
+	// crashed at that point while the rest of it keeps running.
+	Hang
+)
+
+var actionNames = map[Action]string{
+	Off: "off", Error: "error", Panic: "panic", Exit: "exit", Hang: "hang",
+}
+
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction by its name.
+func ParseAction(name string) (Action, error) {
+	for action, s := range actionNames {
+		if s == name {
+			return action, nil
+		}
+	}
+	return Off, fmt.Errorf("invalid failpoint action %q", name)
+}
+
+type failpoint struct {
+	action Action
+	nth    int // fire from n-th hit
+	hits   int
+}
+
+var enabled int32 // number of enabled points, for a cheap Inject
+var mu sync.Mutex
+var points = make(map[string]*failpoint)
+
+func init() {
+	if spec := os.Getenv(EnvFailpoints); spec != "" {
+		if err := EnableSpec(spec); err != nil {
+			logging.Errorf("failpoint: %v: %v\n", EnvFailpoints, err)
+		}
+	}
+}
+
+// Enable failpoint name to take action on its n-th hit and after. Hits
+// of an already enabled point are counted afresh.
+func Enable(name string, action Action, nth int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := points[name]; !ok {
+		atomic.AddInt32(&enabled, 1)
+	}
+	points[name] = &failpoint{action: action, nth: nth}
+	logging.Infof("failpoint: enabled %v=%v@%v\n", name, action, nth)
+}
+
+// EnableSpec enables failpoints specified as `name=action[@n]`,
+// separated by `;`.
+func EnableSpec(spec string) error {
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, term := item, ""
+		if i := strings.Index(item, "="); i >= 0 {
+			name, term = item[:i], item[i+1:]
+		}
+		nth := 1
+		if i := strings.Index(term, "@"); i >= 0 {
+			n, err := strconv.Atoi(term[i+1:])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid hit count in %q", item)
+			}
+			term, nth = term[:i], n
+		}
+		action, err := ParseAction(term)
+		if err != nil {
+			return err
+		}
+		Enable(name, action, nth)
+	}
+	return nil
+}
+
+// Disable failpoint name.
+func Disable(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := points[name]; ok {
+		delete(points, name)
+		atomic.AddInt32(&enabled, -1)
+	}
+}
+
+// Reset disables all failpoints.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	points = make(map[string]*failpoint)
+	atomic.StoreInt32(&enabled, 0)
+}
+
+// Hits of failpoint name since it was enabled, 0 if not enabled.
+func Hits(name string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	if fp, ok := points[name]; ok {
+		return fp.hits
+	}
+	return 0
+}
+
+// Inject a fault at failpoint name, if enabled. Returns ErrorInjected
+// for action Error, otherwise nil unless it does not return at all.
+func Inject(name string) error {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return nil
+	}
+
+	mu.Lock()
+	fp, ok := points[name]
+	if !ok {
+		mu.Unlock()
+		return nil
+	}
+	fp.hits++
+	action, hits := fp.action, fp.hits
+	if hits < fp.nth {
+		action = Off
+	}
+	mu.Unlock()
+
+	if action != Off {
+		logging.Infof("failpoint: %v hit %v, %v\n", name, hits, action)
+	}
+	switch action {
+	case Error:
+		return ErrorInjected
+	case Panic:
+		panic(ErrorInjected)
+	case Exit:
+		logging.Infof("failpoint: %v exiting with %v\n", name, ExitCode)
+		os.Exit(ExitCode)
+	case Hang:
+		select {}
+	}
+	return nil
+}
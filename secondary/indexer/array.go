@@ -14,6 +14,7 @@ import (
 	"errors"
 	"github.com/couchbase/indexing/secondary/collatejson"
 	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/queryutil"
 	"github.com/couchbase/indexing/secondary/logging"
 	"sort"
 )
@@ -23,6 +24,17 @@ var (
 	ErrArrayKeyTooLong     = errors.New("Array to be indexed too long")
 )
 
+// Returns whether array items are distinct and position of the array in
+// secondary key, for an array index. Adaptive index keys are a single array
+// of distinct [fieldpath, value] pairs.
+func getArrayExprPosition(defn common.IndexDefn) (bool, int, error) {
+	if defn.IsAdaptive {
+		return true, 0, nil
+	}
+	_, isDistinct, arrayPos, err := queryutil.GetArrayExpressionPosition(defn.SecExprs)
+	return isDistinct, arrayPos, err
+}
+
 // Given the input secondary key, this method creates the product of array items
 // with all other items in the composite secondary key
 // Example: if input key is [35, ["Dave", "Ann", "Pete"]] and arrayPos = 1, this generates the product as:
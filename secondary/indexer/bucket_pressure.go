@@ -0,0 +1,233 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/platform"
+)
+
+//bucketPressure tracks the mutation queue memory of a bucket in a stream
+//against its share of the mutation queue memory. A stream filling its
+//queue beyond its share is throttled by delaying the DCP buffer acks of
+//the bucket in the projector feed, so only the offending bucket slows down
+//and the rest of the buckets keep moving.
+type bucketPressure struct {
+	memUsed   int64
+	memShare  int64
+	throttled bool
+	ackDelay  time.Duration
+}
+
+//level returns memory used as a percentage of the share
+func (bp *bucketPressure) level() int64 {
+	if bp.memShare <= 0 {
+		return 0
+	}
+	return bp.memUsed * 100 / bp.memShare
+}
+
+//monitorBucketPressure periodically checks the mutation queues
+//till mutation manager shuts down
+func (m *mutationMgr) monitorBucketPressure() {
+
+	interval := m.config["bucket_pressure.check_interval"].Int()
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.checkBucketPressure()
+
+		case <-m.shutdownCh:
+			return
+		}
+	}
+}
+
+//checkBucketPressure updates the memory used by each stream's bucket queue
+//and throttles or releases the stream of a bucket, based on its share of
+//the mutation queue memory. Throttle changes are sent to the supervisor
+//which forwards them to the projectors via kv sender.
+func (m *mutationMgr) checkBucketPressure() {
+
+	var msgs []Message
+
+	func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		enabled := m.config["bucket_pressure.enabled"].Bool()
+		highMark := m.config["bucket_pressure.high_mark"].Float64()
+		lowMark := m.config["bucket_pressure.low_mark"].Float64()
+		ackDelay := time.Duration(m.config["bucket_pressure.ack_delay"].Int()) * time.Millisecond
+		maxAckDelay := time.Duration(m.config["bucket_pressure.max_ack_delay"].Int()) * time.Millisecond
+
+		//under memory pressure, throttle every stream above the low mark
+		if m.memPressure {
+			highMark = lowMark
+		}
+
+		numQueues := 0
+		for _, bucketQueueMap := range m.streamBucketQueueMap {
+			numQueues += len(bucketQueueMap)
+		}
+		var memShare int64
+		if numQueues != 0 {
+			memShare = platform.LoadInt64(&m.maxMemory) / int64(numQueues)
+		}
+
+		pressureMap := make(map[common.StreamId]map[string]*bucketPressure)
+		for streamId, bucketQueueMap := range m.streamBucketQueueMap {
+			pressureMap[streamId] = make(map[string]*bucketPressure)
+			for bucket, q := range bucketQueueMap {
+
+				bp, ok := m.bucketPressureMap[streamId][bucket]
+				if !ok {
+					bp = &bucketPressure{}
+				}
+				prevUsed := bp.memUsed
+				bp.memUsed = q.queue.GetMemUsed()
+				bp.memShare = memShare
+				pressureMap[streamId][bucket] = bp
+
+				high := int64(highMark * float64(memShare))
+				low := int64(lowMark * float64(memShare))
+
+				switch {
+				case enabled && !bp.throttled && bp.memUsed > high:
+					bp.throttled = true
+					bp.ackDelay = ackDelay
+					m.numThrottles[bucket]++
+					logging.Infof("MutationMgr::checkBucketPressure Throttle %v %v "+
+						"MemUsed %v Share %v", streamId, bucket, bp.memUsed, memShare)
+
+				case enabled && bp.throttled && bp.memUsed > high &&
+					bp.memUsed > prevUsed && bp.ackDelay < maxAckDelay:
+					//queue still growing, slow down further
+					bp.ackDelay *= 2
+					if bp.ackDelay > maxAckDelay {
+						bp.ackDelay = maxAckDelay
+					}
+
+				case bp.throttled && (!enabled || bp.memUsed < low):
+					bp.throttled = false
+					bp.ackDelay = 0
+					logging.Infof("MutationMgr::checkBucketPressure Release %v %v "+
+						"MemUsed %v Share %v", streamId, bucket, bp.memUsed, memShare)
+
+				default:
+					continue
+				}
+
+				msgs = append(msgs, &MsgBucketPressure{streamId: streamId,
+					bucket:    bucket,
+					throttled: bp.throttled,
+					ackDelay:  bp.ackDelay})
+			}
+		}
+
+		//release the stream of a bucket gone away while throttled
+		//(stream closed, bucket removed or merged to MAINT_STREAM)
+		for streamId, bucketPressureMap := range m.bucketPressureMap {
+			for bucket, bp := range bucketPressureMap {
+				if _, ok := pressureMap[streamId][bucket]; !ok && bp.throttled {
+					logging.Infof("MutationMgr::checkBucketPressure Release %v %v "+
+						"Removed From Stream", streamId, bucket)
+					msgs = append(msgs, &MsgBucketPressure{streamId: streamId,
+						bucket:    bucket,
+						throttled: false})
+				}
+			}
+		}
+
+		m.bucketPressureMap = pressureMap
+		m.updateBucketPressureStats()
+	}()
+
+	for _, msg := range msgs {
+		m.internalRecvCh <- msg
+	}
+}
+
+//releaseBucketPressure releases the stream of a bucket which is removed
+//from the stream, if throttled. Otherwise scans on the bucket stay
+//throttled on a stream which no longer exists.
+//Must be called with the mutation manager lock held.
+func (m *mutationMgr) releaseBucketPressure(streamId common.StreamId, bucket string) {
+
+	bp, ok := m.bucketPressureMap[streamId][bucket]
+	if !ok {
+		return
+	}
+
+	delete(m.bucketPressureMap[streamId], bucket)
+	if len(m.bucketPressureMap[streamId]) == 0 {
+		delete(m.bucketPressureMap, streamId)
+	}
+
+	if bp.throttled {
+		logging.Infof("MutationMgr::releaseBucketPressure Release %v %v "+
+			"Removed From Stream", streamId, bucket)
+		m.internalRecvCh <- &MsgBucketPressure{streamId: streamId,
+			bucket:    bucket,
+			throttled: false}
+	}
+	m.updateBucketPressureStats()
+}
+
+//updateBucketPressureStats aggregates the pressure of a bucket
+//across streams into bucket stats
+func (m *mutationMgr) updateBucketPressureStats() {
+
+	stats := m.stats.Get()
+	if stats == nil {
+		return
+	}
+
+	for bucket, bs := range stats.buckets {
+		var memUsed, level, ackDelay int64
+		var throttled bool
+		for _, bucketPressureMap := range m.bucketPressureMap {
+			if bp, ok := bucketPressureMap[bucket]; ok {
+				memUsed += bp.memUsed
+				if l := bp.level(); l > level {
+					level = l
+				}
+				if bp.throttled {
+					throttled = true
+				}
+				if d := int64(bp.ackDelay / time.Millisecond); d > ackDelay {
+					ackDelay = d
+				}
+			}
+		}
+		bs.mutationQueueMemory.Set(memUsed)
+		bs.pressureLevel.Set(level)
+		bs.throttled.Set(throttled)
+		bs.ackDelay.Set(ackDelay)
+		bs.numThrottles.Set(m.numThrottles[bucket])
+	}
+}
+
+func (m *mutationMgr) handleMemoryPressure(cmd Message) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.memPressure = cmd.(*MsgMemoryPressure).IsHigh()
+	logging.Infof("MutationMgr::handleMemoryPressure High %v", m.memPressure)
+
+	m.supvCmdch <- &MsgSuccess{}
+}
@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/platform"
+)
+
+func TestBucketPressure(t *testing.T) {
+
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+
+	m := &mutationMgr{
+		streamBucketQueueMap: make(map[common.StreamId]BucketQueueMap),
+		bucketPressureMap:    make(map[common.StreamId]map[string]*bucketPressure),
+		numThrottles:         make(map[string]int64),
+		internalRecvCh:       make(MsgChannel, 10),
+		config:               conf,
+		maxMemory:            platform.NewAlignedInt64(100 * 1024),
+	}
+
+	noisy := NewAtomicMutationQueue("noisy", 1, &m.maxMemory, &m.memUsed, conf)
+	quiet := NewAtomicMutationQueue("quiet", 1, &m.maxMemory, &m.memUsed, conf)
+	m.streamBucketQueueMap[common.MAINT_STREAM] = BucketQueueMap{
+		"noisy": IndexerMutationQueue{queue: noisy},
+		"quiet": IndexerMutationQueue{queue: quiet},
+	}
+
+	//fill the noisy bucket beyond its share of 50KB
+	var seqno uint64
+	for noisy.GetMemUsed() < 45*1024 {
+		seqno++
+		mut := &MutationKeys{meta: &MutationMeta{vbucket: 0, seqno: Seqno(seqno)},
+			docid: make([]byte, 1024)}
+		noisy.Enqueue(mut, 0, nil)
+	}
+	quiet.Enqueue(&MutationKeys{meta: &MutationMeta{vbucket: 0, seqno: 1}}, 0, nil)
+
+	m.checkBucketPressure()
+	msg := checkPressureMsg(t, m, "noisy", true)
+	if msg.GetAckDelay() != 100*time.Millisecond {
+		t.Errorf("Expected ack delay 100ms, received %v", msg.GetAckDelay())
+	}
+	if len(m.internalRecvCh) != 0 {
+		t.Errorf("Unexpected pressure message for quiet bucket")
+	}
+
+	//queue still growing, throttle is doubled
+	noisy.Enqueue(&MutationKeys{meta: &MutationMeta{vbucket: 0, seqno: Seqno(seqno + 1)}}, 0, nil)
+	m.checkBucketPressure()
+	msg = checkPressureMsg(t, m, "noisy", true)
+	if msg.GetAckDelay() != 200*time.Millisecond {
+		t.Errorf("Expected ack delay 200ms, received %v", msg.GetAckDelay())
+	}
+
+	//drained below low mark, throttle is released
+	for noisy.DequeueSingleElement(0) != nil {
+	}
+	m.checkBucketPressure()
+	checkPressureMsg(t, m, "noisy", false)
+
+	if m.numThrottles["noisy"] != 1 || m.numThrottles["quiet"] != 0 {
+		t.Errorf("Unexpected throttle counts %v", m.numThrottles)
+	}
+}
+
+func TestBucketPressureRemovedBucket(t *testing.T) {
+
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+
+	m := &mutationMgr{
+		streamBucketQueueMap: make(map[common.StreamId]BucketQueueMap),
+		bucketPressureMap:    make(map[common.StreamId]map[string]*bucketPressure),
+		numThrottles:         make(map[string]int64),
+		internalRecvCh:       make(MsgChannel, 10),
+		config:               conf,
+		maxMemory:            platform.NewAlignedInt64(100 * 1024),
+	}
+
+	throttle := func(streamId common.StreamId) {
+		memUsed := platform.NewAlignedInt64(0)
+		noisy := NewAtomicMutationQueue("noisy", 1, &m.maxMemory, &memUsed, conf)
+		m.streamBucketQueueMap[streamId] = BucketQueueMap{
+			"noisy": IndexerMutationQueue{queue: noisy},
+		}
+		var seqno uint64
+		for noisy.GetMemUsed() < 90*1024 {
+			seqno++
+			mut := &MutationKeys{meta: &MutationMeta{vbucket: 0, seqno: Seqno(seqno)},
+				docid: make([]byte, 1024)}
+			noisy.Enqueue(mut, 0, nil)
+		}
+		m.checkBucketPressure()
+		checkPressureMsg(t, m, "noisy", true)
+	}
+
+	//bucket gone from the stream while throttled is released
+	throttle(common.INIT_STREAM)
+	delete(m.streamBucketQueueMap, common.INIT_STREAM)
+	m.checkBucketPressure()
+	checkPressureMsg(t, m, "noisy", false)
+	if len(m.bucketPressureMap) != 0 {
+		t.Errorf("Unexpected pressure %v", m.bucketPressureMap)
+	}
+
+	//stream cleaned up while throttled is released once
+	throttle(common.MAINT_STREAM)
+	m.cleanupStream(common.MAINT_STREAM)
+	checkPressureMsg(t, m, "noisy", false)
+	m.checkBucketPressure()
+	if len(m.internalRecvCh) != 0 {
+		t.Errorf("Unexpected pressure message %v", <-m.internalRecvCh)
+	}
+}
+
+func checkPressureMsg(t *testing.T, m *mutationMgr, bucket string,
+	throttled bool) *MsgBucketPressure {
+
+	select {
+	case msg := <-m.internalRecvCh:
+		bp := msg.(*MsgBucketPressure)
+		if bp.GetBucket() != bucket || bp.IsThrottled() != throttled {
+			t.Fatalf("Expected %v throttled %v, received %v", bucket, throttled, bp)
+		}
+		return bp
+	default:
+		t.Fatalf("Expected pressure message for %v", bucket)
+	}
+	return nil
+}
@@ -160,6 +160,9 @@ func (c *clustMgrAgent) handleSupvervisorCommands(cmd Message) {
 	case CLUST_MGR_CLEANUP_INDEX:
 		c.handleCleanupIndex(cmd)
 
+	case CONFIG_SETTINGS_UPDATE:
+		c.handleConfigUpdate(cmd)
+
 	default:
 		logging.Errorf("ClusterMgrAgent::handleSupvervisorCommands Unknown Message %v", cmd)
 	}
@@ -313,6 +316,15 @@ func (c *clustMgrAgent) handleIndexerReady(cmd Message) {
 	c.supvCmdch <- &MsgSuccess{}
 }
 
+func (c *clustMgrAgent) handleConfigUpdate(cmd Message) {
+
+	cfgUpdate := cmd.(*MsgConfigUpdate)
+	c.config = cfgUpdate.GetConfig()
+	c.mgr.ResetConfig(c.config)
+
+	c.supvCmdch <- &MsgSuccess{}
+}
+
 //panicHandler handles the panic from index manager
 func (c *clustMgrAgent) panicHandler() {
 
@@ -511,6 +523,110 @@ func (meta *metaNotifier) OnIndexDelete(defnId common.IndexDefnId, bucket string
 	return nil
 }
 
+func (meta *metaNotifier) OnIndexBuildPause(defnId common.IndexDefnId, bucket string) error {
+
+	logging.Infof("clustMgrAgent::OnIndexBuildPause Notification "+
+		"Received for Pause Build IndexId %v", defnId)
+
+	return meta.stopIndexBuild(CLUST_MGR_PAUSE_INDEX_BUILD, defnId, bucket)
+}
+
+func (meta *metaNotifier) OnIndexBuildCancel(defnId common.IndexDefnId, bucket string) error {
+
+	logging.Infof("clustMgrAgent::OnIndexBuildCancel Notification "+
+		"Received for Cancel Build IndexId %v", defnId)
+
+	return meta.stopIndexBuild(CLUST_MGR_CANCEL_INDEX_BUILD, defnId, bucket)
+}
+
+func (meta *metaNotifier) OnIndexRename(defnId common.IndexDefnId, bucket string, name string) error {
+
+	logging.Infof("clustMgrAgent::OnIndexRename Notification "+
+		"Received for Rename IndexId %v To %v", defnId, name)
+
+	respCh := make(MsgChannel)
+
+	//Treat DefnId as InstId for now
+	meta.adminCh <- &MsgRenameIndex{indexInstId: common.IndexInstId(defnId),
+		name:   name,
+		respCh: respCh}
+
+	//wait for response
+	if res, ok := <-respCh; ok {
+
+		switch res.GetMsgType() {
+
+		case MSG_SUCCESS:
+			logging.Infof("clustMgrAgent::OnIndexRename Success "+
+				"for Rename IndexId %v", defnId)
+			return nil
+
+		case MSG_ERROR:
+			logging.Errorf("clustMgrAgent::OnIndexRename Error "+
+				"for Rename IndexId %v. Error %v", defnId, res)
+			err := res.(*MsgError).GetError()
+			return err.cause
+
+		default:
+			logging.Fatalf("clustMgrAgent::OnIndexRename Unknown Response "+
+				"Received for Rename IndexId %v. Response %v", defnId, res)
+			common.CrashOnError(errors.New("Unknown Response"))
+
+		}
+
+	} else {
+		logging.Fatalf("clustMgrAgent::OnIndexRename Unexpected Channel Close "+
+			"for Rename IndexId %v", defnId)
+		common.CrashOnError(errors.New("Unknown Response"))
+
+	}
+
+	return nil
+}
+
+func (meta *metaNotifier) stopIndexBuild(mType MsgType, defnId common.IndexDefnId, bucket string) error {
+
+	respCh := make(MsgChannel)
+
+	//Treat DefnId as InstId for now
+	meta.adminCh <- &MsgDropIndex{mType: mType,
+		indexInstId: common.IndexInstId(defnId),
+		respCh:      respCh,
+		bucket:      bucket}
+
+	//wait for response
+	if res, ok := <-respCh; ok {
+
+		switch res.GetMsgType() {
+
+		case MSG_SUCCESS:
+			logging.Infof("clustMgrAgent::stopIndexBuild Success "+
+				"for %v IndexId %v", mType, defnId)
+			return nil
+
+		case MSG_ERROR:
+			logging.Errorf("clustMgrAgent::stopIndexBuild Error "+
+				"for %v IndexId %v. Error %v", mType, defnId, res)
+			err := res.(*MsgError).GetError()
+			return err.cause
+
+		default:
+			logging.Fatalf("clustMgrAgent::stopIndexBuild Unknown Response "+
+				"Received for %v IndexId %v. Response %v", mType, defnId, res)
+			common.CrashOnError(errors.New("Unknown Response"))
+
+		}
+
+	} else {
+		logging.Fatalf("clustMgrAgent::stopIndexBuild Unexpected Channel Close "+
+			"for %v IndexId %v", mType, defnId)
+		common.CrashOnError(errors.New("Unknown Response"))
+
+	}
+
+	return nil
+}
+
 func (meta *metaNotifier) makeDefaultPartitionContainer() common.PartitionContainer {
 
 	pc := common.NewKeyPartitionContainer()
@@ -68,3 +68,20 @@ const MAX_KVWARMUP_RETRIES = 120
 const MAX_METAKV_RETRIES = 100
 
 const INDEXER_VERSION = 1
+
+//Failpoints to inject faults in indexer, for crash recovery tests.
+//See package failpoint.
+const (
+	//slice writer about to apply a mutation
+	FP_SLICE_WRITE = "indexer.slice.write"
+	//snapshot being persisted, before its manifest is written
+	FP_SNAPSHOT_PERSIST = "indexer.snapshot.persist"
+	//snapshot manifest written, before the snapshot is made durable
+	FP_SNAPSHOT_MANIFEST = "indexer.snapshot.manifest"
+	//slice rollback half way through
+	FP_SLICE_ROLLBACK = "indexer.slice.rollback"
+	//stream reader handing over mutations to its workers
+	FP_STREAM_READER = "indexer.streamreader.mutations"
+	//request to projector to open or restart a stream
+	FP_KV_SENDER_REQUEST = "indexer.kvsender.request"
+)
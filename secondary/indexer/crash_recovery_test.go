@@ -0,0 +1,311 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/failpoint"
+)
+
+// Crash recovery of slices. Every round runs in a child process that
+// recovers the slice like indexer bootstrap does, verifies the recovered
+// snapshot against a model of the index at its timestamp, and resumes the
+// workload from there till a failpoint crashes the process.
+
+// environment of a child process running a crash recovery round.
+const envCrashRound = "INDEXER_CRASH_ROUND"
+
+const crashNumVbuckets = 8
+const crashNumDocs = 200
+const crashNumMutations = 4000
+const crashBatchSize = 100
+
+type crashRound struct {
+	Mode     common.StorageMode
+	Path     string
+	Rollback bool // rollback, as asked by KV, before resuming the workload
+}
+
+var crashSchedule = []struct {
+	failpoints string
+	rollback   bool
+}{
+	{FP_SLICE_WRITE + "=exit@1500", false},
+	{FP_SNAPSHOT_PERSIST + "=exit@3", false},
+	{FP_SLICE_WRITE + "=exit@800", true},
+	{FP_SNAPSHOT_MANIFEST + "=exit@2", false},
+	{FP_SLICE_ROLLBACK + "=exit@1", true},
+	// KV still asks to rollback after a crash half way through rollback.
+	{FP_SLICE_WRITE + "=exit@500", true},
+	{"", false},
+}
+
+type crashMutation struct {
+	vbucket int
+	seqno   uint64
+	docid   string
+	key     string // empty for deletion
+}
+
+// crashWorkload is the same log of mutations in every round, with seqnos
+// assigned per vbucket in the order of the log.
+func crashWorkload() []crashMutation {
+	rnd := rand.New(rand.NewSource(1))
+	seqnos := make([]uint64, crashNumVbuckets)
+	log := make([]crashMutation, 0, crashNumMutations)
+	for i := 0; i < crashNumMutations; i++ {
+		docid := fmt.Sprintf("docid-%d", rnd.Intn(crashNumDocs))
+		vb := int((crc32.ChecksumIEEE([]byte(docid)) >> 16) & (crashNumVbuckets - 1))
+		seqnos[vb]++
+		m := crashMutation{vbucket: vb, seqno: seqnos[vb], docid: docid}
+		if rnd.Intn(5) != 0 {
+			m.key = "[\"" + randString(rnd, 8) + "\"]"
+		}
+		log = append(log, m)
+	}
+	return log
+}
+
+// crashModelAt returns index keys by docid after applying mutations of
+// the log till ts.
+func crashModelAt(log []crashMutation, ts *common.TsVbuuid) map[string]string {
+	model := make(map[string]string)
+	for _, m := range log {
+		if ts == nil || m.seqno > ts.Seqnos[m.vbucket] {
+			continue
+		}
+		if m.key == "" {
+			delete(model, m.docid)
+		} else {
+			model[m.docid] = m.key
+		}
+	}
+	return model
+}
+
+func verifyCrashSnapshot(t *testing.T, snap Snapshot, log []crashMutation) {
+	expected := make(map[string]bool)
+	for docid, key := range crashModelAt(log, snap.Timestamp()) {
+		buf := make([]byte, 0, maxIndexEntrySize)
+		entry, err := NewSecondaryIndexEntry([]byte(key), []byte(docid), false, 1, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[string(entry)] = true
+	}
+
+	count := 0
+	err := snap.All(func(entry []byte) error {
+		if !expected[string(entry)] {
+			return fmt.Errorf("unexpected entry for %s", docIdFromEntryBytes(entry))
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("snapshot at %v: %v", snap.Timestamp().Seqnos, err)
+	} else if count != len(expected) {
+		t.Fatalf("snapshot at %v: expected %v entries, found %v",
+			snap.Timestamp().Seqnos, len(expected), count)
+	}
+}
+
+func newCrashSlice(t *testing.T, round crashRound) Slice {
+	stats := &IndexStats{}
+	stats.Init()
+	cfg := common.SystemConfig.SectionConfig("indexer.", true)
+	cfg.SetValue("numSliceWriters", 2)
+	cfg.SetValue("numVbuckets", crashNumVbuckets)
+	idxDefn := common.IndexDefn{
+		DefnId:       common.IndexDefnId(1),
+		Bucket:       "default",
+		IsArrayIndex: false}
+
+	var slice Slice
+	var err error
+	if round.Mode == common.FORESTDB {
+		slice, err = NewForestDBSlice(round.Path, SliceId(0), idxDefn,
+			common.IndexInstId(1), false, cfg, stats)
+	} else {
+		slice, err = NewMemDBSlice(round.Path, SliceId(0), idxDefn,
+			common.IndexInstId(1), false, cfg, stats)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slice
+}
+
+// openLatestSnapshot the same way storage manager does after bootstrap
+// and rollback. Without a snapshot, slice is at zero.
+func openLatestSnapshot(t *testing.T, slice Slice) (Snapshot, *common.TsVbuuid) {
+	infos, err := slice.GetSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := NewSnapshotInfoContainer(infos).GetLatest()
+	if info == nil {
+		ts := common.NewTsVbuuid("default", crashNumVbuckets)
+		if info, err = slice.NewSnapshot(ts.Copy(), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := slice.OpenSnapshot(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap, info.Timestamp().Copy()
+}
+
+// rollbackSlice to the snapshot older than a rollback timestamp that is
+// one mutation behind ts, like timekeeper and storage manager do on
+// INDEXER_ROLLBACK.
+func rollbackSlice(t *testing.T, slice Slice, ts *common.TsVbuuid) {
+	rollbackTs := ts.Copy()
+	vb := 0
+	for i, seqno := range rollbackTs.Seqnos {
+		if seqno > rollbackTs.Seqnos[vb] {
+			vb = i
+		}
+	}
+	if rollbackTs.Seqnos[vb] == 0 {
+		return
+	}
+	rollbackTs.Seqnos[vb]--
+
+	infos, err := slice.GetSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := NewSnapshotInfoContainer(infos).GetOlderThanTS(rollbackTs); info != nil {
+		err = slice.Rollback(info)
+	} else {
+		err = slice.RollbackToZero()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commitCrashSnapshot(t *testing.T, slice Slice, snap Snapshot,
+	ts *common.TsVbuuid) Snapshot {
+
+	info, err := slice.NewSnapshot(ts.Copy(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSnap, err := slice.OpenSnapshot(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Close()
+	return newSnap
+}
+
+func runCrashRound(t *testing.T, round crashRound) {
+	log := crashWorkload()
+	slice := newCrashSlice(t, round)
+
+	snap, ts := openLatestSnapshot(t, slice)
+	verifyCrashSnapshot(t, snap, log)
+	if round.Rollback {
+		snap.Close()
+		rollbackSlice(t, slice, ts)
+		snap, ts = openLatestSnapshot(t, slice)
+		verifyCrashSnapshot(t, snap, log)
+	}
+
+	// resume from the recovered timestamp, as the stream would.
+	count := 0
+	for _, m := range log {
+		if m.seqno <= ts.Seqnos[m.vbucket] {
+			continue
+		}
+		meta := NewMutationMeta()
+		meta.bucket = "default"
+		meta.vbucket = Vbucket(m.vbucket)
+		meta.seqno = Seqno(m.seqno)
+		var err error
+		if m.key == "" {
+			err = slice.Delete([]byte(m.docid), meta)
+		} else {
+			err = slice.Insert([]byte(m.key), []byte(m.docid), meta)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.Seqnos[m.vbucket] = m.seqno
+		if count++; count%crashBatchSize == 0 {
+			snap = commitCrashSnapshot(t, slice, snap, ts)
+		}
+	}
+	snap = commitCrashSnapshot(t, slice, snap, ts)
+	verifyCrashSnapshot(t, snap, log)
+	snap.Close()
+	slice.Close()
+}
+
+// runCrashRoundProcess returns the exit status of the child process,
+// along with its output.
+func runCrashRoundProcess(round crashRound, failpoints string) (int, []byte, error) {
+	data, err := json.Marshal(round)
+	if err != nil {
+		return 0, nil, err
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSliceCrashRecovery$")
+	cmd.Env = append(os.Environ(),
+		envCrashRound+"="+string(data), failpoint.EnvFailpoints+"="+failpoints)
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus(), out, nil
+		}
+	}
+	return 0, out, err
+}
+
+func TestSliceCrashRecovery(t *testing.T) {
+	if data := os.Getenv(envCrashRound); data != "" {
+		var round crashRound
+		if err := json.Unmarshal([]byte(data), &round); err != nil {
+			t.Fatal(err)
+		}
+		runCrashRound(t, round)
+		return
+	}
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	for _, mode := range []common.StorageMode{common.MOI, common.FORESTDB} {
+		dir, err := ioutil.TempDir("", "crash_recovery")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		round := crashRound{Mode: mode, Path: filepath.Join(dir, "slice")}
+		for i, r := range crashSchedule {
+			round.Rollback = r.rollback
+			status, out, err := runCrashRoundProcess(round, r.failpoints)
+			if err != nil {
+				t.Fatalf("%v round %v: %v", mode, i, err)
+			}
+			// a failpoint may not be hit before the workload is done.
+			if status != 0 && (status != failpoint.ExitCode || r.failpoints == "") {
+				t.Fatalf("%v round %v (%v) exited with %v:\n%s",
+					mode, i, r.failpoints, status, out)
+			}
+			t.Logf("%v round %v (%v) exited with %v", mode, i, r.failpoints, status)
+		}
+	}
+}
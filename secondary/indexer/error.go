@@ -63,6 +63,7 @@ const (
 	ERROR_INDEXER_INTERNAL_ERROR
 	ERROR_INDEX_BUILD_IN_PROGRESS
 	ERROR_INDEX_DROP_IN_PROGRESS
+	ERROR_INDEX_BUILD_NOT_IN_PROGRESS
 	ERROR_INDEXER_UNKNOWN_INDEX
 	ERROR_INDEXER_UNKNOWN_BUCKET
 	ERROR_INDEXER_IN_RECOVERY
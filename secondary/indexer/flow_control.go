@@ -0,0 +1,131 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+//bucketFeedback is the load of a bucket in a stream, reported back to the
+//projectors which adapt the DCP connection buffer size and buffer-ack
+//cadence of the bucket to it. Unlike bucket pressure, which only kicks in
+//when a bucket fills its share of the mutation queue memory, feedback is
+//sent all the time so the projectors can grow the buffers of idle pipes
+//as well as shrink the buffers of bursty ones.
+type bucketFeedback struct {
+	queueDepth   int64
+	queueMemory  int64
+	flushLatency time.Duration
+}
+
+func (fb *bucketFeedback) String() string {
+	return fmt.Sprintf("QueueDepth %v QueueMemory %v FlushLatency %v",
+		fb.queueDepth, fb.queueMemory, fb.flushLatency)
+}
+
+//monitorFlowControl periodically sends feedback for the buckets
+//in each stream till mutation manager shuts down
+func (m *mutationMgr) monitorFlowControl() {
+
+	interval := m.config["flow_control.feedback_interval"].Int()
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.sendFeedback()
+
+		case <-m.shutdownCh:
+			return
+		}
+	}
+}
+
+//sendFeedback collects the mutation queue depth, memory and last flush
+//latency of each stream's bucket queue and sends them to the supervisor
+//which forwards them to the projectors via kv sender.
+func (m *mutationMgr) sendFeedback() {
+
+	var msgs []Message
+
+	func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		if !m.config["flow_control.enabled"].Bool() {
+			return
+		}
+
+		m.flock.Lock()
+		defer m.flock.Unlock()
+
+		for streamId, bucketQueueMap := range m.streamBucketQueueMap {
+			feedback := make(map[string]*bucketFeedback)
+			for bucket, q := range bucketQueueMap {
+				fb := &bucketFeedback{
+					queueMemory:  q.queue.GetMemUsed(),
+					flushLatency: m.flushLatencyMap[streamId][bucket],
+				}
+				for vb := uint16(0); vb < q.queue.GetNumVbuckets(); vb++ {
+					fb.queueDepth += q.queue.GetSize(Vbucket(vb))
+				}
+				feedback[bucket] = fb
+				m.numFeedbacks[bucket]++
+			}
+			if len(feedback) > 0 {
+				msgs = append(msgs, &MsgStreamFeedback{streamId: streamId,
+					feedback: feedback})
+			}
+		}
+		m.updateFlowControlStats(msgs)
+	}()
+
+	for _, msg := range msgs {
+		m.internalRecvCh <- msg
+	}
+}
+
+//recordFlushLatency is called with flock held
+func (m *mutationMgr) recordFlushLatency(streamId common.StreamId,
+	bucket string, latency time.Duration) {
+
+	if _, ok := m.flushLatencyMap[streamId]; !ok {
+		m.flushLatencyMap[streamId] = make(map[string]time.Duration)
+	}
+	m.flushLatencyMap[streamId][bucket] = latency
+}
+
+//updateFlowControlStats reports the highest flush latency of a bucket
+//across streams into bucket stats
+func (m *mutationMgr) updateFlowControlStats(msgs []Message) {
+
+	stats := m.stats.Get()
+	if stats == nil {
+		return
+	}
+
+	for bucket, bs := range stats.buckets {
+		var flushLatency int64
+		for _, msg := range msgs {
+			fb, ok := msg.(*MsgStreamFeedback).GetFeedback()[bucket]
+			if ok {
+				if l := int64(fb.flushLatency / time.Millisecond); l > flushLatency {
+					flushLatency = l
+				}
+			}
+		}
+		bs.flushLatency.Set(flushLatency)
+		bs.numFeedbacks.Set(m.numFeedbacks[bucket])
+	}
+}
@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/platform"
+)
+
+func TestStreamFeedback(t *testing.T) {
+
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+
+	m := &mutationMgr{
+		streamBucketQueueMap: make(map[common.StreamId]BucketQueueMap),
+		flushLatencyMap:      make(map[common.StreamId]map[string]time.Duration),
+		numFeedbacks:         make(map[string]int64),
+		internalRecvCh:       make(MsgChannel, 10),
+		config:               conf,
+		maxMemory:            platform.NewAlignedInt64(100 * 1024),
+	}
+
+	q := NewAtomicMutationQueue("default", 2, &m.maxMemory, &m.memUsed, conf)
+	m.streamBucketQueueMap[common.MAINT_STREAM] = BucketQueueMap{
+		"default": IndexerMutationQueue{queue: q},
+	}
+
+	for vb := 0; vb < 2; vb++ {
+		for seqno := 1; seqno <= 3; seqno++ {
+			mut := &MutationKeys{meta: &MutationMeta{vbucket: Vbucket(vb),
+				seqno: Seqno(seqno)}, docid: make([]byte, 100)}
+			q.Enqueue(mut, Vbucket(vb), nil)
+		}
+	}
+	m.recordFlushLatency(common.MAINT_STREAM, "default", 250*time.Millisecond)
+
+	m.sendFeedback()
+
+	var msg *MsgStreamFeedback
+	select {
+	case resp := <-m.internalRecvCh:
+		msg = resp.(*MsgStreamFeedback)
+	default:
+		t.Fatalf("Expected feedback for %v", common.MAINT_STREAM)
+	}
+
+	fb, ok := msg.GetFeedback()["default"]
+	if msg.GetStreamId() != common.MAINT_STREAM || !ok {
+		t.Fatalf("Unexpected feedback %v", msg)
+	}
+	if fb.queueDepth != 6 {
+		t.Errorf("Expected queue depth 6, received %v", fb.queueDepth)
+	}
+	if fb.queueMemory != q.GetMemUsed() {
+		t.Errorf("Expected queue memory %v, received %v", q.GetMemUsed(), fb.queueMemory)
+	}
+	if fb.flushLatency != 250*time.Millisecond {
+		t.Errorf("Expected flush latency 250ms, received %v", fb.flushLatency)
+	}
+	if m.numFeedbacks["default"] != 1 {
+		t.Errorf("Unexpected feedback count %v", m.numFeedbacks)
+	}
+}
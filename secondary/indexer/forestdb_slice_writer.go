@@ -15,7 +15,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/common"
-	"github.com/couchbase/indexing/secondary/common/queryutil"
+	"github.com/couchbase/indexing/secondary/failpoint"
 	"github.com/couchbase/indexing/secondary/fdb"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/natsort"
@@ -140,7 +140,7 @@ retry:
 	slice.id = sliceId
 
 	// Array related initialization
-	_, slice.isArrayDistinct, slice.arrayExprPosition, err = queryutil.GetArrayExpressionPosition(idxDefn.SecExprs)
+	slice.isArrayDistinct, slice.arrayExprPosition, err = getArrayExprPosition(idxDefn)
 	if err != nil {
 		return nil, err
 	}
@@ -311,6 +311,9 @@ loop:
 		var nmut int
 		select {
 		case c = <-fdb.cmdCh:
+			if err := failpoint.Inject(FP_SLICE_WRITE); err != nil {
+				fdb.checkFatalDbError(err)
+			}
 			switch c.(type) {
 			case *indexItem:
 				icmd = c.(*indexItem)
@@ -879,6 +882,7 @@ func (fdb *fdbSlice) OpenSnapshot(info SnapshotInfo) (Snapshot, error) {
 			main:       fdb.main[0],
 			ts:         snapInfo.Timestamp(),
 			mainSeqNum: snapInfo.MainSeq,
+			backSeqNum: snapInfo.BackSeq,
 			committed:  info.IsCommitted(),
 		}
 	}
@@ -940,6 +944,10 @@ func (fdb *fdbSlice) Rollback(info SnapshotInfo) error {
 		return err
 	}
 
+	if err := failpoint.Inject(FP_SLICE_ROLLBACK); err != nil {
+		return err
+	}
+
 	//call forestdb to rollback for each kv store
 	err = fdb.main[0].Rollback(snapInfo.MainSeq)
 	if err != nil {
@@ -1099,6 +1107,10 @@ func (fdb *fdbSlice) NewSnapshot(ts *common.TsVbuuid, commit bool) (SnapshotInfo
 			sic.RemoveOldest()
 		}
 
+		if err := failpoint.Inject(FP_SNAPSHOT_PERSIST); err != nil {
+			return nil, err
+		}
+
 		// Meta update should be done before commit
 		// Otherwise, metadata will not be atomically updated along with disk commit.
 		err = fdb.updateSnapshotsMeta(sic.List())
@@ -1106,6 +1118,10 @@ func (fdb *fdbSlice) NewSnapshot(ts *common.TsVbuuid, commit bool) (SnapshotInfo
 			return nil, err
 		}
 
+		if err := failpoint.Inject(FP_SNAPSHOT_MANIFEST); err != nil {
+			return nil, err
+		}
+
 		// Commit database file
 		start := time.Now()
 		err = fdb.dbfile.Commit(forestdb.COMMIT_MANUAL_WAL_FLUSH)
@@ -48,6 +48,7 @@ type fdbSnapshot struct {
 
 	main       *forestdb.KVStore // handle for forward index
 	mainSeqNum forestdb.SeqNum
+	backSeqNum forestdb.SeqNum
 
 	idxDefnId common.IndexDefnId //index definition id
 	idxInstId common.IndexInstId //index instance id
@@ -156,6 +157,54 @@ func (s *fdbSnapshot) Destroy() {
 	}
 }
 
+//openBackIndex opens the back index as of this snapshot,
+//for verifying it against the main index.
+func (s *fdbSnapshot) openBackIndex() (backIndexReader, error) {
+	if s.slice.isPrimary {
+		return nil, errors.New("Primary index has no back index")
+	}
+
+	var backSeq forestdb.SeqNum
+	if s.committed {
+		backSeq = s.backSeqNum
+	} else {
+		backSeq = FORESTDB_INMEMSEQ
+	}
+
+	back, err := s.slice.back[0].SnapshotOpen(backSeq)
+	if err != nil {
+		logging.Errorf("ForestDBSnapshot::openBackIndex \n\tUnexpected Error "+
+			"Opening Back DB Snapshot (%v) SeqNum %v %v", s.slice.Path(), backSeq, err)
+		return nil, err
+	}
+
+	s.slice.IncrRef()
+	return &fdbBackIndexReader{slice: s.slice, back: back}, nil
+}
+
+type fdbBackIndexReader struct {
+	slice *fdbSlice
+	back  *forestdb.KVStore
+}
+
+//lookup returns the back index entry of docid, nil if there is none
+func (r *fdbBackIndexReader) lookup(docid []byte) ([]byte, error) {
+	entry, err := r.back.GetKV(docid)
+	if err == forestdb.FDB_RESULT_KEY_NOT_FOUND {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func (r *fdbBackIndexReader) close() {
+	defer r.slice.DecrRef()
+
+	if err := r.back.Close(); err != nil {
+		logging.Errorf("ForestDBSnapshot::close Unexpected error "+
+			"closing Back DB Snapshot %v", err)
+	}
+}
+
 func (s *fdbSnapshot) String() string {
 
 	str := fmt.Sprintf("Index: %v ", s.idxInstId)
@@ -11,6 +11,7 @@ package indexer
 
 import (
 	"github.com/couchbase/indexing/secondary/common"
+	"time"
 )
 
 // IndexSnapshot is an immutable data structure that provides point-in-time
@@ -23,10 +24,14 @@ import (
 // A snapshot object should not be shared across multiple go routines unless they
 // are serialized. CloneIndexSnapshot() should be used to create a copy of the object
 // if the snapshot needs to be concurrently shared to multiple go routines.
+// Created() is the wall-clock time at which the snapshot was known to have
+// all the mutations received by the indexer till then, it is used to
+// compute the age of a snapshot for bounded-staleness scans.
 type IndexSnapshot interface {
 	IndexInstId() common.IndexInstId
 	Timestamp() *common.TsVbuuid
 	IsEpoch() bool
+	Created() time.Time
 	Partitions() map[common.PartitionId]PartitionSnapshot
 }
 
@@ -41,10 +46,11 @@ type SliceSnapshot interface {
 }
 
 type indexSnapshot struct {
-	instId common.IndexInstId
-	ts     *common.TsVbuuid
-	epoch  bool
-	partns map[common.PartitionId]PartitionSnapshot
+	instId  common.IndexInstId
+	ts      *common.TsVbuuid
+	epoch   bool
+	created time.Time
+	partns  map[common.PartitionId]PartitionSnapshot
 }
 
 func (is *indexSnapshot) IndexInstId() common.IndexInstId {
@@ -59,6 +65,10 @@ func (is *indexSnapshot) Timestamp() *common.TsVbuuid {
 	return is.ts
 }
 
+func (is *indexSnapshot) Created() time.Time {
+	return is.created
+}
+
 func (is *indexSnapshot) Partitions() map[common.PartitionId]PartitionSnapshot {
 	return is.partns
 }
@@ -113,6 +123,23 @@ func CloneIndexSnapshot(is IndexSnapshot) IndexSnapshot {
 	return is
 }
 
+// RefreshIndexSnapshot returns a copy of the snapshot, sharing the same
+// slice snapshots, created now. It is used when an index has no new
+// mutations to snapshot, so that its age does not grow while idle.
+func RefreshIndexSnapshot(is IndexSnapshot) IndexSnapshot {
+	if is == nil {
+		return nil
+	}
+	CloneIndexSnapshot(is)
+	return &indexSnapshot{
+		instId:  is.IndexInstId(),
+		ts:      is.Timestamp(),
+		epoch:   is.IsEpoch(),
+		created: time.Now(),
+		partns:  is.Partitions(),
+	}
+}
+
 func GetSliceSnapshots(is IndexSnapshot) (s []SliceSnapshot) {
 	if is == nil {
 		return
@@ -194,9 +194,6 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 
 	idx.stats = NewIndexerStats()
 
-	// Start indexer endpoints for CRUD  operations.
-	NewRestServer(idx.config["clusterAddr"].String())
-
 	// Read memquota setting
 	idx.stats.memoryQuota.Set(int64(idx.config["settings.memory_quota"].Uint64()))
 	memdb.Debug(idx.config["settings.moi.debug"].Bool())
@@ -234,6 +231,9 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 		return nil, res
 	}
 
+	// Start indexer endpoints for CRUD  operations.
+	NewRestServer(idx.config["clusterAddr"].String(), idx.scanCoord)
+
 	idx.enableManager = idx.config["enableManager"].Bool()
 
 	if idx.enableManager {
@@ -635,6 +635,7 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 		bucket := msg.(*MsgTKStabilityTS).GetBucket()
 		streamId := msg.(*MsgTKStabilityTS).GetStreamId()
 		changeVec := msg.(*MsgTKStabilityTS).GetChangeVector()
+		onDemand := msg.(*MsgTKStabilityTS).IsOnDemand()
 
 		if idx.getStreamBucketState(streamId, bucket) == STREAM_INACTIVE {
 			logging.Warnf("Indexer: Skipped PersistTs for %v %v. "+
@@ -644,7 +645,9 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 
 		idx.streamBucketFlushInProgress[streamId][bucket] = true
 
-		if ts.GetSnapType() == common.FORCE_COMMIT {
+		//force commit and on-demand snapshot of an already flushed ts
+		//have nothing to flush, send these directly to storage manager
+		if ts.GetSnapType() == common.FORCE_COMMIT || onDemand {
 			idx.storageMgrCmdCh <- &MsgMutMgrFlushDone{mType: MUT_MGR_FLUSH_DONE,
 				streamId: streamId,
 				bucket:   bucket,
@@ -671,11 +674,21 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 		idx.storageMgrCmdCh <- msg
 		<-idx.storageMgrCmdCh
 
-	case MUT_MGR_ABORT_DONE:
+	case MUT_MGR_ABORT_DONE, TK_ON_DEMAND_SNAPSHOT:
 
 		idx.tkCmdCh <- msg
 		<-idx.tkCmdCh
 
+	case MUT_MGR_BUCKET_PRESSURE:
+		idx.handleBucketPressure(msg)
+
+	case MUT_MGR_MEMORY_PRESSURE:
+		idx.mutMgrCmdCh <- msg
+		<-idx.mutMgrCmdCh
+
+	case MUT_MGR_STREAM_FEEDBACK:
+		idx.handleStreamFeedback(msg)
+
 	case STORAGE_SNAP_DONE:
 
 		bucket := msg.(*MsgMutMgrFlushDone).GetBucket()
@@ -704,10 +717,15 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 
 	case STORAGE_INDEX_SNAP_REQUEST,
 		STORAGE_INDEX_STORAGE_STATS,
-		STORAGE_INDEX_COMPACT:
+		STORAGE_INDEX_COMPACT,
+		STORAGE_INDEX_SCRUB,
+		TK_BUCKET_IDLE:
 		idx.storageMgrCmdCh <- msg
 		<-idx.storageMgrCmdCh
 
+	case STORAGE_INDEX_SCRUB_REPAIR:
+		idx.handleScrubRepair(msg)
+
 	case CONFIG_SETTINGS_UPDATE:
 		idx.handleConfigUpdate(msg)
 
@@ -854,6 +872,10 @@ func (idx *indexer) handleConfigUpdate(msg Message) {
 	<-idx.mutMgrCmdCh
 	idx.statsMgrCmdCh <- msg
 	<-idx.statsMgrCmdCh
+	if idx.enableManager {
+		idx.clustMgrAgentCmdCh <- msg
+		<-idx.clustMgrAgentCmdCh
+	}
 	idx.updateSliceWithConfig(newConfig)
 
 }
@@ -875,6 +897,14 @@ func (idx *indexer) handleAdminMsgs(msg Message) {
 
 		idx.handleDropIndex(msg)
 
+	case CLUST_MGR_PAUSE_INDEX_BUILD,
+		CLUST_MGR_CANCEL_INDEX_BUILD:
+
+		idx.handleStopIndexBuild(msg)
+
+	case CLUST_MGR_RENAME_INDEX:
+		idx.handleRenameIndex(msg)
+
 	case MSG_ERROR:
 
 		logging.Fatalf("Indexer::handleAdminMsgs Fatal Error On Admin Channel %+v", msg)
@@ -1167,8 +1197,17 @@ func (idx *indexer) handleBuildIndex(msg Message) {
 			common.CrashOnError(err)
 		}
 
+		//indexes with a paused build restart from their last snapshot
+		restartTs := idx.makeRestartTsForIndexList(instIdList)
+		if restartTs != nil {
+			logging.Infof("Indexer::handleBuildIndex \n\tResume Build For Index: %v "+
+				"Stream: %v RestartTs: %v", instIdList, buildStream, restartTs)
+		} else {
+			idx.rollbackResumedIndexesToZero(instIdList)
+		}
+
 		//send Stream Update to workers
-		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, clientCh)
+		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, restartTs, clientCh)
 
 		idx.stateLock.Lock()
 		if _, ok := idx.streamBucketStatus[buildStream]; !ok {
@@ -1334,6 +1373,262 @@ func (idx *indexer) handleDropIndex(msg Message) {
 
 }
 
+//handleRenameIndex renames an index. Only the index definition changes, the
+//index data is kept. Stats of the index start over under the new name.
+func (idx *indexer) handleRenameIndex(msg Message) {
+
+	indexInstId := msg.(*MsgRenameIndex).GetIndexInstId()
+	name := msg.(*MsgRenameIndex).GetName()
+	clientCh := msg.(*MsgRenameIndex).GetResponseChannel()
+
+	logging.Infof("Indexer::handleRenameIndex - IndexInstId %v Name %v", indexInstId, name)
+
+	var indexInst common.IndexInst
+	var ok bool
+	if indexInst, ok = idx.indexInstMap[indexInstId]; !ok {
+
+		errStr := fmt.Sprintf("Unknown Index Instance %v", indexInstId)
+		logging.Errorf("Indexer::handleRenameIndex %v", errStr)
+
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_UNKNOWN_INDEX,
+				severity: FATAL,
+				cause:    errors.New(errStr),
+				category: INDEXER}}
+		return
+	}
+
+	//if the index name already exists for the same bucket,
+	//return error
+	for _, index := range idx.indexInstMap {
+
+		if index.InstId != indexInstId &&
+			index.Defn.Name == name &&
+			index.Defn.Bucket == indexInst.Defn.Bucket &&
+			index.State != common.INDEX_STATE_DELETED {
+
+			logging.Errorf("Indexer::handleRenameIndex Duplicate Index Name. "+
+				"Name: %v, Duplicate Index: %v", name, index)
+
+			clientCh <- &MsgError{
+				err: Error{code: ERROR_INDEX_ALREADY_EXISTS,
+					severity: FATAL,
+					cause:    errors.New("Duplicate Index Name"),
+					category: INDEXER}}
+			return
+		}
+	}
+
+	indexInst.Defn.Name = name
+	idx.indexInstMap[indexInstId] = indexInst
+
+	idx.stats.RenameIndex(indexInstId, name)
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, nil); err != nil {
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+				severity: FATAL,
+				cause:    err,
+				category: INDEXER}}
+		common.CrashOnError(err)
+	}
+
+	clientCh <- &MsgSuccess{}
+}
+
+//handleStopIndexBuild pauses or cancels the initial build of an index.
+func (idx *indexer) handleStopIndexBuild(msg Message) {
+
+	indexInstId := msg.(*MsgDropIndex).GetIndexInstId()
+	clientCh := msg.(*MsgDropIndex).GetResponseChannel()
+	cancel := msg.GetMsgType() == CLUST_MGR_CANCEL_INDEX_BUILD
+
+	logging.Infof("Indexer::handleStopIndexBuild - IndexInstId %v Cancel %v", indexInstId, cancel)
+
+	var indexInst common.IndexInst
+	var ok bool
+	if indexInst, ok = idx.indexInstMap[indexInstId]; !ok {
+
+		errStr := fmt.Sprintf("Unknown Index Instance %v", indexInstId)
+		logging.Errorf("Indexer::handleStopIndexBuild %v", errStr)
+
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_UNKNOWN_INDEX,
+				severity: FATAL,
+				cause:    errors.New(errStr),
+				category: INDEXER}}
+		return
+	}
+
+	is := idx.getIndexerState()
+	if is != common.INDEXER_ACTIVE {
+		logging.Errorf("Indexer::handleStopIndexBuild Cannot Process Stop Index Build "+
+			"In %v state", is)
+
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_NOT_ACTIVE,
+				severity: FATAL,
+				cause:    ErrIndexerNotActive,
+				category: INDEXER}}
+		return
+	}
+
+	//cancel discards the data of an index with a paused build. The index
+	//is not in any stream.
+	if cancel && indexInst.State == common.INDEX_STATE_READY {
+		idx.rollbackIndexToZero(indexInst)
+		clientCh <- &MsgSuccess{}
+		return
+	}
+
+	if indexInst.State != common.INDEX_STATE_INITIAL &&
+		indexInst.State != common.INDEX_STATE_CATCHUP {
+		logging.Errorf("Indexer::handleStopIndexBuild Index %v In %v State. Nothing To Stop.",
+			indexInstId, indexInst.State)
+
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEX_BUILD_NOT_IN_PROGRESS,
+				severity: FATAL,
+				cause:    common.ErrIndexBuildNotInProgress,
+				category: INDEXER}}
+		return
+	}
+
+	streamId := indexInst.Stream
+	bucket := indexInst.Defn.Bucket
+
+	maintState := idx.getStreamBucketState(common.MAINT_STREAM, bucket)
+	initState := idx.getStreamBucketState(common.INIT_STREAM, bucket)
+
+	if maintState == STREAM_RECOVERY ||
+		maintState == STREAM_PREPARE_RECOVERY ||
+		initState == STREAM_RECOVERY ||
+		initState == STREAM_PREPARE_RECOVERY {
+
+		logging.Errorf("Indexer::handleStopIndexBuild Cannot Process Stop Index Build " +
+			"In Recovery Mode.")
+
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_IN_RECOVERY,
+				severity: FATAL,
+				cause:    ErrIndexerInRecovery,
+				category: INDEXER}}
+		return
+	}
+
+	//a drop or another stop request is already waiting on this bucket
+	if obs, ok := idx.streamBucketObserveFlushDone[streamId][bucket]; ok && obs != nil {
+
+		errStr := "Index Drop Or Build Stop Already In Progress. Please Retry."
+		logging.Errorf("Indexer::handleStopIndexBuild %v", errStr)
+
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEX_DROP_IN_PROGRESS,
+				severity: FATAL,
+				cause:    errors.New(errStr),
+				category: INDEXER}}
+		return
+	}
+
+	//if there is a flush in progress for this index's bucket and stream
+	//wait for the flush to finish before stopping the build
+	if ok, _ := idx.streamBucketFlushInProgress[streamId][bucket]; ok {
+		notifyCh := make(MsgChannel)
+		idx.streamBucketObserveFlushDone[streamId][bucket] = notifyCh
+		go idx.processStopIndexBuildAfterFlushDone(indexInst, cancel, notifyCh, clientCh)
+	} else {
+		idx.stopIndexBuild(indexInst, cancel, clientCh)
+	}
+}
+
+//stopIndexBuild moves an index being built out of its streams and back to READY
+//state. The slice is kept, so a later build resumes from the last snapshot. For
+//cancel, the slice is rolled back to zero and a later build starts over.
+func (idx *indexer) stopIndexBuild(indexInst common.IndexInst, cancel bool,
+	clientCh MsgChannel) {
+
+	//the index no longer belongs to any stream. Flusher skips any mutation
+	//still queued for it.
+	stoppedInst := indexInst
+	stoppedInst.State = common.INDEX_STATE_READY
+	stoppedInst.Stream = common.NIL_STREAM
+	stoppedInst.Error = ""
+	idx.indexInstMap[stoppedInst.InstId] = stoppedInst
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, nil); err != nil {
+		clientCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+				severity: FATAL,
+				cause:    err,
+				category: INDEXER}}
+		common.CrashOnError(err)
+	}
+
+	if cancel {
+		idx.rollbackIndexToZero(stoppedInst)
+	}
+
+	//if this is the last index for the bucket in MaintStream and the bucket exists
+	//in InitStream, don't cleanup bucket from stream. It is needed for merge to
+	//happen.
+	bucket := indexInst.Defn.Bucket
+	if indexInst.Stream == common.MAINT_STREAM &&
+		!idx.checkBucketExistsInStream(bucket, common.MAINT_STREAM, false) &&
+		idx.checkBucketExistsInStream(bucket, common.INIT_STREAM, false) {
+		logging.Infof("Indexer::stopIndexBuild Pre-Catchup Index Found for %v "+
+			"%v. Stream Cleanup Skipped.", indexInst.Stream, bucket)
+	} else if ok := idx.sendStreamUpdateForDropIndex(indexInst, clientCh); !ok {
+		return
+	}
+
+	if idx.enableManager {
+		if err := idx.updateMetaInfoForIndexList([]common.IndexInstId{stoppedInst.InstId},
+			true, false, true, false); err != nil {
+			common.CrashOnError(err)
+		}
+	}
+
+	logging.Infof("Indexer::stopIndexBuild Stopped Build For Index %v Cancel %v",
+		stoppedInst.InstId, cancel)
+
+	clientCh <- &MsgSuccess{}
+}
+
+func (idx *indexer) rollbackIndexToZero(indexInst common.IndexInst) {
+
+	for _, partnInst := range idx.indexPartnMap[indexInst.InstId] {
+		for _, slice := range partnInst.Sc.GetAllSlices() {
+			if err := slice.RollbackToZero(); err != nil {
+				logging.Errorf("Indexer::rollbackIndexToZero Error Rollback Index %v "+
+					"Slice %v To Zero. Err %v", indexInst.InstId, slice.Id(), err)
+				common.CrashOnError(err)
+			}
+		}
+	}
+
+	logging.Infof("Indexer::rollbackIndexToZero Rollback Index %v To Zero", indexInst.InstId)
+}
+
+func (idx *indexer) processStopIndexBuildAfterFlushDone(indexInst common.IndexInst,
+	cancel bool, notifyCh MsgChannel, clientCh MsgChannel) {
+
+	select {
+	case <-notifyCh:
+		idx.stopIndexBuild(indexInst, cancel, clientCh)
+	}
+
+	streamId := indexInst.Stream
+	bucket := indexInst.Defn.Bucket
+	idx.streamBucketObserveFlushDone[streamId][bucket] = nil
+
+	//indicate done
+	close(notifyCh)
+}
+
 func (idx *indexer) handlePrepareRecovery(msg Message) {
 
 	streamId := msg.(*MsgRecovery).GetStreamId()
@@ -1779,7 +2074,8 @@ func (idx *indexer) Shutdown() Message {
 }
 
 func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstId,
-	buildStream common.StreamId, bucket string, buildTs Timestamp, clientCh MsgChannel) bool {
+	buildStream common.StreamId, bucket string, buildTs Timestamp,
+	restartTs *common.TsVbuuid, clientCh MsgChannel) bool {
 
 	var cmd Message
 	var indexList []common.IndexInst
@@ -1798,7 +2094,7 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 		indexList: indexList,
 		buildTs:   buildTs,
 		respCh:    respCh,
-		restartTs: nil}
+		restartTs: restartTs}
 
 	//send stream update to timekeeper
 	if resp := idx.sendStreamUpdateToWorker(cmd, idx.tkCmdCh,
@@ -1871,6 +2167,10 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 					}
 
 				case INDEXER_ROLLBACK:
+					if idx.recoverResumedBuildRollback(buildStream, bucket, restartTs, resp) {
+						break retryloop
+					}
+
 					//an initial build request should never receive rollback message
 					logging.Errorf("Indexer::sendStreamUpdateForBuildIndex Unexpected Rollback from "+
 						"Projector during Initial Stream Request %v", resp)
@@ -1942,6 +2242,27 @@ func (idx *indexer) sendStreamUpdateToWorker(cmd Message, workerCmdCh MsgChannel
 	return &MsgSuccess{}
 }
 
+//recoverResumedBuildRollback starts recovery of the build stream on rollback
+//from projector. A resumed build restarts from a snapshot and can be rolled
+//back like a stream restart. Returns false for a build from zero.
+func (idx *indexer) recoverResumedBuildRollback(buildStream common.StreamId,
+	bucket string, restartTs *common.TsVbuuid, resp Message) bool {
+
+	if restartTs == nil {
+		return false
+	}
+
+	logging.Infof("Indexer::sendStreamUpdateForBuildIndex Rollback from "+
+		"Projector For Stream %v Bucket %v", buildStream, bucket)
+
+	rollbackTs := resp.(*MsgRollback).GetRollbackTs()
+	idx.internalRecvCh <- &MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
+		streamId:  buildStream,
+		bucket:    bucket,
+		restartTs: rollbackTs}
+	return true
+}
+
 func (idx *indexer) sendStreamUpdateForDropIndex(indexInst common.IndexInst,
 	clientCh MsgChannel) bool {
 
@@ -2259,7 +2580,7 @@ func (idx *indexer) checkDuplicateInitialBuildRequest(bucket string,
 			index.Defn.Bucket == bucket) ||
 			idx.checkStreamRequestPending(index.Stream, bucket) {
 
-			errStr := fmt.Sprintf("Build Already In Progress. Bucket %v", bucket)
+			errStr := fmt.Sprintf("%v. Bucket %v", common.ErrIndexBuildInProgress, bucket)
 			if idx.enableManager {
 				idx.bulkUpdateError(instIdList, errStr)
 				for _, instId := range instIdList {
@@ -2446,6 +2767,29 @@ func (idx *indexer) handleInitialBuildDone(msg Message) {
 
 }
 
+//handleScrubRepair applies scrubber corrections to an index. Corrections
+//are written to the slices directly, so these can only be applied when
+//there is no flush in progress for the stream and bucket of the index.
+func (idx *indexer) handleScrubRepair(msg Message) {
+
+	req := msg.(*MsgIndexScrubRepair)
+	respch := req.GetResponseChannel()
+
+	inst, ok := idx.indexInstMap[req.GetInstId()]
+	if !ok {
+		respch <- common.ErrIndexNotFound
+		return
+	}
+
+	if ok, _ := idx.streamBucketFlushInProgress[inst.Stream][inst.Defn.Bucket]; ok {
+		respch <- ErrScrubFlushInProgress
+		return
+	}
+
+	idx.storageMgrCmdCh <- msg
+	<-idx.storageMgrCmdCh
+}
+
 func (idx *indexer) handleMergeStream(msg Message) {
 
 	bucket := msg.(*MsgTKMergeStream).GetBucket()
@@ -3517,6 +3861,59 @@ func (idx *indexer) makeRestartTs(streamId common.StreamId) map[string]*common.T
 	return restartTs
 }
 
+//makeRestartTsForIndexList returns the timestamp to restart the build of
+//the given indexes from. This is the oldest of the last snapshots of the
+//indexes, or nil if any index has no snapshot.
+func (idx *indexer) makeRestartTsForIndexList(instIdList []common.IndexInstId) *common.TsVbuuid {
+
+	var restartTs *common.TsVbuuid
+
+	for _, instId := range instIdList {
+
+		partnMap, ok := idx.indexPartnMap[instId]
+		if !ok {
+			return nil
+		}
+
+		//there is only one partition and one slice for now
+		slice := partnMap[0].Sc.GetSliceById(0)
+
+		infos, err := slice.GetSnapshots()
+		if err != nil {
+			logging.Errorf("Indexer::makeRestartTsForIndexList Unable To Read Snapshot "+
+				"Info For Index %v. Err %v", instId, err)
+			return nil
+		}
+
+		latestSnapInfo := NewSnapshotInfoContainer(infos).GetLatest()
+		if latestSnapInfo == nil {
+			return nil
+		}
+
+		ts := latestSnapInfo.Timestamp()
+		if restartTs == nil || !ts.AsRecent(restartTs) {
+			restartTs = ts
+		}
+	}
+
+	return restartTs
+}
+
+//rollbackResumedIndexesToZero discards the data of the paused indexes in a
+//build from zero. This is the case when the build has an index without
+//snapshot. Otherwise, entries of docs deleted while the build is paused
+//are never removed.
+func (idx *indexer) rollbackResumedIndexesToZero(instIdList []common.IndexInstId) {
+
+	for _, instId := range instIdList {
+		if idx.makeRestartTsForIndexList([]common.IndexInstId{instId}) != nil {
+			logging.Infof("Indexer::rollbackResumedIndexesToZero Index %v Built "+
+				"From Zero With %v", instId, instIdList)
+			idx.rollbackIndexToZero(idx.indexInstMap[instId])
+		}
+	}
+}
+
 func (idx *indexer) closeAllStreams() {
 
 	respCh := make(MsgChannel)
@@ -3841,6 +4238,13 @@ func NewSlice(id SliceId, indInst *common.IndexInst,
 	}
 	path := filepath.Join(storage_dir, IndexPath(indInst, id))
 
+	//a renamed index keeps the data stored under its previous name
+	if _, e := os.Stat(path); os.IsNotExist(e) {
+		if prevPath, ok := FindIndexPath(storage_dir, indInst, id); ok {
+			path = prevPath
+		}
+	}
+
 	if indInst.Defn.Using == common.MemDB ||
 		indInst.Defn.Using == common.MemoryOptimized {
 		slice, err = NewMemDBSlice(path, id, indInst.Defn, indInst.InstId, indInst.Defn.IsPrimary, conf, stats.indexes[indInst.InstId])
@@ -4036,7 +4440,7 @@ func (idx *indexer) monitorMemUsage() {
 
 	logging.Infof("Indexer::monitorMemUsage started...")
 
-	var canResume bool
+	var canResume, memPressure bool
 	if idx.getIndexerState() == common.INDEXER_PAUSED {
 		canResume = true
 	}
@@ -4074,6 +4478,26 @@ func (idx *indexer) monitorMemUsage() {
 
 			logging.Infof("Indexer::monitorMemUsage MemoryUsed Total %v Idle %v", mem_used, idle)
 
+			//with per-bucket backpressure, high_mem_mark only throttles
+			//the buckets filling the mutation queues. Indexer is paused
+			//once memory_quota is exhausted.
+			bucket_pressure := idx.config["bucket_pressure.enabled"].Bool()
+			if bucket_pressure {
+				if float64(mem_used) > (high_mem_mark*float64(memory_quota)) &&
+					!memPressure && mem_used > min_oom_mem {
+					idx.internalRecvCh <- &MsgMemoryPressure{high: true}
+					memPressure = true
+				} else if float64(mem_used) < (low_mem_mark*float64(memory_quota)) &&
+					memPressure {
+					idx.internalRecvCh <- &MsgMemoryPressure{high: false}
+					memPressure = false
+				}
+				high_mem_mark = 1.0
+			} else if memPressure {
+				idx.internalRecvCh <- &MsgMemoryPressure{high: false}
+				memPressure = false
+			}
+
 			switch idx.getIndexerState() {
 
 			case common.INDEXER_ACTIVE:
@@ -4106,6 +4530,42 @@ func (idx *indexer) monitorMemUsage() {
 
 }
 
+//handleBucketPressure throttles or releases the stream of a bucket in
+//the projectors and lets scan coordinator queue or shed scans on it
+func (idx *indexer) handleBucketPressure(msg Message) {
+
+	streamId := msg.(*MsgBucketPressure).GetStreamId()
+	bucket := msg.(*MsgBucketPressure).GetBucket()
+
+	if idx.getStreamBucketState(streamId, bucket) == STREAM_INACTIVE {
+		logging.Warnf("Indexer::handleBucketPressure Skipped Projector "+
+			"Throttle %v %v. STREAM_INACTIVE", streamId, bucket)
+	} else {
+		idx.sendMsgToKVSender(msg)
+	}
+
+	idx.scanCoordCmdCh <- msg
+	<-idx.scanCoordCmdCh
+}
+
+//handleStreamFeedback forwards the feedback for buckets with an
+//active stream to the projectors
+func (idx *indexer) handleStreamFeedback(msg Message) {
+
+	streamId := msg.(*MsgStreamFeedback).GetStreamId()
+	feedback := make(map[string]*bucketFeedback)
+	for bucket, fb := range msg.(*MsgStreamFeedback).GetFeedback() {
+		if idx.getStreamBucketState(streamId, bucket) == STREAM_ACTIVE {
+			feedback[bucket] = fb
+		}
+	}
+
+	if len(feedback) > 0 {
+		idx.sendMsgToKVSender(&MsgStreamFeedback{streamId: streamId,
+			feedback: feedback})
+	}
+}
+
 func (idx *indexer) handleIndexerPause(msg Message) {
 
 	logging.Infof("Indexer::handleIndexerPause")
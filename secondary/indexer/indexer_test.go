@@ -0,0 +1,245 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+type testSnapshotInfo struct {
+	ts *common.TsVbuuid
+}
+
+func (info *testSnapshotInfo) Timestamp() *common.TsVbuuid {
+	return info.ts
+}
+
+func (info *testSnapshotInfo) IsCommitted() bool {
+	return true
+}
+
+// restartTestSlice is a slice with the given snapshots, latest first,
+// as returned by storage.
+type restartTestSlice struct {
+	Slice
+	infos      []SnapshotInfo
+	rolledBack bool
+}
+
+func (s *restartTestSlice) Id() SliceId {
+	return 0
+}
+
+func (s *restartTestSlice) GetSnapshots() ([]SnapshotInfo, error) {
+	return s.infos, nil
+}
+
+func (s *restartTestSlice) RollbackToZero() error {
+	s.rolledBack = true
+	s.infos = nil
+	return nil
+}
+
+func newRestartTestTs(seqnos ...uint64) *common.TsVbuuid {
+	ts := common.NewTsVbuuid("default", len(seqnos))
+	for i, seqno := range seqnos {
+		ts.Seqnos[i] = seqno
+		ts.Vbuuids[i] = 100
+		ts.Snapshots[i] = [2]uint64{seqno, seqno}
+	}
+	return ts
+}
+
+// newStopBuildTestIndexer returns an indexer with an index instance for
+// each of the slices, instance id starting from 1.
+func newStopBuildTestIndexer(states []common.IndexState, slices ...*restartTestSlice) *indexer {
+	idx := &indexer{state: common.INDEXER_ACTIVE,
+		indexInstMap:                 make(common.IndexInstMap),
+		indexPartnMap:                make(IndexPartnMap),
+		streamBucketStatus:           make(map[common.StreamId]BucketStatus),
+		streamBucketFlushInProgress:  make(map[common.StreamId]BucketFlushInProgressMap),
+		streamBucketObserveFlushDone: make(map[common.StreamId]BucketObserveFlushDoneMap),
+		internalRecvCh:               make(MsgChannel, 10),
+	}
+
+	for i, slice := range slices {
+		instId := common.IndexInstId(i + 1)
+		stream := common.NIL_STREAM
+		if states[i] == common.INDEX_STATE_INITIAL || states[i] == common.INDEX_STATE_CATCHUP {
+			stream = common.INIT_STREAM
+		}
+		idx.indexInstMap[instId] = common.IndexInst{InstId: instId, State: states[i], Stream: stream,
+			Defn: common.IndexDefn{DefnId: common.IndexDefnId(instId), Bucket: "default"}}
+
+		sc := NewHashedSliceContainer()
+		sc.AddSlice(0, slice)
+		idx.indexPartnMap[instId] = PartitionInstMap{0: PartitionInst{Sc: sc}}
+	}
+	return idx
+}
+
+func TestMakeRestartTsForIndexList(t *testing.T) {
+	ts10, ts20 := newRestartTestTs(10, 20), newRestartTestTs(20, 30)
+	ts5 := newRestartTestTs(5, 15)
+
+	idx := newStopBuildTestIndexer(
+		[]common.IndexState{common.INDEX_STATE_READY, common.INDEX_STATE_READY, common.INDEX_STATE_READY},
+		&restartTestSlice{infos: []SnapshotInfo{&testSnapshotInfo{ts20}, &testSnapshotInfo{ts10}}},
+		&restartTestSlice{infos: []SnapshotInfo{&testSnapshotInfo{ts5}}},
+		&restartTestSlice{})
+
+	tests := []struct {
+		name     string
+		ids      []common.IndexInstId
+		expected *common.TsVbuuid
+	}{
+		{"latest snapshot", []common.IndexInstId{1}, ts20},
+		{"oldest of indexes", []common.IndexInstId{1, 2}, ts5},
+		{"oldest of indexes reversed", []common.IndexInstId{2, 1}, ts5},
+		//an index without snapshot rebuilds all indexes from zero
+		{"no snapshot", []common.IndexInstId{3}, nil},
+		{"one index without snapshot", []common.IndexInstId{1, 3}, nil},
+		{"one index without snapshot last", []common.IndexInstId{3, 1}, nil},
+		{"unknown index", []common.IndexInstId{1, 4}, nil},
+	}
+	for _, test := range tests {
+		if ts := idx.makeRestartTsForIndexList(test.ids); ts != test.expected {
+			t.Errorf("%v: expected restart ts %v, got %v", test.name, test.expected, ts)
+		}
+	}
+}
+
+func TestHandleStopIndexBuild(t *testing.T) {
+
+	stop := func(idx *indexer, id common.IndexInstId, cancel bool) Message {
+		var mType MsgType = CLUST_MGR_PAUSE_INDEX_BUILD
+		if cancel {
+			mType = CLUST_MGR_CANCEL_INDEX_BUILD
+		}
+		respCh := make(MsgChannel, 1)
+		idx.handleStopIndexBuild(&MsgDropIndex{mType: mType, indexInstId: id, respCh: respCh})
+		select {
+		case resp := <-respCh:
+			return resp
+		default:
+			t.Fatalf("no response for stop build of index %v", id)
+		}
+		return nil
+	}
+
+	checkErr := func(name string, resp Message, code errCode) {
+		if resp.GetMsgType() != MSG_ERROR {
+			t.Errorf("%v: expected error %v, got %v", name, code, resp)
+		} else if err := resp.(*MsgError).GetError(); err.code != code {
+			t.Errorf("%v: expected error %v, got %v", name, code, err.code)
+		}
+	}
+
+	paused := &restartTestSlice{infos: []SnapshotInfo{&testSnapshotInfo{newRestartTestTs(10, 20)}}}
+	building := &restartTestSlice{infos: []SnapshotInfo{&testSnapshotInfo{newRestartTestTs(10, 20)}}}
+	idx := newStopBuildTestIndexer(
+		[]common.IndexState{common.INDEX_STATE_READY, common.INDEX_STATE_INITIAL},
+		paused, building)
+
+	checkErr("unknown index", stop(idx, 3, false), ERROR_INDEXER_UNKNOWN_INDEX)
+
+	//a paused index has nothing to pause, and keeps its data
+	checkErr("pause paused index", stop(idx, 1, false), ERROR_INDEX_BUILD_NOT_IN_PROGRESS)
+	if paused.rolledBack || idx.makeRestartTsForIndexList([]common.IndexInstId{1}) == nil {
+		t.Errorf("expected paused index to resume from its snapshot")
+	}
+
+	idx.state = common.INDEXER_PAUSED
+	checkErr("indexer not active", stop(idx, 1, true), ERROR_INDEXER_NOT_ACTIVE)
+	idx.state = common.INDEXER_ACTIVE
+
+	//cancel of a paused index discards its data, a later build starts over
+	if resp := stop(idx, 1, true); resp.GetMsgType() != MSG_SUCCESS {
+		t.Fatalf("expected cancel of paused index to succeed, got %v", resp)
+	}
+	if !paused.rolledBack {
+		t.Errorf("expected cancelled index rolled back to zero")
+	}
+	if ts := idx.makeRestartTsForIndexList([]common.IndexInstId{1}); ts != nil {
+		t.Errorf("expected cancelled index to build from zero, got restart ts %v", ts)
+	}
+	if ts := idx.makeRestartTsForIndexList([]common.IndexInstId{1, 2}); ts != nil {
+		t.Errorf("expected build with a cancelled index from zero, got restart ts %v", ts)
+	}
+
+	//a build in progress cannot be stopped in recovery, or while another
+	//stop is waiting for flush
+	idx.streamBucketStatus[common.INIT_STREAM] = BucketStatus{"default": STREAM_PREPARE_RECOVERY}
+	checkErr("recovery", stop(idx, 2, false), ERROR_INDEXER_IN_RECOVERY)
+	idx.streamBucketStatus[common.INIT_STREAM]["default"] = STREAM_ACTIVE
+
+	idx.streamBucketObserveFlushDone[common.INIT_STREAM] = BucketObserveFlushDoneMap{"default": make(MsgChannel)}
+	checkErr("stop in progress", stop(idx, 2, false), ERROR_INDEX_DROP_IN_PROGRESS)
+	if building.rolledBack || idx.indexInstMap[2].State != common.INDEX_STATE_INITIAL {
+		t.Errorf("expected index build not stopped")
+	}
+}
+
+func TestRollbackResumedBuild(t *testing.T) {
+	idx := newStopBuildTestIndexer(nil)
+	rollbackTs := newRestartTestTs(5, 15)
+	resp := &MsgRollback{streamId: common.INIT_STREAM, bucket: "default", rollbackTs: rollbackTs}
+
+	//a build from zero cannot be rolled back
+	if idx.recoverResumedBuildRollback(common.INIT_STREAM, "default", nil, resp) {
+		t.Fatalf("expected rollback of build from zero not recovered")
+	}
+	if len(idx.internalRecvCh) != 0 {
+		t.Fatalf("unexpected recovery %v", <-idx.internalRecvCh)
+	}
+
+	//a resumed build is recovered from the rollback ts
+	if !idx.recoverResumedBuildRollback(common.INIT_STREAM, "default", newRestartTestTs(10, 20), resp) {
+		t.Fatalf("expected rollback of resumed build recovered")
+	}
+	if len(idx.internalRecvCh) != 1 {
+		t.Fatalf("expected recovery message, got %v", len(idx.internalRecvCh))
+	}
+	msg := (<-idx.internalRecvCh).(*MsgRecovery)
+	if msg.GetMsgType() != INDEXER_INIT_PREP_RECOVERY || msg.GetStreamId() != common.INIT_STREAM ||
+		msg.GetBucket() != "default" || msg.GetRestartTs() != rollbackTs {
+		t.Errorf("unexpected recovery message %v", msg)
+	}
+
+	//the stream is prepared for recovery with the rollback ts
+	idx.streamBucketStatus[common.INIT_STREAM] = BucketStatus{"default": STREAM_ACTIVE}
+	idx.streamBucketRollbackTs = make(map[common.StreamId]BucketRollbackTs)
+	idx.tkCmdCh = make(MsgChannel)
+	go func() {
+		<-idx.tkCmdCh
+		idx.tkCmdCh <- &MsgSuccess{}
+	}()
+	idx.handleInitPrepRecovery(msg)
+	if idx.streamBucketRollbackTs[common.INIT_STREAM]["default"] != rollbackTs {
+		t.Errorf("expected rollback ts recorded for recovery")
+	}
+	if state := idx.getStreamBucketState(common.INIT_STREAM, "default"); state != STREAM_PREPARE_RECOVERY {
+		t.Errorf("expected stream state %v, got %v", STREAM_PREPARE_RECOVERY, state)
+	}
+}
+
+func TestRollbackResumedIndexesToZero(t *testing.T) {
+	paused := &restartTestSlice{infos: []SnapshotInfo{&testSnapshotInfo{newRestartTestTs(10, 20)}}}
+	fresh := &restartTestSlice{}
+	idx := newStopBuildTestIndexer(
+		[]common.IndexState{common.INDEX_STATE_READY, common.INDEX_STATE_READY}, paused, fresh)
+
+	//a paused index built along with a new index restarts from zero,
+	//without the data it has built so far
+	ids := []common.IndexInstId{1, 2}
+	if ts := idx.makeRestartTsForIndexList(ids); ts != nil {
+		t.Fatalf("expected build from zero, got restart ts %v", ts)
+	}
+	idx.rollbackResumedIndexesToZero(ids)
+	if !paused.rolledBack {
+		t.Errorf("expected paused index rolled back to zero")
+	}
+	if fresh.rolledBack {
+		t.Errorf("expected new index not rolled back")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"errors"
 	"fmt"
 	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/failpoint"
 	"github.com/couchbase/indexing/secondary/logging"
 	projClient "github.com/couchbase/indexing/secondary/projector/client"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
@@ -43,6 +44,11 @@ type kvSender struct {
 
 	cInfoCache *c.ClusterInfoCache
 	config     c.Config
+
+	throttleCh chan *MsgBucketPressure //serializes throttle requests to projectors
+	feedbackCh chan *MsgStreamFeedback //feedback waiting to be sent to projectors
+
+	projAddrsStaleCh chan bool //projector addresses for feedback to be fetched again
 }
 
 func NewKVSender(supvCmdch MsgChannel, supvRespch MsgChannel,
@@ -62,12 +68,18 @@ func NewKVSender(supvCmdch MsgChannel, supvRespch MsgChannel,
 		supvRespch: supvRespch,
 		cInfoCache: cinfo,
 		config:     config,
+		throttleCh: make(chan *MsgBucketPressure, WORKER_MSG_QUEUE_LEN),
+		feedbackCh: make(chan *MsgStreamFeedback, int(c.ALL_STREAMS)),
+
+		projAddrsStaleCh: make(chan bool, 1),
 	}
 
 	k.cInfoCache.SetMaxRetries(MAX_CLUSTER_FETCH_RETRY)
 	k.cInfoCache.SetLogPrefix("KVSender: ")
 	//start kvsender loop which listens to commands from its supervisor
 	go k.run()
+	go k.throttleBuckets()
+	go k.sendFeedback()
 
 	return k, &MsgSuccess{}
 
@@ -86,6 +98,8 @@ loop:
 			if ok {
 				if cmd.GetMsgType() == KV_SENDER_SHUTDOWN {
 					logging.Infof("KVSender::run Shutting Down")
+					close(k.throttleCh)
+					close(k.feedbackCh)
 					k.supvCmdch <- &MsgSuccess{}
 					break loop
 				}
@@ -104,9 +118,11 @@ func (k *kvSender) handleSupvervisorCommands(cmd Message) {
 	switch cmd.GetMsgType() {
 
 	case OPEN_STREAM:
+		k.invalidateProjectorAddrs()
 		k.handleOpenStream(cmd)
 
 	case ADD_INDEX_LIST_TO_STREAM:
+		k.invalidateProjectorAddrs()
 		k.handleAddIndexListToStream(cmd)
 
 	case REMOVE_INDEX_LIST_FROM_STREAM:
@@ -119,8 +135,15 @@ func (k *kvSender) handleSupvervisorCommands(cmd Message) {
 		k.handleCloseStream(cmd)
 
 	case KV_SENDER_RESTART_VBUCKETS:
+		k.invalidateProjectorAddrs()
 		k.handleRestartVbuckets(cmd)
 
+	case MUT_MGR_BUCKET_PRESSURE:
+		k.handleBucketPressure(cmd)
+
+	case MUT_MGR_STREAM_FEEDBACK:
+		k.handleStreamFeedback(cmd)
+
 	case CONFIG_SETTINGS_UPDATE:
 		k.handleConfigUpdate(cmd)
 
@@ -232,6 +255,144 @@ func (k *kvSender) handleRestartVbuckets(cmd Message) {
 	k.supvCmdch <- &MsgSuccess{}
 }
 
+func (k *kvSender) handleBucketPressure(cmd Message) {
+
+	logging.LazyDebug(func() string {
+		return fmt.Sprintf("KVSender::handleBucketPressure %v", cmd)
+	})
+
+	k.throttleCh <- cmd.(*MsgBucketPressure)
+	k.supvCmdch <- &MsgSuccess{}
+}
+
+//throttleBuckets sends throttle requests to projectors in the order
+//they are received, so a release never overtakes its throttle
+func (k *kvSender) throttleBuckets() {
+
+	for msg := range k.throttleCh {
+		k.throttleBucket(msg.GetStreamId(), msg.GetBucket(), msg.GetAckDelay())
+	}
+}
+
+func (k *kvSender) throttleBucket(streamId c.StreamId, bucket string,
+	ackDelay time.Duration) {
+
+	addrs, err := k.getAllProjectorAddrs()
+	if err != nil {
+		logging.Errorf("KVSender::throttleBucket %v %v Error in fetching cluster info %v",
+			streamId, bucket, err)
+		return
+	}
+
+	topic := getTopicForStreamId(streamId)
+	delay := uint32(ackDelay / time.Millisecond)
+
+	fn := func(r int, err error) error {
+
+		//clear the error before every retry
+		err = nil
+		for _, addr := range addrs {
+			ap := newProjClient(addr)
+			if ret := sendThrottleBucketsRequest(ap, topic, []string{bucket}, delay); ret != nil {
+				//Treat TopicMissing/InvalidBucket as success, stream is not open
+				if ret.Error() == projClient.ErrorTopicMissing.Error() ||
+					ret.Error() == projClient.ErrorInvalidBucket.Error() {
+					logging.Infof("KVSender::throttleBucket %v %v Treating %v As Success",
+						streamId, bucket, ret)
+				} else {
+					err = ret
+				}
+			}
+		}
+		return err
+	}
+
+	rh := c.NewRetryHelper(MAX_KV_REQUEST_RETRY, time.Second, BACKOFF_FACTOR, fn)
+	if err := rh.Run(); err != nil {
+		logging.Errorf("KVSender::throttleBucket %v %v Error Received %v",
+			streamId, bucket, err)
+	}
+}
+
+func (k *kvSender) handleStreamFeedback(cmd Message) {
+
+	logging.LazyTrace(func() string {
+		return fmt.Sprintf("KVSender::handleStreamFeedback %v", cmd)
+	})
+
+	//feedback is periodic, drop it if projectors are not keeping up
+	select {
+	case k.feedbackCh <- cmd.(*MsgStreamFeedback):
+	default:
+		logging.Warnf("KVSender::handleStreamFeedback Dropped Feedback For %v",
+			cmd.(*MsgStreamFeedback).GetStreamId())
+	}
+	k.supvCmdch <- &MsgSuccess{}
+}
+
+//invalidateProjectorAddrs makes sendFeedback fetch the projector addresses
+//again. Streams are opened or restarted when the cluster topology changes.
+func (k *kvSender) invalidateProjectorAddrs() {
+	select {
+	case k.projAddrsStaleCh <- true:
+	default:
+	}
+}
+
+//sendFeedback sends feedback to projectors in the order it is received.
+//It is not retried, the next feedback is never far behind.
+//Projector addresses are cached, fetching cluster info from ns_server for
+//every feedback is too expensive. They are fetched again on a topology
+//change, see invalidateProjectorAddrs, or an error from a projector.
+func (k *kvSender) sendFeedback() {
+
+	var addrs []string
+	for msg := range k.feedbackCh {
+		streamId := msg.GetStreamId()
+
+		select {
+		case <-k.projAddrsStaleCh:
+			addrs = nil
+		default:
+		}
+
+		if addrs == nil {
+			var err error
+			if addrs, err = k.getAllProjectorAddrs(); err != nil {
+				logging.Errorf("KVSender::sendFeedback %v Error in fetching cluster info %v",
+					streamId, err)
+				continue
+			}
+		}
+
+		var buckets []*protobuf.BucketFeedback
+		for bucket, fb := range msg.GetFeedback() {
+			buckets = append(buckets, protobuf.NewBucketFeedback(bucket,
+				uint64(fb.queueDepth), uint64(fb.queueMemory),
+				uint64(fb.flushLatency/time.Millisecond)))
+		}
+
+		var refresh bool
+		topic := getTopicForStreamId(streamId)
+		for _, addr := range addrs {
+			ap := newProjClient(addr)
+			if err := ap.SendFeedback(topic, buckets); err != nil {
+				//TopicMissing/InvalidBucket, stream is not open on this projector yet
+				if err.Error() != projClient.ErrorTopicMissing.Error() &&
+					err.Error() != projClient.ErrorInvalidBucket.Error() {
+					logging.Errorf("KVSender::sendFeedback %v Projector %v Err %v",
+						streamId, addr, err)
+					//projector may have left the cluster
+					refresh = true
+				}
+			}
+		}
+		if refresh {
+			addrs = nil
+		}
+	}
+}
+
 func (k *kvSender) openMutationStream(streamId c.StreamId, indexInstList []c.IndexInst,
 	restartTs *c.TsVbuuid, respCh MsgChannel, stopCh StopChannel) {
 
@@ -694,6 +855,10 @@ func (k *kvSender) sendMutationTopicRequest(ap *projClient.Client, topic string,
 
 	endpointType := "dataport"
 
+	if err := failpoint.Inject(FP_KV_SENDER_REQUEST); err != nil {
+		return nil, err
+	}
+
 	if res, err := ap.MutationTopicRequest(topic, endpointType,
 		[]*protobuf.TsVbuuid{reqTimestamps}, instances); err != nil {
 		logging.Errorf("KVSender::sendMutationTopicRequest Projector %v Topic %v %v \n\tUnexpected Error %v", ap,
@@ -748,6 +913,10 @@ func (k *kvSender) sendRestartVbuckets(ap *projClient.Client,
 		}
 	}
 
+	if err := failpoint.Inject(FP_KV_SENDER_REQUEST); err != nil {
+		return nil, err
+	}
+
 	if res, err := ap.RestartVbuckets(topic, []*protobuf.TsVbuuid{restartTs}); err != nil {
 		logging.Errorf("KVSender::sendRestartVbuckets Unexpected Error During "+
 			"Restart Vbuckets Request for Projector %v Topic %v %v . Err %v.", ap,
@@ -836,6 +1005,28 @@ func sendDelBucketsRequest(ap *projClient.Client,
 	}
 }
 
+//send the actual ThrottleBuckets request on adminport
+func sendThrottleBucketsRequest(ap *projClient.Client,
+	topic string,
+	buckets []string,
+	ackDelay uint32) error {
+
+	logging.Infof("KVSender::sendThrottleBucketsRequest Projector %v Topic %v Buckets %v "+
+		"AckDelay %vms", ap, topic, buckets, ackDelay)
+
+	if err := ap.ThrottleBuckets(topic, buckets, ackDelay); err != nil {
+		logging.Errorf("KVSender::sendThrottleBucketsRequest Unexpected Error During "+
+			"Throttle Buckets Request Projector %v Topic %v Buckets %v. Err %v", ap,
+			topic, buckets, err)
+
+		return err
+	} else {
+		logging.Infof("KVSender::sendThrottleBucketsRequest Success Projector %v Topic %v Buckets %v",
+			ap, topic, buckets)
+		return nil
+	}
+}
+
 //send the actual ShutdownStreamRequest on adminport
 func sendShutdownTopic(ap *projClient.Client,
 	topic string) error {
@@ -1171,6 +1362,16 @@ func convertIndexDefnToProtobuf(indexDefn c.IndexDefn) *protobuf.IndexDefn {
 		PartitionScheme: partnScheme,
 		PartnExpression: proto.String(indexDefn.PartitionKey),
 		WhereExpression: proto.String(indexDefn.WhereExpr),
+		Scope:           proto.String(indexDefn.Scope),
+		ScopeID:         proto.String(indexDefn.ScopeId),
+		Collection:      proto.String(indexDefn.Collection),
+		CollectionID:    proto.String(indexDefn.CollectionId),
+		IsAdaptive:      proto.Bool(indexDefn.IsAdaptive),
+		FieldPrefixes:   indexDefn.FieldPrefixes,
+		MaxFields:       proto.Uint32(uint32(indexDefn.MaxFields)),
+		MaxValueSize:    proto.Uint32(uint32(indexDefn.MaxValueSize)),
+		Immutable:       proto.Bool(indexDefn.Immutable),
+		WhereImmutable:  proto.Bool(indexDefn.WhereImmutable),
 	}
 
 	return defn
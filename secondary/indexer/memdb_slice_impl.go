@@ -16,7 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/common"
-	"github.com/couchbase/indexing/secondary/common/queryutil"
+	"github.com/couchbase/indexing/secondary/failpoint"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/memdb"
 	"github.com/couchbase/indexing/secondary/memdb/mm"
@@ -201,7 +201,7 @@ func NewMemDBSlice(path string, sliceId SliceId, idxDefn common.IndexDefn,
 	slice.initStores()
 
 	// Array related initialization
-	_, slice.isArrayDistinct, slice.arrayExprPosition, err = queryutil.GetArrayExpressionPosition(idxDefn.SecExprs)
+	slice.isArrayDistinct, slice.arrayExprPosition, err = getArrayExprPosition(idxDefn)
 	if err != nil {
 		return nil, err
 	}
@@ -295,6 +295,9 @@ loop:
 		var nmut int
 		select {
 		case icmd = <-mdb.cmdCh[workerId]:
+			if err := failpoint.Inject(FP_SLICE_WRITE); err != nil {
+				mdb.checkFatalDbError(err)
+			}
 			switch icmd.op {
 			case opUpdate:
 				start = time.Now()
@@ -647,18 +650,28 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 
 		mdb.confLock.RUnlock()
 		err := mdb.mainstore.StoreToDisk(tmpdir, s.info.MainSnap, concurrency, nil)
+		if err == nil {
+			err = failpoint.Inject(FP_SNAPSHOT_PERSIST)
+		}
 		if err == nil {
 			var fd *os.File
 			var bs []byte
 			bs, err = json.Marshal(s.info)
 			if err == nil {
 				fd, err = os.OpenFile(manifest, os.O_WRONLY|os.O_CREATE, 0755)
+			}
+			if err == nil {
 				_, err = fd.Write(bs)
 				if err == nil {
 					err = fd.Close()
+				} else {
+					fd.Close()
 				}
 			}
 
+			if err == nil {
+				err = failpoint.Inject(FP_SNAPSHOT_MANIFEST)
+			}
 			if err == nil {
 				err = os.Rename(tmpdir, dir)
 				if err == nil {
@@ -802,6 +815,10 @@ func (mdb *memdbSlice) Rollback(info SnapshotInfo) error {
 		}
 	}
 
+	if err := failpoint.Inject(FP_SLICE_ROLLBACK); err != nil {
+		return err
+	}
+
 	mdb.resetStores()
 	return nil
 }
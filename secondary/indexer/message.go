@@ -47,6 +47,9 @@ const (
 	MUT_MGR_SHUTDOWN
 	MUT_MGR_FLUSH_DONE
 	MUT_MGR_ABORT_DONE
+	MUT_MGR_BUCKET_PRESSURE
+	MUT_MGR_MEMORY_PRESSURE
+	MUT_MGR_STREAM_FEEDBACK
 
 	//TIMEKEEPER
 	TK_SHUTDOWN
@@ -58,12 +61,16 @@ const (
 	TK_MERGE_STREAM
 	TK_MERGE_STREAM_ACK
 	TK_GET_BUCKET_HWT
+	TK_BUCKET_IDLE
+	TK_ON_DEMAND_SNAPSHOT
 
 	//STORAGE_MANAGER
 	STORAGE_MGR_SHUTDOWN
 	STORAGE_INDEX_SNAP_REQUEST
 	STORAGE_INDEX_STORAGE_STATS
 	STORAGE_INDEX_COMPACT
+	STORAGE_INDEX_SCRUB
+	STORAGE_INDEX_SCRUB_REPAIR
 	STORAGE_SNAP_DONE
 
 	//KVSender
@@ -90,6 +97,9 @@ const (
 	CLUST_MGR_DEL_BUCKET
 	CLUST_MGR_INDEXER_READY
 	CLUST_MGR_CLEANUP_INDEX
+	CLUST_MGR_PAUSE_INDEX_BUILD
+	CLUST_MGR_CANCEL_INDEX_BUILD
+	CLUST_MGR_RENAME_INDEX
 
 	//CBQ_BRIDGE_SHUTDOWN
 	CBQ_BRIDGE_SHUTDOWN
@@ -542,12 +552,94 @@ func (m *MsgMutMgrFlushDone) String() string {
 
 }
 
+//MUT_MGR_BUCKET_PRESSURE
+type MsgBucketPressure struct {
+	streamId  common.StreamId
+	bucket    string
+	throttled bool
+	ackDelay  time.Duration
+}
+
+func (m *MsgBucketPressure) GetMsgType() MsgType {
+	return MUT_MGR_BUCKET_PRESSURE
+}
+
+func (m *MsgBucketPressure) GetStreamId() common.StreamId {
+	return m.streamId
+}
+
+func (m *MsgBucketPressure) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgBucketPressure) IsThrottled() bool {
+	return m.throttled
+}
+
+func (m *MsgBucketPressure) GetAckDelay() time.Duration {
+	return m.ackDelay
+}
+
+func (m *MsgBucketPressure) String() string {
+
+	str := "\n\tMessage: MsgBucketPressure"
+	str += fmt.Sprintf("\n\tStream: %v", m.streamId)
+	str += fmt.Sprintf("\n\tBucket: %v", m.bucket)
+	str += fmt.Sprintf("\n\tThrottled: %v", m.throttled)
+	str += fmt.Sprintf("\n\tAckDelay: %v", m.ackDelay)
+	return str
+
+}
+
+//MUT_MGR_STREAM_FEEDBACK
+type MsgStreamFeedback struct {
+	streamId common.StreamId
+	feedback map[string]*bucketFeedback
+}
+
+func (m *MsgStreamFeedback) GetMsgType() MsgType {
+	return MUT_MGR_STREAM_FEEDBACK
+}
+
+func (m *MsgStreamFeedback) GetStreamId() common.StreamId {
+	return m.streamId
+}
+
+func (m *MsgStreamFeedback) GetFeedback() map[string]*bucketFeedback {
+	return m.feedback
+}
+
+func (m *MsgStreamFeedback) String() string {
+
+	str := "\n\tMessage: MsgStreamFeedback"
+	str += fmt.Sprintf("\n\tStream: %v", m.streamId)
+	for bucket, fb := range m.feedback {
+		str += fmt.Sprintf("\n\tBucket: %v %v", bucket, fb)
+	}
+	return str
+
+}
+
+//MUT_MGR_MEMORY_PRESSURE
+type MsgMemoryPressure struct {
+	high bool
+}
+
+func (m *MsgMemoryPressure) GetMsgType() MsgType {
+	return MUT_MGR_MEMORY_PRESSURE
+}
+
+func (m *MsgMemoryPressure) IsHigh() bool {
+	return m.high
+}
+
 //TK_STABILITY_TIMESTAMP
 type MsgTKStabilityTS struct {
 	ts        *common.TsVbuuid
 	streamId  common.StreamId
 	bucket    string
 	changeVec []bool
+	onDemand  bool
 }
 
 func (m *MsgTKStabilityTS) GetMsgType() MsgType {
@@ -570,12 +662,19 @@ func (m *MsgTKStabilityTS) GetChangeVector() []bool {
 	return m.changeVec
 }
 
+//IsOnDemand returns true if the TS has already been flushed and
+//only needs to be snapshotted
+func (m *MsgTKStabilityTS) IsOnDemand() bool {
+	return m.onDemand
+}
+
 func (m *MsgTKStabilityTS) String() string {
 
 	str := "\n\tMessage: MsgTKStabilityTS"
 	str += fmt.Sprintf("\n\tStream: %v", m.streamId)
 	str += fmt.Sprintf("\n\tBucket: %v", m.bucket)
 	str += fmt.Sprintf("\n\tTS: %v", m.ts)
+	str += fmt.Sprintf("\n\tOnDemand: %v", m.onDemand)
 	return str
 
 }
@@ -640,6 +739,56 @@ func (m *MsgTKMergeStream) GetMergeList() []common.IndexInst {
 	return m.mergeList
 }
 
+//TK_BUCKET_IDLE
+//sent when all the mutations received for a stream-bucket
+//have been flushed and snapshotted at ts
+type MsgTKBucketIdle struct {
+	streamId common.StreamId
+	bucket   string
+	ts       *common.TsVbuuid
+}
+
+func (m *MsgTKBucketIdle) GetMsgType() MsgType {
+	return TK_BUCKET_IDLE
+}
+
+func (m *MsgTKBucketIdle) GetStreamId() common.StreamId {
+	return m.streamId
+}
+
+func (m *MsgTKBucketIdle) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgTKBucketIdle) GetTimestamp() *common.TsVbuuid {
+	return m.ts
+}
+
+//TK_ON_DEMAND_SNAPSHOT
+//sent when a scan starts waiting for a snapshot of a stream-bucket
+//at least as recent as ts
+type MsgTKOnDemandSnapshot struct {
+	streamId common.StreamId
+	bucket   string
+	ts       *common.TsVbuuid
+}
+
+func (m *MsgTKOnDemandSnapshot) GetMsgType() MsgType {
+	return TK_ON_DEMAND_SNAPSHOT
+}
+
+func (m *MsgTKOnDemandSnapshot) GetStreamId() common.StreamId {
+	return m.streamId
+}
+
+func (m *MsgTKOnDemandSnapshot) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgTKOnDemandSnapshot) GetTimestamp() *common.TsVbuuid {
+	return m.ts
+}
+
 //TK_ENABLE_FLUSH
 //TK_DISABLE_FLUSH
 type MsgTKToggleFlush struct {
@@ -742,6 +891,8 @@ func (m *MsgBuildIndexResponse) GetString() string {
 
 //CBQ_DROP_INDEX_DDL
 //CLUST_MGR_DROP_INDEX_DDL
+//CLUST_MGR_PAUSE_INDEX_BUILD
+//CLUST_MGR_CANCEL_INDEX_BUILD
 type MsgDropIndex struct {
 	mType       MsgType
 	indexInstId common.IndexInstId
@@ -773,6 +924,37 @@ func (m *MsgDropIndex) GetString() string {
 	return str
 }
 
+//CLUST_MGR_RENAME_INDEX
+type MsgRenameIndex struct {
+	indexInstId common.IndexInstId
+	name        string
+	respCh      MsgChannel
+}
+
+func (m *MsgRenameIndex) GetMsgType() MsgType {
+	return CLUST_MGR_RENAME_INDEX
+}
+
+func (m *MsgRenameIndex) GetIndexInstId() common.IndexInstId {
+	return m.indexInstId
+}
+
+func (m *MsgRenameIndex) GetName() string {
+	return m.name
+}
+
+func (m *MsgRenameIndex) GetResponseChannel() MsgChannel {
+	return m.respCh
+}
+
+func (m *MsgRenameIndex) GetString() string {
+
+	str := "\n\tMessage: MsgRenameIndex"
+	str += fmt.Sprintf("\n\tIndex: %v", m.indexInstId)
+	str += fmt.Sprintf("\n\tName: %v", m.name)
+	return str
+}
+
 //TK_GET_BUCKET_HWT
 //STREAM_READER_HWT
 type MsgBucketHWT struct {
@@ -781,6 +963,9 @@ type MsgBucketHWT struct {
 	bucket   string
 	ts       *common.TsVbuuid
 	prevSnap *common.TsVbuuid
+
+	//high seqno per vbucket of each collection in bucket
+	collSeqnos map[uint32]Timestamp
 }
 
 func (m *MsgBucketHWT) GetMsgType() MsgType {
@@ -803,6 +988,10 @@ func (m *MsgBucketHWT) GetPrevSnap() *common.TsVbuuid {
 	return m.prevSnap
 }
 
+func (m *MsgBucketHWT) GetCollectionSeqnos() map[uint32]Timestamp {
+	return m.collSeqnos
+}
+
 func (m *MsgBucketHWT) String() string {
 
 	str := "\n\tMessage: MsgBucketHWT"
@@ -964,6 +1153,7 @@ func (m *MsgRepairAbort) GetBucket() string {
 type MsgIndexSnapRequest struct {
 	ts          *common.TsVbuuid
 	cons        common.Consistency
+	staleness   time.Duration
 	idxInstId   common.IndexInstId
 	expiredTime time.Time
 
@@ -983,6 +1173,10 @@ func (m *MsgIndexSnapRequest) GetConsistency() common.Consistency {
 	return m.cons
 }
 
+func (m *MsgIndexSnapRequest) GetStaleness() time.Duration {
+	return m.staleness
+}
+
 func (m *MsgIndexSnapRequest) GetExpiredTime() time.Time {
 	return m.expiredTime
 }
@@ -1042,6 +1236,67 @@ func (m *MsgIndexCompact) GetAbortTime() time.Time {
 	return m.abortTime
 }
 
+//STORAGE_INDEX_SCRUB
+//Index is identified by instId, or by bucket and name
+//if instId is not set. Response is a *ScrubReport or
+//an error.
+type MsgIndexScrub struct {
+	instId  common.IndexInstId
+	bucket  string
+	name    string
+	options ScrubOptions
+	respch  chan interface{}
+}
+
+func (m *MsgIndexScrub) GetMsgType() MsgType {
+	return STORAGE_INDEX_SCRUB
+}
+
+func (m *MsgIndexScrub) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgIndexScrub) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgIndexScrub) GetName() string {
+	return m.name
+}
+
+func (m *MsgIndexScrub) GetOptions() ScrubOptions {
+	return m.options
+}
+
+func (m *MsgIndexScrub) GetResponseChannel() chan interface{} {
+	return m.respch
+}
+
+//STORAGE_INDEX_SCRUB_REPAIR
+//Response is a *scrubRepairResult or an error.
+type MsgIndexScrubRepair struct {
+	instId common.IndexInstId
+	ts     *common.TsVbuuid
+	fixes  []*scrubFix
+	respch chan interface{}
+}
+
+func (m *MsgIndexScrubRepair) GetMsgType() MsgType {
+	return STORAGE_INDEX_SCRUB_REPAIR
+}
+
+func (m *MsgIndexScrubRepair) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgIndexScrubRepair) GetTimestamp() *common.TsVbuuid {
+	return m.ts
+}
+
+func (m *MsgIndexScrubRepair) GetResponseChannel() chan interface{} {
+	return m.respch
+}
+
 //KV_STREAM_REPAIR
 type MsgKVStreamRepair struct {
 	streamId  common.StreamId
@@ -1213,6 +1468,12 @@ func (m MsgType) String() string {
 		return "MUT_MGR_FLUSH_DONE"
 	case MUT_MGR_ABORT_DONE:
 		return "MUT_MGR_ABORT_DONE"
+	case MUT_MGR_BUCKET_PRESSURE:
+		return "MUT_MGR_BUCKET_PRESSURE"
+	case MUT_MGR_MEMORY_PRESSURE:
+		return "MUT_MGR_MEMORY_PRESSURE"
+	case MUT_MGR_STREAM_FEEDBACK:
+		return "MUT_MGR_STREAM_FEEDBACK"
 
 	case TK_SHUTDOWN:
 		return "TK_SHUTDOWN"
@@ -1233,6 +1494,10 @@ func (m MsgType) String() string {
 		return "TK_MERGE_STREAM_ACK"
 	case TK_GET_BUCKET_HWT:
 		return "TK_GET_BUCKET_HWT"
+	case TK_BUCKET_IDLE:
+		return "TK_BUCKET_IDLE"
+	case TK_ON_DEMAND_SNAPSHOT:
+		return "TK_ON_DEMAND_SNAPSHOT"
 	case REPAIR_ABORT:
 		return "REPAIR_ABORT"
 
@@ -1326,6 +1591,12 @@ func (m MsgType) String() string {
 		return "CLUST_MGR_INDEXER_READY"
 	case CLUST_MGR_CLEANUP_INDEX:
 		return "CLUST_MGR_CLEANUP_INDEX"
+	case CLUST_MGR_PAUSE_INDEX_BUILD:
+		return "CLUST_MGR_PAUSE_INDEX_BUILD"
+	case CLUST_MGR_CANCEL_INDEX_BUILD:
+		return "CLUST_MGR_CANCEL_INDEX_BUILD"
+	case CLUST_MGR_RENAME_INDEX:
+		return "CLUST_MGR_RENAME_INDEX"
 
 	case CBQ_CREATE_INDEX_DDL:
 		return "CBQ_CREATE_INDEX_DDL"
@@ -1338,6 +1609,10 @@ func (m MsgType) String() string {
 		return "STORAGE_INDEX_STORAGE_STATS"
 	case STORAGE_INDEX_COMPACT:
 		return "STORAGE_INDEX_COMPACT"
+	case STORAGE_INDEX_SCRUB:
+		return "STORAGE_INDEX_SCRUB"
+	case STORAGE_INDEX_SCRUB_REPAIR:
+		return "STORAGE_INDEX_SCRUB_REPAIR"
 	case STORAGE_SNAP_DONE:
 		return "STORAGE_SNAP_DONE"
 
@@ -15,6 +15,7 @@ import (
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/platform"
 	"sync"
+	"time"
 )
 
 //MutationManager handles messages from Indexer to manage Mutation Streams
@@ -41,6 +42,13 @@ type mutationMgr struct {
 
 	streamFlusherStopChMap map[common.StreamId]BucketStopChMap //stop channels for flusher
 
+	bucketPressureMap map[common.StreamId]map[string]*bucketPressure //memory pressure per stream bucket
+	numThrottles      map[string]int64                               //throttles per bucket
+	memPressure       bool                                           //indexer above high_mem_mark
+
+	flushLatencyMap map[common.StreamId]map[string]time.Duration //last flush latency per stream bucket, protected by flock
+	numFeedbacks    map[string]int64                             //feedbacks sent per bucket
+
 	mutMgrRecvCh   MsgChannel //Receive msg channel for Mutation Manager
 	internalRecvCh MsgChannel //Buffered channel to queue worker messages
 	supvCmdch      MsgChannel //supervisor sends commands on this channel
@@ -86,6 +94,10 @@ func NewMutationManager(supvCmdch MsgChannel, supvRespch MsgChannel,
 		streamReaderCmdChMap:   make(map[common.StreamId]MsgChannel),
 		streamReaderExitChMap:  make(map[common.StreamId]DoneChannel),
 		streamFlusherStopChMap: make(map[common.StreamId]BucketStopChMap),
+		bucketPressureMap:      make(map[common.StreamId]map[string]*bucketPressure),
+		numThrottles:           make(map[string]int64),
+		flushLatencyMap:        make(map[common.StreamId]map[string]time.Duration),
+		numFeedbacks:           make(map[string]int64),
 		mutMgrRecvCh:           make(MsgChannel),
 		internalRecvCh:         make(MsgChannel, WORKER_MSG_QUEUE_LEN),
 		shutdownCh:             make(DoneChannel),
@@ -113,6 +125,8 @@ func (m *mutationMgr) run() {
 
 	go m.handleWorkerMsgs()
 	go m.listenWorkerMsgs()
+	go m.monitorBucketPressure()
+	go m.monitorFlowControl()
 
 	//main Mutation Manager loop
 loop:
@@ -300,6 +314,9 @@ func (m *mutationMgr) handleSupervisorCommands(cmd Message) {
 	case INDEXER_RESUME:
 		m.handleIndexerResume(cmd)
 
+	case MUT_MGR_MEMORY_PRESSURE:
+		m.handleMemoryPressure(cmd)
+
 	default:
 		logging.Fatalf("MutationMgr::handleSupervisorCommands Received Unknown Command %v", cmd)
 		common.CrashOnError(errors.New("Unknown Command On Supervisor Channel"))
@@ -316,7 +333,9 @@ func (m *mutationMgr) handleWorkerMessage(cmd Message) {
 		STREAM_READER_STREAM_END,
 		STREAM_READER_ERROR,
 		STREAM_READER_CONN_ERROR,
-		STREAM_READER_HWT:
+		STREAM_READER_HWT,
+		MUT_MGR_BUCKET_PRESSURE,
+		MUT_MGR_STREAM_FEEDBACK:
 		//send message to supervisor to take decision
 		logging.Tracef("MutationMgr::handleWorkerMessage Received %v from worker", cmd)
 		m.supvRespch <- cmd
@@ -605,6 +624,7 @@ func (m *mutationMgr) handleRemoveBucketFromStream(cmd Message) {
 		mq.Destroy()
 		delete(bucketQueueMap, bucket)
 	}
+	m.releaseBucketPressure(streamId, bucket)
 
 	if len(bucketQueueMap) == 0 {
 		m.sendMsgToStreamReader(streamId,
@@ -801,6 +821,10 @@ func (m *mutationMgr) sendMsgToStreamReader(streamId common.StreamId, msg Messag
 //cleanupStream cleans up internal structs for the given stream
 func (m *mutationMgr) cleanupStream(streamId common.StreamId) {
 
+	for bucket := range m.bucketPressureMap[streamId] {
+		m.releaseBucketPressure(streamId, bucket)
+	}
+
 	//cleanup internal maps for this stream
 	delete(m.streamReaderMap, streamId)
 	delete(m.streamBucketQueueMap, streamId)
@@ -811,6 +835,7 @@ func (m *mutationMgr) cleanupStream(streamId common.StreamId) {
 	m.flock.Lock()
 	defer m.flock.Unlock()
 	delete(m.streamFlusherStopChMap, streamId)
+	delete(m.flushLatencyMap, streamId)
 
 }
 
@@ -854,6 +879,7 @@ func (m *mutationMgr) persistMutationQueue(q IndexerMutationQueue,
 
 		flusher := NewFlusher(config, stats)
 		sts := getSeqTsFromTsVbuuid(ts)
+		start := time.Now()
 		msgch := flusher.PersistUptoTS(q.queue, streamId, ts.Bucket,
 			m.indexInstMap, m.indexPartnMap, sts, changeVec, stopch)
 		//wait for flusher to finish
@@ -866,6 +892,11 @@ func (m *mutationMgr) persistMutationQueue(q IndexerMutationQueue,
 
 			//delete the stop channel from the map
 			delete(m.streamFlusherStopChMap[streamId], bucket)
+
+			//record the flush latency for flow control feedback
+			if msg.GetMsgType() == MSG_SUCCESS {
+				m.recordFlushLatency(streamId, bucket, time.Since(start))
+			}
 		}()
 
 		stats.memoryUsedQueue.Set(platform.LoadInt64(&m.memUsed))
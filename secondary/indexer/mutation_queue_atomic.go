@@ -45,6 +45,9 @@ type MutationQueue interface {
 	//returns the numbers of vbuckets for the queue
 	GetNumVbuckets() uint16
 
+	//return memory used by mutations in this queue
+	GetMemUsed() int64
+
 	//destroy the resources
 	Destroy()
 }
@@ -69,6 +72,7 @@ type atomicMutationQueue struct {
 	size      []platform.AlignedInt64 //size of queue per vbucket
 	memUsed   *platform.AlignedInt64  //memory used by queue
 	maxMemory *platform.AlignedInt64  //max memory to be used
+	qMemUsed  platform.AlignedInt64   //memory used by this queue alone
 
 	allocPollInterval   uint64 //poll interval for new allocs, if queue is full
 	dequeuePollInterval uint64 //poll interval for dequeue, if waiting for mutations
@@ -100,6 +104,7 @@ func NewAtomicMutationQueue(bucket string, numVbuckets uint16, maxMemory *platfo
 		resultChanSize:      config["mutation_queue.resultChanSize"].Uint64(),
 		minQueueLen:         config["settings.minVbQueueLength"].Uint64(),
 		bucket:              bucket,
+		qMemUsed:            platform.NewAlignedInt64(0),
 	}
 
 	var x uint16
@@ -150,6 +155,7 @@ func (q *atomicMutationQueue) Enqueue(mutation *MutationKeys,
 	n.next = nil
 
 	platform.AddInt64(q.memUsed, n.mutation.Size())
+	platform.AddInt64(&q.qMemUsed, n.mutation.Size())
 
 	//point tail's next to new node
 	tail := (*node)(platform.LoadPointer(&q.tail[vbucket]))
@@ -210,6 +216,7 @@ func (q *atomicMutationQueue) dequeueUptoSeqno(vbucket Vbucket, seqno Seqno,
 				platform.StorePointer(&q.head[vbucket], unsafe.Pointer(head.next))
 				platform.AddInt64(&q.size[vbucket], -1)
 				platform.AddInt64(q.memUsed, -m.Size())
+				platform.AddInt64(&q.qMemUsed, -m.Size())
 				//send mutation to caller
 				dequeueSeq = m.meta.seqno
 				datach <- m
@@ -290,6 +297,7 @@ func (q *atomicMutationQueue) DequeueSingleElement(vbucket Vbucket) *MutationKey
 		platform.StorePointer(&q.head[vbucket], unsafe.Pointer(head.next))
 		platform.AddInt64(&q.size[vbucket], -1)
 		platform.AddInt64(q.memUsed, -m.Size())
+		platform.AddInt64(&q.qMemUsed, -m.Size())
 		return m
 	}
 	return nil
@@ -325,6 +333,11 @@ func (q *atomicMutationQueue) GetNumVbuckets() uint16 {
 	return q.numVbuckets
 }
 
+//GetMemUsed returns memory used by mutations in this queue
+func (q *atomicMutationQueue) GetMemUsed() int64 {
+	return platform.LoadInt64(&q.qMemUsed)
+}
+
 //allocNode tries to get node from freelist, otherwise allocates a new node and returns
 func (q *atomicMutationQueue) allocNode(vbucket Vbucket, appch StopChannel) *node {
 
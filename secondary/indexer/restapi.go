@@ -10,19 +10,22 @@ import "fmt"
 import c "github.com/couchbase/indexing/secondary/common"
 import qclient "github.com/couchbase/indexing/secondary/queryport/client"
 import mclient "github.com/couchbase/indexing/secondary/manager/client"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 import log "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/query/parser/n1ql"
 import "github.com/couchbase/query/expression"
+import "github.com/golang/protobuf/proto"
 
 type restServer struct {
-	cluster string
-	client  *qclient.GsiClient
-	config  c.Config
+	cluster   string
+	client    *qclient.GsiClient
+	config    c.Config
+	scanCoord ScanCoordinator
 }
 
 const UnboundedLiteral = "~[]{}UnboundedTruenilNA~"
 
-func NewRestServer(cluster string) (*restServer, Message) {
+func NewRestServer(cluster string, scanCoord ScanCoordinator) (*restServer, Message) {
 	log.Infof("%v starting RESTful services", cluster)
 
 	// get the singleton-client
@@ -33,7 +36,9 @@ func NewRestServer(cluster string) (*restServer, Message) {
 	qconf := config.SectionConfig("queryport.client.", true /*trim*/)
 
 	client, _ := qclient.NewGsiClient(cluster, qconf)
-	restapi := &restServer{cluster: cluster, client: client, config: qconf}
+	restapi := &restServer{
+		cluster: cluster, client: client, config: qconf, scanCoord: scanCoord,
+	}
 
 	if err != nil {
 		return restapi, &MsgError{
@@ -107,7 +112,12 @@ func (api *restServer) handleIndexes(
 //GET    /api/index/{id}?lookup=true
 //GET    /api/index/{id}?range=true
 //GET    /api/index/{id}?scanall=true
+//GET    /api/index/{id}?multiscan=true
 //GET    /api/index/{id}?count=true
+//
+// range, scanall and multiscan accept `pageSize` in the request body to
+// return results one page at a time, along with an opaque `cursor` that
+// shall be passed as `after` to fetch the next page.
 func (api *restServer) handleIndex(
 	w http.ResponseWriter, request *http.Request) {
 
@@ -556,6 +566,10 @@ func (api *restServer) doRange(w http.ResponseWriter, request *http.Request) {
 		http.Error(w, jsonstr(msg, err), http.StatusBadRequest)
 		return
 	}
+	if isNextPage(params) {
+		api.doNextPage(w, index, params)
+		return
+	}
 
 	value, ok := params["startkey"]
 	if !ok {
@@ -618,6 +632,34 @@ func (api *restServer) doRange(w http.ResponseWriter, request *http.Request) {
 	low, high := c.SecondaryKey(begin), c.SecondaryKey(end)
 	cons := stale2consistency(stale)
 
+	if isFirstPage(params) {
+		l, err := json.Marshal(low)
+		if err != nil {
+			http.Error(w, jsonstr("invalid startkey: %v", err), http.StatusBadRequest)
+			return
+		}
+		h, err := json.Marshal(high)
+		if err != nil {
+			http.Error(w, jsonstr("invalid endkey: %v", err), http.StatusBadRequest)
+			return
+		}
+		req := &protobuf.ScanRequest{
+			DefnID: proto.Uint64(uint64(index.Definition.DefnId)),
+			Span: &protobuf.Span{
+				Range: &protobuf.Range{
+					Low: l, High: h,
+					Inclusion: proto.Uint32(uint32(incl2incl(inclusion))),
+				},
+			},
+			Distinct: proto.Bool(distinct),
+			Limit:    proto.Int64(pagedLimit(params, limit)),
+			Cons:     proto.Uint32(uint32(cons)),
+			Vector:   tsconsistency2vector(ts),
+		}
+		api.doFirstPage(w, index, params, req)
+		return
+	}
+
 	var skeys []c.SecondaryKey
 	var pkeys [][]byte
 
@@ -674,6 +716,10 @@ func (api *restServer) doMultiScan(w http.ResponseWriter, request *http.Request)
 		http.Error(w, jsonstr(msg, err), http.StatusBadRequest)
 		return
 	}
+	if isNextPage(params) {
+		api.doNextPage(w, index, params)
+		return
+	}
 
 	value, ok := params["scans"]
 	if !ok {
@@ -741,6 +787,31 @@ func (api *restServer) doMultiScan(w http.ResponseWriter, request *http.Request)
 
 	cons := stale2consistency(stale)
 
+	if isFirstPage(params) {
+		protoScans, err := scans2proto(scans)
+		if err != nil {
+			http.Error(w, jsonstr("invalid scans: %v", err), http.StatusBadRequest)
+			return
+		}
+		req := &protobuf.ScanRequest{
+			DefnID:   proto.Uint64(uint64(index.Definition.DefnId)),
+			Span:     &protobuf.Span{Range: nil},
+			Distinct: proto.Bool(distinct),
+			Limit:    proto.Int64(pagedLimit(params, limit)),
+			Cons:     proto.Uint32(uint32(cons)),
+			Vector:   tsconsistency2vector(ts),
+			Scans:    protoScans,
+			Indexprojection: &protobuf.IndexProjection{
+				EntryKeys:  projection.EntryKeys,
+				PrimaryKey: proto.Bool(projection.PrimaryKey),
+			},
+			Reverse: proto.Bool(reverse),
+			Offset:  proto.Int64(offset),
+		}
+		api.doFirstPage(w, index, params, req)
+		return
+	}
+
 	var skeys []c.SecondaryKey
 	var pkeys [][]byte
 
@@ -797,6 +868,10 @@ func (api *restServer) doScanall(w http.ResponseWriter, request *http.Request) {
 		http.Error(w, jsonstr(msg, err), http.StatusBadRequest)
 		return
 	}
+	if isNextPage(params) {
+		api.doNextPage(w, index, params)
+		return
+	}
 
 	if value, ok := params["limit"]; ok && value != nil {
 		limit = int64(value.(float64))
@@ -822,6 +897,17 @@ func (api *restServer) doScanall(w http.ResponseWriter, request *http.Request) {
 
 	cons := stale2consistency(stale)
 
+	if isFirstPage(params) {
+		req := &protobuf.ScanAllRequest{
+			DefnID: proto.Uint64(uint64(index.Definition.DefnId)),
+			Limit:  proto.Int64(pagedLimit(params, limit)),
+			Cons:   proto.Uint32(uint32(cons)),
+			Vector: tsconsistency2vector(ts),
+		}
+		api.doFirstPage(w, index, params, req)
+		return
+	}
+
 	var skeys []c.SecondaryKey
 	var pkeys [][]byte
 
@@ -946,6 +1032,105 @@ func (api *restServer) doCount(w http.ResponseWriter, request *http.Request) {
 	w.Write(data)
 }
 
+// open a scan cursor on a pinned snapshot and respond with the first page.
+func (api *restServer) doFirstPage(
+	w http.ResponseWriter, index *mclient.IndexMetadata,
+	params map[string]interface{}, req interface{}) {
+
+	pageSize, err := pageSizeParam(params)
+	if err != nil {
+		http.Error(w, jsonstr("%v", err), http.StatusBadRequest)
+		return
+	}
+	if api.scanCoord == nil {
+		msg := "paged scans are not supported on this node"
+		http.Error(w, jsonstr(msg), http.StatusNotImplemented)
+		return
+	}
+
+	cursor, err := api.scanCoord.OpenScanCursor(req)
+	if err == ErrNotMyIndex || err == c.ErrIndexNotFound {
+		msg := "paged scan should be requested on the indexer hosting the index: %v"
+		http.Error(w, jsonstr(msg, err), http.StatusBadRequest)
+		return
+	} else if err == ErrScanCursorOptions {
+		http.Error(w, jsonstr("%v", err), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, jsonstr("%v", err), http.StatusInternalServerError)
+		return
+	}
+
+	api.writePage(w, index, cursor, pageSize)
+}
+
+// respond with the next page from the cursor passed as `after`.
+func (api *restServer) doNextPage(
+	w http.ResponseWriter, index *mclient.IndexMetadata,
+	params map[string]interface{}) {
+
+	cursor, ok := params["after"].(string)
+	if !ok || cursor == "" {
+		http.Error(w, jsonstr("invalid cursor in field after"), http.StatusBadRequest)
+		return
+	}
+	pageSize, err := pageSizeParam(params)
+	if err != nil {
+		http.Error(w, jsonstr("%v", err), http.StatusBadRequest)
+		return
+	}
+	if api.scanCoord == nil {
+		msg := "paged scans are not supported on this node"
+		http.Error(w, jsonstr(msg), http.StatusNotImplemented)
+		return
+	}
+
+	api.writePage(w, index, cursor, pageSize)
+}
+
+func (api *restServer) writePage(
+	w http.ResponseWriter, index *mclient.IndexMetadata,
+	cursor string, pageSize int) {
+
+	defnId := uint64(index.Definition.DefnId)
+	rows, done, err := api.scanCoord.NextScanCursorPage(cursor, defnId, pageSize)
+	if err == ErrScanCursorNotFound {
+		http.Error(w, jsonstr("%v", err), http.StatusGone)
+		return
+	} else if err == ErrScanCursorMismatch {
+		http.Error(w, jsonstr("%v", err), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, jsonstr("%v", err), http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		entry := map[string]interface{}{"key": nil, "docid": string(row.Docid)}
+		if row.Key != nil {
+			entry["key"] = json.RawMessage(row.Key)
+		}
+		entries = append(entries, entry)
+	}
+	result := map[string]interface{}{"entries": entries}
+	if !done {
+		result["cursor"] = cursor
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		api.scanCoord.CloseScanCursor(cursor)
+		msg := jsonstr(`unable to marshal result: %v`, err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprintf("%v", len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
 func (api *restServer) getIndex(path string) (*mclient.IndexMetadata, string) {
 	var index *mclient.IndexMetadata
 	defnId, err := urlPath2IndexId(path)
@@ -1024,6 +1209,89 @@ func vector2tsconsistency(
 	return qclient.NewTsConsistency(vbnos, seqnos, vbuuids), nil
 }
 
+func tsconsistency2vector(ts *qclient.TsConsistency) *protobuf.TsConsistency {
+	if ts == nil {
+		return nil
+	}
+	return protobuf.NewTsConsistency(ts.Vbnos, ts.Seqnos, ts.Vbuuids, ts.Crc64)
+}
+
+// isFirstPage returns true if a paged scan is requested.
+func isFirstPage(params map[string]interface{}) bool {
+	value, ok := params["pageSize"]
+	return ok && value != nil
+}
+
+// isNextPage returns true if the request continues a paged scan.
+func isNextPage(params map[string]interface{}) bool {
+	value, ok := params["after"]
+	return ok && value != nil
+}
+
+func pageSizeParam(params map[string]interface{}) (int, error) {
+	value, ok := params["pageSize"]
+	if !ok || value == nil {
+		return 0, fmt.Errorf("missing field pageSize")
+	}
+	pageSize, ok := value.(float64)
+	if !ok || pageSize < 1 {
+		return 0, fmt.Errorf("invalid pageSize %v", value)
+	}
+	return int(pageSize), nil
+}
+
+// for paged scans limit applies only when explicitly requested.
+func pagedLimit(params map[string]interface{}, limit int64) int64 {
+	if value, ok := params["limit"]; ok && value != nil {
+		return limit
+	}
+	return 0
+}
+
+func scans2proto(scans qclient.Scans) ([]*protobuf.Scan, error) {
+	protoScans := make([]*protobuf.Scan, 0, len(scans))
+	for _, scan := range scans {
+		if scan == nil {
+			continue
+		}
+		var equals [][]byte
+		var filters []*protobuf.CompositeElementFilter
+
+		if len(scan.Seek) > 0 {
+			for _, seek := range scan.Seek {
+				s, err := json.Marshal(seek)
+				if err != nil {
+					return nil, err
+				}
+				equals = append(equals, s)
+			}
+		} else {
+			for _, f := range scan.Filter {
+				var l, h []byte
+				var err error
+				if f.Low != c.MinUnbounded {
+					if l, err = json.Marshal(f.Low); err != nil {
+						return nil, err
+					}
+				}
+				if f.High != c.MaxUnbounded {
+					if h, err = json.Marshal(f.High); err != nil {
+						return nil, err
+					}
+				}
+				filters = append(filters, &protobuf.CompositeElementFilter{
+					Low: l, High: h, Inclusion: proto.Uint32(uint32(f.Inclusion)),
+				})
+			}
+		}
+		protoScans = append(protoScans, &protobuf.Scan{
+			Filters: filters,
+			Equals:  equals,
+		})
+	}
+	return protoScans, nil
+}
+
 func equal2Key(arg []byte) ([]interface{}, error) {
 	var key []interface{}
 	if err := json.Unmarshal(arg, &key); err != nil {
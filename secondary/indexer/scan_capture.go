@@ -0,0 +1,207 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ScanCaptureRecord is a sampled scan request, written one JSON record per
+// line into the capture file. Field names follow cbindexperf's ScanConfig
+// so that a capture file can be replayed as-is.
+type ScanCaptureRecord struct {
+	Time        int64 // request arrival, unix nano
+	Bucket      string
+	Index       string
+	Type        string // All, Range, Lookup or Scans
+	Limit       int64
+	Low         json.RawMessage   `json:",omitempty"`
+	High        json.RawMessage   `json:",omitempty"`
+	Lookups     []json.RawMessage `json:",omitempty"`
+	Inclusion   uint32
+	Scans       []ScanCaptureScan `json:",omitempty"`
+	Offset      int64             `json:",omitempty"`
+	Reverse     bool              `json:",omitempty"`
+	Distinct    bool              `json:",omitempty"`
+	Consistency bool
+}
+
+type ScanCaptureScan struct {
+	Seek   []json.RawMessage   `json:",omitempty"`
+	Filter []ScanCaptureFilter `json:",omitempty"`
+}
+
+// Low and High are nil for unbounded filters.
+type ScanCaptureFilter struct {
+	Low       json.RawMessage
+	High      json.RawMessage
+	Inclusion uint32
+}
+
+// scanCapture samples scan requests into the file configured by
+// `scan_capture.file` at `scan_capture.sample_rate`, capturing no more than
+// `scan_capture.max_records` requests per file.
+type scanCapture struct {
+	active  int32
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	records int
+	flushed time.Time
+}
+
+func (sc *scanCapture) capture(cfg common.Config, protoReq interface{}, r *ScanRequest) {
+	path := cfg["scan_capture.file"].String()
+	rate := cfg["scan_capture.sample_rate"].Float64()
+	if path == "" || rate <= 0 {
+		if atomic.LoadInt32(&sc.active) == 1 {
+			sc.close()
+		}
+		return
+	}
+	if rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	rec := newScanCaptureRecord(protoReq, r)
+	if rec == nil {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		r.Log.Errorf("scan capture failed: %v", err)
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.path != path {
+		sc.doClose()
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			logging.Errorf("ScanCoordinator: unable to open scan capture file %v: %v", path, err)
+			return
+		}
+		logging.Infof("ScanCoordinator: capturing scan requests into %v", path)
+		sc.path, sc.file, sc.w, sc.records = path, f, bufio.NewWriter(f), 0
+		atomic.StoreInt32(&sc.active, 1)
+	}
+
+	if max := cfg["scan_capture.max_records"].Int(); max > 0 && sc.records >= max {
+		return
+	}
+
+	sc.w.Write(data)
+	sc.w.WriteByte('\n')
+	sc.records++
+
+	if time.Since(sc.flushed) > time.Second {
+		sc.w.Flush()
+		sc.flushed = time.Now()
+	}
+}
+
+func (sc *scanCapture) close() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.doClose()
+}
+
+func (sc *scanCapture) doClose() {
+	if sc.file != nil {
+		sc.w.Flush()
+		sc.file.Close()
+		logging.Infof("ScanCoordinator: captured %v scan requests into %v", sc.records, sc.path)
+	}
+	sc.path, sc.file, sc.w, sc.records = "", nil, nil, 0
+	atomic.StoreInt32(&sc.active, 0)
+}
+
+func newScanCaptureRecord(protoReq interface{}, r *ScanRequest) *ScanCaptureRecord {
+	rec := &ScanCaptureRecord{
+		Time:   time.Now().UnixNano(),
+		Bucket: r.Bucket,
+		Index:  r.IndexName,
+	}
+
+	var cons common.Consistency
+	switch req := protoReq.(type) {
+	case *protobuf.ScanRequest:
+		cons = common.Consistency(req.GetCons())
+		rec.Limit = req.GetLimit()
+		rec.Offset = req.GetOffset()
+		rec.Reverse = req.GetReverse()
+		rec.Distinct = req.GetDistinct()
+
+		if scans := req.GetScans(); len(scans) > 0 {
+			rec.Type = "Scans"
+			for _, scan := range scans {
+				var cs ScanCaptureScan
+				for _, eq := range scan.GetEquals() {
+					cs.Seek = append(cs.Seek, rawJson(eq))
+				}
+				for _, f := range scan.GetFilters() {
+					cs.Filter = append(cs.Filter, ScanCaptureFilter{
+						Low:       rawJson(f.GetLow()),
+						High:      rawJson(f.GetHigh()),
+						Inclusion: f.GetInclusion(),
+					})
+				}
+				rec.Scans = append(rec.Scans, cs)
+			}
+		} else if equals := req.GetSpan().GetEquals(); len(equals) > 0 {
+			rec.Type = "Lookup"
+			for _, eq := range equals {
+				rec.Lookups = append(rec.Lookups, rawJson(eq))
+			}
+		} else {
+			rec.Type = "Range"
+			rng := req.GetSpan().GetRange()
+			rec.Low = rawJson(rng.GetLow())
+			rec.High = rawJson(rng.GetHigh())
+			rec.Inclusion = rng.GetInclusion()
+		}
+
+	case *protobuf.ScanAllRequest:
+		cons = common.Consistency(req.GetCons())
+		rec.Type = "All"
+		rec.Limit = req.GetLimit()
+
+	default:
+		return nil
+	}
+
+	rec.Consistency = cons == common.SessionConsistency
+	return rec
+}
+
+// Primary index keys are not JSON encoded, they are captured as strings.
+func rawJson(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err == nil {
+		return json.RawMessage(append([]byte(nil), b...))
+	}
+	data, _ := json.Marshal(string(b))
+	return json.RawMessage(data)
+}
@@ -36,6 +36,8 @@ var (
 	ErrSnapNotAvailable   = errors.New("No snapshot available for scan")
 	ErrUnsupportedRequest = errors.New("Unsupported query request")
 	ErrVbuuidMismatch     = errors.New("Mismatch in session vbuuids")
+	ErrStalenessRequired  = errors.New("Staleness bound is required")
+	ErrBucketPressure     = errors.New("Bucket is throttled under memory pressure")
 )
 
 var secKeyBufPool *common.BytesBufPool
@@ -65,6 +67,7 @@ type ScanRequest struct {
 	High        IndexKey
 	Keys        []IndexKey
 	Consistency *common.Consistency
+	Staleness   time.Duration
 	Stats       *IndexStats
 
 	// user supplied
@@ -74,6 +77,7 @@ type ScanRequest struct {
 	Incl      Inclusion
 	Limit     int64
 	isPrimary bool
+	numKeys   int
 
 	// New parameters for spock
 	Scans           []Scan
@@ -89,6 +93,7 @@ type ScanRequest struct {
 
 	RequestId string
 	LogPrefix string
+	Log       *logging.Context
 
 	keyBufList []*[]byte
 }
@@ -206,6 +211,10 @@ func (r ScanRequest) String() string {
 		str += fmt.Sprintf(", consistency:%s", strings.ToLower(r.Consistency.String()))
 	}
 
+	if r.Staleness > 0 {
+		str += fmt.Sprintf(", staleness:%v", r.Staleness)
+	}
+
 	if r.RequestId != "" {
 		str += fmt.Sprintf(", requestId:%v", r.RequestId)
 	}
@@ -213,6 +222,77 @@ func (r ScanRequest) String() string {
 	return str
 }
 
+// logFields are the structured log fields identifying this request.
+func (r *ScanRequest) logFields() logging.Fields {
+	fields := make(logging.Fields)
+	if r.RequestId != "" {
+		fields[logging.FieldRequestId] = r.RequestId
+	}
+	if r.Bucket != "" {
+		fields[logging.FieldBucket] = r.Bucket
+	}
+	if r.IndexName != "" {
+		fields[logging.FieldIndex] = r.IndexName
+	}
+	if r.IndexInstId != 0 {
+		fields[logging.FieldInstId] = r.IndexInstId
+	}
+	return fields
+}
+
+// updateUsageStats records the request in the scan usage stats of the
+// index, by request type and by how many of the index keys it used.
+func (r *ScanRequest) updateUsageStats() {
+	r.Stats.lastScanTime.Set(time.Now().UnixNano())
+
+	switch r.ScanType {
+	case ScanReq:
+		r.Stats.numScanRequests.Add(1)
+	case ScanAllReq:
+		r.Stats.numScanAllRequests.Add(1)
+	case CountReq:
+		r.Stats.numCountRequests.Add(1)
+	case StatsReq:
+		r.Stats.numStatsRequests.Add(1)
+	}
+
+	if r.isFullKeyScan() {
+		r.Stats.numFullKeyScans.Add(1)
+	} else {
+		r.Stats.numPrefixScans.Add(1)
+	}
+}
+
+// isFullKeyScan tells whether every span of the request constrains all
+// keys of the index, as against a leading prefix of them.
+func (r *ScanRequest) isFullKeyScan() bool {
+	if len(r.Keys) > 0 {
+		return true
+	}
+	if len(r.Scans) == 0 {
+		return false
+	}
+
+	for _, scan := range r.Scans {
+		if scan.ScanType == AllReq || len(scan.Filters) == 0 {
+			return false
+		}
+		for _, filter := range scan.Filters {
+			n := 0
+			for _, cf := range filter.CompositeFilters {
+				if cf.Low == MinIndexKey && cf.High == MaxIndexKey {
+					break
+				}
+				n++
+			}
+			if n < r.numKeys {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (r *ScanRequest) getTimeoutCh() <-chan time.Time {
 	if r.Timeout != nil {
 		return r.Timeout.C
@@ -273,6 +353,9 @@ func NewCancelCallback(req *ScanRequest, callb func(error)) *CancelCb {
 }
 
 type ScanCoordinator interface {
+	OpenScanCursor(protoReq interface{}) (string, error)
+	NextScanCursorPage(id string, defnId uint64, pageSize int) ([]ScanCursorRow, bool, error)
+	CloseScanCursor(id string)
 }
 
 type scanCoordinator struct {
@@ -294,6 +377,22 @@ type scanCoordinator struct {
 	stats IndexerStatsHolder
 
 	indexerState atomic.Value
+
+	cursorMu     sync.Mutex
+	cursors      map[string]*scanCursor
+	cursorStopCh chan bool
+
+	capture scanCapture
+
+	pressureMu sync.Mutex
+	pressure   map[string]*scanPressure
+}
+
+// scanPressure holds the streams of a bucket throttled by mutation
+// manager. Scans queued on the bucket wait for donech to be closed.
+type scanPressure struct {
+	streams map[common.StreamId]bool
+	donech  chan bool
 }
 
 func (s *scanCoordinator) getIndexerState() common.IndexerState {
@@ -320,6 +419,9 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 		snapshotNotifych: snapshotNotifych,
 		logPrefix:        "ScanCoordinator",
 		reqCounter:       platform.NewAlignedUint64(0),
+		cursors:          make(map[string]*scanCursor),
+		cursorStopCh:     make(chan bool),
+		pressure:         make(map[string]*scanPressure),
 	}
 
 	s.config.Store(config)
@@ -343,6 +445,7 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 	// main loop
 	go s.run()
 	go s.listenSnapshot()
+	go s.reapScanCursors()
 
 	return s, &MsgSuccess{}
 
@@ -405,6 +508,8 @@ loop:
 				if cmd.GetMsgType() == SCAN_COORD_SHUTDOWN {
 					logging.Infof("ScanCoordinator: Shutting Down")
 					s.serv.Close()
+					close(s.cursorStopCh)
+					s.capture.close()
 					s.supvCmdch <- &MsgSuccess{}
 					break loop
 				}
@@ -440,6 +545,9 @@ func (s *scanCoordinator) handleSupvervisorCommands(cmd Message) {
 	case INDEXER_BOOTSTRAP:
 		s.handleIndexerBootstrap(cmd)
 
+	case MUT_MGR_BUCKET_PRESSURE:
+		s.handleBucketPressure(cmd)
+
 	default:
 		logging.Errorf("ScanCoordinator: Received Unknown Command %v", cmd)
 		s.supvCmdch <- &MsgError{
@@ -457,6 +565,13 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 	r = new(ScanRequest)
 	r.ScanId = platform.AddUint64(&s.reqCounter, 1)
 	r.LogPrefix = fmt.Sprintf("SCAN##%d", r.ScanId)
+	r.Log = logging.NewContext(r.LogPrefix, logging.Fields{
+		logging.FieldComponent: "ScanCoordinator",
+		logging.FieldScanId:    r.ScanId,
+	})
+	defer func() {
+		r.Log = r.Log.WithFields(r.logFields())
+	}()
 
 	cfg := s.config.Load()
 	timeout := time.Millisecond * time.Duration(cfg["settings.scan_timeout"].Int())
@@ -847,6 +962,13 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 			}
 			r.Ts.Crc64 = 0
 			r.Ts.Bucket = r.Bucket
+		} else if cons == common.BoundedStalenessConsistency {
+			staleness := vector.GetStaleness()
+			if staleness == 0 {
+				localErr = ErrStalenessRequired
+				return
+			}
+			r.Staleness = time.Duration(staleness) * time.Millisecond
 		}
 	}
 
@@ -864,6 +986,10 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 		indexInst, localErr = s.findIndexInstance(r.DefnID)
 		if localErr == nil {
 			r.isPrimary = indexInst.Defn.IsPrimary
+			r.numKeys = len(indexInst.Defn.SecExprs)
+			if r.isPrimary {
+				r.numKeys = 1
+			}
 			r.IndexName, r.Bucket = indexInst.Defn.Name, indexInst.Defn.Bucket
 			r.IndexInstId = indexInst.InstId
 
@@ -921,6 +1047,7 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 		r.Incl = Inclusion(req.GetSpan().GetRange().GetInclusion())
 		r.Limit = req.GetLimit()
 		r.Reverse = req.GetReverse()
+		r.Distinct = req.GetDistinct()
 		r.Indexprojection = req.GetIndexprojection()
 		r.Offset = req.GetOffset()
 		if isBootstrapMode {
@@ -976,7 +1103,7 @@ func (s *scanCoordinator) getRequestedIndexSnapshot(r *ScanRequest) (snap IndexS
 
 		ss, ok := s.lastSnapshot[r.IndexInstId]
 		cons := *r.Consistency
-		if ok && ss != nil && isSnapshotConsistent(ss, cons, r.Ts) {
+		if ok && ss != nil && isSnapshotConsistent(ss, cons, r.Ts, r.Staleness) {
 			return CloneIndexSnapshot(ss), nil
 		}
 		return nil, nil
@@ -992,6 +1119,7 @@ func (s *scanCoordinator) getRequestedIndexSnapshot(r *ScanRequest) (snap IndexS
 	snapReqMsg := &MsgIndexSnapRequest{
 		ts:          r.Ts,
 		cons:        *r.Consistency,
+		staleness:   r.Staleness,
 		respch:      snapResch,
 		idxInstId:   r.IndexInstId,
 		expiredTime: r.ExpiredTime,
@@ -1017,8 +1145,8 @@ func (s *scanCoordinator) getRequestedIndexSnapshot(r *ScanRequest) (snap IndexS
 	return
 }
 
-func isSnapshotConsistent(
-	ss IndexSnapshot, cons common.Consistency, reqTs *common.TsVbuuid) bool {
+func isSnapshotConsistent(ss IndexSnapshot, cons common.Consistency,
+	reqTs *common.TsVbuuid, staleness time.Duration) bool {
 
 	if snapTs := ss.Timestamp(); snapTs != nil {
 		if cons == common.QueryConsistency && snapTs.AsRecent(reqTs) {
@@ -1034,6 +1162,8 @@ func isSnapshotConsistent(
 			// in receiving a rollback.
 			// return nil, ErrVbuuidMismatch
 			return false
+		} else if cons == common.BoundedStalenessConsistency {
+			return time.Since(ss.Created()) <= staleness
 		} else if cons == common.AnyConsistency {
 			return true
 		}
@@ -1075,12 +1205,12 @@ func (s *scanCoordinator) respondWithError(conn net.Conn, req *ScanRequest, err
 	}
 
 finish:
-	logging.Errorf("%s RESPONSE Failed with error (%s), requestId: %v", req.LogPrefix, err, req.RequestId)
+	req.Log.Errorf("RESPONSE Failed with error (%s), requestId: %v", err, req.RequestId)
 }
 
-func (s *scanCoordinator) handleError(prefix string, err error) {
+func (s *scanCoordinator) handleError(log *logging.Context, err error) {
 	if err != nil {
-		logging.Errorf("%s Error occured %s", prefix, err)
+		log.Errorf("Error occured %s", err)
 	}
 }
 
@@ -1092,13 +1222,13 @@ func (s *scanCoordinator) tryRespondWithError(w ScanResponseWriter, req *ScanReq
 			stats := s.stats.Get()
 			stats.notFoundError.Add(1)
 		} else if err == common.ErrIndexerInBootstrap {
-			logging.Verbosef("%s REQUEST %s", req.LogPrefix, req)
-			logging.Verbosef("%s RESPONSE status:(error = %s), requestId: %v", req.LogPrefix, err, req.RequestId)
+			req.Log.Verbosef("REQUEST %s", req)
+			req.Log.Verbosef("RESPONSE status:(error = %s), requestId: %v", err, req.RequestId)
 		} else {
-			logging.Infof("%s REQUEST %s", req.LogPrefix, req)
-			logging.Infof("%s RESPONSE status:(error = %s), requestId: %v", req.LogPrefix, err, req.RequestId)
+			req.Log.Infof("REQUEST %s", req)
+			req.Log.Infof("RESPONSE status:(error = %s), requestId: %v", err, req.RequestId)
 		}
-		s.handleError(req.LogPrefix, w.Error(err))
+		s.handleError(req.Log, w.Error(err))
 		return true
 	}
 
@@ -1115,7 +1245,7 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 	atime := time.Now()
 	w := NewProtoWriter(req.ScanType, conn)
 	defer func() {
-		s.handleError(req.LogPrefix, w.Done())
+		s.handleError(req.Log, w.Done())
 		req.Done()
 	}()
 
@@ -1124,11 +1254,11 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 		return
 	}
 
-	logging.Verbosef("%s REQUEST %s", req.LogPrefix, req)
+	req.Log.Verbosef("REQUEST %s", req)
 
 	if req.Consistency != nil {
-		logging.LazyVerbose(func() string {
-			return fmt.Sprintf("%s requested timestamp: %s => %s Crc64 => %v", req.LogPrefix,
+		req.Log.LazyVerbose(func() string {
+			return fmt.Sprintf("requested timestamp: %s => %s Crc64 => %v",
 				strings.ToLower(req.Consistency.String()), ScanTStoString(req.Ts), req.Ts.GetCrc64())
 		})
 	}
@@ -1139,12 +1269,20 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 
 	req.Stats.scanReqAllocDuration.Add(time.Now().Sub(atime).Nanoseconds())
 
+	s.capture.capture(s.config.Load(), protoReq, req)
+
 	if err := s.isScanAllowed(*req.Consistency); err != nil {
 		s.tryRespondWithError(w, req, err)
 		return
 	}
 
+	if err := s.waitBucketPressure(req); err != nil {
+		s.tryRespondWithError(w, req, err)
+		return
+	}
+
 	req.Stats.numRequests.Add(1)
+	req.updateUsageStats()
 
 	req.Stats.scanReqInitDuration.Add(time.Now().Sub(ttime).Nanoseconds())
 
@@ -1156,9 +1294,9 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 
 	defer DestroyIndexSnapshot(is)
 
-	logging.LazyVerbose(func() string {
-		return fmt.Sprintf("%s snapshot timestamp: %s",
-			req.LogPrefix, ScanTStoString(is.Timestamp()))
+	req.Log.LazyVerbose(func() string {
+		return fmt.Sprintf("snapshot timestamp: %s",
+			ScanTStoString(is.Timestamp()))
 	})
 
 	defer func() {
@@ -1183,7 +1321,7 @@ func (s *scanCoordinator) processRequest(req *ScanRequest, w ScanResponseWriter,
 
 func (s *scanCoordinator) handleHeloRequest(req *ScanRequest, w ScanResponseWriter) {
 	err := w.Helo()
-	s.handleError(req.LogPrefix, err)
+	s.handleError(req.Log, err)
 }
 
 func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWriter,
@@ -1204,12 +1342,16 @@ func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWrit
 	req.Stats.scanBytesRead.Add(int64(scanPipeline.BytesRead()))
 	req.Stats.scanDuration.Add(scanTime.Nanoseconds())
 	req.Stats.scanWaitDuration.Add(waitTime.Nanoseconds())
+	req.Stats.scanLatencyHisto.Add(scanTime.Nanoseconds())
+	req.Stats.scanWaitLatencyHisto.Add(waitTime.Nanoseconds())
+	req.Stats.scanRowsHisto.Add(int64(scanPipeline.RowsReturned()))
+	req.Stats.scanBytesHisto.Add(int64(scanPipeline.BytesRead()))
 
 	if err != nil {
 		status := fmt.Sprintf("(error = %s)", err)
-		logging.LazyVerbose(func() string {
-			return fmt.Sprintf("%s RESPONSE rows:%d, waitTime:%v, totalTime:%v, status:%s, requestId:%s",
-				req.LogPrefix, scanPipeline.RowsReturned(), waitTime, scanTime, status, req.RequestId)
+		req.Log.LazyVerbose(func() string {
+			return fmt.Sprintf("RESPONSE rows:%d, waitTime:%v, totalTime:%v, status:%s, requestId:%s",
+				scanPipeline.RowsReturned(), waitTime, scanTime, status, req.RequestId)
 		})
 
 		if err == common.ErrClientCancel {
@@ -1217,9 +1359,9 @@ func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWrit
 		}
 	} else {
 		status := "ok"
-		logging.LazyVerbose(func() string {
-			return fmt.Sprintf("%s RESPONSE rows:%d, waitTime:%v, totalTime:%v, status:%s",
-				req.LogPrefix, scanPipeline.RowsReturned(), waitTime, scanTime, status)
+		req.Log.LazyVerbose(func() string {
+			return fmt.Sprintf("RESPONSE rows:%d, waitTime:%v, totalTime:%v, status:%s",
+				scanPipeline.RowsReturned(), waitTime, scanTime, status)
 		})
 	}
 }
@@ -1259,9 +1401,9 @@ func (s *scanCoordinator) handleCountRequest(req *ScanRequest, w ScanResponseWri
 		return
 	}
 
-	logging.Verbosef("%s RESPONSE count:%d status:ok", req.LogPrefix, rows)
+	req.Log.Verbosef("RESPONSE count:%d status:ok", rows)
 	err = w.Count(rows)
-	s.handleError(req.LogPrefix, err)
+	s.handleError(req.Log, err)
 }
 
 func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWriter,
@@ -1297,9 +1439,9 @@ func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWri
 		return
 	}
 
-	logging.Verbosef("%s RESPONSE status:ok", req.LogPrefix)
+	req.Log.Verbosef("RESPONSE status:ok")
 	err = w.Stats(rows, 0, nil, nil)
-	s.handleError(req.LogPrefix, err)
+	s.handleError(req.Log, err)
 }
 
 // Find and return data structures for the specified index
@@ -1359,6 +1501,90 @@ func (s *scanCoordinator) handleIndexerResume(cmd Message) {
 	s.supvCmdch <- &MsgSuccess{}
 }
 
+func (s *scanCoordinator) handleBucketPressure(cmd Message) {
+	streamId := cmd.(*MsgBucketPressure).GetStreamId()
+	bucket := cmd.(*MsgBucketPressure).GetBucket()
+	throttled := cmd.(*MsgBucketPressure).IsThrottled()
+
+	s.pressureMu.Lock()
+	defer s.pressureMu.Unlock()
+
+	p, ok := s.pressure[bucket]
+	if throttled {
+		if !ok {
+			p = &scanPressure{
+				streams: make(map[common.StreamId]bool),
+				donech:  make(chan bool),
+			}
+			s.pressure[bucket] = p
+			logging.Infof("%v: Bucket %v under pressure, scan policy %v", s.logPrefix,
+				bucket, s.config.Load()["bucket_pressure.scan_policy"].String())
+		}
+		p.streams[streamId] = true
+	} else if ok {
+		delete(p.streams, streamId)
+		if len(p.streams) == 0 {
+			close(p.donech)
+			delete(s.pressure, bucket)
+			logging.Infof("%v: Bucket %v released from pressure", s.logPrefix, bucket)
+		}
+	}
+
+	s.supvCmdch <- &MsgSuccess{}
+}
+
+// waitBucketPressure sheds or queues session and query consistent scans
+// while the bucket is throttled. stale=ok scans are always allowed.
+func (s *scanCoordinator) waitBucketPressure(req *ScanRequest) error {
+	if *req.Consistency == common.AnyConsistency {
+		return nil
+	}
+
+	s.pressureMu.Lock()
+	p, ok := s.pressure[req.Bucket]
+	s.pressureMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	cfg := s.config.Load()
+	var bucketStats *BucketStats
+	if stats := s.stats.Get(); stats != nil {
+		bucketStats = stats.buckets[req.Bucket]
+	}
+
+	if cfg["bucket_pressure.scan_policy"].String() == "shed" {
+		if bucketStats != nil {
+			bucketStats.numScansShed.Add(1)
+		}
+		return ErrBucketPressure
+	}
+
+	if bucketStats != nil {
+		bucketStats.numScansQueued.Add(1)
+	}
+
+	timeout := time.Duration(cfg["bucket_pressure.scan_wait_timeout"].Int()) * time.Millisecond
+	t0 := time.Now()
+	defer func() {
+		req.Log.LazyVerbose(func() string {
+			return fmt.Sprintf("held %v for bucket pressure", time.Since(t0))
+		})
+	}()
+
+	select {
+	case <-p.donech:
+		return nil
+	case <-req.CancelCh:
+		return common.ErrClientCancel
+	case <-time.After(timeout):
+		if bucketStats != nil {
+			bucketStats.numScansShed.Add(1)
+		}
+		return ErrBucketPressure
+	}
+}
+
 func (s *scanCoordinator) handleIndexerBootstrap(cmd Message) {
 	s.setIndexerState(common.INDEXER_BOOTSTRAP)
 	s.supvCmdch <- &MsgSuccess{}
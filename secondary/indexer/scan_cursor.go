@@ -0,0 +1,418 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/couchbase/indexing/secondary/common"
+	p "github.com/couchbase/indexing/secondary/pipeline"
+	"sync"
+	"time"
+)
+
+// Paged scans
+//
+// A scan cursor serves a ScanReq/ScanAllReq one page at a time. The index
+// snapshot picked for the first page is pinned by the cursor, so that every
+// subsequent page is read from the same point-in-time view of the index.
+// The cursor keeps its position as the last key returned from the current
+// (scan, slice) pair and the number of rows returned for that key, which
+// lets the next page seek directly to where the previous page stopped.
+// Cursors that are not read for `scan_cursor_ttl` milliseconds are closed
+// and their snapshot released.
+//
+// Rows are returned in index order, with all keys of the index and the
+// docid. Reverse, distinct and projection of a subset of index keys are
+// not supported with a cursor.
+
+var (
+	ErrScanCursorNotFound = errors.New("Scan cursor not found or expired")
+	ErrScanCursorMismatch = errors.New("Scan cursor does not belong to this index")
+	ErrScanCursorLimit    = errors.New("Too many open scan cursors")
+	ErrScanCursorOptions  = errors.New("Reverse, distinct and projection are not supported with scan cursor")
+
+	errScanCursorPageFull = errors.New("Scan cursor page full")
+)
+
+// ScanCursorRow is a single index entry returned by a paged scan. Key is
+// the JSON encoded secondary key, for primary index it is same as Docid.
+type ScanCursorRow struct {
+	Key   []byte
+	Docid []byte
+}
+
+type scanCursor struct {
+	mu sync.Mutex
+
+	id     string
+	req    *ScanRequest
+	snap   IndexSnapshot
+	expiry time.Time
+
+	// position of the cursor
+	scanPos  int    // index into req.Scans
+	slicePos int    // index into slice snapshots
+	lastKey  []byte // last key consumed from current (scan, slice)
+	dups     int    // rows consumed so far with key == lastKey
+	seen     int    // rows consumed so far from current (scan, slice)
+
+	skipped  int64 // rows skipped for req.Offset
+	returned int64 // rows returned across all pages
+	done     bool
+}
+
+// isScanCursorRequest returns false if the request asks for rows in
+// a different order or form than that of the index.
+func isScanCursorRequest(req *ScanRequest) bool {
+	if req.Reverse || req.Distinct {
+		return false
+	}
+	if proj := req.Indexprojection; proj != nil && len(proj.EntryKeys) > 0 {
+		if len(proj.EntryKeys) != req.numKeys {
+			return false
+		}
+		for i, pos := range proj.EntryKeys {
+			if pos != int64(i) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newScanCursorId(defnId uint64) (string, error) {
+	uuid, err := common.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("%d:%x", defnId, uuid.Uint64())
+	return base64.URLEncoding.EncodeToString([]byte(id)), nil
+}
+
+// OpenScanCursor validates the scan request, waits for a snapshot that
+// satisfies the requested consistency and pins it under a new cursor.
+func (s *scanCoordinator) OpenScanCursor(protoReq interface{}) (string, error) {
+	req, err := s.newRequest(protoReq, nil)
+	if err == nil && req.ScanType != ScanReq && req.ScanType != ScanAllReq {
+		err = ErrUnsupportedRequest
+	} else if err == nil && !isScanCursorRequest(req) {
+		err = ErrScanCursorOptions
+	}
+	if err != nil {
+		req.Done()
+		return "", err
+	}
+
+	if err = s.isScanAllowed(*req.Consistency); err != nil {
+		req.Done()
+		return "", err
+	}
+
+	cfg := s.config.Load()
+	if max := cfg["scan_cursor_max"].Int(); max > 0 && s.numScanCursors() >= max {
+		req.Done()
+		return "", ErrScanCursorLimit
+	}
+
+	is, err := s.getRequestedIndexSnapshot(req)
+	if err != nil {
+		req.Done()
+		return "", err
+	}
+
+	// scan timeout applies only to the wait for a consistent snapshot,
+	// life time of the cursor is governed by scan_cursor_ttl.
+	if req.Timeout != nil {
+		req.Timeout.Stop()
+	}
+
+	id, err := newScanCursorId(req.DefnID)
+	if err != nil {
+		DestroyIndexSnapshot(is)
+		req.Done()
+		return "", err
+	}
+
+	req.Stats.numRequests.Add(1)
+	req.updateUsageStats()
+
+	cur := &scanCursor{
+		id:     id,
+		req:    req,
+		snap:   is,
+		expiry: time.Now().Add(s.scanCursorTTL()),
+	}
+
+	s.cursorMu.Lock()
+	s.cursors[id] = cur
+	s.cursorMu.Unlock()
+
+	req.Log.Verbosef("REQUEST %s, cursor:%v", req, id)
+	return id, nil
+}
+
+// NextScanCursorPage returns upto pageSize rows from the cursor. The
+// returned flag is true when the cursor is exhausted, in which case it is
+// closed and cannot be used anymore.
+func (s *scanCoordinator) NextScanCursorPage(
+	id string, defnId uint64, pageSize int) ([]ScanCursorRow, bool, error) {
+
+	s.cursorMu.Lock()
+	cur, ok := s.cursors[id]
+	s.cursorMu.Unlock()
+	if !ok {
+		return nil, true, ErrScanCursorNotFound
+	}
+
+	cur.mu.Lock()
+	if cur.snap == nil {
+		cur.mu.Unlock()
+		return nil, true, ErrScanCursorNotFound
+	} else if cur.req.DefnID != defnId {
+		cur.mu.Unlock()
+		return nil, false, ErrScanCursorMismatch
+	}
+
+	t0 := time.Now()
+	rows, bytesRead, err := cur.nextPage(pageSize)
+	cur.expiry = time.Now().Add(s.scanCursorTTL())
+	done := cur.done
+	req := cur.req
+	cur.mu.Unlock()
+
+	req.Stats.numRowsReturned.Add(int64(len(rows)))
+	req.Stats.scanBytesRead.Add(int64(bytesRead))
+	req.Stats.scanDuration.Add(time.Since(t0).Nanoseconds())
+
+	req.Log.LazyVerbose(func() string {
+		return fmt.Sprintf("RESPONSE cursor:%v, rows:%d, done:%v, err:%v",
+			id, len(rows), done, err)
+	})
+
+	if err != nil || done {
+		s.CloseScanCursor(id)
+		return rows, true, err
+	}
+	return rows, false, nil
+}
+
+// CloseScanCursor releases the snapshot pinned by the cursor.
+func (s *scanCoordinator) CloseScanCursor(id string) {
+	s.cursorMu.Lock()
+	cur, ok := s.cursors[id]
+	delete(s.cursors, id)
+	s.cursorMu.Unlock()
+
+	if ok {
+		cur.close()
+	}
+}
+
+func (s *scanCoordinator) numScanCursors() int {
+	s.cursorMu.Lock()
+	defer s.cursorMu.Unlock()
+	return len(s.cursors)
+}
+
+func (s *scanCoordinator) scanCursorTTL() time.Duration {
+	cfg := s.config.Load()
+	return time.Duration(cfg["scan_cursor_ttl"].Int()) * time.Millisecond
+}
+
+// reapScanCursors periodically closes cursors idle beyond their ttl.
+func (s *scanCoordinator) reapScanCursors() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.cursorStopCh:
+			s.cursorMu.Lock()
+			cursors := s.cursors
+			s.cursors = make(map[string]*scanCursor)
+			s.cursorMu.Unlock()
+			for _, cur := range cursors {
+				cur.close()
+			}
+			return
+
+		case now := <-ticker.C:
+			var expired []*scanCursor
+			s.cursorMu.Lock()
+			for id, cur := range s.cursors {
+				if now.After(cur.expiry) {
+					delete(s.cursors, id)
+					expired = append(expired, cur)
+				}
+			}
+			s.cursorMu.Unlock()
+
+			for _, cur := range expired {
+				cur.req.Log.Infof("cursor:%v expired", cur.id)
+				cur.close()
+			}
+		}
+	}
+}
+
+func (cur *scanCursor) close() {
+	cur.mu.Lock()
+	defer cur.mu.Unlock()
+
+	if cur.snap != nil {
+		DestroyIndexSnapshot(cur.snap)
+		cur.snap = nil
+		cur.req.Done()
+	}
+}
+
+// nextPage should be called with cur.mu held.
+func (cur *scanCursor) nextPage(pageSize int) ([]ScanCursorRow, uint64, error) {
+	var bytesRead uint64
+
+	rows := make([]ScanCursorRow, 0, pageSize)
+	if cur.done {
+		return rows, 0, nil
+	}
+
+	r := cur.req
+	slices := GetSliceSnapshots(cur.snap)
+
+	buf := secKeyBufPool.Get()
+	defer secKeyBufPool.Put(buf)
+	tmpBuf := p.GetBlock()
+	defer p.PutBlock(tmpBuf)
+
+	for cur.scanPos < len(r.Scans) {
+		scan := r.Scans[cur.scanPos]
+		for cur.slicePos < len(slices) {
+			skip := cur.dups
+			if scan.ScanType == LookupReq {
+				skip = cur.seen
+			}
+
+			fn := func(entry []byte) error {
+				if scan.ScanType == FilterRangeReq {
+					skipRow, err := filterScanRow(entry, scan, (*buf)[:0])
+					if err != nil {
+						return err
+					} else if skipRow {
+						return nil
+					}
+				}
+
+				var sk, docid []byte
+				count := 1
+				t := (*tmpBuf)[:0]
+				if r.isPrimary {
+					sk, docid = piSplitEntry(entry, t)
+				} else {
+					sk, docid, count = siSplitEntry(entry, t)
+				}
+
+				for i := 0; i < count; i++ {
+					if skip > 0 {
+						skip--
+						continue
+					}
+
+					if r.Limit > 0 && cur.returned >= r.Limit {
+						cur.done = true
+						return ErrLimitReached
+					} else if len(rows) >= pageSize {
+						return errScanCursorPageFull
+					}
+
+					cur.seen++
+					if cur.lastKey != nil && bytes.Equal(sk, cur.lastKey) {
+						cur.dups++
+					} else {
+						cur.lastKey = append(cur.lastKey[:0], sk...)
+						cur.dups = 1
+					}
+
+					if cur.skipped < r.Offset {
+						cur.skipped++
+						continue
+					}
+
+					row := ScanCursorRow{Docid: append([]byte(nil), docid...)}
+					if !r.isPrimary {
+						row.Key = append([]byte(nil), sk...)
+					}
+					rows = append(rows, row)
+					bytesRead += uint64(len(sk) + len(docid))
+					cur.returned++
+				}
+				return nil
+			}
+
+			err := cur.iterate(scan, slices[cur.slicePos].Snapshot(), fn)
+			switch err {
+			case nil:
+			case errScanCursorPageFull:
+				return rows, bytesRead, nil
+			case ErrLimitReached:
+				return rows, bytesRead, nil
+			default:
+				return rows, bytesRead, err
+			}
+
+			cur.slicePos++
+			cur.lastKey, cur.dups, cur.seen = nil, 0, 0
+		}
+		cur.scanPos++
+		cur.slicePos = 0
+	}
+
+	cur.done = true
+	return rows, bytesRead, nil
+}
+
+// iterate runs the scan on a slice snapshot, resuming from cursor position
+// if part of the (scan, slice) pair was already consumed by earlier pages.
+func (cur *scanCursor) iterate(scan Scan, snap Snapshot, fn EntryCallback) error {
+	if scan.ScanType == LookupReq {
+		return snap.Lookup(scan.Equals, fn)
+	}
+
+	if cur.lastKey == nil {
+		if scan.ScanType == AllReq {
+			return snap.All(fn)
+		}
+		return snap.Range(scan.Low, scan.High, scan.Incl, fn)
+	}
+
+	var low IndexKey
+	var err error
+	if cur.req.isPrimary {
+		low, err = NewPrimaryKey(cur.lastKey)
+	} else {
+		buf := secKeyBufPool.Get()
+		defer secKeyBufPool.Put(buf)
+		low, err = NewSecondaryKey(cur.lastKey, *buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	if scan.ScanType == AllReq {
+		return snap.Range(low, MaxIndexKey, Both, fn)
+	}
+
+	incl := Low
+	if scan.Incl == High || scan.Incl == Both {
+		incl = Both
+	}
+	return snap.Range(low, scan.High, incl, fn)
+}
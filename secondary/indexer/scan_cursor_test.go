@@ -0,0 +1,218 @@
+package indexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+type cursorTestDoc struct {
+	docid string
+	key   string // JSON encoded secondary key
+}
+
+// newCursorTestSnapshot returns an index snapshot of a single MOI slice
+// with docs indexed in it.
+func newCursorTestSnapshot(t *testing.T, dir string, defn common.IndexDefn,
+	docs []cursorTestDoc) IndexSnapshot {
+
+	stats := &IndexStats{}
+	stats.Init()
+	cfg := common.SystemConfig.SectionConfig("indexer.", true)
+	cfg.SetValue("numSliceWriters", 1)
+	cfg.SetValue("numVbuckets", 1)
+
+	slice, err := NewMemDBSlice(filepath.Join(dir, defn.Name), SliceId(0), defn,
+		common.IndexInstId(defn.DefnId), false, cfg, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := common.NewTsVbuuid(defn.Bucket, 1)
+	for _, doc := range docs {
+		ts.Seqnos[0]++
+		meta := NewMutationMeta()
+		meta.bucket = defn.Bucket
+		meta.seqno = Seqno(ts.Seqnos[0])
+		key := []byte(doc.key)
+		if defn.IsArrayIndex {
+			// array items are exploded from the encoded key
+			if key, err = jsonEncoder.Encode(key, make([]byte, 0, 1024)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := slice.Insert(key, []byte(doc.docid), meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := slice.NewSnapshot(ts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := slice.OpenSnapshot(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &indexSnapshot{
+		instId: common.IndexInstId(defn.DefnId),
+		ts:     ts,
+		partns: map[common.PartitionId]PartitionSnapshot{
+			0: &partitionSnapshot{
+				id:     0,
+				slices: map[SliceId]SliceSnapshot{0: &sliceSnapshot{id: 0, snap: snap}},
+			},
+		},
+	}
+}
+
+// readScanCursor reads all the pages of a cursor, as "key docid" rows.
+func readScanCursor(t *testing.T, cur *scanCursor, pageSize int) []string {
+	var rows []string
+	for i := 0; !cur.done; i++ {
+		page, _, err := cur.nextPage(pageSize)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(page) > pageSize {
+			t.Fatalf("page of %v rows for page size %v", len(page), pageSize)
+		} else if i > 1000 {
+			t.Fatalf("cursor not done after %v pages", i)
+		}
+		for _, row := range page {
+			rows = append(rows, fmt.Sprintf("%s %s", row.Key, row.Docid))
+		}
+	}
+	return rows
+}
+
+func checkScanCursorRows(t *testing.T, name string, rows, expected []string) {
+	if len(rows) != len(expected) {
+		t.Fatalf("%v: expected %v rows, got %v: %v", name, len(expected), len(rows), rows)
+	}
+	for i := range rows {
+		if rows[i] != expected[i] {
+			t.Fatalf("%v: expected row %v to be %q, got %q", name, i, expected[i], rows[i])
+		}
+	}
+}
+
+func TestScanCursorResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan_cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// duplicate secondary keys, with a page boundary in between them
+	// for most page sizes.
+	var docs []cursorTestDoc
+	for i := 0; i < 12; i++ {
+		docs = append(docs, cursorTestDoc{
+			docid: fmt.Sprintf("doc%02d", i),
+			key:   fmt.Sprintf(`["k%d"]`, i%3),
+		})
+	}
+	defn := common.IndexDefn{DefnId: 1, Name: "idx_dup", Bucket: "default",
+		SecExprs: []string{"`k`"}}
+	is := newCursorTestSnapshot(t, dir, defn, docs)
+	defer DestroyIndexSnapshot(is)
+
+	var all []string
+	for k := 0; k < 3; k++ {
+		for i := k; i < 12; i += 3 {
+			all = append(all, fmt.Sprintf(`["k%d"] doc%02d`, k, i))
+		}
+	}
+	low, _ := NewSecondaryKey([]byte(`["k0"]`), make([]byte, 0, 1024))
+	high, _ := NewSecondaryKey([]byte(`["k2"]`), make([]byte, 0, 1024))
+
+	scans := []struct {
+		name     string
+		scan     Scan
+		offset   int64
+		limit    int64
+		expected []string
+	}{
+		{"all", Scan{ScanType: AllReq}, 0, 0, all},
+		{"range both", Scan{ScanType: RangeReq, Low: low, High: high, Incl: Both}, 0, 0, all},
+		{"range neither", Scan{ScanType: RangeReq, Low: low, High: high, Incl: Neither}, 0, 0, all[4:8]},
+		{"range high", Scan{ScanType: RangeReq, Low: low, High: high, Incl: High}, 0, 0, all[4:]},
+		{"offset and limit", Scan{ScanType: AllReq}, 3, 7, all[3:10]},
+	}
+	for _, s := range scans {
+		for pageSize := 1; pageSize <= 13; pageSize++ {
+			cur := &scanCursor{
+				req: &ScanRequest{ScanType: ScanReq, Scans: []Scan{s.scan},
+					Offset: s.offset, Limit: s.limit},
+				snap: is,
+			}
+			rows := readScanCursor(t, cur, pageSize)
+			checkScanCursorRows(t, fmt.Sprintf("%v, page size %v", s.name, pageSize),
+				rows, s.expected)
+		}
+	}
+}
+
+func TestScanCursorResumeArray(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan_cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// items repeated in the array of a document are a single entry
+	// with a count, the cursor can stop in the middle of it.
+	docs := []cursorTestDoc{
+		{"doc1", `[["x","y","x"]]`},
+		{"doc2", `[["x"]]`},
+		{"doc3", `[["y","z","y"]]`},
+	}
+	defn := common.IndexDefn{DefnId: 2, Name: "idx_arr", Bucket: "default",
+		IsArrayIndex: true, SecExprs: []string{"(all (array `v` for `v` in `arr` end))"}}
+	is := newCursorTestSnapshot(t, dir, defn, docs)
+	defer DestroyIndexSnapshot(is)
+
+	expected := []string{
+		`["x"] doc1`, `["x"] doc1`, `["x"] doc2`,
+		`["y"] doc1`, `["y"] doc3`, `["y"] doc3`,
+		`["z"] doc3`,
+	}
+	for pageSize := 1; pageSize <= 8; pageSize++ {
+		cur := &scanCursor{
+			req:  &ScanRequest{ScanType: ScanAllReq, Scans: []Scan{{ScanType: AllReq}}},
+			snap: is,
+		}
+		rows := readScanCursor(t, cur, pageSize)
+		checkScanCursorRows(t, fmt.Sprintf("page size %v", pageSize), rows, expected)
+	}
+}
+
+func TestScanCursorRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ScanRequest
+		ok   bool
+	}{
+		{"plain", ScanRequest{numKeys: 2}, true},
+		{"reverse", ScanRequest{numKeys: 2, Reverse: true}, false},
+		{"distinct", ScanRequest{numKeys: 2, Distinct: true}, false},
+		{"all keys", ScanRequest{numKeys: 2,
+			Indexprojection: &protobuf.IndexProjection{EntryKeys: []int64{0, 1}}}, true},
+		{"no keys", ScanRequest{numKeys: 2,
+			Indexprojection: &protobuf.IndexProjection{}}, true},
+		{"subset of keys", ScanRequest{numKeys: 2,
+			Indexprojection: &protobuf.IndexProjection{EntryKeys: []int64{1}}}, false},
+		{"keys out of order", ScanRequest{numKeys: 2,
+			Indexprojection: &protobuf.IndexProjection{EntryKeys: []int64{1, 0}}}, false},
+	}
+	for _, test := range tests {
+		if ok := isScanCursorRequest(&test.req); ok != test.ok {
+			t.Errorf("%v: expected %v, got %v", test.name, test.ok, ok)
+		}
+	}
+}
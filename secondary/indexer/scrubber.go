@@ -0,0 +1,702 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+)
+
+//Scrubber verifies the contents of an index against the documents in KV.
+//Documents of the scrubbed vbuckets are streamed from KV up to the seqnos
+//of an index snapshot, and each document is evaluated with the index
+//definition, the same way projector does. The keys so computed are compared
+//with the entries of the main index and, if the snapshot can read it, the
+//back index, as of the same snapshot.
+//
+//Documents mutated or deleted after the snapshot are not sent by KV for a
+//stream ending at the snapshot seqnos, as KV sends only the latest version
+//of a document. Entries of documents deleted as of the snapshot are
+//reported as extra, entries of documents not sent at all are skipped.
+//
+//In repair mode, every document with a discrepancy is deleted from the index
+//and inserted again with the computed key. Corrections are applied by
+//storage manager between flushes, see handleIndexScrubRepair.
+
+var (
+	ErrScrubNoSnapshot      = errors.New("No snapshot available to scrub")
+	ErrScrubIndexNotActive  = errors.New("Index is not active")
+	ErrScrubFlushInProgress = errors.New("Flush in progress")
+)
+
+//kind of a discrepancy
+const (
+	SCRUB_MISSING  = "missing"
+	SCRUB_EXTRA    = "extra"
+	SCRUB_MISMATCH = "mismatch"
+)
+
+//index store of a discrepancy
+const (
+	SCRUB_MAIN_INDEX = "main"
+	SCRUB_BACK_INDEX = "back"
+)
+
+const scrubOpaque = uint16(0x5C5C)
+const scrubEndpoint = "scrubber"
+const scrubStreamTimeout = 60 * time.Second
+const scrubRepairBatch = 1000
+const scrubRepairRetries = 200
+const scrubRepairRetryInterval = 50 * time.Millisecond
+
+//ScrubOptions control what is scrubbed and how.
+type ScrubOptions struct {
+	Vbuckets []uint16 //vbuckets to scrub, if empty all or a sample
+	Sample   int      //scrub a random sample of vbuckets, if Vbuckets is empty
+	Rate     int      //documents per second read from KV, 0 for the configured rate
+	Repair   bool     //issue corrective inserts and deletes
+}
+
+//ScrubEntry is a discrepancy found for a document.
+type ScrubEntry struct {
+	DocId    string   `json:"docid"`
+	Vbucket  uint16   `json:"vbucket"`
+	Store    string   `json:"store"`
+	Kind     string   `json:"kind"`
+	Expected []string `json:"expected,omitempty"`
+	Found    []string `json:"found,omitempty"`
+}
+
+//ScrubReport is the outcome of a scrub.
+type ScrubReport struct {
+	InstId           common.IndexInstId `json:"instId"`
+	Bucket           string             `json:"bucket"`
+	Name             string             `json:"name"`
+	Vbuckets         []uint16           `json:"vbuckets"`
+	Seqnos           []uint64           `json:"seqnos"`
+	FailedVbuckets   []uint16           `json:"failedVbuckets,omitempty"`
+	BackIndexChecked bool               `json:"backIndexChecked"`
+	DocsScanned      int64              `json:"docsScanned"`
+	EntriesScanned   int64              `json:"entriesScanned"`
+	Missing          int64              `json:"missing"`
+	Extra            int64              `json:"extra"`
+	Mismatched       int64              `json:"mismatched"`
+	Skipped          int64              `json:"skipped"`
+	Repaired         int64              `json:"repaired"`
+	RepairSkipped    int64              `json:"repairSkipped"`
+	Entries          []*ScrubEntry      `json:"entries,omitempty"`
+	Truncated        bool               `json:"truncated"`
+	Elapsed          string             `json:"elapsed"`
+}
+
+//backIndexReader reads the back index of a slice as of a snapshot.
+type backIndexReader interface {
+	lookup(docid []byte) ([]byte, error)
+	close()
+}
+
+//backIndexSnapshot is implemented by snapshots that can read their back
+//index.
+type backIndexSnapshot interface {
+	openBackIndex() (backIndexReader, error)
+}
+
+//scrubDoc is a document read from KV.
+type scrubDoc struct {
+	vbno uint16
+	key  []byte //secondary key as projected, nil if not indexed
+}
+
+//scrubFix is a correction for a document, the document is deleted from the
+//index and, if key is not nil, inserted again.
+type scrubFix struct {
+	docid []byte
+	vbno  uint16
+	key   []byte
+}
+
+type scrubber struct {
+	inst      common.IndexInst
+	snaps     []Snapshot
+	ts        *common.TsVbuuid
+	options   ScrubOptions
+	config    common.Config
+	supvMsgch MsgChannel
+
+	bucket    *couchbase.Bucket
+	evaluator *protobuf.IndexEvaluator
+	arrayPos  int
+	distinct  bool
+	vbuckets  map[uint16]bool
+
+	expected map[string]*scrubDoc
+	deleted  map[string]bool //documents deleted as of the snapshot
+	actual   map[string][][]byte
+	fixes    map[string]*scrubFix
+
+	report     *ScrubReport
+	maxEntries int
+	logPrefix  string
+}
+
+func newScrubber(inst common.IndexInst, snaps []Snapshot, ts *common.TsVbuuid,
+	options ScrubOptions, config common.Config, supvMsgch MsgChannel) *scrubber {
+
+	if options.Rate == 0 {
+		options.Rate = config["settings.scrub.rate"].Int()
+	}
+
+	return &scrubber{
+		inst:       inst,
+		snaps:      snaps,
+		ts:         ts,
+		options:    options,
+		config:     config,
+		supvMsgch:  supvMsgch,
+		vbuckets:   make(map[uint16]bool),
+		expected:   make(map[string]*scrubDoc),
+		deleted:    make(map[string]bool),
+		actual:     make(map[string][][]byte),
+		fixes:      make(map[string]*scrubFix),
+		maxEntries: config["settings.scrub.max_report_entries"].Int(),
+		logPrefix:  fmt.Sprintf("Scrubber::%v", inst.InstId),
+		report: &ScrubReport{
+			InstId: inst.InstId,
+			Bucket: inst.Defn.Bucket,
+			Name:   inst.Defn.Name,
+		},
+	}
+}
+
+//run the scrub, snapshots are closed when done.
+func (sc *scrubber) run() (*ScrubReport, error) {
+	defer func() {
+		for _, snap := range sc.snaps {
+			snap.Close()
+		}
+	}()
+
+	start := time.Now()
+	logging.Infof("%v Scrubbing index %v:%v with options %+v", sc.logPrefix,
+		sc.inst.Defn.Bucket, sc.inst.Defn.Name, sc.options)
+
+	var err error
+	cluster := sc.config["clusterAddr"].String()
+	if sc.bucket, err = common.ConnectBucket(cluster, "default", sc.inst.Defn.Bucket); err != nil {
+		return nil, err
+	}
+	defer sc.bucket.Close()
+
+	if err = sc.initEvaluator(); err != nil {
+		return nil, err
+	}
+	sc.selectVbuckets()
+
+	if err = sc.walkKV(); err != nil {
+		return nil, err
+	}
+	if err = sc.walkIndex(); err != nil {
+		return nil, err
+	}
+	if err = sc.compare(); err != nil {
+		return nil, err
+	}
+	if sc.options.Repair {
+		if err = sc.repair(); err != nil {
+			return nil, err
+		}
+	}
+
+	sc.report.Elapsed = time.Since(start).String()
+	logging.Infof("%v Done in %v, docs %v entries %v missing %v extra %v "+
+		"mismatched %v skipped %v repaired %v", sc.logPrefix, sc.report.Elapsed,
+		sc.report.DocsScanned, sc.report.EntriesScanned, sc.report.Missing,
+		sc.report.Extra, sc.report.Mismatched, sc.report.Skipped, sc.report.Repaired)
+	return sc.report, nil
+}
+
+//initEvaluator compiles the index definition into an evaluator routing
+//all keys to a single endpoint.
+func (sc *scrubber) initEvaluator() error {
+	defn := sc.inst.Defn
+	protoInst := convertIndexInstToProtobuf(sc.config, sc.inst, convertIndexDefnToProtobuf(defn))
+	protoInst.SinglePartn = &protobuf.SinglePartition{Endpoints: []string{scrubEndpoint}}
+
+	var err error
+	sc.evaluator, err = protobuf.NewIndexEvaluator(protoInst, protobuf.FeedVersion_watson)
+	if err != nil {
+		return err
+	}
+	if defn.IsArrayIndex {
+		sc.distinct, sc.arrayPos, err = getArrayExprPosition(defn)
+	}
+	return err
+}
+
+//selectVbuckets to scrub, as requested, a random sample or all of them.
+func (sc *scrubber) selectVbuckets() {
+	numVbuckets := len(sc.ts.Seqnos)
+
+	vbnos := make([]uint16, 0, numVbuckets)
+	if len(sc.options.Vbuckets) > 0 {
+		for _, vbno := range sc.options.Vbuckets {
+			if int(vbno) < numVbuckets {
+				vbnos = append(vbnos, vbno)
+			}
+		}
+	} else if sc.options.Sample > 0 && sc.options.Sample < numVbuckets {
+		for _, i := range rand.Perm(numVbuckets)[:sc.options.Sample] {
+			vbnos = append(vbnos, uint16(i))
+		}
+	} else {
+		for i := 0; i < numVbuckets; i++ {
+			vbnos = append(vbnos, uint16(i))
+		}
+	}
+	sort.Sort(common.Vbuckets(vbnos))
+
+	for _, vbno := range vbnos {
+		sc.vbuckets[vbno] = true
+		sc.report.Vbuckets = append(sc.report.Vbuckets, vbno)
+		sc.report.Seqnos = append(sc.report.Seqnos, sc.ts.Seqnos[vbno])
+	}
+}
+
+//walkKV streams the scrubbed vbuckets from KV, up to the snapshot seqnos,
+//and evaluates the index keys of every document.
+func (sc *scrubber) walkKV() error {
+	config := map[string]interface{}{
+		"genChanSize":    10000,
+		"dataChanSize":   10000,
+		"numConnections": 1,
+	}
+	name := couchbase.NewDcpFeedName(fmt.Sprintf("scrub-%v-%v", sc.inst.InstId, time.Now().UnixNano()))
+	feed, err := sc.bucket.StartDcpFeed(name, uint32(0), scrubOpaque, config)
+	if err != nil {
+		return err
+	}
+	defer feed.Close()
+
+	pending := make(map[uint16]bool)
+	for _, vbno := range sc.report.Vbuckets {
+		end := sc.ts.Seqnos[vbno]
+		if end == 0 {
+			continue
+		}
+		err := feed.DcpRequestStream(vbno, scrubOpaque, 0, sc.ts.Vbuuids[vbno],
+			0, end, 0, 0)
+		if err != nil {
+			return err
+		}
+		pending[vbno] = true
+	}
+
+	throttle := newScrubThrottle(sc.options.Rate)
+	encodeBuf := make([]byte, 0, maxIndexEntrySize)
+	timer := time.NewTimer(scrubStreamTimeout)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case e, ok := <-feed.C:
+			if !ok {
+				return fmt.Errorf("dcp feed closed with %v vbuckets pending", len(pending))
+			}
+			timer.Reset(scrubStreamTimeout)
+
+			switch e.Opcode {
+			case mcd.DCP_STREAMREQ:
+				if e.Status != mcd.SUCCESS {
+					logging.Errorf("%v Stream request for vbucket %v failed %v",
+						sc.logPrefix, e.VBucket, e.Status)
+					sc.report.FailedVbuckets = append(sc.report.FailedVbuckets, e.VBucket)
+					delete(pending, e.VBucket)
+				}
+
+			case mcd.DCP_MUTATION:
+				throttle.wait()
+				sc.report.DocsScanned++
+				delete(sc.deleted, string(e.Key))
+				sc.evaluate(e, encodeBuf)
+
+			case mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
+				delete(sc.expected, string(e.Key))
+				sc.deleted[string(e.Key)] = true
+
+			case mcd.DCP_STREAMEND:
+				delete(pending, e.VBucket)
+			}
+
+		case <-timer.C:
+			return fmt.Errorf("timeout streaming from KV, %v vbuckets pending", len(pending))
+		}
+	}
+	return nil
+}
+
+//evaluate the index key of a document, documents that fail evaluation are
+//skipped.
+func (sc *scrubber) evaluate(e *mc.DcpEvent, encodeBuf []byte) {
+	docid := string(e.Key)
+	data := make(map[string]interface{})
+	if err := sc.evaluator.TransformRoute(sc.ts.Vbuuids[e.VBucket], e, data, encodeBuf); err != nil {
+		logging.Errorf("%v Error evaluating docid %s: %v", sc.logPrefix, e.Key, err)
+		sc.report.Skipped++
+		delete(sc.expected, docid)
+		return
+	}
+
+	doc := &scrubDoc{vbno: e.VBucket}
+	if dkv, ok := data[scrubEndpoint].(*common.DataportKeyVersions); ok {
+		kv := dkv.Kv
+		for i, cmd := range kv.Commands {
+			if cmd == common.Upsert && kv.Keys[i] != nil {
+				doc.key = append([]byte(nil), kv.Keys[i]...)
+			}
+		}
+	}
+	if sc.inst.Defn.IsPrimary {
+		doc.key = []byte(docid)
+	}
+	sc.expected[docid] = doc
+}
+
+//walkIndex collects the main index entries of documents in the scrubbed
+//vbuckets.
+func (sc *scrubber) walkIndex() error {
+	isPrimary := sc.inst.Defn.IsPrimary
+	var buf []byte
+
+	callb := func(entry []byte) error {
+		sc.report.EntriesScanned++
+
+		var docid []byte
+		var err error
+		buf = buf[:0]
+		if isPrimary {
+			e := primaryIndexEntry(entry)
+			docid, err = e.ReadDocId(buf)
+		} else {
+			docid, err = secondaryIndexEntry(entry).ReadDocId(buf)
+		}
+		if err != nil {
+			return err
+		}
+
+		vbno := uint16(sc.bucket.VBHash(string(docid)))
+		if sc.vbuckets[vbno] {
+			key := string(docid)
+			sc.actual[key] = append(sc.actual[key], append([]byte(nil), entry...))
+		}
+		return nil
+	}
+
+	for _, snap := range sc.snaps {
+		if err := snap.All(callb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//compare documents read from KV with index entries.
+func (sc *scrubber) compare() error {
+	var backs []backIndexReader
+	if !sc.inst.Defn.IsPrimary {
+		for _, snap := range sc.snaps {
+			bs, ok := snap.(backIndexSnapshot)
+			if !ok {
+				break
+			}
+			back, err := bs.openBackIndex()
+			if err != nil {
+				closeBackIndexReaders(backs)
+				return err
+			}
+			backs = append(backs, back)
+		}
+		if len(backs) != len(sc.snaps) {
+			closeBackIndexReaders(backs)
+			backs = nil
+		}
+	}
+	defer closeBackIndexReaders(backs)
+	sc.report.BackIndexChecked = len(backs) > 0
+
+	for docid, doc := range sc.expected {
+		found := sc.actual[docid]
+		delete(sc.actual, docid)
+		if err := sc.compareDoc(docid, doc, found, backs); err != nil {
+			return err
+		}
+	}
+
+	//entries of documents not read from KV. A document not sent at all was
+	//mutated or deleted after the snapshot, it cannot be checked as of the
+	//snapshot.
+	for docid, found := range sc.actual {
+		if !sc.deleted[docid] {
+			sc.report.Skipped++
+			continue
+		}
+		doc := &scrubDoc{vbno: uint16(sc.bucket.VBHash(docid))}
+		if err := sc.compareDoc(docid, doc, found, backs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sc *scrubber) compareDoc(docid string, doc *scrubDoc,
+	found [][]byte, backs []backIndexReader) error {
+
+	expected, err := scrubEntries(sc.inst.Defn, []byte(docid), doc.key,
+		sc.arrayPos, sc.distinct)
+	if err != nil {
+		logging.Errorf("%v Error encoding entries for docid %v: %v", sc.logPrefix, docid, err)
+		sc.report.Skipped++
+		return nil
+	}
+
+	consistent := true
+	if kind := diffScrubEntries(expected, found); kind != "" {
+		sc.addEntry(docid, doc.vbno, SCRUB_MAIN_INDEX, kind, expected, found)
+		consistent = false
+	}
+
+	if len(backs) > 0 {
+		var expectedBack []byte
+		if doc.key != nil {
+			if expectedBack, err = GetIndexEntryBytes(doc.key, []byte(docid),
+				false, sc.inst.Defn.IsArrayIndex, 1); err != nil {
+				sc.report.Skipped++
+				return nil
+			}
+		}
+
+		var foundBack []byte
+		for _, back := range backs {
+			if foundBack, err = back.lookup([]byte(docid)); err != nil {
+				return err
+			} else if foundBack != nil {
+				break
+			}
+		}
+
+		if kind := diffScrubEntries(toScrubEntries(expectedBack), toScrubEntries(foundBack)); kind != "" {
+			sc.addEntry(docid, doc.vbno, SCRUB_BACK_INDEX, kind,
+				toScrubEntries(expectedBack), toScrubEntries(foundBack))
+			consistent = false
+		}
+	}
+
+	if !consistent && sc.options.Repair {
+		sc.fixes[docid] = &scrubFix{docid: []byte(docid), vbno: doc.vbno, key: doc.key}
+	}
+	return nil
+}
+
+func (sc *scrubber) addEntry(docid string, vbno uint16, store, kind string,
+	expected, found [][]byte) {
+
+	switch kind {
+	case SCRUB_MISSING:
+		sc.report.Missing++
+	case SCRUB_EXTRA:
+		sc.report.Extra++
+	case SCRUB_MISMATCH:
+		sc.report.Mismatched++
+	}
+
+	if len(sc.report.Entries) >= sc.maxEntries {
+		sc.report.Truncated = true
+		return
+	}
+
+	isPrimary := sc.inst.Defn.IsPrimary
+	if store == SCRUB_BACK_INDEX {
+		isPrimary = false
+	}
+	entry := &ScrubEntry{
+		DocId:    docid,
+		Vbucket:  vbno,
+		Store:    store,
+		Kind:     kind,
+		Expected: formatScrubEntries(expected, isPrimary),
+		Found:    formatScrubEntries(found, isPrimary),
+	}
+	sc.report.Entries = append(sc.report.Entries, entry)
+	logging.Warnf("%v %v entry in %v index for docid %v vbucket %v",
+		sc.logPrefix, kind, store, docid, vbno)
+}
+
+//repair sends the corrections to indexer in batches, retrying while a
+//flush is in progress.
+func (sc *scrubber) repair() error {
+	fixes := make([]*scrubFix, 0, len(sc.fixes))
+	for _, fix := range sc.fixes {
+		fixes = append(fixes, fix)
+	}
+
+	for len(fixes) > 0 {
+		n := len(fixes)
+		if n > scrubRepairBatch {
+			n = scrubRepairBatch
+		}
+
+		var resp interface{}
+		for i := 0; ; i++ {
+			respch := make(chan interface{}, 1)
+			sc.supvMsgch <- &MsgIndexScrubRepair{
+				instId: sc.inst.InstId,
+				ts:     sc.ts,
+				fixes:  fixes[:n],
+				respch: respch,
+			}
+			resp = <-respch
+			if resp != ErrScrubFlushInProgress {
+				break
+			} else if i >= scrubRepairRetries {
+				return ErrScrubFlushInProgress
+			}
+			time.Sleep(scrubRepairRetryInterval)
+		}
+
+		switch r := resp.(type) {
+		case error:
+			return r
+		case *scrubRepairResult:
+			sc.report.Repaired += r.repaired
+			sc.report.RepairSkipped += r.skipped
+		}
+		fixes = fixes[n:]
+	}
+	return nil
+}
+
+type scrubRepairResult struct {
+	repaired int64
+	skipped  int64
+}
+
+//scrubEntries returns the main index entries expected for a document with
+//key, encoded the same way slices encode them.
+func scrubEntries(defn common.IndexDefn, docid, key []byte,
+	arrayPos int, distinct bool) ([][]byte, error) {
+
+	if key == nil {
+		return nil, nil
+	} else if defn.IsPrimary {
+		entry, err := NewPrimaryIndexEntry(docid)
+		return toScrubEntries(entry), err
+	} else if !defn.IsArrayIndex {
+		entry, err := GetIndexEntryBytes(key, docid, false, false, 1)
+		return toScrubEntries(entry), err
+	}
+
+	items, counts, err := ArrayIndexItems(key, arrayPos, nil, distinct, true)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([][]byte, 0, len(items))
+	for i, item := range items {
+		entry, err := GetIndexEntryBytes(item, docid, false, false, counts[i])
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+//diffScrubEntries returns the kind of discrepancy between expected and
+//found entries, empty if they are the same.
+func diffScrubEntries(expected, found [][]byte) string {
+	if len(expected) == 0 && len(found) == 0 {
+		return ""
+	} else if len(found) == 0 {
+		return SCRUB_MISSING
+	} else if len(expected) == 0 {
+		return SCRUB_EXTRA
+	} else if len(expected) != len(found) {
+		return SCRUB_MISMATCH
+	}
+
+	sort.Sort(common.ByteSlices(expected))
+	sort.Sort(common.ByteSlices(found))
+	for i := range expected {
+		if !bytes.Equal(expected[i], found[i]) {
+			return SCRUB_MISMATCH
+		}
+	}
+	return ""
+}
+
+func toScrubEntries(entry []byte) [][]byte {
+	if len(entry) == 0 {
+		return nil
+	}
+	return [][]byte{entry}
+}
+
+func formatScrubEntries(entries [][]byte, isPrimary bool) []string {
+	var strs []string
+	for _, entry := range entries {
+		if isPrimary {
+			e := primaryIndexEntry(entry)
+			strs = append(strs, e.String())
+		} else {
+			e := secondaryIndexEntry(entry)
+			strs = append(strs, e.String())
+		}
+	}
+	return strs
+}
+
+func closeBackIndexReaders(backs []backIndexReader) {
+	for _, back := range backs {
+		back.close()
+	}
+}
+
+//scrubThrottle limits the rate of documents read from KV.
+type scrubThrottle struct {
+	rate  int
+	start time.Time
+	count int64
+}
+
+func newScrubThrottle(rate int) *scrubThrottle {
+	return &scrubThrottle{rate: rate, start: time.Now()}
+}
+
+func (t *scrubThrottle) wait() {
+	if t.rate <= 0 {
+		return
+	}
+	t.count++
+	due := t.start.Add(time.Duration(t.count) * time.Second / time.Duration(t.rate))
+	if d := due.Sub(time.Now()); d > 0 {
+		time.Sleep(d)
+	}
+}
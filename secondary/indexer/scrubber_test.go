@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestDiffScrubEntries(t *testing.T) {
+	e1 := []byte("entry1")
+	e2 := []byte("entry2")
+	e3 := []byte("entry3")
+
+	tests := []struct {
+		expected [][]byte
+		found    [][]byte
+		kind     string
+	}{
+		{nil, nil, ""},
+		{[][]byte{e1}, nil, SCRUB_MISSING},
+		{nil, [][]byte{e1}, SCRUB_EXTRA},
+		{[][]byte{e1}, [][]byte{e2}, SCRUB_MISMATCH},
+		{[][]byte{e1, e2}, [][]byte{e1}, SCRUB_MISMATCH},
+		{[][]byte{e1, e2, e3}, [][]byte{e3, e1, e2}, ""},
+	}
+
+	for i, test := range tests {
+		if kind := diffScrubEntries(test.expected, test.found); kind != test.kind {
+			t.Errorf("Test %v: expected %q, received %q", i, test.kind, kind)
+		}
+	}
+}
+
+func TestScrubEntries(t *testing.T) {
+	docid := []byte("doc1")
+
+	defn := common.IndexDefn{IsPrimary: true}
+	entries, err := scrubEntries(defn, docid, docid, 0, false)
+	if err != nil || len(entries) != 1 || string(entries[0]) != "doc1" {
+		t.Errorf("Unexpected primary entries %v, error %v", entries, err)
+	}
+
+	defn = common.IndexDefn{}
+	entries, err = scrubEntries(defn, docid, nil, 0, false)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Unexpected entries for nil key %v, error %v", entries, err)
+	}
+
+	key := []byte(`["abc"]`)
+	entries, err = scrubEntries(defn, docid, key, 0, false)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Unexpected secondary entries %v, error %v", entries, err)
+	}
+
+	buf, _ := secondaryIndexEntry(entries[0]).ReadDocId(nil)
+	if string(buf) != "doc1" {
+		t.Errorf("Expected docid doc1, received %s", buf)
+	}
+}
@@ -11,7 +11,9 @@ package indexer
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
@@ -22,6 +24,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -62,6 +65,7 @@ func NewSettingsManager(supvCmdch MsgChannel,
 	initGlobalSettings(nil, config)
 	http.HandleFunc("/settings", s.handleSettingsReq)
 	http.HandleFunc("/triggerCompaction", s.handleCompactionTrigger)
+	http.HandleFunc("/scrub", s.handleScrubReq)
 	http.HandleFunc("/settings/runtime/freeMemory", s.handleFreeMemoryReq)
 	http.HandleFunc("/settings/runtime/forceGC", s.handleForceGCReq)
 	go func() {
@@ -190,6 +194,81 @@ func (s *settingsManager) handleCompactionTrigger(w http.ResponseWriter, r *http
 	s.writeOk(w)
 }
 
+//handleScrubReq verifies an index against KV documents.
+//The index is given as index=<instId> or index=<bucket>:<name>, with
+//optional vbuckets=<vb1,vb2,..>, sample=<n>, rate=<docs/sec> and
+//repair=true. Responds with the scrub report.
+func (s *settingsManager) handleScrubReq(w http.ResponseWriter, r *http.Request) {
+	if !s.validateAuth(w, r) {
+		return
+	}
+
+	req, err := parseScrubRequest(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	logging.Infof("Received scrub request for index %v", r.FormValue("index"))
+	s.supvMsgch <- req
+	resp := <-req.respch
+
+	if err, ok := resp.(error); ok {
+		s.writeError(w, err)
+		return
+	}
+
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJson(w, buf)
+}
+
+func parseScrubRequest(r *http.Request) (*MsgIndexScrub, error) {
+	req := &MsgIndexScrub{respch: make(chan interface{}, 1)}
+
+	index := r.FormValue("index")
+	if index == "" {
+		return nil, errors.New("Missing index")
+	} else if pos := strings.Index(index, ":"); pos > 0 {
+		req.bucket, req.name = index[:pos], index[pos+1:]
+	} else if instId, err := strconv.ParseUint(index, 10, 64); err == nil {
+		req.instId = common.IndexInstId(instId)
+	} else {
+		return nil, fmt.Errorf("Invalid index %v", index)
+	}
+
+	if vbuckets := r.FormValue("vbuckets"); vbuckets != "" {
+		for _, vb := range strings.Split(vbuckets, ",") {
+			vbno, err := strconv.ParseUint(strings.TrimSpace(vb), 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid vbucket %v", vb)
+			}
+			req.options.Vbuckets = append(req.options.Vbuckets, uint16(vbno))
+		}
+	}
+
+	var err error
+	if sample := r.FormValue("sample"); sample != "" {
+		if req.options.Sample, err = strconv.Atoi(sample); err != nil {
+			return nil, fmt.Errorf("Invalid sample %v", sample)
+		}
+	}
+	if rate := r.FormValue("rate"); rate != "" {
+		if req.options.Rate, err = strconv.Atoi(rate); err != nil {
+			return nil, fmt.Errorf("Invalid rate %v", rate)
+		}
+	}
+	if repair := r.FormValue("repair"); repair != "" {
+		if req.options.Repair, err = strconv.ParseBool(repair); err != nil {
+			return nil, fmt.Errorf("Invalid repair %v", repair)
+		}
+	}
+	return req, nil
+}
+
 func (s *settingsManager) run() {
 loop:
 	for {
@@ -291,6 +370,13 @@ func setLogger(config common.Config) {
 	level := logging.Level(logLevel)
 	logging.Infof("Setting log level to %v", level)
 	logging.SetLogLevel(level)
+
+	format := logging.Format(config["indexer.settings.log_format"].String())
+	logging.Infof("Setting log format to %v", format)
+	logging.SetLogFormat(format)
+
+	logging.SetSampling(config["indexer.settings.log_sampling.first"].Int(),
+		config["indexer.settings.log_sampling.thereafter"].Int())
 }
 
 func setBlockPoolSize(o, n common.Config) {
@@ -318,6 +404,10 @@ func initGlobalSettings(oldCfg, newCfg common.Config) {
 	logging.Infof("Setting maxcpus = %d", ncpu)
 
 	setLogger(newCfg)
+
+	window := newCfg["indexer.settings.getseqnos_window"].Int()
+	common.SetBucketSeqnosWindow(time.Duration(window) * time.Microsecond)
+
 	useMutationSyncPool = newCfg["indexer.useMutationSyncPool"].Bool()
 	maxArrayKeyLength = newCfg["indexer.settings.max_array_seckey_size"].Int()
 	maxArrayKeyBufferLength = maxArrayKeyLength * 3
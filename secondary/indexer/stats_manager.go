@@ -17,8 +17,10 @@ import (
 	"github.com/couchbase/indexing/secondary/memdb/mm"
 	"github.com/couchbase/indexing/secondary/platform"
 	"github.com/couchbase/indexing/secondary/stats"
+	"math"
 	"net/http"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -37,8 +39,20 @@ type BucketStats struct {
 	mutationQueueSize  stats.Int64Val
 	numMutationsQueued stats.Int64Val
 
-	tsQueueSize   stats.Int64Val
-	numNonAlignTS stats.Int64Val
+	tsQueueSize          stats.Int64Val
+	numNonAlignTS        stats.Int64Val
+	numOnDemandSnapshots stats.Int64Val
+
+	mutationQueueMemory stats.Int64Val
+	pressureLevel       stats.Int64Val
+	throttled           stats.BoolVal
+	ackDelay            stats.Int64Val
+	numThrottles        stats.Int64Val
+	numScansQueued      stats.Int64Val
+	numScansShed        stats.Int64Val
+
+	flushLatency stats.Int64Val
+	numFeedbacks stats.Int64Val
 }
 
 func (s *BucketStats) Init() {
@@ -46,6 +60,16 @@ func (s *BucketStats) Init() {
 	s.numMutationsQueued.Init()
 	s.tsQueueSize.Init()
 	s.numNonAlignTS.Init()
+	s.numOnDemandSnapshots.Init()
+	s.mutationQueueMemory.Init()
+	s.pressureLevel.Init()
+	s.throttled.Init()
+	s.ackDelay.Init()
+	s.numThrottles.Init()
+	s.numScansQueued.Init()
+	s.numScansShed.Init()
+	s.flushLatency.Init()
+	s.numFeedbacks.Init()
 }
 
 type IndexTimingStats struct {
@@ -103,6 +127,7 @@ type IndexStats struct {
 	diskSize              stats.Int64Val
 	buildProgress         stats.Int64Val
 	numDocsQueued         stats.Int64Val
+	collectionSeqnos      stats.Int64Val
 	deleteBytes           stats.Int64Val
 	dataSize              stats.Int64Val
 	scanBytesRead         stats.Int64Val
@@ -127,9 +152,53 @@ type IndexStats struct {
 	notReadyError         stats.Int64Val
 	clientCancelError     stats.Int64Val
 
+	// scan usage, last scan time is unix time in nanoseconds
+	lastScanTime       stats.Int64Val
+	numScanRequests    stats.Int64Val
+	numScanAllRequests stats.Int64Val
+	numCountRequests   stats.Int64Val
+	numStatsRequests   stats.Int64Val
+	numFullKeyScans    stats.Int64Val
+	numPrefixScans     stats.Int64Val
+
+	// per scan distributions, over all scans and rolling windows
+	scanLatencyHisto     stats.RollingHistogram
+	scanWaitLatencyHisto stats.RollingHistogram
+	scanRowsHisto        stats.RollingHistogram
+	scanBytesHisto       stats.RollingHistogram
+	snapshotWaitHisto    stats.RollingHistogram
+
 	Timings IndexTimingStats
 }
 
+var (
+	// latency histogram bounds in nanoseconds, the last bound is open
+	scanLatencyBuckets = []int64{
+		100000, 500000, 1000000, 5000000, 10000000, 50000000, 100000000,
+		500000000, 1000000000, 5000000000, 10000000000, math.MaxInt64,
+	}
+	scanRowsBuckets = []int64{
+		0, 1, 10, 100, 1000, 10000, 100000, 1000000, math.MaxInt64,
+	}
+	scanBytesBuckets = []int64{
+		0, 1024, 10240, 102400, 1048576, 10485760, 104857600, math.MaxInt64,
+	}
+
+	// rolling windows of 1 minute slots upto 15 minutes
+	statsWindowSlot  = time.Minute
+	statsWindowSlots = 15
+	statsWindows     = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+)
+
+func humanizeNanos(v int64) string {
+	if v == math.MinInt64 {
+		return "0"
+	} else if v == math.MaxInt64 {
+		return "inf"
+	}
+	return fmt.Sprint(time.Duration(v))
+}
+
 type IndexerStatsHolder struct {
 	ptr unsafe.Pointer
 }
@@ -158,6 +227,7 @@ func (s *IndexStats) Init() {
 	s.diskSize.Init()
 	s.buildProgress.Init()
 	s.numDocsQueued.Init()
+	s.collectionSeqnos.Init()
 	s.deleteBytes.Init()
 	s.dataSize.Init()
 	s.fragPercent.Init()
@@ -181,6 +251,19 @@ func (s *IndexStats) Init() {
 	s.diskSnapLoadDuration.Init()
 	s.notReadyError.Init()
 	s.clientCancelError.Init()
+	s.lastScanTime.Init()
+	s.numScanRequests.Init()
+	s.numScanAllRequests.Init()
+	s.numCountRequests.Init()
+	s.numStatsRequests.Init()
+	s.numFullKeyScans.Init()
+	s.numPrefixScans.Init()
+
+	s.scanLatencyHisto.Init(scanLatencyBuckets, humanizeNanos, statsWindowSlot, statsWindowSlots)
+	s.scanWaitLatencyHisto.Init(scanLatencyBuckets, humanizeNanos, statsWindowSlot, statsWindowSlots)
+	s.scanRowsHisto.Init(scanRowsBuckets, nil, statsWindowSlot, statsWindowSlots)
+	s.scanBytesHisto.Init(scanBytesBuckets, nil, statsWindowSlot, statsWindowSlots)
+	s.snapshotWaitHisto.Init(scanLatencyBuckets, humanizeNanos, statsWindowSlot, statsWindowSlots)
 
 	s.Timings.Init()
 }
@@ -252,6 +335,14 @@ func (s *IndexerStats) RemoveIndex(id common.IndexInstId) {
 	}
 }
 
+//RenameIndex renames the stats of an index in place. Slices and storage
+//manager keep the pointer to the stats of the index.
+func (s *IndexerStats) RenameIndex(id common.IndexInstId, name string) {
+	if idx, ok := s.indexes[id]; ok {
+		idx.name = name
+	}
+}
+
 func (is IndexerStats) MarshalJSON() ([]byte, error) {
 	var prefix string
 
@@ -310,6 +401,7 @@ func (is IndexerStats) MarshalJSON() ([]byte, error) {
 		addStat("disk_size", s.diskSize.Value())
 		addStat("build_progress", s.buildProgress.Value())
 		addStat("num_docs_queued", s.numDocsQueued.Value())
+		addStat("collection_seqnos_received", s.collectionSeqnos.Value())
 		addStat("delete_bytes", s.deleteBytes.Value())
 		addStat("data_size", s.dataSize.Value())
 		addStat("frag_percent", s.fragPercent.Value())
@@ -337,6 +429,18 @@ func (is IndexerStats) MarshalJSON() ([]byte, error) {
 		addStat("disk_load_duration", s.diskSnapLoadDuration.Value())
 		addStat("not_ready_errcount", s.notReadyError.Value())
 		addStat("client_cancel_errcount", s.clientCancelError.Value())
+		addStat("last_scan_time", s.lastScanTime.Value())
+		addStat("num_scan_requests", s.numScanRequests.Value())
+		addStat("num_scan_all_requests", s.numScanAllRequests.Value())
+		addStat("num_count_requests", s.numCountRequests.Value())
+		addStat("num_stats_requests", s.numStatsRequests.Value())
+		addStat("num_full_key_scans", s.numFullKeyScans.Value())
+		addStat("num_prefix_scans", s.numPrefixScans.Value())
+		addStat("scan_latency_histogram", s.scanLatencyHisto.Total())
+		addStat("scan_wait_latency_histogram", s.scanWaitLatencyHisto.Total())
+		addStat("scan_rows_histogram", s.scanRowsHisto.Total())
+		addStat("scan_bytes_histogram", s.scanBytesHisto.Total())
+		addStat("snapshot_wait_histogram", s.snapshotWaitHisto.Total())
 
 		addStat("timings/dcp_getseqs", s.Timings.dcpSeqs.Value())
 		addStat("timings/storage_clone_handle", s.Timings.stCloneHandle.Value())
@@ -361,9 +465,25 @@ func (is IndexerStats) MarshalJSON() ([]byte, error) {
 		addStat("num_mutations_queued", s.numMutationsQueued.Value())
 		addStat("ts_queue_size", s.tsQueueSize.Value())
 		addStat("num_nonalign_ts", s.numNonAlignTS.Value())
+		addStat("num_on_demand_snapshots", s.numOnDemandSnapshots.Value())
+		addStat("mutation_queue_memory", s.mutationQueueMemory.Value())
+		addStat("pressure_level", s.pressureLevel.Value())
+		addStat("throttled", s.throttled.Value())
+		addStat("ack_delay", s.ackDelay.Value())
+		addStat("num_throttles", s.numThrottles.Value())
+		addStat("num_scans_queued", s.numScansQueued.Value())
+		addStat("num_scans_shed", s.numScansShed.Value())
+		addStat("flush_latency", s.flushLatency.Value())
+		addStat("num_feedbacks", s.numFeedbacks.Value())
 		if st := common.BucketSeqsTiming(s.bucket); st != nil {
 			addStat("timings/dcp_getseqs", st.Value())
 		}
+		if st, ok := common.BucketSeqsStats(s.bucket); ok {
+			addStat("getseqs_requests", st.Requests)
+			addStat("getseqs_kv_rounds", st.Rounds)
+			addStat("getseqs_kv_rounds_saved", st.Saved())
+			addStat("getseqs_coalescing_ratio", st.CoalescingRatio())
+		}
 	}
 
 	return json.Marshal(statsMap)
@@ -400,6 +520,8 @@ type statsManager struct {
 	cacheUpdateInProgress bool
 
 	statsLogDumpInterval platform.AlignedUint64
+
+	indexInstMap common.IndexInstMap
 }
 
 func NewStatsManager(supvCmdch MsgChannel,
@@ -419,6 +541,9 @@ func NewStatsManager(supvCmdch MsgChannel,
 	http.HandleFunc("/stats/storage/mm", s.handleStorageMMStatsReq)
 	http.HandleFunc("/stats/storage", s.handleStorageStatsReq)
 	http.HandleFunc("/stats/reset", s.handleStatsResetReq)
+	http.HandleFunc("/stats/index/", s.handleIndexStatsReq)
+	http.HandleFunc("/stats/usage", s.handleIndexUsageReq)
+	http.HandleFunc("/metrics", s.handleMetricsReq)
 	go s.run()
 	go s.runStatsDumpLogger()
 	return s, &MsgSuccess{}
@@ -492,6 +617,158 @@ func (s *statsManager) handleStatsReq(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleIndexStatsReq serves /stats/index/{name}, scan distributions of
+// an index over all scans and over rolling windows. Name is either
+// <bucket>:<index>, or <index> matching the index in every bucket.
+func (s *statsManager) handleIndexStatsReq(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	var bucket string
+	name := strings.TrimPrefix(r.URL.Path, "/stats/index/")
+	if i := strings.Index(name, ":"); i >= 0 {
+		bucket, name = name[:i], name[i+1:]
+	}
+
+	is := s.stats.Get()
+	if is == nil || name == "" {
+		w.WriteHeader(404)
+		w.Write([]byte("Index not found"))
+		return
+	}
+	if common.IndexerState(is.indexerState.Value()) != common.INDEXER_BOOTSTRAP {
+		s.tryUpdateStats(false)
+	}
+
+	result := make(map[string]interface{})
+	for instId, st := range is.indexes {
+		if st.name == name && (bucket == "" || st.bucket == bucket) {
+			result[fmt.Sprintf("%s:%s", st.bucket, st.name)] = st.scanDistStats(instId)
+		}
+	}
+	if len(result) == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("Index not found"))
+		return
+	}
+
+	bytes, _ := json.Marshal(result)
+	w.WriteHeader(200)
+	w.Write(bytes)
+}
+
+// handleIndexUsageReq serves /stats/usage, scan usage and storage cost of
+// the indexes on this node along with unused and redundant ones among
+// them. Optional parameter unusedFor, a duration like 24h, reports indexes
+// not scanned for that long as unused besides those never scanned.
+func (s *statsManager) handleIndexUsageReq(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	var unusedFor time.Duration
+	if v := r.URL.Query().Get("unusedFor"); v != "" {
+		var err error
+		if unusedFor, err = time.ParseDuration(v); err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(fmt.Sprintf("Invalid unusedFor %v", v)))
+			return
+		}
+	}
+
+	var usages []*common.IndexUsage
+	if is := s.stats.Get(); is != nil {
+		if common.IndexerState(is.indexerState.Value()) != common.INDEXER_BOOTSTRAP {
+			s.tryUpdateStats(r.URL.Query().Get("async") == "false")
+		}
+
+		s.Lock()
+		indexInstMap := s.indexInstMap
+		s.Unlock()
+
+		for instId, inst := range indexInstMap {
+			if st, ok := is.indexes[instId]; ok && inst.State != common.INDEX_STATE_DELETED {
+				usages = append(usages, st.indexUsage(inst, r.Host))
+			}
+		}
+	}
+
+	bytes, _ := json.Marshal(common.NewIndexUsageReport(usages, unusedFor))
+	w.WriteHeader(200)
+	w.Write(bytes)
+}
+
+func (s *IndexStats) indexUsage(inst common.IndexInst, node string) *common.IndexUsage {
+	u := &common.IndexUsage{
+		DefnId:       inst.Defn.DefnId,
+		Bucket:       inst.Defn.Bucket,
+		Name:         inst.Defn.Name,
+		Node:         node,
+		IsPrimary:    inst.Defn.IsPrimary,
+		SecExprs:     inst.Defn.SecExprs,
+		WhereExpr:    inst.Defn.WhereExpr,
+		LastScanTime: s.lastScanTime.Value(),
+		NumRequests:  s.numRequests.Value(),
+		NumRequestsByType: map[string]int64{
+			string(StatsReq): s.numStatsRequests.Value(),
+			CountReq:         s.numCountRequests.Value(),
+			ScanReq:          s.numScanRequests.Value(),
+			ScanAllReq:       s.numScanAllRequests.Value(),
+		},
+		NumFullKeyScans: s.numFullKeyScans.Value(),
+		NumPrefixScans:  s.numPrefixScans.Value(),
+		DataSize:        s.dataSize.Value(),
+		DiskSize:        s.diskSize.Value(),
+	}
+
+	// memory optimized indexes hold all their data in memory
+	if common.GetStorageMode() == common.MOI {
+		u.MemorySize = u.DataSize
+	}
+	return u
+}
+
+func (s *IndexStats) scanDistStats(instId common.IndexInstId) map[string]interface{} {
+	m := map[string]interface{}{
+		"instance_id":       instId,
+		"num_requests":      s.numRequests.Value(),
+		"num_rows_returned": s.numRowsReturned.Value(),
+		"scan_bytes_read":   s.scanBytesRead.Value(),
+	}
+
+	addDist := func(k string, rh *stats.RollingHistogram) {
+		dist := map[string]interface{}{"all": histogramSummary(rh.Total())}
+		for _, win := range statsWindows {
+			dist[fmt.Sprintf("%dm", int(win.Minutes()))] = histogramSummary(rh.Window(win))
+		}
+		m[k] = dist
+	}
+	addDist("scan_latency", &s.scanLatencyHisto)
+	addDist("scan_wait_latency", &s.scanWaitLatencyHisto)
+	addDist("scan_rows", &s.scanRowsHisto)
+	addDist("scan_bytes", &s.scanBytesHisto)
+	addDist("snapshot_wait", &s.snapshotWaitHisto)
+	return m
+}
+
+// percentiles are upper bounds of buckets holding them, math.MaxInt64 if
+// it falls in the last bucket.
+func histogramSummary(h *stats.Histogram) map[string]interface{} {
+	return map[string]interface{}{
+		"count":     h.Count(),
+		"sum":       h.Sum(),
+		"p50":       h.Percentile(50),
+		"p90":       h.Percentile(90),
+		"p99":       h.Percentile(99),
+		"histogram": h,
+	}
+}
+
 func (s *statsManager) handleMemStatsReq(w http.ResponseWriter, r *http.Request) {
 	stats := new(runtime.MemStats)
 	if r.Method == "POST" || r.Method == "GET" {
@@ -592,6 +869,11 @@ loop:
 func (s *statsManager) handleIndexInstanceUpdate(cmd Message) {
 	req := cmd.(*MsgUpdateInstMap)
 	s.stats.Set(req.GetStatsObject())
+	if m := req.GetIndexInstMap(); m != nil {
+		s.Lock()
+		s.indexInstMap = common.CopyIndexInstMap(m)
+		s.Unlock()
+	}
 	s.supvCmdch <- &MsgSuccess{}
 }
 
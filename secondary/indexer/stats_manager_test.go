@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestIndexStatsReq(t *testing.T) {
+	var is IndexerStats
+	is.Init()
+	is.AddIndex(1, "default", "idx")
+	is.AddIndex(2, "other", "idx")
+	is.AddIndex(3, "default", "idx2")
+	is.indexes[1].numRequests.Add(2)
+	is.indexes[1].scanLatencyHisto.Add(2000000)
+	is.indexes[1].scanLatencyHisto.Add(20000000)
+
+	s := &statsManager{lastStatTime: time.Now()}
+	s.config.Store(common.SystemConfig.SectionConfig("indexer.", true))
+	s.stats.Set(&is)
+
+	get := func(method, path string) (int, map[string]map[string]interface{}) {
+		w := httptest.NewRecorder()
+		s.handleIndexStatsReq(w, httptest.NewRequest(method, path, nil))
+		var result map[string]map[string]interface{}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("%v %v: %v", method, path, err)
+			}
+		}
+		return w.Code, result
+	}
+
+	code, result := get("GET", "/stats/index/idx")
+	if code != http.StatusOK || len(result) != 2 ||
+		result["default:idx"] == nil || result["other:idx"] == nil {
+		t.Fatalf("expected idx of both buckets, got %v %v", code, result)
+	}
+
+	code, result = get("GET", "/stats/index/default:idx")
+	if code != http.StatusOK || len(result) != 1 {
+		t.Fatalf("expected idx of default bucket, got %v %v", code, result)
+	}
+	st := result["default:idx"]
+	if st["instance_id"] != float64(1) || st["num_requests"] != float64(2) {
+		t.Errorf("unexpected stats %v", st)
+	}
+	latency := st["scan_latency"].(map[string]interface{})
+	for _, k := range []string{"all", "1m", "5m", "15m"} {
+		dist, ok := latency[k].(map[string]interface{})
+		if !ok {
+			t.Fatalf("missing %v distribution in %v", k, latency)
+		}
+		if dist["count"] != float64(2) || dist["sum"] != float64(22000000) ||
+			dist["p50"] != float64(5000000) || dist["p99"] != float64(50000000) {
+			t.Errorf("unexpected %v distribution %v", k, dist)
+		}
+	}
+
+	for _, path := range []string{"/stats/index/", "/stats/index/nope", "/stats/index/other:idx2"} {
+		if code, _ := get("GET", path); code != http.StatusNotFound {
+			t.Errorf("expected %v for %v, got %v", http.StatusNotFound, path, code)
+		}
+	}
+	if code, _ := get("DELETE", "/stats/index/idx"); code != http.StatusBadRequest {
+		t.Errorf("expected %v for DELETE, got %v", http.StatusBadRequest, code)
+	}
+}
+
+func TestRenameIndexStats(t *testing.T) {
+	var is IndexerStats
+	is.Init()
+	is.AddIndex(1, "default", "idx")
+	stats := is.indexes[1]
+	stats.numRequests.Add(2)
+
+	//slices and storage manager keep the stats of the index
+	clone := is.Clone()
+	is.RenameIndex(1, "idx_renamed")
+	if is.indexes[1] != stats || clone.indexes[1] != stats {
+		t.Fatalf("expected stats of the index kept after rename")
+	}
+	if stats.name != "idx_renamed" || stats.numRequests.Value() != 2 {
+		t.Errorf("expected renamed stats with its values, got %v %v", stats.name, stats.numRequests.Value())
+	}
+
+	is.RenameIndex(2, "unknown")
+	if len(is.indexes) != 1 {
+		t.Errorf("expected no stats for unknown index")
+	}
+}
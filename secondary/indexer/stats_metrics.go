@@ -0,0 +1,181 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"fmt"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/stats"
+	"net/http"
+	"time"
+)
+
+// Prometheus exposition of indexer stats on /metrics. Per index metrics
+// are labelled by bucket, index and instance, per bucket metrics by bucket.
+
+func (s *statsManager) handleMetricsReq(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	is := s.stats.Get()
+	if is == nil {
+		w.WriteHeader(503)
+		w.Write([]byte("Stats not available"))
+		return
+	}
+
+	t0 := time.Now()
+	if common.IndexerState(is.indexerState.Value()) != common.INDEXER_BOOTSTRAP {
+		s.tryUpdateStats(false)
+	}
+
+	pw := stats.NewPromWriter("index")
+	is.writeMetrics(pw)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(200)
+	pw.Flush(w)
+	is.statsResponse.Put(time.Since(t0))
+}
+
+func (is *IndexerStats) writeMetrics(pw *stats.PromWriter) {
+	var none stats.Labels
+
+	pw.Gauge("uptime_seconds", "Indexer uptime", none, time.Since(uptime).Seconds())
+	pw.Gauge("num_connections", "Open query connections", none, float64(is.numConnections.Value()))
+	pw.Counter("not_found_errors_total", "Scans on unknown index", none, is.notFoundError.Value())
+	pw.Gauge("memory_quota_bytes", "Indexer memory quota", none, float64(is.memoryQuota.Value()))
+	pw.Gauge("memory_used_bytes", "Indexer memory used", none, float64(is.memoryUsed.Value()))
+	pw.Gauge("memory_used_storage_bytes", "Memory used by storage", none, float64(is.memoryUsedStorage.Value()))
+	pw.Gauge("memory_used_queue_bytes", "Memory used by mutation queues", none, float64(is.memoryUsedQueue.Value()))
+	pw.Gauge("needs_restart", "Indexer needs restart", none, bool2float(is.needsRestart.Value()))
+	pw.Gauge("indexer_state", fmt.Sprintf("Indexer state, %v", indexerStateHelp), none,
+		float64(is.indexerState.Value()))
+	pw.Timing("stats_response_seconds", "Stats response time", none, &is.statsResponse)
+
+	for instId, s := range is.indexes {
+		l := stats.Labels{"bucket": s.bucket, "index": s.name, "instance": fmt.Sprint(instId)}
+
+		pw.Counter("scan_duration_nanoseconds_total", "Time spent in scans", l, s.scanDuration.Value())
+		pw.Counter("scan_request_duration_nanoseconds_total", "Time spent in scan requests", l, s.scanReqDuration.Value())
+		pw.Counter("scan_wait_duration_nanoseconds_total", "Time spent waiting for consistent snapshot", l, s.scanWaitDuration.Value())
+		pw.Counter("insert_bytes_total", "Bytes inserted", l, s.insertBytes.Value())
+		pw.Counter("delete_bytes_total", "Bytes deleted", l, s.deleteBytes.Value())
+		pw.Counter("get_bytes_total", "Bytes read by storage gets", l, s.getBytes.Value())
+		pw.Counter("scan_bytes_read_total", "Bytes read by scans", l, s.scanBytesRead.Value())
+		pw.Counter("num_docs_indexed_total", "Documents indexed", l, s.numDocsIndexed.Value())
+		pw.Counter("num_docs_processed_total", "Documents processed", l, s.numDocsProcessed.Value())
+		pw.Counter("num_requests_total", "Scan requests", l, s.numRequests.Value())
+		pw.Counter("num_completed_requests_total", "Completed scan requests", l, s.numCompletedRequests.Value())
+		pw.Counter("num_rows_returned_total", "Rows returned by scans", l, s.numRowsReturned.Value())
+		pw.Counter("num_commits_total", "Storage commits", l, s.numCommits.Value())
+		pw.Counter("num_snapshots_total", "Snapshots created", l, s.numSnapshots.Value())
+		pw.Counter("num_compactions_total", "Compactions", l, s.numCompactions.Value())
+		pw.Counter("num_items_flushed_total", "Items flushed to storage", l, s.numItemsFlushed.Value())
+		pw.Counter("num_flush_queued_total", "Items queued for flush", l, s.numDocsFlushQueued.Value())
+		pw.Counter("num_items_restored_total", "Items restored from disk snapshot", l, s.numItemsRestored.Value())
+		pw.Counter("not_ready_errors_total", "Scans on index that is not ready", l, s.notReadyError.Value())
+		pw.Counter("client_cancel_errors_total", "Scans cancelled by client", l, s.clientCancelError.Value())
+		pw.Counter("num_full_key_scans_total", "Scans constraining all index keys", l, s.numFullKeyScans.Value())
+		pw.Counter("num_prefix_scans_total", "Scans constraining a prefix of index keys", l, s.numPrefixScans.Value())
+
+		pw.Gauge("num_docs_pending", "Documents pending to be indexed", l, float64(s.numDocsPending.Value()))
+		pw.Gauge("num_docs_queued", "Documents queued to be indexed", l, float64(s.numDocsQueued.Value()))
+		pw.Gauge("flush_queue_size", "Items waiting to be flushed", l,
+			float64(postiveNum(s.numDocsFlushQueued.Value()-s.numDocsIndexed.Value())))
+		pw.Gauge("disk_size_bytes", "Disk size", l, float64(s.diskSize.Value()))
+		pw.Gauge("data_size_bytes", "Data size", l, float64(s.dataSize.Value()))
+		pw.Gauge("frag_percent", "Fragmentation percent", l, float64(s.fragPercent.Value()))
+		pw.Gauge("items_count", "Items in index", l, float64(s.itemsCount.Value()))
+		pw.Gauge("last_scan_time_seconds", "Unix time of last scan", l, float64(s.lastScanTime.Value())/1e9)
+		pw.Gauge("build_progress", "Initial build progress percent", l, float64(s.buildProgress.Value()))
+		pw.Gauge("avg_ts_interval_nanoseconds", "Average interval between timestamps", l, float64(s.avgTsInterval.Value()))
+		pw.Gauge("avg_ts_items_count", "Average items per timestamp", l, float64(s.avgTsItemsCount.Value()))
+		pw.Gauge("since_last_snapshot_nanoseconds", "Time since last snapshot", l, float64(s.sinceLastSnapshot.Value()))
+		pw.Gauge("num_snapshot_waiters", "Scans waiting for snapshot", l, float64(s.numSnapshotWaiters.Value()))
+		pw.Gauge("num_last_snapshot_reply", "Scans served from last snapshot", l, float64(s.numLastSnapshotReply.Value()))
+		pw.Gauge("disk_store_duration_milliseconds", "Duration of last disk snapshot store", l, float64(s.diskSnapStoreDuration.Value()))
+		pw.Gauge("disk_load_duration_milliseconds", "Duration of last disk snapshot load", l, float64(s.diskSnapLoadDuration.Value()))
+
+		pw.Histogram("scan_latency_seconds", "Scan latency", l, s.scanLatencyHisto.Total(), 1e9)
+		pw.Histogram("scan_wait_latency_seconds", "Wait for consistent snapshot latency", l,
+			s.scanWaitLatencyHisto.Total(), 1e9)
+		pw.Histogram("scan_rows", "Rows returned per scan", l, s.scanRowsHisto.Total(), 1)
+		pw.Histogram("scan_bytes", "Bytes read per scan", l, s.scanBytesHisto.Total(), 1)
+		pw.Histogram("snapshot_wait_seconds", "Time a scan waited in storage manager for a snapshot", l,
+			s.snapshotWaitHisto.Total(), 1e9)
+
+		t := &s.Timings
+		pw.Timing("dcp_getseqs_seconds", "DCP get seqnos latency", l, &t.dcpSeqs)
+		pw.Timing("storage_clone_handle_seconds", "Storage clone handle latency", l, &t.stCloneHandle)
+		pw.Timing("storage_commit_seconds", "Storage commit latency", l, &t.stCommit)
+		pw.Timing("storage_new_iterator_seconds", "Storage new iterator latency", l, &t.stNewIterator)
+		pw.Timing("storage_snapshot_create_seconds", "Storage snapshot create latency", l, &t.stSnapshotCreate)
+		pw.Timing("storage_snapshot_close_seconds", "Storage snapshot close latency", l, &t.stSnapshotClose)
+		pw.Timing("storage_persist_snapshot_create_seconds", "Storage persistent snapshot latency", l, &t.stPersistSnapshotCreate)
+		pw.Timing("storage_get_seconds", "Storage get latency", l, &t.stKVGet)
+		pw.Timing("storage_set_seconds", "Storage set latency", l, &t.stKVSet)
+		pw.Timing("storage_iterator_next_seconds", "Storage iterator next latency", l, &t.stIteratorNext)
+		pw.Timing("scan_pipeline_iterate_seconds", "Scan pipeline iterate latency", l, &t.stScanPipelineIterate)
+		pw.Timing("storage_del_seconds", "Storage delete latency", l, &t.stKVDelete)
+		pw.Timing("storage_info_seconds", "Storage info latency", l, &t.stKVInfo)
+		pw.Timing("storage_meta_get_seconds", "Storage meta get latency", l, &t.stKVMetaGet)
+		pw.Timing("storage_meta_set_seconds", "Storage meta set latency", l, &t.stKVMetaSet)
+	}
+
+	for _, s := range is.buckets {
+		l := stats.Labels{"bucket": s.bucket}
+		pw.Gauge("bucket_mutation_queue_size", "Mutations in queue", l, float64(s.mutationQueueSize.Value()))
+		pw.Counter("bucket_num_mutations_queued_total", "Mutations queued", l, s.numMutationsQueued.Value())
+		pw.Gauge("bucket_ts_queue_size", "Timestamps in queue", l, float64(s.tsQueueSize.Value()))
+		pw.Counter("bucket_num_nonalign_ts_total", "Timestamps not snapshot aligned", l, s.numNonAlignTS.Value())
+		pw.Counter("bucket_num_on_demand_snapshots_total", "Snapshots created for waiting scans", l,
+			s.numOnDemandSnapshots.Value())
+		pw.Gauge("bucket_mutation_queue_memory_bytes", "Memory used by mutation queues", l,
+			float64(s.mutationQueueMemory.Value()))
+		pw.Gauge("bucket_pressure_level", "Mutation queue memory as percent of the bucket share", l,
+			float64(s.pressureLevel.Value()))
+		pw.Gauge("bucket_throttled", "Bucket stream throttled by delaying DCP buffer acks", l,
+			bool2float(s.throttled.Value()))
+		pw.Gauge("bucket_ack_delay_seconds", "Delay between DCP buffer acks", l,
+			float64(s.ackDelay.Value())/1000)
+		pw.Counter("bucket_num_throttles_total", "Times the bucket stream was throttled", l, s.numThrottles.Value())
+		pw.Counter("bucket_num_scans_queued_total", "Scans held on bucket under pressure", l, s.numScansQueued.Value())
+		pw.Counter("bucket_num_scans_shed_total", "Scans rejected on bucket under pressure", l, s.numScansShed.Value())
+		pw.Gauge("bucket_flush_latency_seconds", "Latency of the last mutation queue flush", l,
+			float64(s.flushLatency.Value())/1000)
+		pw.Counter("bucket_num_feedbacks_total", "Flow control feedbacks sent to projectors", l,
+			s.numFeedbacks.Value())
+		if st := common.BucketSeqsTiming(s.bucket); st != nil {
+			pw.Timing("bucket_dcp_getseqs_seconds", "DCP get seqnos latency", l, st)
+		}
+		if st, ok := common.BucketSeqsStats(s.bucket); ok {
+			pw.Counter("bucket_getseqs_requests_total", "Requests for kv seqnos", l, st.Requests)
+			pw.Counter("bucket_getseqs_kv_rounds_total", "GET_SEQNOS rounds made to kv", l, st.Rounds)
+			pw.Counter("bucket_getseqs_kv_rounds_saved_total", "GET_SEQNOS rounds saved by coalescing", l, st.Saved())
+			pw.Gauge("bucket_getseqs_coalescing_ratio", "Requests served per GET_SEQNOS round", l, st.CoalescingRatio())
+		}
+	}
+}
+
+var indexerStateHelp = fmt.Sprintf("%d=%v %d=%v %d=%v %d=%v",
+	common.INDEXER_ACTIVE, common.INDEXER_ACTIVE,
+	common.INDEXER_PAUSED, common.INDEXER_PAUSED,
+	common.INDEXER_PREPARE_UNPAUSE, common.INDEXER_PREPARE_UNPAUSE,
+	common.INDEXER_BOOTSTRAP, common.INDEXER_BOOTSTRAP)
+
+func bool2float(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package indexer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/stats"
+)
+
+func TestIndexerMetrics(t *testing.T) {
+	var is IndexerStats
+	is.Init()
+	is.AddIndex(1, "default", "idx")
+	for _, v := range []int64{500000000, 2000000000, 20000000000} {
+		is.indexes[1].scanLatencyHisto.Add(v)
+	}
+	is.buckets["default"].mutationQueueSize.Set(3)
+
+	pw := stats.NewPromWriter("index")
+	is.writeMetrics(pw)
+	var out bytes.Buffer
+	if err := pw.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	l := `{bucket="default",index="idx",instance="1"`
+	expected := []string{
+		"# HELP index_scan_latency_seconds Scan latency",
+		"# TYPE index_scan_latency_seconds histogram",
+		"index_scan_latency_seconds_bucket" + l + `,le="0.0001"} 0`,
+		"index_scan_latency_seconds_bucket" + l + `,le="0.1"} 0`,
+		"index_scan_latency_seconds_bucket" + l + `,le="0.5"} 1`,
+		"index_scan_latency_seconds_bucket" + l + `,le="1"} 1`,
+		"index_scan_latency_seconds_bucket" + l + `,le="5"} 2`,
+		"index_scan_latency_seconds_bucket" + l + `,le="10"} 2`,
+		"index_scan_latency_seconds_bucket" + l + `,le="+Inf"} 3`,
+		"index_scan_latency_seconds_sum" + l + "} 22.5",
+		"index_scan_latency_seconds_count" + l + "} 3",
+		"# TYPE index_num_requests_total counter",
+		"index_num_requests_total" + l + "} 0",
+		`index_bucket_mutation_queue_size{bucket="default"} 3`,
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(out.String(), "\n") {
+		lines[line] = true
+	}
+	for _, line := range expected {
+		if !lines[line] {
+			t.Errorf("missing %q in metrics:\n%s", line, out.String())
+		}
+	}
+}
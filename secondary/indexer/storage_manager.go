@@ -46,6 +46,11 @@ type storageMgr struct {
 	// List of waiters waiting for a snapshot to be created with expected
 	// atleast-timestamp
 	waitersMap map[common.IndexInstId][]*snapshotWaiter
+	// Stream-buckets for which an on-demand snapshot has been requested
+	// from timekeeper, and no flush has completed since
+	snapReqMap map[common.StreamId]map[string]bool
+	// Timestamp of the last flush for each stream-bucket
+	flushTsMap map[common.StreamId]map[string]*common.TsVbuuid
 
 	dbfile *forestdb.File
 	meta   *forestdb.KVStore // handle for index meta
@@ -63,20 +68,24 @@ type snapshotWaiter struct {
 	wch       chan interface{}
 	ts        *common.TsVbuuid
 	cons      common.Consistency
+	staleness time.Duration
 	idxInstId common.IndexInstId
 	expired   time.Time
+	start     time.Time
 }
 
 func newSnapshotWaiter(idxId common.IndexInstId, ts *common.TsVbuuid,
-	cons common.Consistency,
+	cons common.Consistency, staleness time.Duration,
 	ch chan interface{}, expired time.Time) *snapshotWaiter {
 
 	return &snapshotWaiter{
 		ts:        ts,
 		cons:      cons,
+		staleness: staleness,
 		wch:       ch,
 		idxInstId: idxId,
 		expired:   expired,
+		start:     time.Now(),
 	}
 }
 
@@ -104,6 +113,8 @@ func NewStorageManager(supvCmdch MsgChannel, supvRespch MsgChannel,
 		snapshotNotifych: snapshotNotifych,
 		indexSnapMap:     make(map[common.IndexInstId]IndexSnapshot),
 		waitersMap:       make(map[common.IndexInstId][]*snapshotWaiter),
+		snapReqMap:       make(map[common.StreamId]map[string]bool),
+		flushTsMap:       make(map[common.StreamId]map[string]*common.TsVbuuid),
 		config:           config,
 	}
 
@@ -178,12 +189,21 @@ func (s *storageMgr) handleSupvervisorCommands(cmd Message) {
 	case STORAGE_INDEX_SNAP_REQUEST:
 		s.handleGetIndexSnapshot(cmd)
 
+	case TK_BUCKET_IDLE:
+		s.handleBucketIdle(cmd)
+
 	case STORAGE_INDEX_STORAGE_STATS:
 		s.handleGetIndexStorageStats(cmd)
 
 	case STORAGE_INDEX_COMPACT:
 		s.handleIndexCompaction(cmd)
 
+	case STORAGE_INDEX_SCRUB:
+		s.handleIndexScrub(cmd)
+
+	case STORAGE_INDEX_SCRUB_REPAIR:
+		s.handleIndexScrubRepair(cmd)
+
 	case STORAGE_STATS:
 		s.handleStats(cmd)
 	}
@@ -208,6 +228,16 @@ func (s *storageMgr) handleCreateSnapshot(cmd Message) {
 	snapType := tsVbuuid.GetSnapType()
 	tsVbuuid.Crc64 = common.HashVbuuid(tsVbuuid.Vbuuids)
 
+	//any waiter still pending after this flush can request again
+	if reqs, ok := s.snapReqMap[streamId]; ok {
+		delete(reqs, bucket)
+	}
+
+	if _, ok := s.flushTsMap[streamId]; !ok {
+		s.flushTsMap[streamId] = make(map[string]*common.TsVbuuid)
+	}
+	s.flushTsMap[streamId][bucket] = tsVbuuid
+
 	if snapType == common.NO_SNAP {
 		logging.Infof("StorageMgr::handleCreateSnapshot Skip Snapshot For %v "+
 			"%v SnapType %v", streamId, bucket, snapType)
@@ -381,9 +411,10 @@ func (s *storageMgr) createSnapshotWorker(streamId common.StreamId, bucket strin
 				}
 
 				is := &indexSnapshot{
-					instId: idxInstId,
-					ts:     tsVbuuid.Copy(),
-					partns: partnSnaps,
+					instId:  idxInstId,
+					ts:      tsVbuuid.Copy(),
+					created: time.Now(),
+					partns:  partnSnaps,
 				}
 
 				if isSnapCreated {
@@ -435,6 +466,12 @@ func (s *storageMgr) updateSnapMapAndNotify(is IndexSnapshot, idxStats *IndexSta
 	s.muSnap.Lock()
 	defer s.muSnap.Unlock()
 
+	s.updateSnapMapAndNotifyNoLock(is, idxStats)
+}
+
+//updateSnapMapAndNotifyNoLock is updateSnapMapAndNotify with muSnap held
+func (s *storageMgr) updateSnapMapAndNotifyNoLock(is IndexSnapshot, idxStats *IndexStats) {
+
 	DestroyIndexSnapshot(s.indexSnapMap[is.IndexInstId()])
 	s.indexSnapMap[is.IndexInstId()] = is
 
@@ -455,10 +492,11 @@ func (s *storageMgr) updateSnapMapAndNotify(is IndexSnapshot, idxStats *IndexSta
 			continue
 		}
 
-		if isSnapshotConsistent(is, w.cons, w.ts) {
+		if isSnapshotConsistent(is, w.cons, w.ts, w.staleness) {
 			w.Notify(CloneIndexSnapshot(is))
 			numReplies++
 			idxStats.numSnapshotWaiters.Add(-1)
+			idxStats.snapshotWaitHisto.Add(int64(t.Sub(w.start)))
 			continue
 		}
 		newWaiters = append(newWaiters, w)
@@ -467,6 +505,47 @@ func (s *storageMgr) updateSnapMapAndNotify(is IndexSnapshot, idxStats *IndexSta
 	idxStats.numLastSnapshotReply.Set(numReplies)
 }
 
+// handleBucketIdle refreshes the snapshots of indexes in an idle
+// stream-bucket. There are no new mutations to create a snapshot with,
+// so the latest snapshot is as recent as it can be, refreshing it keeps
+// its age within bound for bounded-staleness scans.
+func (s *storageMgr) handleBucketIdle(cmd Message) {
+	s.supvCmdch <- &MsgSuccess{}
+
+	streamId := cmd.(*MsgTKBucketIdle).GetStreamId()
+	bucket := cmd.(*MsgTKBucketIdle).GetBucket()
+	ts := cmd.(*MsgTKBucketIdle).GetTimestamp()
+
+	stats := s.stats.Get()
+	for idxInstId, inst := range s.indexInstMap {
+		if inst.Defn.Bucket != bucket || inst.Stream != streamId ||
+			inst.State == common.INDEX_STATE_DELETED {
+			continue
+		}
+
+		idxStats := stats.indexes[idxInstId]
+		if idxStats == nil {
+			continue
+		}
+
+		//refresh under the same lock as the lookup, else a newer snapshot
+		//created in between gets replaced by the refreshed older one
+		func() {
+			s.muSnap.Lock()
+			defer s.muSnap.Unlock()
+
+			is := s.indexSnapMap[idxInstId]
+			if is == nil || is.Timestamp() == nil {
+				return
+			}
+			if (ts == nil && !is.IsEpoch()) || (ts != nil && !is.Timestamp().Equal(ts)) {
+				return
+			}
+			s.updateSnapMapAndNotifyNoLock(RefreshIndexSnapshot(is), idxStats)
+		}()
+	}
+}
+
 //handleRollback will rollback to given timestamp
 func (sm *storageMgr) handleRollback(cmd Message) {
 
@@ -475,6 +554,10 @@ func (sm *storageMgr) handleRollback(cmd Message) {
 	bucket := cmd.(*MsgRollback).GetBucket()
 	logging.Infof("StorageMgr::handleRollback rollbackTs is %v", rollbackTs)
 
+	if flushTs, ok := sm.flushTsMap[streamId]; ok {
+		delete(flushTs, bucket)
+	}
+
 	var respTs *common.TsVbuuid
 
 	//for every index managed by this indexer
@@ -576,9 +659,10 @@ func (s *storageMgr) addNilSnapshot(idxInstId common.IndexInstId, bucket string)
 	if _, ok := s.indexSnapMap[idxInstId]; !ok {
 		ts := common.NewTsVbuuid(bucket, s.config["numVbuckets"].Int())
 		snap := &indexSnapshot{
-			instId: idxInstId,
-			ts:     ts, // nil snapshot should have ZERO Crc64 :)
-			epoch:  true,
+			instId:  idxInstId,
+			ts:      ts, // nil snapshot should have ZERO Crc64 :)
+			epoch:   true,
+			created: time.Now(),
 		}
 		s.indexSnapMap[idxInstId] = snap
 		s.notifySnapshotCreation(snap)
@@ -715,7 +799,7 @@ func (s *storageMgr) handleGetIndexSnapshot(cmd Message) {
 	// can notify the requester when a snapshot with matching timestamp
 	// is available.
 	is := s.indexSnapMap[req.GetIndexId()]
-	if is != nil && isSnapshotConsistent(is, req.GetConsistency(), req.GetTS()) {
+	if is != nil && isSnapshotConsistent(is, req.GetConsistency(), req.GetTS(), req.GetStaleness()) {
 		req.respch <- CloneIndexSnapshot(is)
 		return
 	}
@@ -725,7 +809,7 @@ func (s *storageMgr) handleGetIndexSnapshot(cmd Message) {
 	}
 
 	w := newSnapshotWaiter(
-		req.GetIndexId(), req.GetTS(), req.GetConsistency(),
+		req.GetIndexId(), req.GetTS(), req.GetConsistency(), req.GetStaleness(),
 		req.GetReplyChannel(), req.GetExpiredTime())
 
 	if ws, ok := s.waitersMap[req.GetIndexId()]; ok {
@@ -733,6 +817,41 @@ func (s *storageMgr) handleGetIndexSnapshot(cmd Message) {
 	} else {
 		s.waitersMap[req.idxInstId] = []*snapshotWaiter{w}
 	}
+
+	s.requestOnDemandSnapshot(inst, req.GetConsistency(), req.GetTS())
+}
+
+// requestOnDemandSnapshot asks timekeeper to snapshot the stream-bucket
+// as soon as the flushed mutations satisfy ts, instead of waiting for the
+// next snapshot interval. Only one request per stream-bucket is sent
+// until the next flush completes.
+func (s *storageMgr) requestOnDemandSnapshot(inst common.IndexInst,
+	cons common.Consistency, ts *common.TsVbuuid) {
+
+	if ts == nil ||
+		(cons != common.QueryConsistency && cons != common.SessionConsistency) {
+		return
+	}
+
+	bucket := inst.Defn.Bucket
+	reqs, ok := s.snapReqMap[inst.Stream]
+	if !ok {
+		reqs = make(map[string]bool)
+		s.snapReqMap[inst.Stream] = reqs
+	}
+	if reqs[bucket] {
+		return
+	}
+	reqs[bucket] = true
+
+	msg := &MsgTKOnDemandSnapshot{
+		streamId: inst.Stream,
+		bucket:   bucket,
+		ts:       ts.Copy(),
+	}
+	go func() {
+		s.supvRespch <- msg
+	}()
 }
 
 func (s *storageMgr) handleGetIndexStorageStats(cmd Message) {
@@ -880,6 +999,237 @@ func (s *storageMgr) handleIndexCompaction(cmd Message) {
 	}()
 }
 
+//handleIndexScrub verifies an index against KV. The scrub runs on
+//snapshots of the index, without blocking storage manager main loop.
+func (s *storageMgr) handleIndexScrub(cmd Message) {
+	s.supvCmdch <- &MsgSuccess{}
+	req := cmd.(*MsgIndexScrub)
+	respch := req.GetResponseChannel()
+
+	var inst common.IndexInst
+	var found bool
+	if req.GetInstId() != 0 {
+		inst, found = s.indexInstMap[req.GetInstId()]
+	} else {
+		for _, idxInst := range s.indexInstMap {
+			if idxInst.Defn.Bucket == req.GetBucket() &&
+				idxInst.Defn.Name == req.GetName() &&
+				idxInst.State != common.INDEX_STATE_DELETED {
+				inst, found = idxInst, true
+				break
+			}
+		}
+	}
+
+	if !found || inst.State == common.INDEX_STATE_DELETED {
+		respch <- common.ErrIndexNotFound
+		return
+	} else if inst.State != common.INDEX_STATE_ACTIVE {
+		respch <- ErrScrubIndexNotActive
+		return
+	}
+
+	snaps, ts, err := s.openScrubSnapshots(inst.InstId)
+	if err != nil {
+		respch <- err
+		return
+	}
+
+	sc := newScrubber(inst, snaps, ts, req.GetOptions(), s.config.Clone(), s.supvRespch)
+	go func() {
+		report, err := sc.run()
+		if err != nil {
+			logging.Errorf("StorageMgr::handleIndexScrub Index %v Error %v", inst.InstId, err)
+			respch <- err
+			return
+		}
+		respch <- report
+	}()
+}
+
+//openScrubSnapshots returns a snapshot of every slice of the index and the
+//timestamp of the snapshots. With forestdb, the latest committed snapshot
+//is used, as its back index can be read as of the same snapshot.
+func (s *storageMgr) openScrubSnapshots(instId common.IndexInstId) (
+	[]Snapshot, *common.TsVbuuid, error) {
+
+	var snaps []Snapshot
+	closeSnaps := func() {
+		for _, snap := range snaps {
+			snap.Close()
+		}
+	}
+
+	if common.GetStorageMode() == common.FORESTDB {
+		var ts *common.TsVbuuid
+		for _, partnInst := range s.indexPartnMap[instId] {
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+				infos, err := slice.GetSnapshots()
+				if err != nil {
+					closeSnaps()
+					return nil, nil, err
+				}
+				info := NewSnapshotInfoContainer(infos).GetLatest()
+				if info == nil || info.Timestamp() == nil {
+					closeSnaps()
+					return nil, nil, ErrScrubNoSnapshot
+				}
+				snap, err := slice.OpenSnapshot(info)
+				if err != nil {
+					closeSnaps()
+					return nil, nil, err
+				}
+				snaps = append(snaps, snap)
+				ts = info.Timestamp()
+			}
+		}
+		if len(snaps) == 0 {
+			return nil, nil, ErrScrubNoSnapshot
+		}
+		return snaps, ts, nil
+	}
+
+	s.muSnap.Lock()
+	defer s.muSnap.Unlock()
+
+	is := s.indexSnapMap[instId]
+	if is == nil || is.Timestamp() == nil {
+		return nil, nil, ErrScrubNoSnapshot
+	}
+	for _, ps := range CloneIndexSnapshot(is).Partitions() {
+		for _, ss := range ps.Slices() {
+			snaps = append(snaps, ss.Snapshot())
+		}
+	}
+	return snaps, is.Timestamp(), nil
+}
+
+//handleIndexScrubRepair applies scrubber corrections to the slices of
+//an index. Indexer makes sure there is no flush in progress for the index,
+//so that corrections are not interleaved with a snapshot. Corrections for
+//vbuckets that have received mutations since the scrub are skipped, as the
+//document may have changed.
+func (s *storageMgr) handleIndexScrubRepair(cmd Message) {
+	req := cmd.(*MsgIndexScrubRepair)
+	respch := req.GetResponseChannel()
+
+	inst, ok := s.indexInstMap[req.GetInstId()]
+	if !ok || inst.State == common.INDEX_STATE_DELETED {
+		s.supvCmdch <- &MsgSuccess{}
+		respch <- common.ErrIndexNotFound
+		return
+	}
+
+	currTs := s.flushTsMap[inst.Stream][inst.Defn.Bucket]
+	if currTs == nil {
+		s.muSnap.Lock()
+		if is := s.indexSnapMap[inst.InstId]; is != nil {
+			currTs = is.Timestamp()
+		}
+		s.muSnap.Unlock()
+	}
+
+	scrubTs := req.GetTimestamp()
+	result := &scrubRepairResult{}
+	for _, fix := range req.fixes {
+		vbno := fix.vbno
+		if currTs == nil || int(vbno) >= len(currTs.Seqnos) ||
+			currTs.Seqnos[vbno] != scrubTs.Seqnos[vbno] ||
+			currTs.Vbuuids[vbno] != scrubTs.Vbuuids[vbno] {
+			result.skipped++
+			continue
+		}
+
+		meta := &MutationMeta{
+			bucket:  inst.Defn.Bucket,
+			vbucket: Vbucket(vbno),
+			vbuuid:  Vbuuid(scrubTs.Vbuuids[vbno]),
+			seqno:   Seqno(scrubTs.Seqnos[vbno]),
+		}
+
+		var err error
+		for _, partnInst := range s.indexPartnMap[inst.InstId] {
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+				if err = slice.Delete(fix.docid, meta); err != nil {
+					break
+				}
+				if fix.key != nil {
+					if err = slice.Insert(fix.key, fix.docid, meta); err != nil {
+						break
+					}
+				}
+			}
+		}
+
+		if err != nil {
+			logging.Errorf("StorageMgr::handleIndexScrubRepair Index %v Error "+
+				"repairing docid %s: %v", inst.InstId, fix.docid, err)
+			result.skipped++
+		} else {
+			result.repaired++
+		}
+	}
+
+	logging.Infof("StorageMgr::handleIndexScrubRepair Index %v Repaired %v Skipped %v",
+		inst.InstId, result.repaired, result.skipped)
+
+	//corrections are applied at the flushed ts, a snapshot of the same ts
+	//is not created again on flush, so snapshot the repaired index here
+	if result.repaired > 0 {
+		s.createScrubRepairSnapshot(inst, currTs)
+	}
+
+	s.supvCmdch <- &MsgSuccess{}
+	respch <- result
+}
+
+//createScrubRepairSnapshot creates a snapshot of the slices of an index at
+//ts, so that scrubber corrections are visible to scans.
+func (s *storageMgr) createScrubRepairSnapshot(inst common.IndexInst, ts *common.TsVbuuid) {
+
+	idxStats := s.stats.Get().indexes[inst.InstId]
+	if idxStats == nil {
+		return
+	}
+
+	partnSnaps := make(map[common.PartitionId]PartitionSnapshot)
+	for partnId, partnInst := range s.indexPartnMap[inst.InstId] {
+		sliceSnaps := make(map[SliceId]SliceSnapshot)
+		for _, slice := range partnInst.Sc.GetAllSlices() {
+			info, err := slice.NewSnapshot(ts.Copy(), false)
+			if err != nil {
+				logging.Errorf("StorageMgr::createScrubRepairSnapshot Error Creating "+
+					"Snapshot Index: %v Slice: %v. Error %v", inst.InstId, slice.Id(), err)
+				common.CrashOnError(err)
+			}
+
+			snap, err := slice.OpenSnapshot(info)
+			if err != nil {
+				logging.Errorf("StorageMgr::createScrubRepairSnapshot Error Opening "+
+					"Snapshot Index: %v Slice: %v. Error %v", inst.InstId, slice.Id(), err)
+				common.CrashOnError(err)
+			}
+
+			sliceSnaps[slice.Id()] = &sliceSnapshot{
+				id:   slice.Id(),
+				snap: snap,
+			}
+		}
+		partnSnaps[partnId] = &partitionSnapshot{
+			id:     partnId,
+			slices: sliceSnaps,
+		}
+	}
+
+	idxStats.numSnapshots.Add(1)
+	s.updateSnapMapAndNotify(&indexSnapshot{
+		instId:  inst.InstId,
+		ts:      ts.Copy(),
+		created: time.Now(),
+		partns:  partnSnaps,
+	}, idxStats)
+}
+
 // Update index-snapshot map using index partition map
 // This function should be called only during initialization
 // of storage manager and during rollback.
@@ -949,9 +1299,10 @@ func (s *storageMgr) updateIndexSnapMap(indexPartnMap IndexPartnMap,
 			}
 
 			is := &indexSnapshot{
-				instId: idxInstId,
-				ts:     tsVbuuid,
-				partns: map[common.PartitionId]PartitionSnapshot{pid: ps},
+				instId:  idxInstId,
+				ts:      tsVbuuid,
+				created: time.Now(),
+				partns:  map[common.PartitionId]PartitionSnapshot{pid: ps},
 			}
 			s.indexSnapMap[idxInstId] = is
 			s.notifySnapshotCreation(is)
@@ -0,0 +1,361 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestIsSnapshotConsistentBoundedStaleness(t *testing.T) {
+	ts := common.NewTsVbuuid("default", 1)
+	now := time.Now()
+
+	tests := []struct {
+		created   time.Time
+		staleness time.Duration
+		ok        bool
+	}{
+		{now, 10 * time.Second, true},
+		{now.Add(-5 * time.Second), 10 * time.Second, true},
+		{now.Add(-15 * time.Second), 10 * time.Second, false},
+		{now.Add(-time.Hour), 10 * time.Second, false},
+		{now.Add(-time.Hour), 2 * time.Hour, true},
+	}
+	for _, test := range tests {
+		is := &indexSnapshot{instId: 1, ts: ts, created: test.created}
+		age := now.Sub(test.created)
+		if ok := isSnapshotConsistent(is, common.BoundedStalenessConsistency, nil,
+			test.staleness); ok != test.ok {
+			t.Errorf("snapshot of age %v, staleness %v: expected %v, got %v",
+				age, test.staleness, test.ok, ok)
+		}
+	}
+
+	//snapshot without a timestamp is never consistent
+	is := &indexSnapshot{instId: 1, created: now}
+	if isSnapshotConsistent(is, common.BoundedStalenessConsistency, nil, time.Hour) {
+		t.Errorf("expected snapshot without timestamp to be inconsistent")
+	}
+}
+
+func newTestStorageMgr(insts ...common.IndexInst) *storageMgr {
+	s := &storageMgr{
+		supvCmdch:        make(MsgChannel, 10),
+		snapshotNotifych: make(chan IndexSnapshot, 100),
+		indexInstMap:     make(common.IndexInstMap),
+		indexSnapMap:     make(map[common.IndexInstId]IndexSnapshot),
+		waitersMap:       make(map[common.IndexInstId][]*snapshotWaiter),
+		snapReqMap:       make(map[common.StreamId]map[string]bool),
+		flushTsMap:       make(map[common.StreamId]map[string]*common.TsVbuuid),
+	}
+	stats := &IndexerStats{}
+	stats.Init()
+	for _, inst := range insts {
+		s.indexInstMap[inst.InstId] = inst
+		stats.AddIndex(inst.InstId, inst.Defn.Bucket, inst.Defn.Name)
+	}
+	s.stats.Set(stats)
+	return s
+}
+
+func TestBucketIdleRefresh(t *testing.T) {
+	s := newTestStorageMgr(
+		common.IndexInst{InstId: 1, Stream: common.MAINT_STREAM,
+			Defn: common.IndexDefn{Bucket: "default", Name: "idx1"}},
+		common.IndexInst{InstId: 2, Stream: common.MAINT_STREAM,
+			Defn: common.IndexDefn{Bucket: "other", Name: "idx2"}},
+		common.IndexInst{InstId: 3, Stream: common.MAINT_STREAM,
+			Defn: common.IndexDefn{Bucket: "default", Name: "idx3"}},
+	)
+
+	idleTs := common.NewTsVbuuid("default", 1)
+	idleTs.Seqnos[0] = 10
+	behindTs := common.NewTsVbuuid("default", 1)
+	behindTs.Seqnos[0] = 5
+
+	created := time.Now().Add(-time.Minute)
+	s.indexSnapMap[1] = &indexSnapshot{instId: 1, ts: idleTs.Copy(), created: created}
+	s.indexSnapMap[2] = &indexSnapshot{instId: 2, ts: idleTs.Copy(), created: created}
+	s.indexSnapMap[3] = &indexSnapshot{instId: 3, ts: behindTs, created: created}
+
+	//a minute old snapshot is too stale for the waiter
+	wch := make(chan interface{}, 1)
+	s.waitersMap[1] = []*snapshotWaiter{newSnapshotWaiter(1, nil,
+		common.BoundedStalenessConsistency, 10*time.Second, wch, time.Time{})}
+	if isSnapshotConsistent(s.indexSnapMap[1], common.BoundedStalenessConsistency,
+		nil, 10*time.Second) {
+		t.Fatalf("expected snapshot to be stale before bucket idle")
+	}
+
+	s.handleBucketIdle(&MsgTKBucketIdle{streamId: common.MAINT_STREAM,
+		bucket: "default", ts: idleTs})
+	if resp := <-s.supvCmdch; resp.GetMsgType() != MSG_SUCCESS {
+		t.Fatalf("unexpected response %v", resp)
+	}
+
+	if is := s.indexSnapMap[1]; !is.Created().After(created) || !is.Timestamp().Equal(idleTs) {
+		t.Errorf("expected snapshot at %v to be refreshed, got %v created %v",
+			idleTs, is.Timestamp(), is.Created())
+	}
+	select {
+	case msg := <-wch:
+		if is, ok := msg.(IndexSnapshot); !ok || is.IndexInstId() != 1 {
+			t.Errorf("unexpected reply to waiter %v", msg)
+		}
+	default:
+		t.Errorf("expected waiter to be answered by refreshed snapshot")
+	}
+	if len(s.waitersMap[1]) != 0 {
+		t.Errorf("expected no waiters left, got %v", len(s.waitersMap[1]))
+	}
+
+	//index of another bucket, and index not caught up to the idle
+	//timestamp keep their snapshots
+	for _, instId := range []common.IndexInstId{2, 3} {
+		if is := s.indexSnapMap[instId]; !is.Created().Equal(created) {
+			t.Errorf("expected snapshot of %v not to be refreshed, created %v",
+				instId, is.Created())
+		}
+	}
+}
+
+func newTestTsVbuuid(seqno uint64) *common.TsVbuuid {
+	ts := common.NewTsVbuuid("default", 1)
+	ts.Seqnos[0] = seqno
+	ts.Vbuuids[0] = 100
+	ts.Snapshots[0] = [2]uint64{seqno, seqno}
+	ts.SetSnapAligned(true)
+	return ts
+}
+
+func receiveMsg(t *testing.T, ch MsgChannel) Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("expected a message")
+	}
+	return nil
+}
+
+func TestOnDemandSnapshot(t *testing.T) {
+	inst := common.IndexInst{InstId: 1, Stream: common.MAINT_STREAM,
+		State: common.INDEX_STATE_ACTIVE,
+		Defn:  common.IndexDefn{Bucket: "default", Name: "idx1"}}
+	s := newTestStorageMgr(inst)
+	s.supvRespch = make(MsgChannel, 10)
+	s.indexSnapMap[1] = &indexSnapshot{instId: 1, ts: newTestTsVbuuid(5), created: time.Now()}
+
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	conf.SetValue("numVbuckets", 1)
+	tk := &timekeeper{
+		supvCmdch:    make(MsgChannel, 10),
+		supvRespch:   make(MsgChannel, 10),
+		ss:           InitStreamState(conf),
+		config:       conf,
+		indexerState: common.INDEXER_ACTIVE,
+	}
+	tk.stats.Set(s.stats.Get())
+	tk.ss.initNewStream(common.MAINT_STREAM)
+	tk.ss.initBucketInStream(common.MAINT_STREAM, "default")
+
+	//mutations upto 10 have been flushed, but the flush skipped
+	//the snapshot, the next one is due at the snapshot interval.
+	flushedTs := newTestTsVbuuid(10)
+	flushedTs.SetSnapType(common.NO_SNAP)
+	tk.ss.streamBucketLastFlushedTsMap[common.MAINT_STREAM]["default"] = flushedTs
+
+	//scan waiting for mutations upto 10 makes storage manager request
+	//a snapshot, once per stream-bucket.
+	respch := make(chan interface{}, 1)
+	for i := 0; i < 2; i++ {
+		s.handleGetIndexSnapshot(&MsgIndexSnapRequest{ts: newTestTsVbuuid(10),
+			cons: common.QueryConsistency, idxInstId: 1, respch: respch})
+		if resp := receiveMsg(t, s.supvCmdch); resp.GetMsgType() != MSG_SUCCESS {
+			t.Fatalf("unexpected response %v", resp)
+		}
+	}
+	if len(s.waitersMap[1]) != 2 {
+		t.Fatalf("expected 2 waiters, got %v", len(s.waitersMap[1]))
+	}
+	msg := receiveMsg(t, s.supvRespch)
+	req, ok := msg.(*MsgTKOnDemandSnapshot)
+	if !ok || req.GetBucket() != "default" || req.GetTimestamp().Seqnos[0] != 10 {
+		t.Fatalf("unexpected request %v", msg)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(s.supvRespch) != 0 {
+		t.Errorf("expected a single on-demand snapshot request")
+	}
+
+	//timekeeper snapshots the flushed ts right away
+	tk.handleOnDemandSnapshot(req)
+	if resp := receiveMsg(t, tk.supvCmdch); resp.GetMsgType() != MSG_SUCCESS {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	msg = receiveMsg(t, tk.supvRespch)
+	stabilityTs, ok := msg.(*MsgTKStabilityTS)
+	if !ok || !stabilityTs.IsOnDemand() ||
+		stabilityTs.GetTimestamp().GetSnapType() != common.INMEM_SNAP ||
+		!stabilityTs.GetTimestamp().Equal(flushedTs) {
+		t.Fatalf("unexpected stability ts %v", msg)
+	}
+	if tk.ss.streamBucketFlushInProgressTsMap[common.MAINT_STREAM]["default"] == nil {
+		t.Errorf("expected on-demand snapshot to be in progress")
+	}
+
+	//snapshot of the flushed ts answers the waiters
+	s.updateSnapMapAndNotify(&indexSnapshot{instId: 1,
+		ts: stabilityTs.GetTimestamp(), created: time.Now()}, s.stats.Get().indexes[1])
+	for i := 0; i < 2; i++ {
+		select {
+		case resp := <-respch:
+			if is, ok := resp.(IndexSnapshot); !ok || is.Timestamp().Seqnos[0] != 10 {
+				t.Errorf("unexpected reply to waiter %v", resp)
+			}
+		default:
+			t.Errorf("expected waiter %v to be answered", i)
+		}
+	}
+}
+
+func TestOnDemandSnapshotNotFlushed(t *testing.T) {
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	conf.SetValue("numVbuckets", 1)
+	tk := &timekeeper{
+		supvRespch:   make(MsgChannel, 10),
+		ss:           InitStreamState(conf),
+		config:       conf,
+		indexerState: common.INDEXER_ACTIVE,
+	}
+	tk.ss.initNewStream(common.MAINT_STREAM)
+	tk.ss.initBucketInStream(common.MAINT_STREAM, "default")
+
+	flushedTs := newTestTsVbuuid(8)
+	flushedTs.SetSnapType(common.NO_SNAP)
+	tk.ss.streamBucketLastFlushedTsMap[common.MAINT_STREAM]["default"] = flushedTs
+
+	//waiting for mutations not yet flushed
+	tk.ss.addSnapWanted(common.MAINT_STREAM, "default", newTestTsVbuuid(10))
+	if tk.maybeSendOnDemandSnapshot(common.MAINT_STREAM, "default") {
+		t.Fatalf("unexpected snapshot of ts not satisfying the scan")
+	}
+
+	//flushed ts with a snapshot already
+	flushedTs = newTestTsVbuuid(10)
+	flushedTs.SetSnapType(common.INMEM_SNAP)
+	tk.ss.streamBucketLastFlushedTsMap[common.MAINT_STREAM]["default"] = flushedTs
+	if tk.maybeSendOnDemandSnapshot(common.MAINT_STREAM, "default") {
+		t.Fatalf("unexpected snapshot of ts already snapshotted")
+	}
+
+	//disabled
+	flushedTs.SetSnapType(common.NO_SNAP)
+	conf.SetValue("settings.on_demand_snapshot", false)
+	if tk.maybeSendOnDemandSnapshot(common.MAINT_STREAM, "default") {
+		t.Fatalf("unexpected snapshot with on-demand snapshots disabled")
+	}
+
+	conf.SetValue("settings.on_demand_snapshot", true)
+	if !tk.maybeSendOnDemandSnapshot(common.MAINT_STREAM, "default") {
+		t.Fatalf("expected snapshot of flushed ts")
+	}
+}
+
+type scrubRepairTestSnapshot struct {
+	Snapshot
+	ts *common.TsVbuuid
+}
+
+func (s *scrubRepairTestSnapshot) Timestamp() *common.TsVbuuid {
+	return s.ts
+}
+
+func (s *scrubRepairTestSnapshot) Open() error {
+	return nil
+}
+
+func (s *scrubRepairTestSnapshot) Close() error {
+	return nil
+}
+
+type scrubRepairTestSlice struct {
+	Slice
+	inserted  []string
+	deleted   []string
+	snapshots int
+}
+
+func (s *scrubRepairTestSlice) Id() SliceId {
+	return 0
+}
+
+func (s *scrubRepairTestSlice) Insert(key, docid []byte, meta *MutationMeta) error {
+	s.inserted = append(s.inserted, string(docid))
+	return nil
+}
+
+func (s *scrubRepairTestSlice) Delete(docid []byte, meta *MutationMeta) error {
+	s.deleted = append(s.deleted, string(docid))
+	return nil
+}
+
+func (s *scrubRepairTestSlice) NewSnapshot(ts *common.TsVbuuid, commit bool) (SnapshotInfo, error) {
+	s.snapshots++
+	return &testSnapshotInfo{ts}, nil
+}
+
+func (s *scrubRepairTestSlice) OpenSnapshot(info SnapshotInfo) (Snapshot, error) {
+	return &scrubRepairTestSnapshot{ts: info.Timestamp()}, nil
+}
+
+func TestScrubRepairSnapshot(t *testing.T) {
+	inst := common.IndexInst{InstId: 1, Stream: common.MAINT_STREAM,
+		State: common.INDEX_STATE_ACTIVE,
+		Defn:  common.IndexDefn{Bucket: "default", Name: "idx1"}}
+	s := newTestStorageMgr(inst)
+
+	slice := &scrubRepairTestSlice{}
+	sc := NewHashedSliceContainer()
+	sc.AddSlice(0, slice)
+	s.indexPartnMap = IndexPartnMap{1: PartitionInstMap{0: PartitionInst{Sc: sc}}}
+
+	created := time.Now().Add(-time.Minute)
+	s.indexSnapMap[1] = &indexSnapshot{instId: 1, ts: newTestTsVbuuid(10), created: created}
+
+	repair := func(scrubTs *common.TsVbuuid) *scrubRepairResult {
+		respch := make(chan interface{}, 1)
+		s.handleIndexScrubRepair(&MsgIndexScrubRepair{instId: 1, ts: scrubTs,
+			fixes:  []*scrubFix{{docid: []byte("doc1"), key: []byte(`["a"]`)}},
+			respch: respch})
+		if resp := receiveMsg(t, s.supvCmdch); resp.GetMsgType() != MSG_SUCCESS {
+			t.Fatalf("unexpected response %v", resp)
+		}
+		return (<-respch).(*scrubRepairResult)
+	}
+
+	//vbucket mutated since the scrub, nothing to snapshot
+	if r := repair(newTestTsVbuuid(5)); r.repaired != 0 || r.skipped != 1 {
+		t.Fatalf("expected fix skipped, got %+v", r)
+	}
+	if slice.snapshots != 0 || !s.indexSnapMap[1].Created().Equal(created) {
+		t.Errorf("unexpected snapshot without repair")
+	}
+
+	//repaired index is snapshotted at the same ts
+	if r := repair(newTestTsVbuuid(10)); r.repaired != 1 {
+		t.Fatalf("expected fix repaired, got %+v", r)
+	}
+	if len(slice.deleted) != 1 || len(slice.inserted) != 1 {
+		t.Errorf("expected doc deleted and inserted, got %v %v", slice.deleted, slice.inserted)
+	}
+	is := s.indexSnapMap[1]
+	if slice.snapshots != 1 || !is.Created().After(created) || is.Timestamp().Seqnos[0] != 10 {
+		t.Errorf("expected repaired index snapshotted at 10, got %v created %v",
+			is.Timestamp(), is.Created())
+	}
+	if ss := is.Partitions()[0].Slices()[0].Snapshot(); ss.Timestamp().Seqnos[0] != 10 {
+		t.Errorf("expected slice snapshot at 10, got %v", ss.Timestamp())
+	}
+}
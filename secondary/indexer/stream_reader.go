@@ -16,6 +16,7 @@ import (
 
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/dataport"
+	"github.com/couchbase/indexing/secondary/failpoint"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/platform"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/data"
@@ -219,6 +220,11 @@ func (r *mutationStreamReader) listenSupvCmd() {
 
 func (r *mutationStreamReader) handleVbKeyVersions(vbKeyVers []*protobuf.VbKeyVersions) {
 
+	//injected errors are handled like a panic from stream library
+	if err := failpoint.Inject(FP_STREAM_READER); err != nil {
+		panic(err)
+	}
+
 	for _, vb := range vbKeyVers {
 		r.streamWorkers[int(vb.GetVbucket())%r.numWorkers].workerch <- vb
 	}
@@ -361,12 +367,14 @@ func (r *mutationStreamReader) maybeSendSync() {
 
 	hwt := make(map[string]*common.TsVbuuid)
 	prevSnap := make(map[string]*common.TsVbuuid)
+	collSeqnos := make(map[string]map[uint32]Timestamp)
 	numVbuckets := r.config["numVbuckets"].Int()
 
 	r.queueMapLock.RLock()
 	for bucket, _ := range r.bucketQueueMap {
 		hwt[bucket] = common.NewTsVbuuidCached(bucket, numVbuckets)
 		prevSnap[bucket] = common.NewTsVbuuidCached(bucket, numVbuckets)
+		collSeqnos[bucket] = make(map[uint32]Timestamp)
 	}
 
 	for bucket, _ := range hwt {
@@ -389,15 +397,27 @@ func (r *mutationStreamReader) maybeSendSync() {
 					prevSnap[bucket].Snapshots[vb] = r.streamWorkers[i].bucketPrevSnapMap[bucket].Snapshots[vb]
 				}
 			}
+			//each worker only tracks the vbuckets it owns
+			for cid, seqnos := range r.streamWorkers[i].bucketCollSeqnos[bucket] {
+				if _, ok := collSeqnos[bucket][cid]; !ok {
+					collSeqnos[bucket][cid] = NewTimestamp(numVbuckets)
+				}
+				for vb, seqno := range seqnos {
+					if seqno > collSeqnos[bucket][cid][vb] {
+						collSeqnos[bucket][cid][vb] = seqno
+					}
+				}
+			}
 			r.streamWorkers[i].bucketSyncDue[bucket] = false
 			r.streamWorkers[i].lock.Unlock()
 		}
 		if needSync {
 			r.supvRespch <- &MsgBucketHWT{mType: STREAM_READER_HWT,
-				streamId: r.streamId,
-				bucket:   bucket,
-				ts:       hwt[bucket],
-				prevSnap: prevSnap[bucket]}
+				streamId:   r.streamId,
+				bucket:     bucket,
+				ts:         hwt[bucket],
+				prevSnap:   prevSnap[bucket],
+				collSeqnos: collSeqnos[bucket]}
 		}
 	}
 
@@ -438,6 +458,10 @@ type streamWorker struct {
 	bucketPrevSnapMap map[string]*common.TsVbuuid
 	bucketSyncDue     map[string]bool
 
+	//high seqno per vbucket of each collection of a bucket,
+	//for the mutations which have passed the bucket filter
+	bucketCollSeqnos map[string]map[uint32]Timestamp
+
 	lock sync.RWMutex
 
 	//local variables
@@ -463,6 +487,7 @@ func newStreamWorker(streamId common.StreamId, numWorkers int, workerId int, con
 		bucketFilter:      make(map[string]*common.TsVbuuid),
 		bucketPrevSnapMap: make(map[string]*common.TsVbuuid),
 		bucketSyncDue:     make(map[string]bool),
+		bucketCollSeqnos:  make(map[string]map[uint32]Timestamp),
 		reader:            reader,
 	}
 	w.initBucketFilter(bucketFilter)
@@ -536,7 +561,7 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 				w.evalFilter = false
 				//check the bucket filter to see if this mutation can be processed
 				//valid mutation will increment seqno of the filter
-				if !w.checkAndSetBucketFilter(meta) {
+				if !w.checkAndSetBucketFilter(meta, kv.GetCollectionID()) {
 					w.skipMutation = true
 				}
 			}
@@ -571,6 +596,12 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 
 			mutk.mut = append(mutk.mut, mut)
 
+		case common.Sync:
+			//projector sends a Sync with the seqno of events it doesn't
+			//forward, like collection system events. Move the filter past
+			//it, else a snapshot ending with such an event never completes.
+			w.setSeqnoInBucketFilter(meta)
+
 		case common.DropData:
 			//send message to supervisor to take decision
 			msg := &MsgStream{mType: STREAM_READER_STREAM_DROP_DATA,
@@ -672,6 +703,7 @@ func (w *streamWorker) initBucketFilter(bucketFilter map[string]*common.TsVbuuid
 			}
 
 			w.bucketSyncDue[b] = false
+			w.bucketCollSeqnos[b] = make(map[uint32]Timestamp)
 
 			//reset stat for bucket
 			stats := w.reader.stats.Get()
@@ -689,6 +721,7 @@ func (w *streamWorker) initBucketFilter(bucketFilter map[string]*common.TsVbuuid
 			delete(w.bucketFilter, b)
 			delete(w.bucketPrevSnapMap, b)
 			delete(w.bucketSyncDue, b)
+			delete(w.bucketCollSeqnos, b)
 		}
 	}
 
@@ -715,8 +748,10 @@ func (w *streamWorker) setBucketFilter(meta *MutationMeta) {
 
 //checkAndSetBucketFilter checks if mutation can be processed
 //based on the current filter. Filter is also updated with new
-//seqno/vbuuid if mutations can be processed.
-func (w *streamWorker) checkAndSetBucketFilter(meta *MutationMeta) bool {
+//seqno/vbuuid if mutations can be processed, along with the high
+//seqno of the collection the mutation belongs to.
+func (w *streamWorker) checkAndSetBucketFilter(meta *MutationMeta,
+	collectionId uint32) bool {
 
 	w.lock.Lock()
 	defer w.lock.Unlock()
@@ -747,6 +782,7 @@ func (w *streamWorker) checkAndSetBucketFilter(meta *MutationMeta) bool {
 			filter.Seqnos[meta.vbucket] = uint64(meta.seqno)
 			filter.Vbuuids[meta.vbucket] = uint64(meta.vbuuid)
 			w.bucketSyncDue[meta.bucket] = true
+			w.setCollectionSeqno(meta, collectionId)
 			return true
 		} else {
 			logging.Tracef("MutationStreamReader::checkAndSetBucketFilter Skipped "+
@@ -762,6 +798,42 @@ func (w *streamWorker) checkAndSetBucketFilter(meta *MutationMeta) bool {
 	}
 }
 
+//setSeqnoInBucketFilter moves the seqno of bucket filter forward to
+//the seqno of a Sync message. Unlike checkAndSetBucketFilter, there is
+//no mutation for the seqno and it is not out-of-bound to receive the
+//seqno of the last processed mutation again.
+func (w *streamWorker) setSeqnoInBucketFilter(meta *MutationMeta) {
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if filter, ok := w.bucketFilter[meta.bucket]; ok {
+		if uint64(meta.seqno) > filter.Seqnos[meta.vbucket] &&
+			filter.Vbuuids[meta.vbucket] != 0 {
+			filter.Seqnos[meta.vbucket] = uint64(meta.seqno)
+			filter.Vbuuids[meta.vbucket] = uint64(meta.vbuuid)
+			w.bucketSyncDue[meta.bucket] = true
+		}
+	}
+}
+
+//setCollectionSeqno records the seqno of mutation as the high seqno
+//of its collection for the vbucket. Called with lock held.
+func (w *streamWorker) setCollectionSeqno(meta *MutationMeta,
+	collectionId uint32) {
+
+	collSeqnos, ok := w.bucketCollSeqnos[meta.bucket]
+	if !ok {
+		return
+	}
+	seqnos, ok := collSeqnos[collectionId]
+	if !ok {
+		seqnos = NewTimestamp(len(w.bucketFilter[meta.bucket].Seqnos))
+		collSeqnos[collectionId] = seqnos
+	}
+	seqnos[meta.vbucket] = meta.seqno
+}
+
 //updates snapshot information in bucket filter
 func (w *streamWorker) updateSnapInFilter(meta *MutationMeta,
 	snapStart uint64, snapEnd uint64) {
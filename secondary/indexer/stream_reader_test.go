@@ -0,0 +1,68 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/data"
+)
+
+func newTestKeyVersions(seqno uint64, cmd byte) *protobuf.KeyVersions {
+	return &protobuf.KeyVersions{
+		Seqno:    &seqno,
+		Uuids:    []uint64{1},
+		Commands: []uint32{uint32(cmd)},
+		Keys:     [][]byte{[]byte(`["key"]`)},
+		Oldkeys:  [][]byte{nil},
+	}
+}
+
+func TestSnapshotEndingWithSystemEvent(t *testing.T) {
+
+	reader := &mutationStreamReader{streamId: common.MAINT_STREAM,
+		indexerState: common.INDEXER_PAUSED}
+	w := &streamWorker{streamId: common.MAINT_STREAM,
+		bucketFilter:      map[string]*common.TsVbuuid{"default": common.NewTsVbuuid("default", 1)},
+		bucketPrevSnapMap: map[string]*common.TsVbuuid{"default": common.NewTsVbuuid("default", 1)},
+		bucketSyncDue:     map[string]bool{"default": false},
+		bucketCollSeqnos:  map[string]map[uint32]Timestamp{"default": {}},
+		reader:            reader,
+	}
+	//as set by StreamBegin
+	w.bucketFilter["default"].Vbuuids[0] = 100
+
+	//snapshot 1-3, where 3 is a collection system event projector
+	//doesn't send a mutation for, only a Sync with its seqno.
+	snapshot := newTestKeyVersions(0, common.Snapshot)
+	snapshot.Uuids[0] = 0x1
+	snapshot.Keys[0] = make([]byte, 8)
+	snapshot.Oldkeys[0] = make([]byte, 8)
+	binary.BigEndian.PutUint64(snapshot.Keys[0], 1)
+	binary.BigEndian.PutUint64(snapshot.Oldkeys[0], 3)
+	w.handleSingleKeyVersion("default", 0, 100, snapshot)
+	w.handleSingleKeyVersion("default", 0, 100, newTestKeyVersions(2, common.Upsert))
+
+	filter := w.bucketFilter["default"]
+	if filter.Seqnos[0] != 2 || filter.CheckSnapAligned() {
+		t.Fatalf("Unexpected filter %v-%v after mutation",
+			filter.Seqnos[0], filter.Snapshots[0])
+	}
+
+	w.bucketSyncDue["default"] = false
+	w.handleSingleKeyVersion("default", 0, 100, newTestKeyVersions(3, common.Sync))
+	if filter.Seqnos[0] != 3 || !filter.CheckSnapAligned() {
+		t.Fatalf("Unexpected filter %v-%v after system event",
+			filter.Seqnos[0], filter.Snapshots[0])
+	}
+	if !w.bucketSyncDue["default"] {
+		t.Errorf("Expected HWT to be sent to timekeeper")
+	}
+
+	//periodic Sync with the seqno already processed is a no-op
+	w.bucketSyncDue["default"] = false
+	w.handleSingleKeyVersion("default", 0, 100, newTestKeyVersions(3, common.Sync))
+	if filter.Seqnos[0] != 3 || w.bucketSyncDue["default"] {
+		t.Errorf("Unexpected filter %v after repeated Sync", filter.Seqnos[0])
+	}
+}
@@ -26,6 +26,7 @@ type StreamState struct {
 	streamBucketVbRefCountMap map[common.StreamId]BucketVbRefCountMap
 
 	streamBucketHWTMap            map[common.StreamId]BucketHWTMap
+	streamBucketCollectionHWTMap  map[common.StreamId]BucketCollectionHWTMap
 	streamBucketNeedsCommitMap    map[common.StreamId]BucketNeedsCommitMap
 	streamBucketHasBuildCompTSMap map[common.StreamId]BucketHasBuildCompTSMap
 	streamBucketNewTsReqdMap      map[common.StreamId]BucketNewTsReqdMap
@@ -52,9 +53,11 @@ type StreamState struct {
 	streamBucketTimerStopCh     map[common.StreamId]BucketTimerStopCh
 	streamBucketLastPersistTime map[common.StreamId]BucketLastPersistTime
 	streamBucketSkippedInMemTs  map[common.StreamId]BucketSkippedInMemTs
+	streamBucketSnapWantedTsMap map[common.StreamId]BucketSnapWantedTsMap
 }
 
 type BucketHWTMap map[string]*common.TsVbuuid
+type BucketCollectionHWTMap map[string]map[uint32]Timestamp
 type BucketLastFlushedTsMap map[string]*common.TsVbuuid
 type BucketRestartTsMap map[string]*common.TsVbuuid
 type BucketOpenTsMap map[string]*common.TsVbuuid
@@ -80,6 +83,7 @@ type BucketRepairStopCh map[string]StopChannel
 type BucketTimerStopCh map[string]StopChannel
 type BucketLastPersistTime map[string]time.Time
 type BucketSkippedInMemTs map[string]uint64
+type BucketSnapWantedTsMap map[string]*common.TsVbuuid
 
 type BucketStatus map[string]StreamStatus
 
@@ -88,6 +92,7 @@ func InitStreamState(config common.Config) *StreamState {
 	ss := &StreamState{
 		config:                                config,
 		streamBucketHWTMap:                    make(map[common.StreamId]BucketHWTMap),
+		streamBucketCollectionHWTMap:          make(map[common.StreamId]BucketCollectionHWTMap),
 		streamBucketNeedsCommitMap:            make(map[common.StreamId]BucketNeedsCommitMap),
 		streamBucketHasBuildCompTSMap:         make(map[common.StreamId]BucketHasBuildCompTSMap),
 		streamBucketNewTsReqdMap:              make(map[common.StreamId]BucketNewTsReqdMap),
@@ -114,6 +119,7 @@ func InitStreamState(config common.Config) *StreamState {
 		streamBucketLastPersistTime:           make(map[common.StreamId]BucketLastPersistTime),
 		streamBucketSkippedInMemTs:            make(map[common.StreamId]BucketSkippedInMemTs),
 		streamBucketLastSnapMarker:            make(map[common.StreamId]BucketLastSnapMarker),
+		streamBucketSnapWantedTsMap:           make(map[common.StreamId]BucketSnapWantedTsMap),
 	}
 
 	return ss
@@ -126,6 +132,9 @@ func (ss *StreamState) initNewStream(streamId common.StreamId) {
 	bucketHWTMap := make(BucketHWTMap)
 	ss.streamBucketHWTMap[streamId] = bucketHWTMap
 
+	bucketCollectionHWTMap := make(BucketCollectionHWTMap)
+	ss.streamBucketCollectionHWTMap[streamId] = bucketCollectionHWTMap
+
 	bucketNeedsCommitMap := make(BucketNeedsCommitMap)
 	ss.streamBucketNeedsCommitMap[streamId] = bucketNeedsCommitMap
 
@@ -201,6 +210,9 @@ func (ss *StreamState) initNewStream(streamId common.StreamId) {
 	bucketLastSnapMarker := make(BucketLastSnapMarker)
 	ss.streamBucketLastSnapMarker[streamId] = bucketLastSnapMarker
 
+	bucketSnapWantedTsMap := make(BucketSnapWantedTsMap)
+	ss.streamBucketSnapWantedTsMap[streamId] = bucketSnapWantedTsMap
+
 	ss.streamStatus[streamId] = STREAM_ACTIVE
 
 }
@@ -210,6 +222,7 @@ func (ss *StreamState) initBucketInStream(streamId common.StreamId,
 
 	numVbuckets := ss.config["numVbuckets"].Int()
 	ss.streamBucketHWTMap[streamId][bucket] = common.NewTsVbuuid(bucket, numVbuckets)
+	ss.streamBucketCollectionHWTMap[streamId][bucket] = make(map[uint32]Timestamp)
 	ss.streamBucketNeedsCommitMap[streamId][bucket] = false
 	ss.streamBucketHasBuildCompTSMap[streamId][bucket] = false
 	ss.streamBucketNewTsReqdMap[streamId][bucket] = false
@@ -234,6 +247,7 @@ func (ss *StreamState) initBucketInStream(streamId common.StreamId,
 	ss.streamBucketStartTimeMap[streamId][bucket] = uint64(0)
 	ss.streamBucketSkippedInMemTs[streamId][bucket] = 0
 	ss.streamBucketLastSnapMarker[streamId][bucket] = common.NewTsVbuuid(bucket, numVbuckets)
+	ss.streamBucketSnapWantedTsMap[streamId][bucket] = nil
 
 	ss.streamBucketStatus[streamId][bucket] = STREAM_ACTIVE
 
@@ -250,6 +264,7 @@ func (ss *StreamState) cleanupBucketFromStream(streamId common.StreamId,
 	}
 
 	delete(ss.streamBucketHWTMap[streamId], bucket)
+	delete(ss.streamBucketCollectionHWTMap[streamId], bucket)
 	delete(ss.streamBucketNeedsCommitMap[streamId], bucket)
 	delete(ss.streamBucketHasBuildCompTSMap[streamId], bucket)
 	delete(ss.streamBucketNewTsReqdMap[streamId], bucket)
@@ -274,6 +289,7 @@ func (ss *StreamState) cleanupBucketFromStream(streamId common.StreamId,
 	delete(ss.streamBucketStartTimeMap[streamId], bucket)
 	delete(ss.streamBucketLastSnapMarker[streamId], bucket)
 	delete(ss.streamBucketSkippedInMemTs[streamId], bucket)
+	delete(ss.streamBucketSnapWantedTsMap[streamId], bucket)
 
 	ss.streamBucketStatus[streamId][bucket] = STREAM_INACTIVE
 
@@ -286,6 +302,7 @@ func (ss *StreamState) resetStreamState(streamId common.StreamId) {
 
 	//delete this stream from internal maps
 	delete(ss.streamBucketHWTMap, streamId)
+	delete(ss.streamBucketCollectionHWTMap, streamId)
 	delete(ss.streamBucketNeedsCommitMap, streamId)
 	delete(ss.streamBucketHasBuildCompTSMap, streamId)
 	delete(ss.streamBucketNewTsReqdMap, streamId)
@@ -309,6 +326,7 @@ func (ss *StreamState) resetStreamState(streamId common.StreamId) {
 	delete(ss.streamBucketStartTimeMap, streamId)
 	delete(ss.streamBucketSkippedInMemTs, streamId)
 	delete(ss.streamBucketLastSnapMarker, streamId)
+	delete(ss.streamBucketSnapWantedTsMap, streamId)
 
 	ss.streamStatus[streamId] = STREAM_INACTIVE
 
@@ -395,6 +413,15 @@ func (ss *StreamState) setHWTFromRestartTs(streamId common.StreamId,
 			//update HWT
 			ss.streamBucketHWTMap[streamId][bucket] = restartTs.Copy()
 
+			//collections cannot be ahead of the bucket
+			for _, seqnos := range ss.streamBucketCollectionHWTMap[streamId][bucket] {
+				for i, seqno := range seqnos {
+					if uint64(seqno) > restartTs.Seqnos[i] {
+						seqnos[i] = Seqno(restartTs.Seqnos[i])
+					}
+				}
+			}
+
 			//update Last Flushed Ts
 			ss.streamBucketLastFlushedTsMap[streamId][bucket] = restartTs.Copy()
 			logging.Verbosef("StreamState::setHWTFromRestartTs HWT Set For "+
@@ -759,6 +786,40 @@ func (ss *StreamState) updateHWT(streamId common.StreamId,
 	})
 }
 
+//updateCollectionHWT will update the high seqno of each collection
+//of a bucket in the stream based on the Sync message received.
+func (ss *StreamState) updateCollectionHWT(streamId common.StreamId,
+	bucket string, collSeqnos map[uint32]Timestamp) {
+
+	collHWT, ok := ss.streamBucketCollectionHWTMap[streamId][bucket]
+	if !ok {
+		return
+	}
+
+	numVbuckets := ss.config["numVbuckets"].Int()
+	for cid, seqnos := range collSeqnos {
+		ts, ok := collHWT[cid]
+		if !ok {
+			ts = NewTimestamp(numVbuckets)
+			collHWT[cid] = ts
+		}
+		for i, seq := range seqnos {
+			if seq > ts[i] {
+				ts[i] = seq
+			}
+		}
+	}
+}
+
+//getCollectionHWT returns the high seqno of a collection for each
+//vbucket of a bucket in the stream, nil if no mutation has been
+//received for the collection yet.
+func (ss *StreamState) getCollectionHWT(streamId common.StreamId,
+	bucket string, collectionId uint32) Timestamp {
+
+	return ss.streamBucketCollectionHWTMap[streamId][bucket][collectionId]
+}
+
 func (ss *StreamState) checkNewTSDue(streamId common.StreamId, bucket string) bool {
 	newTsReqd := ss.streamBucketNewTsReqdMap[streamId][bucket]
 	return newTsReqd
@@ -792,6 +853,45 @@ func (ss *StreamState) checkCommitOverdue(streamId common.StreamId, bucket strin
 	return false
 }
 
+//checkBucketIdle returns true if all the mutations received for the
+//stream-bucket have been flushed
+func (ss *StreamState) checkBucketIdle(streamId common.StreamId, bucket string) bool {
+
+	tsList := ss.streamBucketTsListMap[streamId][bucket]
+	return !ss.streamBucketNewTsReqdMap[streamId][bucket] &&
+		ss.streamBucketFlushInProgressTsMap[streamId][bucket] == nil &&
+		ss.streamBucketFlushEnabledMap[streamId][bucket] &&
+		(tsList == nil || tsList.Len() == 0)
+}
+
+//addSnapWanted records that a scan is waiting for a snapshot of the
+//stream-bucket at least as recent as ts. Wanted seqnos of all waiting
+//scans are merged, as a snapshot satisfying the merged ts satisfies all.
+func (ss *StreamState) addSnapWanted(streamId common.StreamId, bucket string,
+	ts *common.TsVbuuid) {
+
+	wanted := ss.streamBucketSnapWantedTsMap[streamId][bucket]
+	if wanted == nil {
+		ss.streamBucketSnapWantedTsMap[streamId][bucket] = ts.Copy()
+		return
+	}
+
+	for i, seqno := range ts.Seqnos {
+		if i < len(wanted.Seqnos) && seqno > wanted.Seqnos[i] {
+			wanted.Seqnos[i] = seqno
+		}
+	}
+}
+
+//checkSnapWanted returns true if a scan is waiting for a snapshot
+//which ts can satisfy
+func (ss *StreamState) checkSnapWanted(streamId common.StreamId, bucket string,
+	ts *common.TsVbuuid) bool {
+
+	wanted := ss.streamBucketSnapWantedTsMap[streamId][bucket]
+	return wanted != nil && ts != nil && ts.IsSnapAligned() && ts.AsRecentTs(wanted)
+}
+
 //gets the stability timestamp based on the current HWT
 func (ss *StreamState) getNextStabilityTS(streamId common.StreamId,
 	bucket string) *common.TsVbuuid {
@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestCollectionHWT(t *testing.T) {
+
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	conf.SetValue("numVbuckets", 2)
+
+	ss := InitStreamState(conf)
+	ss.initNewStream(common.MAINT_STREAM)
+	ss.initBucketInStream(common.MAINT_STREAM, "default")
+
+	ss.updateCollectionHWT(common.MAINT_STREAM, "default", map[uint32]Timestamp{
+		0: {10, 4},
+		8: {3, 0},
+	})
+	//older seqnos from a slower worker don't move the HWT back
+	ss.updateCollectionHWT(common.MAINT_STREAM, "default", map[uint32]Timestamp{
+		8: {2, 7},
+	})
+
+	if ts := ss.getCollectionHWT(common.MAINT_STREAM, "default", 8); ts[0] != 3 || ts[1] != 7 {
+		t.Errorf("Unexpected HWT %v for collection 8", ts)
+	}
+	if ts := ss.getCollectionHWT(common.MAINT_STREAM, "default", 9); ts != nil {
+		t.Errorf("Unexpected HWT %v for unknown collection", ts)
+	}
+
+	//collections are clipped to the restart timestamp
+	restartTs := common.NewTsVbuuid("default", 2)
+	restartTs.Seqnos[0] = 5
+	restartTs.Seqnos[1] = 5
+	ss.streamBucketRestartTsMap[common.MAINT_STREAM]["default"] = restartTs
+	ss.setHWTFromRestartTs(common.MAINT_STREAM, "default")
+
+	if ts := ss.getCollectionHWT(common.MAINT_STREAM, "default", 0); ts[0] != 5 || ts[1] != 4 {
+		t.Errorf("Unexpected HWT %v for default collection after restart", ts)
+	}
+	if ts := ss.getCollectionHWT(common.MAINT_STREAM, "default", 8); ts[0] != 3 || ts[1] != 5 {
+		t.Errorf("Unexpected HWT %v for collection 8 after restart", ts)
+	}
+
+	ss.cleanupBucketFromStream(common.MAINT_STREAM, "default")
+	if ts := ss.getCollectionHWT(common.MAINT_STREAM, "default", 0); ts != nil {
+		t.Errorf("Unexpected HWT %v after bucket cleanup", ts)
+	}
+}
@@ -175,6 +175,9 @@ func (tk *timekeeper) handleSupervisorCommands(cmd Message) {
 	case TK_GET_BUCKET_HWT:
 		tk.handleGetBucketHWT(cmd)
 
+	case TK_ON_DEMAND_SNAPSHOT:
+		tk.handleOnDemandSnapshot(cmd)
+
 	case INDEXER_INIT_PREP_RECOVERY:
 		tk.handleInitPrepRecovery(cmd)
 
@@ -497,6 +500,8 @@ func (tk *timekeeper) handleSync(cmd Message) {
 
 	//update HWT for the bucket
 	tk.ss.updateHWT(streamId, bucket, hwt, prevSnap)
+	tk.ss.updateCollectionHWT(streamId, bucket,
+		cmd.(*MsgBucketHWT).GetCollectionSeqnos())
 	hwt.Free()
 	prevSnap.Free()
 
@@ -534,6 +539,12 @@ func (tk *timekeeper) handleFlushDone(cmd Message) {
 
 		//update internal map to reflect flush is done
 		bucketFlushInProgressTsMap[bucket] = nil
+
+		//scans waiting for a snapshot upto this ts have been served
+		if fts != nil && fts.GetSnapType() != common.NO_SNAP &&
+			tk.ss.checkSnapWanted(streamId, bucket, fts) {
+			tk.ss.streamBucketSnapWantedTsMap[streamId][bucket] = nil
+		}
 	} else {
 		//this bucket is already gone from this stream, may be because
 		//the index were dropped. Log and ignore.
@@ -562,7 +573,7 @@ func (tk *timekeeper) processFlushAbort(streamId common.StreamId, bucket string)
 	bucketLastFlushedTsMap := tk.ss.streamBucketLastFlushedTsMap[streamId]
 	bucketFlushInProgressTsMap := tk.ss.streamBucketFlushInProgressTsMap[streamId]
 
-	logging.Infof("Timekeeper::processFlushAbort Flush Abort Received %v %v"+
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::processFlushAbort Flush Abort Received %v %v"+
 		"\nFlushTs %v \nLastFlushTs %v", streamId, bucket, bucketFlushInProgressTsMap[bucket],
 		bucketLastFlushedTsMap[bucket])
 
@@ -577,7 +588,7 @@ func (tk *timekeeper) processFlushAbort(streamId common.StreamId, bucket string)
 
 	case STREAM_ACTIVE, STREAM_RECOVERY:
 
-		logging.Infof("Timekeeper::processFlushAbort %v %v Generate InitPrepRecovery", streamId, bucket)
+		tk.logCtx(streamId, bucket).Infof("Timekeeper::processFlushAbort %v %v Generate InitPrepRecovery", streamId, bucket)
 		tk.supvRespch <- &MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
 			streamId: streamId,
 			bucket:   bucket}
@@ -585,7 +596,7 @@ func (tk *timekeeper) processFlushAbort(streamId common.StreamId, bucket string)
 	case STREAM_PREPARE_RECOVERY:
 
 		//send message to stop running stream
-		logging.Infof("Timekeeper::processFlushAbort %v %v Generate PrepareRecovery", streamId, bucket)
+		tk.logCtx(streamId, bucket).Infof("Timekeeper::processFlushAbort %v %v Generate PrepareRecovery", streamId, bucket)
 		tk.supvRespch <- &MsgRecovery{mType: INDEXER_PREPARE_RECOVERY,
 			streamId: streamId,
 			bucket:   bucket}
@@ -595,7 +606,7 @@ func (tk *timekeeper) processFlushAbort(streamId common.StreamId, bucket string)
 			"Received for Inactive StreamId %v bucket %v ", streamId, bucket)
 
 	default:
-		logging.Errorf("Timekeeper::processFlushAbort %v %v Invalid Stream State %v.", streamId, bucket, state)
+		tk.logCtx(streamId, bucket).Errorf("Timekeeper::processFlushAbort %v %v Invalid Stream State %v.", streamId, bucket, state)
 
 	}
 
@@ -625,8 +636,11 @@ func (tk *timekeeper) handleFlushDoneMaintStream(cmd Message) {
 		tk.checkPendingStreamMerge(streamId, bucket)
 
 		//check if there is any pending TS for this bucket/stream.
-		//It can be processed now.
-		tk.processPendingTS(streamId, bucket)
+		//It can be processed now. Otherwise snapshot the flushed ts
+		//if a scan is waiting for it.
+		if !tk.processPendingTS(streamId, bucket) {
+			tk.maybeSendOnDemandSnapshot(streamId, bucket)
+		}
 
 	case STREAM_PREPARE_RECOVERY:
 
@@ -901,7 +915,7 @@ func (tk *timekeeper) handleStreamBegin(cmd Message) {
 
 	defer meta.Free()
 
-	logging.Infof("TK StreamBegin %v %v %v %v %v", streamId, meta.bucket,
+	tk.logCtx(streamId, meta.bucket).Sampled().Infof("TK StreamBegin %v %v %v %v %v", streamId, meta.bucket,
 		meta.vbucket, meta.vbuuid, meta.seqno)
 
 	tk.lock.Lock()
@@ -985,7 +999,7 @@ func (tk *timekeeper) handleStreamEnd(cmd Message) {
 
 	defer meta.Free()
 
-	logging.Infof("TK StreamEnd %v %v %v %v %v", streamId, meta.bucket,
+	tk.logCtx(streamId, meta.bucket).Sampled().Infof("TK StreamEnd %v %v %v %v %v", streamId, meta.bucket,
 		meta.vbucket, meta.vbuuid, meta.seqno)
 
 	tk.lock.Lock()
@@ -1074,7 +1088,7 @@ func (tk *timekeeper) handleStreamConnError(cmd Message) {
 	bucket := cmd.(*MsgStreamInfo).GetBucket()
 	vbList := cmd.(*MsgStreamInfo).GetVbList()
 
-	logging.Infof("TK ConnError %v %v %v", streamId, bucket, vbList)
+	tk.logCtx(streamId, bucket).Infof("TK ConnError %v %v %v", streamId, bucket, vbList)
 
 	tk.lock.Lock()
 	defer tk.lock.Unlock()
@@ -1335,7 +1349,7 @@ func (tk *timekeeper) handleInitBuildDoneAck(cmd Message) {
 	bucket := cmd.(*MsgTKInitBuildDone).GetBucket()
 	mergeTs := cmd.(*MsgTKInitBuildDone).GetMergeTs()
 
-	logging.Infof("Timekeeper::handleInitBuildDoneAck StreamId %v Bucket %v",
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::handleInitBuildDoneAck StreamId %v Bucket %v",
 		streamId, bucket)
 
 	tk.lock.Lock()
@@ -1393,7 +1407,7 @@ func (tk *timekeeper) handleMergeStreamAck(cmd Message) {
 	streamId := cmd.(*MsgTKMergeStream).GetStreamId()
 	bucket := cmd.(*MsgTKMergeStream).GetBucket()
 
-	logging.Infof("Timekeeper::handleMergeStreamAck StreamId %v Bucket %v",
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::handleMergeStreamAck StreamId %v Bucket %v",
 		streamId, bucket)
 
 	tk.supvCmdch <- &MsgSuccess{}
@@ -1406,7 +1420,7 @@ func (tk *timekeeper) handleStreamRequestDone(cmd Message) {
 	buildTs := cmd.(*MsgStreamInfo).GetBuildTs()
 	activeTs := cmd.(*MsgStreamInfo).GetActiveTs()
 
-	logging.Infof("Timekeeper::handleStreamRequestDone StreamId %v Bucket %v",
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::handleStreamRequestDone StreamId %v Bucket %v",
 		streamId, bucket)
 
 	tk.lock.Lock()
@@ -1463,7 +1477,7 @@ func (tk *timekeeper) handleRecoveryDone(cmd Message) {
 	mergeTs := cmd.(*MsgRecovery).GetRestartTs()
 	activeTs := cmd.(*MsgRecovery).GetActiveTs()
 
-	logging.Infof("Timekeeper::handleRecoveryDone StreamId %v Bucket %v",
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::handleRecoveryDone StreamId %v Bucket %v",
 		streamId, bucket)
 
 	tk.lock.Lock()
@@ -1535,7 +1549,7 @@ func (tk *timekeeper) handleConfigUpdate(cmd Message) {
 func (tk *timekeeper) prepareRecovery(streamId common.StreamId,
 	bucket string) bool {
 
-	logging.Infof("Timekeeper::prepareRecovery StreamId %v Bucket %v",
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::prepareRecovery StreamId %v Bucket %v",
 		streamId, bucket)
 
 	//change to PREPARE_RECOVERY so that
@@ -1921,12 +1935,18 @@ func (tk *timekeeper) generateNewStabilityTS(streamId common.StreamId,
 			tsVbuuid := tk.ss.streamBucketLastFlushedTsMap[streamId][bucket].Copy()
 
 			if tsVbuuid.IsSnapAligned() {
-				logging.Infof("Timekeeper:: %v %v Forcing Overdue Commit", streamId, bucket)
+				tk.logCtx(streamId, bucket).Infof("Timekeeper:: %v %v Forcing Overdue Commit", streamId, bucket)
 				tsVbuuid.SetSnapType(common.FORCE_COMMIT)
 				tk.ss.streamBucketLastPersistTime[streamId][bucket] = time.Now()
 				tk.sendNewStabilityTS(tsVbuuid, bucket, streamId)
 			}
 		}
+
+		//all received mutations have been flushed, let storage manager
+		//refresh the snapshots so that their age doesn't grow while idle
+		if tk.ss.checkBucketIdle(streamId, bucket) {
+			tk.sendBucketIdle(streamId, bucket)
+		}
 	}
 
 }
@@ -2032,6 +2052,123 @@ func (tk *timekeeper) processPendingTS(streamId common.StreamId, bucket string)
 	return false
 }
 
+//sendBucketIdle notifies supervisor that the stream-bucket has no
+//pending mutations to be flushed
+func (tk *timekeeper) sendBucketIdle(streamId common.StreamId, bucket string) {
+
+	var ts *common.TsVbuuid
+	if lts := tk.ss.streamBucketLastFlushedTsMap[streamId][bucket]; lts != nil {
+		ts = lts.Copy()
+	}
+
+	go func() {
+		tk.supvRespch <- &MsgTKBucketIdle{streamId: streamId,
+			bucket: bucket,
+			ts:     ts}
+	}()
+}
+
+//handleOnDemandSnapshot records the ts a scan is waiting for, so that
+//a snapshot is created as soon as the flushed mutations satisfy it,
+//instead of at the next snapshot interval.
+func (tk *timekeeper) handleOnDemandSnapshot(cmd Message) {
+
+	tk.supvCmdch <- &MsgSuccess{}
+
+	if !tk.config["settings.on_demand_snapshot"].Bool() {
+		return
+	}
+
+	streamId := cmd.(*MsgTKOnDemandSnapshot).GetStreamId()
+	bucket := cmd.(*MsgTKOnDemandSnapshot).GetBucket()
+	ts := cmd.(*MsgTKOnDemandSnapshot).GetTimestamp()
+
+	tk.lock.Lock()
+
+	if status, ok := tk.ss.streamBucketStatus[streamId][bucket]; !ok || status != STREAM_ACTIVE {
+		tk.lock.Unlock()
+		return
+	}
+
+	tk.ss.addSnapWanted(streamId, bucket, ts)
+	sent := tk.maybeSendOnDemandSnapshot(streamId, bucket)
+
+	tk.lock.Unlock()
+
+	//mutations the scan is waiting for are yet to be flushed, generate
+	//the next stability ts right away rather than on the next tick.
+	if !sent {
+		tk.generateNewStabilityTS(streamId, bucket)
+	}
+}
+
+//maybeSendOnDemandSnapshot sends the last flushed TS to be snapshotted,
+//if it was flushed without a snapshot and a scan is waiting for it.
+//Returns true if the TS was sent.
+func (tk *timekeeper) maybeSendOnDemandSnapshot(streamId common.StreamId,
+	bucket string) bool {
+
+	if tk.indexerState != common.INDEXER_ACTIVE ||
+		tk.ss.streamBucketStatus[streamId][bucket] != STREAM_ACTIVE {
+		return false
+	}
+
+	if !tk.config["settings.on_demand_snapshot"].Bool() ||
+		!tk.ss.canFlushNewTS(streamId, bucket) {
+		return false
+	}
+
+	lts := tk.ss.streamBucketLastFlushedTsMap[streamId][bucket]
+	if lts == nil || lts.GetSnapType() != common.NO_SNAP ||
+		!tk.ss.checkSnapWanted(streamId, bucket, lts) {
+		return false
+	}
+
+	flushTs := lts.Copy()
+	flushTs.SetSnapType(common.INMEM_SNAP)
+	tk.addOnDemandSnapshotStat(bucket)
+
+	logging.LazyTrace(func() string {
+		return fmt.Sprintf("Timekeeper::maybeSendOnDemandSnapshot Bucket: %v "+
+			"Stream: %v TS: %v", bucket, streamId, flushTs)
+	})
+
+	tk.ss.streamBucketFlushInProgressTsMap[streamId][bucket] = flushTs
+
+	go func() {
+		tk.supvRespch <- &MsgTKStabilityTS{ts: flushTs,
+			bucket:   bucket,
+			streamId: streamId,
+			onDemand: true}
+	}()
+
+	return true
+}
+
+//isOnDemandSnapshot returns true if a snapshot of flushTs is to be
+//created as a scan is waiting for it
+func (tk *timekeeper) isOnDemandSnapshot(streamId common.StreamId,
+	bucket string, flushTs *common.TsVbuuid) bool {
+
+	if !tk.config["settings.on_demand_snapshot"].Bool() ||
+		!tk.ss.checkSnapWanted(streamId, bucket, flushTs) {
+		return false
+	}
+
+	tk.addOnDemandSnapshotStat(bucket)
+	return true
+}
+
+func (tk *timekeeper) addOnDemandSnapshotStat(bucket string) {
+	stats := tk.stats.Get()
+	if stats == nil {
+		return
+	}
+	if stat, ok := stats.buckets[bucket]; ok {
+		stat.numOnDemandSnapshots.Add(1)
+	}
+}
+
 //sendNewStabilityTS sends the given TS to supervisor
 func (tk *timekeeper) sendNewStabilityTS(flushTs *common.TsVbuuid, bucket string,
 	streamId common.StreamId) {
@@ -2080,7 +2217,7 @@ func (tk *timekeeper) sendNewStabilityTS(flushTs *common.TsVbuuid, bucket string
 					if totalWait > 300 {
 						lastFlushedTs := tk.ss.streamBucketLastFlushedTsMap[streamId][bucket]
 						hwt := tk.ss.streamBucketHWTMap[streamId][bucket]
-						logging.Warnf("Timekeeper::flushMonitor Waiting For Flush "+
+						tk.logCtx(streamId, bucket).Sampled().Warnf("Timekeeper::flushMonitor Waiting For Flush "+
 							"to finish for %v seconds. FlushTs %v \n LastFlushTs %v \n HWT %v", totalWait,
 							flushTs, lastFlushedTs, hwt)
 					}
@@ -2152,7 +2289,8 @@ func (tk *timekeeper) setSnapshotType(streamId common.StreamId, bucket string,
 				//if fast flush mode is enabled, skip in-mem snapshots based
 				//on number of pending ts to be processed.
 				skipFactor := tk.calcSkipFactorForFastFlush(streamId, bucket)
-				if skipFactor != 0 && (tk.ss.streamBucketSkippedInMemTs[streamId][bucket] < skipFactor) {
+				if skipFactor != 0 && (tk.ss.streamBucketSkippedInMemTs[streamId][bucket] < skipFactor) &&
+					!tk.isOnDemandSnapshot(streamId, bucket, flushTs) {
 					tk.ss.streamBucketSkippedInMemTs[streamId][bucket]++
 					flushTs.SetSnapType(common.NO_SNAP)
 				} else {
@@ -2800,6 +2938,13 @@ func (tk *timekeeper) handleStats(cmd Message) {
 				}
 			}
 
+			collReceived := uint64(0)
+			if cid, err := common.ParseCollectionId(inst.Defn.CollectionId); err == nil {
+				for _, seqno := range tk.ss.getCollectionHWT(inst.Stream, inst.Defn.Bucket, cid) {
+					collReceived += uint64(seqno)
+				}
+			}
+
 			pending := uint64(0)
 			kvTs := bucketTsMap[inst.Defn.Bucket]
 			for i, seqno := range kvTs {
@@ -2836,6 +2981,7 @@ func (tk *timekeeper) handleStats(cmd Message) {
 			if idxStats != nil {
 				idxStats.numDocsProcessed.Set(int64(flushedCount))
 				idxStats.numDocsQueued.Set(int64(queued))
+				idxStats.collectionSeqnos.Set(int64(collReceived))
 				idxStats.numDocsPending.Set(int64(pending))
 				idxStats.buildProgress.Set(int64(v))
 			}
@@ -2899,7 +3045,7 @@ func (tk *timekeeper) checkPendingStreamMerge(streamId common.StreamId,
 func (tk *timekeeper) startTimer(streamId common.StreamId,
 	bucket string) {
 
-	logging.Infof("Timekeeper::startTimer %v %v", streamId, bucket)
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::startTimer %v %v", streamId, bucket)
 
 	snapInterval := tk.getInMemSnapInterval()
 	ticker := time.NewTicker(time.Millisecond * time.Duration(snapInterval))
@@ -2923,7 +3069,7 @@ func (tk *timekeeper) startTimer(streamId common.StreamId,
 //stopTimer stops the stream/bucket timer started by startTimer
 func (tk *timekeeper) stopTimer(streamId common.StreamId, bucket string) {
 
-	logging.Infof("Timekeeper::stopTimer %v %v", streamId, bucket)
+	tk.logCtx(streamId, bucket).Infof("Timekeeper::stopTimer %v %v", streamId, bucket)
 
 	stopCh := tk.ss.streamBucketTimerStopCh[streamId][bucket]
 	if stopCh != nil {
@@ -3143,3 +3289,12 @@ func (tk *timekeeper) setNeedsCommit(streamId common.StreamId,
 	}
 
 }
+
+//logCtx returns the structured log context for stream/bucket
+func (tk *timekeeper) logCtx(streamId common.StreamId, bucket string) *logging.Context {
+	return logging.NewContext("", logging.Fields{
+		logging.FieldComponent: "Timekeeper",
+		logging.FieldStreamId:  streamId.String(),
+		logging.FieldBucket:    bucket,
+	})
+}
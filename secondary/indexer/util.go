@@ -15,6 +15,7 @@ import (
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"net"
+	"path/filepath"
 	"time"
 )
 
@@ -72,6 +73,17 @@ func IndexPath(inst *common.IndexInst, sliceId SliceId) string {
 	return fmt.Sprintf("%s_%s_%d_%d.index", inst.Defn.Bucket, inst.Defn.Name, inst.InstId, sliceId)
 }
 
+//FindIndexPath finds the data of an index slice stored under a previous name
+//of the index. The index instance id does not change when an index is renamed.
+func FindIndexPath(dir string, inst *common.IndexInst, sliceId SliceId) (string, bool) {
+	pattern := fmt.Sprintf("%s_*_%d_%d.index", inst.Defn.Bucket, inst.InstId, sliceId)
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil || len(matches) == 0 {
+		return "", false
+	}
+	return matches[0], true
+}
+
 func GetCurrentKVTs(cluster, pooln, bucketn string, numVbs int) (Timestamp, error) {
 
 	var seqnos []uint64
@@ -117,6 +117,7 @@ func Level(s string) LogLevel {
 
 type destination struct {
 	baselevel LogLevel
+	format    LogFormat
 	target    *l.Logger
 }
 
@@ -228,6 +229,10 @@ func (log *destination) IsEnabled(at LogLevel) bool {
 
 func (log *destination) printf(at LogLevel, format string, v ...interface{}) {
 	if log.IsEnabled(at) {
+		if log.format == JsonFormat {
+			log.record(at, nil, fmt.Sprintf(format, v...))
+			return
+		}
 		ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
 		log.target.Printf(ts+" ["+at.String()+"] "+format, v...)
 	}
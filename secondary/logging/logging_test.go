@@ -2,11 +2,11 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
-	"regexp"
 	"strings"
 	"testing"
-	"time"
 )
 
 var buffer *bytes.Buffer
@@ -142,6 +142,65 @@ func TestSystemLog(t *testing.T) {
 	SetLogWriter(os.Stdout)
 }
 
+func TestJsonFormat(t *testing.T) {
+	buffer.Reset()
+	SetLogWriter(buffer)
+	SetLogFormat(JsonFormat)
+	ctx := NewContext("SCAN##1", Fields{FieldBucket: "default"})
+	ctx.With(FieldRequestId, "req1").Infof("rows:%d", 10)
+	Infof("plain")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %v", lines)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("invalid record %v: %v", lines[0], err)
+	}
+	if rec["msg"] != "rows:10" || rec["level"] != "Info" ||
+		rec[FieldBucket] != "default" || rec[FieldRequestId] != "req1" {
+		t.Errorf("unexpected record %v", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil || rec["msg"] != "plain" {
+		t.Errorf("unexpected record %v", lines[1])
+	}
+	SetLogWriter(os.Stdout)
+}
+
+func TestContextText(t *testing.T) {
+	buffer.Reset()
+	SetLogWriter(buffer)
+	NewContext("SCAN##1", Fields{FieldBucket: "default"}).Infof("rows:%d", 10)
+	if s := buffer.String(); !strings.Contains(s, "[Info] SCAN##1 rows:10") {
+		t.Errorf("unexpected output %v", s)
+	}
+	SetLogWriter(os.Stdout)
+}
+
+func TestSampling(t *testing.T) {
+	buffer.Reset()
+	SetLogWriter(buffer)
+	SetSampling(2, 3)
+	defer SetSampling(0, 1)
+
+	ctx := NewContext("", nil).Sampled()
+	for i := 0; i < 8; i++ {
+		ctx.Infof("hot %d", i)
+	}
+	s := buffer.String()
+	// first 2 are logged, then every 3rd
+	for _, i := range []int{0, 1, 4, 7} {
+		if !strings.Contains(s, fmt.Sprintf("hot %d", i)) {
+			t.Errorf("expected message %d in %v", i, s)
+		}
+	}
+	if strings.Contains(s, "hot 2") || !strings.Contains(s, "2 similar messages dropped") {
+		t.Errorf("unexpected sampling %v", s)
+	}
+	SetLogWriter(os.Stdout)
+}
+
 func TestStackTheTrace(t *testing.T) {
 	buffer.Reset()
 	SetLogWriter(buffer)
@@ -0,0 +1,326 @@
+package logging
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "sort"
+import "strings"
+import "sync"
+import "time"
+
+// Structured logging
+//
+// In json format every log message is emitted as a single line JSON
+// record of the form,
+//
+//   {"ts":"...","level":"Info","msg":"...","bucket":"default",...}
+//
+// Request scoped fields like request-id, bucket, index-instance and
+// stream-id are carried by a Context, which is created once per request,
+// stream or feed and used in place of the package level log functions.
+// In text format a Context logs exactly like the package level functions,
+// with its prefix prepended to the message.
+
+// LogFormat is the output format of logger.
+type LogFormat int16
+
+const (
+	TextFormat LogFormat = iota
+	JsonFormat
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	case JsonFormat:
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// Format parses log format, defaults to text.
+func Format(s string) LogFormat {
+	switch strings.ToLower(s) {
+	case "json":
+		return JsonFormat
+	default:
+		return TextFormat
+	}
+}
+
+// Well known field names, used by tools/logd to query records.
+const (
+	FieldComponent = "component"
+	FieldRequestId = "requestId"
+	FieldScanId    = "scanId"
+	FieldBucket    = "bucket"
+	FieldIndex     = "index"
+	FieldInstId    = "instId"
+	FieldStreamId  = "streamId"
+	FieldTopic     = "topic"
+	FieldDropped   = "dropped"
+)
+
+// Fields are key/value pairs attached to a structured log record.
+type Fields map[string]interface{}
+
+// Context logs messages with a fixed set of fields. A nil context logs
+// like the package level functions.
+type Context struct {
+	prefix  string
+	fields  Fields
+	sampler *Sampler
+}
+
+// NewContext returns a context logging with prefix in text format and
+// with fields in json format.
+func NewContext(prefix string, fields Fields) *Context {
+	return &Context{prefix: prefix, fields: fields}
+}
+
+// WithFields returns a context having fields in addition to those of ctx.
+func (ctx *Context) WithFields(fields Fields) *Context {
+	if ctx == nil {
+		ctx = &Context{}
+	}
+	nfields := make(Fields, len(ctx.fields)+len(fields))
+	for k, v := range ctx.fields {
+		nfields[k] = v
+	}
+	for k, v := range fields {
+		nfields[k] = v
+	}
+	return &Context{prefix: ctx.prefix, fields: nfields, sampler: ctx.sampler}
+}
+
+// With returns a context having field key in addition to those of ctx.
+func (ctx *Context) With(key string, value interface{}) *Context {
+	return ctx.WithFields(Fields{key: value})
+}
+
+// Sampled returns a context whose messages are rate limited by the
+// system sampler, meant for hot paths. See SetSampling.
+func (ctx *Context) Sampled() *Context {
+	if ctx == nil {
+		ctx = &Context{}
+	}
+	return &Context{prefix: ctx.prefix, fields: ctx.fields, sampler: SystemSampler}
+}
+
+// Prefix returns the text format prefix of this context.
+func (ctx *Context) Prefix() string {
+	if ctx == nil {
+		return ""
+	}
+	return ctx.prefix
+}
+
+func (ctx *Context) Fatalf(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Fatal, format, v...)
+}
+
+func (ctx *Context) Errorf(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Error, format, v...)
+}
+
+func (ctx *Context) Warnf(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Warn, format, v...)
+}
+
+func (ctx *Context) Infof(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Info, format, v...)
+}
+
+func (ctx *Context) Verbosef(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Verbose, format, v...)
+}
+
+func (ctx *Context) Debugf(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Debug, format, v...)
+}
+
+func (ctx *Context) Tracef(format string, v ...interface{}) {
+	SystemLogger.ctxprintf(ctx, Trace, format, v...)
+}
+
+// Run function only if output will be logged at verbose level
+func (ctx *Context) LazyVerbose(fn func() string) {
+	if SystemLogger.IsEnabled(Verbose) {
+		SystemLogger.ctxprintf(ctx, Verbose, "%s", fn())
+	}
+}
+
+// Run function only if output will be logged at debug level
+func (ctx *Context) LazyDebug(fn func() string) {
+	if SystemLogger.IsEnabled(Debug) {
+		SystemLogger.ctxprintf(ctx, Debug, "%s", fn())
+	}
+}
+
+// Run function only if output will be logged at trace level
+func (ctx *Context) LazyTrace(fn func() string) {
+	if SystemLogger.IsEnabled(Trace) {
+		SystemLogger.ctxprintf(ctx, Trace, "%s", fn())
+	}
+}
+
+func (log *destination) ctxprintf(ctx *Context, at LogLevel, format string, v ...interface{}) {
+	if !log.IsEnabled(at) {
+		return
+	} else if ctx == nil {
+		log.printf(at, format, v...)
+		return
+	}
+
+	var dropped uint64
+	if ctx.sampler != nil {
+		var ok bool
+		if ok, dropped = ctx.sampler.allow(format); !ok {
+			return
+		}
+	}
+
+	if log.format == JsonFormat {
+		fields := ctx.fields
+		if dropped > 0 {
+			fields = ctx.WithFields(Fields{FieldDropped: dropped}).fields
+		}
+		log.record(at, fields, fmt.Sprintf(format, v...))
+		return
+	}
+
+	if ctx.prefix != "" {
+		format = ctx.prefix + " " + format
+	}
+	if dropped > 0 {
+		format = fmt.Sprintf("%s (%d similar messages dropped)", format, dropped)
+	}
+	log.printf(at, format, v...)
+}
+
+// record writes a single json log record.
+func (log *destination) record(at LogLevel, fields Fields, msg string) {
+	var buf bytes.Buffer
+	ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
+
+	buf.WriteString(`{"ts":`)
+	writeJson(&buf, ts)
+	buf.WriteString(`,"level":`)
+	writeJson(&buf, at.String())
+	buf.WriteString(`,"msg":`)
+	writeJson(&buf, strings.TrimRight(msg, "\n"))
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteByte(',')
+		writeJson(&buf, k)
+		buf.WriteByte(':')
+		writeJson(&buf, fields[k])
+	}
+	buf.WriteByte('}')
+
+	log.target.Print(buf.String())
+}
+
+func writeJson(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+	buf.Write(data)
+}
+
+// Sampler limits the rate of log messages from hot paths. In every
+// interval, first `first` messages of a format are logged, and thereafter
+// every `thereafter`-th message. Number of messages dropped since the
+// last logged one is reported along with it.
+type Sampler struct {
+	mu         sync.Mutex
+	first      uint64
+	thereafter uint64
+	interval   time.Duration
+	counts     map[string]*sampleCount
+}
+
+type sampleCount struct {
+	start   time.Time
+	n       uint64
+	dropped uint64
+}
+
+// NewSampler returns a sampler, first <= 0 disables sampling.
+func NewSampler(first, thereafter int, interval time.Duration) *Sampler {
+	s := &Sampler{counts: make(map[string]*sampleCount)}
+	s.Reset(first, thereafter, interval)
+	return s
+}
+
+// Reset changes the sampling rate.
+func (s *Sampler) Reset(first, thereafter int, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if first < 0 {
+		first = 0
+	}
+	if thereafter < 1 {
+		thereafter = 1
+	}
+	s.first, s.thereafter, s.interval = uint64(first), uint64(thereafter), interval
+	s.counts = make(map[string]*sampleCount)
+}
+
+func (s *Sampler) allow(key string) (bool, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.first == 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	c, ok := s.counts[key]
+	if !ok {
+		c = &sampleCount{start: now}
+		s.counts[key] = c
+	} else if now.Sub(c.start) >= s.interval {
+		c.start, c.n = now, 0
+	}
+
+	c.n++
+	if c.n <= s.first || (c.n-s.first)%s.thereafter == 0 {
+		dropped := c.dropped
+		c.dropped = 0
+		return true, dropped
+	}
+	c.dropped++
+	return false, 0
+}
+
+// The default sampler used by sampled contexts, disabled by default.
+var SystemSampler = NewSampler(0, 1, time.Second)
+
+// SetSampling sets per-second sampling rate of sampled contexts,
+// first <= 0 disables sampling.
+func SetSampling(first, thereafter int) {
+	SystemSampler.Reset(first, thereafter, time.Second)
+}
+
+// Set the log output format
+func SetLogFormat(to LogFormat) {
+	SystemLogger.SetLogFormat(to)
+}
+
+// Set the log output format
+func (log *destination) SetLogFormat(to LogFormat) {
+	log.format = to
+}
+
+// WithFields returns a context logging to default logger with fields.
+func WithFields(fields Fields) *Context {
+	return NewContext("", fields)
+}
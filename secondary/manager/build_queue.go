@@ -0,0 +1,224 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"encoding/json"
+	"github.com/couchbase/indexing/secondary/common"
+	"sort"
+)
+
+///////////////////////////////////////////////////////
+// Type Definition
+///////////////////////////////////////////////////////
+
+//
+// Index builds that cannot start right away, because another index of the
+// bucket is being built or the node is at its build limit, wait in the
+// build queue.  The queue is persisted in the metadata repository, so it
+// survives indexer restart.  Entries are ordered by priority (higher first),
+// then by the order they are queued.
+//
+type BuildQueue struct {
+	Seqno   uint64             `json:"seqno,omitempty"`
+	Entries []*BuildQueueEntry `json:"entries,omitempty"`
+}
+
+type BuildQueueEntry struct {
+	DefnId   common.IndexDefnId `json:"defnId,omitempty"`
+	Bucket   string             `json:"bucket,omitempty"`
+	Priority int                `json:"priority,omitempty"`
+	Seqno    uint64             `json:"seqno,omitempty"`
+	QueuePos int                `json:"queuePos,omitempty"` // position in the full queue, if filtered by bucket
+}
+
+type buildQueueSorter []*BuildQueueEntry
+
+///////////////////////////////////////////////////////
+// Public Function
+///////////////////////////////////////////////////////
+
+//
+// Add an index to the queue.  Return false if the index is already queued.
+//
+func (q *BuildQueue) Add(defn *common.IndexDefn) bool {
+
+	if q.Position(defn.DefnId) != 0 {
+		return false
+	}
+
+	q.Seqno++
+	q.Entries = append(q.Entries, &BuildQueueEntry{
+		DefnId:   defn.DefnId,
+		Bucket:   defn.Bucket,
+		Priority: defn.BuildPriority,
+		Seqno:    q.Seqno,
+	})
+	sort.Stable(buildQueueSorter(q.Entries))
+
+	return true
+}
+
+//
+// Remove an index from the queue.  Return false if the index is not queued.
+//
+func (q *BuildQueue) Remove(defnId common.IndexDefnId) bool {
+
+	for i, entry := range q.Entries {
+		if entry.DefnId == defnId {
+			q.Entries = append(q.Entries[:i], q.Entries[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+//
+// Position (starting from 1) of the index in the queue, or 0 if the index is not queued.
+//
+func (q *BuildQueue) Position(defnId common.IndexDefnId) int {
+
+	for i, entry := range q.Entries {
+		if entry.DefnId == defnId {
+			if entry.QueuePos != 0 {
+				return entry.QueuePos
+			}
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+//
+// Select the queued indexes that can start building.  Indexer allows one initial build
+// stream per bucket, so a bucket with an index being built is skipped, and queued indexes
+// of the same bucket are batched into one build.   A batch takes at most bucketLimit
+// indexes, and no more indexes are started once nodeLimit indexes are being built on
+// the node.  A limit of 0 means no limit.  building is the number of indexes being built
+// per bucket.
+//
+func (q *BuildQueue) Schedule(bucketLimit int, nodeLimit int, building map[string]int) [][]*BuildQueueEntry {
+
+	budget := -1
+	if nodeLimit > 0 {
+		budget = nodeLimit
+		for _, count := range building {
+			budget -= count
+		}
+		if budget <= 0 {
+			return nil
+		}
+	}
+
+	var batches [][]*BuildQueueEntry
+	scheduled := make(map[string]bool)
+
+	for _, head := range q.Entries {
+
+		if budget == 0 {
+			break
+		}
+
+		if building[head.Bucket] != 0 || scheduled[head.Bucket] {
+			continue
+		}
+		scheduled[head.Bucket] = true
+
+		var batch []*BuildQueueEntry
+		for _, entry := range q.Entries {
+			if entry.Bucket != head.Bucket {
+				continue
+			}
+			if budget == 0 || (bucketLimit > 0 && len(batch) >= bucketLimit) {
+				break
+			}
+
+			batch = append(batch, entry)
+			if budget > 0 {
+				budget--
+			}
+		}
+
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+///////////////////////////////////////////////////////
+// private function
+///////////////////////////////////////////////////////
+
+func (q *BuildQueue) clone() *BuildQueue {
+
+	result := &BuildQueue{Seqno: q.Seqno}
+	for _, entry := range q.Entries {
+		e := *entry
+		result.Entries = append(result.Entries, &e)
+	}
+
+	return result
+}
+
+//
+// Return the entries of the bucket, keeping their position in the full queue.
+//
+func (q *BuildQueue) filter(bucket string) *BuildQueue {
+
+	result := &BuildQueue{Seqno: q.Seqno}
+	for i, entry := range q.Entries {
+		if entry.Bucket == bucket {
+			e := *entry
+			if e.QueuePos == 0 {
+				e.QueuePos = i + 1
+			}
+			result.Entries = append(result.Entries, &e)
+		}
+	}
+
+	return result
+}
+
+func marshallBuildQueue(queue *BuildQueue) ([]byte, error) {
+
+	buf, err := json.Marshal(&queue)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func unmarshallBuildQueue(data []byte) (*BuildQueue, error) {
+
+	queue := new(BuildQueue)
+	if err := json.Unmarshal(data, queue); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+func (s buildQueueSorter) Len() int {
+	return len(s)
+}
+
+func (s buildQueueSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s buildQueueSorter) Less(i, j int) bool {
+	if s[i].Priority != s[j].Priority {
+		return s[i].Priority > s[j].Priority
+	}
+	return s[i].Seqno < s[j].Seqno
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+type testQueuedIndex struct {
+	id       common.IndexDefnId
+	bucket   string
+	priority int
+}
+
+func newTestBuildQueue(indexes ...testQueuedIndex) *BuildQueue {
+	queue := new(BuildQueue)
+	for _, index := range indexes {
+		queue.Add(&common.IndexDefn{DefnId: index.id, Bucket: index.bucket, BuildPriority: index.priority})
+	}
+	return queue
+}
+
+// formatBatches returns scheduled batches as "bucket:id,id" strings.
+func formatBatches(batches [][]*BuildQueueEntry) []string {
+	var result []string
+	for _, batch := range batches {
+		s := batch[0].Bucket + ":"
+		for i, entry := range batch {
+			if i != 0 {
+				s += ","
+			}
+			s += fmt.Sprintf("%v", entry.DefnId)
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestBuildQueueOrder(t *testing.T) {
+	queue := newTestBuildQueue(
+		testQueuedIndex{1, "b1", 0},
+		testQueuedIndex{2, "b1", 5},
+		testQueuedIndex{3, "b2", 0},
+		testQueuedIndex{4, "b2", 5},
+		testQueuedIndex{5, "b1", -1},
+	)
+
+	//higher priority first, FIFO among same priority
+	expected := []common.IndexDefnId{2, 4, 1, 3, 5}
+	for i, id := range expected {
+		if pos := queue.Position(id); pos != i+1 {
+			t.Errorf("expected index %v at position %v, got %v", id, i+1, pos)
+		}
+	}
+
+	if queue.Add(&common.IndexDefn{DefnId: 1, Bucket: "b1", BuildPriority: 10}) {
+		t.Errorf("expected index already queued")
+	}
+	if queue.Position(1) != 3 {
+		t.Errorf("expected position unchanged, got %v", queue.Position(1))
+	}
+
+	if !queue.Remove(4) || queue.Remove(4) {
+		t.Errorf("expected index 4 removed once")
+	}
+	if queue.Position(4) != 0 || queue.Position(1) != 2 || queue.Position(5) != 4 {
+		t.Errorf("unexpected positions after remove %v %v %v",
+			queue.Position(4), queue.Position(1), queue.Position(5))
+	}
+
+	//seqno keeps FIFO order of an index queued after a remove
+	queue.Add(&common.IndexDefn{DefnId: 4, Bucket: "b2"})
+	if queue.Position(4) != 4 {
+		t.Errorf("expected re-queued index after earlier ones, got %v", queue.Position(4))
+	}
+
+	buf, err := marshallBuildQueue(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, err := unmarshallBuildQueue(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.Seqno != queue.Seqno || len(clone.Entries) != len(queue.Entries) {
+		t.Fatalf("unexpected queue %v after unmarshall", clone)
+	}
+	for i := range clone.Entries {
+		if *clone.Entries[i] != *queue.Entries[i] {
+			t.Errorf("expected entry %v, got %v", queue.Entries[i], clone.Entries[i])
+		}
+	}
+}
+
+func TestBuildQueueSchedule(t *testing.T) {
+	queued := []testQueuedIndex{
+		{1, "b1", 0},
+		{2, "b2", 0},
+		{3, "b1", 0},
+		{4, "b3", 0},
+		{5, "b2", 0},
+		{6, "b1", 0},
+	}
+
+	tests := []struct {
+		name        string
+		queued      []testQueuedIndex
+		bucketLimit int
+		nodeLimit   int
+		building    map[string]int
+		expected    []string
+	}{
+		{"empty queue", nil, 0, 0, nil, nil},
+		{"no limit", queued, 0, 0, nil, []string{"b1:1,3,6", "b2:2,5", "b3:4"}},
+		{"bucket limit", queued, 2, 0, nil, []string{"b1:1,3", "b2:2,5", "b3:4"}},
+		{"bucket limit 1", queued, 1, 0, nil, []string{"b1:1", "b2:2", "b3:4"}},
+		{"node limit", queued, 0, 4, nil, []string{"b1:1,3,6", "b2:2"}},
+		{"node and bucket limit", queued, 2, 4, nil, []string{"b1:1,3", "b2:2,5"}},
+		{"node limit within batch", queued, 0, 2, nil, []string{"b1:1,3"}},
+		{"bucket building", queued, 0, 0, map[string]int{"b1": 1}, []string{"b2:2,5", "b3:4"}},
+		{"node budget", queued, 0, 3, map[string]int{"b1": 1}, []string{"b2:2,5"}},
+		{"node budget of other bucket", queued, 0, 4, map[string]int{"b4": 2}, []string{"b1:1,3"}},
+		{"node full", queued, 0, 2, map[string]int{"b4": 2}, nil},
+		{"node over limit", queued, 0, 2, map[string]int{"b4": 3}, nil},
+		{"all buckets building", queued, 0, 0, map[string]int{"b1": 1, "b2": 1, "b3": 1}, nil},
+		{"priority", []testQueuedIndex{{1, "b1", 0}, {2, "b2", 0}, {3, "b2", 1}, {4, "b1", 2}},
+			0, 0, nil, []string{"b1:4,1", "b2:3,2"}},
+		{"priority within bucket limit", []testQueuedIndex{{1, "b1", 0}, {2, "b1", 0}, {3, "b1", 1}},
+			2, 0, nil, []string{"b1:3,1"}},
+		{"priority within node limit", []testQueuedIndex{{1, "b1", 0}, {2, "b2", 1}, {3, "b3", 0}},
+			0, 2, nil, []string{"b2:2", "b1:1"}},
+		{"FIFO ties", []testQueuedIndex{{3, "b1", 1}, {1, "b1", 1}, {2, "b1", 1}},
+			2, 0, nil, []string{"b1:3,1"}},
+	}
+
+	for _, test := range tests {
+		queue := newTestBuildQueue(test.queued...)
+		result := formatBatches(queue.Schedule(test.bucketLimit, test.nodeLimit, test.building))
+		if fmt.Sprint(result) != fmt.Sprint(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, result)
+		}
+		//schedule does not change the queue
+		if len(queue.Entries) != len(test.queued) {
+			t.Errorf("%v: expected %v queued, got %v", test.name, len(test.queued), len(queue.Entries))
+		}
+	}
+}
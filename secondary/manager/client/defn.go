@@ -21,15 +21,20 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 const (
-	OPCODE_CREATE_INDEX      common.OpCode = common.OPCODE_CUSTOM + 1
-	OPCODE_DROP_INDEX                      = OPCODE_CREATE_INDEX + 1
-	OPCODE_BUILD_INDEX                     = OPCODE_DROP_INDEX + 1
-	OPCODE_UPDATE_INDEX_INST               = OPCODE_BUILD_INDEX + 1
-	OPCODE_SERVICE_MAP                     = OPCODE_UPDATE_INDEX_INST + 1
-	OPCODE_DELETE_BUCKET                   = OPCODE_SERVICE_MAP + 1
-	OPCODE_INDEXER_READY                   = OPCODE_DELETE_BUCKET + 1
-	OPCODE_CLEANUP_INDEX                   = OPCODE_INDEXER_READY + 1
-	OPCODE_CLEANUP_DEFER_INDEX             = OPCODE_CLEANUP_INDEX + 1
+	OPCODE_CREATE_INDEX         common.OpCode = common.OPCODE_CUSTOM + 1
+	OPCODE_DROP_INDEX                         = OPCODE_CREATE_INDEX + 1
+	OPCODE_BUILD_INDEX                        = OPCODE_DROP_INDEX + 1
+	OPCODE_UPDATE_INDEX_INST                  = OPCODE_BUILD_INDEX + 1
+	OPCODE_SERVICE_MAP                        = OPCODE_UPDATE_INDEX_INST + 1
+	OPCODE_DELETE_BUCKET                      = OPCODE_SERVICE_MAP + 1
+	OPCODE_INDEXER_READY                      = OPCODE_DELETE_BUCKET + 1
+	OPCODE_CLEANUP_INDEX                      = OPCODE_INDEXER_READY + 1
+	OPCODE_CLEANUP_DEFER_INDEX                = OPCODE_CLEANUP_INDEX + 1
+	OPCODE_PAUSE_BUILD_INDEX                  = OPCODE_CLEANUP_DEFER_INDEX + 1
+	OPCODE_CANCEL_BUILD_INDEX                 = OPCODE_PAUSE_BUILD_INDEX + 1
+	OPCODE_ALTER_INDEX                        = OPCODE_CANCEL_BUILD_INDEX + 1
+	OPCODE_ROLLBACK_ALTER_INDEX               = OPCODE_ALTER_INDEX + 1
+	OPCODE_RENAME_INDEX                       = OPCODE_ROLLBACK_ALTER_INDEX + 1
 )
 
 /////////////////////////////////////////////////////////////////////////
@@ -47,10 +52,15 @@ type IndexTopology struct {
 }
 
 type IndexDefnDistribution struct {
-	Bucket    string                  `json:"bucket,omitempty"`
-	Name      string                  `json:"name,omitempty"`
-	DefnId    uint64                  `json:"defnId,omitempty"`
-	Instances []IndexInstDistribution `json:"instances,omitempty"`
+	Bucket          string                  `json:"bucket,omitempty"`
+	Scope           string                  `json:"scope,omitempty"`
+	Collection      string                  `json:"collection,omitempty"`
+	Name            string                  `json:"name,omitempty"`
+	DefnId          uint64                  `json:"defnId,omitempty"`
+	ShadowOf        uint64                  `json:"shadowOf,omitempty"`
+	RollbackOnError bool                    `json:"rollbackOnError,omitempty"`
+	Aliases         []uint64                `json:"aliases,omitempty"`
+	Instances       []IndexInstDistribution `json:"instances,omitempty"`
 }
 
 type IndexInstDistribution struct {
@@ -59,6 +69,7 @@ type IndexInstDistribution struct {
 	StreamId   uint32                  `json:"streamId,omitempty"`
 	Error      string                  `json:"error,omitempty"`
 	BuildTime  []uint64                `json:"buildTime,omitempty"`
+	Paused     bool                    `json:"paused,omitempty"`
 	Partitions []IndexPartDistribution `json:"partitions,omitempty"`
 }
 
@@ -91,6 +102,16 @@ type IndexIdList struct {
 	DefnIds []uint64 `json:"defnIds,omitempty"`
 }
 
+/////////////////////////////////////////////////////////////////////////
+// Alter Index
+////////////////////////////////////////////////////////////////////////
+
+type AlterIndexRequest struct {
+	DefnId   uint64       `json:"defnId,omitempty"`
+	Shadow   *c.IndexDefn `json:"shadow,omitempty"`
+	Rollback bool         `json:"rollback,omitempty"`
+}
+
 /////////////////////////////////////////////////////////////////////////
 // Service Map
 ////////////////////////////////////////////////////////////////////////
@@ -156,6 +177,26 @@ func MarshallIndexIdList(list *IndexIdList) ([]byte, error) {
 	return buf, nil
 }
 
+func UnmarshallAlterIndexRequest(data []byte) (*AlterIndexRequest, error) {
+
+	request := new(AlterIndexRequest)
+	if err := json.Unmarshal(data, request); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func MarshallAlterIndexRequest(request *AlterIndexRequest) ([]byte, error) {
+
+	buf, err := json.Marshal(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
 func UnmarshallServiceMap(data []byte) (*ServiceMap, error) {
 
 	logging.Debugf("UnmarshallServiceMap: %v", string(data))
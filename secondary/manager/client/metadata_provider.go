@@ -45,6 +45,8 @@ type metadataRepo struct {
 	definitions map[c.IndexDefnId]*c.IndexDefn
 	instances   map[c.IndexDefnId]*IndexInstDistribution
 	indices     map[c.IndexDefnId]*IndexMetadata
+	shadows     map[c.IndexDefnId]bool
+	aliases     map[c.IndexDefnId]c.IndexDefnId
 	version     uint64
 	mutex       sync.RWMutex
 }
@@ -82,6 +84,7 @@ type InstanceDefn struct {
 	BuildTime []uint64
 	IndexerId c.IndexerId
 	Endpts    []c.Endpoint
+	Paused    bool
 }
 
 type event struct {
@@ -217,18 +220,24 @@ func (o *MetadataProvider) CheckIndexerStatus() []IndexerStatus {
 }
 
 func (o *MetadataProvider) CreateIndexWithPlan(
-	name, bucket, using, exprType, partnExpr, whereExpr string,
+	name, bucket, scope, collection, using, exprType, partnExpr, whereExpr string,
 	secExprs []string, isPrimary bool, plan map[string]interface{}) (c.IndexDefnId, error, bool) {
 
 	// FindIndexByName will only return valid index
-	if o.FindIndexByName(name, bucket) != nil {
+	if o.FindIndexByName(name, bucket, scope, collection) != nil {
 		return c.IndexDefnId(0), errors.New(fmt.Sprintf("Index %s already exists.", name)), false
 	}
 
 	var immutable bool = false
+	var whereImmutable bool = false
 	var deferred bool = false
 	var wait bool = true
 	var nodes []string = nil
+	var priority int = 0
+	var adaptive bool = false
+	var prefixes []string = nil
+	var maxFields int = 0
+	var maxValueSize int = 0
 
 	if plan != nil {
 		logging.Debugf("MetadataProvider:CreateIndexWithPlan(): plan %v", plan)
@@ -310,6 +319,115 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 		} else {
 			immutable = immutable2
 		}
+
+		switch w := plan["where_immutable"].(type) {
+		case bool:
+			whereImmutable = w
+		case string:
+			var err error
+			if whereImmutable, err = strconv.ParseBool(w); err != nil {
+				return c.IndexDefnId(0),
+					errors.New("Fails to create index.  Parameter where_immutable must be a boolean value of (true or false)."),
+					false
+			}
+		case nil:
+		default:
+			return c.IndexDefnId(0),
+				errors.New("Fails to create index.  Parameter where_immutable must be a boolean value of (true or false)."),
+				false
+		}
+		if whereImmutable && len(whereExpr) == 0 {
+			return c.IndexDefnId(0),
+				errors.New("Fails to create index.  Parameter where_immutable is only for index with a where clause."),
+				false
+		}
+
+		switch p := plan["build_priority"].(type) {
+		case float64:
+			priority = int(p)
+		case string:
+			var err error
+			if priority, err = strconv.Atoi(p); err != nil {
+				return c.IndexDefnId(0),
+					errors.New("Fails to create index.  Parameter build_priority must be an integer value."),
+					false
+			}
+		case nil:
+		default:
+			return c.IndexDefnId(0),
+				errors.New("Fails to create index.  Parameter build_priority must be an integer value."),
+				false
+		}
+
+		switch a := plan["adaptive"].(type) {
+		case bool:
+			adaptive = a
+		case string:
+			var err error
+			if adaptive, err = strconv.ParseBool(a); err != nil {
+				return c.IndexDefnId(0),
+					errors.New("Fails to create index.  Parameter adaptive must be a boolean value of (true or false)."),
+					false
+			}
+		case nil:
+		default:
+			return c.IndexDefnId(0),
+				errors.New("Fails to create index.  Parameter adaptive must be a boolean value of (true or false)."),
+				false
+		}
+
+		switch ps := plan["field_prefixes"].(type) {
+		case []interface{}:
+			for _, prefix := range ps {
+				if p, ok := prefix.(string); ok && len(p) > 0 {
+					prefixes = append(prefixes, p)
+				} else {
+					return c.IndexDefnId(0),
+						errors.New(fmt.Sprintf("Fails to create index.  Field prefix '%v' is not valid", prefix)),
+						false
+				}
+			}
+		case string:
+			prefixes = []string{ps}
+		case nil:
+		default:
+			return c.IndexDefnId(0),
+				errors.New("Fails to create index.  Parameter field_prefixes must be a list of field paths."),
+				false
+		}
+
+		for param, limit := range map[string]*int{"max_fields": &maxFields, "max_value_size": &maxValueSize} {
+			switch l := plan[param].(type) {
+			case float64:
+				*limit = int(l)
+			case string:
+				var err error
+				if *limit, err = strconv.Atoi(l); err != nil {
+					return c.IndexDefnId(0),
+						errors.New(fmt.Sprintf("Fails to create index.  Parameter %v must be an integer value.", param)),
+						false
+				}
+			case nil:
+			default:
+				return c.IndexDefnId(0),
+					errors.New(fmt.Sprintf("Fails to create index.  Parameter %v must be an integer value.", param)),
+					false
+			}
+			if *limit < 0 {
+				return c.IndexDefnId(0),
+					errors.New(fmt.Sprintf("Fails to create index.  Parameter %v cannot be negative.", param)),
+					false
+			}
+		}
+
+		if !adaptive && (prefixes != nil || maxFields != 0 || maxValueSize != 0) {
+			return c.IndexDefnId(0),
+				errors.New("Fails to create index.  Parameters field_prefixes, max_fields and max_value_size are only for adaptive index."),
+				false
+		}
+		if adaptive && isPrimary {
+			return c.IndexDefnId(0), errors.New("Fails to create index.  Primary index cannot be adaptive."), false
+		}
 	}
 
 	logging.Debugf("MetadataProvider:CreateIndex(): deferred_build %v sync %v nodes %v", deferred, wait, nodes)
@@ -330,21 +448,13 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 	}
 
 	// Array index related information
-	isArrayIndex := false
-	arrayExprCount := 0
-	for _, exp := range secExprs {
-		isArray, _, err := queryutil.IsArrayExpression(exp)
-		if err != nil {
-			return c.IndexDefnId(0), errors.New(fmt.Sprintf("Error in parsing expression %v : %v", exp, err)), false
-		}
-		if isArray == true {
-			isArrayIndex = isArray
-			arrayExprCount++
-		}
+	isArrayIndex, err := checkArrayIndex(secExprs)
+	if err != nil {
+		return c.IndexDefnId(0), err, false
 	}
-
-	if arrayExprCount > 1 {
-		return c.IndexDefnId(0), errors.New("Multiple expressions with ALL are found. Only one array expression is supported per index."), false
+	// adaptive index has an entry for each field of document
+	if adaptive {
+		isArrayIndex = true
 	}
 
 	idxDefn := &c.IndexDefn{
@@ -352,6 +462,8 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 		Name:            name,
 		Using:           c.IndexType(using),
 		Bucket:          bucket,
+		Scope:           scope,
+		Collection:      collection,
 		IsPrimary:       isPrimary,
 		SecExprs:        secExprs,
 		ExprType:        c.ExprType(exprType),
@@ -361,7 +473,13 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 		Deferred:        deferred,
 		Nodes:           nodes,
 		Immutable:       immutable,
-		IsArrayIndex:    isArrayIndex}
+		WhereImmutable:  whereImmutable,
+		IsArrayIndex:    isArrayIndex,
+		BuildPriority:   priority,
+		IsAdaptive:      adaptive,
+		FieldPrefixes:   prefixes,
+		MaxFields:       maxFields,
+		MaxValueSize:    maxValueSize}
 
 	content, err := c.MarshallIndexDefn(idxDefn)
 	if err != nil {
@@ -516,6 +634,175 @@ func (o *MetadataProvider) BuildIndexes(defnIDs []c.IndexDefnId) error {
 	return nil
 }
 
+// Pause the build of the indexes.  A paused index keeps the data that has been built, and
+// ResumeIndexBuild() continues the build from there.
+func (o *MetadataProvider) PauseIndexBuild(defnIDs []c.IndexDefnId) error {
+	return o.stopIndexBuild(OPCODE_PAUSE_BUILD_INDEX, defnIDs)
+}
+
+// Cancel the build of the indexes.  The data that has been built is discarded, and the
+// indexes are left in deferred state.
+func (o *MetadataProvider) CancelIndexBuild(defnIDs []c.IndexDefnId) error {
+	return o.stopIndexBuild(OPCODE_CANCEL_BUILD_INDEX, defnIDs)
+}
+
+// Resume the build of paused indexes.
+func (o *MetadataProvider) ResumeIndexBuild(defnIDs []c.IndexDefnId) error {
+
+	for _, id := range defnIDs {
+		meta := o.FindIndex(id)
+		if meta == nil {
+			return errors.New("Cannot resume index build. Index Definition not found")
+		}
+
+		if meta.Instances == nil || meta.Instances[0].State != c.INDEX_STATE_READY || !meta.Instances[0].Paused {
+			return errors.New(fmt.Sprintf("Index %s build is not paused.", meta.Definition.Name))
+		}
+	}
+
+	return o.BuildIndexes(defnIDs)
+}
+
+func (o *MetadataProvider) stopIndexBuild(opCode common.OpCode, defnIDs []c.IndexDefnId) error {
+
+	watcherIndexMap := make(map[c.IndexerId][]c.IndexDefnId)
+
+	for _, id := range defnIDs {
+
+		meta := o.FindIndex(id)
+		if meta == nil {
+			return errors.New("Index does not exist.")
+		}
+
+		watcher, err := o.findWatcherByDefnIdIgnoreStatus(id)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Cannot locate cluster node hosting Index %s.", meta.Definition.Name))
+		}
+
+		indexerId := watcher.getIndexerId()
+		watcherIndexMap[indexerId] = append(watcherIndexMap[indexerId], id)
+	}
+
+	for indexerId, idList := range watcherIndexMap {
+
+		watcher, err := o.findWatcherByIndexerId(indexerId)
+		if err != nil {
+			return errors.New("Cannot locate cluster node hosting Index.")
+		}
+
+		content, err := MarshallIndexIdList(BuildIndexIdList(idList))
+		if err != nil {
+			return err
+		}
+
+		if _, err = watcher.makeRequest(opCode, "Index Build", content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rename an index.  The index is not rebuilt.  Watchers pick up the new name once the
+// index definition is updated.
+func (o *MetadataProvider) RenameIndex(defnID c.IndexDefnId, name string) error {
+
+	meta := o.FindIndex(defnID)
+	if meta == nil {
+		return errors.New("Index does not exist.")
+	}
+
+	if len(name) == 0 {
+		return errors.New("Index name cannot be empty.")
+	}
+
+	if exist := o.FindIndexByName(name, meta.Definition.Bucket, meta.Definition.Scope,
+		meta.Definition.Collection); exist != nil && exist.Definition.DefnId != defnID {
+		return errors.New(fmt.Sprintf("Index %s already exists.", name))
+	}
+
+	watcher, err := o.findWatcherByDefnIdIgnoreStatus(defnID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Cannot locate cluster node hosting Index %s.", meta.Definition.Name))
+	}
+
+	key := fmt.Sprintf("%d", defnID)
+	_, err = watcher.makeRequest(OPCODE_RENAME_INDEX, key, []byte(name))
+	return err
+}
+
+// Alter the index keys and filter of an index.  The index is rebuilt as a hidden shadow index
+// in the background, and keeps serving scans until the shadow index replaces it.  If rollback
+// is true, the shadow index is dropped when its build fails.
+func (o *MetadataProvider) AlterIndex(defnID c.IndexDefnId, secExprs []string, whereExpr string, rollback bool) error {
+
+	meta := o.FindIndex(defnID)
+	if meta == nil {
+		return errors.New("Index does not exist.")
+	}
+
+	watcher, err := o.findWatcherByDefnIdIgnoreStatus(defnID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Cannot locate cluster node hosting Index %s.", meta.Definition.Name))
+	}
+
+	isArrayIndex, err := checkArrayIndex(secExprs)
+	if err != nil {
+		return err
+	}
+
+	shadowID, err := c.NewIndexDefnId()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Fails to alter index. Fail to create uuid for index definition."))
+	}
+
+	request := &AlterIndexRequest{
+		DefnId: uint64(defnID),
+		Shadow: &c.IndexDefn{
+			DefnId:       shadowID,
+			SecExprs:     secExprs,
+			WhereExpr:    whereExpr,
+			IsArrayIndex: isArrayIndex},
+		Rollback: rollback}
+
+	content, err := MarshallAlterIndexRequest(request)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%d", defnID)
+	_, err = watcher.makeRequest(OPCODE_ALTER_INDEX, key, content)
+	return err
+}
+
+// Roll back the alter of an index that is yet to complete.  The index is left unchanged.
+func (o *MetadataProvider) RollbackAlterIndex(defnID c.IndexDefnId) error {
+
+	meta := o.FindIndex(defnID)
+	if meta == nil {
+		return errors.New("Index does not exist.")
+	}
+
+	watcher, err := o.findWatcherByDefnIdIgnoreStatus(defnID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Cannot locate cluster node hosting Index %s.", meta.Definition.Name))
+	}
+
+	content, err := MarshallIndexIdList(BuildIndexIdList([]c.IndexDefnId{defnID}))
+	if err != nil {
+		return err
+	}
+
+	_, err = watcher.makeRequest(OPCODE_ROLLBACK_ALTER_INDEX, "Alter Index", content)
+	return err
+}
+
+// Find the current id of an index.  An altered index keeps the id it had before it is
+// altered as an alias.
+func (o *MetadataProvider) ResolveIndexDefnId(id c.IndexDefnId) c.IndexDefnId {
+	return o.repo.resolveAlias(id)
+}
+
 func (o *MetadataProvider) ListIndex() ([]*IndexMetadata, uint64) {
 
 	indices, version := o.repo.listDefn()
@@ -579,12 +866,15 @@ func (o *MetadataProvider) UpdateServiceAddrForIndexer(id c.IndexerId, adminport
 	return watcher.updateServiceMap(adminport)
 }
 
-func (o *MetadataProvider) FindIndexByName(name string, bucket string) *IndexMetadata {
+func (o *MetadataProvider) FindIndexByName(name string, bucket string, scope string,
+	collection string) *IndexMetadata {
 
+	keyspace := c.Keyspace(bucket, scope, collection)
 	indices, _ := o.repo.listDefn()
 	for _, meta := range indices {
 		if o.isValidIndexFromActiveIndexer(meta) {
-			if meta.Definition.Name == name && meta.Definition.Bucket == bucket {
+			defn := meta.Definition
+			if defn.Name == name && c.Keyspace(defn.Bucket, defn.Scope, defn.Collection) == keyspace {
 				return meta
 			}
 		}
@@ -798,6 +1088,28 @@ func (o *MetadataProvider) isValidIndexFromActiveIndexer(meta *IndexMetadata) bo
 	return o.isActiveWatcherNoLock(meta.Instances[0].IndexerId)
 }
 
+func checkArrayIndex(secExprs []string) (bool, error) {
+
+	isArrayIndex := false
+	arrayExprCount := 0
+	for _, exp := range secExprs {
+		isArray, _, err := queryutil.IsArrayExpression(exp)
+		if err != nil {
+			return false, errors.New(fmt.Sprintf("Error in parsing expression %v : %v", exp, err))
+		}
+		if isArray == true {
+			isArrayIndex = isArray
+			arrayExprCount++
+		}
+	}
+
+	if arrayExprCount > 1 {
+		return false, errors.New("Multiple expressions with ALL are found. Only one array expression is supported per index.")
+	}
+
+	return isArrayIndex, nil
+}
+
 func isValidIndex(meta *IndexMetadata) bool {
 
 	if meta.Definition == nil {
@@ -826,6 +1138,8 @@ func newMetadataRepo() *metadataRepo {
 		definitions: make(map[c.IndexDefnId]*c.IndexDefn),
 		instances:   make(map[c.IndexDefnId]*IndexInstDistribution),
 		indices:     make(map[c.IndexDefnId]*IndexMetadata),
+		shadows:     make(map[c.IndexDefnId]bool),
+		aliases:     make(map[c.IndexDefnId]c.IndexDefnId),
 		version:     uint64(0)}
 }
 
@@ -836,7 +1150,8 @@ func (r *metadataRepo) listDefn() (map[c.IndexDefnId]*IndexMetadata, uint64) {
 
 	result := make(map[c.IndexDefnId]*IndexMetadata)
 	for id, meta := range r.indices {
-		if len(meta.Instances) != 0 {
+		// the shadow index of an index being altered is hidden
+		if len(meta.Instances) != 0 && !r.shadows[id] {
 			tmp := &IndexMetadata{Definition: meta.Definition, Instances: []*InstanceDefn{meta.Instances[0]}}
 			result[id] = tmp
 		}
@@ -920,6 +1235,13 @@ func (r *metadataRepo) removeDefn(defnId c.IndexDefnId) {
 	delete(r.definitions, defnId)
 	delete(r.instances, defnId)
 	delete(r.indices, defnId)
+	delete(r.shadows, defnId)
+
+	for alias, id := range r.aliases {
+		if id == defnId {
+			delete(r.aliases, alias)
+		}
+	}
 
 	r.version++
 }
@@ -935,11 +1257,32 @@ func (r *metadataRepo) updateTopology(topology *IndexTopology) {
 			r.instances[defnId] = &instRef
 			r.updateIndexMetadataNoLock(defnId, &instRef)
 		}
+
+		if defnRef.ShadowOf != 0 {
+			r.shadows[defnId] = true
+		} else {
+			delete(r.shadows, defnId)
+		}
+
+		for _, alias := range defnRef.Aliases {
+			r.aliases[c.IndexDefnId(alias)] = defnId
+		}
 	}
 
 	r.version++
 }
 
+func (r *metadataRepo) resolveAlias(defnId c.IndexDefnId) c.IndexDefnId {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if id, ok := r.aliases[defnId]; ok {
+		return id
+	}
+	return defnId
+}
+
 func (r *metadataRepo) incrementVersion() {
 
 	r.mutex.Lock()
@@ -982,6 +1325,7 @@ func (r *metadataRepo) updateIndexMetadataNoLock(defnId c.IndexDefnId, inst *Ind
 		idxInst.State = c.IndexState(inst.State)
 		idxInst.Error = inst.Error
 		idxInst.BuildTime = inst.BuildTime
+		idxInst.Paused = inst.Paused
 
 		for _, partition := range inst.Partitions {
 			for _, slice := range partition.SinglePartition.Slices {
@@ -46,6 +46,9 @@ var TIME_INTERVAL = time.Duration(2000) * time.Millisecond
 // Stream Monitor (2m)
 var MONITOR_INTERVAL = time.Duration(120000) * time.Millisecond
 
+// Build Queue (5s)
+var BUILD_QUEUE_CHECK_INTERVAL = time.Duration(5000) * time.Millisecond
+
 /////////////////////////////////////////////
 // Constant
 /////////////////////////////////////////////
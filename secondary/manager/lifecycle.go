@@ -22,6 +22,7 @@ import (
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/manager/client"
 	"strings"
+	"sync"
 	"time"
 	//"runtime/debug"
 )
@@ -36,6 +37,13 @@ type LifecycleMgr struct {
 	outgoings    chan c.Packet
 	killch       chan bool
 	indexerReady bool
+
+	// build queue
+	buildMutex       sync.Mutex
+	buildStarted     map[common.IndexDefnId]string
+	configMutex      sync.Mutex
+	bucketBuildLimit int
+	nodeBuildLimit   int
 }
 
 type requestHolder struct {
@@ -52,7 +60,8 @@ type topologyChange struct {
 	BuildTime []uint64 `json:"buildTime,omitempty"`
 }
 
-func NewLifecycleMgr(addrProvider common.ServiceAddressProvider, notifier MetadataNotifier, clusterURL string) *LifecycleMgr {
+func NewLifecycleMgr(addrProvider common.ServiceAddressProvider, notifier MetadataNotifier, clusterURL string,
+	config common.Config) *LifecycleMgr {
 
 	mgr := &LifecycleMgr{repo: nil,
 		addrProvider: addrProvider,
@@ -62,7 +71,10 @@ func NewLifecycleMgr(addrProvider common.ServiceAddressProvider, notifier Metada
 		outgoings:    make(chan c.Packet, 1000),
 		killch:       make(chan bool),
 		bootstraps:   make(chan *requestHolder, 1000),
-		indexerReady: false}
+		indexerReady: false,
+		buildStarted: make(map[common.IndexDefnId]string)}
+
+	mgr.ResetConfig(config)
 
 	return mgr
 }
@@ -76,6 +88,20 @@ func (m *LifecycleMgr) RegisterNotifier(notifier MetadataNotifier) {
 	m.notifier = notifier
 }
 
+func (m *LifecycleMgr) ResetConfig(config common.Config) {
+
+	m.configMutex.Lock()
+	defer m.configMutex.Unlock()
+
+	if limit, ok := config["settings.build_queue.bucket_limit"]; ok {
+		m.bucketBuildLimit = limit.Int()
+	}
+
+	if limit, ok := config["settings.build_queue.node_limit"]; ok {
+		m.nodeBuildLimit = limit.Int()
+	}
+}
+
 func (m *LifecycleMgr) Terminate() {
 	if m.killch != nil {
 		close(m.killch)
@@ -157,6 +183,15 @@ END_BOOTSTRAP:
 
 	logging.Debugf("LifecycleMgr.processRequest(): indexer is ready to process new client request.")
 
+	// complete alter index interrupted by indexer restart
+	m.recoverShadowIndexSwap()
+
+	// resume index builds queued before indexer restart
+	m.processBuildQueue()
+
+	ticker := time.NewTicker(BUILD_QUEUE_CHECK_INTERVAL)
+	defer ticker.Stop()
+
 	// Indexer is ready and all bootstrap requests are processed.  Proceed to handle regular messages.
 	for {
 		select {
@@ -164,11 +199,19 @@ END_BOOTSTRAP:
 			if ok {
 				// TOOD: deal with error
 				m.dispatchRequest(request, factory)
+
+				// an index build may have completed or an index dropped. Start queued builds if there is capacity.
+				op := c.OpCode(request.request.GetOpCode())
+				if op == client.OPCODE_UPDATE_INDEX_INST || op == client.OPCODE_DROP_INDEX {
+					m.processBuildQueue()
+				}
 			} else {
 				// server shutdown.
 				logging.Debugf("LifecycleMgr.handleRequest(): channel for receiving client request is closed. Terminate.")
 				return
 			}
+		case <-ticker.C:
+			m.processBuildQueue()
 		case <-m.killch:
 			// server shutdown
 			logging.Debugf("LifecycleMgr.processRequest(): receive kill signal. Stop Client request processing.")
@@ -199,6 +242,16 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 		err = m.handleDeleteIndex(key)
 	case client.OPCODE_BUILD_INDEX:
 		err = m.handleBuildIndexes(content)
+	case client.OPCODE_PAUSE_BUILD_INDEX:
+		err = m.handleStopIndexBuild(content, false)
+	case client.OPCODE_CANCEL_BUILD_INDEX:
+		err = m.handleStopIndexBuild(content, true)
+	case client.OPCODE_ALTER_INDEX:
+		err = m.handleAlterIndex(content)
+	case client.OPCODE_ROLLBACK_ALTER_INDEX:
+		err = m.handleRollbackAlterIndex(content)
+	case client.OPCODE_RENAME_INDEX:
+		err = m.handleRenameIndex(key, content)
 	case client.OPCODE_SERVICE_MAP:
 		result, err = m.handleServiceMap(content)
 	case client.OPCODE_DELETE_BUCKET:
@@ -233,14 +286,7 @@ func (m *LifecycleMgr) handleCreateIndex(key string, content []byte) error {
 
 func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn) error {
 
-	if !defn.Deferred && !m.canBuildIndex(defn.Bucket) {
-		logging.Errorf("LifecycleMgr.handleCreateIndex() : Cannot create index %s.%s while another index is being built",
-			defn.Bucket, defn.Name)
-		return errors.New(fmt.Sprintf("Cannot create Index %s.%s while another index is being built.",
-			defn.Bucket, defn.Name))
-	}
-
-	existDefn, err := m.repo.GetIndexDefnByName(defn.Bucket, defn.Name)
+	existDefn, err := m.repo.GetIndexDefnByName(defn.Bucket, defn.Scope, defn.Collection, defn.Name)
 	if err != nil {
 		logging.Errorf("LifecycleMgr.handleCreateIndex() : createIndex fails. Reason = %v", err)
 		return err
@@ -255,7 +301,8 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn) error {
 
 		state, _ := topology.GetStatusByDefn(existDefn.DefnId)
 		if state != common.INDEX_STATE_NIL && state != common.INDEX_STATE_DELETED {
-			return errors.New(fmt.Sprintf("Index %s.%s already exists", defn.Bucket, defn.Name))
+			return errors.New(fmt.Sprintf("Index %s.%s already exists",
+				common.Keyspace(defn.Bucket, defn.Scope, defn.Collection), defn.Name))
 		}
 	}
 
@@ -274,6 +321,15 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn) error {
 	}
 	defn.BucketUUID = bucketUUID
 
+	// Resolve the collection ids, which projector uses to filter mutations.  Index on
+	// default collection does not need collections to be enabled on the bucket.
+	defn.ScopeId, defn.CollectionId, err = m.getCollectionId(defn.Bucket, defn.Scope, defn.Collection)
+	if err != nil {
+		return fmt.Errorf("Collection %s does not exist or temporarily unavailable for creating new index."+
+			" Please retry the operation at a later time (err=%v).",
+			common.Keyspace(defn.Bucket, defn.Scope, defn.Collection), err)
+	}
+
 	//if no index_type has been specified
 	if strings.ToLower(string(defn.Using)) == "gsi" {
 		if common.GetStorageMode() != common.NOT_SET {
@@ -327,14 +383,21 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn) error {
 
 	if !defn.Deferred {
 		if m.notifier != nil {
+			// If another index of the bucket is being built, the index build is queued
+			// and started once the build completes.
 			logging.Debugf("LifecycleMgr.handleCreateIndex() : start Index Build")
-			if errMap := m.notifier.OnIndexBuild([]common.IndexDefnId{defn.DefnId}, []string{defn.Bucket}); len(errMap) != 0 {
-				err := errMap[common.IndexInstId(defn.DefnId)]
+			err := m.enqueueBuild([]*common.IndexDefn{defn})
+			if err == nil {
+				err = m.processBuildQueue()[defn.DefnId]
+			}
+
+			if err != nil {
 				logging.Errorf("LifecycleMgr.hanaleCreateIndex() : createIndex fails. Reason = %v", err)
 
 				m.notifier.OnIndexDelete(defn.DefnId, defn.Bucket)
 				m.repo.DropIndexById(defn.DefnId)
 				m.repo.deleteIndexFromTopology(defn.Bucket, defn.DefnId)
+				m.dequeueBuild(defn.DefnId)
 				return err
 			}
 		}
@@ -361,56 +424,700 @@ func (m *LifecycleMgr) handleBuildIndexes(content []byte) error {
 	return m.BuildIndexes(input)
 }
 
+//
+// Index builds are queued, and started as soon as there is capacity.  Indexes of the
+// same bucket that can start together are built in a single initial build stream.  An
+// error is returned only for the builds that are started and fail.
+//
 func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId) error {
 
-	buckets := []string(nil)
+	defns := make([]*common.IndexDefn, 0, len(ids))
 	for _, id := range ids {
 		defn, err := m.repo.GetIndexDefnById(id)
 		if err != nil {
 			logging.Errorf("LifecycleMgr.handleBuildIndexes() : buildIndex fails. Reason = %v", err)
 			return err
 		}
+		defns = append(defns, defn)
+	}
 
-		found := false
-		for _, bucket := range buckets {
-			if bucket == defn.Bucket {
-				found = true
+	if m.notifier != nil {
+		if err := m.enqueueBuild(defns); err != nil {
+			logging.Errorf("LifecycleMgr.handleBuildIndexes() : buildIndex fails. Reason = %v", err)
+			return err
+		}
+
+		errMap := m.processBuildQueue()
+		result := error(nil)
+
+		for _, id := range ids {
+			build_err, ok := errMap[id]
+			if !ok {
+				continue
+			}
+
+			if result == nil {
+				result = build_err
+			} else if result.Error() != build_err.Error() {
+				result = errors.New("Build index fails. Please check index status for error.")
 			}
 		}
 
-		if !found {
-			buckets = append(buckets, defn.Bucket)
+		if result != nil {
+			logging.Errorf("LifecycleMgr.hanaleBuildIndexes() : buildIndex fails. Reason = %v", result)
+			return result
 		}
 	}
 
-	if m.notifier != nil {
-		if errMap := m.notifier.OnIndexBuild(ids, buckets); len(errMap) != 0 {
-			logging.Errorf("LifecycleMgr.hanaleBuildIndexes() : buildIndex fails. Reason = %v", errMap)
-			result := error(nil)
+	logging.Debugf("LifecycleMgr.handleBuildIndexes() : buildIndex completes")
+
+	return nil
+}
 
-			for instId, build_err := range errMap {
-				defnId := common.IndexDefnId(instId)
+func (m *LifecycleMgr) enqueueBuild(defns []*common.IndexDefn) error {
 
-				if defn, err := m.repo.GetIndexDefnById(defnId); err == nil {
-					m.UpdateIndexInstance(defn.Bucket, defnId, common.INDEX_STATE_NIL, common.NIL_STREAM, build_err.Error(), nil)
-				}
+	m.buildMutex.Lock()
+	defer m.buildMutex.Unlock()
+
+	queue := m.repo.GetBuildQueue()
+
+	changed := false
+	for _, defn := range defns {
+		if queue.Add(defn) {
+			logging.Infof("LifecycleMgr.enqueueBuild() : index %v.%v queued for build at position %v",
+				defn.Bucket, defn.Name, queue.Position(defn.DefnId))
+			changed = true
+		}
+	}
+
+	if changed {
+		return m.repo.SetBuildQueue(queue)
+	}
+
+	return nil
+}
+
+//
+// Remove an index from the build queue.  Return true if the index was queued.
+//
+func (m *LifecycleMgr) dequeueBuild(defnId common.IndexDefnId) (bool, error) {
+
+	m.buildMutex.Lock()
+	defer m.buildMutex.Unlock()
+
+	queue := m.repo.GetBuildQueue()
+	if queue.Remove(defnId) {
+		return true, m.repo.SetBuildQueue(queue)
+	}
+
+	return false, nil
+}
+
+//
+// Start queued index builds as capacity allows.  This returns the error for each index
+// that fails to start.  An index that fails is removed from the queue, with the error
+// recorded in its index instance.
+//
+func (m *LifecycleMgr) processBuildQueue() map[common.IndexDefnId]error {
+
+	if !m.indexerReady || m.notifier == nil {
+		return nil
+	}
+
+	m.buildMutex.Lock()
+	defer m.buildMutex.Unlock()
+
+	queue := m.repo.GetBuildQueue()
+	if len(queue.Entries) == 0 {
+		return nil
+	}
+
+	// remove indexes that are dropped, or no longer waiting for build
+	changed := false
+	for _, entry := range append([]*BuildQueueEntry(nil), queue.Entries...) {
+		if state, _ := m.getIndexState(entry.Bucket, entry.DefnId); state != common.INDEX_STATE_READY {
+			logging.Infof("LifecycleMgr.processBuildQueue() : remove index %v from build queue. Index state %v",
+				entry.DefnId, state)
+			queue.Remove(entry.DefnId)
+			changed = true
+		}
+	}
+
+	m.configMutex.Lock()
+	bucketLimit, nodeLimit := m.bucketBuildLimit, m.nodeBuildLimit
+	m.configMutex.Unlock()
+
+	errMap := make(map[common.IndexDefnId]error)
+
+	for _, batch := range queue.Schedule(bucketLimit, nodeLimit, m.getBuildingIndexes()) {
+
+		bucket := batch[0].Bucket
+		ids := make([]common.IndexDefnId, len(batch))
+		for i, entry := range batch {
+			ids[i] = entry.DefnId
+		}
+
+		logging.Infof("LifecycleMgr.processBuildQueue() : start index build for bucket %v. Index %v", bucket, ids)
+		buildErrs := m.notifier.OnIndexBuild(ids, []string{bucket})
+
+		for _, id := range ids {
+			queue.Remove(id)
+			changed = true
+
+			build_err, ok := buildErrs[common.IndexInstId(id)]
+			if !ok {
+				m.buildStarted[id] = bucket
+				continue
+			}
+
+			logging.Errorf("LifecycleMgr.processBuildQueue() : build index %v fails. Reason = %v", id, build_err)
+			m.UpdateIndexInstance(bucket, id, common.INDEX_STATE_NIL, common.NIL_STREAM, build_err.Error(), nil)
+			errMap[id] = build_err
+		}
+	}
+
+	if changed {
+		if err := m.repo.SetBuildQueue(queue); err != nil {
+			logging.Errorf("LifecycleMgr.processBuildQueue() : fail to save build queue. Reason = %v", err)
+		}
+	}
+
+	return errMap
+}
+
+//
+// Number of indexes being built for each bucket.  An index build that has been started,
+// but yet to be reflected in the index instance state, is also counted.
+//
+func (m *LifecycleMgr) getBuildingIndexes() map[string]int {
+
+	building := make(map[string]int)
+
+	iter, err := m.repo.NewTopologyIterator()
+	if err != nil {
+		return building
+	}
+	defer iter.Close()
 
-				if result == nil {
-					result = build_err
-				} else if result.Error() != build_err.Error() {
-					result = errors.New("Build index fails. Please check index status for error.")
+	topology, err := iter.Next()
+	for err == nil {
+		for _, defnRef := range topology.Definitions {
+			for _, inst := range defnRef.Instances {
+				if inst.State == uint32(common.INDEX_STATE_INITIAL) ||
+					inst.State == uint32(common.INDEX_STATE_CATCHUP) {
+					building[topology.Bucket]++
 				}
 			}
+		}
+		topology, err = iter.Next()
+	}
 
-			return result
+	for defnId, bucket := range m.buildStarted {
+		if state, errStr := m.getIndexState(bucket, defnId); state == common.INDEX_STATE_READY && len(errStr) == 0 {
+			building[bucket]++
+		} else {
+			delete(m.buildStarted, defnId)
 		}
 	}
 
-	logging.Debugf("LifecycleMgr.handleBuildIndexes() : buildIndex completes")
+	return building
+}
+
+func (m *LifecycleMgr) handleStopIndexBuild(content []byte, cancel bool) error {
+
+	list, err := client.UnmarshallIndexIdList(content)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleStopIndexBuild() : stopIndexBuild fails. Unable to unmarshall index list. Reason = %v", err)
+		return err
+	}
+
+	for _, id := range list.DefnIds {
+		if err := m.StopIndexBuild(common.IndexDefnId(id), cancel); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+//
+// Pause or cancel the build of an index.  A queued index is removed from the build queue.  An
+// index being built is removed from its streams and moved back to READY state.  A paused index
+// keeps its data, so a later build resumes from where it is paused.  Cancel discards the data,
+// including the data of an index that is paused.
+//
+func (m *LifecycleMgr) StopIndexBuild(id common.IndexDefnId, cancel bool) error {
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil || defn == nil {
+		logging.Errorf("LifecycleMgr.StopIndexBuild() : stopIndexBuild fails. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	topology, err := m.repo.GetTopologyByBucket(defn.Bucket)
+	if err != nil || topology == nil {
+		logging.Errorf("LifecycleMgr.StopIndexBuild() : fails to find index instance. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	inst := topology.GetIndexInstByDefn(id)
+	if inst == nil {
+		return errors.New("Index does not exist.")
+	}
+	state, paused := common.IndexState(inst.State), inst.Paused
+
+	queued, err := m.dequeueBuild(id)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.StopIndexBuild() : fail to save build queue. Reason = %v", err)
+		return err
+	}
+
+	// an index build that has been started may not be reflected in the index state yet
+	m.buildMutex.Lock()
+	_, started := m.buildStarted[id]
+	delete(m.buildStarted, id)
+	m.buildMutex.Unlock()
+
+	building := started || state == common.INDEX_STATE_INITIAL || state == common.INDEX_STATE_CATCHUP
+	if !building && !queued && !(cancel && paused) {
+		return fmt.Errorf("Index %s is not being built.", defn.Name)
+	}
+
+	if m.notifier != nil && (building || (cancel && paused)) {
+		if cancel {
+			err = m.notifier.OnIndexBuildCancel(id, defn.Bucket)
+		} else {
+			err = m.notifier.OnIndexBuildPause(id, defn.Bucket)
+		}
+
+		if err != nil {
+			logging.Errorf("LifecycleMgr.StopIndexBuild() : stopIndexBuild fails. Reason = %v", err)
+			return err
+		}
+	}
+
+	topology.UpdateStateForIndexInstByDefn(id, common.INDEX_STATE_READY)
+	topology.UpdateStreamForIndexInstByDefn(id, common.NIL_STREAM)
+	topology.SetErrorForIndexInstByDefn(id, "")
+	topology.SetPausedForIndexInstByDefn(id, !cancel && (building || paused))
+
+	if err := m.repo.SetTopologyByBucket(defn.Bucket, topology); err != nil {
+		logging.Errorf("LifecycleMgr.StopIndexBuild() : fail to update index instance. Reason = %v", err)
+		return err
+	}
+
+	logging.Infof("LifecycleMgr.StopIndexBuild() : stopped build of index %v.%v. Cancel %v", defn.Bucket, defn.Name, cancel)
+
+	return nil
+}
+
+func (m *LifecycleMgr) handleAlterIndex(content []byte) error {
+
+	request, err := client.UnmarshallAlterIndexRequest(content)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex() : alterIndex fails. Unable to unmarshall request. Reason = %v", err)
+		return err
+	}
+
+	if request.Shadow == nil {
+		return errors.New("Missing index definition for alter index.")
+	}
+
+	return m.AlterIndex(common.IndexDefnId(request.DefnId), request.Shadow, request.Rollback)
+}
+
+//
+// Alter the index keys and filter of an index.  A hidden shadow index is created with the new
+// definition and built in the background, while the index keeps serving scans.  Once the shadow
+// index is active, it is swapped with the index (see swapShadowIndex).  If rollback is set, the
+// shadow index is dropped when its build fails, leaving the index unchanged.  Otherwise, the
+// shadow index is kept with the error until RollbackAlterIndex() is called.
+//
+func (m *LifecycleMgr) AlterIndex(id common.IndexDefnId, shadow *common.IndexDefn, rollback bool) error {
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil || defn == nil {
+		logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	topology, err := m.repo.GetTopologyByBucket(defn.Bucket)
+	if err != nil || topology == nil {
+		logging.Errorf("LifecycleMgr.AlterIndex() : fails to find index instance. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	if defn.IsPrimary {
+		return fmt.Errorf("Primary index %s cannot be altered.", defn.Name)
+	}
+
+	if state, _ := topology.GetStatusByDefn(id); state != common.INDEX_STATE_ACTIVE {
+		return fmt.Errorf("Index %s is not active.  Only an active index can be altered.", defn.Name)
+	}
+
+	if topology.FindShadowIndexDefinition(id) != nil {
+		return fmt.Errorf("Index %s is already being altered.", defn.Name)
+	}
+
+	// The shadow index takes everything but the index keys and filter from the index.  It has
+	// a hidden name, until it is swapped with the index.
+	shadowDefn := *defn
+	shadowDefn.DefnId = shadow.DefnId
+	shadowDefn.Name = shadowIndexName(defn.Name, shadow.DefnId)
+	shadowDefn.SecExprs = shadow.SecExprs
+	shadowDefn.WhereExpr = shadow.WhereExpr
+	// A new filter can refer to fields that are not declared immutable.
+	shadowDefn.WhereImmutable = defn.WhereImmutable && shadow.WhereExpr == defn.WhereExpr
+	shadowDefn.IsArrayIndex = shadow.IsArrayIndex || defn.IsAdaptive
+	shadowDefn.Deferred = false
+
+	if err := m.repo.CreateIndex(&shadowDefn); err != nil {
+		logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+		return err
+	}
+
+	if err := m.repo.addIndexToTopology(&shadowDefn, common.IndexInstId(shadowDefn.DefnId)); err != nil {
+		logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+		m.repo.DropIndexById(shadowDefn.DefnId)
+		return err
+	}
+
+	if err := m.setShadowIndex(defn.Bucket, shadowDefn.DefnId, id, rollback); err != nil {
+		logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+		m.repo.DropIndexById(shadowDefn.DefnId)
+		m.repo.deleteIndexFromTopology(defn.Bucket, shadowDefn.DefnId)
+		return err
+	}
+
+	if m.notifier != nil {
+		if err := m.notifier.OnIndexCreate(&shadowDefn); err != nil {
+			logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+			m.repo.DropIndexById(shadowDefn.DefnId)
+			m.repo.deleteIndexFromTopology(defn.Bucket, shadowDefn.DefnId)
+			return err
+		}
+	}
+
+	if err := m.updateIndexState(defn.Bucket, shadowDefn.DefnId, common.INDEX_STATE_READY); err != nil {
+		logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+		m.dropShadowIndex(defn.Bucket, shadowDefn.DefnId)
+		return err
+	}
+
+	if m.notifier != nil {
+		err := m.enqueueBuild([]*common.IndexDefn{&shadowDefn})
+		if err == nil {
+			err = m.processBuildQueue()[shadowDefn.DefnId]
+		}
+
+		if err != nil {
+			logging.Errorf("LifecycleMgr.AlterIndex() : alterIndex fails. Reason = %v", err)
+			m.dequeueBuild(shadowDefn.DefnId)
+			m.dropShadowIndex(defn.Bucket, shadowDefn.DefnId)
+			return err
+		}
+	}
+
+	logging.Infof("LifecycleMgr.AlterIndex() : altering index %v.%v with shadow index %v", defn.Bucket, defn.Name, shadowDefn.DefnId)
+
+	return nil
+}
+
+func (m *LifecycleMgr) handleRollbackAlterIndex(content []byte) error {
+
+	list, err := client.UnmarshallIndexIdList(content)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleRollbackAlterIndex() : rollbackAlterIndex fails. Unable to unmarshall index list. Reason = %v", err)
+		return err
+	}
+
+	for _, id := range list.DefnIds {
+		if err := m.RollbackAlterIndex(common.IndexDefnId(id)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// Roll back an alter index that has yet to complete.  The shadow index is dropped, and the index
+// is left unchanged.
+//
+func (m *LifecycleMgr) RollbackAlterIndex(id common.IndexDefnId) error {
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil || defn == nil {
+		logging.Errorf("LifecycleMgr.RollbackAlterIndex() : rollbackAlterIndex fails. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	topology, err := m.repo.GetTopologyByBucket(defn.Bucket)
+	if err != nil || topology == nil {
+		logging.Errorf("LifecycleMgr.RollbackAlterIndex() : fails to find index instance. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	shadow := topology.FindShadowIndexDefinition(id)
+	if shadow == nil {
+		return fmt.Errorf("Index %s is not being altered.", defn.Name)
+	}
+
+	m.dequeueBuild(common.IndexDefnId(shadow.DefnId))
+	m.dropShadowIndex(defn.Bucket, common.IndexDefnId(shadow.DefnId))
+
+	logging.Infof("LifecycleMgr.RollbackAlterIndex() : rolled back alter of index %v.%v", defn.Bucket, defn.Name)
+
+	return nil
+}
+
+func (m *LifecycleMgr) setShadowIndex(bucket string, shadowId common.IndexDefnId, id common.IndexDefnId, rollback bool) error {
+
+	topology, err := m.repo.GetTopologyByBucket(bucket)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.setShadowIndex() : fails to find index instance. Reason = %v", err)
+		return err
+	}
+
+	topology.SetShadowForIndexDefn(shadowId, id, rollback)
+
+	return m.repo.SetTopologyByBucket(bucket, topology)
+}
+
+//
+// Swap an index being altered with its shadow index, once the shadow index is built.  A single
+// topology update makes the shadow index visible under the name of the index, and marks the
+// index as deleted.  The id of the index is kept as an alias of the shadow index, so a client
+// holding the id can find the shadow index.  The topology update is persisted first, so a swap
+// interrupted by indexer restart is completed on bootstrap (see recoverShadowIndexSwap).  The
+// shadow index definition is then renamed, and the index is dropped.
+//
+func (m *LifecycleMgr) swapShadowIndex(bucket string, shadowId common.IndexDefnId) error {
+
+	topology, err := m.repo.GetTopologyByBucket(bucket)
+	if err != nil || topology == nil {
+		logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to find index instance. Reason = %v", err)
+		return err
+	}
+
+	defnRef := topology.FindIndexDefinitionById(shadowId)
+	if defnRef == nil || defnRef.ShadowOf == 0 {
+		return nil
+	}
+	id := common.IndexDefnId(defnRef.ShadowOf)
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil || defn == nil {
+		logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to find altered index %v. Reason = %v", id, err)
+		return errors.New("Index does not exist.")
+	}
+
+	topology.SwapShadowIndexDefinition(shadowId, defn.Name)
+	if err := m.repo.SetTopologyByBucket(bucket, topology); err != nil {
+		logging.Errorf("LifecycleMgr.swapShadowIndex() : fail to swap shadow index. Reason = %v", err)
+		return err
+	}
+
+	logging.Infof("LifecycleMgr.swapShadowIndex() : index %v.%v altered. Index %v replaced by %v", bucket, defn.Name, id, shadowId)
+
+	return m.completeShadowIndexSwap(bucket, topology.FindIndexDefinitionById(shadowId))
+}
+
+//
+// Complete the swap of a shadow index once the topology is swapped.  The shadow index definition
+// takes the name of the index, and any index replaced by the shadow index is dropped.  This is
+// idempotent, so it can be repeated for a swap interrupted at any step.
+//
+func (m *LifecycleMgr) completeShadowIndexSwap(bucket string, defnRef *IndexDefnDistribution) error {
+
+	shadowId := common.IndexDefnId(defnRef.DefnId)
+
+	shadow, err := m.repo.GetIndexDefnById(shadowId)
+	if err != nil || shadow == nil {
+		logging.Errorf("LifecycleMgr.completeShadowIndexSwap() : fails to find shadow index %v. Reason = %v", shadowId, err)
+		return errors.New("Index does not exist.")
+	}
+
+	renamed := shadow.Name != defnRef.Name
+	if renamed {
+		defn := *shadow
+		defn.Name = defnRef.Name
+		if err := m.repo.UpdateIndexDefn(&defn); err != nil {
+			logging.Errorf("LifecycleMgr.completeShadowIndexSwap() : fail to rename shadow index. Reason = %v", err)
+			return err
+		}
+	}
+
+	for _, alias := range defnRef.Aliases {
+		id := common.IndexDefnId(alias)
+		if defn, err := m.repo.GetIndexDefnById(id); err != nil || defn == nil {
+			continue
+		}
+
+		if m.notifier != nil {
+			m.notifier.OnIndexDelete(id, bucket)
+		}
+		m.repo.DropIndexById(id)
+		m.repo.deleteIndexFromTopology(bucket, id)
+	}
+
+	// the indexer takes the new name once the index is dropped
+	if renamed && m.notifier != nil {
+		if err := m.notifier.OnIndexRename(shadowId, bucket, defnRef.Name); err != nil {
+			logging.Errorf("LifecycleMgr.completeShadowIndexSwap() : fail to rename shadow index in indexer. Reason = %v", err)
+		}
+	}
+
+	return nil
+}
+
+//
+// Complete the shadow index swaps interrupted by indexer restart.  A swapped shadow index has
+// aliases in the topology, and its definition may yet to be renamed, or the index that it
+// replaces may yet to be dropped.
+//
+func (m *LifecycleMgr) recoverShadowIndexSwap() {
+
+	iter, err := m.repo.NewTopologyIterator()
+	if err != nil {
+		logging.Errorf("LifecycleMgr.recoverShadowIndexSwap() : fails to read index topology. Reason = %v", err)
+		return
+	}
+	defer iter.Close()
+
+	var swapped []*IndexDefnDistribution
+	topology, err := iter.Next()
+	for err == nil {
+		for i, defnRef := range topology.Definitions {
+			if len(defnRef.Aliases) != 0 && defnRef.ShadowOf == 0 {
+				swapped = append(swapped, &topology.Definitions[i])
+			}
+		}
+		topology, err = iter.Next()
+	}
+
+	for _, defnRef := range swapped {
+		if err := m.completeShadowIndexSwap(defnRef.Bucket, defnRef); err != nil {
+			logging.Errorf("LifecycleMgr.recoverShadowIndexSwap() : fail to complete swap of shadow index %v. Reason = %v",
+				defnRef.DefnId, err)
+		}
+	}
+}
+
+//
+// Drop the shadow index of an index being altered.  The shadow index may have been
+// partially dropped already.
+//
+func (m *LifecycleMgr) dropShadowIndex(bucket string, shadowId common.IndexDefnId) {
+
+	m.updateIndexState(bucket, shadowId, common.INDEX_STATE_DELETED)
+
+	if m.notifier != nil {
+		m.notifier.OnIndexDelete(shadowId, bucket)
+	}
+	m.repo.DropIndexById(shadowId)
+	m.repo.deleteIndexFromTopology(bucket, shadowId)
+}
+
+func shadowIndexName(name string, shadowId common.IndexDefnId) string {
+	return fmt.Sprintf("%s#alter#%v", name, shadowId)
+}
+
+func (m *LifecycleMgr) handleRenameIndex(key string, content []byte) error {
+
+	id, err := indexDefnId(key)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleRenameIndex() : renameIndex fails. Reason = %v", err)
+		return err
+	}
+
+	return m.RenameIndex(id, string(content))
+}
+
+//
+// Rename an index without rebuilding it.  The index definition and the index topology are
+// updated together.  If either update fails, the index keeps its name.  Watchers are notified
+// of the new name through the update of the index definition.
+//
+func (m *LifecycleMgr) RenameIndex(id common.IndexDefnId, name string) error {
+
+	if len(name) == 0 {
+		return errors.New("Index name cannot be empty.")
+	}
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil || defn == nil {
+		logging.Errorf("LifecycleMgr.RenameIndex() : renameIndex fails. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	topology, err := m.repo.GetTopologyByBucket(defn.Bucket)
+	if err != nil || topology == nil {
+		logging.Errorf("LifecycleMgr.RenameIndex() : fails to find index instance. Reason = %v", err)
+		return errors.New("Index does not exist.")
+	}
+
+	state, _ := topology.GetStatusByDefn(id)
+	if state == common.INDEX_STATE_NIL || state == common.INDEX_STATE_CREATED || state == common.INDEX_STATE_DELETED {
+		return errors.New("Index does not exist.")
+	}
+
+	if defn.Name == name {
+		return nil
+	}
+
+	existDefn, err := m.repo.GetIndexDefnByName(defn.Bucket, defn.Scope, defn.Collection, name)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.RenameIndex() : renameIndex fails. Reason = %v", err)
+		return err
+	}
+
+	if existDefn != nil {
+		state, _ := topology.GetStatusByDefn(existDefn.DefnId)
+		if state != common.INDEX_STATE_NIL && state != common.INDEX_STATE_DELETED {
+			return errors.New(fmt.Sprintf("Index %s.%s already exists",
+				common.Keyspace(defn.Bucket, defn.Scope, defn.Collection), name))
+		}
+	}
+
+	if m.notifier != nil {
+		if err := m.notifier.OnIndexRename(id, defn.Bucket, name); err != nil {
+			logging.Errorf("LifecycleMgr.RenameIndex() : renameIndex fails. Reason = %v", err)
+			return err
+		}
+	}
+
+	renamed := *defn
+	renamed.Name = name
+
+	if err := m.repo.UpdateIndexDefn(&renamed); err != nil {
+		logging.Errorf("LifecycleMgr.RenameIndex() : renameIndex fails. Reason = %v", err)
+		m.undoRenameIndex(defn)
+		return err
+	}
+
+	topology.RenameIndexDefinition(id, name)
+	if err := m.repo.SetTopologyByBucket(defn.Bucket, topology); err != nil {
+		logging.Errorf("LifecycleMgr.RenameIndex() : renameIndex fails. Reason = %v", err)
+		m.repo.UpdateIndexDefn(defn)
+		m.undoRenameIndex(defn)
+		return err
+	}
+
+	logging.Infof("LifecycleMgr.RenameIndex() : renamed index %v.%v to %v", defn.Bucket, defn.Name, name)
+
+	return nil
+}
+
+func (m *LifecycleMgr) undoRenameIndex(defn *common.IndexDefn) {
+
+	if m.notifier != nil {
+		if err := m.notifier.OnIndexRename(defn.DefnId, defn.Bucket, defn.Name); err != nil {
+			logging.Errorf("LifecycleMgr.undoRenameIndex() : fail to restore name of index %v. Reason = %v", defn.DefnId, err)
+		}
+	}
+}
+
 func (m *LifecycleMgr) handleDeleteIndex(key string) error {
 
 	id, err := indexDefnId(key)
@@ -449,9 +1156,18 @@ func (m *LifecycleMgr) DeleteIndex(id common.IndexDefnId, notify bool) error {
 	if notify && m.notifier != nil {
 		m.notifier.OnIndexDelete(defn.DefnId, defn.Bucket)
 	}
+	m.dequeueBuild(defn.DefnId)
 	m.repo.DropIndexById(defn.DefnId)
 	m.repo.deleteIndexFromTopology(defn.Bucket, defn.DefnId)
 
+	// an index being altered is dropped along with its shadow index
+	if topology, err := m.repo.GetTopologyByBucket(defn.Bucket); err == nil && topology != nil {
+		if shadow := topology.FindShadowIndexDefinition(defn.DefnId); shadow != nil {
+			m.dequeueBuild(common.IndexDefnId(shadow.DefnId))
+			m.dropShadowIndex(defn.Bucket, common.IndexDefnId(shadow.DefnId))
+		}
+	}
+
 	logging.Debugf("LifecycleMgr.DeleteIndex() : deleted index:  bucket : %v bucket uuid %v name %v",
 		defn.Bucket, defn.BucketUUID, defn.Name)
 	return nil
@@ -480,6 +1196,11 @@ func (m *LifecycleMgr) UpdateIndexInstance(bucket string, defnId common.IndexDef
 	changed := false
 	if state != common.INDEX_STATE_NIL {
 		changed = topology.UpdateStateForIndexInstByDefn(common.IndexDefnId(defnId), common.IndexState(state)) || changed
+
+		// a paused index build has resumed
+		if state != common.INDEX_STATE_READY {
+			changed = topology.SetPausedForIndexInstByDefn(common.IndexDefnId(defnId), false) || changed
+		}
 	}
 
 	if streamId != common.NIL_STREAM {
@@ -495,6 +1216,19 @@ func (m *LifecycleMgr) UpdateIndexInstance(bucket string, defnId common.IndexDef
 		}
 	}
 
+	// A shadow index is swapped with the index being altered once it is built.  If its
+	// build fails, the shadow index is dropped when rollback is requested.
+	if defnRef := topology.FindIndexDefinitionById(defnId); defnRef != nil && defnRef.ShadowOf != 0 {
+		if state == common.INDEX_STATE_ACTIVE {
+			return m.swapShadowIndex(bucket, defnId)
+		}
+
+		if len(errStr) != 0 && defnRef.RollbackOnError {
+			logging.Infof("LifecycleMgr.UpdateIndexInstance() : roll back alter of index %v. Reason = %v", defnRef.ShadowOf, errStr)
+			m.dropShadowIndex(bucket, defnId)
+		}
+	}
+
 	return nil
 }
 
@@ -516,23 +1250,14 @@ func (m *LifecycleMgr) updateIndexState(bucket string, defnId common.IndexDefnId
 	return nil
 }
 
-func (m *LifecycleMgr) canBuildIndex(bucket string) bool {
-
-	t, _ := m.repo.GetTopologyByBucket(bucket)
-	if t == nil {
-		return true
-	}
+func (m *LifecycleMgr) getIndexState(bucket string, defnId common.IndexDefnId) (common.IndexState, string) {
 
-	for i, _ := range t.Definitions {
-		for j, _ := range t.Definitions[i].Instances {
-			if t.Definitions[i].Instances[j].State == uint32(common.INDEX_STATE_CATCHUP) ||
-				t.Definitions[i].Instances[j].State == uint32(common.INDEX_STATE_INITIAL) {
-				return false
-			}
-		}
+	topology, err := m.repo.GetTopologyByBucket(bucket)
+	if err != nil || topology == nil {
+		return common.INDEX_STATE_NIL, ""
 	}
 
-	return true
+	return topology.GetStatusByDefn(defnId)
 }
 
 func (m *LifecycleMgr) handleServiceMap(content []byte) ([]byte, error) {
@@ -691,6 +1416,24 @@ RETRY:
 	return uuid, nil
 }
 
+func (m *LifecycleMgr) getCollectionId(bucket, scope, collection string) (string, string, error) {
+
+	count := 0
+RETRY:
+	scopeId, collectionId, err := common.GetCollectionId(m.clusterURL, bucket, scope, collection)
+	if err != nil && count < 5 {
+		count++
+		time.Sleep(time.Duration(100) * time.Millisecond)
+		goto RETRY
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return scopeId, collectionId, nil
+}
+
 // This function ensures:
 // 1) Bucket exists
 // 2) Existing Index Definition matches the UUID of exixisting bucket
@@ -0,0 +1,666 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// testNotifier records the calls from lifecycle manager to indexer.
+type testNotifier struct {
+	mutex     sync.Mutex
+	builds    [][]common.IndexDefnId
+	buildErrs map[common.IndexInstId]error
+	deleted   []common.IndexDefnId
+	paused    []common.IndexDefnId
+	cancelled []common.IndexDefnId
+	renamed   map[common.IndexDefnId]string
+	renameErr error
+}
+
+func (n *testNotifier) OnIndexCreate(defn *common.IndexDefn) error {
+	return nil
+}
+
+func (n *testNotifier) OnIndexDelete(id common.IndexDefnId, bucket string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.deleted = append(n.deleted, id)
+	return nil
+}
+
+func (n *testNotifier) OnIndexBuild(ids []common.IndexDefnId, buckets []string) map[common.IndexInstId]error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.builds = append(n.builds, append([]common.IndexDefnId(nil), ids...))
+
+	errMap := make(map[common.IndexInstId]error)
+	for _, id := range ids {
+		if err, ok := n.buildErrs[common.IndexInstId(id)]; ok {
+			errMap[common.IndexInstId(id)] = err
+		}
+	}
+	return errMap
+}
+
+func (n *testNotifier) OnIndexBuildPause(id common.IndexDefnId, bucket string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.paused = append(n.paused, id)
+	return nil
+}
+
+func (n *testNotifier) OnIndexBuildCancel(id common.IndexDefnId, bucket string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.cancelled = append(n.cancelled, id)
+	return nil
+}
+
+func (n *testNotifier) OnIndexRename(id common.IndexDefnId, bucket string, name string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.renameErr != nil {
+		return n.renameErr
+	}
+	if n.renamed == nil {
+		n.renamed = make(map[common.IndexDefnId]string)
+	}
+	n.renamed[id] = name
+	return nil
+}
+
+var testRepoPort = 9150
+
+// newTestLifecycleMgr returns a lifecycle manager for a ready indexer, with
+// a local metadata repository and its event manager.  The returned function
+// closes the repository.
+func newTestLifecycleMgr(t *testing.T, bucketLimit, nodeLimit int) (*LifecycleMgr, *testNotifier, func()) {
+
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventMgr, err := newEventManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRepoPort++
+	repo, _, err := NewLocalMetadataRepo(fmt.Sprintf("localhost:%v", testRepoPort), eventMgr, nil,
+		filepath.Join(dir, "MetadataStore"), 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	notifier := &testNotifier{buildErrs: make(map[common.IndexInstId]error)}
+	m := &LifecycleMgr{repo: repo,
+		notifier:         notifier,
+		indexerReady:     true,
+		buildStarted:     make(map[common.IndexDefnId]string),
+		bucketBuildLimit: bucketLimit,
+		nodeBuildLimit:   nodeLimit}
+
+	return m, notifier, func() {
+		repo.Close()
+		eventMgr.close()
+		os.RemoveAll(dir)
+	}
+}
+
+// createTestIndex adds a deferred index to the repository, without going
+// through bucket validation of CreateIndex.
+func createTestIndex(t *testing.T, m *LifecycleMgr, id common.IndexDefnId, bucket string, name string,
+	priority int) *common.IndexDefn {
+
+	defn := &common.IndexDefn{
+		DefnId:        id,
+		Name:          name,
+		Using:         common.ForestDB,
+		Bucket:        bucket,
+		SecExprs:      []string{"`age`"},
+		ExprType:      common.N1QL,
+		Deferred:      true,
+		BuildPriority: priority}
+
+	if err := m.repo.CreateIndex(defn); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.repo.addIndexToTopology(defn, common.IndexInstId(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.updateIndexState(bucket, id, common.INDEX_STATE_READY); err != nil {
+		t.Fatal(err)
+	}
+	return defn
+}
+
+func checkBuilds(t *testing.T, n *testNotifier, expected ...[]common.IndexDefnId) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if fmt.Sprint(n.builds) != fmt.Sprint(expected) {
+		t.Fatalf("expected builds %v, got %v", expected, n.builds)
+	}
+}
+
+func TestBuildQueueLifecycle(t *testing.T) {
+
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 1)
+	defer cleanup()
+
+	createTestIndex(t, m, 1, "default", "idx1", 0)
+	createTestIndex(t, m, 2, "default", "idx2", 0)
+	createTestIndex(t, m, 3, "default", "idx3", 0)
+	createTestIndex(t, m, 4, "other", "idx4", 0)
+	createTestIndex(t, m, 5, "other", "idx5", 1)
+
+	if err := m.BuildIndexes([]common.IndexDefnId{1}); err != nil {
+		t.Fatal(err)
+	}
+	checkBuilds(t, notifier, []common.IndexDefnId{1})
+
+	//node is at its build limit, even though the started build is not in the
+	//index state yet
+	if err := m.BuildIndexes([]common.IndexDefnId{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.BuildIndexes([]common.IndexDefnId{4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.BuildIndexes([]common.IndexDefnId{5}); err != nil {
+		t.Fatal(err)
+	}
+	checkBuilds(t, notifier, []common.IndexDefnId{1})
+
+	queue := m.repo.GetBuildQueue()
+	for id, pos := range map[common.IndexDefnId]int{1: 0, 2: 2, 3: 3, 4: 4, 5: 1} {
+		if queue.Position(id) != pos {
+			t.Errorf("expected index %v at position %v, got %v", id, pos, queue.Position(id))
+		}
+	}
+
+	//queue position in the full queue is reported in the local metadata of the bucket
+	m.repo.SetLocalValue("IndexerId", "indexer1")
+	m.repo.SetLocalValue("IndexerNodeUUID", "uuid1")
+	ctx := &requestHandlerContext{mgr: &IndexManager{repo: m.repo}}
+	meta, err := ctx.getLocalIndexMetadata("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.BuildQueue == nil || len(meta.BuildQueue.Entries) != 2 ||
+		meta.BuildQueue.Position(5) != 1 || meta.BuildQueue.Position(4) != 4 {
+		t.Fatalf("unexpected build queue %v for bucket other", meta.BuildQueue)
+	}
+	meta, err = ctx.getLocalIndexMetadata("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.BuildQueue == nil || len(meta.BuildQueue.Entries) != 4 {
+		t.Fatalf("unexpected build queue %v", meta.BuildQueue)
+	}
+
+	//dropped index is removed from the queue
+	if err := m.DeleteIndex(2, true); err != nil {
+		t.Fatal(err)
+	}
+	queue = m.repo.GetBuildQueue()
+	if queue.Position(2) != 0 || queue.Position(3) != 2 || queue.Position(4) != 3 {
+		t.Errorf("unexpected positions %v %v %v after drop",
+			queue.Position(2), queue.Position(3), queue.Position(4))
+	}
+	if len(notifier.deleted) != 1 || notifier.deleted[0] != 2 {
+		t.Errorf("expected index 2 deleted, got %v", notifier.deleted)
+	}
+
+	//no capacity while index 1 is being built
+	if err := m.UpdateIndexInstance("default", 1, common.INDEX_STATE_INITIAL, common.INIT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	m.processBuildQueue()
+	checkBuilds(t, notifier, []common.IndexDefnId{1})
+
+	//once index 1 is built, the queue head (higher priority) starts
+	if err := m.UpdateIndexInstance("default", 1, common.INDEX_STATE_ACTIVE, common.MAINT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	m.processBuildQueue()
+	checkBuilds(t, notifier, []common.IndexDefnId{1}, []common.IndexDefnId{5})
+	if queue = m.repo.GetBuildQueue(); queue.Position(5) != 0 || queue.Position(3) != 1 {
+		t.Errorf("unexpected positions %v %v after build starts", queue.Position(5), queue.Position(3))
+	}
+
+	//an index no longer waiting for build is removed from the queue
+	if err := m.updateIndexState("default", 3, common.INDEX_STATE_ACTIVE); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateIndexInstance("other", 5, common.INDEX_STATE_ACTIVE, common.MAINT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	m.processBuildQueue()
+	checkBuilds(t, notifier, []common.IndexDefnId{1}, []common.IndexDefnId{5}, []common.IndexDefnId{4})
+	if queue = m.repo.GetBuildQueue(); len(queue.Entries) != 0 {
+		t.Errorf("expected empty queue, got %v", queue.Entries)
+	}
+}
+
+func TestBuildQueueBuildError(t *testing.T) {
+
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 0)
+	defer cleanup()
+
+	createTestIndex(t, m, 1, "default", "idx1", 0)
+	createTestIndex(t, m, 2, "default", "idx2", 0)
+	notifier.buildErrs[common.IndexInstId(2)] = fmt.Errorf("build fails")
+
+	if err := m.BuildIndexes([]common.IndexDefnId{1, 2}); err == nil || err.Error() != "build fails" {
+		t.Fatalf("expected build error, got %v", err)
+	}
+	checkBuilds(t, notifier, []common.IndexDefnId{1, 2})
+
+	if queue := m.repo.GetBuildQueue(); len(queue.Entries) != 0 {
+		t.Errorf("expected empty queue, got %v", queue.Entries)
+	}
+	if _, errStr := m.getIndexState("default", 2); errStr != "build fails" {
+		t.Errorf("expected error recorded in index instance, got %q", errStr)
+	}
+	if _, ok := m.buildStarted[2]; ok {
+		t.Errorf("expected failed build not started")
+	}
+	if _, ok := m.buildStarted[1]; !ok {
+		t.Errorf("expected build of index 1 started")
+	}
+}
+
+func checkPaused(t *testing.T, m *LifecycleMgr, id common.IndexDefnId, state common.IndexState, paused bool) {
+	topology, err := m.repo.GetTopologyByBucket("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := topology.GetIndexInstByDefn(id)
+	if common.IndexState(inst.State) != state || inst.Paused != paused {
+		t.Fatalf("expected index %v in state %v paused %v, got %v paused %v",
+			id, state, paused, common.IndexState(inst.State), inst.Paused)
+	}
+}
+
+func TestStopIndexBuild(t *testing.T) {
+
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 0)
+	defer cleanup()
+
+	createTestIndex(t, m, 1, "default", "idx1", 0)
+	createTestIndex(t, m, 2, "default", "idx2", 0)
+
+	if err := m.StopIndexBuild(1, false); err == nil {
+		t.Errorf("expected error for index not being built")
+	}
+	if err := m.StopIndexBuild(1, true); err == nil {
+		t.Errorf("expected error for cancel of index not being built")
+	}
+	if err := m.StopIndexBuild(3, false); err == nil {
+		t.Errorf("expected error for unknown index")
+	}
+
+	//pause a build that is started, but yet to be reflected in the index state
+	if err := m.BuildIndexes([]common.IndexDefnId{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StopIndexBuild(1, false); err != nil {
+		t.Fatal(err)
+	}
+	checkPaused(t, m, 1, common.INDEX_STATE_READY, true)
+	if len(notifier.paused) != 1 || notifier.paused[0] != 1 {
+		t.Errorf("expected build of index 1 paused, got %v", notifier.paused)
+	}
+	if _, ok := m.buildStarted[1]; ok {
+		t.Errorf("expected paused build removed from started builds")
+	}
+
+	//a paused index cannot be paused again
+	if err := m.StopIndexBuild(1, false); err == nil {
+		t.Errorf("expected error for pause of paused index")
+	}
+
+	//a queued build is removed from queue, indexer is not notified
+	if err := m.BuildIndexes([]common.IndexDefnId{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.BuildIndexes([]common.IndexDefnId{2}); err != nil {
+		t.Fatal(err)
+	}
+	checkBuilds(t, notifier, []common.IndexDefnId{1}, []common.IndexDefnId{1})
+	if err := m.StopIndexBuild(2, false); err != nil {
+		t.Fatal(err)
+	}
+	checkPaused(t, m, 2, common.INDEX_STATE_READY, false)
+	if m.repo.GetBuildQueue().Position(2) != 0 || len(notifier.paused) != 1 {
+		t.Errorf("expected queued index removed from queue without notifying indexer")
+	}
+
+	//resumed build clears the paused flag once indexer picks it up
+	checkPaused(t, m, 1, common.INDEX_STATE_READY, true)
+	if err := m.UpdateIndexInstance("default", 1, common.INDEX_STATE_INITIAL, common.INIT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	checkPaused(t, m, 1, common.INDEX_STATE_INITIAL, false)
+
+	//pause a build in progress
+	if err := m.StopIndexBuild(1, false); err != nil {
+		t.Fatal(err)
+	}
+	checkPaused(t, m, 1, common.INDEX_STATE_READY, true)
+	topology, _ := m.repo.GetTopologyByBucket("default")
+	if inst := topology.GetIndexInstByDefn(1); common.StreamId(inst.StreamId) != common.NIL_STREAM {
+		t.Errorf("expected paused index out of stream, got %v", inst.StreamId)
+	}
+
+	//cancel a paused build discards its data
+	if err := m.StopIndexBuild(1, true); err != nil {
+		t.Fatal(err)
+	}
+	checkPaused(t, m, 1, common.INDEX_STATE_READY, false)
+	if len(notifier.cancelled) != 1 || notifier.cancelled[0] != 1 {
+		t.Errorf("expected build of index 1 cancelled, got %v", notifier.cancelled)
+	}
+	if err := m.StopIndexBuild(1, true); err == nil {
+		t.Errorf("expected error for cancel of cancelled index")
+	}
+
+	//cancel a build in progress
+	if err := m.UpdateIndexInstance("default", 1, common.INDEX_STATE_CATCHUP, common.INIT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StopIndexBuild(1, true); err != nil {
+		t.Fatal(err)
+	}
+	checkPaused(t, m, 1, common.INDEX_STATE_READY, false)
+	if len(notifier.cancelled) != 2 {
+		t.Errorf("expected build of index 1 cancelled, got %v", notifier.cancelled)
+	}
+}
+
+func indexExists(m *LifecycleMgr, id common.IndexDefnId) bool {
+	defn, err := m.repo.GetIndexDefnById(id)
+	return err == nil && defn != nil
+}
+
+// createAlterTestIndex creates an active index 1 that is being altered with
+// shadow index 10.
+func createAlterTestIndex(t *testing.T, m *LifecycleMgr, rollback bool) {
+	createTestIndex(t, m, 1, "default", "idx1", 0)
+	if err := m.updateIndexState("default", 1, common.INDEX_STATE_ACTIVE); err != nil {
+		t.Fatal(err)
+	}
+
+	shadow := &common.IndexDefn{DefnId: 10, SecExprs: []string{"`name`"}}
+	if err := m.AlterIndex(1, shadow, rollback); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkAltered(t *testing.T, m *LifecycleMgr, notifier *testNotifier) {
+	if indexExists(m, 1) {
+		t.Errorf("expected altered index dropped")
+	}
+	if defn, err := m.repo.GetIndexDefnById(10); err != nil || defn.Name != "idx1" || defn.SecExprs[0] != "`name`" {
+		t.Fatalf("expected shadow index renamed, got %v %v", defn, err)
+	}
+	if defn, _ := m.repo.GetIndexDefnByName("default", "", "", "idx1"); defn == nil || defn.DefnId != 10 {
+		t.Errorf("expected shadow index found by name, got %v", defn)
+	}
+
+	topology, err := m.repo.GetTopologyByBucket("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defnRef := topology.FindIndexDefinitionById(10)
+	if defnRef == nil || defnRef.Name != "idx1" || defnRef.ShadowOf != 0 ||
+		len(defnRef.Aliases) != 1 || defnRef.Aliases[0] != 1 {
+		t.Errorf("unexpected shadow index %v in topology", defnRef)
+	}
+	if topology.FindIndexDefinitionById(1) != nil {
+		t.Errorf("expected altered index removed from topology")
+	}
+
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if len(notifier.deleted) != 1 || notifier.deleted[0] != 1 || notifier.renamed[10] != "idx1" {
+		t.Errorf("unexpected notification of drop %v and rename %v", notifier.deleted, notifier.renamed)
+	}
+}
+
+func TestAlterIndexSwap(t *testing.T) {
+
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 0)
+	defer cleanup()
+
+	createAlterTestIndex(t, m, false)
+	checkBuilds(t, notifier, []common.IndexDefnId{10})
+
+	if defn, err := m.repo.GetIndexDefnById(10); err != nil || defn.Name != shadowIndexName("idx1", 10) {
+		t.Fatalf("unexpected shadow index %v %v", defn, err)
+	}
+	if err := m.AlterIndex(1, &common.IndexDefn{DefnId: 11}, false); err == nil {
+		t.Errorf("expected error for index already being altered")
+	}
+
+	//index is swapped once the shadow index is built
+	if err := m.UpdateIndexInstance("default", 10, common.INDEX_STATE_INITIAL, common.INIT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !indexExists(m, 1) {
+		t.Fatalf("expected index swapped only once shadow index is built")
+	}
+	if err := m.UpdateIndexInstance("default", 10, common.INDEX_STATE_ACTIVE, common.MAINT_STREAM, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	checkAltered(t, m, notifier)
+
+	//nothing to recover after a completed swap
+	m.recoverShadowIndexSwap()
+	checkAltered(t, m, notifier)
+}
+
+func TestShadowIndexSwapRecovery(t *testing.T) {
+
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 0)
+	defer cleanup()
+
+	createAlterTestIndex(t, m, false)
+
+	//swap interrupted once the topology is swapped
+	topology, err := m.repo.GetTopologyByBucket("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topology.SwapShadowIndexDefinition(10, "idx1")
+	if err := m.repo.SetTopologyByBucket("default", topology); err != nil {
+		t.Fatal(err)
+	}
+
+	m.recoverShadowIndexSwap()
+	checkAltered(t, m, notifier)
+
+	m.recoverShadowIndexSwap()
+	checkAltered(t, m, notifier)
+}
+
+func TestAlterIndexRollback(t *testing.T) {
+
+	//shadow index fails to start building
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 0)
+	defer cleanup()
+
+	createTestIndex(t, m, 1, "default", "idx1", 0)
+	if err := m.updateIndexState("default", 1, common.INDEX_STATE_ACTIVE); err != nil {
+		t.Fatal(err)
+	}
+	notifier.buildErrs[common.IndexInstId(10)] = fmt.Errorf("build fails")
+	if err := m.AlterIndex(1, &common.IndexDefn{DefnId: 10}, false); err == nil {
+		t.Fatalf("expected alter index to fail")
+	}
+	delete(notifier.buildErrs, common.IndexInstId(10))
+
+	checkRolledBack := func(name string, shadowId common.IndexDefnId) {
+		if indexExists(m, shadowId) {
+			t.Errorf("%v: expected shadow index dropped", name)
+		}
+		topology, _ := m.repo.GetTopologyByBucket("default")
+		if topology.FindShadowIndexDefinition(1) != nil || topology.FindIndexDefinitionById(shadowId) != nil {
+			t.Errorf("%v: expected shadow index removed from topology", name)
+		}
+		if defn, err := m.repo.GetIndexDefnById(1); err != nil || defn.Name != "idx1" {
+			t.Errorf("%v: expected index unchanged, got %v %v", name, defn, err)
+		}
+		if state, _ := m.getIndexState("default", 1); state != common.INDEX_STATE_ACTIVE {
+			t.Errorf("%v: expected index active, got %v", name, state)
+		}
+		if m.repo.GetBuildQueue().Position(shadowId) != 0 {
+			t.Errorf("%v: expected shadow index removed from build queue", name)
+		}
+	}
+	checkRolledBack("build start", 10)
+
+	//shadow index build fails, with rollback on error
+	if err := m.AlterIndex(1, &common.IndexDefn{DefnId: 11}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateIndexInstance("default", 11, common.INDEX_STATE_NIL, common.NIL_STREAM, "build fails", nil); err != nil {
+		t.Fatal(err)
+	}
+	checkRolledBack("rollback on error", 11)
+
+	//without rollback on error, shadow index is kept until rollback is requested
+	if err := m.AlterIndex(1, &common.IndexDefn{DefnId: 12}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateIndexInstance("default", 12, common.INDEX_STATE_NIL, common.NIL_STREAM, "build fails", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, errStr := m.getIndexState("default", 12); !indexExists(m, 12) || errStr != "build fails" {
+		t.Fatalf("expected shadow index kept with error %q", errStr)
+	}
+	if err := m.RollbackAlterIndex(1); err != nil {
+		t.Fatal(err)
+	}
+	checkRolledBack("rollback", 12)
+	if err := m.RollbackAlterIndex(1); err == nil {
+		t.Errorf("expected error for index not being altered")
+	}
+}
+
+func checkIndexName(t *testing.T, m *LifecycleMgr, id common.IndexDefnId, name string) {
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil || defn.Name != name {
+		t.Fatalf("expected index definition named %v, got %v %v", name, defn, err)
+	}
+	topology, err := m.repo.GetTopologyByBucket("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defnRef := topology.FindIndexDefinitionById(id); defnRef == nil || defnRef.Name != name {
+		t.Fatalf("expected index topology named %v, got %v", name, defnRef)
+	}
+}
+
+func TestRenameIndex(t *testing.T) {
+
+	m, notifier, cleanup := newTestLifecycleMgr(t, 0, 0)
+	defer cleanup()
+
+	createTestIndex(t, m, 1, "default", "idx1", 0)
+	createTestIndex(t, m, 2, "default", "idx2", 0)
+
+	eventMgr := m.repo.repo.(*LocalRepoRef).eventMgr
+	defnCh, err := eventMgr.register("watcher", EVENT_CREATE_INDEX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topologyCh, err := eventMgr.register("watcher", EVENT_UPDATE_TOPOLOGY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//failed rename leaves index with its name, without notifying watchers
+	for name, err := range map[string]error{"": nil, "idx2": nil, "idx3": fmt.Errorf("rename fails")} {
+		notifier.renameErr = err
+		if m.RenameIndex(1, name) == nil {
+			t.Errorf("expected rename to %q to fail", name)
+		}
+		checkIndexName(t, m, 1, "idx1")
+	}
+	notifier.renameErr = nil
+	if len(defnCh) != 0 || len(topologyCh) != 0 {
+		t.Fatalf("unexpected notification for failed rename")
+	}
+	if err := m.RenameIndex(3, "idx3"); err == nil {
+		t.Errorf("expected error for unknown index")
+	}
+
+	if err := m.RenameIndex(1, "idx3"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexName(t, m, 1, "idx3")
+	if defn, _ := m.repo.GetIndexDefnByName("default", "", "", "idx1"); defn != nil {
+		t.Errorf("expected old name not found, got %v", defn)
+	}
+	if notifier.renamed[1] != "idx3" {
+		t.Errorf("expected indexer notified of new name, got %v", notifier.renamed)
+	}
+
+	//watchers see the new name in both definition and topology
+	if len(defnCh) != 1 || len(topologyCh) != 1 {
+		t.Fatalf("expected one notification each, got %v %v", len(defnCh), len(topologyCh))
+	}
+	defn, err := common.UnmarshallIndexDefn((<-defnCh).([]byte))
+	if err != nil || defn.DefnId != 1 || defn.Name != "idx3" {
+		t.Errorf("unexpected index definition %v %v for watcher", defn, err)
+	}
+	topology, err := unmarshallIndexTopology((<-topologyCh).([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defnRef := topology.FindIndexDefinitionById(1); defnRef == nil || defnRef.Name != "idx3" {
+		t.Errorf("unexpected index topology %v for watcher", defnRef)
+	}
+
+	//rename to the same name is a no-op
+	if err := m.RenameIndex(1, "idx3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(defnCh) != 0 || len(topologyCh) != 0 {
+		t.Errorf("unexpected notification for rename to the same name")
+	}
+
+	//name of a dropped index can be reused
+	if err := m.DeleteIndex(2, true); err != nil {
+		t.Fatal(err)
+	}
+	for len(defnCh) != 0 || len(topologyCh) != 0 {
+		select {
+		case <-defnCh:
+		case <-topologyCh:
+		}
+	}
+	if err := m.RenameIndex(1, "idx2"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexName(t, m, 1, "idx2")
+}
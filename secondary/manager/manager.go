@@ -12,6 +12,7 @@ package manager
 import (
 	//"fmt"
 	"encoding/json"
+	"errors"
 	"fmt"
 	gometaC "github.com/couchbase/gometa/common"
 	gometaL "github.com/couchbase/gometa/log"
@@ -89,10 +90,26 @@ type IndexManager struct {
 //    A) Both index definition and index instance exist.
 //    B) Index Instance is not in INDEX_STATE_CREATE or INDEX_STATE_DELETED.
 //
+// 6) Pause/Cancel Index Build
+//    A) Only an index in INDEX_STATE_INITIAL or INDEX_STATE_CATCHUP can be paused or cancelled.  A queued index is
+//       simply removed from the build queue.
+//    B) IndexManager will invoke MetadataNotifier.OnIndexBuildPause() or OnIndexBuildCancel().  The index is removed
+//       from its streams and moved back to INDEX_STATE_READY.
+//    C) A paused index keeps its data.  When it is built again, the build resumes from its last snapshot.  A cancelled
+//       index discards its data, and a later build starts over.
+//
+// 7) Rename Index
+//    A) The new name must not be used by another index of the same bucket.
+//    B) IndexManager will invoke MetadataNotifier.OnIndexRename().  The index data is kept, and the index is not
+//       rebuilt.
+//
 type MetadataNotifier interface {
 	OnIndexCreate(*common.IndexDefn) error
 	OnIndexDelete(common.IndexDefnId, string) error
 	OnIndexBuild([]common.IndexDefnId, []string) map[common.IndexInstId]error
+	OnIndexBuildPause(common.IndexDefnId, string) error
+	OnIndexBuildCancel(common.IndexDefnId, string) error
+	OnIndexRename(common.IndexDefnId, string, string) error
 }
 
 type RequestServer interface {
@@ -144,7 +161,7 @@ func NewIndexManagerInternal(
 
 	// Initialize LifecycleMgr.
 	clusterURL := config["clusterAddr"].String()
-	mgr.lifecycleMgr = NewLifecycleMgr(addrProvider, nil, clusterURL)
+	mgr.lifecycleMgr = NewLifecycleMgr(addrProvider, nil, clusterURL, config)
 
 	// Initialize MetadataRepo.  This a blocking call until the
 	// the metadataRepo (including watcher) is operational (e.g.
@@ -268,6 +285,13 @@ func (m *IndexManager) RegisterNotifier(notifier MetadataNotifier) {
 	m.lifecycleMgr.RegisterNotifier(notifier)
 }
 
+//
+// Apply new indexer settings
+//
+func (m *IndexManager) ResetConfig(config common.Config) {
+	m.lifecycleMgr.ResetConfig(config)
+}
+
 func (m *IndexManager) SetLocalValue(key string, value string) error {
 	return m.repo.SetLocalValue(key, value)
 }
@@ -287,6 +311,14 @@ func (m *IndexManager) GetIndexDefnById(id common.IndexDefnId) (*common.IndexDef
 	return m.repo.GetIndexDefnById(id)
 }
 
+//
+// Get an index definiton by bucket and name
+//
+func (m *IndexManager) GetIndexDefnByName(bucket string, scope string, collection string,
+	name string) (*common.IndexDefn, error) {
+	return m.repo.GetIndexDefnByName(bucket, scope, collection, name)
+}
+
 //
 // Get Metadata Iterator for index definition
 //
@@ -403,6 +435,60 @@ func (m *IndexManager) HandleDeleteIndexDDL(defnId common.IndexDefnId) error {
 	return nil
 }
 
+//
+// Rename an index on this node.
+//
+func (m *IndexManager) HandleRenameIndex(defnId common.IndexDefnId, name string) error {
+
+	return m.requestServer.MakeRequest(client.OPCODE_RENAME_INDEX, fmt.Sprintf("%d", defnId), []byte(name))
+}
+
+//
+// Pause or cancel the build of an index on this node.
+//
+func (m *IndexManager) HandleStopIndexBuild(defnId common.IndexDefnId, cancel bool) error {
+
+	content, err := client.MarshallIndexIdList(client.BuildIndexIdList([]common.IndexDefnId{defnId}))
+	if err != nil {
+		return err
+	}
+
+	opCode := client.OPCODE_PAUSE_BUILD_INDEX
+	if cancel {
+		opCode = client.OPCODE_CANCEL_BUILD_INDEX
+	}
+
+	return m.requestServer.MakeRequest(opCode, fmt.Sprintf("%d", defnId), content)
+}
+
+//
+// Resume the paused build of an index on this node.
+//
+func (m *IndexManager) HandleResumeIndexBuild(defnId common.IndexDefnId) error {
+
+	defn, err := m.repo.GetIndexDefnById(defnId)
+	if err != nil || defn == nil {
+		return errors.New("Index does not exist.")
+	}
+
+	topology, err := m.repo.GetTopologyByBucket(defn.Bucket)
+	if err != nil || topology == nil {
+		return errors.New("Index does not exist.")
+	}
+
+	inst := topology.GetIndexInstByDefn(defnId)
+	if inst == nil || inst.State != uint32(common.INDEX_STATE_READY) || !inst.Paused {
+		return fmt.Errorf("Index %s build is not paused.", defn.Name)
+	}
+
+	content, err := client.MarshallIndexIdList(client.BuildIndexIdList([]common.IndexDefnId{defnId}))
+	if err != nil {
+		return err
+	}
+
+	return m.requestServer.MakeRequest(client.OPCODE_BUILD_INDEX, "Index Build", content)
+}
+
 func (m *IndexManager) UpdateIndexInstance(bucket string, defnId common.IndexDefnId, state common.IndexState,
 	streamId common.StreamId, err string, buildTime []uint64) error {
 
@@ -32,6 +32,7 @@ type MetadataRepo struct {
 	defnCache  map[common.IndexDefnId]*common.IndexDefn
 	topoCache  map[string]*IndexTopology
 	globalTopo *GlobalTopology
+	buildQueue *BuildQueue
 }
 
 type RepoRef interface {
@@ -105,7 +106,8 @@ func NewMetadataRepo(requestAddr string,
 		isClosed:   false,
 		defnCache:  make(map[common.IndexDefnId]*common.IndexDefn),
 		topoCache:  make(map[string]*IndexTopology),
-		globalTopo: nil}
+		globalTopo: nil,
+		buildQueue: new(BuildQueue)}
 
 	if err := repo.loadDefn(); err != nil {
 		return nil, err
@@ -115,6 +117,10 @@ func NewMetadataRepo(requestAddr string,
 		return nil, err
 	}
 
+	if err := repo.loadBuildQueue(); err != nil {
+		return nil, err
+	}
+
 	return repo, nil
 }
 
@@ -132,7 +138,8 @@ func NewLocalMetadataRepo(msgAddr string,
 		isClosed:   false,
 		defnCache:  make(map[common.IndexDefnId]*common.IndexDefn),
 		topoCache:  make(map[string]*IndexTopology),
-		globalTopo: nil}
+		globalTopo: nil,
+		buildQueue: new(BuildQueue)}
 
 	if err := repo.loadDefn(); err != nil {
 		return nil, nil, err
@@ -142,6 +149,10 @@ func NewLocalMetadataRepo(msgAddr string,
 		return nil, nil, err
 	}
 
+	if err := repo.loadBuildQueue(); err != nil {
+		return nil, nil, err
+	}
+
 	return repo, ref.server, nil
 }
 
@@ -255,13 +266,15 @@ func (c *MetadataRepo) GetIndexDefnById(id common.IndexDefnId) (*common.IndexDef
 	return defn, nil
 }
 
-func (c *MetadataRepo) GetIndexDefnByName(bucket string, name string) (*common.IndexDefn, error) {
+func (c *MetadataRepo) GetIndexDefnByName(bucket string, scope string, collection string,
+	name string) (*common.IndexDefn, error) {
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	keyspace := common.Keyspace(bucket, scope, collection)
 	for _, defn := range c.defnCache {
-		if defn.Name == name && defn.Bucket == bucket {
+		if defn.Name == name && common.Keyspace(defn.Bucket, defn.Scope, defn.Collection) == keyspace {
 			return defn, nil
 		}
 	}
@@ -358,6 +371,35 @@ func (c *MetadataRepo) SetGlobalTopology(topology *GlobalTopology) error {
 	return nil
 }
 
+///////////////////////////////////////////////////////
+//  Public Function : Build Queue
+///////////////////////////////////////////////////////
+
+func (c *MetadataRepo) GetBuildQueue() *BuildQueue {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.buildQueue.clone()
+}
+
+func (c *MetadataRepo) SetBuildQueue(queue *BuildQueue) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data, err := marshallBuildQueue(queue)
+	if err != nil {
+		return err
+	}
+
+	lookupName := buildQueueKey()
+	if err := c.setMeta(lookupName, data); err != nil {
+		return err
+	}
+
+	c.buildQueue = queue.clone()
+	return nil
+}
+
 ///////////////////////////////////////////////////////
 //  Public Function : Index DDL
 ///////////////////////////////////////////////////////
@@ -395,6 +437,34 @@ func (c *MetadataRepo) CreateIndex(defn *common.IndexDefn) error {
 	return nil
 }
 
+func (c *MetadataRepo) UpdateIndexDefn(defn *common.IndexDefn) error {
+
+	// check if defn already exist
+	exist, _ := c.GetIndexDefnById(defn.DefnId)
+	if exist == nil {
+		return NewError(ERROR_META_IDX_DEFN_NOT_EXIST, NORMAL, METADATA_REPO, nil,
+			fmt.Sprintf("Index Definition '%s' does not exist", defn.Name))
+	}
+
+	// marshall the defn
+	data, err := common.MarshallIndexDefn(defn)
+	if err != nil {
+		return err
+	}
+
+	lookupName := indexDefnKeyById(defn.DefnId)
+	if err := c.setMeta(lookupName, data); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.defnCache[defn.DefnId] = defn
+
+	return nil
+}
+
 func (c *MetadataRepo) DropIndexById(id common.IndexDefnId) error {
 
 	// check if defn already exist
@@ -476,6 +546,31 @@ func (c *MetadataRepo) loadTopology() error {
 	}
 }
 
+func (c *MetadataRepo) loadBuildQueue() error {
+
+	iter, err := c.repo.newIterator()
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for {
+		key, content, err := iter.Next()
+		if err != nil {
+			return nil
+		}
+
+		if isBuildQueueKey(key) {
+			queue, err := unmarshallBuildQueue(content)
+			if err != nil {
+				return err
+			}
+
+			c.buildQueue = queue
+		}
+	}
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Public Function : RepoIterator
 /////////////////////////////////////////////////////////////////////////////
@@ -908,6 +1003,18 @@ func unmarshallGlobalTopology(data []byte) (*GlobalTopology, error) {
 	return topology, nil
 }
 
+///////////////////////////////////////////////////////
+// package local function : Build Queue
+///////////////////////////////////////////////////////
+
+func buildQueueKey() string {
+	return "IndexBuildQueue"
+}
+
+func isBuildQueueKey(key string) bool {
+	return strings.Contains(key, "IndexBuildQueue")
+}
+
 ///////////////////////////////////////////////////////////
 // package local function : Index Definition and Topology
 ///////////////////////////////////////////////////////////
@@ -931,7 +1038,7 @@ func (m *MetadataRepo) addIndexToTopology(defn *common.IndexDefn, id common.Inde
 		return err
 	}
 
-	topology.AddIndexDefinition(defn.Bucket, defn.Name, uint64(defn.DefnId),
+	topology.AddIndexDefinition(defn.Bucket, defn.Scope, defn.Collection, defn.Name, uint64(defn.DefnId),
 		uint64(id), uint32(common.INDEX_STATE_CREATED), string(indexerId))
 
 	// Add a reference of the bucket-level topology to the global topology.
@@ -30,7 +30,7 @@ import (
 ///////////////////////////////////////////////////////
 
 //
-// Index create / drop
+// Index create / drop / rename
 //
 
 type RequestType string
@@ -38,12 +38,14 @@ type RequestType string
 const (
 	CREATE RequestType = "create"
 	DROP   RequestType = "drop"
+	RENAME RequestType = "rename"
 )
 
 type IndexRequest struct {
 	Version uint64           `json:"version,omitempty"`
 	Type    RequestType      `json:"type,omitempty"`
 	Index   common.IndexDefn `json:"index,omitempty"`
+	NewName string           `json:"newName,omitempty"`
 }
 
 type IndexResponse struct {
@@ -61,6 +63,7 @@ type LocalIndexMetadata struct {
 	NodeUUID         string             `json:"nodeUUID,omitempty"`
 	IndexTopologies  []IndexTopology    `json:"topologies,omitempty"`
 	IndexDefinitions []common.IndexDefn `json:"definitions,omitempty"`
+	BuildQueue       *BuildQueue        `json:"buildQueue,omitempty"`
 }
 
 type ClusterIndexMetadata struct {
@@ -110,6 +113,7 @@ type IndexStatus struct {
 	Hosts      []string           `json:"hosts,omitempty"`
 	Error      string             `json:"error,omitempty"`
 	Completion int                `json:"completion"`
+	QueuePos   int                `json:"queuePosition,omitempty"`
 }
 
 type indexStatusSorter []IndexStatus
@@ -150,6 +154,10 @@ func registerRequestHandler(mgr *IndexManager, clusterUrl string) {
 
 		http.HandleFunc("/createIndex", handlerContext.createIndexRequest)
 		http.HandleFunc("/dropIndex", handlerContext.dropIndexRequest)
+		http.HandleFunc("/renameIndex", handlerContext.renameIndexRequest)
+		http.HandleFunc("/pauseIndexBuild", handlerContext.pauseIndexBuildRequest)
+		http.HandleFunc("/resumeIndexBuild", handlerContext.resumeIndexBuildRequest)
+		http.HandleFunc("/cancelIndexBuild", handlerContext.cancelIndexBuildRequest)
 		http.HandleFunc("/getLocalIndexMetadata", handlerContext.handleLocalIndexMetadataRequest)
 		http.HandleFunc("/getIndexMetadata", handlerContext.handleIndexMetadataRequest)
 		http.HandleFunc("/restoreIndexMetadata", handlerContext.handleRestoreIndexMetadataRequest)
@@ -225,6 +233,93 @@ func (m *requestHandlerContext) dropIndexRequest(w http.ResponseWriter, r *http.
 	}
 }
 
+//
+// The index to rename is identified by its id, or by its bucket and name.
+//
+func (m *requestHandlerContext) renameIndexRequest(w http.ResponseWriter, r *http.Request) {
+
+	if !doAuth(r, w, m.clusterUrl) {
+		return
+	}
+
+	// convert request
+	request := m.convertIndexRequest(r)
+	if request == nil {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Unable to convert request for rename index")
+		return
+	}
+
+	indexDefn := request.Index
+	if indexDefn.DefnId == 0 {
+		defn, err := m.mgr.GetIndexDefnByName(indexDefn.Bucket, indexDefn.Scope,
+			indexDefn.Collection, indexDefn.Name)
+		if err != nil || defn == nil {
+			sendIndexResponseWithError(http.StatusBadRequest, w, "Index does not exist.")
+			return
+		}
+		indexDefn.DefnId = defn.DefnId
+	}
+
+	// call the index manager to handle the DDL
+	if err := m.mgr.HandleRenameIndex(indexDefn.DefnId, request.NewName); err == nil {
+		// No error, return success
+		sendIndexResponse(w)
+	} else {
+		// report failure
+		sendIndexResponseWithError(http.StatusInternalServerError, w, fmt.Sprintf("%v", err))
+	}
+}
+
+///////////////////////////////////////////////////////
+// Pause / Resume / Cancel Index Build
+///////////////////////////////////////////////////////
+
+func (m *requestHandlerContext) pauseIndexBuildRequest(w http.ResponseWriter, r *http.Request) {
+
+	m.indexBuildRequest(w, r, "pause", func(defnId common.IndexDefnId) error {
+		return m.mgr.HandleStopIndexBuild(defnId, false)
+	})
+}
+
+func (m *requestHandlerContext) resumeIndexBuildRequest(w http.ResponseWriter, r *http.Request) {
+
+	m.indexBuildRequest(w, r, "resume", m.mgr.HandleResumeIndexBuild)
+}
+
+func (m *requestHandlerContext) cancelIndexBuildRequest(w http.ResponseWriter, r *http.Request) {
+
+	m.indexBuildRequest(w, r, "cancel", func(defnId common.IndexDefnId) error {
+		return m.mgr.HandleStopIndexBuild(defnId, true)
+	})
+}
+
+func (m *requestHandlerContext) indexBuildRequest(w http.ResponseWriter, r *http.Request, op string,
+	handler func(common.IndexDefnId) error) {
+
+	if !doAuth(r, w, m.clusterUrl) {
+		return
+	}
+
+	// convert request
+	request := m.convertIndexRequest(r)
+	if request == nil {
+		sendIndexResponseWithError(http.StatusBadRequest, w, fmt.Sprintf("Unable to convert request for %v index build", op))
+		return
+	}
+
+	// call the index manager to handle the request
+	indexDefn := request.Index
+	logging.Debugf("RequestHandler::indexBuildRequest: invoke IndexManager for %v index build %v", op, indexDefn.DefnId)
+
+	if err := handler(indexDefn.DefnId); err == nil {
+		// No error, return success
+		sendIndexResponse(w)
+	} else {
+		// report failure
+		sendIndexResponseWithError(http.StatusInternalServerError, w, fmt.Sprintf("%v", err))
+	}
+}
+
 func (m *requestHandlerContext) convertIndexRequest(r *http.Request) *IndexRequest {
 
 	req := &IndexRequest{}
@@ -335,6 +430,12 @@ func (m *requestHandlerContext) getIndexStatus(cinfo *common.ClusterInfoCache, b
 				}
 
 				if topology := m.findTopologyByBucket(localMeta.IndexTopologies, defn.Bucket); topology != nil {
+
+					// the shadow index of an index being altered is hidden
+					if defnRef := topology.FindIndexDefinitionById(defn.DefnId); defnRef != nil && defnRef.ShadowOf != 0 {
+						continue
+					}
+
 					state, errStr := topology.GetStatusByDefn(defn.DefnId)
 
 					if state != common.INDEX_STATE_CREATED &&
@@ -361,6 +462,18 @@ func (m *requestHandlerContext) getIndexStatus(cinfo *common.ClusterInfoCache, b
 							}
 						}
 
+						if inst := topology.GetIndexInstByDefn(defn.DefnId); inst != nil &&
+							inst.Paused && state == common.INDEX_STATE_READY {
+							stateStr = "Build Paused"
+						}
+
+						queuePos := 0
+						if localMeta.BuildQueue != nil && state == common.INDEX_STATE_READY {
+							if queuePos = localMeta.BuildQueue.Position(defn.DefnId); queuePos != 0 {
+								stateStr = "Queued"
+							}
+						}
+
 						if len(errStr) != 0 {
 							stateStr = "Error"
 						}
@@ -384,6 +497,7 @@ func (m *requestHandlerContext) getIndexStatus(cinfo *common.ClusterInfoCache, b
 							Hosts:      []string{curl},
 							Definition: common.IndexStatement(defn),
 							Completion: completion,
+							QueuePos:   queuePos,
 						}
 
 						list = append(list, status)
@@ -566,6 +680,14 @@ func (m *requestHandlerContext) getLocalIndexMetadata(bucket string) (meta *Loca
 		topology, err = iter1.Next()
 	}
 
+	queue := repo.GetBuildQueue()
+	if len(bucket) != 0 {
+		queue = queue.filter(bucket)
+	}
+	if len(queue.Entries) != 0 {
+		meta.BuildQueue = queue
+	}
+
 	return meta, nil
 }
 
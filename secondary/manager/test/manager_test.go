@@ -66,14 +66,14 @@ func TestIndexManager(t *testing.T) {
 	plan := make(map[string]interface{})
 	plan["nodes"] = []string{msgAddr}
 	plan["defer_build"] = true
-	newDefnId101, err := provider.CreateIndexWithPlan("manager_test_101", "Default", common.ForestDB,
+	newDefnId101, err := provider.CreateIndexWithPlan("manager_test_101", "Default", "", "", common.ForestDB,
 		common.N1QL, "Testing", "TestingWhereExpr", []string{"Testing"}, false, plan)
 	if err != nil {
 		t.Fatal("Cannot create Index Defn 101 through MetadataProvider")
 	}
 	runIterator(mgr, t, 1)
 
-	newDefnId102, err := provider.CreateIndexWithPlan("manager_test_102", "Default", common.ForestDB,
+	newDefnId102, err := provider.CreateIndexWithPlan("manager_test_102", "Default", "", "", common.ForestDB,
 		common.N1QL, "Testing", "TestingWhereExpr", []string{"Testing"}, false, plan)
 	if err != nil {
 		t.Fatal("Cannot create Index Defn 102 through MetadataProvider")
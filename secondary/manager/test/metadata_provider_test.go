@@ -117,7 +117,7 @@ func TestMetadataProvider(t *testing.T) {
 	plan := make(map[string]interface{})
 	plan["nodes"] = []interface{}{msgAddr}
 	plan["defer_build"] = true
-	newDefnId, err := provider.CreateIndexWithPlan("metadata_provider_test_102", "Default", common.ForestDB,
+	newDefnId, err := provider.CreateIndexWithPlan("metadata_provider_test_102", "Default", "", "", common.ForestDB,
 		common.N1QL, "Testing", "TestingWhereExpr", []string{"Testing"}, false, plan)
 	if err != nil {
 		t.Fatal("Cannot create Index Defn 102 through MetadataProvider" + err.Error())
@@ -136,7 +136,7 @@ func TestMetadataProvider(t *testing.T) {
 	logging.Infof("done dropping index 101")
 
 	// Create Index (immediate).
-	newDefnId2, err := provider.CreateIndexWithPlan("metadata_provider_test_103", "Default", common.ForestDB,
+	newDefnId2, err := provider.CreateIndexWithPlan("metadata_provider_test_103", "Default", "", "", common.ForestDB,
 		common.N1QL, "Testing", "TestingWhereExpr", []string{"Testing"}, false, nil)
 	if err != nil {
 		t.Fatal("Cannot create Index Defn 103 through MetadataProvider")
@@ -156,7 +156,7 @@ func TestMetadataProvider(t *testing.T) {
 	logging.Infof("done updating index 103")
 
 	// Create Index (immediate).  This index is supposed to fail by OnIndexBuild()
-	if _, err := provider.CreateIndexWithPlan("metadata_provider_test_104", "Default", common.ForestDB,
+	if _, err := provider.CreateIndexWithPlan("metadata_provider_test_104", "Default", "", "", common.ForestDB,
 		common.N1QL, "Testing", "Testing", []string{"Testing"}, false, nil); err == nil {
 		t.Fatal("Error does not propage for create Index Defn 104 through MetadataProvider")
 	}
@@ -228,7 +228,7 @@ func TestMetadataProvider(t *testing.T) {
 
 	// Create Index (immediate).
 
-	newDefnId105, err := provider.CreateIndexWithPlan("metadata_provider_test_105", "Default", common.ForestDB,
+	newDefnId105, err := provider.CreateIndexWithPlan("metadata_provider_test_105", "Default", "", "", common.ForestDB,
 		common.N1QL, "Testing", "TestingWhereExpr", []string{"Testing"}, false, nil)
 	if err == nil {
 		t.Fatal("Does not receive timeout error for create Index Defn 105 through MetadataProvider")
@@ -31,10 +31,15 @@ type IndexTopology struct {
 }
 
 type IndexDefnDistribution struct {
-	Bucket    string                  `json:"bucket,omitempty"`
-	Name      string                  `json:"name,omitempty"`
-	DefnId    uint64                  `json:"defnId,omitempty"`
-	Instances []IndexInstDistribution `json:"instances,omitempty"`
+	Bucket          string                  `json:"bucket,omitempty"`
+	Scope           string                  `json:"scope,omitempty"`
+	Collection      string                  `json:"collection,omitempty"`
+	Name            string                  `json:"name,omitempty"`
+	DefnId          uint64                  `json:"defnId,omitempty"`
+	ShadowOf        uint64                  `json:"shadowOf,omitempty"`
+	RollbackOnError bool                    `json:"rollbackOnError,omitempty"`
+	Aliases         []uint64                `json:"aliases,omitempty"`
+	Instances       []IndexInstDistribution `json:"instances,omitempty"`
 }
 
 type IndexInstDistribution struct {
@@ -42,6 +47,7 @@ type IndexInstDistribution struct {
 	State      uint32                  `json:"state,omitempty"`
 	StreamId   uint32                  `json:"steamId,omitempty"`
 	Error      string                  `json:"error,omitempty"`
+	Paused     bool                    `json:"paused,omitempty"`
 	Partitions []IndexPartDistribution `json:"partitions,omitempty"`
 }
 
@@ -104,6 +110,13 @@ func (g *GlobalTopology) RemoveTopologyKey(key string) {
 	}
 }
 
+//
+// Keyspace of the index definition, i.e. bucket.scope.collection
+//
+func (d *IndexDefnDistribution) Keyspace() string {
+	return common.Keyspace(d.Bucket, d.Scope, d.Collection)
+}
+
 /////////////////////////////////////////////////////////////////////////
 // Topology Maintenance
 ////////////////////////////////////////////////////////////////////////
@@ -111,9 +124,10 @@ func (g *GlobalTopology) RemoveTopologyKey(key string) {
 //
 // Add an index definition to Topology.
 //
-func (t *IndexTopology) AddIndexDefinition(bucket string, name string, defnId uint64, instId uint64, state uint32, indexerId string) {
+func (t *IndexTopology) AddIndexDefinition(bucket string, scope string, collection string, name string,
+	defnId uint64, instId uint64, state uint32, indexerId string) {
 
-	t.RemoveIndexDefinition(bucket, name)
+	t.RemoveIndexDefinition(bucket, scope, collection, name)
 
 	slice := new(IndexSliceLocator)
 	slice.SliceId = 0
@@ -131,6 +145,8 @@ func (t *IndexTopology) AddIndexDefinition(bucket string, name string, defnId ui
 
 	defn := new(IndexDefnDistribution)
 	defn.Bucket = bucket
+	defn.Scope = scope
+	defn.Collection = collection
 	defn.Name = name
 	defn.DefnId = defnId
 	defn.Instances = append(defn.Instances, *inst)
@@ -141,10 +157,11 @@ func (t *IndexTopology) AddIndexDefinition(bucket string, name string, defnId ui
 //
 // Remove an index definition to Topology.
 //
-func (t *IndexTopology) RemoveIndexDefinition(bucket string, name string) {
+func (t *IndexTopology) RemoveIndexDefinition(bucket string, scope string, collection string, name string) {
 
+	keyspace := common.Keyspace(bucket, scope, collection)
 	for i, defnRef := range t.Definitions {
-		if defnRef.Bucket == bucket && defnRef.Name == name {
+		if defnRef.Keyspace() == keyspace && defnRef.Name == name {
 			if i == len(t.Definitions)-1 {
 				t.Definitions = t.Definitions[:i]
 			} else {
@@ -172,10 +189,11 @@ func (t *IndexTopology) RemoveIndexDefinitionById(id common.IndexDefnId) {
 //
 // Get all index instance Id's for a specific defnition
 //
-func (t *IndexTopology) FindIndexDefinition(bucket string, name string) *IndexDefnDistribution {
+func (t *IndexTopology) FindIndexDefinition(bucket string, scope string, collection string, name string) *IndexDefnDistribution {
 
+	keyspace := common.Keyspace(bucket, scope, collection)
 	for _, defnRef := range t.Definitions {
-		if defnRef.Bucket == bucket && defnRef.Name == name {
+		if defnRef.Keyspace() == keyspace && defnRef.Name == name {
 			return &defnRef
 		}
 	}
@@ -274,6 +292,110 @@ func (t *IndexTopology) SetErrorForIndexInstByDefn(defnId common.IndexDefnId, er
 	return changed
 }
 
+//
+// Mark a paused index build on instance
+//
+func (t *IndexTopology) SetPausedForIndexInstByDefn(defnId common.IndexDefnId, paused bool) bool {
+
+	changed := false
+	for i, _ := range t.Definitions {
+		if t.Definitions[i].DefnId == uint64(defnId) {
+			for j, _ := range t.Definitions[i].Instances {
+				if t.Definitions[i].Instances[j].Paused != paused {
+					t.Definitions[i].Instances[j].Paused = paused
+					logging.Debugf("IndexTopology.SetPausedForIndexInstByDefn(): Set paused for index '%v' inst '%v' to '%v'",
+						defnId, t.Definitions[i].Instances[j].InstId, paused)
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+//
+// Rename an index definition
+//
+func (t *IndexTopology) RenameIndexDefinition(defnId common.IndexDefnId, name string) bool {
+
+	for i, _ := range t.Definitions {
+		if t.Definitions[i].DefnId == uint64(defnId) {
+			if t.Definitions[i].Name != name {
+				t.Definitions[i].Name = name
+				logging.Debugf("IndexTopology.RenameIndexDefinition(): Rename index '%v' to '%v'", defnId, name)
+				return true
+			}
+			return false
+		}
+	}
+	return false
+}
+
+//
+// Mark an index definition as the shadow of an index being altered
+//
+func (t *IndexTopology) SetShadowForIndexDefn(defnId common.IndexDefnId, shadowOf common.IndexDefnId, rollback bool) bool {
+
+	for i, _ := range t.Definitions {
+		if t.Definitions[i].DefnId == uint64(defnId) {
+			t.Definitions[i].ShadowOf = uint64(shadowOf)
+			t.Definitions[i].RollbackOnError = rollback
+			logging.Debugf("IndexTopology.SetShadowForIndexDefn(): Set index '%v' as shadow of index '%v'", defnId, shadowOf)
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Get the shadow index definition of an index being altered
+//
+func (t *IndexTopology) FindShadowIndexDefinition(id common.IndexDefnId) *IndexDefnDistribution {
+
+	for _, defnRef := range t.Definitions {
+		if defnRef.ShadowOf == uint64(id) {
+			return &defnRef
+		}
+	}
+	return nil
+}
+
+//
+// Swap a shadow index definition with the index that it alters.  The shadow takes
+// over the name of the index, and keeps the id of the index (and its aliases) as
+// aliases.  The index being altered is marked as deleted.
+//
+func (t *IndexTopology) SwapShadowIndexDefinition(shadowId common.IndexDefnId, name string) bool {
+
+	shadow := -1
+	for i, _ := range t.Definitions {
+		if t.Definitions[i].DefnId == uint64(shadowId) {
+			shadow = i
+		}
+	}
+
+	if shadow == -1 || t.Definitions[shadow].ShadowOf == 0 {
+		return false
+	}
+
+	for i, _ := range t.Definitions {
+		if t.Definitions[i].DefnId == t.Definitions[shadow].ShadowOf {
+			for j, _ := range t.Definitions[i].Instances {
+				t.Definitions[i].Instances[j].State = uint32(common.INDEX_STATE_DELETED)
+			}
+			t.Definitions[shadow].Aliases = append(append([]uint64(nil), t.Definitions[i].Aliases...), t.Definitions[i].DefnId)
+		}
+	}
+
+	logging.Debugf("IndexTopology.SwapShadowIndexDefinition(): Swap index '%v' with shadow index '%v'",
+		t.Definitions[shadow].ShadowOf, shadowId)
+
+	t.Definitions[shadow].Name = name
+	t.Definitions[shadow].ShadowOf = 0
+	t.Definitions[shadow].RollbackOnError = false
+	return true
+}
+
 //
 // Update Index Status on instance
 //
@@ -520,6 +642,16 @@ func convertIndexDefnToProtoMsg(indexDefn *common.IndexDefn) *protobuf.IndexDefn
 		SecExpressions:  indexDefn.SecExprs,
 		PartitionScheme: partnScheme,
 		PartnExpression: proto.String(indexDefn.PartitionKey),
+		Scope:           proto.String(indexDefn.Scope),
+		ScopeID:         proto.String(indexDefn.ScopeId),
+		Collection:      proto.String(indexDefn.Collection),
+		CollectionID:    proto.String(indexDefn.CollectionId),
+		IsAdaptive:      proto.Bool(indexDefn.IsAdaptive),
+		FieldPrefixes:   indexDefn.FieldPrefixes,
+		MaxFields:       proto.Uint32(uint32(indexDefn.MaxFields)),
+		MaxValueSize:    proto.Uint32(uint32(indexDefn.MaxValueSize)),
+		Immutable:       proto.Bool(indexDefn.Immutable),
+		WhereImmutable:  proto.Bool(indexDefn.WhereImmutable),
 	}
 
 	return defn
@@ -0,0 +1,116 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func newTestTopology(names ...string) *IndexTopology {
+	topology := &IndexTopology{Bucket: "default"}
+	for i, name := range names {
+		id := uint64(i + 1)
+		topology.AddIndexDefinition("default", "", "", name, id, id, uint32(common.INDEX_STATE_READY), "indexer1")
+	}
+	return topology
+}
+
+func TestTopologyPaused(t *testing.T) {
+	topology := newTestTopology("idx1", "idx2")
+
+	if topology.SetPausedForIndexInstByDefn(1, false) {
+		t.Errorf("expected no change for index not paused")
+	}
+	if !topology.SetPausedForIndexInstByDefn(1, true) || !topology.GetIndexInstByDefn(1).Paused {
+		t.Fatalf("expected index 1 paused")
+	}
+	if topology.SetPausedForIndexInstByDefn(1, true) {
+		t.Errorf("expected no change for index already paused")
+	}
+	if topology.GetIndexInstByDefn(2).Paused {
+		t.Errorf("expected index 2 not paused")
+	}
+	if topology.SetPausedForIndexInstByDefn(3, true) {
+		t.Errorf("expected no change for unknown index")
+	}
+
+	//paused flag is persisted with the topology
+	buf, err := MarshallIndexTopology(topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topology, err = unmarshallIndexTopology(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !topology.GetIndexInstByDefn(1).Paused || topology.GetIndexInstByDefn(2).Paused {
+		t.Errorf("unexpected paused flag after unmarshall")
+	}
+
+	if !topology.SetPausedForIndexInstByDefn(1, false) || topology.GetIndexInstByDefn(1).Paused {
+		t.Errorf("expected index 1 resumed")
+	}
+}
+
+func TestTopologyShadowSwap(t *testing.T) {
+	topology := newTestTopology("idx1", "idx2")
+
+	if topology.FindShadowIndexDefinition(1) != nil {
+		t.Errorf("expected no shadow for index not altered")
+	}
+	if topology.SwapShadowIndexDefinition(2, "idx1") {
+		t.Errorf("expected no swap for index that is not a shadow")
+	}
+	if topology.SetShadowForIndexDefn(3, 1, true) {
+		t.Errorf("expected no shadow set for unknown index")
+	}
+
+	if !topology.SetShadowForIndexDefn(2, 1, true) {
+		t.Fatalf("expected index 2 set as shadow of index 1")
+	}
+	if shadow := topology.FindShadowIndexDefinition(1); shadow == nil || shadow.DefnId != 2 || !shadow.RollbackOnError {
+		t.Fatalf("unexpected shadow %v for index 1", shadow)
+	}
+	if topology.FindShadowIndexDefinition(2) != nil {
+		t.Errorf("expected no shadow for shadow index")
+	}
+
+	if !topology.SwapShadowIndexDefinition(2, "idx1") {
+		t.Fatalf("expected shadow index swapped")
+	}
+	defnRef := topology.FindIndexDefinitionById(2)
+	if defnRef.Name != "idx1" || defnRef.ShadowOf != 0 || defnRef.RollbackOnError ||
+		len(defnRef.Aliases) != 1 || defnRef.Aliases[0] != 1 {
+		t.Errorf("unexpected shadow index %v after swap", defnRef)
+	}
+	if state, _ := topology.GetStatusByDefn(1); state != common.INDEX_STATE_DELETED {
+		t.Errorf("expected altered index deleted, got %v", state)
+	}
+	if state, _ := topology.GetStatusByDefn(2); state != common.INDEX_STATE_READY {
+		t.Errorf("expected shadow index state unchanged, got %v", state)
+	}
+	if topology.FindShadowIndexDefinition(1) != nil || topology.SwapShadowIndexDefinition(2, "idx1") {
+		t.Errorf("expected swap done once")
+	}
+
+	//an index altered again keeps the ids of the indexes it replaces
+	topology.RemoveIndexDefinitionById(1)
+	topology.AddIndexDefinition("default", "", "", "idx1#alter#3", 3, 3, uint32(common.INDEX_STATE_READY), "indexer1")
+	topology.SetShadowForIndexDefn(3, 2, false)
+	if !topology.SwapShadowIndexDefinition(3, "idx1") {
+		t.Fatalf("expected shadow index swapped")
+	}
+	if defnRef := topology.FindIndexDefinitionById(3); defnRef.Name != "idx1" ||
+		len(defnRef.Aliases) != 2 || defnRef.Aliases[0] != 1 || defnRef.Aliases[1] != 2 {
+		t.Errorf("unexpected shadow index %v after swap", defnRef)
+	}
+}
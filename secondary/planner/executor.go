@@ -16,6 +16,7 @@ import (
 	"github.com/couchbase/cbauth/service"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
+	"io"
 	"io/ioutil"
 	"math"
 	"math/rand"
@@ -46,6 +47,7 @@ type RunConfig struct {
 	MaxCpuUse      int
 	MemQuota       int64
 	CpuQuota       int
+	DiskQuota      int64
 	DataCostWeight float64
 	CpuCostWeight  float64
 	MemCostWeight  float64
@@ -81,6 +83,7 @@ type Plan struct {
 	Placement []*IndexerNode `json:"placement,omitempty"`
 	MemQuota  uint64         `json:"memQuota,omitempty"`
 	CpuQuota  uint64         `json:"cpuQuota,omitempty"`
+	DiskQuota uint64         `json:"diskQuota,omitempty"`
 	IsLive    bool           `json:"isLive,omitempty"`
 }
 
@@ -94,6 +97,7 @@ type IndexSpec struct {
 	Deferred     bool     `json:"deferred,omitempty"`
 	Immutable    bool     `json:"immutable,omitempty"`
 	IsArrayIndex bool     `json:"isArrayIndex,omitempty"`
+	Using        string   `json:"using,omitempty"`
 
 	// usage
 	Replica      uint64 `json:"replica,omitempty"`
@@ -104,6 +108,25 @@ type IndexSpec struct {
 	ArrSize      uint64 `json:"arrSize,omitempty"`
 	MutationRate uint64 `json:"mutationRate,omitempty"`
 	ScanRate     uint64 `json:"scanRate,omitempty"`
+	ResidentPct  uint64 `json:"residentPercent,omitempty"`
+}
+
+//
+// PlanResult is the outcome of a planner run, for tools that report on
+// placement instead of reading it off the log.
+//
+type PlanResult struct {
+	Placement   []*IndexerNode `json:"placement,omitempty"`
+	UseLiveData bool           `json:"useLiveData,omitempty"`
+	MemQuota    uint64         `json:"memQuota,omitempty"`
+	CpuQuota    uint64         `json:"cpuQuota,omitempty"`
+	DiskQuota   uint64         `json:"diskQuota,omitempty"`
+	Score       float64        `json:"score"`
+	ElapseTime  uint64         `json:"elapsedTime"`
+	Try         uint64         `json:"try"`
+	Violations  *Violations    `json:"violations,omitempty"`
+	Stats       *RunStats      `json:"stats,omitempty"`
+	DDL         string         `json:"ddl,omitempty"`
 }
 
 //////////////////////////////////////////////////////////////
@@ -254,12 +277,52 @@ func ExecuteRebalanceWithOptions(plan *Plan, indexSpecs []*IndexSpec, detail boo
 	return err
 }
 
+//
+// ExecuteWithResult runs the planner and returns the placement, violations, run stats and
+// DDL for new indexes.  If the planner cannot satisfy the constraints, the result is
+// returned along with the violations as error.
+//
+func ExecuteWithResult(config *RunConfig, command CommandType, plan *Plan, indexSpecs []*IndexSpec,
+	deletedNodes []string) (*PlanResult, error) {
+
+	p, s, err := execute(config, command, plan, indexSpecs, deletedNodes)
+	return newPlanResult(p, s, err)
+}
+
+func newPlanResult(p *SAPlanner, s *RunStats, err error) (*PlanResult, error) {
+
+	violations, ok := err.(*Violations)
+	if (err != nil && !ok) || p == nil || p.Result == nil {
+		return nil, err
+	}
+
+	result := &PlanResult{
+		Placement:   p.Result.Placement,
+		UseLiveData: p.Result.UseLiveData(),
+		MemQuota:    p.constraint.GetMemQuota(),
+		CpuQuota:    p.constraint.GetCpuQuota(),
+		DiskQuota:   p.constraint.GetDiskQuota(),
+		Score:       p.Score,
+		ElapseTime:  p.ElapseTime,
+		Try:         p.Try,
+		Stats:       s,
+	}
+
+	if ok {
+		result.Violations = violations
+	} else {
+		result.DDL = createIndexStmts(p.Result)
+	}
+
+	return result, err
+}
+
 func execute(config *RunConfig, command CommandType, p *Plan, indexSpecs []*IndexSpec, deletedNodes []string) (*SAPlanner, *RunStats, error) {
 
 	var indexes []*IndexUsage
 	var err error
 
-	sizing := newMOISizingMethod()
+	sizing := newFDBSizingMethod()
 
 	if command == CommandPlan {
 		if indexSpecs != nil {
@@ -297,7 +360,7 @@ func plan(config *RunConfig, plan *Plan, indexes []*IndexUsage) (*SAPlanner, *Ru
 	var solution *Solution
 	var initialIndexes []*IndexUsage
 
-	sizing = newMOISizingMethod()
+	sizing = newFDBSizingMethod()
 
 	// update runtime stats
 	s := &RunStats{}
@@ -371,7 +434,7 @@ func rebalance(config *RunConfig, plan *Plan, indexes []*IndexUsage, deletedNode
 
 	s := &RunStats{}
 
-	sizing = newMOISizingMethod()
+	sizing = newFDBSizingMethod()
 
 	// create an initial solution
 	if plan != nil {
@@ -440,6 +503,20 @@ func genCreateIndexDDL(ddl string, solution *Solution) error {
 		return nil
 	}
 
+	allStmts := createIndexStmts(solution)
+
+	if err := ioutil.WriteFile(ddl, ([]byte)(allStmts), os.ModePerm); err != nil {
+		return errors.New(fmt.Sprintf("Unable to write DDL statements into %v. err = %s", ddl, err))
+	}
+
+	return nil
+}
+
+//
+// This function returns the create index and build index statements for new indexes in the solution.
+//
+func createIndexStmts(solution *Solution) string {
+
 	var allStmts string
 
 	for _, indexer := range solution.Placement {
@@ -479,11 +556,7 @@ func genCreateIndexDDL(ddl string, solution *Solution) error {
 		}
 	}
 
-	if err := ioutil.WriteFile(ddl, ([]byte)(allStmts), os.ModePerm); err != nil {
-		return errors.New(fmt.Sprintf("Unable to write DDL statements into %v. err = %s", ddl, err))
-	}
-
-	return nil
+	return allStmts
 }
 
 //////////////////////////////////////////////////////////////
@@ -510,6 +583,7 @@ func DefaultRunConfig() *RunConfig {
 		MaxCpuUse:      -1,
 		MemQuota:       -1,
 		CpuQuota:       -1,
+		DiskQuota:      -1,
 		DataCostWeight: 1,
 		CpuCostWeight:  1,
 		MemCostWeight:  1,
@@ -561,8 +635,9 @@ func initialSolution(config *RunConfig,
 	maxMemUse := config.MaxMemUse
 
 	memQuota, cpuQuota := computeQuota(config, sizing, indexes, false)
+	diskQuota := computeDiskQuota(config)
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	indexers := indexerNodes(constraint, indexes, sizing, false)
 
@@ -584,8 +659,9 @@ func emptySolution(config *RunConfig,
 	maxMemUse := config.MaxMemUse
 
 	memQuota, cpuQuota := computeQuota(config, sizing, indexes, false)
+	diskQuota := computeDiskQuota(config)
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	r := newSolution(constraint, sizing, ([]*IndexerNode)(nil), false, false)
 
@@ -625,7 +701,12 @@ func solutionFromPlan(command CommandType, config *RunConfig, sizing SizingMetho
 		cpuQuota = uint64(float64(plan.CpuQuota) * cpuQuotaFactor)
 	}
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	diskQuota := computeDiskQuota(config)
+	if config.DiskQuota == -1 && plan.DiskQuota != 0 {
+		diskQuota = plan.DiskQuota
+	}
+
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	r := newSolution(constraint, sizing, plan.Placement, plan.IsLive, command == CommandRebalance)
 	r.calculateSize() // in case sizing formula changes
@@ -667,6 +748,18 @@ func computeQuota(config *RunConfig, sizing SizingMethod, indexes []*IndexUsage,
 	return memQuota, cpuQuota
 }
 
+//
+// Disk quota per indexer node.  Disk usage is not constrained if quota is not specified.
+//
+func computeDiskQuota(config *RunConfig) uint64 {
+
+	if config.DiskQuota <= 0 {
+		return 0
+	}
+
+	return uint64(config.DiskQuota)
+}
+
 func filterPinnedIndexes(config *RunConfig, indexes []*IndexUsage) []*IndexUsage {
 
 	result := ([]*IndexUsage)(nil)
@@ -807,7 +900,7 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 		index.DefnId = common.IndexDefnId(uuid.Uint64())
 		index.InstId = common.IndexInstId(i)
 		index.Bucket = spec.Bucket
-		index.IsMOI = true
+		index.IsMOI = spec.Using != common.ForestDB
 		index.IsPrimary = spec.IsPrimary
 
 		if i == 0 {
@@ -824,6 +917,9 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 		index.Definition.WhereExpr = spec.WhereExpr
 		index.Definition.Immutable = spec.Immutable
 		index.Definition.IsArrayIndex = spec.IsArrayIndex
+		if spec.Using != "" {
+			index.Definition.Using = common.IndexType(spec.Using)
+		}
 
 		index.NumOfDocs = spec.NumDoc
 		index.AvgDocKeySize = spec.DocKeySize
@@ -832,6 +928,7 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 		index.AvgArrSize = spec.ArrSize
 		index.MutationRate = spec.MutationRate
 		index.ScanRate = spec.ScanRate
+		index.MemResidentRatio = spec.ResidentPct
 
 		sizing.ComputeIndexSize(index)
 
@@ -854,15 +951,75 @@ func printPlanSummary(plan *Plan) {
 	logging.Infof("--------------------------------------")
 	logging.Infof("Mem Quota:	%v", formatMemoryStr(plan.MemQuota))
 	logging.Infof("Cpu Quota:	%v", plan.CpuQuota)
+	if plan.DiskQuota != 0 {
+		logging.Infof("Disk Quota:	%v", formatMemoryStr(plan.DiskQuota))
+	}
 	logging.Infof("--------------------------------------")
 }
 
+//
+// This function writes the result in text format.
+//
+func (r *PlanResult) WriteText(w io.Writer) {
+
+	fmt.Fprintf(w, "Mem Quota:\t%v\n", formatMemoryStr(r.MemQuota))
+	fmt.Fprintf(w, "Cpu Quota:\t%v\n", r.CpuQuota)
+	if r.DiskQuota != 0 {
+		fmt.Fprintf(w, "Disk Quota:\t%v\n", formatMemoryStr(r.DiskQuota))
+	}
+	fmt.Fprintf(w, "Score:\t\t%v\n", r.Score)
+	fmt.Fprintf(w, "Elapsed Time:\t%v\n", formatTimeStr(r.ElapseTime))
+	fmt.Fprintf(w, "Try:\t\t%v\n", r.Try)
+
+	fmt.Fprintf(w, "\n--- Placement\n")
+	for _, indexer := range r.Placement {
+		fmt.Fprintf(w, "Indexer nodeId:%v, serverGroup:%v, memory:%s, cpu:%v, disk:%s, number of indexes:%v\n",
+			indexer.NodeId, indexer.ServerGroup, formatMemoryStr(indexer.GetMemTotal(r.UseLiveData)),
+			indexer.CpuUsage, formatMemoryStr(indexer.GetDiskUsage(r.UseLiveData)), len(indexer.Indexes))
+
+		for _, index := range indexer.Indexes {
+			fmt.Fprintf(w, "\tIndex name:%v, bucket:%v, defnId:%v, instId:%v, memory:%s, cpu:%v, disk:%s\n",
+				index.Name, index.Bucket, index.DefnId, index.InstId, formatMemoryStr(index.GetMemTotal(r.UseLiveData)),
+				index.CpuUsage, formatMemoryStr(index.GetDiskUsage(r.UseLiveData)))
+		}
+	}
+
+	if r.Violations != nil {
+		fmt.Fprintf(w, "\n--- Violations%v", r.Violations.Error())
+	}
+
+	if s := r.Stats; s != nil {
+		fmt.Fprintf(w, "\n--- Stats\n")
+		fmt.Fprintf(w, "index count:\t%v\n", s.IndexCount)
+		fmt.Fprintf(w, "average index size:\t%v\n", formatMemoryStr(uint64(s.AvgIndexSize)))
+		fmt.Fprintf(w, "index size deviation:\t%v\n", formatMemoryStr(uint64(s.StdDevIndexSize)))
+		fmt.Fprintf(w, "average index cpu:\t%v\n", s.AvgIndexCpu)
+		fmt.Fprintf(w, "index cpu deviation:\t%v\n", s.StdDevIndexCpu)
+		if s.Initial_indexerCount != 0 {
+			fmt.Fprintf(w, "initial score:\t%v\n", s.Initial_score)
+			fmt.Fprintf(w, "initial index count:\t%v\n", s.Initial_indexCount)
+			fmt.Fprintf(w, "initial indexer count:\t%v\n", s.Initial_indexerCount)
+			fmt.Fprintf(w, "initial indexer memory:\t%v\n", formatMemoryStr(uint64(s.Initial_avgIndexerSize)))
+			fmt.Fprintf(w, "initial indexer memory deviation:\t%v\n", formatMemoryStr(uint64(s.Initial_stdDevIndexerSize)))
+			fmt.Fprintf(w, "initial indexer cpu:\t%v\n", s.Initial_avgIndexerCpu)
+			fmt.Fprintf(w, "initial indexer cpu deviation:\t%v\n", s.Initial_stdDevIndexerCpu)
+			fmt.Fprintf(w, "initial index moved:\t%v\n", s.Initial_movedIndex)
+			fmt.Fprintf(w, "initial index data moved:\t%v\n", formatMemoryStr(s.Initial_movedData))
+		}
+	}
+
+	if r.DDL != "" {
+		fmt.Fprintf(w, "\n--- DDL\n%v", r.DDL)
+	}
+}
+
 func savePlan(output string, solution *Solution, constraint ConstraintMethod) error {
 
 	plan := &Plan{
 		Placement: solution.Placement,
 		MemQuota:  constraint.GetMemQuota(),
 		CpuQuota:  constraint.GetCpuQuota(),
+		DiskQuota: constraint.GetDiskQuota(),
 		IsLive:    solution.isLiveData,
 	}
 
@@ -55,6 +55,15 @@ const (
 	MOIScanTimeout                = 120
 )
 
+// constant - index sizing - forestdb
+const (
+	FDBMutationRatePerCore uint64  = 10000
+	FDBScanRatePerCore             = 2500
+	FDBEntryOverhead               = 64
+	FDBResidentRatio               = 20
+	FDBFragmentation       float64 = 0.3
+)
+
 // constant - command
 type CommandType string
 
@@ -72,6 +81,7 @@ const (
 	ResourceViolation                   = "ResourceViolation"
 	AvailabilityViolation               = "AvailabilityViolation"
 	DeleteNodeViolation                 = "DeleteNodeViolation"
+	DiskViolation                       = "DiskViolation"
 )
 
 //////////////////////////////////////////////////////////////
@@ -100,6 +110,7 @@ type PlacementMethod interface {
 type ConstraintMethod interface {
 	GetMemQuota() uint64
 	GetCpuQuota() uint64
+	GetDiskQuota() uint64
 	SatisfyClusterResourceConstraint(s *Solution) bool
 	SatisfyNodeResourceConstraint(s *Solution, n *IndexerNode) bool
 	SatisfyClusterConstraint(s *Solution, eligibles []*IndexUsage) bool
@@ -140,6 +151,7 @@ type IndexerNode struct {
 	// input/output: resource consumption (from live cluster)
 	ActualMemUsage    uint64 `json:"actualMemUsage"`
 	ActualMemOverhead uint64 `json:"actualMemOverhead"`
+	ActualDiskUsage   uint64 `json:"actualDiskUsage,omitempty"`
 
 	// input: index residing on the node
 	Indexes []*IndexUsage `json:"indexes"`
@@ -181,6 +193,7 @@ type IndexUsage struct {
 	ActualMemUsage    uint64 `json:"actualMemUsage"`
 	ActualMemOverhead uint64 `json:"actualMemOverhead"`
 	ActualKeySize     uint64 `json:"actualKeySize"`
+	ActualDiskUsage   uint64 `json:"actualDiskUsage,omitempty"`
 
 	// input: index definition (optional)
 	Definition *common.IndexDefn `json:"definition,omitempty"`
@@ -203,15 +216,17 @@ type Violations struct {
 	Violations []*Violation
 	MemQuota   uint64
 	CpuQuota   uint64
+	DiskQuota  uint64
 }
 
 type Violation struct {
-	Name     string
-	Bucket   string
-	NodeId   string
-	CpuUsage uint64
-	MemUsage uint64
-	Details  []string
+	Name      string
+	Bucket    string
+	NodeId    string
+	CpuUsage  uint64
+	MemUsage  uint64
+	DiskUsage uint64
+	Details   []string
 }
 
 //////////////////////////////////////////////////////////////
@@ -276,6 +291,10 @@ type RandomPlacement struct {
 type MOISizingMethod struct {
 }
 
+type FDBSizingMethod struct {
+	moi *MOISizingMethod
+}
+
 //////////////////////////////////////////////////////////////
 // Interface Implementation - ConstraintMethod
 //////////////////////////////////////////////////////////////
@@ -284,6 +303,7 @@ type IndexerConstraint struct {
 	// system level constraint
 	MemQuota   uint64 `json:"memQuota,omitempty"`
 	CpuQuota   uint64 `json:"cpuQuota,omitempty"`
+	DiskQuota  uint64 `json:"diskQuota,omitempty"`
 	MaxMemUse  int64  `json:"maxMemUse,omitempty"`
 	MaxCpuUse  int64  `json:"maxCpuUse,omitempty"`
 	canResize  bool
@@ -480,6 +500,10 @@ func (p *SAPlanner) PrintLayout() {
 		logging.Infof("Memory Quota: %v (%v)", p.constraint.GetMemQuota(),
 			formatMemoryStr(p.constraint.GetMemQuota()))
 		logging.Infof("CPU Quota: %v", p.constraint.GetCpuQuota())
+		if p.constraint.GetDiskQuota() != 0 {
+			logging.Infof("Disk Quota: %v (%v)", p.constraint.GetDiskQuota(),
+				formatMemoryStr(p.constraint.GetDiskQuota()))
+		}
 		logging.Infof("----------------------------------------")
 		p.cost.Print()
 		logging.Infof("----------------------------------------")
@@ -691,6 +715,7 @@ func (s *Solution) findIndexOffset(node *IndexerNode, index *IndexUsage) int {
 func (s *Solution) addIndex(n *IndexerNode, idx *IndexUsage) {
 	n.Indexes = append(n.Indexes, idx)
 	n.AddMemUsageOverhead(s, idx.GetMemUsage(s.UseLiveData()), idx.GetMemOverhead(s.UseLiveData()))
+	n.AddDiskUsage(s, idx.GetDiskUsage(s.UseLiveData()))
 	n.CpuUsage += idx.CpuUsage
 }
 
@@ -707,6 +732,7 @@ func (s *Solution) removeIndex(n *IndexerNode, i int) {
 	}
 
 	n.SubtractMemUsageOverhead(s, idx.GetMemUsage(s.UseLiveData()), idx.GetMemOverhead(s.UseLiveData()))
+	n.SubtractDiskUsage(s, idx.GetDiskUsage(s.UseLiveData()))
 	n.CpuUsage -= idx.CpuUsage
 }
 
@@ -841,12 +867,16 @@ func (s *Solution) PrintLayout() {
 			indexer.GetMemUsage(s.UseLiveData()), formatMemoryStr(uint64(indexer.GetMemUsage(s.UseLiveData()))),
 			indexer.GetMemOverhead(s.UseLiveData()), formatMemoryStr(uint64(indexer.GetMemOverhead(s.UseLiveData()))),
 			indexer.CpuUsage, len(indexer.Indexes))
+		logging.Infof("\tIndexer total disk:%v (%s)",
+			indexer.GetDiskUsage(s.UseLiveData()), formatMemoryStr(indexer.GetDiskUsage(s.UseLiveData())))
 
 		for _, index := range indexer.Indexes {
 			logging.Infof("\t\tIndex defnId:%v, instId:%v, name:%v, bucket:%v", index.DefnId, index.InstId, index.Name, index.Bucket)
 			logging.Infof("\t\tIndex memory:%v (%s), overhead: %v (%s), cpu:%v",
 				index.GetMemUsage(s.UseLiveData()), formatMemoryStr(uint64(index.GetMemUsage(s.UseLiveData()))),
 				index.GetMemOverhead(s.UseLiveData()), formatMemoryStr(uint64(index.GetMemOverhead(s.UseLiveData()))), index.CpuUsage)
+			logging.Infof("\t\tIndex disk:%v (%s)",
+				index.GetDiskUsage(s.UseLiveData()), formatMemoryStr(index.GetDiskUsage(s.UseLiveData())))
 		}
 	}
 }
@@ -1043,6 +1073,7 @@ func (s *Solution) calculateSize() {
 //
 func newIndexerConstraint(memQuota uint64,
 	cpuQuota uint64,
+	diskQuota uint64,
 	canResize bool,
 	maxNumNode int,
 	maxCpuUse int,
@@ -1050,6 +1081,7 @@ func newIndexerConstraint(memQuota uint64,
 	return &IndexerConstraint{
 		MemQuota:   memQuota,
 		CpuQuota:   cpuQuota,
+		DiskQuota:  diskQuota,
 		canResize:  canResize,
 		maxNumNode: uint64(maxNumNode),
 		MaxCpuUse:  int64(maxCpuUse),
@@ -1063,6 +1095,7 @@ func newIndexerConstraint(memQuota uint64,
 func (c *IndexerConstraint) Print() {
 	logging.Infof("Memory Quota %v (%s)", c.MemQuota, formatMemoryStr(c.MemQuota))
 	logging.Infof("CPU Quota %v", c.CpuQuota)
+	logging.Infof("Disk Quota %v (%s)", c.DiskQuota, formatMemoryStr(c.DiskQuota))
 	logging.Infof("Max Cpu Utilization %v", c.MaxCpuUse)
 	logging.Infof("Max Memory Utilization %v", c.MaxMemUse)
 }
@@ -1078,11 +1111,13 @@ func (c *IndexerConstraint) Validate(s *Solution) error {
 
 	var totalIndexMem uint64
 	var totalIndexCpu uint64
+	var totalIndexDisk uint64
 
 	for _, indexer := range s.Placement {
 		for _, index := range indexer.Indexes {
 			totalIndexMem += index.GetMemTotal(s.UseLiveData())
 			totalIndexCpu += index.CpuUsage
+			totalIndexDisk += index.GetDiskUsage(s.UseLiveData())
 		}
 	}
 
@@ -1094,6 +1129,10 @@ func (c *IndexerConstraint) Validate(s *Solution) error {
 		return errors.New(fmt.Sprintf("Total cpu usage of all indexes exceed aggregated cpu quota of all indexer nodes"))
 	}
 
+	if c.DiskQuota != 0 && totalIndexDisk > (c.DiskQuota*uint64(len(s.Placement))) {
+		return errors.New(fmt.Sprintf("Total disk usage of all indexes exceed aggregated disk quota of all indexer nodes"))
+	}
+
 	return nil
 }
 
@@ -1103,8 +1142,9 @@ func (c *IndexerConstraint) Validate(s *Solution) error {
 func (c *IndexerConstraint) GetViolations(s *Solution, eligibles []*IndexUsage) *Violations {
 
 	violations := &Violations{
-		MemQuota: s.getConstraintMethod().GetMemQuota(),
-		CpuQuota: s.getConstraintMethod().GetCpuQuota(),
+		MemQuota:  s.getConstraintMethod().GetMemQuota(),
+		CpuQuota:  s.getConstraintMethod().GetCpuQuota(),
+		DiskQuota: s.getConstraintMethod().GetDiskQuota(),
 	}
 
 	for _, indexer := range s.Placement {
@@ -1115,12 +1155,13 @@ func (c *IndexerConstraint) GetViolations(s *Solution, eligibles []*IndexUsage)
 				if hasIndex(indexer, index) {
 
 					violation := &Violation{
-						Name:     index.Name,
-						Bucket:   index.Bucket,
-						NodeId:   indexer.NodeId,
-						MemUsage: index.GetMemTotal(s.UseLiveData()),
-						CpuUsage: index.CpuUsage,
-						Details:  nil}
+						Name:      index.Name,
+						Bucket:    index.Bucket,
+						NodeId:    indexer.NodeId,
+						MemUsage:  index.GetMemTotal(s.UseLiveData()),
+						CpuUsage:  index.CpuUsage,
+						DiskUsage: index.GetDiskUsage(s.UseLiveData()),
+						Details:   nil}
 
 					// If this indexer node has a placeable index, then check if the
 					// index can be moved to other nodes.
@@ -1173,6 +1214,20 @@ func (c *IndexerConstraint) GetCpuQuota() uint64 {
 	return c.CpuQuota
 }
 
+//
+// Get disk quota.  Disk usage is not constrained if quota is 0.
+//
+func (c *IndexerConstraint) GetDiskQuota() uint64 {
+	return c.DiskQuota
+}
+
+//
+// Check if disk usage is within disk quota
+//
+func (c *IndexerConstraint) withinDiskQuota(diskUsage uint64) bool {
+	return c.DiskQuota == 0 || diskUsage <= c.DiskQuota
+}
+
 //
 // Allow Add Node
 //
@@ -1223,6 +1278,10 @@ func (c *IndexerConstraint) CanAddIndex(s *Solution, n *IndexerNode, u *IndexUsa
 		return ResourceViolation
 	}
 
+	if !c.withinDiskQuota(u.GetDiskUsage(s.UseLiveData()) + n.GetDiskUsage(s.UseLiveData())) {
+		return DiskViolation
+	}
+
 	return NoViolation
 }
 
@@ -1255,6 +1314,10 @@ func (c *IndexerConstraint) CanSwapIndex(sol *Solution, n *IndexerNode, s *Index
 		return ResourceViolation
 	}
 
+	if !c.withinDiskQuota(s.GetDiskUsage(sol.UseLiveData()) + n.GetDiskUsage(sol.UseLiveData()) - t.GetDiskUsage(sol.UseLiveData())) {
+		return DiskViolation
+	}
+
 	for _, index := range n.Indexes {
 		// check replica
 		if index.DefnId == s.DefnId {
@@ -1296,6 +1359,10 @@ func (c *IndexerConstraint) SatisfyNodeResourceConstraint(s *Solution, n *Indexe
 		return false
 	}
 
+	if !c.withinDiskQuota(n.GetDiskUsage(s.UseLiveData())) {
+		return false
+	}
+
 	return true
 }
 
@@ -1322,6 +1389,9 @@ func (c *IndexerConstraint) SatisfyClusterResourceConstraint(s *Solution) bool {
 		if indexer.CpuUsage > cpuQuota {
 			return false
 		}
+		if !c.withinDiskQuota(indexer.GetDiskUsage(s.UseLiveData())) {
+			return false
+		}
 	}
 
 	return true
@@ -1422,6 +1492,7 @@ func (o *IndexerNode) clone() *IndexerNode {
 		delete:            o.delete,
 		ActualMemUsage:    o.ActualMemUsage,
 		ActualMemOverhead: o.ActualMemOverhead,
+		ActualDiskUsage:   o.ActualDiskUsage,
 	}
 
 	for i, _ := range o.Indexes {
@@ -1499,6 +1570,42 @@ func (o *IndexerNode) AddMemUsageOverhead(s *Solution, usage uint64, overhead ui
 	}
 }
 
+//
+// Get disk usage
+//
+func (o *IndexerNode) GetDiskUsage(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualDiskUsage
+	}
+
+	return o.DiskUsage
+}
+
+//
+// Add disk
+//
+func (o *IndexerNode) AddDiskUsage(s *Solution, usage uint64) {
+
+	if s.UseLiveData() {
+		o.ActualDiskUsage += usage
+	} else {
+		o.DiskUsage += usage
+	}
+}
+
+//
+// Subtract disk
+//
+func (o *IndexerNode) SubtractDiskUsage(s *Solution, usage uint64) {
+
+	if s.UseLiveData() {
+		o.ActualDiskUsage -= usage
+	} else {
+		o.DiskUsage -= usage
+	}
+}
+
 //
 // Add memory
 //
@@ -1572,6 +1679,18 @@ func (o *IndexUsage) GetMemTotal(useLive bool) uint64 {
 	return o.MemUsage + o.MemOverhead
 }
 
+//
+// Get disk usage
+//
+func (o *IndexUsage) GetDiskUsage(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualDiskUsage
+	}
+
+	return o.DiskUsage
+}
+
 //////////////////////////////////////////////////////////////
 // UsageBasedCostMethod
 //////////////////////////////////////////////////////////////
@@ -2487,6 +2606,163 @@ func (s *MOISizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool) (
 	return memQuota, cpuQuota
 }
 
+//////////////////////////////////////////////////////////////
+// FDBSizingMethod
+//////////////////////////////////////////////////////////////
+
+//
+// Constructor.  ForestDB sizing method sizes memory optimized indexes
+// using MOI sizing, so it can be used for cluster with mixed storage.
+//
+func newFDBSizingMethod() *FDBSizingMethod {
+	return &FDBSizingMethod{moi: newMOISizingMethod()}
+}
+
+//
+// Validate
+//
+func (s *FDBSizingMethod) Validate(solution *Solution) error {
+	return nil
+}
+
+//
+// This function computes the index size
+//
+func (s *FDBSizingMethod) ComputeIndexSize(idx *IndexUsage) {
+
+	if idx.IsMOI {
+		s.moi.ComputeIndexSize(idx)
+		return
+	}
+
+	dataSize := s.computeDataSize(idx)
+	if dataSize == 0 {
+		idx.MemOverhead = s.ComputeIndexOverhead(idx)
+		return
+	}
+
+	// disk size : data size, plus fragmentation accumulated before compaction kicks in
+	idx.DiskUsage = uint64(float64(dataSize) / (1 - FDBFragmentation))
+
+	// buffer cache : resident ratio of data size (default 20%)
+	residentRatio := idx.MemResidentRatio
+	if residentRatio == 0 {
+		residentRatio = FDBResidentRatio
+	}
+	idx.MemUsage = dataSize * residentRatio / 100
+
+	// compute cpu usage
+	cpu := float64(idx.MutationRate)/float64(FDBMutationRatePerCore) + float64(idx.ScanRate)/float64(FDBScanRatePerCore)
+	idx.CpuUsage = uint64(math.Floor(cpu)) + 1
+
+	idx.MemOverhead = s.ComputeIndexOverhead(idx)
+}
+
+//
+// This function computes the data size of index, including main index and back index.
+//
+func (s *FDBSizingMethod) computeDataSize(idx *IndexUsage) uint64 {
+
+	if !idx.IsPrimary {
+		if idx.AvgSecKeySize != 0 {
+			// secondary index data size : (2 * (EntryOverhead + KeyLen + DocIdLen)) * NumberOfItems
+			return 2 * (FDBEntryOverhead + idx.AvgSecKeySize + idx.AvgDocKeySize) * idx.NumOfDocs
+		} else if idx.AvgArrKeySize != 0 {
+			// secondary array index data size :
+			// main index : (EntryOverhead + ArrElemSize + DocIdLen) * NumArrElems * NumberOfItems
+			// back index : (EntryOverhead + DocIdLen + ArrElemSize * NumArrElems) * NumberOfItems
+			main := (FDBEntryOverhead + idx.AvgArrKeySize + idx.AvgDocKeySize) * idx.AvgArrSize
+			back := FDBEntryOverhead + idx.AvgDocKeySize + idx.AvgArrKeySize*idx.AvgArrSize
+			return (main + back) * idx.NumOfDocs
+		} else if idx.ActualKeySize != 0 {
+			// secondary index data size : (2 * (EntryOverhead + ActualKeySize)) * NumberOfItems
+			return 2 * (FDBEntryOverhead + idx.ActualKeySize) * idx.NumOfDocs
+		}
+	} else {
+		if idx.AvgDocKeySize != 0 {
+			// primary index data size : (EntryOverhead + DocIdLen) * NumberOfItems
+			return (FDBEntryOverhead + idx.AvgDocKeySize) * idx.NumOfDocs
+		} else if idx.ActualKeySize != 0 {
+			// primary index data size : (EntryOverhead + ActualKeySize) * NumberOfItems
+			return (FDBEntryOverhead + idx.ActualKeySize) * idx.NumOfDocs
+		}
+	}
+
+	return 0
+}
+
+//
+// This function computes the indexer memory, cpu and disk usage
+//
+func (s *FDBSizingMethod) ComputeIndexerSize(o *IndexerNode) {
+
+	o.MemUsage = 0
+	o.CpuUsage = 0
+	o.DiskUsage = 0
+
+	for _, idx := range o.Indexes {
+		o.MemUsage += idx.MemUsage
+		o.CpuUsage += idx.CpuUsage
+		o.DiskUsage += idx.DiskUsage
+	}
+
+	s.ComputeIndexerOverhead(o)
+}
+
+//
+// This function computes the indexer memory overhead
+//
+func (s *FDBSizingMethod) ComputeIndexerOverhead(o *IndexerNode) {
+
+	// channel overhead : 100MB
+	overhead := uint64(100 * 1024 * 1024)
+
+	for _, idx := range o.Indexes {
+		overhead += s.ComputeIndexOverhead(idx)
+	}
+
+	o.MemOverhead = uint64(overhead)
+}
+
+//
+// This function estimates the index memory overhead
+//
+func (s *FDBSizingMethod) ComputeIndexOverhead(idx *IndexUsage) uint64 {
+
+	if idx.IsMOI {
+		return s.moi.ComputeIndexOverhead(idx)
+	}
+
+	// protobuf overhead : 150MB per index
+	overhead := float64(150 * 1024 * 1024)
+
+	// incoming mutation buffer overhead: 30K * SizePerItem * NumberOfIndexes * MutationRate/500
+	if idx.AvgSecKeySize != 0 {
+		overhead += float64(30*1000*(idx.AvgSecKeySize+idx.AvgDocKeySize)) * float64(idx.MutationRate) / float64(500)
+	} else if idx.AvgArrKeySize != 0 {
+		overhead += float64(30*1000*(idx.AvgArrKeySize*idx.AvgArrSize+idx.AvgDocKeySize)) * float64(idx.MutationRate) / float64(500)
+	} else if idx.AvgDocKeySize != 0 {
+		overhead += float64(30*1000*idx.AvgDocKeySize) * float64(idx.MutationRate) / float64(500)
+	} else if idx.ActualKeySize != 0 {
+		overhead += float64(30*1000*(idx.ActualKeySize)) * float64(idx.MutationRate) / float64(500)
+	}
+
+	// snapshots are on disk, there is no snapshot overhead in memory
+
+	// golang overhead: 5% of total memory
+	golangOverhead := (float64(idx.MemUsage) + overhead) * 0.05
+	overhead += golangOverhead
+
+	return uint64(overhead)
+}
+
+//
+// This function estimates the min memory quota given a set of indexes
+//
+func (s *FDBSizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool) (uint64, uint64) {
+	return s.moi.ComputeMinQuota(indexes, useLive)
+}
+
 //////////////////////////////////////////////////////////////
 // Violations
 //////////////////////////////////////////////////////////////
@@ -2497,10 +2773,14 @@ func (s *MOISizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool) (
 func (v *Violations) Error() string {
 	err := fmt.Sprintf("\nMemoryQuota: %v\n", v.MemQuota)
 	err += fmt.Sprintf("CpuQuota: %v\n", v.CpuQuota)
+	if v.DiskQuota != 0 {
+		err += fmt.Sprintf("DiskQuota: %v\n", v.DiskQuota)
+	}
 
 	for _, violation := range v.Violations {
-		err += fmt.Sprintf("--- Violations for index <%v, %v> (mem %v, cpu %v) at node %v \n",
-			violation.Name, violation.Bucket, formatMemoryStr(violation.MemUsage), violation.CpuUsage, violation.NodeId)
+		err += fmt.Sprintf("--- Violations for index <%v, %v> (mem %v, cpu %v, disk %v) at node %v \n",
+			violation.Name, violation.Bucket, formatMemoryStr(violation.MemUsage), violation.CpuUsage,
+			formatMemoryStr(violation.DiskUsage), violation.NodeId)
 
 		for _, detail := range violation.Details {
 			err += fmt.Sprintf("\t%v\n", detail)
@@ -68,7 +68,7 @@ func RetrievePlanFromCluster(clusterUrl string) (*Plan, error) {
 //
 func recalculateIndexerSize(plan *Plan) {
 
-	sizing := newMOISizingMethod()
+	sizing := newFDBSizingMethod()
 
 	for _, indexer := range plan.Placement {
 		for _, index := range indexer.Indexes {
@@ -223,7 +223,6 @@ func getIndexStats(clusterUrl string, plan *Plan) error {
 		/*
 			ServerGroup string `json:"serverGroup,omitempty"`
 			CpuUsage    uint64 `json:"cpuUsage,omitempty"`
-			DiskUsage   uint64 `json:"diskUsage,omitempty"`
 		*/
 
 		var actualStorageMem uint64
@@ -262,11 +261,17 @@ func getIndexStats(clusterUrl string, plan *Plan) error {
 			/*
 				ServerGroup string `json:"serverGroup,omitempty"`
 				CpuUsage    uint64 `json:"cpuUsage,omitempty"`
-				DiskUsage   uint64 `json:"diskUsage,omitempty"`
 			*/
 
 			var key string
 
+			// disk_size is the size of index files on disk, including fragmentation.
+			key = fmt.Sprintf("%v:%v:disk_size", index.Bucket, index.Name)
+			if diskSize, ok := statsMap[key]; ok {
+				index.ActualDiskUsage = uint64(diskSize.(float64))
+				indexer.ActualDiskUsage += index.ActualDiskUsage
+			}
+
 			// items_count captures number of key per index
 			key = fmt.Sprintf("%v:%v:items_count", index.Bucket, index.Name)
 			if itemsCount, ok := statsMap[key]; ok {
@@ -458,7 +463,7 @@ func createIndexerNode(cinfo *common.ClusterInfoCache, nid common.NodeId) (*Inde
 		return nil, err
 	}
 
-	sizing := newMOISizingMethod()
+	sizing := newFDBSizingMethod()
 	return newIndexerNode(host, sizing), nil
 }
 
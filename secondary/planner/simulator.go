@@ -313,6 +313,13 @@ func (t *simulator) RunSimulation(count int, config *RunConfig, command CommandT
 	return nil
 }
 
+// Simulate runs a single simulation and returns the placement, violations and run stats.
+func (t *simulator) Simulate(config *RunConfig, command CommandType, spec *WorkloadSpec, p *Plan, indexSpecs []*IndexSpec) (*PlanResult, error) {
+
+	planner, s, err := t.RunSingleTest(config, command, spec, p, indexSpecs)
+	return newPlanResult(planner, s, err)
+}
+
 func (t *simulator) RunSingleTest(config *RunConfig, command CommandType, spec *WorkloadSpec, p *Plan, indexSpecs []*IndexSpec) (*SAPlanner, *RunStats, error) {
 
 	var indexes []*IndexUsage
@@ -0,0 +1,153 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestFDBSizing(t *testing.T) {
+
+	sizing := newFDBSizingMethod()
+
+	tests := []struct {
+		name   string
+		index  IndexUsage
+		disk   uint64
+		memory uint64
+		cpu    uint64
+	}{
+		// data size 2 * (64 + 30 + 10) * 1000 = 208000
+		{"secondary",
+			IndexUsage{AvgSecKeySize: 30, AvgDocKeySize: 10, NumOfDocs: 1000, MutationRate: 25000, ScanRate: 1000},
+			297142, 41600, 3},
+		{"resident ratio",
+			IndexUsage{AvgSecKeySize: 30, AvgDocKeySize: 10, NumOfDocs: 1000, MemResidentRatio: 50},
+			297142, 104000, 1},
+		// data size ((64 + 10 + 10) * 5 + (64 + 10 + 10 * 5)) * 100 = 54400
+		{"array",
+			IndexUsage{AvgArrKeySize: 10, AvgArrSize: 5, AvgDocKeySize: 10, NumOfDocs: 100},
+			77714, 10880, 1},
+		// data size (64 + 16) * 1000 = 80000
+		{"primary",
+			IndexUsage{IsPrimary: true, AvgDocKeySize: 16, NumOfDocs: 1000, ScanRate: 5000},
+			114285, 16000, 3},
+		// data size 2 * (64 + 36) * 1000 = 200000
+		{"actual key size",
+			IndexUsage{ActualKeySize: 36, NumOfDocs: 1000},
+			285714, 40000, 1},
+		{"no size", IndexUsage{NumOfDocs: 1000}, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		idx := test.index
+		sizing.ComputeIndexSize(&idx)
+		if idx.DiskUsage != test.disk || idx.MemUsage != test.memory || idx.CpuUsage != test.cpu {
+			t.Errorf("%v: expected disk %v, mem %v, cpu %v, got %v, %v, %v", test.name,
+				test.disk, test.memory, test.cpu, idx.DiskUsage, idx.MemUsage, idx.CpuUsage)
+		}
+		if idx.MemOverhead < 150*1024*1024 {
+			t.Errorf("%v: unexpected memory overhead %v", test.name, idx.MemOverhead)
+		}
+	}
+
+	// memory optimized index is sized same as MOI sizing
+	fdb := IndexUsage{IsMOI: true, AvgSecKeySize: 30, AvgDocKeySize: 10, NumOfDocs: 1000, MutationRate: 1000}
+	moi := fdb
+	sizing.ComputeIndexSize(&fdb)
+	newMOISizingMethod().ComputeIndexSize(&moi)
+	if fdb.MemUsage != moi.MemUsage || fdb.MemOverhead != moi.MemOverhead ||
+		fdb.CpuUsage != moi.CpuUsage || fdb.DiskUsage != 0 {
+		t.Errorf("expected MOI sizing %v, %v, %v, got %v, %v, %v, disk %v",
+			moi.MemUsage, moi.MemOverhead, moi.CpuUsage, fdb.MemUsage, fdb.MemOverhead,
+			fdb.CpuUsage, fdb.DiskUsage)
+	}
+
+	// indexer disk usage adds up its indexes
+	indexer := newIndexerNode("node1", sizing)
+	for _, test := range tests {
+		idx := test.index
+		sizing.ComputeIndexSize(&idx)
+		indexer.Indexes = append(indexer.Indexes, &idx)
+	}
+	sizing.ComputeIndexerSize(indexer)
+	if indexer.DiskUsage != 297142*2+77714+114285+285714 {
+		t.Errorf("unexpected indexer disk usage %v", indexer.DiskUsage)
+	}
+}
+
+func TestDiskQuotaConstraint(t *testing.T) {
+
+	sizing := newFDBSizingMethod()
+	newIndex := func(defnId common.IndexDefnId, numDocs uint64) *IndexUsage {
+		// disk size 2 * (64 + 36) * numDocs / 0.7
+		idx := &IndexUsage{DefnId: defnId, Name: "idx", Bucket: "default",
+			AvgSecKeySize: 36, NumOfDocs: numDocs}
+		sizing.ComputeIndexSize(idx)
+		return idx
+	}
+	idx1 := newIndex(1, 2000)
+	idx2 := newIndex(2, 2000)
+	idx3 := newIndex(3, 100)
+
+	// 1MB disk quota per node fits either of idx1 and idx2, not both
+	constraint := newIndexerConstraint(100*1024*1024*1024, 16, 1024*1024, false, 1, -1, -1)
+	s := newSolution(constraint, sizing, []*IndexerNode{newIndexerNode("node1", sizing)}, false, false)
+	n := s.Placement[0]
+
+	if code := constraint.CanAddIndex(s, n, idx1); code != NoViolation {
+		t.Fatalf("expected %v adding first index, got %v", NoViolation, code)
+	}
+	s.addIndex(n, idx1)
+	if n.GetDiskUsage(s.UseLiveData()) != idx1.DiskUsage {
+		t.Errorf("expected node disk usage %v, got %v", idx1.DiskUsage, n.GetDiskUsage(s.UseLiveData()))
+	}
+	if code := constraint.CanAddIndex(s, n, idx2); code != DiskViolation {
+		t.Errorf("expected %v adding second index, got %v", DiskViolation, code)
+	}
+	if code := constraint.CanAddIndex(s, n, idx3); code != NoViolation {
+		t.Errorf("expected %v adding small index, got %v", NoViolation, code)
+	}
+	if !constraint.SatisfyNodeResourceConstraint(s, n) || !constraint.SatisfyClusterResourceConstraint(s) {
+		t.Errorf("expected node within disk quota")
+	}
+	if err := constraint.Validate(s); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	s.addIndex(n, idx2)
+	if constraint.SatisfyNodeResourceConstraint(s, n) || constraint.SatisfyClusterResourceConstraint(s) {
+		t.Errorf("expected node over disk quota")
+	}
+	if err := constraint.Validate(s); err == nil || !strings.Contains(err.Error(), "disk") {
+		t.Errorf("expected disk quota error, got %v", err)
+	}
+	if code := constraint.CanSwapIndex(s, n, idx3, idx2); code != NoViolation {
+		t.Errorf("expected %v swapping out large index, got %v", NoViolation, code)
+	}
+
+	s.removeIndex(n, s.findIndexOffset(n, idx2))
+	if n.GetDiskUsage(s.UseLiveData()) != idx1.DiskUsage {
+		t.Errorf("expected node disk usage %v after removal, got %v",
+			idx1.DiskUsage, n.GetDiskUsage(s.UseLiveData()))
+	}
+
+	// no disk quota, disk usage is not constrained
+	constraint = newIndexerConstraint(100*1024*1024*1024, 16, 0, false, 1, -1, -1)
+	s = newSolution(constraint, sizing, []*IndexerNode{newIndexerNode("node1", sizing)}, false, false)
+	n = s.Placement[0]
+	s.addIndex(n, idx1)
+	if code := constraint.CanAddIndex(s, n, idx2); code != NoViolation {
+		t.Errorf("expected %v without disk quota, got %v", NoViolation, code)
+	}
+}
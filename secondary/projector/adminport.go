@@ -16,6 +16,8 @@ var reqRestartVbuckets = &protobuf.RestartVbucketsRequest{}
 var reqShutdownVbuckets = &protobuf.ShutdownVbucketsRequest{}
 var reqAddBuckets = &protobuf.AddBucketsRequest{}
 var reqDelBuckets = &protobuf.DelBucketsRequest{}
+var reqThrottleBuckets = &protobuf.ThrottleBucketsRequest{}
+var reqFeedback = &protobuf.FeedbackRequest{}
 var reqAddInstances = &protobuf.AddInstancesRequest{}
 var reqDelInstances = &protobuf.DelInstancesRequest{}
 var reqRepairEndpoints = &protobuf.RepairEndpointsRequest{}
@@ -33,12 +35,15 @@ func (p *Projector) mainAdminPort(reqch chan ap.Request) {
 	p.admind.Register(reqShutdownVbuckets)
 	p.admind.Register(reqAddBuckets)
 	p.admind.Register(reqDelBuckets)
+	p.admind.Register(reqThrottleBuckets)
+	p.admind.Register(reqFeedback)
 	p.admind.Register(reqAddInstances)
 	p.admind.Register(reqDelInstances)
 	p.admind.Register(reqRepairEndpoints)
 	p.admind.Register(reqShutdownFeed)
 	p.admind.Register(reqStats)
 	p.admind.RegisterHTTPHandler("/stats", p.handleStats)
+	p.admind.RegisterHTTPHandler("/metrics", p.handleMetrics)
 	p.admind.RegisterHTTPHandler("/settings", p.handleSettings)
 
 	// debug pprof hanlders.
@@ -100,6 +105,10 @@ func (p *Projector) handleRequest(req ap.Request, opaque uint16) {
 		response = p.doAddBuckets(request, opaque)
 	case *protobuf.DelBucketsRequest:
 		response = p.doDelBuckets(request, opaque)
+	case *protobuf.ThrottleBucketsRequest:
+		response = p.doThrottleBuckets(request, opaque)
+	case *protobuf.FeedbackRequest:
+		response = p.doFeedback(request, opaque)
 	case *protobuf.AddInstancesRequest:
 		response = p.doAddInstances(request, opaque)
 	case *protobuf.DelInstancesRequest:
@@ -515,6 +515,64 @@ func (client *Client) DelBuckets(topic string, buckets []string) error {
 	return nil
 }
 
+// ThrottleBuckets will delay buffer-acks of upstream DCP connections
+// for one or more buckets in a feed, by `ackDelay` milli-seconds.
+// Zero delay removes the throttle. Idempotent API.
+//
+// Possible errors returned,
+// - http errors for transport related failures.
+// - ErrorTopicMissing if feed is not started.
+// - ErrorInvalidBucket if bucket is not added to feed.
+func (client *Client) ThrottleBuckets(
+	topic string, buckets []string, ackDelay uint32) error {
+
+	req := protobuf.NewThrottleBucketsRequest(topic, buckets, ackDelay)
+	res := &protobuf.Error{}
+	err := client.withRetry(
+		func() error {
+			err := client.ap.Request(req, res)
+			if err != nil {
+				return err
+			} else if s := res.GetError(); s != "" {
+				return fmt.Errorf(s)
+			}
+			return err // nil
+		})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendFeedback will report downstream load for one or more buckets
+// in a feed, projector adapts the flow-control of upstream DCP
+// connections for those buckets. Idempotent API.
+//
+// Possible errors returned,
+// - http errors for transport related failures.
+// - ErrorTopicMissing if feed is not started.
+// - ErrorInvalidBucket if bucket is not added to feed.
+func (client *Client) SendFeedback(
+	topic string, buckets []*protobuf.BucketFeedback) error {
+
+	req := protobuf.NewFeedbackRequest(topic, buckets)
+	res := &protobuf.Error{}
+	err := client.withRetry(
+		func() error {
+			err := client.ap.Request(req, res)
+			if err != nil {
+				return err
+			} else if s := res.GetError(); s != "" {
+				return fmt.Errorf(s)
+			}
+			return err // nil
+		})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // AddInstances will add one or more instances to one or more
 // buckets. Idempotent API, provided ErrorInconsistentFeed is
 // addressed.
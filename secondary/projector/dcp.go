@@ -42,6 +42,17 @@ type BucketFeeder interface {
 	// EndVbStreams ends an existing vbucket stream from this feed.
 	EndVbStreams(opaque uint16, endTs *protobuf.TsVbuuid) error
 
+	// SetAckDelay throttles this feed by delaying buffer-acks to the
+	// producers, zero delay removes the throttle.
+	SetAckDelay(delay time.Duration) error
+
+	// SetBufferSize resizes the flow control buffer of connections with
+	// the producers and sets the fraction of it read before a buffer-ack.
+	SetBufferSize(bufsize uint32, ackThreshold float32) error
+
+	// GetStats returns the flow control stats of this feed.
+	GetStats() (mc.DcpStats, error)
+
 	// CloseFeed ends all active streams on this feed and free its resources.
 	CloseFeed() (err error)
 }
@@ -118,6 +129,21 @@ func (bdcp *bucketDcp) EndVbStreams(
 	return err
 }
 
+// SetAckDelay implements Feeder{} interface.
+func (bdcp *bucketDcp) SetAckDelay(delay time.Duration) error {
+	return bdcp.dcpFeed.SetAckDelay(delay)
+}
+
+// SetBufferSize implements Feeder{} interface.
+func (bdcp *bucketDcp) SetBufferSize(bufsize uint32, ackThreshold float32) error {
+	return bdcp.dcpFeed.SetBufferSize(bufsize, ackThreshold)
+}
+
+// GetStats implements Feeder{} interface.
+func (bdcp *bucketDcp) GetStats() (mc.DcpStats, error) {
+	return bdcp.dcpFeed.GetStats()
+}
+
 // CloseFeed implements Feeder{} interface.
 func (bdcp *bucketDcp) CloseFeed() error {
 	bdcp.dcpFeed.Close()
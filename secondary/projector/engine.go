@@ -67,3 +67,8 @@ func (engine *Engine) TransformRoute(
 
 	return engine.evaluator.TransformRoute(vbuuid, m, data, encodeBuf)
 }
+
+// GetStatistics for this engine.
+func (engine *Engine) GetStatistics() map[string]interface{} {
+	return engine.evaluator.GetStatistics()
+}
@@ -1,5 +1,7 @@
 package projector
 
+import "time"
+
 import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
 import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
 import "github.com/couchbase/indexing/secondary/dcp"
@@ -96,6 +98,21 @@ func (b *FakeBucket) EndVbStreams(
 	return
 }
 
+// SetAckDelay is method receiver for BucketFeeder interface
+func (b *FakeBucket) SetAckDelay(delay time.Duration) (err error) {
+	return
+}
+
+// SetBufferSize is method receiver for BucketFeeder interface
+func (b *FakeBucket) SetBufferSize(bufsize uint32, ackThreshold float32) (err error) {
+	return
+}
+
+// GetStats is method receiver for BucketFeeder interface
+func (b *FakeBucket) GetStats() (stats mc.DcpStats, err error) {
+	return
+}
+
 // CloseFeed is method receiver for BucketFeeder interface
 func (b *FakeBucket) CloseFeed() (err error) {
 	return
@@ -54,6 +54,8 @@ type Feed struct {
 	rollTss map[string]*protobuf.TsVbuuid // bucket -> TsVbuuid
 
 	feeders map[string]BucketFeeder // bucket -> BucketFeeder{}
+	// flowControls, adapt DCP connection buffer to downstream feedback.
+	flowControls map[string]*flowControl // bucket -> flowControl
 	// downstream
 	kvdata    map[string]*KVData            // bucket -> kvdata
 	engines   map[string]map[uint64]*Engine // bucket -> uuid -> engine
@@ -99,10 +101,11 @@ func NewFeed(
 		projector: projector,
 
 		// upstream
-		reqTss:  make(map[string]*protobuf.TsVbuuid),
-		actTss:  make(map[string]*protobuf.TsVbuuid),
-		rollTss: make(map[string]*protobuf.TsVbuuid),
-		feeders: make(map[string]BucketFeeder),
+		reqTss:       make(map[string]*protobuf.TsVbuuid),
+		actTss:       make(map[string]*protobuf.TsVbuuid),
+		rollTss:      make(map[string]*protobuf.TsVbuuid),
+		feeders:      make(map[string]BucketFeeder),
+		flowControls: make(map[string]*flowControl),
 		// downstream
 		kvdata:    make(map[string]*KVData),
 		engines:   make(map[string]map[uint64]*Engine),
@@ -120,7 +123,7 @@ func NewFeed(
 	feed.logPrefix = fmt.Sprintf("FEED[<=>%v(%v)]", topic, feed.cluster)
 
 	go feed.genServer()
-	logging.Infof("%v ##%x feed started ...\n", feed.logPrefix, opaque)
+	feed.logCtx(opaque, "").Infof("feed started ...\n")
 	return feed, nil
 }
 
@@ -145,6 +148,8 @@ const (
 	fCmdResetConfig
 	fCmdDeleteEndpoint
 	fCmdPing
+	fCmdThrottleBuckets
+	fCmdFeedback
 )
 
 // ResetConfig for this feed.
@@ -225,6 +230,30 @@ func (feed *Feed) DelBuckets(
 	return c.OpError(err, resp, 0)
 }
 
+// ThrottleBuckets will delay buffer-acks for upstream
+// connections of specified buckets.
+// Synchronous call.
+func (feed *Feed) ThrottleBuckets(
+	req *protobuf.ThrottleBucketsRequest, opaque uint16) error {
+
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{fCmdThrottleBuckets, req, opaque, respch}
+	resp, err := c.FailsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return c.OpError(err, resp, 0)
+}
+
+// Feedback will adapt flow-control of upstream connections
+// to the load reported by downstream.
+// Synchronous call.
+func (feed *Feed) Feedback(
+	req *protobuf.FeedbackRequest, opaque uint16) error {
+
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{fCmdFeedback, req, opaque, respch}
+	resp, err := c.FailsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return c.OpError(err, resp, 0)
+}
+
 // AddInstances will restart specified endpoint-address if
 // it is not active already.
 // Synchronous call.
@@ -605,6 +634,16 @@ func (feed *Feed) handleCommand(msg []interface{}) (status string) {
 		}
 		respch <- []interface{}{err}
 
+	case fCmdThrottleBuckets:
+		req := msg[1].(*protobuf.ThrottleBucketsRequest)
+		opaque, respch := msg[2].(uint16), msg[3].(chan []interface{})
+		respch <- []interface{}{feed.throttleBuckets(req, opaque)}
+
+	case fCmdFeedback:
+		req := msg[1].(*protobuf.FeedbackRequest)
+		opaque, respch := msg[2].(uint16), msg[3].(chan []interface{})
+		respch <- []interface{}{feed.feedback(req, opaque)}
+
 	case fCmdAddInstances:
 		req := msg[1].(*protobuf.AddInstancesRequest)
 		opaque, respch := msg[2].(uint16), msg[3].(chan []interface{})
@@ -1035,6 +1074,64 @@ func (feed *Feed) delBuckets(
 	return nil
 }
 
+// only upstream flow-control shall be updated.
+// - return ErrorInvalidBucket if bucket is not added.
+func (feed *Feed) throttleBuckets(
+	req *protobuf.ThrottleBucketsRequest, opaque uint16) (err error) {
+
+	delay := time.Duration(req.GetAckDelay()) * time.Millisecond
+	for _, bucketn := range req.GetBuckets() {
+		feeder, ok := feed.feeders[bucketn]
+		if !ok {
+			fmsg := "%v ##%x throttleBuckets() invalid-bucket %q\n"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn)
+			err = projC.ErrorInvalidBucket
+			continue
+		}
+		if e := feeder.SetAckDelay(delay); e != nil {
+			fmsg := "%v ##%x SetAckDelay(%q): %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, e)
+			err = e
+			continue
+		}
+		fmsg := "%v ##%x bucket %q buffer-ack delay %v\n"
+		logging.Infof(fmsg, feed.logPrefix, opaque, bucketn, delay)
+	}
+	return err
+}
+
+// only upstream flow-control shall be updated.
+// - return ErrorInvalidBucket if bucket is not added.
+func (feed *Feed) feedback(
+	req *protobuf.FeedbackRequest, opaque uint16) (err error) {
+
+	for _, bfeedback := range req.GetBuckets() {
+		bucketn := bfeedback.GetBucket()
+		feeder, ok := feed.feeders[bucketn]
+		if !ok {
+			fmsg := "%v ##%x feedback() invalid-bucket %q\n"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn)
+			err = projC.ErrorInvalidBucket
+			continue
+		}
+		fc, ok := feed.flowControls[bucketn]
+		if !ok {
+			fc = newFlowControl(bucketn)
+			feed.flowControls[bucketn] = fc // :SideEffect:
+		}
+		if !fc.update(bfeedback, feed.config) {
+			continue
+		}
+		e := feeder.SetBufferSize(fc.bufsize, fc.ackThreshold)
+		if e != nil {
+			fmsg := "%v ##%x SetBufferSize(%q): %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, e)
+			err = e
+		}
+	}
+	return err
+}
+
 // only data-path shall be updated.
 // - return ErrorInconsistentFeed for malformed feed request
 func (feed *Feed) addInstances(
@@ -1172,7 +1269,17 @@ func (feed *Feed) getStatistics() c.Statistics {
 	stats.Set("topic", feed.topic)
 	stats.Set("engines", feed.engineNames())
 	for bucketn, kvdata := range feed.kvdata {
-		stats.Set("bucket-"+bucketn, kvdata.GetStatistics())
+		bstats := kvdata.GetStatistics()
+		if fc, ok := feed.flowControls[bucketn]; ok {
+			fcstats := fc.getStatistics()
+			if dstats, err := feed.feeders[bucketn].GetStats(); err == nil {
+				fcstats["bufferAcks"] = float64(dstats.TotalBufferAckSent)
+				fcstats["bufferResizes"] = float64(dstats.TotalBufferResize)
+				fcstats["connBufferSize"] = float64(dstats.BufferSize)
+			}
+			bstats["flowControl"] = fcstats
+		}
+		stats.Set("bucket-"+bucketn, bstats)
 	}
 	endStats, _ := c.NewStatistics(nil)
 	for raddr, endpoint := range feed.endpoints {
@@ -1226,7 +1333,7 @@ func (feed *Feed) shutdown(opaque uint16) error {
 	}
 	// cleanup
 	close(feed.finch)
-	logging.Infof("%v ##%x feed ... stopped\n", feed.logPrefix, feed.opaque)
+	feed.logCtx(feed.opaque, "").Infof("feed ... stopped\n")
 	return nil
 }
 
@@ -1243,14 +1350,15 @@ func (feed *Feed) cleanupBucket(bucketn string, enginesOk bool) {
 	if ok {
 		feeder.CloseFeed()
 	}
-	delete(feed.feeders, bucketn) // :SideEffect:
+	delete(feed.feeders, bucketn)      // :SideEffect:
+	delete(feed.flowControls, bucketn) // :SideEffect:
 	// cleanup data structures.
 	if kvdata, ok := feed.kvdata[bucketn]; ok {
 		kvdata.Close()
 	}
 	delete(feed.kvdata, bucketn) // :SideEffect:
-	fmsg := "%v ##%x bucket %v removed ..."
-	logging.Infof(fmsg, feed.logPrefix, feed.opaque, bucketn)
+	fmsg := "bucket %v removed ..."
+	feed.logCtx(feed.opaque, bucketn).Infof(fmsg, bucketn)
 }
 
 func (feed *Feed) openFeeder(
@@ -1277,6 +1385,9 @@ func (feed *Feed) openFeeder(
 		"dataChanSize":   feed.config["dcp.dataChanSize"].Int(),
 		"numConnections": feed.config["dcp.numConnections"].Int(),
 		"latencyTick":    feed.config["dcp.latencyTick"].Int(),
+		"xattrs":         feed.config["dcp.xattrs"].Bool(),
+		"snappy":         feed.config["dcp.snappy"].Bool(),
+		"collections":    feed.config["dcp.collections"].Bool(),
 	}
 	kvaddr, err := feed.getLocalKVAddrs(pooln, bucketn, opaque)
 	if err != nil {
@@ -1285,8 +1396,8 @@ func (feed *Feed) openFeeder(
 	kvaddrs := []string{kvaddr}
 	feeder, err = OpenBucketFeed(name, bucket, opaque, kvaddrs, dcpConfig)
 	if err != nil {
-		fmsg := "%v ##%x OpenBucketFeed(%q): %v"
-		logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
+		fmsg := "OpenBucketFeed(%q): %v"
+		feed.logCtx(opaque, bucketn).Errorf(fmsg, bucketn, err)
 		return nil, projC.ErrorFeeder
 	}
 	return feeder, nil
@@ -1308,20 +1419,20 @@ func (feed *Feed) bucketFeed(
 
 	// stop and start are mutually exclusive
 	if stop {
-		fmsg := "%v ##%x stop-timestamp %v\n"
-		logging.Infof(fmsg, feed.logPrefix, opaque, reqTs.Repr())
+		fmsg := "stop-timestamp %v\n"
+		feed.logCtx(opaque, bucketn).Infof(fmsg, reqTs.Repr())
 		if err = feeder.EndVbStreams(opaque, reqTs); err != nil {
-			fmsg := "%v ##%x EndVbStreams(%q): %v"
-			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
+			fmsg := "EndVbStreams(%q): %v"
+			feed.logCtx(opaque, bucketn).Errorf(fmsg, bucketn, err)
 			return projC.ErrorFeeder
 		}
 
 	} else if start {
-		fmsg := "%v ##%x start-timestamp %v\n"
-		logging.Infof(fmsg, feed.logPrefix, opaque, reqTs.Repr())
+		fmsg := "start-timestamp %v\n"
+		feed.logCtx(opaque, bucketn).Infof(fmsg, reqTs.Repr())
 		if err = feeder.StartVbStreams(opaque, reqTs); err != nil {
-			fmsg := "%v ##%x StartVbStreams(%q): %v"
-			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
+			fmsg := "StartVbStreams(%q): %v"
+			feed.logCtx(opaque, bucketn).Errorf(fmsg, bucketn, err)
 			return projC.ErrorFeeder
 		}
 	}
@@ -1701,15 +1812,15 @@ loop:
 			}
 
 		case <-timeout:
-			logging.Errorf("%v ##%x dcp-timeout\n", feed.logPrefix, opaque)
+			feed.logCtx(opaque, "").Errorf("dcp-timeout\n")
 			err = projC.ErrorResponseTimeout
 			break loop
 		}
 	}
 	// re-populate in the same order.
 	if len(msgs) > 0 {
-		fmsg := "%v ##%x re-populating back-channel with %d messages"
-		logging.Infof(fmsg, feed.logPrefix, opaque, len(msgs))
+		fmsg := "re-populating back-channel with %d messages"
+		feed.logCtx(opaque, "").Infof(fmsg, len(msgs))
 	}
 	for _, msg := range msgs {
 		feed.backch <- msg
@@ -1822,3 +1933,18 @@ func FeedConfigParams() []string {
 		"dataport.maxPayload"}
 	return paramNames
 }
+
+// logCtx returns the structured log context for opaque and, if not
+// empty, bucket.
+func (feed *Feed) logCtx(opaque uint16, bucketn string) *logging.Context {
+	fields := logging.Fields{
+		logging.FieldComponent: "Feed",
+		logging.FieldTopic:     feed.topic,
+		"opaque":               opaque,
+	}
+	if bucketn != "" {
+		fields[logging.FieldBucket] = bucketn
+	}
+	prefix := fmt.Sprintf("%v ##%x", feed.logPrefix, opaque)
+	return logging.NewContext(prefix, fields)
+}
@@ -0,0 +1,111 @@
+package projector
+
+import c "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/dcp"
+import "github.com/couchbase/indexing/secondary/logging"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+
+// flowControl tunes the DCP connection buffer of a bucket in a feed, based
+// on the mutation queue depth and flush latency fed back by downstream.
+//
+// The buffer is halved and buffer-acks are made less frequent as long as
+// downstream is above its target queue depth or flush latency, and the
+// buffer is grown by a fixed step, with buffer-acks back to default
+// cadence, once downstream is well below its targets. In between, the
+// buffer is left untouched.
+type flowControl struct {
+	bucket       string
+	bufsize      uint32
+	ackThreshold float32
+	// last feedback from downstream
+	queueDepth   uint64
+	queueMemory  uint64
+	flushLatency uint64 // in milliseconds
+	// stats
+	numFeedbacks uint64
+	numShrinks   uint64
+	numGrows     uint64
+}
+
+// default ack threshold, same as the one DCP connections are opened with.
+const defaultAckThreshold = float32(0.2)
+
+func newFlowControl(bucket string) *flowControl {
+	return &flowControl{
+		bucket:       bucket,
+		bufsize:      couchbase.DEFAULT_WINDOW_SIZE,
+		ackThreshold: defaultAckThreshold,
+	}
+}
+
+// update flow control with feedback from downstream, return whether
+// the connection buffer has to be changed.
+func (fc *flowControl) update(
+	feedback *protobuf.BucketFeedback, config c.Config) bool {
+
+	fc.queueDepth = feedback.GetQueueDepth()
+	fc.queueMemory = feedback.GetQueueMemory()
+	fc.flushLatency = feedback.GetFlushLatency()
+	fc.numFeedbacks++
+
+	if !config["dcp.flowControl.enabled"].Bool() {
+		// restore the buffer connections were opened with.
+		if fc.bufsize == couchbase.DEFAULT_WINDOW_SIZE &&
+			fc.ackThreshold == defaultAckThreshold {
+			return false
+		}
+		fc.bufsize = couchbase.DEFAULT_WINDOW_SIZE
+		fc.ackThreshold = defaultAckThreshold
+		return true
+	}
+
+	minBufsize := uint32(config["dcp.flowControl.minBufferSize"].Int())
+	maxBufsize := uint32(config["dcp.flowControl.maxBufferSize"].Int())
+	step := uint32(config["dcp.flowControl.bufferStep"].Int())
+	maxAckThreshold := float32(config["dcp.flowControl.maxAckThreshold"].Float64())
+	targetDepth := uint64(config["dcp.flowControl.targetQueueDepth"].Int())
+	targetLatency := uint64(config["dcp.flowControl.targetFlushLatency"].Int())
+
+	bufsize, ackThreshold := fc.bufsize, fc.ackThreshold
+	switch {
+	case fc.queueDepth > targetDepth || fc.flushLatency > targetLatency:
+		bufsize /= 2
+		ackThreshold *= 1.5
+		fc.numShrinks++
+
+	case fc.queueDepth < targetDepth/2 && fc.flushLatency < targetLatency/2:
+		bufsize += step
+		ackThreshold = defaultAckThreshold
+		fc.numGrows++
+	}
+	if bufsize < minBufsize {
+		bufsize = minBufsize
+	} else if bufsize > maxBufsize {
+		bufsize = maxBufsize
+	}
+	if ackThreshold > maxAckThreshold {
+		ackThreshold = maxAckThreshold
+	}
+
+	if bufsize == fc.bufsize && ackThreshold == fc.ackThreshold {
+		return false
+	}
+	fmsg := "flowControl %q depth %v latency %vms, buffer %v -> %v\n"
+	logging.Debugf(
+		fmsg, fc.bucket, fc.queueDepth, fc.flushLatency, fc.bufsize, bufsize)
+	fc.bufsize, fc.ackThreshold = bufsize, ackThreshold
+	return true
+}
+
+func (fc *flowControl) getStatistics() map[string]interface{} {
+	return map[string]interface{}{
+		"bufferSize":   float64(fc.bufsize),
+		"ackThreshold": float64(fc.ackThreshold),
+		"queueDepth":   float64(fc.queueDepth),
+		"queueMemory":  float64(fc.queueMemory),
+		"flushLatency": float64(fc.flushLatency),
+		"numFeedbacks": float64(fc.numFeedbacks),
+		"numShrinks":   float64(fc.numShrinks),
+		"numGrows":     float64(fc.numGrows),
+	}
+}
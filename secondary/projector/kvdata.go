@@ -354,6 +354,11 @@ loop:
 					}
 				}
 				stats.Set("vbuckets", statVbuckets)
+				statEngines := make(map[string]interface{})
+				for uuid, engine := range kvdata.engines {
+					statEngines[strconv.FormatUint(uuid, 10)] = engine.GetStatistics()
+				}
+				stats.Set("engines", statEngines)
 				respch <- []interface{}{map[string]interface{}(stats)}
 
 			case kvCmdResetConfig:
@@ -470,6 +475,12 @@ func (kvdata *KVData) scatterMutation(
 		case mcd.DCP_EXPIRATION:
 			kvdata.exprCount++
 		}
+
+	case mcd.DCP_SEQNO_ADVANCED:
+		seqno = m.Seqno
+		if err := worker.Event(m); err != nil {
+			panic(err)
+		}
 	}
 	return
 }
@@ -507,12 +518,14 @@ func (kvdata *KVData) publishStreamEnd() {
 
 func (kvdata *KVData) newStats() c.Statistics {
 	statVbuckets := make(map[string]interface{})
+	statEngines := make(map[string]interface{})
 	m := map[string]interface{}{
 		"events":   float64(0),   // no. of mutations events received
 		"addInsts": float64(0),   // no. of addInstances received
 		"delInsts": float64(0),   // no. of delInsts received
 		"tsCount":  float64(0),   // no. of updateTs received
 		"vbuckets": statVbuckets, // per vbucket statistics
+		"engines":  statEngines,  // per engine statistics
 	}
 	stats, _ := c.NewStatistics(m)
 	return stats
@@ -0,0 +1,97 @@
+package projector
+
+import "net/http"
+import "runtime"
+import "strings"
+
+import c "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/logging"
+import "github.com/couchbase/indexing/secondary/stats"
+
+// Prometheus exposition of projector statistics on /metrics.
+//
+// Feed statistics are nested maps, they are flattened into metrics named
+// by the path of keys, except for keys that identify an entity, which
+// become labels:
+//
+//   feeds.<topic>                -> topic="<topic>"
+//   bucket-<bucket>              -> bucket="<bucket>"
+//   endpoints.<raddr>            -> endpoint="<raddr>"
+//   vbuckets.<vbno>              -> vbucket="<vbno>"
+
+// handle projector statistics in prometheus format
+func (p *Projector) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	logging.Verbosef("%s Request %q\n", p.logPrefix, r.URL.Path)
+
+	pw := stats.NewPromWriter("projector")
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	pw.Gauge("memory_alloc_bytes", "Heap bytes allocated", nil, float64(ms.Alloc))
+	pw.Gauge("memory_sys_bytes", "Bytes obtained from system", nil, float64(ms.Sys))
+	pw.Gauge("goroutines", "Number of goroutines", nil, float64(runtime.NumGoroutine()))
+
+	feeds := p.GetFeeds()
+	pw.Gauge("feeds", "Number of active feeds", nil, float64(len(feeds)))
+	for _, feed := range feeds {
+		fstats := feed.GetStatistics()
+		if fstats == nil {
+			continue
+		}
+		labels := stats.Labels{"topic": feed.topic}
+		flattenMetrics(pw, "feed", labels, map[string]interface{}(fstats))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := pw.Flush(w); err != nil {
+		logging.Errorf("%v writing metrics: %v\n", p.logPrefix, err)
+	}
+}
+
+func flattenMetrics(
+	pw *stats.PromWriter, name string, labels stats.Labels, m map[string]interface{}) {
+
+	for key, value := range m {
+		nlabels, nname := labels, name
+		switch {
+		case strings.HasPrefix(key, "bucket-"):
+			nlabels = withLabel(labels, "bucket", strings.TrimPrefix(key, "bucket-"))
+		case key == "endpoints" || key == "vbuckets" || key == "engines":
+			if sub, ok := value.(map[string]interface{}); ok {
+				label := strings.TrimSuffix(key, "s")
+				for id, v := range sub {
+					if vm, ok := v.(map[string]interface{}); ok {
+						flattenMetrics(pw, name+"_"+label, withLabel(labels, label, id), vm)
+					}
+				}
+			}
+			continue
+		default:
+			nname = name + "_" + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenMetrics(pw, nname, nlabels, v)
+		case c.Statistics:
+			flattenMetrics(pw, nname, nlabels, map[string]interface{}(v))
+		case float64:
+			pw.Gauge(nname, "", nlabels, v)
+		case int:
+			pw.Gauge(nname, "", nlabels, float64(v))
+		case int64:
+			pw.Gauge(nname, "", nlabels, float64(v))
+		case uint64:
+			pw.Gauge(nname, "", nlabels, float64(v))
+		}
+	}
+}
+
+func withLabel(labels stats.Labels, k, v string) stats.Labels {
+	nl := make(stats.Labels, len(labels)+1)
+	for lk, lv := range labels {
+		nl[lk] = lv
+	}
+	nl[k] = v
+	return nl
+}
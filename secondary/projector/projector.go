@@ -116,6 +116,16 @@ func (p *Projector) ResetConfig(config c.Config) {
 	if cv, ok := config["projector.settings.log_level"]; ok {
 		logging.SetLogLevel(logging.Level(cv.String()))
 	}
+	if cv, ok := config["projector.settings.log_format"]; ok {
+		logging.SetLogFormat(logging.Format(cv.String()))
+	}
+	if cv, ok := config["projector.settings.log_sampling.first"]; ok {
+		thereafter := 1
+		if cv1, ok := config["projector.settings.log_sampling.thereafter"]; ok {
+			thereafter = cv1.Int()
+		}
+		logging.SetSampling(cv.Int(), thereafter)
+	}
 	if cv, ok := config["projector.maxCpuPercent"]; ok {
 		c.SetNumCPUs(cv.Int())
 	}
@@ -507,6 +517,55 @@ func (p *Projector) doDelBuckets(
 	return protobuf.NewError(err)
 }
 
+// - return ErrorTopicMissing if feed is not started.
+// - return ErrorInvalidBucket if bucket is not added.
+// - otherwise, error is empty string.
+func (p *Projector) doThrottleBuckets(
+	request *protobuf.ThrottleBucketsRequest, opaque uint16) ap.MessageMarshaller {
+
+	topic := request.GetTopic()
+
+	// log this request.
+	prefix := p.logPrefix
+	fmsg := "%v ##%x doThrottleBuckets() %q %v ackDelay %vms\n"
+	logging.Infof(fmsg, prefix, opaque, topic, request.GetBuckets(),
+		request.GetAckDelay())
+	defer logging.Infof("%v ##%x doThrottleBuckets() returns ...\n", prefix, opaque)
+
+	feed, err := p.acquireFeed(topic)
+	defer p.releaseFeed(topic)
+	if err != nil {
+		logging.Errorf("%v ##%x acquireFeed(): %v\n", prefix, opaque, err)
+		return protobuf.NewError(err)
+	}
+
+	err = feed.ThrottleBuckets(request, opaque)
+	return protobuf.NewError(err)
+}
+
+// - return ErrorTopicMissing if feed is not started.
+// - return ErrorInvalidBucket if bucket is not added.
+// - otherwise, error is empty string.
+func (p *Projector) doFeedback(
+	request *protobuf.FeedbackRequest, opaque uint16) ap.MessageMarshaller {
+
+	topic := request.GetTopic()
+
+	// feedback is periodic, log this request only for debugging.
+	prefix := p.logPrefix
+	logging.Debugf("%v ##%x doFeedback() %q\n", prefix, opaque, topic)
+
+	feed, err := p.acquireFeed(topic)
+	defer p.releaseFeed(topic)
+	if err != nil {
+		logging.Errorf("%v ##%x acquireFeed(): %v\n", prefix, opaque, err)
+		return protobuf.NewError(err)
+	}
+
+	err = feed.Feedback(request, opaque)
+	return protobuf.NewError(err)
+}
+
 // - return ErrorTopicMissing if feed is not started.
 // - return ErrorInconsistentFeed for malformed feed request
 // - otherwise, error is empty string.
@@ -376,7 +376,7 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 			return v
 		}
 		v.mutationCount++
-		v.seqno = m.Seqno // sequence number gets updated only here
+		v.seqno = m.Seqno
 		// prepare a data for each endpoint.
 		dataForEndpoints := make(map[string]interface{})
 		// for each engine distribute transformations to endpoints.
@@ -403,6 +403,24 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 			}
 		}
 
+	case mcd.DCP_SEQNO_ADVANCED: // broadcast Sync
+		if !vbok {
+			fmsg := "%v ##%x vbucket %v not started\n"
+			logging.Errorf(fmsg, logPrefix, m.Opaque, m.VBucket)
+			return v
+		}
+		// no mutation for the seqno, like a system event, downstream
+		// shall still move past it, else a snapshot ending with it
+		// never completes.
+		v.seqno = m.Seqno
+		if data := v.makeSyncData(worker.engines); data != nil {
+			v.syncCount++
+			worker.broadcast2Endpoints(data)
+		} else {
+			fmsg := "%v ##%x Sync NOT PUBLISHED for vbucket %v\n"
+			logging.Errorf(fmsg, logPrefix, m.Opaque, vbno)
+		}
+
 	case mcd.DCP_STREAMEND:
 		if vbok {
 			if data := v.makeStreamEndData(worker.engines); data != nil {
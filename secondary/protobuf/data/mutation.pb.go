@@ -213,6 +213,7 @@ type KeyVersions struct {
 	Keys             [][]byte `protobuf:"bytes,5,rep,name=keys" json:"keys,omitempty"`
 	Oldkeys          [][]byte `protobuf:"bytes,6,rep,name=oldkeys" json:"oldkeys,omitempty"`
 	Partnkeys        [][]byte `protobuf:"bytes,7,rep,name=partnkeys" json:"partnkeys,omitempty"`
+	CollectionID     *uint32  `protobuf:"varint,8,opt,name=collectionID" json:"collectionID,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -269,6 +270,13 @@ func (m *KeyVersions) GetPartnkeys() [][]byte {
 	return nil
 }
 
+func (m *KeyVersions) GetCollectionID() uint32 {
+	if m != nil && m.CollectionID != nil {
+		return *m.CollectionID
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("protobuf.Command", Command_name, Command_value)
 }
@@ -0,0 +1,124 @@
+package protobuf
+
+import "encoding/json"
+import "sort"
+import "strings"
+
+import "github.com/couchbase/indexing/secondary/logging"
+import qvalue "github.com/couchbase/query/value"
+
+// AdaptiveTransform evaluates a document for an adaptive index, which
+// indexes every field of a document without a schema. Secondary key is
+// returned as an array of [fieldpath, value] pairs, one for each scalar
+// field in document, that can be exploded into an index entry per pair by
+// array index.
+//
+// Fields of nested objects are named by their dotted path, like `a.b.c`,
+// and elements of an array are indexed under the path of the array. If
+// `prefixes` are supplied, only fields whose path is one of them, or is
+// nested under one of them, are indexed. If `maxFields` is > 0, no more
+// than `maxFields` pairs are indexed for a document, in the order of their
+// paths. If `maxValueSize` is > 0, string values larger than
+// `maxValueSize` bytes are not indexed.
+func AdaptiveTransform(
+	docid, doc []byte, prefixes []string, maxFields, maxValueSize int,
+	encodeBuf []byte) ([]byte, error) {
+
+	fields, ok := qvalue.NewValue(doc).Actual().(map[string]interface{})
+	if !ok { // not a JSON object, skip document
+		return nil, nil
+	}
+
+	at := &adaptiveTransform{
+		prefixes:     prefixes,
+		maxFields:    maxFields,
+		maxValueSize: maxValueSize,
+		seen:         make(map[string]bool),
+	}
+	at.walk("", fields)
+	if len(at.pairs) == 0 {
+		return nil, nil
+	}
+
+	// The shape of the secondary key looks like,
+	//     [[[path1, value1], [path2, value2], ...]]
+	arrValue := []interface{}{at.pairs}
+	if encodeBuf != nil {
+		out, err := CollateJSONEncode(qvalue.NewValue(arrValue), encodeBuf)
+		if err != nil {
+			fmsg := "CollateJSONEncode: adaptive index for docid: %s (err: %v) skip document"
+			logging.Errorf(fmsg, docid, err)
+			return nil, nil
+		}
+		return out, err // return as collated JSON array
+	}
+	return json.Marshal(arrValue) // return as JSON array
+}
+
+type adaptiveTransform struct {
+	prefixes     []string
+	maxFields    int
+	maxValueSize int
+	pairs        []interface{}
+	seen         map[string]bool // to index a [path, value] pair once
+}
+
+func (at *adaptiveTransform) walk(path string, value interface{}) {
+	if at.maxFields > 0 && len(at.pairs) >= at.maxFields {
+		return
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldpath := key
+			if path != "" {
+				fieldpath = path + "." + key
+			}
+			if index, descend := at.matchPrefix(fieldpath); index || descend {
+				at.walk(fieldpath, val[key])
+			}
+		}
+
+	case []interface{}:
+		for _, item := range val {
+			at.walk(path, item)
+		}
+
+	default:
+		if index, _ := at.matchPrefix(path); !index {
+			return
+		}
+		if s, ok := val.(string); ok && at.maxValueSize > 0 && len(s) > at.maxValueSize {
+			return
+		}
+		pair := []interface{}{path, val}
+		key, err := json.Marshal(pair)
+		if err != nil || at.seen[string(key)] {
+			return
+		}
+		at.seen[string(key)] = true
+		at.pairs = append(at.pairs, pair)
+	}
+}
+
+// matchPrefix returns whether field at path is to be indexed and whether
+// fields nested under path can be indexed.
+func (at *adaptiveTransform) matchPrefix(path string) (index, descend bool) {
+	if len(at.prefixes) == 0 {
+		return true, true
+	}
+	for _, prefix := range at.prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true, true
+		} else if strings.HasPrefix(prefix, path+".") {
+			descend = true
+		}
+	}
+	return false, descend
+}
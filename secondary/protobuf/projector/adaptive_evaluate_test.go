@@ -0,0 +1,47 @@
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+var docAdaptive = []byte(`{"type": "user", "name": {"first": "Daniel", "last": "Fred"}, "age": 32, "tags": ["a", "b", "a"], "bio": "a long biography"}`)
+
+func TestAdaptiveTransform(t *testing.T) {
+	secKey, err := AdaptiveTransform([]byte("docid"), docAdaptive, nil, 0, 0, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := `[[["age",32],["bio","a long biography"],["name.first","Daniel"],` +
+		`["name.last","Fred"],["tags","a"],["tags","b"],["type","user"]]]`
+	if !bytes.Equal(secKey, encodeJSON(ref)) {
+		t.Fatalf("evaluation failed %v", decodeCollateJSON(secKey))
+	}
+}
+
+func TestAdaptiveTransformLimits(t *testing.T) {
+	prefixes := []string{"name", "bio", "tags"}
+	secKey, err := AdaptiveTransform([]byte("docid"), docAdaptive, prefixes, 3, 10, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := `[[["name.first","Daniel"],["name.last","Fred"],["tags","a"]]]`
+	if !bytes.Equal(secKey, encodeJSON(ref)) {
+		t.Fatalf("evaluation failed %v", decodeCollateJSON(secKey))
+	}
+
+	secKey, err = AdaptiveTransform([]byte("docid"), docAdaptive, []string{"name.middle"}, 0, 0, buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if secKey != nil {
+		t.Fatalf("expected document to be skipped %v", decodeCollateJSON(secKey))
+	}
+}
+
+func BenchmarkAdaptiveTransform2000(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		AdaptiveTransform([]byte("docid"), doc2000, nil, 0, 0, buf)
+	}
+}
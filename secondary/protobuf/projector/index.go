@@ -1,6 +1,7 @@
 package protobuf
 
 import "fmt"
+import "sync/atomic"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import c "github.com/couchbase/indexing/secondary/common"
@@ -92,11 +93,18 @@ func (instance *IndexInst) GetPartitionObject() Partition {
 // IndexEvaluator implements `Evaluator` interface for protobuf
 // definition of an index instance.
 type IndexEvaluator struct {
+	// 64-bit aligned counters, updated by concurrent vbucket workers.
+	suppressedUpsertDeletions uint64 // mutations not sent for partial index
+	suppressedDeletions       uint64 // deletions not sent for partial index
+
 	skExprs  []interface{} // compiled expression
 	pkExpr   interface{}   // compiled expression
 	whExpr   interface{}   // compiled expression
 	instance *IndexInst
 	version  FeedVersion
+	// collection of the index, mutations from other collections
+	// are filtered out before evaluation.
+	collectionId uint32
 }
 
 // NewIndexEvaluator returns a reference to a new instance
@@ -109,6 +117,11 @@ func NewIndexEvaluator(instance *IndexInst,
 	ie := &IndexEvaluator{instance: instance, version: version}
 	// compile expressions once and reuse it many times.
 	defn := ie.instance.GetDefinition()
+	ie.collectionId, err = c.ParseCollectionId(defn.GetCollectionID())
+	if err != nil {
+		logging.Errorf("invalid collection id %q\n", defn.GetCollectionID())
+		return nil, err
+	}
 	exprtype := defn.GetExprType()
 	switch exprtype {
 	case ExprType_N1QL:
@@ -209,6 +222,18 @@ func (ie *IndexEvaluator) TransformRoute(
 	var npkey /*new-partition*/, opkey /*old-partition*/, nkey, okey []byte
 	instn := ie.instance
 
+	switch m.Opcode {
+	case mcd.DCP_MUTATION, mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
+		if m.CollectionID != ie.collectionId {
+			return nil // document belongs to another collection
+		}
+	}
+	if m.Opcode == mcd.DCP_MUTATION && m.Error != nil {
+		// value could not be decoded, evaluating it would delete the
+		// document from index.
+		return m.Error
+	}
+
 	meta := dcpEvent2Meta(m)
 	where, err := ie.wherePredicate(m.Value, meta, encodeBuf)
 	if err != nil {
@@ -241,15 +266,13 @@ func (ie *IndexEvaluator) TransformRoute(
 		uuid, where, string(npkey), string(nkey))
 	switch m.Opcode {
 	case mcd.DCP_MUTATION:
-		// FIXME: TODO: where clause is not used to for optimizing out messages
-		// not passing the where clause. For this we need a gaurantee that
-		// where clause will be defined only on immutable fields.
 		if where { // WHERE predicate, sent upsert only if where is true.
 			raddrs := instn.UpsertEndpoints(m, npkey, nkey, okey)
 			for _, raddr := range raddrs {
 				dkv, ok := data[raddr].(*c.DataportKeyVersions)
 				if !ok {
 					kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
+					kv.CollectionId = m.CollectionID
 					kv.AddUpsert(uuid, nkey, okey)
 					dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
 				} else {
@@ -257,6 +280,10 @@ func (ie *IndexEvaluator) TransformRoute(
 				}
 				data[raddr] = dkv
 			}
+		} else if skip, err := ie.neverIndexed(m, meta, encodeBuf); err != nil {
+			return err
+		} else if skip {
+			atomic.AddUint64(&ie.suppressedUpsertDeletions, 1)
 		} else { // if WHERE is false, broadcast upsertdelete.
 			// NOTE: downstream can use upsertdelete and immutable flag
 			// to optimize out back-index lookup.
@@ -265,6 +292,7 @@ func (ie *IndexEvaluator) TransformRoute(
 				dkv, ok := data[raddr].(*c.DataportKeyVersions)
 				if !ok {
 					kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
+					kv.CollectionId = m.CollectionID
 					kv.AddUpsertDeletion(uuid, okey)
 					dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
 				} else {
@@ -275,12 +303,21 @@ func (ie *IndexEvaluator) TransformRoute(
 		}
 
 	case mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
+		if len(m.OldValue) > 0 {
+			if skip, err := ie.neverIndexed(m, meta, encodeBuf); err != nil {
+				return err
+			} else if skip {
+				atomic.AddUint64(&ie.suppressedDeletions, 1)
+				return nil
+			}
+		}
 		// Delete shall be broadcasted if old-key is not available.
 		raddrs := instn.DeletionEndpoints(m, opkey, okey)
 		for _, raddr := range raddrs {
 			dkv, ok := data[raddr].(*c.DataportKeyVersions)
 			if !ok {
 				kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
+				kv.CollectionId = m.CollectionID
 				kv.AddDeletion(uuid, okey)
 				dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
 			} else {
@@ -292,6 +329,42 @@ func (ie *IndexEvaluator) TransformRoute(
 	return nil
 }
 
+// GetStatistics return the counters of this evaluator.
+func (ie *IndexEvaluator) GetStatistics() map[string]interface{} {
+	return map[string]interface{}{
+		"suppressedUpsertDeletions": float64(atomic.LoadUint64(&ie.suppressedUpsertDeletions)),
+		"suppressedDeletions":       float64(atomic.LoadUint64(&ie.suppressedDeletions)),
+	}
+}
+
+// neverIndexed return whether the document in mutation `m`, that does
+// not pass the WHERE predicate now, could not have passed it in its
+// previous version either. Then there is no entry in a partial index for
+// the document, to be removed by UpsertDeletion or Deletion, and the
+// indexer need not do a back-index lookup for it.
+//
+// This is the case when the index declares the fields of its WHERE
+// predicate as immutable, or when the old value of document is available
+// and does not pass the WHERE predicate.
+func (ie *IndexEvaluator) neverIndexed(
+	m *mc.DcpEvent, meta map[string]interface{}, encodeBuf []byte) (bool, error) {
+
+	if ie.whExpr == nil { // not a partial index
+		return false, nil
+	}
+	defn := ie.instance.GetDefinition()
+	if m.Opcode == mcd.DCP_MUTATION && defn.GetWhereImmutable() {
+		return true, nil
+	} else if len(m.OldValue) == 0 {
+		return false, nil
+	}
+	where, err := ie.wherePredicate(m.OldValue, meta, encodeBuf)
+	if err != nil {
+		return false, err
+	}
+	return !where, nil
+}
+
 func (ie *IndexEvaluator) evaluate(
 	docid, doc []byte, meta map[string]interface{}, encodeBuf []byte) ([]byte, error) {
 
@@ -300,6 +373,12 @@ func (ie *IndexEvaluator) evaluate(
 		return []byte(`["` + string(docid) + `"]`), nil
 	}
 
+	if defn.GetIsAdaptive() { // all fields of document
+		return AdaptiveTransform(
+			docid, doc, defn.GetFieldPrefixes(), int(defn.GetMaxFields()),
+			int(defn.GetMaxValueSize()), encodeBuf)
+	}
+
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
@@ -353,7 +432,7 @@ func (ie *IndexEvaluator) wherePredicate(
 
 // helper functions
 func dcpEvent2Meta(m *mc.DcpEvent) map[string]interface{} {
-	return map[string]interface{}{
+	meta := map[string]interface{}{
 		"id":       string(m.Key),
 		"byseqno":  m.Seqno,
 		"revseqno": m.RevSeqno,
@@ -363,4 +442,8 @@ func dcpEvent2Meta(m *mc.DcpEvent) map[string]interface{} {
 		"nru":      m.Nru,
 		"cas":      m.Cas,
 	}
+	if len(m.Xattrs) > 0 {
+		meta["xattrs"] = xattrs2N1QL(m.Xattrs)
+	}
+	return meta
 }
@@ -239,6 +239,16 @@ type IndexDefn struct {
 	PartitionScheme  *PartitionScheme `protobuf:"varint,8,opt,name=partitionScheme,enum=protobuf.PartitionScheme" json:"partitionScheme,omitempty"`
 	PartnExpression  *string          `protobuf:"bytes,9,opt,name=partnExpression" json:"partnExpression,omitempty"`
 	WhereExpression  *string          `protobuf:"bytes,10,opt,name=whereExpression" json:"whereExpression,omitempty"`
+	Scope            *string          `protobuf:"bytes,11,opt,name=scope" json:"scope,omitempty"`
+	ScopeID          *string          `protobuf:"bytes,12,opt,name=scopeID" json:"scopeID,omitempty"`
+	Collection       *string          `protobuf:"bytes,13,opt,name=collection" json:"collection,omitempty"`
+	CollectionID     *string          `protobuf:"bytes,14,opt,name=collectionID" json:"collectionID,omitempty"`
+	IsAdaptive       *bool            `protobuf:"varint,15,opt,name=isAdaptive" json:"isAdaptive,omitempty"`
+	FieldPrefixes    []string         `protobuf:"bytes,16,rep,name=fieldPrefixes" json:"fieldPrefixes,omitempty"`
+	MaxFields        *uint32          `protobuf:"varint,17,opt,name=maxFields" json:"maxFields,omitempty"`
+	MaxValueSize     *uint32          `protobuf:"varint,18,opt,name=maxValueSize" json:"maxValueSize,omitempty"`
+	Immutable        *bool            `protobuf:"varint,19,opt,name=immutable" json:"immutable,omitempty"`
+	WhereImmutable   *bool            `protobuf:"varint,20,opt,name=whereImmutable" json:"whereImmutable,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
@@ -316,6 +326,76 @@ func (m *IndexDefn) GetWhereExpression() string {
 	return ""
 }
 
+func (m *IndexDefn) GetScope() string {
+	if m != nil && m.Scope != nil {
+		return *m.Scope
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetScopeID() string {
+	if m != nil && m.ScopeID != nil {
+		return *m.ScopeID
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetCollection() string {
+	if m != nil && m.Collection != nil {
+		return *m.Collection
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetCollectionID() string {
+	if m != nil && m.CollectionID != nil {
+		return *m.CollectionID
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetIsAdaptive() bool {
+	if m != nil && m.IsAdaptive != nil {
+		return *m.IsAdaptive
+	}
+	return false
+}
+
+func (m *IndexDefn) GetFieldPrefixes() []string {
+	if m != nil {
+		return m.FieldPrefixes
+	}
+	return nil
+}
+
+func (m *IndexDefn) GetMaxFields() uint32 {
+	if m != nil && m.MaxFields != nil {
+		return *m.MaxFields
+	}
+	return 0
+}
+
+func (m *IndexDefn) GetMaxValueSize() uint32 {
+	if m != nil && m.MaxValueSize != nil {
+		return *m.MaxValueSize
+	}
+	return 0
+}
+
+func (m *IndexDefn) GetImmutable() bool {
+	if m != nil && m.Immutable != nil {
+		return *m.Immutable
+	}
+	return false
+}
+
+func (m *IndexDefn) GetWhereImmutable() bool {
+	if m != nil && m.WhereImmutable != nil {
+		return *m.WhereImmutable
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterEnum("protobuf.IndexState", IndexState_name, IndexState_value)
 	proto.RegisterEnum("protobuf.StorageType", StorageType_name, StorageType_value)
@@ -0,0 +1,121 @@
+package protobuf
+
+import (
+	"errors"
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/golang/protobuf/proto"
+)
+
+var docOld = []byte(`{"name": "Fred", "age": 20}`)
+var docYoung = []byte(`{"name": "Fred", "age": 21}`)
+var docAdult = []byte(`{"name": "Fred", "age": 32}`)
+
+func newPartialEvaluator(t *testing.T, whereImmutable bool) *IndexEvaluator {
+	defn := &IndexDefn{
+		DefnID:          proto.Uint64(20),
+		Bucket:          proto.String("default"),
+		IsPrimary:       proto.Bool(false),
+		Name:            proto.String("adults"),
+		Using:           StorageType_memdb.Enum(),
+		ExprType:        ExprType_N1QL.Enum(),
+		SecExpressions:  []string{`name`},
+		PartitionScheme: PartitionScheme_SINGLE.Enum(),
+		WhereExpression: proto.String(`age > 30`),
+		WhereImmutable:  proto.Bool(whereImmutable),
+	}
+	ii := &IndexInst{
+		InstId:      proto.Uint64(0x20),
+		State:       IndexState_IndexInitial.Enum(),
+		Definition:  defn,
+		SinglePartn: NewSinglePartition([]string{"localhost:9104"}),
+	}
+	ie, err := NewIndexEvaluator(ii, FeedVersion_watson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ie
+}
+
+func transformCommands(
+	t *testing.T, ie *IndexEvaluator, opcode mcd.CommandCode, value, oldValue []byte) []byte {
+
+	m := &mc.DcpEvent{
+		Opcode: opcode, VBucket: 1, Key: []byte("docid"), Value: value,
+		OldValue: oldValue, Seqno: 10,
+	}
+	data := make(map[string]interface{})
+	if err := ie.TransformRoute(1234, m, data, buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return data["localhost:9104"].(*c.DataportKeyVersions).Kv.Commands
+}
+
+func TestPartialIndexSuppression(t *testing.T) {
+	ie := newPartialEvaluator(t, false)
+
+	if cmds := transformCommands(t, ie, mcd.DCP_MUTATION, docAdult, nil); len(cmds) != 1 || cmds[0] != c.Upsert {
+		t.Fatalf("expected upsert, got %v", cmds)
+	}
+	// without old value the document might have been in the index.
+	if cmds := transformCommands(t, ie, mcd.DCP_MUTATION, docYoung, nil); len(cmds) != 1 || cmds[0] != c.UpsertDeletion {
+		t.Fatalf("expected upsert-deletion, got %v", cmds)
+	}
+	if cmds := transformCommands(t, ie, mcd.DCP_MUTATION, docYoung, docAdult); len(cmds) != 1 || cmds[0] != c.UpsertDeletion {
+		t.Fatalf("expected upsert-deletion, got %v", cmds)
+	}
+	if cmds := transformCommands(t, ie, mcd.DCP_MUTATION, docYoung, docOld); cmds != nil {
+		t.Fatalf("expected upsert-deletion to be suppressed, got %v", cmds)
+	}
+	if cmds := transformCommands(t, ie, mcd.DCP_DELETION, nil, docOld); cmds != nil {
+		t.Fatalf("expected deletion to be suppressed, got %v", cmds)
+	}
+	if cmds := transformCommands(t, ie, mcd.DCP_DELETION, nil, nil); len(cmds) != 1 || cmds[0] != c.Deletion {
+		t.Fatalf("expected deletion, got %v", cmds)
+	}
+
+	stats := ie.GetStatistics()
+	if stats["suppressedUpsertDeletions"] != float64(1) || stats["suppressedDeletions"] != float64(1) {
+		t.Fatalf("unexpected statistics %v", stats)
+	}
+
+	// immutable document fields say nothing about the WHERE clause.
+	ie = newPartialEvaluator(t, false)
+	ie.instance.GetDefinition().Immutable = proto.Bool(true)
+	if cmds := transformCommands(t, ie, mcd.DCP_MUTATION, docYoung, nil); len(cmds) != 1 || cmds[0] != c.UpsertDeletion {
+		t.Fatalf("expected upsert-deletion, got %v", cmds)
+	}
+
+	// with where fields immutable, old value is not needed.
+	ie = newPartialEvaluator(t, true)
+	if cmds := transformCommands(t, ie, mcd.DCP_MUTATION, docYoung, nil); cmds != nil {
+		t.Fatalf("expected upsert-deletion to be suppressed, got %v", cmds)
+	}
+	if cmds := transformCommands(t, ie, mcd.DCP_DELETION, nil, nil); len(cmds) != 1 || cmds[0] != c.Deletion {
+		t.Fatalf("expected deletion, got %v", cmds)
+	}
+}
+
+func TestUndecodableValue(t *testing.T) {
+	ie := newPartialEvaluator(t, false)
+
+	// a value that could not be decoded is neither indexed nor deleted.
+	m := &mc.DcpEvent{
+		Opcode: mcd.DCP_MUTATION, VBucket: 1, Key: []byte("docid"),
+		Value: []byte{0xff, 0xff}, Datatype: mcd.DatatypeSnappy, Seqno: 10,
+		Error: errors.New("corrupt input"),
+	}
+	data := make(map[string]interface{})
+	if err := ie.TransformRoute(1234, m, data, buf); err != m.Error {
+		t.Fatalf("expected error %v, got %v", m.Error, err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("expected no commands, got %v", data)
+	}
+}
@@ -26,9 +26,11 @@ var missing = qvalue.NewValue(string(collatejson.MissingLiteral))
 // N1QLTransform will use compiled list of expression from N1QL's DDL
 // statement and evaluate a document using them to return a secondary
 // key as JSON object.
+// `xattrs` in `meta` is available only for documents streamed along
+// with their extended attributes.
 // `meta` supplies a dictionary of,
 //      `id`, `byseqno`, `revseqno`, `flags`, `expiry`, `locktime`,
-//      `nru`, `cas`
+//      `nru`, `cas`, `xattrs`
 func N1QLTransform(
 	docid, doc []byte, cExprs []interface{},
 	meta map[string]interface{}, encodeBuf []byte) ([]byte, error) {
@@ -133,3 +135,13 @@ func CollateJSONEncode(val qvalue.Value, encodeBuf []byte) ([]byte, error) {
 	encoded, err := codec.EncodeN1QLValue(val, encodeBuf[:0])
 	return append([]byte(nil), encoded...), err
 }
+
+// xattrs2N1QL returns document's extended attributes as N1QL values, so
+// that they can be referred in expressions as `meta().xattrs.<name>`.
+func xattrs2N1QL(xattrs map[string][]byte) map[string]interface{} {
+	values := make(map[string]interface{}, len(xattrs))
+	for name, value := range xattrs {
+		values[name] = qvalue.NewValue(value)
+	}
+	return values
+}
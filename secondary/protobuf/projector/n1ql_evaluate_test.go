@@ -101,6 +101,24 @@ func TestN1QLTransform2000(t *testing.T) {
 	}
 }
 
+func TestN1QLTransformXattrs(t *testing.T) {
+	cExprs, err := CompileN1QLExpression(
+		[]string{`meta().xattrs._sync.rev`, `city`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	xattrs := map[string][]byte{"_sync": []byte(`{"rev":"2-abc"}`)}
+	meta := map[string]interface{}{"id": "docid", "xattrs": xattrs2N1QL(xattrs)}
+	secKey, err := N1QLTransform([]byte("docid"), doc150, cExprs, meta, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(secKey, encodeJSON(`["2-abc","Kathmandu"]`)) {
+		t.Fatalf("evaluation failed %v", decodeCollateJSON(secKey))
+	}
+}
+
 func BenchmarkCompileN1QLExpression(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		CompileN1QLExpression([]string{`age`})
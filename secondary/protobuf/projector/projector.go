@@ -637,6 +637,91 @@ func (req *DelBucketsRequest) Decode(data []byte) (err error) {
 	return proto.Unmarshal(data, req)
 }
 
+// **********************
+// ThrottleBucketsRequest
+// **********************
+
+// NewThrottleBucketsRequest creates a ThrottleBucketsRequest
+// for topic to delay buffer-acks for one or more buckets.
+func NewThrottleBucketsRequest(
+	topic string, buckets []string, ackDelay uint32) *ThrottleBucketsRequest {
+
+	return &ThrottleBucketsRequest{
+		Topic:    proto.String(topic),
+		Buckets:  buckets,
+		AckDelay: proto.Uint32(ackDelay),
+	}
+}
+
+// Name implement MessageMarshaller{} interface
+func (req *ThrottleBucketsRequest) Name() string {
+	return "throttleBucketsRequest"
+}
+
+// ContentType implement MessageMarshaller{} interface
+func (req *ThrottleBucketsRequest) ContentType() string {
+	return "application/protobuf"
+}
+
+// Encode implement MessageMarshaller{} interface
+func (req *ThrottleBucketsRequest) Encode() (data []byte, err error) {
+	return proto.Marshal(req)
+}
+
+// Decode implement MessageMarshaller{} interface
+func (req *ThrottleBucketsRequest) Decode(data []byte) (err error) {
+	return proto.Unmarshal(data, req)
+}
+
+// ***************
+// FeedbackRequest
+// ***************
+
+// NewFeedbackRequest creates a FeedbackRequest for topic
+// with downstream load of one or more buckets.
+func NewFeedbackRequest(
+	topic string, buckets []*BucketFeedback) *FeedbackRequest {
+
+	return &FeedbackRequest{
+		Topic:   proto.String(topic),
+		Buckets: buckets,
+	}
+}
+
+// NewBucketFeedback creates downstream load for a bucket,
+// `flushLatency` is in milliseconds.
+func NewBucketFeedback(
+	bucket string,
+	queueDepth, queueMemory, flushLatency uint64) *BucketFeedback {
+
+	return &BucketFeedback{
+		Bucket:       proto.String(bucket),
+		QueueDepth:   proto.Uint64(queueDepth),
+		QueueMemory:  proto.Uint64(queueMemory),
+		FlushLatency: proto.Uint64(flushLatency),
+	}
+}
+
+// Name implement MessageMarshaller{} interface
+func (req *FeedbackRequest) Name() string {
+	return "feedbackRequest"
+}
+
+// ContentType implement MessageMarshaller{} interface
+func (req *FeedbackRequest) ContentType() string {
+	return "application/protobuf"
+}
+
+// Encode implement MessageMarshaller{} interface
+func (req *FeedbackRequest) Encode() (data []byte, err error) {
+	return proto.Marshal(req)
+}
+
+// Decode implement MessageMarshaller{} interface
+func (req *FeedbackRequest) Decode(data []byte) (err error) {
+	return proto.Unmarshal(data, req)
+}
+
 // *******************
 // AddInstancesRequest
 // *******************
@@ -432,6 +432,109 @@ func (m *DelBucketsRequest) GetBuckets() []string {
 	return nil
 }
 
+// ThrottleBucketsRequest will delay buffer-acks of DCP connections for
+// specified buckets, to slow down their vbucket-streams when downstream
+// is under memory pressure. Error message will be sent as response.
+type ThrottleBucketsRequest struct {
+	Topic            *string  `protobuf:"bytes,1,req,name=topic" json:"topic,omitempty"`
+	Buckets          []string `protobuf:"bytes,2,rep,name=buckets" json:"buckets,omitempty"`
+	AckDelay         *uint32  `protobuf:"varint,3,req,name=ackDelay" json:"ackDelay,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ThrottleBucketsRequest) Reset()         { *m = ThrottleBucketsRequest{} }
+func (m *ThrottleBucketsRequest) String() string { return proto.CompactTextString(m) }
+func (*ThrottleBucketsRequest) ProtoMessage()    {}
+
+func (m *ThrottleBucketsRequest) GetTopic() string {
+	if m != nil && m.Topic != nil {
+		return *m.Topic
+	}
+	return ""
+}
+
+func (m *ThrottleBucketsRequest) GetBuckets() []string {
+	if m != nil {
+		return m.Buckets
+	}
+	return nil
+}
+
+func (m *ThrottleBucketsRequest) GetAckDelay() uint32 {
+	if m != nil && m.AckDelay != nil {
+		return *m.AckDelay
+	}
+	return 0
+}
+
+// FeedbackRequest reports downstream load for buckets of a topic, to
+// adapt the flow control of their DCP connections.
+// Error message will be sent as response.
+type FeedbackRequest struct {
+	Topic            *string           `protobuf:"bytes,1,req,name=topic" json:"topic,omitempty"`
+	Buckets          []*BucketFeedback `protobuf:"bytes,2,rep,name=buckets" json:"buckets,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *FeedbackRequest) Reset()         { *m = FeedbackRequest{} }
+func (m *FeedbackRequest) String() string { return proto.CompactTextString(m) }
+func (*FeedbackRequest) ProtoMessage()    {}
+
+func (m *FeedbackRequest) GetTopic() string {
+	if m != nil && m.Topic != nil {
+		return *m.Topic
+	}
+	return ""
+}
+
+func (m *FeedbackRequest) GetBuckets() []*BucketFeedback {
+	if m != nil {
+		return m.Buckets
+	}
+	return nil
+}
+
+// BucketFeedback is the downstream load for a bucket.
+type BucketFeedback struct {
+	Bucket           *string `protobuf:"bytes,1,req,name=bucket" json:"bucket,omitempty"`
+	QueueDepth       *uint64 `protobuf:"varint,2,req,name=queueDepth" json:"queueDepth,omitempty"`
+	QueueMemory      *uint64 `protobuf:"varint,3,req,name=queueMemory" json:"queueMemory,omitempty"`
+	FlushLatency     *uint64 `protobuf:"varint,4,req,name=flushLatency" json:"flushLatency,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *BucketFeedback) Reset()         { *m = BucketFeedback{} }
+func (m *BucketFeedback) String() string { return proto.CompactTextString(m) }
+func (*BucketFeedback) ProtoMessage()    {}
+
+func (m *BucketFeedback) GetBucket() string {
+	if m != nil && m.Bucket != nil {
+		return *m.Bucket
+	}
+	return ""
+}
+
+func (m *BucketFeedback) GetQueueDepth() uint64 {
+	if m != nil && m.QueueDepth != nil {
+		return *m.QueueDepth
+	}
+	return 0
+}
+
+func (m *BucketFeedback) GetQueueMemory() uint64 {
+	if m != nil && m.QueueMemory != nil {
+		return *m.QueueMemory
+	}
+	return 0
+}
+
+func (m *BucketFeedback) GetFlushLatency() uint64 {
+	if m != nil && m.FlushLatency != nil {
+		return *m.FlushLatency
+	}
+	return 0
+}
+
 // AddInstancesRequest to add index-instances to a topic.
 // Respond back with TimestampResponse
 type AddInstancesRequest struct {
@@ -98,3 +98,9 @@ func NewTsConsistency(
 		Crc64: proto.Uint64(crc64),
 	}
 }
+
+// NewTsStaleness returns a consistency vector for
+// BoundedStalenessConsistency, staleness is in milliseconds.
+func NewTsStaleness(staleness uint32) *TsConsistency {
+	return &TsConsistency{Staleness: proto.Uint32(staleness)}
+}
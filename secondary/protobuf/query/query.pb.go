@@ -62,11 +62,13 @@ func (m *Error) GetError() string {
 // AnyConsistency, this message is typically ignored.
 // SessionConsistency, {vbnos, seqnos, crc64} are to be considered.
 // QueryConsistency, {vbnos, seqnos, vbuuids} are to be considered.
+// BoundedStalenessConsistency, {staleness} is to be considered.
 type TsConsistency struct {
 	Vbnos            []uint32 `protobuf:"varint,1,rep,name=vbnos" json:"vbnos,omitempty"`
 	Seqnos           []uint64 `protobuf:"varint,2,rep,name=seqnos" json:"seqnos,omitempty"`
 	Vbuuids          []uint64 `protobuf:"varint,3,rep,name=vbuuids" json:"vbuuids,omitempty"`
 	Crc64            *uint64  `protobuf:"varint,4,opt,name=crc64" json:"crc64,omitempty"`
+	Staleness        *uint32  `protobuf:"varint,5,opt,name=staleness" json:"staleness,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -102,6 +104,13 @@ func (m *TsConsistency) GetCrc64() uint64 {
 	return 0
 }
 
+func (m *TsConsistency) GetStaleness() uint32 {
+	if m != nil && m.Staleness != nil {
+		return *m.Staleness
+	}
+	return 0
+}
+
 // Request can be one of the optional field.
 type QueryPayload struct {
 	Version           *uint32             `protobuf:"varint,1,req,name=version" json:"version,omitempty"`
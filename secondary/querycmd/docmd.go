@@ -44,6 +44,10 @@ type Command struct {
 	WithPlan  map[string]interface{}
 	// options for build index
 	Bindexes []string
+	// options for rename index
+	NewName string
+	// options for index usage report
+	UnusedFor time.Duration
 	// options for Range, Statistics, Count
 	Low         c.SecondaryKey
 	High        c.SecondaryKey
@@ -64,6 +68,7 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 	var inclusion uint
 	var equal, low, high string
 	var useSessionCons bool
+	var unusedFor string
 
 	cmdOptions := &Command{Consistency: c.AnyConsistency}
 	fset := flag.NewFlagSet("cmd", flag.ExitOnError)
@@ -72,15 +77,19 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 	fset.StringVar(&cmdOptions.Server, "server", "", "Cluster server address")
 	fset.StringVar(&cmdOptions.Auth, "auth", "", "Auth user and password")
 	fset.StringVar(&cmdOptions.Bucket, "bucket", "", "Bucket name")
-	fset.StringVar(&cmdOptions.OpType, "type", "", "Command: scan|stats|scanAll|count|nodes|create|build|drop|list|config")
+	fset.StringVar(&cmdOptions.OpType, "type", "", "Command: scan|stats|scanAll|count|nodes|create|build|pause|resume|cancel|drop|rename|list|usage|config")
 	fset.StringVar(&cmdOptions.IndexName, "index", "", "Index name")
 	// options for create-index
 	fset.StringVar(&cmdOptions.WhereStr, "where", "", "where clause for create index")
 	fset.StringVar(&fields, "fields", "", "Comma separated on-index fields") // secStrs
 	fset.BoolVar(&cmdOptions.IsPrimary, "primary", false, "Is primary index")
 	fset.StringVar(&cmdOptions.With, "with", "", "index specific properties")
-	// options for build-indexes, drop-indexes
-	fset.StringVar(&bindexes, "indexes", "", "csv list of bucket:index to build")
+	// options for rename-index
+	fset.StringVar(&cmdOptions.NewName, "newname", "", "new name for rename index")
+	// options for index usage report
+	fset.StringVar(&unusedFor, "unusedfor", "", "report indexes not scanned for this duration as unused, eg. 24h")
+	// options for build-indexes, drop-indexes, pause/resume/cancel-index-build
+	fset.StringVar(&bindexes, "indexes", "", "csv list of bucket:index to build, pause, resume or cancel")
 	// options for Range, Statistics, Count
 	fset.StringVar(&low, "low", "[]", "Span.Range: [low]")
 	fset.StringVar(&high, "high", "[]", "Span.Range: [high]")
@@ -106,6 +115,14 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 		cmdOptions.Consistency = c.SessionConsistency
 	}
 
+	if unusedFor != "" {
+		d, err := time.ParseDuration(unusedFor)
+		if err != nil {
+			return nil, nil, fset, fmt.Errorf("invalid unusedfor %v: %v", unusedFor, err)
+		}
+		cmdOptions.UnusedFor = d
+	}
+
 	// if server is not specified, try guessing
 	if cmdOptions.Server == "" {
 		if guess := guessServer(); guess != "" {
@@ -241,24 +258,34 @@ func HandleCommand(
 		}
 
 	case "build":
-		defnIDs := make([]uint64, 0, len(cmd.Bindexes))
-		for _, bindex := range cmd.Bindexes {
-			v := strings.Split(bindex, ":")
-			if len(v) < 0 {
-				return fmt.Errorf("invalid index specified : %v", bindex)
+		var defnIDs []uint64
+		if defnIDs, err = getDefnIDs(client, cmd.Bindexes); err == nil {
+			err = client.BuildIndexes(defnIDs)
+			fmt.Fprintf(w, "Index building for: %v\n", defnIDs)
+		}
+
+	case "pause":
+		var defnIDs []uint64
+		if defnIDs, err = getDefnIDs(client, cmd.Bindexes); err == nil {
+			if err = client.PauseIndexBuild(defnIDs); err == nil {
+				fmt.Fprintf(w, "Index build paused for: %v\n", defnIDs)
 			}
-			bucket, iname = v[0], v[1]
-			index, ok := GetIndex(client, bucket, iname)
-			if ok {
-				defnIDs = append(defnIDs, uint64(index.Definition.DefnId))
-			} else {
-				err = fmt.Errorf("index %v/%v unknown", bucket, iname)
-				break
+		}
+
+	case "resume":
+		var defnIDs []uint64
+		if defnIDs, err = getDefnIDs(client, cmd.Bindexes); err == nil {
+			if err = client.ResumeIndexBuild(defnIDs); err == nil {
+				fmt.Fprintf(w, "Index build resumed for: %v\n", defnIDs)
 			}
 		}
-		if err == nil {
-			err = client.BuildIndexes(defnIDs)
-			fmt.Fprintf(w, "Index building for: %v\n", defnIDs)
+
+	case "cancel":
+		var defnIDs []uint64
+		if defnIDs, err = getDefnIDs(client, cmd.Bindexes); err == nil {
+			if err = client.CancelIndexBuild(defnIDs); err == nil {
+				fmt.Fprintf(w, "Index build cancelled for: %v\n", defnIDs)
+			}
 		}
 
 	case "drop":
@@ -274,6 +301,16 @@ func HandleCommand(
 			break
 		}
 
+	case "rename":
+		index, ok := GetIndex(client, cmd.Bucket, cmd.IndexName)
+		if !ok {
+			return fmt.Errorf("invalid index specified : %v", cmd.IndexName)
+		}
+		err = client.RenameIndex(uint64(index.Definition.DefnId), cmd.NewName)
+		if err == nil {
+			fmt.Fprintf(w, "Index renamed %v/%v to %v\n", bucket, iname, cmd.NewName)
+		}
+
 	case "scan":
 		var state c.IndexState
 
@@ -376,6 +413,21 @@ func HandleCommand(
 			}
 		}
 
+	case "usage":
+		nodes, err := client.Nodes()
+		if err != nil {
+			return err
+		}
+		var usages []*c.IndexUsage
+		for _, indexer := range nodes {
+			report, err := getIndexUsage(indexer.Adminport, cmd.Auth)
+			if err != nil {
+				return err
+			}
+			usages = append(usages, report.Indexes...)
+		}
+		printIndexUsage(w, c.NewIndexUsageReport(usages, cmd.UnusedFor))
+
 	case "config":
 		nodes, err := client.Nodes()
 		if err != nil {
@@ -466,7 +518,89 @@ func printIndexInfo(w io.Writer, index *mclient.IndexMetadata) {
 	}
 }
 
+// getIndexUsage from indexer node listening on adminport.
+func getIndexUsage(adminport, auth string) (*c.IndexUsageReport, error) {
+	host, sport, err := net.SplitHostPort(adminport)
+	if err != nil {
+		return nil, err
+	}
+	iport, _ := strconv.Atoi(sport)
+
+	// indexer http port follows admin and scan ports
+	url := "http://" + host + ":" + strconv.Itoa(iport+2) + "/stats/usage?async=false"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		up := strings.Split(auth, ":")
+		req.SetBasicAuth(up[0], up[1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", url, string(body))
+	}
+
+	report := &c.IndexUsageReport{}
+	if err := json.Unmarshal(body, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func printIndexUsage(w io.Writer, report *c.IndexUsageReport) {
+	lastScan := func(u *c.IndexUsage) string {
+		if u.LastScanTime == 0 {
+			return "never"
+		}
+		return time.Unix(0, u.LastScanTime).Format(time.RFC3339)
+	}
+
+	fmt.Fprintln(w, "Unused indexes:")
+	for _, u := range report.Unused {
+		fmt.Fprintf(w, "    %s/%s on %s, last scan:%s, memory:%v, disk:%v\n",
+			u.Bucket, u.Name, u.Node, lastScan(u), u.MemorySize, u.DiskSize)
+	}
+	fmt.Fprintln(w, "Redundant indexes:")
+	for _, r := range report.Redundant {
+		fmt.Fprintf(w, "    %s/%s %v covered by %s/%s %v, memory:%v, disk:%v\n",
+			r.Index.Bucket, r.Index.Name, r.Index.SecExprs,
+			r.CoveredBy.Bucket, r.CoveredBy.Name, r.CoveredBy.SecExprs,
+			r.Index.MemorySize, r.Index.DiskSize)
+	}
+	fmt.Fprintf(w, "Unused memory:%v, disk:%v; redundant memory:%v, disk:%v\n",
+		report.UnusedMemorySize, report.UnusedDiskSize,
+		report.RedundantMemorySize, report.RedundantDiskSize)
+}
+
 // GetIndex for bucket/indexName.
+// getDefnIDs for csv list of bucket:index.
+func getDefnIDs(client *qclient.GsiClient, bindexes []string) ([]uint64, error) {
+	defnIDs := make([]uint64, 0, len(bindexes))
+	for _, bindex := range bindexes {
+		v := strings.Split(bindex, ":")
+		if len(v) < 2 {
+			return nil, fmt.Errorf("invalid index specified : %v", bindex)
+		}
+		bucket, iname := v[0], v[1]
+		index, ok := GetIndex(client, bucket, iname)
+		if !ok {
+			return nil, fmt.Errorf("index %v/%v unknown", bucket, iname)
+		}
+		defnIDs = append(defnIDs, uint64(index.Definition.DefnId))
+	}
+	return defnIDs, nil
+}
+
 func GetIndex(
 	client *qclient.GsiClient,
 	bucket, indexName string) (*mclient.IndexMetadata, bool) {
@@ -563,7 +697,7 @@ func validate(cmd *Command, fset *flag.FlagSet) error {
 		have = []string{"type", "server", "auth", "index", "bucket", "primary"}
 		dont = []string{"h", "indexes", "low", "high", "equal", "incl", "limit", "ckey", "cval"}
 
-	case "build":
+	case "build", "pause", "resume", "cancel":
 		have = []string{"type", "server", "auth", "indexes"}
 		dont = []string{"h", "index", "bucket", "where", "fields", "primary", "with", "low", "high", "equal", "incl", "limit", "ckey", "cval"}
 
@@ -571,6 +705,10 @@ func validate(cmd *Command, fset *flag.FlagSet) error {
 		have = []string{"type", "server", "auth", "index", "bucket"}
 		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit", "ckey", "cval"}
 
+	case "rename":
+		have = []string{"type", "server", "auth", "index", "bucket", "newname"}
+		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit", "ckey", "cval"}
+
 	case "scan":
 		have = []string{"type", "server", "auth", "index", "bucket"}
 		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "ckey", "cval"}
@@ -587,6 +725,10 @@ func validate(cmd *Command, fset *flag.FlagSet) error {
 		have = []string{"type", "server", "auth", "index", "bucket"}
 		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "ckey", "cval"}
 
+	case "usage":
+		have = []string{"type", "server", "auth"}
+		dont = []string{"h", "index", "bucket", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit", "ckey", "cval"}
+
 	case "config":
 		have = []string{"type", "server", "auth"}
 		dont = []string{"h", "index", "bucket", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit"}
@@ -171,11 +171,45 @@ func (b *cbqClient) CreateIndex(
 	return 0, err
 }
 
+// CreateCollectionIndex implement BridgeAccessor{} interface.
+func (b *cbqClient) CreateCollectionIndex(
+	name, bucket, scope, collection, using, exprType, partnExpr,
+	whereExpr string, secExprs []string, isPrimary bool,
+	with []byte) (defnID uint64, err error) {
+
+	if common.Keyspace(bucket, scope, collection) != common.Keyspace(bucket, "", "") {
+		panic("cbqClient does not implement collections")
+	}
+	return b.CreateIndex(
+		name, bucket, using, exprType, partnExpr, whereExpr,
+		secExprs, isPrimary, with)
+}
+
 // BuildIndexes implement BridgeAccessor{} interface.
 func (b *cbqClient) BuildIndexes(defnID []uint64) error {
 	panic("cbqClient does not implement build-indexes")
 }
 
+// PauseIndexBuild implement BridgeAccessor{} interface.
+func (b *cbqClient) PauseIndexBuild(defnID []uint64) error {
+	panic("cbqClient does not implement pause-index-build")
+}
+
+// ResumeIndexBuild implement BridgeAccessor{} interface.
+func (b *cbqClient) ResumeIndexBuild(defnID []uint64) error {
+	panic("cbqClient does not implement resume-index-build")
+}
+
+// CancelIndexBuild implement BridgeAccessor{} interface.
+func (b *cbqClient) CancelIndexBuild(defnID []uint64) error {
+	panic("cbqClient does not implement cancel-index-build")
+}
+
+// RenameIndex implement BridgeAccessor{} interface.
+func (b *cbqClient) RenameIndex(defnID uint64, name string) error {
+	panic("cbqClient does not implement rename-index")
+}
+
 // DropIndex implement BridgeAccessor{} interface.
 func (b *cbqClient) DropIndex(defnID uint64) error {
 	var resp *http.Response
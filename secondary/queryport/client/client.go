@@ -3,12 +3,15 @@ package client
 import "time"
 import "unsafe"
 import "io"
+import "sync"
 import "sync/atomic"
 import "fmt"
+import "math"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/platform"
 import "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/dcp"
 import "github.com/golang/protobuf/proto"
 import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 import mclient "github.com/couchbase/indexing/secondary/manager/client"
@@ -112,10 +115,36 @@ type BridgeAccessor interface {
 		secExprs []string, isPrimary bool,
 		with []byte) (defnID uint64, err error)
 
+	// CreateCollectionIndex is same as CreateIndex, for an index defined
+	// on a collection in bucket.
+	// scope
+	//      scope of the collection, empty for default scope.
+	// collection
+	//      collection name, empty for default collection.
+	CreateCollectionIndex(
+		name, bucket, scope, collection, using, exprType, partnExpr,
+		whereExpr string, secExprs []string, isPrimary bool,
+		with []byte) (defnID uint64, err error)
+
 	// BuildIndexes to build a deferred set of indexes. This call implies
 	// that indexes specified are already created.
 	BuildIndexes(defnIDs []uint64) error
 
+	// PauseIndexBuild to pause the build of a set of indexes. Data
+	// built so far is kept, and ResumeIndexBuild continues from it.
+	PauseIndexBuild(defnIDs []uint64) error
+
+	// ResumeIndexBuild to resume the build of a set of paused indexes.
+	ResumeIndexBuild(defnIDs []uint64) error
+
+	// CancelIndexBuild to cancel the build of a set of indexes. Data
+	// built so far is discarded, and indexes are left deferred.
+	CancelIndexBuild(defnIDs []uint64) error
+
+	// RenameIndex to rename index specified by `defnID`. Index is
+	// not rebuilt.
+	RenameIndex(defnID uint64, name string) error
+
 	// DropIndex to drop index specified by `defnID`.
 	// - if index is in deferred build state, it shall be removed
 	//   from deferred list.
@@ -224,6 +253,11 @@ type GsiClient struct {
 	queryClients unsafe.Pointer // map[string(queryport)]*GsiScanClient
 	bucketHash   unsafe.Pointer // map[string]uint64 // bucket -> crc64
 	metaCh       chan bool      // listen to metadata changes
+	seqnosWindow time.Duration  // coalescing window for kv seqnos
+
+	// cached bucket connections for STATS call
+	kvmu      sync.Mutex
+	kvbuckets map[string]*couchbase.Bucket
 }
 
 // NewGsiClient returns client to access GSI cluster.
@@ -239,6 +273,12 @@ func NewGsiClient(
 		return nil, err
 	}
 	c.maxvb = -1
+	// window is of this client, the process default belongs to the
+	// indexer when the client runs inside it.
+	c.seqnosWindow = -1
+	if cv, ok := config["getseqnosWindow"]; ok {
+		c.seqnosWindow = time.Duration(cv.Int()) * time.Microsecond
+	}
 	c.Refresh()
 	return c, nil
 }
@@ -284,7 +324,8 @@ func (c *GsiClient) Nodes() ([]*IndexerService, error) {
 func (c *GsiClient) BucketSeqnos(
 	bucketn string, hash64 uint64) (*TsConsistency, error) {
 
-	seqnos, err := common.BucketSeqnos(c.cluster, "default" /*pool*/, bucketn)
+	seqnos, err := common.BucketSeqnosWithWindow(
+		c.cluster, "default" /*pool*/, bucketn, c.seqnosWindow)
 	if err != nil {
 		return nil, err
 	}
@@ -300,19 +341,20 @@ func (c *GsiClient) BucketSeqnos(
 // BucketTs will return the current vbucket-timestamp using STATS
 // command.
 func (c *GsiClient) BucketTs(bucketn string) (*TsConsistency, error) {
-	b, err := common.ConnectBucket(c.cluster, "default" /*pooln*/, bucketn)
+	b, err := c.getBucketConn(bucketn)
 	if err != nil {
 		return nil, err
 	}
-	defer b.Close()
 
 	if c.maxvb == -1 {
 		if c.maxvb, err = common.MaxVbuckets(b); err != nil {
+			c.closeBucketConn(bucketn, b)
 			return nil, err
 		}
 	}
 	seqnos, vbuuids, err := common.BucketTs(b, c.maxvb)
 	if err != nil {
+		c.closeBucketConn(bucketn, b)
 		return nil, err
 	}
 	vbnos := make([]uint16, c.maxvb)
@@ -322,12 +364,55 @@ func (c *GsiClient) BucketTs(bucketn string) (*TsConsistency, error) {
 	return NewTsConsistency(vbnos, seqnos, vbuuids), nil
 }
 
+// getBucketConn returns a connection to bucket shared across calls,
+// connecting to it if not connected already.
+func (c *GsiClient) getBucketConn(bucketn string) (*couchbase.Bucket, error) {
+	c.kvmu.Lock()
+	defer c.kvmu.Unlock()
+
+	if b, ok := c.kvbuckets[bucketn]; ok {
+		return b, nil
+	}
+	b, err := common.ConnectBucket(c.cluster, "default" /*pooln*/, bucketn)
+	if err != nil {
+		return nil, err
+	}
+	if c.kvbuckets == nil {
+		c.kvbuckets = make(map[string]*couchbase.Bucket)
+	}
+	c.kvbuckets[bucketn] = b
+	return b, nil
+}
+
+// closeBucketConn closes a failed bucket connection, so that it is
+// re-established by next call.
+func (c *GsiClient) closeBucketConn(bucketn string, b *couchbase.Bucket) {
+	c.kvmu.Lock()
+	defer c.kvmu.Unlock()
+
+	if c.kvbuckets[bucketn] == b {
+		delete(c.kvbuckets, bucketn)
+		b.Close()
+	}
+}
+
 // CreateIndex implements BridgeAccessor{} interface.
 func (c *GsiClient) CreateIndex(
 	name, bucket, using, exprType, partnExpr, whereExpr string,
 	secExprs []string, isPrimary bool,
 	with []byte) (defnID uint64, err error) {
 
+	return c.CreateCollectionIndex(
+		name, bucket, "", "", using, exprType, partnExpr, whereExpr,
+		secExprs, isPrimary, with)
+}
+
+// CreateCollectionIndex implements BridgeAccessor{} interface.
+func (c *GsiClient) CreateCollectionIndex(
+	name, bucket, scope, collection, using, exprType, partnExpr,
+	whereExpr string, secExprs []string, isPrimary bool,
+	with []byte) (defnID uint64, err error) {
+
 	err = common.IsValidIndexName(name)
 	if err != nil {
 		return 0, err
@@ -337,14 +422,15 @@ func (c *GsiClient) CreateIndex(
 		return defnID, ErrorClientUninitialized
 	}
 	begin := time.Now()
-	defnID, err = c.bridge.CreateIndex(
-		name, bucket, using, exprType, partnExpr, whereExpr,
-		secExprs, isPrimary, with)
+	defnID, err = c.bridge.CreateCollectionIndex(
+		name, bucket, scope, collection, using, exprType, partnExpr,
+		whereExpr, secExprs, isPrimary, with)
 	fmsg := "CreateIndex %v %v/%v using:%v exprType:%v partnExpr:%v " +
 		"whereExpr:%v secExprs:%v isPrimary:%v with:%v - " +
 		"elapsed(%v) err(%v)"
+	keyspace := common.Keyspace(bucket, scope, collection)
 	logging.Infof(
-		fmsg, defnID, bucket, name, using, exprType, partnExpr, whereExpr,
+		fmsg, defnID, keyspace, name, using, exprType, partnExpr, whereExpr,
 		secExprs, isPrimary, string(with), time.Since(begin), err)
 	return defnID, err
 }
@@ -361,6 +447,54 @@ func (c *GsiClient) BuildIndexes(defnIDs []uint64) error {
 	return err
 }
 
+// PauseIndexBuild implements BridgeAccessor{} interface.
+func (c *GsiClient) PauseIndexBuild(defnIDs []uint64) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.PauseIndexBuild(defnIDs)
+	fmsg := "PauseIndexBuild %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnIDs, time.Since(begin), err)
+	return err
+}
+
+// ResumeIndexBuild implements BridgeAccessor{} interface.
+func (c *GsiClient) ResumeIndexBuild(defnIDs []uint64) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.ResumeIndexBuild(defnIDs)
+	fmsg := "ResumeIndexBuild %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnIDs, time.Since(begin), err)
+	return err
+}
+
+// CancelIndexBuild implements BridgeAccessor{} interface.
+func (c *GsiClient) CancelIndexBuild(defnIDs []uint64) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.CancelIndexBuild(defnIDs)
+	fmsg := "CancelIndexBuild %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnIDs, time.Since(begin), err)
+	return err
+}
+
+// RenameIndex implements BridgeAccessor{} interface.
+func (c *GsiClient) RenameIndex(defnID uint64, name string) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.RenameIndex(defnID, name)
+	fmsg := "RenameIndex %v to %q - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnID, name, time.Since(begin), err)
+	return err
+}
+
 // DropIndex implements BridgeAccessor{} interface.
 func (c *GsiClient) DropIndex(defnID uint64) error {
 	if c.bridge == nil {
@@ -503,6 +637,30 @@ func (c *GsiClient) Range(
 	return
 }
 
+// AdaptiveRange scans an adaptive index for documents having a field
+// `path`, in dotted notation, with value between low and high. A nil low
+// or high leaves the range open on that side.
+func (c *GsiClient) AdaptiveRange(
+	defnID uint64, requestId string, path string, low, high interface{},
+	inclusion Inclusion, distinct bool, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	if index := c.bridge.GetIndexDefn(defnID); index == nil {
+		return ErrorIndexNotFound
+	} else if !index.IsAdaptive {
+		return ErrorNotAdaptiveIndex
+	}
+
+	lowKey, highKey := adaptiveRangeKeys(path, low, high)
+	return c.Range(
+		defnID, requestId, lowKey, highKey, inclusion, distinct, limit,
+		cons, vector, callb)
+}
+
 // ScanAll for full table scan.
 func (c *GsiClient) ScanAll(
 	defnID uint64, requestId string, limit int64,
@@ -720,6 +878,13 @@ func (c *GsiClient) Close() {
 	for _, qc := range qcs {
 		qc.Close()
 	}
+
+	c.kvmu.Lock()
+	defer c.kvmu.Unlock()
+	for bucketn, b := range c.kvbuckets {
+		b.Close()
+		delete(c.kvbuckets, bucketn)
+	}
 }
 
 func (c *GsiClient) updateScanClients() {
@@ -883,6 +1048,11 @@ func (c *GsiClient) getConsistency(
 		} else {
 			vector = nil
 		}
+	} else if cons == common.BoundedStalenessConsistency {
+		if vector == nil || vector.Staleness <= 0 {
+			return nil, ErrorExpectedStaleness
+		}
+		vector = NewTsStaleness(vector.Staleness)
 	} else if cons == common.AnyConsistency {
 		vector = nil
 	} else {
@@ -970,12 +1140,14 @@ func (c *GsiClient) listenMetaChange() {
 //
 // Timestamp-vector will be ignored for AnyConsistency, computed
 // locally by scan-coordinator or accepted as scan-arguments for
-// SessionConsistency.
+// SessionConsistency. For BoundedStalenessConsistency only the
+// Staleness bound is considered.
 type TsConsistency struct {
-	Vbnos   []uint16
-	Seqnos  []uint64
-	Vbuuids []uint64
-	Crc64   uint64
+	Vbnos     []uint16
+	Seqnos    []uint64
+	Vbuuids   []uint64
+	Crc64     uint64
+	Staleness time.Duration
 }
 
 // NewTsConsistency returns a new consistency vector object.
@@ -985,6 +1157,30 @@ func NewTsConsistency(
 	return &TsConsistency{Vbnos: vbnos, Seqnos: seqnos, Vbuuids: vbuuids}
 }
 
+// NewTsStaleness returns a consistency vector object for
+// BoundedStalenessConsistency, scans will be served from an index
+// snapshot that is no older than staleness.
+func NewTsStaleness(staleness time.Duration) *TsConsistency {
+	return &TsConsistency{Staleness: staleness}
+}
+
+func (ts *TsConsistency) toProtobuf() *protobuf.TsConsistency {
+	vector := protobuf.NewTsConsistency(ts.Vbnos, ts.Seqnos, ts.Vbuuids, ts.Crc64)
+	if ts.Staleness > 0 {
+		vector.Staleness = proto.Uint32(stalenessMillis(ts.Staleness))
+	}
+	return vector
+}
+
+// stalenessMillis rounds staleness up to milliseconds.
+func stalenessMillis(staleness time.Duration) uint32 {
+	ms := (staleness + time.Millisecond - 1) / time.Millisecond
+	if ms > math.MaxUint32 {
+		ms = math.MaxUint32
+	}
+	return uint32(ms)
+}
+
 // Override vbucket's {seqno, vbuuid} in the timestamp-vector,
 // if vbucket is not present in the vector, append them to vector.
 func (ts *TsConsistency) Override(
@@ -1018,3 +1214,22 @@ func curePrimaryKey(key interface{}) ([]byte, string) {
 	}
 	return nil, "before"
 }
+
+// adaptiveRangeKeys returns the range of adaptive index entries, which are
+// [[path, value]], for values of path between low and high. Open low is
+// [[path]], which sorts before any value of path, and open high is
+// [[path+"\x01"]], which sorts after any value of path and before the
+// next path.
+func adaptiveRangeKeys(
+	path string, low, high interface{}) (common.SecondaryKey, common.SecondaryKey) {
+
+	lowKey := common.SecondaryKey{[]interface{}{path}}
+	if low != nil {
+		lowKey = common.SecondaryKey{[]interface{}{path, low}}
+	}
+	highKey := common.SecondaryKey{[]interface{}{path + "\x01"}}
+	if high != nil {
+		highKey = common.SecondaryKey{[]interface{}{path, high}}
+	}
+	return lowKey, highKey
+}
@@ -27,6 +27,12 @@ var ErrorInvalidConsistency = errors.New("queryport.invalidConsistency")
 // ErrorExpectedTimestamp
 var ErrorExpectedTimestamp = errors.New("queryport.expectedTimestamp")
 
+// ErrorExpectedStaleness
+var ErrorExpectedStaleness = errors.New("queryport.expectedStaleness")
+
+// ErrorNotAdaptiveIndex
+var ErrorNotAdaptiveIndex = errors.New("queryport.notAdaptiveIndex")
+
 // These error strings need to be in sync with common.ErrIndexNotFound
 // and common.ErrIndexNotReady.
 var ErrIndexNotFound = fmt.Errorf("Index not found")
@@ -41,6 +47,8 @@ var errorDescriptions = map[string]string{
 	ErrorNotImplemented.Error():      "client API not implemented",
 	ErrorInvalidConsistency.Error():  "supplied consistency is invalid",
 	ErrorExpectedTimestamp.Error():   "consistency timestamp is expected",
+	ErrorExpectedStaleness.Error():   "staleness bound is expected",
+	ErrorNotAdaptiveIndex.Error():    "index is not an adaptive index",
 	ErrIndexNotFound.Error():         "index is deleted or node hosting index is down",
 	ErrIndexNotReady.Error():         ErrIndexNotReady.Error(),
 }
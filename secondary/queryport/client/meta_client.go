@@ -140,6 +140,17 @@ func (b *metadataClient) CreateIndex(
 	secExprs []string, isPrimary bool,
 	planJSON []byte) (uint64, error) {
 
+	return b.CreateCollectionIndex(
+		indexName, bucket, "", "", using, exprType, partnExpr, whereExpr,
+		secExprs, isPrimary, planJSON)
+}
+
+// CreateCollectionIndex implements BridgeAccessor{} interface.
+func (b *metadataClient) CreateCollectionIndex(
+	indexName, bucket, scope, collection, using, exprType, partnExpr,
+	whereExpr string, secExprs []string, isPrimary bool,
+	planJSON []byte) (uint64, error) {
+
 	plan := make(map[string]interface{})
 	if planJSON != nil && len(planJSON) > 0 {
 		err := json.Unmarshal(planJSON, &plan)
@@ -151,8 +162,8 @@ func (b *metadataClient) CreateIndex(
 	refreshCnt := 0
 RETRY:
 	defnID, err, needRefresh := b.mdClient.CreateIndexWithPlan(
-		indexName, bucket, using, exprType, partnExpr, whereExpr,
-		secExprs, isPrimary, plan)
+		indexName, bucket, scope, collection, using, exprType, partnExpr,
+		whereExpr, secExprs, isPrimary, plan)
 
 	if needRefresh && refreshCnt == 0 {
 		fmsg := "GsiClient: Indexer Node List is out-of-date.  Require refresh."
@@ -180,6 +191,44 @@ func (b *metadataClient) BuildIndexes(defnIDs []uint64) error {
 	return b.mdClient.BuildIndexes(ids)
 }
 
+// PauseIndexBuild implements BridgeAccessor{} interface.
+func (b *metadataClient) PauseIndexBuild(defnIDs []uint64) error {
+	ids, err := b.indexDefnIds(defnIDs)
+	if err != nil {
+		return err
+	}
+	return b.mdClient.PauseIndexBuild(ids)
+}
+
+// ResumeIndexBuild implements BridgeAccessor{} interface.
+func (b *metadataClient) ResumeIndexBuild(defnIDs []uint64) error {
+	ids, err := b.indexDefnIds(defnIDs)
+	if err != nil {
+		return err
+	}
+	return b.mdClient.ResumeIndexBuild(ids)
+}
+
+// CancelIndexBuild implements BridgeAccessor{} interface.
+func (b *metadataClient) CancelIndexBuild(defnIDs []uint64) error {
+	ids, err := b.indexDefnIds(defnIDs)
+	if err != nil {
+		return err
+	}
+	return b.mdClient.CancelIndexBuild(ids)
+}
+
+func (b *metadataClient) indexDefnIds(defnIDs []uint64) ([]common.IndexDefnId, error) {
+	if _, ok := b.getNodes(defnIDs); !ok {
+		return nil, ErrorIndexNotFound
+	}
+	ids := make([]common.IndexDefnId, len(defnIDs))
+	for i, id := range defnIDs {
+		ids[i] = common.IndexDefnId(id)
+	}
+	return ids, nil
+}
+
 // DropIndex implements BridgeAccessor{} interface.
 func (b *metadataClient) DropIndex(defnID uint64) error {
 	err := b.mdClient.DropIndex(common.IndexDefnId(defnID))
@@ -190,6 +239,16 @@ func (b *metadataClient) DropIndex(defnID uint64) error {
 	return err
 }
 
+// RenameIndex implements BridgeAccessor{} interface.
+func (b *metadataClient) RenameIndex(defnID uint64, name string) error {
+	err := b.mdClient.RenameIndex(common.IndexDefnId(defnID), name)
+	if err == nil { // refresh index local cache with the new name.
+		currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+		b.safeupdate(currmeta.adminports, true /*force*/)
+	}
+	return err
+}
+
 // GetScanports implements BridgeAccessor{} interface.
 func (b *metadataClient) GetScanports() (queryports []string) {
 	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
@@ -210,6 +269,9 @@ func (b *metadataClient) GetScanports() (queryports []string) {
 func (b *metadataClient) GetScanport(
 	defnID uint64, retry int, excludes map[uint64]bool) (qp string, targetDefnID uint64, ok bool) {
 
+	// an altered index is scanned by the id it had before it is altered
+	defnID = uint64(b.mdClient.ResolveIndexDefnId(common.IndexDefnId(defnID)))
+
 	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
 	if rand.Float64() < b.randomWeight {
 		var replicas [128]uint64
@@ -270,7 +332,7 @@ func (b *metadataClient) IsPrimary(defnID uint64) bool {
 // IndexState implement BridgeAccessor{} interface.
 func (b *metadataClient) IndexState(defnID uint64) (common.IndexState, error) {
 	b.Refresh()
-	return b.indexState(defnID)
+	return b.indexState(uint64(b.mdClient.ResolveIndexDefnId(common.IndexDefnId(defnID))))
 }
 
 // close this bridge, to be called when a new indexer is added or
@@ -441,6 +503,11 @@ loop:
 				s = append(s, fmt.Sprintf(`"%v": %v`, id, load.avgLoad))
 			}
 			logging.Infof("client load stats {%v}", strings.Join(s, ","))
+
+			for bucket, st := range common.AllBucketSeqsStats() {
+				fmsg := "bucket %v getseqnos requests %v kv-rounds %v saved %v ratio %.2f\n"
+				logging.Infof(fmsg, bucket, st.Requests, st.Rounds, st.Saved(), st.CoalescingRatio())
+			}
 		}()
 		select {
 		case _, ok := <-b.finch:
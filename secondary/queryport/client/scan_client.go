@@ -191,8 +191,7 @@ func (c *GsiScanClient) Lookup(
 		Cons:      proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 
 	// ---> protobuf.ScanRequest
@@ -255,8 +254,7 @@ func (c *GsiScanClient) Range(
 		Cons:     proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 	// ---> protobuf.ScanRequest
 	if err := c.sendRequest(conn, pkt, req); err != nil {
@@ -309,8 +307,7 @@ func (c *GsiScanClient) RangePrimary(
 		Cons:     proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 	// ---> protobuf.ScanRequest
 	if err := c.sendRequest(conn, pkt, req); err != nil {
@@ -356,8 +353,7 @@ func (c *GsiScanClient) ScanAll(
 		Cons:      proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 	if err := c.sendRequest(conn, pkt, req); err != nil {
 		fmsg := "%v ScanAll(%v) request transport failed `%v`\n"
@@ -468,8 +464,7 @@ func (c *GsiScanClient) MultiScan(
 		Offset:          proto.Int64(offset),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 	// ---> protobuf.ScanRequest
 	if err := c.sendRequest(conn, pkt, req); err != nil {
@@ -515,8 +510,7 @@ func (c *GsiScanClient) CountLookup(
 		Cons:      proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 	resp, err := c.doRequestResponse(req, requestId)
 	if err != nil {
@@ -542,8 +536,7 @@ func (c *GsiScanClient) CountLookupPrimary(
 		Cons:      proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 	resp, err := c.doRequestResponse(req, requestId)
 	if err != nil {
@@ -583,8 +576,7 @@ func (c *GsiScanClient) CountRange(
 		Cons: proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 
 	resp, err := c.doRequestResponse(req, requestId)
@@ -615,8 +607,7 @@ func (c *GsiScanClient) CountRangePrimary(
 		Cons: proto.Uint32(uint32(cons)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = vector.toProtobuf()
 	}
 
 	resp, err := c.doRequestResponse(req, requestId)
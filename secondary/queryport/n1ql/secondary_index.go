@@ -368,6 +368,26 @@ func (gsi *gsiKeyspace) BuildIndexes(requestId string, names ...string) errors.E
 	return nil
 }
 
+// RenameIndex renames an index on this keyspace, without rebuilding
+// it. Not part of datastore.Indexer{} interface.
+func (gsi *gsiKeyspace) RenameIndex(
+	requestId, name, newName string) (datastore.Index, errors.Error) {
+
+	index, err := gsi.IndexByName(name)
+	if err != nil {
+		return nil, errors.NewError(err, "RenameIndex")
+	}
+	defnID := string2defnID(index.Id())
+	if err := gsi.gsiClient.RenameIndex(defnID, newName); err != nil {
+		return nil, errors.NewError(err, "GSI RenameIndex()")
+	}
+	// refresh to get back the index under its new name.
+	if err := gsi.Refresh(); err != nil {
+		return nil, err
+	}
+	return gsi.IndexById(defnID2String(defnID))
+}
+
 // Refresh list of indexes and scanner clients.
 func (gsi *gsiKeyspace) Refresh() errors.Error {
 	l.Tracef("%v gsiKeyspace.Refresh()", gsi.logPrefix)
@@ -611,11 +631,12 @@ func (si *secondaryIndex) Count(span *datastore.Span,
 		return 0, ErrorIndexEmpty
 	}
 	client := si.gsi.gsiClient
+	gcons, gvector := si.gsiConsistency(cons, vector)
 
 	if span.Seek != nil {
 		seek := values2SKey(span.Seek)
 		count, e := client.CountLookup(si.defnID, "", []c.SecondaryKey{seek},
-			n1ql2GsiConsistency[cons], vector2ts(vector))
+			gcons, gvector)
 		if e != nil {
 			return 0, n1qlError(client, e)
 		}
@@ -625,7 +646,7 @@ func (si *secondaryIndex) Count(span *datastore.Span,
 	low, high := values2SKey(span.Range.Low), values2SKey(span.Range.High)
 	incl := n1ql2GsiInclusion[span.Range.Inclusion]
 	count, e := client.CountRange(si.defnID, "", low, high, incl,
-		n1ql2GsiConsistency[cons], vector2ts(vector))
+		gcons, gvector)
 	if e != nil {
 		return 0, n1qlError(client, e)
 	}
@@ -678,11 +699,12 @@ func (si *secondaryIndex) Scan(
 	starttm := time.Now()
 
 	client, cnf := si.gsi.gsiClient, si.gsi.config
+	gcons, gvector := si.gsiConsistency(cons, vector)
 	if span.Seek != nil {
 		seek := values2SKey(span.Seek)
 		client.Lookup(
 			si.defnID, requestId, []c.SecondaryKey{seek}, distinct, limit,
-			n1ql2GsiConsistency[cons], vector2ts(vector),
+			gcons, gvector,
 			makeResponsehandler(
 				requestId,
 				si, client, conn, &tmpfile, &backfillSync, syncCh, cnf))
@@ -692,7 +714,7 @@ func (si *secondaryIndex) Scan(
 		incl := n1ql2GsiInclusion[span.Range.Inclusion]
 		client.Range(
 			si.defnID, requestId, low, high, incl, distinct, limit,
-			n1ql2GsiConsistency[cons], vector2ts(vector),
+			gcons, gvector,
 			makeResponsehandler(
 				requestId,
 				si, client, conn, &tmpfile, &backfillSync, syncCh, cnf))
@@ -736,13 +758,14 @@ func (si *secondaryIndex) Scan2(
 	starttm := time.Now()
 
 	client, cnf := si.gsi.gsiClient, si.gsi.config
+	gcons, gvector := si.gsiConsistency(cons, vector)
 
 	gsiscans := n1qlspanstogsi(spans)
 	gsiprojection := n1qlprojectiontogsi(projection)
 	client.MultiScan(
 		si.defnID, requestId, gsiscans, reverse, distinct,
 		gsiprojection, offset, limit,
-		n1ql2GsiConsistency[cons], vector2ts(vector),
+		gcons, gvector,
 		makeResponsehandler(
 			requestId,
 			si, client, conn, &tmpfile, &backfillSync, syncCh, cnf))
@@ -784,9 +807,10 @@ func (si *secondaryIndex) ScanEntries(
 	starttm := time.Now()
 
 	client, cnf := si.gsi.gsiClient, si.gsi.config
+	gcons, gvector := si.gsiConsistency(cons, vector)
 	client.ScanAll(
 		si.defnID, requestId, limit,
-		n1ql2GsiConsistency[cons], vector2ts(vector),
+		gcons, gvector,
 		makeResponsehandler(
 			requestId,
 			si, client, conn, &tmpfile, &backfillSync, syncCh, cnf))
@@ -799,6 +823,22 @@ func (si *secondaryIndex) ScanEntries(
 // private functions for secondaryIndex
 //-------------------------------------
 
+// gsiConsistency maps n1ql scan consistency to gsi consistency. If
+// scanStaleness is configured, unbounded scans are served from an index
+// snapshot that is no older than scanStaleness milliseconds.
+func (si *secondaryIndex) gsiConsistency(
+	cons datastore.ScanConsistency,
+	vector timestamp.Vector) (c.Consistency, *qclient.TsConsistency) {
+
+	if cons == datastore.UNBOUNDED {
+		if cv, ok := si.gsi.config["scanStaleness"]; ok && cv.Int() > 0 {
+			staleness := time.Duration(cv.Int()) * time.Millisecond
+			return c.BoundedStalenessConsistency, qclient.NewTsStaleness(staleness)
+		}
+	}
+	return n1ql2GsiConsistency[cons], vector2ts(vector)
+}
+
 func makeResponsehandler(
 	requestId string,
 	si *secondaryIndex,
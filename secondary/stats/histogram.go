@@ -7,6 +7,7 @@ import "fmt"
 type Histogram struct {
 	buckets    []int64
 	vals       []platform.AlignedInt64
+	sum        platform.AlignedInt64
 	humanizeFn func(int64) string
 }
 
@@ -21,6 +22,7 @@ func (h *Histogram) Init(buckets []int64, humanizeFn func(int64) string) {
 	for i, _ := range h.vals {
 		h.vals[i] = platform.NewAlignedInt64(0)
 	}
+	h.sum = platform.NewAlignedInt64(0)
 
 	if humanizeFn == nil {
 		humanizeFn = func(v int64) string { return fmt.Sprint(v) }
@@ -32,6 +34,7 @@ func (h *Histogram) Init(buckets []int64, humanizeFn func(int64) string) {
 func (h *Histogram) Add(val int64) {
 	i := h.findBucket(val)
 	platform.AddInt64(&h.vals[i], 1)
+	platform.AddInt64(&h.sum, val)
 }
 
 func (h *Histogram) findBucket(val int64) int {
@@ -68,3 +71,50 @@ func (h Histogram) String() string {
 func (h Histogram) MarshalJSON() ([]byte, error) {
 	return []byte(h.String()), nil
 }
+
+// Count returns the total number of values added to the histogram.
+func (h *Histogram) Count() int64 {
+	var count int64
+	for i := range h.vals {
+		count += platform.LoadInt64(&h.vals[i])
+	}
+	return count
+}
+
+// Percentile returns the upper bound of the bucket holding the p-th
+// percentile (0 < p <= 100) of values added to the histogram. Returns 0
+// if the histogram is empty.
+func (h *Histogram) Percentile(p float64) int64 {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(float64(count) * p / 100))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var cum int64
+	for i := range h.vals {
+		cum += platform.LoadInt64(&h.vals[i])
+		if cum >= rank {
+			return h.buckets[i+1]
+		}
+	}
+	return h.buckets[len(h.vals)]
+}
+
+// Sum returns the sum of values added to the histogram.
+func (h *Histogram) Sum() int64 {
+	return platform.LoadInt64(&h.sum)
+}
+
+// Buckets calls fn with upper bound and count of every bucket, in
+// increasing order of upper bound. Upper bound of the last bucket is
+// math.MaxInt64.
+func (h *Histogram) Buckets(fn func(upper, count int64)) {
+	for i := range h.vals {
+		fn(h.buckets[i+1], platform.LoadInt64(&h.vals[i]))
+	}
+}
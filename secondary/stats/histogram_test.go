@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	var h Histogram
+	// buckets are (-inf, 10], (10, 20], (20, 50], (50, +inf)
+	h.Init([]int64{10, 20, 50, 100}, nil)
+
+	if p := h.Percentile(50); p != 0 {
+		t.Errorf("expected 0 for empty histogram, got %v", p)
+	}
+
+	for _, v := range []int64{1, 2, 3, 4, 5, 15, 15, 20, 40, 200} {
+		h.Add(v)
+	}
+	if h.Count() != 10 || h.Sum() != 305 {
+		t.Fatalf("unexpected count %v, sum %v", h.Count(), h.Sum())
+	}
+
+	tests := []struct {
+		p        float64
+		expected int64
+	}{
+		{0, 10},
+		{10, 10},
+		{50, 10},
+		{50.1, 20},
+		{80, 20},
+		{90, 50},
+		{99, math.MaxInt64},
+		{100, math.MaxInt64},
+	}
+	for _, test := range tests {
+		if p := h.Percentile(test.p); p != test.expected {
+			t.Errorf("expected p%v to be %v, got %v", test.p, test.expected, p)
+		}
+	}
+
+	var uppers, counts []int64
+	h.Buckets(func(upper, count int64) {
+		uppers = append(uppers, upper)
+		counts = append(counts, count)
+	})
+	expectedUppers := []int64{10, 20, 50, math.MaxInt64}
+	expectedCounts := []int64{5, 3, 1, 1}
+	for i := range expectedUppers {
+		if uppers[i] != expectedUppers[i] || counts[i] != expectedCounts[i] {
+			t.Errorf("expected bucket %v to be %v:%v, got %v:%v", i,
+				expectedUppers[i], expectedCounts[i], uppers[i], counts[i])
+		}
+	}
+}
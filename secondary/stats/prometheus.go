@@ -0,0 +1,168 @@
+package stats
+
+import "bufio"
+import "fmt"
+import "io"
+import "math"
+import "sort"
+import "strings"
+
+// Labels of a Prometheus metric sample.
+type Labels map[string]string
+
+const (
+	PromCounter   = "counter"
+	PromGauge     = "gauge"
+	PromHistogram = "histogram"
+)
+
+type promFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []string
+}
+
+// PromWriter gathers metrics and writes them in Prometheus text
+// exposition format. Samples of a metric family are written together,
+// in the order they were added, when Flush is called.
+type PromWriter struct {
+	namespace string
+	families  map[string]*promFamily
+	order     []string
+}
+
+func NewPromWriter(namespace string) *PromWriter {
+	return &PromWriter{
+		namespace: namespace,
+		families:  make(map[string]*promFamily),
+	}
+}
+
+// Counter adds a sample of monotonically increasing value.
+func (p *PromWriter) Counter(name, help string, labels Labels, v int64) {
+	p.sample(name, help, PromCounter, "", labels, float64(v))
+}
+
+// Gauge adds a sample of a value that can go up and down.
+func (p *PromWriter) Gauge(name, help string, labels Labels, v float64) {
+	p.sample(name, help, PromGauge, "", labels, v)
+}
+
+// Histogram adds a histogram sample, bucket bounds and sum are divided by
+// scale, for eg. 1e9 to report nanoseconds as seconds.
+func (p *PromWriter) Histogram(name, help string, labels Labels, h *Histogram, scale float64) {
+	if len(h.vals) == 0 {
+		return
+	}
+
+	var cum int64
+	h.Buckets(func(upper, count int64) {
+		cum += count
+		le := "+Inf"
+		if upper != math.MaxInt64 {
+			le = formatFloat(float64(upper) / scale)
+		}
+		p.sample(name, help, PromHistogram, "_bucket", labels.with("le", le), float64(cum))
+	})
+	p.sample(name, help, PromHistogram, "_sum", labels, float64(h.Sum())/scale)
+	p.sample(name, help, PromHistogram, "_count", labels, float64(cum))
+}
+
+// Timing adds a timing stat as a histogram in seconds.
+func (p *PromWriter) Timing(name, help string, labels Labels, t *TimingStat) {
+	p.Histogram(name, help, labels, &t.Histo, 1e9)
+}
+
+func (p *PromWriter) sample(name, help, typ, suffix string, labels Labels, v float64) {
+	if p.namespace != "" {
+		name = p.namespace + "_" + name
+	}
+	name = promName(name)
+
+	f, ok := p.families[name]
+	if !ok {
+		f = &promFamily{name: name, help: help, typ: typ}
+		p.families[name] = f
+		p.order = append(p.order, name)
+	}
+	s := name + suffix + labels.String() + " " + formatFloat(v)
+	f.samples = append(f.samples, s)
+}
+
+// Flush writes gathered metrics to w.
+func (p *PromWriter) Flush(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, name := range p.order {
+		f := p.families[name]
+		if f.help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.samples {
+			bw.WriteString(s)
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+func (l Labels) with(k, v string) Labels {
+	nl := make(Labels, len(l)+1)
+	for lk, lv := range l {
+		nl[lk] = lv
+	}
+	nl[k] = v
+	return nl
+}
+
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", promName(k), escapeLabel(l[k])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// promName replaces characters not allowed in metric and label names.
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,55 @@
+package stats
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestPromWriter(t *testing.T) {
+	pw := NewPromWriter("index")
+
+	pw.Gauge("up time", "Indexer uptime\nin seconds, C:\\", nil, 12.5)
+	pw.Counter("requests_total", "Scan requests", Labels{"bucket": "default", "index": "idx-1"}, 7)
+	pw.Counter("requests_total", "Scan requests", Labels{"bucket": "a\"b\\c\n", "in-dex": "idx"}, 3)
+	pw.Gauge("ratio", "", nil, math.Inf(1))
+
+	var h Histogram
+	h.Init([]int64{1000000, 10000000, 100000000, math.MaxInt64}, nil)
+	for _, v := range []int64{500000, 2000000, 2000000, 50000000, 2000000000} {
+		h.Add(v)
+	}
+	pw.Histogram("scan_latency_seconds", "Scan latency", Labels{"index": "idx-1"}, &h, 1e9)
+
+	var rows Histogram
+	rows.Init([]int64{10, 100, 1000}, nil)
+	pw.Histogram("scan_rows", "Rows per scan", nil, &rows, 1)
+
+	var timing TimingStat
+	timing.Init()
+	pw.Timing("stats_response_seconds", "Stats response time", nil, &timing)
+
+	var out bytes.Buffer
+	if err := pw.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "prometheus.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("output differs from %v, got:\n%s", golden, out.Bytes())
+	}
+}
@@ -0,0 +1,87 @@
+package stats
+
+import "github.com/couchbase/indexing/secondary/platform"
+import "sync"
+import "time"
+
+// RollingHistogram tracks a histogram of all values added, along with
+// histograms of values added in each of the last `nslots` intervals, so
+// that histograms over rolling time windows of upto nslots*interval can
+// be computed.
+type RollingHistogram struct {
+	mu         sync.Mutex
+	total      Histogram
+	buckets    []int64
+	humanizeFn func(int64) string
+	interval   time.Duration
+	slots      []rollingSlot
+	now        func() time.Time // clock of the slots, time.Now
+}
+
+type rollingSlot struct {
+	epoch int64
+	histo Histogram
+}
+
+func (r *RollingHistogram) Init(buckets []int64, humanizeFn func(int64) string,
+	interval time.Duration, nslots int) {
+
+	r.buckets, r.humanizeFn = buckets, humanizeFn
+	r.interval = interval
+	r.now = time.Now
+	r.total.Init(buckets, humanizeFn)
+	r.slots = make([]rollingSlot, nslots)
+	for i := range r.slots {
+		r.slots[i].epoch = -1
+		r.slots[i].histo.Init(buckets, humanizeFn)
+	}
+}
+
+func (r *RollingHistogram) Add(val int64) {
+	r.total.Add(val)
+	if len(r.slots) == 0 {
+		return
+	}
+
+	epoch := r.now().UnixNano() / int64(r.interval)
+	r.mu.Lock()
+	slot := &r.slots[epoch%int64(len(r.slots))]
+	if slot.epoch != epoch {
+		slot.epoch = epoch
+		slot.histo.Init(r.buckets, r.humanizeFn)
+	}
+	slot.histo.Add(val)
+	r.mu.Unlock()
+}
+
+// Total returns the histogram of all values added.
+func (r *RollingHistogram) Total() *Histogram {
+	return &r.total
+}
+
+// Window returns the histogram of values added in the last window
+// duration, rounded up to the slot interval.
+func (r *RollingHistogram) Window(window time.Duration) *Histogram {
+	h := new(Histogram)
+	h.Init(r.buckets, r.humanizeFn)
+	if len(r.slots) == 0 {
+		return h
+	}
+
+	now := r.now().UnixNano() / int64(r.interval)
+	oldest := now - int64((window+r.interval-1)/r.interval) + 1
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.slots {
+		slot := &r.slots[i]
+		if slot.epoch < oldest || slot.epoch > now {
+			continue
+		}
+		for j := range slot.histo.vals {
+			platform.AddInt64(&h.vals[j], platform.LoadInt64(&slot.histo.vals[j]))
+		}
+		platform.AddInt64(&h.sum, platform.LoadInt64(&slot.histo.sum))
+	}
+	return h
+}
@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollingHistogramWindow(t *testing.T) {
+	var r RollingHistogram
+	r.Init([]int64{10, 100, 1000, 10000}, nil, time.Minute, 3)
+	clock := time.Unix(600, 0)
+	r.now = func() time.Time { return clock }
+
+	check := func(name string, h *Histogram, count, sum int64) {
+		if h.Count() != count || h.Sum() != sum {
+			t.Errorf("%v: expected count %v sum %v, got %v %v",
+				name, count, sum, h.Count(), h.Sum())
+		}
+	}
+
+	r.Add(5)
+	r.Add(5)
+	clock = clock.Add(time.Minute)
+	r.Add(50)
+	clock = clock.Add(time.Minute + 30*time.Second)
+	r.Add(500)
+
+	check("1m", r.Window(time.Minute), 1, 500)
+	check("90s", r.Window(90*time.Second), 2, 550)
+	check("2m", r.Window(2*time.Minute), 2, 550)
+	check("3m", r.Window(3*time.Minute), 4, 560)
+	check("10m", r.Window(10*time.Minute), 4, 560)
+	if p := r.Window(3 * time.Minute).Percentile(50); p != 10 {
+		t.Errorf("expected p50 of 3m window to be 10, got %v", p)
+	}
+
+	// slot of the first minute is reused, dropping its values.
+	clock = clock.Add(time.Minute)
+	r.Add(7)
+	check("3m after expiry", r.Window(3*time.Minute), 3, 557)
+	check("1m after expiry", r.Window(time.Minute), 1, 7)
+	check("total", r.Total(), 5, 567)
+
+	// all slots are stale without new values.
+	clock = clock.Add(5 * time.Minute)
+	check("3m when idle", r.Window(3*time.Minute), 0, 0)
+	check("total when idle", r.Total(), 5, 567)
+}
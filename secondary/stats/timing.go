@@ -3,22 +3,41 @@ package stats
 import "time"
 import "fmt"
 
+// Upper bounds of TimingStat histogram buckets, in nanoseconds.
+var TimingBuckets = []int64{
+	int64(10 * time.Microsecond),
+	int64(100 * time.Microsecond),
+	int64(500 * time.Microsecond),
+	int64(time.Millisecond),
+	int64(5 * time.Millisecond),
+	int64(10 * time.Millisecond),
+	int64(50 * time.Millisecond),
+	int64(100 * time.Millisecond),
+	int64(500 * time.Millisecond),
+	int64(time.Second),
+	int64(5 * time.Second),
+	int64(10 * time.Second),
+}
+
 type TimingStat struct {
 	Count   Int64Val
 	Sum     Int64Val
 	SumOfSq Int64Val
+	Histo   Histogram
 }
 
 func (t *TimingStat) Init() {
 	t.Count.Init()
 	t.Sum.Init()
 	t.SumOfSq.Init()
+	t.Histo.Init(TimingBuckets, nil)
 }
 
 func (t *TimingStat) Put(dur time.Duration) {
 	t.Count.Add(1)
 	t.Sum.Add(int64(dur))
 	t.SumOfSq.Add(int64(dur * dur))
+	t.Histo.Add(int64(dur))
 }
 
 func (t TimingStat) Value() string {
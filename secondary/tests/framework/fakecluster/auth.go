@@ -0,0 +1,301 @@
+package fakecluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// cbauth and metakv server side, best effort. The wire formats follow
+// what the cbauth client libraries expect of ns_server, a revrpc
+// connection upgraded from an RPCCONNECT request over which ns_server
+// pushes the credentials cache, and metakv entries as JSON under
+// /_metakv. Only features used by projector and indexer are supported.
+
+// cbauth credentials cache pushed to clients.
+type authCache struct {
+	Nodes              []authNode `json:"nodes"`
+	AuthCheckURL       string     `json:"authCheckUrl"`
+	PermissionCheckURL string     `json:"permissionCheckUrl"`
+	SpecialUser        string     `json:"specialUser"`
+}
+
+type authNode struct {
+	Host     string `json:"host"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Ports    []int  `json:"ports"`
+	Local    bool   `json:"local"`
+}
+
+// handleRevrpc hijacks an RPCCONNECT request and acts as the rpc client
+// over that connection, cbauth in the test process being the server.
+func (n *Node) handleRevrpc(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	if r.Method != "RPCCONNECT" {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	if user, pass, ok := r.BasicAuth(); !ok || user != c.config.User || pass != c.config.Password {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijack not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		logging.Errorf("%v revrpc hijack: %v\n", c.logPrefix, err)
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n")); err != nil {
+		conn.Close()
+		return
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.revrpcs = append(c.revrpcs, conn)
+	c.mu.Unlock()
+
+	rwc := &revrpcConn{Reader: bufrw.Reader, Conn: conn}
+	client := rpc.NewClientWithCodec(jsonrpc.NewClientCodec(rwc))
+	go func() {
+		defer client.Close()
+		var ok bool
+		if err := client.Call("AuthCacheSvc.UpdateDB", c.authCache(n), &ok); err != nil {
+			logging.Errorf("%v revrpc AuthCacheSvc.UpdateDB: %v\n", c.logPrefix, err)
+			return
+		}
+		// keep the connection open, cbauth treats a close as ns_server
+		// going away.
+		changed, closed := c.changeCh()
+		for !closed {
+			<-changed
+			changed, closed = c.changeCh()
+		}
+	}()
+}
+
+// reads buffered by the http server precede the rest of the connection.
+type revrpcConn struct {
+	*bufio.Reader
+	net.Conn
+}
+
+func (rc *revrpcConn) Read(p []byte) (int, error) {
+	return rc.Reader.Read(p)
+}
+
+func (c *Cluster) authCache(local *Node) *authCache {
+	cache := &authCache{
+		AuthCheckURL:       "http://" + local.RestAddr() + "/_cbauth/checkAuth",
+		PermissionCheckURL: "http://" + local.RestAddr() + "/_cbauth/checkPermission",
+		SpecialUser:        "@fakecluster",
+	}
+	for _, node := range c.nodes {
+		ports := make([]int, 0, len(node.services))
+		for _, port := range node.services {
+			ports = append(ports, port)
+		}
+		sort.Ints(ports)
+		cache.Nodes = append(cache.Nodes, authNode{
+			Host:     "127.0.0.1",
+			User:     c.config.User,
+			Password: c.config.Password,
+			Ports:    ports,
+			Local:    node == local,
+		})
+	}
+	return cache
+}
+
+// handleCheckAuth validates credentials forwarded by cbauth.
+func (n *Node) handleCheckAuth(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	user, pass, ok := r.BasicAuth()
+	if !ok || user != c.config.User || pass != c.config.Password {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, map[string]string{"role": "admin", "user": user})
+}
+
+//--------
+// metakv
+//--------
+
+type metakvEntry struct {
+	Path  string
+	Value []byte
+	Rev   []byte
+}
+
+type metakvStore struct {
+	mu      sync.Mutex
+	rev     uint64
+	entries map[string]*metakvEntry
+	changed chan struct{}
+}
+
+func newMetakvStore() *metakvStore {
+	return &metakvStore{
+		entries: make(map[string]*metakvEntry),
+		changed: make(chan struct{}),
+	}
+}
+
+func (s *metakvStore) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/_metakv")
+	switch r.Method {
+	case "GET":
+		if r.FormValue("feed") == "continuous" {
+			s.observe(w, path)
+		} else if strings.HasSuffix(path, "/") {
+			writeJSON(w, s.children(path))
+		} else if e := s.get(path); e != nil {
+			writeJSON(w, e)
+		} else {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+
+	case "PUT":
+		r.ParseForm()
+		var rev []byte
+		if v, ok := r.Form["rev"]; ok {
+			rev = []byte(v[0])
+		}
+		create := r.FormValue("create") == "true"
+		if !s.set(path, []byte(r.FormValue("value")), rev, create) {
+			http.Error(w, "revision mismatch", http.StatusConflict)
+		}
+
+	case "DELETE":
+		s.delete(path)
+
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *metakvStore) get(path string) *metakvEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[path]
+}
+
+func (s *metakvStore) children(dir string) []*metakvEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.childrenLocked(dir)
+}
+
+func (s *metakvStore) childrenLocked(dir string) []*metakvEntry {
+	entries := make([]*metakvEntry, 0)
+	for path, e := range s.entries {
+		if strings.HasPrefix(path, dir) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// set entry at path, rev, when given, shall match the current revision
+// and create shall fail if the entry already exists.
+func (s *metakvStore) set(path string, value, rev []byte, create bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.entries[path]
+	if (create && ok) || (rev != nil && (!ok || string(old.Rev) != string(rev))) {
+		return false
+	}
+	s.rev++
+	s.entries[path] = &metakvEntry{
+		Path:  path,
+		Value: value,
+		Rev:   []byte(strconv.FormatUint(s.rev, 10)),
+	}
+	s.notifyLocked()
+	return true
+}
+
+func (s *metakvStore) delete(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[path]; ok {
+		delete(s.entries, path)
+		s.notifyLocked()
+	}
+}
+
+func (s *metakvStore) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// observe entries under dir, streaming existing entries and every update
+// thereafter. Deleted entries are streamed with a nil value.
+func (s *metakvStore) observe(w http.ResponseWriter, dir string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	var gone <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		gone = cn.CloseNotify()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	seen := make(map[string]string)
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		entries := s.childrenLocked(dir)
+		s.mu.Unlock()
+
+		current := make(map[string]string)
+		for _, e := range entries {
+			current[e.Path] = string(e.Rev)
+			if seen[e.Path] == string(e.Rev) {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+		for path := range seen {
+			if _, ok := current[path]; !ok {
+				if err := enc.Encode(&metakvEntry{Path: path}); err != nil {
+					return
+				}
+			}
+		}
+		seen = current
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-gone:
+			return
+		}
+	}
+}
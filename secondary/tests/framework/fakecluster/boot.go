@@ -0,0 +1,189 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/dataport"
+	"github.com/couchbase/indexing/secondary/indexer"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/projector"
+)
+
+// Projector and indexer are booted in-process on the first node, the
+// same way cmd/projector and cmd/indexer do. Both register process wide
+// state, like expvars and handlers on the default http mux, hence a
+// process can boot them only once. With more than one node, vbuckets
+// active on other nodes are not projected.
+
+// BootTimeout for projector and indexer to come up.
+var BootTimeout = 2 * time.Minute
+
+var authOnce sync.Once
+var authErr error
+
+// initAuth unless cbauth was already set up from CBAUTH_REVRPC_URL.
+func (c *Cluster) initAuth() error {
+	if os.Getenv(envRevrpcURL) != "" {
+		return nil
+	}
+	authOnce.Do(func() {
+		_, authErr = cbauth.InternalRetryDefaultInit(
+			c.ClusterAddr(), c.config.User, c.config.Password)
+	})
+	return authErr
+}
+
+// bootConfig for projector and indexer of a node, that can be passed
+// on to a node process.
+type bootConfig struct {
+	ClusterAddr string
+	NumVbuckets int
+	Services    map[string]int // service ports of the node
+	NodeUUID    string
+	LogPrefix   string
+}
+
+func (c *Cluster) bootConfig() *bootConfig {
+	node := c.nodes[0]
+	return &bootConfig{
+		ClusterAddr: c.ClusterAddr(),
+		NumVbuckets: c.config.NumVbuckets,
+		Services:    node.services,
+		NodeUUID:    node.uuid,
+		LogPrefix:   c.logPrefix,
+	}
+}
+
+func (b *bootConfig) serviceAddr(srvc string) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(b.Services[srvc]))
+}
+
+// StartProjector on the first node, listening on its projector port.
+func (c *Cluster) StartProjector(diagDir string) error {
+	if err := c.initAuth(); err != nil {
+		return err
+	}
+	return c.bootConfig().startProjector(diagDir)
+}
+
+func (b *bootConfig) startProjector(diagDir string) error {
+	if err := os.MkdirAll(diagDir, 0755); err != nil {
+		return err
+	}
+
+	nvbs, cluster := b.NumVbuckets, b.ClusterAddr
+	config := common.SystemConfig.Clone()
+	config.SetValue("maxVbuckets", nvbs)
+	config.SetValue("projector.clusterAddr", cluster)
+	config.SetValue("projector.adminport.listenAddr", b.serviceAddr("projector"))
+	config.SetValue("projector.diagnostics_dir", diagDir)
+	epfactory := func(topic, endpointType, addr string, config common.Config) (common.RouterEndpoint, error) {
+		switch endpointType {
+		case "dataport":
+			return dataport.NewRouterEndpoint(cluster, topic, addr, nvbs, config)
+		}
+		return nil, fmt.Errorf("unknown endpoint type %v", endpointType)
+	}
+	config.SetValue("projector.routerEndpointFactory", common.RouterEndpointFactory(epfactory))
+
+	projector.NewProjector(nvbs, config)
+	return waitForAddr(b.serviceAddr("projector"), BootTimeout)
+}
+
+// StartIndexer on the first node, storing index files under storageDir,
+// and wait for it to become active. storageMode is forestdb or
+// memory_optimized, empty for the default.
+func (c *Cluster) StartIndexer(storageDir, storageMode string) error {
+	if err := c.initAuth(); err != nil {
+		return err
+	}
+	b := c.bootConfig()
+	if err := b.startIndexer(storageDir, storageMode); err != nil {
+		return err
+	}
+	return c.waitForIndexer(b.serviceAddr("indexHttp"), BootTimeout)
+}
+
+func (b *bootConfig) startIndexer(storageDir, storageMode string) error {
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return err
+	}
+	if storageMode != "" && !common.SetStorageModeStr(storageMode) {
+		return fmt.Errorf("invalid storage mode %v", storageMode)
+	}
+
+	port := func(srvc string) string {
+		return strconv.Itoa(b.Services[srvc])
+	}
+	config := common.SystemConfig.Clone()
+	config.SetValue("indexer.clusterAddr", b.ClusterAddr)
+	config.SetValue("indexer.numVbuckets", b.NumVbuckets)
+	config.SetValue("indexer.enableManager", true)
+	config.SetValue("indexer.adminPort", port("indexAdmin"))
+	config.SetValue("indexer.scanPort", port("indexScan"))
+	config.SetValue("indexer.httpPort", port("indexHttp"))
+	config.SetValue("indexer.streamInitPort", port("indexStreamInit"))
+	config.SetValue("indexer.streamCatchupPort", port("indexStreamCatchup"))
+	config.SetValue("indexer.streamMaintPort", port("indexStreamMaint"))
+	config.SetValue("indexer.storage_dir", storageDir)
+	config.SetValue("indexer.diagnostics_dir", storageDir)
+	config.SetValue("indexer.nodeuuid", b.NodeUUID)
+
+	go func() {
+		if _, msg := indexer.NewIndexer(config); msg.GetMsgType() != indexer.MSG_SUCCESS {
+			logging.Errorf("%v indexer failed to start: %v\n", b.LogPrefix, msg)
+		}
+	}()
+	return nil
+}
+
+// IndexerAddr is the admin address of the in-process indexer, to be used
+// as cluster address by queryport clients.
+func (c *Cluster) IndexerAddr() string {
+	return c.nodes[0].ServiceAddr("indexAdmin")
+}
+
+func (c *Cluster) waitForIndexer(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := c.indexerState(addr)
+		if err == nil && state == common.INDEXER_ACTIVE.String() {
+			return nil
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for indexer, state %q: %v", state, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func (c *Cluster) indexerState(addr string) (string, error) {
+	req, err := http.NewRequest("GET", "http://"+addr+"/stats", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.config.User, c.config.Password)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("stats %v", res.Status)
+	}
+
+	var stats map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return "", err
+	}
+	state, _ := stats["indexer_state"].(string)
+	return state, nil
+}
@@ -0,0 +1,424 @@
+// Package fakecluster is a self-contained stand-in for a Couchbase cluster,
+// enough to run projector and indexer end-to-end with `go test`.
+//
+// A cluster is a set of fake nodes on localhost, each serving,
+//   - ns_server REST, /pools, bucket details with vbucket maps and node
+//     services, along with their streaming variants, metakv under
+//     /_metakv and the cbauth revrpc handshake.
+//   - memcached binary protocol with a DCP producer for all buckets,
+//     supporting failover logs, snapshot markers, seqnos, rollback and
+//     vbucket takeover.
+//
+// Projector and indexer look up credentials and settings via cbauth and
+// metakv, which pick the cluster address from CBAUTH_REVRPC_URL when the
+// process starts. Packages booting them in-process shall run their tests
+// via Main, that re-executes the test binary with the environment set up.
+package fakecluster
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// environment variable read by cbauth and metakv on process start.
+const envRevrpcURL = "CBAUTH_REVRPC_URL"
+
+// Config for a fake cluster.
+type Config struct {
+	NumNodes    int      // number of kv nodes, default 1
+	NumVbuckets int      // vbuckets per bucket, power of 2, default 64
+	Buckets     []string // buckets to create, default ["default"]
+	User        string   // administrator, default "Administrator"
+	Password    string   // default "asdasd"
+}
+
+// Cluster of fake nodes.
+type Cluster struct {
+	config Config
+	uuid   string
+
+	mu      sync.Mutex
+	nodes   []*Node
+	buckets map[string]*Bucket
+	rev     int
+	changed chan struct{} // closed and renewed on topology change
+	metakv  *metakvStore
+	revrpcs []net.Conn
+	closed  bool
+
+	logPrefix string
+}
+
+// Node is a fake cluster node, with ns_server REST and memcached
+// listening on localhost. Ports for index and projector services are
+// reserved on every node, though only the node hosting in-process
+// projector and indexer serves them.
+type Node struct {
+	index    int
+	cluster  *Cluster
+	uuid     string // of the indexer node, same across restarts
+	rest     net.Listener
+	kv       net.Listener
+	services map[string]int
+
+	mu     sync.Mutex
+	conns  map[net.Conn]bool // accepted REST and memcached connections
+	closed bool
+}
+
+// New starts a fake cluster. If the process was started by Main, the
+// first node listens on the address in CBAUTH_REVRPC_URL.
+func New(config Config) (*Cluster, error) {
+	if config.NumNodes <= 0 {
+		config.NumNodes = 1
+	}
+	if config.NumVbuckets <= 0 {
+		config.NumVbuckets = 64
+	}
+	if config.NumVbuckets&(config.NumVbuckets-1) != 0 {
+		return nil, fmt.Errorf("number of vbuckets %v is not a power of 2", config.NumVbuckets)
+	}
+	if len(config.Buckets) == 0 {
+		config.Buckets = []string{"default"}
+	}
+	if config.User == "" {
+		config.User, config.Password = "Administrator", "asdasd"
+	}
+
+	c := &Cluster{
+		config:    config,
+		uuid:      newUUID(),
+		buckets:   make(map[string]*Bucket),
+		changed:   make(chan struct{}),
+		metakv:    newMetakvStore(),
+		logPrefix: "FAKECLUSTER",
+	}
+
+	for i := 0; i < config.NumNodes; i++ {
+		restAddr := "127.0.0.1:0"
+		if u, err := url.Parse(os.Getenv(envRevrpcURL)); i == 0 && err == nil && u.Host != "" {
+			restAddr = u.Host
+		}
+		n, err := c.newNode(i, restAddr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, n)
+	}
+
+	for _, name := range config.Buckets {
+		c.buckets[name] = newBucket(c, name, config.NumVbuckets)
+	}
+
+	for _, n := range c.nodes {
+		go n.serveREST()
+		go n.serveKV()
+	}
+	logging.Infof("%v started %v nodes, REST at %v\n", c.logPrefix, len(c.nodes), c.ClusterAddr())
+	return c, nil
+}
+
+func (c *Cluster) newNode(index int, restAddr string) (*Node, error) {
+	n := &Node{
+		index:    index,
+		cluster:  c,
+		uuid:     newUUID(),
+		services: make(map[string]int),
+		conns:    make(map[net.Conn]bool),
+	}
+
+	var err error
+	if n.rest, err = net.Listen("tcp", restAddr); err != nil {
+		return nil, err
+	}
+	if n.kv, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		n.rest.Close()
+		return nil, err
+	}
+	n.services["mgmt"] = listenerPort(n.rest)
+	n.services["kv"] = listenerPort(n.kv)
+
+	for _, srvc := range []string{"projector", "indexAdmin", "indexScan",
+		"indexHttp", "indexStreamInit", "indexStreamCatchup", "indexStreamMaint"} {
+
+		port, err := freePort()
+		if err != nil {
+			n.close()
+			return nil, err
+		}
+		n.services[srvc] = port
+	}
+	return n, nil
+}
+
+// Close the cluster, stopping all listeners and connections.
+func (c *Cluster) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	revrpcs := c.revrpcs
+	c.revrpcs = nil
+	c.mu.Unlock()
+
+	for _, conn := range revrpcs {
+		conn.Close()
+	}
+	for _, n := range c.nodes {
+		n.close()
+	}
+	for _, b := range c.buckets {
+		b.closeStreams()
+	}
+	c.notifyChange()
+}
+
+// ClusterAddr is the ns_server REST address of the first node, in
+// host:port form, as passed to projector and indexer.
+func (c *Cluster) ClusterAddr() string {
+	return c.nodes[0].RestAddr()
+}
+
+// ClusterURL with administrator credentials, for dcp.Connect and
+// ClusterInfoCache.
+func (c *Cluster) ClusterURL() string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   c.ClusterAddr(),
+		User:   url.UserPassword(c.config.User, c.config.Password),
+	}
+	return u.String()
+}
+
+// Credentials of the cluster administrator.
+func (c *Cluster) Credentials() (user, password string) {
+	return c.config.User, c.config.Password
+}
+
+// Nodes of the cluster.
+func (c *Cluster) Nodes() []*Node {
+	return c.nodes
+}
+
+// Bucket by name, nil if the bucket does not exist.
+func (c *Cluster) Bucket(name string) *Bucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buckets[name]
+}
+
+// CreateBucket with a vbucket map spreading vbuckets across all nodes.
+func (c *Cluster) CreateBucket(name string) (*Bucket, error) {
+	c.mu.Lock()
+	if _, ok := c.buckets[name]; ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("bucket %v already exists", name)
+	}
+	b := newBucket(c, name, c.config.NumVbuckets)
+	c.buckets[name] = b
+	c.mu.Unlock()
+
+	c.notifyChange()
+	return b, nil
+}
+
+// DeleteBucket closing all its streams.
+func (c *Cluster) DeleteBucket(name string) error {
+	c.mu.Lock()
+	b, ok := c.buckets[name]
+	delete(c.buckets, name)
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("bucket %v does not exist", name)
+	}
+
+	b.closeStreams()
+	c.notifyChange()
+	return nil
+}
+
+// notifyChange wakes up streaming REST clients and bumps the revision
+// of node services.
+func (c *Cluster) notifyChange() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rev++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Cluster) changeCh() (<-chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed, c.closed
+}
+
+func (c *Cluster) bucketList() []*Bucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buckets := make([]*Bucket, 0, len(c.buckets))
+	for _, b := range c.buckets {
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// RestAddr of ns_server REST on this node.
+func (n *Node) RestAddr() string {
+	return n.rest.Addr().String()
+}
+
+// KVAddr of memcached on this node.
+func (n *Node) KVAddr() string {
+	return n.kv.Addr().String()
+}
+
+// ServicePort reserved for service srvc on this node, as published in
+// node services.
+func (n *Node) ServicePort(srvc string) int {
+	return n.services[srvc]
+}
+
+// ServiceAddr reserved for service srvc on this node.
+func (n *Node) ServiceAddr(srvc string) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(n.services[srvc]))
+}
+
+// close listeners and connections, so that clients holding on to a
+// keep-alive connection do not see a closed cluster.
+func (n *Node) close() {
+	if n.rest != nil {
+		n.rest.Close()
+	}
+	if n.kv != nil {
+		n.kv.Close()
+	}
+
+	n.mu.Lock()
+	n.closed = true
+	conns := n.conns
+	n.conns = make(map[net.Conn]bool)
+	n.mu.Unlock()
+	for conn := range conns {
+		conn.Close()
+	}
+}
+
+// track an accepted connection till it is closed, false if the node is
+// already closed.
+func (n *Node) track(conn net.Conn) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return false
+	}
+	n.conns[conn] = true
+	return true
+}
+
+func (n *Node) untrack(conn net.Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.conns, conn)
+}
+
+// Main runs tests of the calling package against a fake cluster booting
+// projector and indexer in-process. To be called from TestMain. In a
+// node process, started by StartNodeProcess, it boots projector and
+// indexer instead of running tests.
+func Main(m *testing.M) {
+	Run(m.Run)
+}
+
+// Run is Main for tools booting projector and indexer against a fake
+// cluster. It re-executes the process with the environment set up, in
+// which run is called, and exits with its status.
+func Run(run func() int) {
+	if data := os.Getenv(envNodeProcess); data != "" {
+		runNodeProcess(data)
+	}
+	if os.Getenv(envRevrpcURL) != "" {
+		os.Exit(run())
+	}
+
+	port, err := freePort()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fakecluster: %v\n", err)
+		os.Exit(1)
+	}
+	host := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(), envRevrpcURL+"="+revrpcURL(host, "Administrator", "asdasd"))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitStatus(exitErr); ok {
+				os.Exit(status)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "fakecluster: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// revrpcURL for cbauth to reach ns_server REST at host.
+func revrpcURL(host, user, password string) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+		User:   url.UserPassword(user, password),
+		Path:   "/_cbauth",
+	}
+	return u.String()
+}
+
+func exitStatus(err *exec.ExitError) (int, bool) {
+	if status, ok := err.Sys().(syscall.WaitStatus); ok {
+		return status.ExitStatus(), true
+	}
+	return 0, false
+}
+
+func listenerPort(l net.Listener) int {
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// freePort reserves a port by binding and releasing it.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return listenerPort(l), nil
+}
+
+// waitForAddr till something listens on addr.
+func waitForAddr(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %v: %v", addr, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
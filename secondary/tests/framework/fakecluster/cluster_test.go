@@ -0,0 +1,402 @@
+package fakecluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport"
+	mcc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/tests/framework/secondaryindex"
+)
+
+var dcpConfig = map[string]interface{}{
+	"genChanSize":    1000,
+	"dataChanSize":   1000,
+	"numConnections": 1,
+}
+
+func TestMain(m *testing.M) {
+	Main(m)
+}
+
+func startCluster(t *testing.T, nodes int) (*Cluster, *couchbase.Bucket) {
+	cl, err := New(Config{NumNodes: nodes, NumVbuckets: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := couchbase.Connect(cl.ClusterURL())
+	if err != nil {
+		cl.Close()
+		t.Fatal(err)
+	}
+	pool, err := client.GetPool("default")
+	if err != nil {
+		cl.Close()
+		t.Fatal(err)
+	}
+	bucket, err := pool.GetBucket("default")
+	if err != nil {
+		cl.Close()
+		t.Fatal(err)
+	}
+	return cl, bucket
+}
+
+func allVbuckets(nvbs int) []uint16 {
+	vbnos := make([]uint16, 0, nvbs)
+	for vbno := 0; vbno < nvbs; vbno++ {
+		vbnos = append(vbnos, uint16(vbno))
+	}
+	return vbnos
+}
+
+// nextEvent of opcode, skipping others, for vbucket vbno.
+func nextEvent(t *testing.T, feed *couchbase.DcpFeed,
+	opcode mc.CommandCode, vbno uint16) *mcc.DcpEvent {
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e := <-feed.C:
+			if e.Opcode == opcode && e.VBucket == vbno {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %v on vb %v", opcode, vbno)
+		}
+	}
+}
+
+func TestBucketVbmap(t *testing.T) {
+	cl, bucket := startCluster(t, 2)
+	defer cl.Close()
+	defer bucket.Close()
+
+	vbmap := bucket.VBServerMap()
+	if len(vbmap.VBucketMap) != 8 || len(vbmap.ServerList) != 2 {
+		t.Fatalf("unexpected vbmap %v", vbmap)
+	}
+	for i, node := range cl.Nodes() {
+		if vbmap.ServerList[i] != node.KVAddr() {
+			t.Fatalf("expected server %v, got %v", node.KVAddr(), vbmap.ServerList[i])
+		}
+	}
+	fb := cl.Bucket("default")
+	for vbno, idxs := range vbmap.VBucketMap {
+		if owner := fb.Owner(uint16(vbno)); idxs[0] != owner {
+			t.Fatalf("vb %v expected on node %v, got %v", vbno, owner, idxs[0])
+		}
+	}
+}
+
+func TestClusterInfoCache(t *testing.T) {
+	cl, bucket := startCluster(t, 2)
+	defer cl.Close()
+	bucket.Close()
+
+	cinfo, err := common.NewClusterInfoCache(cl.ClusterURL(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cinfo.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	nids := cinfo.GetNodesByServiceType(common.INDEX_ADMIN_SERVICE)
+	if len(nids) != 2 {
+		t.Fatalf("expected 2 index nodes, got %v", nids)
+	}
+	addr, err := cinfo.GetLocalServiceAddress("kv")
+	if err != nil || addr != cl.Nodes()[0].KVAddr() {
+		t.Fatalf("unexpected local kv address %v: %v", addr, err)
+	}
+	vbs, err := cinfo.GetVBuckets(cinfo.GetCurrentNode(), "default")
+	if err != nil || len(vbs) != 4 {
+		t.Fatalf("unexpected vbuckets %v: %v", vbs, err)
+	}
+}
+
+func TestKVOperations(t *testing.T) {
+	cl, bucket := startCluster(t, 2)
+	defer cl.Close()
+	defer bucket.Close()
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("doc%v", i)
+		if err := bucket.SetRaw(key, 0, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, ok := cl.Bucket("default").Get("doc3"); !ok || string(value) != "doc3" {
+		t.Fatalf("unexpected value %q", value)
+	}
+	if value, err := bucket.GetRaw("doc4"); err != nil || string(value) != "doc4" {
+		t.Fatalf("unexpected value %q: %v", value, err)
+	}
+	if err := bucket.Delete("doc4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bucket.GetRaw("doc4"); err == nil {
+		t.Fatalf("expected doc4 to be deleted")
+	}
+}
+
+func TestDcpStream(t *testing.T) {
+	cl, bucket := startCluster(t, 2)
+	defer cl.Close()
+	defer bucket.Close()
+
+	fb := cl.Bucket("default")
+	for i := 0; i < 20; i++ {
+		fb.Set(fmt.Sprintf("doc%v", i), []byte("{}"))
+	}
+
+	vbnos := allVbuckets(fb.NumVbuckets())
+	flogs, err := bucket.GetFailoverLogs(0xABCD, vbnos, dcpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := bucket.StartDcpFeed(couchbase.NewDcpFeedName("test"), 0, 0xABCD, dcpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+
+	seqnos, err := feed.DcpGetSeqnos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vbno := range vbnos {
+		if seqnos[vbno] != fb.HighSeqno(vbno) {
+			t.Fatalf("vb %v expected seqno %v, got %v", vbno, fb.HighSeqno(vbno), seqnos[vbno])
+		}
+		flog := flogs[vbno]
+		vbuuid, _, _ := flog.Latest()
+		err := feed.DcpRequestStream(vbno, 1, 0, vbuuid, 0, 0xFFFFFFFFFFFFFFFF, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mutations, snapshots := 0, 0
+	timeout := time.After(10 * time.Second)
+	for mutations < 20 {
+		select {
+		case e := <-feed.C:
+			switch e.Opcode {
+			case mc.DCP_MUTATION:
+				mutations++
+			case mc.DCP_SNAPSHOT:
+				snapshots++
+			}
+		case <-timeout:
+			t.Fatalf("received %v mutations of 20", mutations)
+		}
+	}
+	if snapshots == 0 {
+		t.Fatalf("expected snapshot markers")
+	}
+
+	// live mutations.
+	seqno, _ := fb.Set("doc0", []byte("{\"a\":1}"))
+	e := nextEvent(t, feed, mc.DCP_MUTATION, fb.VbucketOf("doc0"))
+	if e.Seqno != seqno || string(e.Key) != "doc0" {
+		t.Fatalf("unexpected mutation %v", e)
+	}
+	seqno, _ = fb.Delete("doc1")
+	e = nextEvent(t, feed, mc.DCP_DELETION, fb.VbucketOf("doc1"))
+	if e.Seqno != seqno {
+		t.Fatalf("unexpected deletion %v", e)
+	}
+}
+
+func TestDcpRollback(t *testing.T) {
+	cl, bucket := startCluster(t, 1)
+	defer cl.Close()
+	defer bucket.Close()
+
+	fb := cl.Bucket("default")
+	vbno := fb.VbucketOf("doc0")
+	for i := 0; i < 5; i++ {
+		fb.Set("doc0", []byte("{}"))
+	}
+	flog := fb.FailoverLog(vbno)
+	vbuuid, high := flog[0].Vbuuid, fb.HighSeqno(vbno)
+
+	feed, err := bucket.StartDcpFeed(couchbase.NewDcpFeedName("test"), 0, 0xABCD, dcpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	if err := feed.DcpRequestStream(vbno, 1, 0, vbuuid, high, 0xFFFFFFFFFFFFFFFF, high, high); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, feed, mc.DCP_STREAMREQ, vbno)
+
+	if err := fb.InjectRollback(vbno, 2); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, feed, mc.DCP_STREAMEND, vbno)
+	if len(fb.FailoverLog(vbno)) != 2 || fb.HighSeqno(vbno) != 2 {
+		t.Fatalf("unexpected failover log %v", fb.FailoverLog(vbno))
+	}
+
+	if err := feed.DcpRequestStream(vbno, 1, 0, vbuuid, high, 0xFFFFFFFFFFFFFFFF, high, high); err != nil {
+		t.Fatal(err)
+	}
+	e := nextEvent(t, feed, mc.DCP_STREAMREQ, vbno)
+	if e.Status != mc.ROLLBACK || e.Seqno != 2 {
+		t.Fatalf("expected rollback to 2, got %v %v", e.Status, e.Seqno)
+	}
+}
+
+func TestDcpTakeover(t *testing.T) {
+	cl, bucket := startCluster(t, 2)
+	defer cl.Close()
+	defer bucket.Close()
+
+	fb := cl.Bucket("default")
+	vbno := fb.ActiveVbuckets(0)[0]
+	vbuuid := fb.FailoverLog(vbno)[0].Vbuuid
+
+	feed, err := bucket.StartDcpFeed(couchbase.NewDcpFeedName("test"), 0, 0xABCD, dcpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	if err := feed.DcpRequestStream(vbno, 1, 0, vbuuid, 0, 0xFFFFFFFFFFFFFFFF, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, feed, mc.DCP_STREAMREQ, vbno)
+
+	if err := fb.Takeover(vbno, 1); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, feed, mc.DCP_STREAMEND, vbno)
+
+	if err := bucket.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if owner := bucket.VBServerMap().VBucketMap[vbno][0]; owner != 1 {
+		t.Fatalf("expected vb %v on node 1, got %v", vbno, owner)
+	}
+	flogs, err := bucket.GetFailoverLogs(0xABCD, []uint16{vbno}, dcpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flog := flogs[vbno]
+	if latest, _, _ := flog.Latest(); len(flog) != 2 || latest == vbuuid {
+		t.Fatalf("expected a new failover entry, got %v", flog)
+	}
+}
+
+func TestDcpXattrs(t *testing.T) {
+	cl, bucket := startCluster(t, 1)
+	defer cl.Close()
+	defer bucket.Close()
+
+	config := map[string]interface{}{"xattrs": true, "snappy": true}
+	for key, value := range dcpConfig {
+		config[key] = value
+	}
+	fb := cl.Bucket("default")
+	vbno := fb.VbucketOf("doc0")
+	vbuuid := fb.FailoverLog(vbno)[0].Vbuuid
+
+	feed, err := bucket.StartDcpFeed(couchbase.NewDcpFeedName("test"), 0, 0xABCD, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	if err := feed.DcpRequestStream(vbno, 1, 0, vbuuid, 0, 0xFFFFFFFFFFFFFFFF, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, feed, mc.DCP_STREAMREQ, vbno)
+
+	doc, rev := []byte(`{"a":1}`), []byte(`{"rev":"1-abc"}`)
+	fb.SetWithXattrs("doc0", doc, map[string][]byte{"_sync": rev})
+	e := nextEvent(t, feed, mc.DCP_MUTATION, vbno)
+	if string(e.Value) != string(doc) || e.Datatype != mc.DatatypeJSON {
+		t.Fatalf("unexpected value %q datatype %v", e.Value, e.Datatype)
+	}
+	if len(e.Xattrs) != 1 || string(e.Xattrs["_sync"]) != string(rev) {
+		t.Fatalf("unexpected xattrs %v", e.Xattrs)
+	}
+
+	// documents without xattrs.
+	fb.Set("doc0", doc)
+	e = nextEvent(t, feed, mc.DCP_MUTATION, vbno)
+	if string(e.Value) != string(doc) || len(e.Xattrs) != 0 {
+		t.Fatalf("unexpected mutation %q %v", e.Value, e.Xattrs)
+	}
+}
+
+// TestIndexerEndToEnd boots projector and indexer against the fake
+// cluster, builds an index, scans it and verifies that a rollback is
+// reflected in the index.
+func TestIndexerEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	cl, err := New(Config{NumVbuckets: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	dir, err := ioutil.TempDir("", "fakecluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := cl.StartProjector(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.StartIndexer(dir, common.StorageMode(common.FORESTDB).String()); err != nil {
+		t.Fatal(err)
+	}
+
+	fb := cl.Bucket("default")
+	for i := 0; i < 100; i++ {
+		fb.Set(fmt.Sprintf("doc%v", i), []byte(fmt.Sprintf(`{"age":%v}`, i)))
+	}
+
+	server := cl.ClusterAddr()
+	err = secondaryindex.CreateSecondaryIndex(
+		"idx_age", "default", server, "", []string{"age"}, false, nil, true, 120, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := secondaryindex.ScanAll("idx_age", "default", server, 0, common.SessionConsistency, nil)
+	if err != nil || len(rows) != 100 {
+		t.Fatalf("expected 100 rows, got %v: %v", len(rows), err)
+	}
+
+	// rollback a vbucket to zero, its documents are lost.
+	vbno := fb.VbucketOf("doc0")
+	lost := 0
+	for i := 0; i < 100; i++ {
+		if fb.VbucketOf(fmt.Sprintf("doc%v", i)) == vbno {
+			lost++
+		}
+	}
+	if err := fb.InjectRollback(vbno, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		rows, err := secondaryindex.ScanAll("idx_age", "default", server, 0, common.AnyConsistency, nil)
+		if err == nil && len(rows) == 100-lost {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected %v rows after rollback, got %v: %v", 100-lost, len(rows), err)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,418 @@
+package fakecluster
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	mc "github.com/couchbase/indexing/secondary/dcp/transport"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/golang/snappy"
+)
+
+// DCP producer, per memcached connection. Every stream is served by its
+// own routine, sending a snapshot marker followed by the mutations since
+// the last snapshot, each time the vbucket changes. Snapshots are always
+// in-memory snapshots and mutations are not de-duplicated. Flow control
+// is not enforced and NOOPs are not sent. Values are sent with the
+// datatypes negotiated by HELLO, xattrs are included only when asked
+// for by DCP_OPEN and values are always compressed if snappy is enabled.
+
+// flags in DCP_STREAMEND.
+const (
+	dcpStreamEndOK           = uint32(0)
+	dcpStreamEndClosed       = uint32(1)
+	dcpStreamEndStateChanged = uint32(2)
+)
+
+// extras length of DCP_STREAMREQ.
+const dcpStreamReqExtrasLen = 48
+
+type dcpProducer struct {
+	kc     *kvConn
+	name   string
+	xattrs bool // include xattrs in mutations
+
+	mu      sync.Mutex
+	streams map[uint16]*dcpStream
+}
+
+type dcpStream struct {
+	producer *dcpProducer
+	bucket   *Bucket
+	vbno     uint16
+	opaque   uint32
+	start    uint64
+	endSeqno uint64
+
+	endch   chan uint32   // ended by cluster, with flags
+	closech chan struct{} // closed by client
+	donech  chan struct{}
+}
+
+func isDcpOpcode(opcode mc.CommandCode) bool {
+	switch opcode {
+	case mc.DCP_OPEN, mc.DCP_CONTROL, mc.DCP_FAILOVERLOG, mc.DCP_GET_SEQNO,
+		mc.DCP_STREAMREQ, mc.DCP_CLOSESTREAM, mc.DCP_BUFFERACK, mc.DCP_NOOP:
+		return true
+	}
+	return false
+}
+
+func (kc *kvConn) handleDcp(req *mc.MCRequest) *mc.MCResponse {
+	switch req.Opcode {
+	case mc.DCP_BUFFERACK, mc.DCP_NOOP:
+		return nil
+	case mc.DCP_OPEN:
+		if kc.dcp != nil {
+			kc.dcp.close()
+		}
+		var flags uint32
+		if len(req.Extras) >= 8 {
+			flags = binary.BigEndian.Uint32(req.Extras[4:8])
+		}
+		kc.dcp = &dcpProducer{
+			kc:      kc,
+			name:    string(req.Key),
+			xattrs:  flags&mc.DCP_OPEN_INCLUDE_XATTRS != 0,
+			streams: make(map[uint16]*dcpStream),
+		}
+		logging.Debugf("%v node %v DCP_OPEN %q flags %x\n",
+			kc.node.cluster.logPrefix, kc.node.index, kc.dcp.name, flags)
+		return &mc.MCResponse{}
+	}
+
+	if kc.bucket == nil {
+		return &mc.MCResponse{Status: mc.EINVAL}
+	}
+	switch req.Opcode {
+	case mc.DCP_CONTROL:
+		return &mc.MCResponse{}
+	case mc.DCP_FAILOVERLOG:
+		return kc.handleFailoverLog(req)
+	case mc.DCP_GET_SEQNO:
+		return kc.handleGetSeqnos(req)
+	}
+
+	if kc.dcp == nil {
+		return &mc.MCResponse{Status: mc.EINVAL}
+	}
+	switch req.Opcode {
+	case mc.DCP_STREAMREQ:
+		res, stream := kc.dcp.streamRequest(req)
+		if stream == nil {
+			return res
+		}
+		// response shall precede the stream.
+		res.Opcode, res.Opaque = req.Opcode, req.Opaque
+		if err := kc.transmit(res); err != nil {
+			kc.dcp.remove(stream)
+			return nil
+		}
+		go stream.run()
+		return nil
+	case mc.DCP_CLOSESTREAM:
+		return kc.dcp.closeStream(req.VBucket)
+	}
+	return &mc.MCResponse{Status: mc.UNKNOWN_COMMAND}
+}
+
+func (kc *kvConn) handleFailoverLog(req *mc.MCRequest) *mc.MCResponse {
+	b := kc.bucket
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(req.VBucket) >= len(b.vbuckets) || b.vbuckets[req.VBucket].node != kc.node.index {
+		return &mc.MCResponse{Status: mc.NOT_MY_VBUCKET}
+	}
+	return &mc.MCResponse{Body: encodeFailoverLog(b.vbuckets[req.VBucket].flog)}
+}
+
+// handleGetSeqnos for vbuckets active on this node.
+func (kc *kvConn) handleGetSeqnos(req *mc.MCRequest) *mc.MCResponse {
+	b := kc.bucket
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	body := make([]byte, 0, len(b.vbuckets)*10)
+	for _, vb := range b.vbuckets {
+		if vb.node != kc.node.index {
+			continue
+		}
+		var entry [10]byte
+		binary.BigEndian.PutUint16(entry[:2], vb.vbno)
+		binary.BigEndian.PutUint64(entry[2:], vb.high)
+		body = append(body, entry[:]...)
+	}
+	return &mc.MCResponse{Body: body}
+}
+
+// streamRequest returns the response and, if the request is accepted,
+// a stream yet to be started.
+func (p *dcpProducer) streamRequest(req *mc.MCRequest) (*mc.MCResponse, *dcpStream) {
+	if len(req.Extras) < dcpStreamReqExtrasLen {
+		return &mc.MCResponse{Status: mc.EINVAL}, nil
+	}
+	start := binary.BigEndian.Uint64(req.Extras[8:16])
+	end := binary.BigEndian.Uint64(req.Extras[16:24])
+	vbuuid := binary.BigEndian.Uint64(req.Extras[24:32])
+
+	b, vbno := p.kc.bucket, req.VBucket
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) || b.vbuckets[vbno].node != p.kc.node.index {
+		return &mc.MCResponse{Status: mc.NOT_MY_VBUCKET}, nil
+	}
+	vb := b.vbuckets[vbno]
+	if seqno, ok := vb.rollbackSeqno(vbuuid, start); ok {
+		body := make([]byte, 8)
+		binary.BigEndian.PutUint64(body, seqno)
+		return &mc.MCResponse{Status: mc.ROLLBACK, Body: body}, nil
+	} else if start > end {
+		return &mc.MCResponse{Status: mc.ERANGE}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.streams[vbno]; ok {
+		return &mc.MCResponse{Status: mc.KEY_EEXISTS}, nil
+	}
+	stream := &dcpStream{
+		producer: p,
+		bucket:   b,
+		vbno:     vbno,
+		opaque:   req.Opaque,
+		start:    start,
+		endSeqno: end,
+		endch:    make(chan uint32, 1),
+		closech:  make(chan struct{}),
+		donech:   make(chan struct{}),
+	}
+	p.streams[vbno] = stream
+	vb.streams[stream] = true
+	return &mc.MCResponse{Body: encodeFailoverLog(vb.flog)}, stream
+}
+
+func (p *dcpProducer) closeStream(vbno uint16) *mc.MCResponse {
+	p.mu.Lock()
+	stream, ok := p.streams[vbno]
+	p.mu.Unlock()
+	if !ok {
+		return &mc.MCResponse{Status: mc.KEY_ENOENT}
+	}
+	stream.stop()
+	p.remove(stream)
+	return &mc.MCResponse{}
+}
+
+func (p *dcpProducer) remove(stream *dcpStream) {
+	p.mu.Lock()
+	if p.streams[stream.vbno] == stream {
+		delete(p.streams, stream.vbno)
+	}
+	p.mu.Unlock()
+
+	b := stream.bucket
+	b.mu.Lock()
+	delete(b.vbuckets[stream.vbno].streams, stream)
+	b.mu.Unlock()
+}
+
+// close all streams when the connection goes away.
+func (p *dcpProducer) close() {
+	p.mu.Lock()
+	streams := make([]*dcpStream, 0, len(p.streams))
+	for _, stream := range p.streams {
+		streams = append(streams, stream)
+	}
+	p.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.stop()
+		p.remove(stream)
+	}
+}
+
+// rollbackSeqno for a stream request from start under vbuuid, if the
+// requested history is not part of this vbucket's history.
+func (vb *vbucket) rollbackSeqno(vbuuid, start uint64) (uint64, bool) {
+	if start == 0 {
+		return 0, false
+	}
+	for i, entry := range vb.flog {
+		if entry.Vbuuid != vbuuid {
+			continue
+		}
+		upper := vb.high
+		if i > 0 {
+			upper = vb.flog[i-1].Seqno
+		}
+		if start > upper {
+			return upper, true
+		}
+		return 0, false
+	}
+	return 0, true
+}
+
+func (s *dcpStream) run() {
+	defer close(s.donech)
+
+	seqno := s.start
+	for {
+		s.bucket.mu.Lock()
+		vb := s.bucket.vbuckets[s.vbno]
+		items := make([]*item, 0)
+		for _, it := range vb.history {
+			if it.seqno > seqno && it.seqno <= s.endSeqno {
+				items = append(items, it)
+			}
+		}
+		changed := vb.changed
+		s.bucket.mu.Unlock()
+
+		if len(items) > 0 {
+			if err := s.sendSnapshot(items); err != nil {
+				return
+			}
+			seqno = items[len(items)-1].seqno
+		}
+		if seqno >= s.endSeqno {
+			s.producer.remove(s)
+			s.sendStreamEnd(dcpStreamEndOK)
+			return
+		}
+
+		select {
+		case <-changed:
+		case flags := <-s.endch:
+			s.producer.remove(s)
+			s.sendStreamEnd(flags)
+			return
+		case <-s.closech:
+			return
+		}
+	}
+}
+
+// end stream from the cluster side.
+func (s *dcpStream) end(flags uint32) {
+	select {
+	case s.endch <- flags:
+	default:
+	}
+}
+
+// stop stream on client request, without DCP_STREAMEND.
+func (s *dcpStream) stop() {
+	select {
+	case <-s.closech:
+	default:
+		close(s.closech)
+	}
+	<-s.donech
+}
+
+func (s *dcpStream) sendSnapshot(items []*item) error {
+	marker := &mc.MCRequest{
+		Opcode:  mc.DCP_SNAPSHOT,
+		VBucket: s.vbno,
+		Opaque:  s.opaque,
+		Extras:  make([]byte, 20),
+	}
+	binary.BigEndian.PutUint64(marker.Extras[0:8], items[0].seqno)
+	binary.BigEndian.PutUint64(marker.Extras[8:16], items[len(items)-1].seqno)
+	binary.BigEndian.PutUint32(marker.Extras[16:20], 1) // in-memory
+	if err := s.producer.kc.transmit(marker); err != nil {
+		return err
+	}
+
+	for _, it := range items {
+		pkt := &mc.MCRequest{
+			VBucket: s.vbno,
+			Opaque:  s.opaque,
+			Cas:     it.cas,
+			Key:     []byte(it.key),
+		}
+		if it.deleted {
+			pkt.Opcode = mc.DCP_DELETION
+			pkt.Extras = make([]byte, 18)
+			binary.BigEndian.PutUint64(pkt.Extras[0:8], it.seqno)
+			binary.BigEndian.PutUint64(pkt.Extras[8:16], it.revSeqno)
+		} else {
+			pkt.Opcode = mc.DCP_MUTATION
+			pkt.DataType, pkt.Body = s.producer.encodeValue(it)
+			pkt.Extras = make([]byte, 31)
+			binary.BigEndian.PutUint64(pkt.Extras[0:8], it.seqno)
+			binary.BigEndian.PutUint64(pkt.Extras[8:16], it.revSeqno)
+			binary.BigEndian.PutUint32(pkt.Extras[16:20], it.flags)
+			binary.BigEndian.PutUint32(pkt.Extras[20:24], it.expiry)
+		}
+		if err := s.producer.kc.transmit(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeValue of a mutation with the negotiated datatypes.
+func (p *dcpProducer) encodeValue(it *item) (uint8, []byte) {
+	var datatype uint8
+	body := it.value
+	if p.kc.features[mc.FeatureJSON] && json.Valid(it.value) {
+		datatype |= mc.DatatypeJSON
+	}
+	if p.xattrs && len(it.xattrs) > 0 {
+		body = append(encodeXattrs(it.xattrs), it.value...)
+		datatype |= mc.DatatypeXattr
+	}
+	if p.kc.features[mc.FeatureSnappy] {
+		body = snappy.Encode(nil, body)
+		datatype |= mc.DatatypeSnappy
+	}
+	return datatype, body
+}
+
+func (s *dcpStream) sendStreamEnd(flags uint32) {
+	pkt := &mc.MCRequest{
+		Opcode:  mc.DCP_STREAMEND,
+		VBucket: s.vbno,
+		Opaque:  s.opaque,
+		Extras:  make([]byte, 4),
+	}
+	binary.BigEndian.PutUint32(pkt.Extras, flags)
+	s.producer.kc.transmit(pkt)
+}
+
+func encodeFailoverLog(flog []FailoverEntry) []byte {
+	body := make([]byte, 0, len(flog)*16)
+	for _, entry := range flog {
+		var buf [16]byte
+		binary.BigEndian.PutUint64(buf[:8], entry.Vbuuid)
+		binary.BigEndian.PutUint64(buf[8:], entry.Seqno)
+		body = append(body, buf[:]...)
+	}
+	return body
+}
+
+// encodeXattrs section, 4 byte length of the section followed by pairs
+// of 4 byte length, key, 0x00, value, 0x00, in key order.
+func encodeXattrs(xattrs map[string][]byte) []byte {
+	keys := make([]string, 0, len(xattrs))
+	for key := range xattrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	section := make([]byte, 4)
+	for _, key := range keys {
+		var plen [4]byte
+		binary.BigEndian.PutUint32(plen[:], uint32(len(key)+len(xattrs[key])+2))
+		section = append(section, plen[:]...)
+		section = append(section, key...)
+		section = append(section, 0)
+		section = append(section, xattrs[key]...)
+		section = append(section, 0)
+	}
+	binary.BigEndian.PutUint32(section[:4], uint32(len(section)-4))
+	return section
+}
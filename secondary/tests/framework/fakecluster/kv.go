@@ -0,0 +1,563 @@
+package fakecluster
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+
+	mc "github.com/couchbase/indexing/secondary/dcp/transport"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport/server"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// ErrorInvalidVbucket for vbucket numbers outside the bucket.
+var ErrorInvalidVbucket = errors.New("fakecluster.invalidVbucket")
+
+// ErrorInvalidNode for node index outside the cluster.
+var ErrorInvalidNode = errors.New("fakecluster.invalidNode")
+
+// ErrorInvalidSeqno for rollback beyond the high seqno.
+var ErrorInvalidSeqno = errors.New("fakecluster.invalidSeqno")
+
+// memcached status for failed SASL authentication, not defined by the
+// transport package.
+const statusAuthError = mc.Status(0x20)
+
+// FailoverEntry of a vbucket's failover log.
+type FailoverEntry struct {
+	Vbuuid uint64
+	Seqno  uint64
+}
+
+// item is a mutation or deletion of a document.
+type item struct {
+	key      string
+	value    []byte
+	flags    uint32
+	expiry   uint32
+	cas      uint64
+	seqno    uint64
+	revSeqno uint64
+	deleted  bool
+	xattrs   map[string][]byte
+}
+
+type vbucket struct {
+	vbno    uint16
+	node    int              // index of the active node
+	high    uint64           // high seqno
+	items   map[string]*item // latest version of every document
+	history []*item          // all mutations in seqno order
+	flog    []FailoverEntry  // newest first
+	changed chan struct{}    // closed and renewed on every mutation
+	streams map[*dcpStream]bool
+}
+
+// Bucket of documents, hashed to vbuckets that are spread across the
+// nodes of the cluster.
+type Bucket struct {
+	cluster *Cluster
+	name    string
+	uuid    string
+
+	mu       sync.Mutex
+	vbuckets []*vbucket
+}
+
+func newBucket(c *Cluster, name string, nvbs int) *Bucket {
+	b := &Bucket{cluster: c, name: name, uuid: newUUID()}
+	for vbno := 0; vbno < nvbs; vbno++ {
+		b.vbuckets = append(b.vbuckets, &vbucket{
+			vbno:    uint16(vbno),
+			node:    vbno * len(c.nodes) / nvbs,
+			items:   make(map[string]*item),
+			flog:    []FailoverEntry{{Vbuuid: newVbuuid(), Seqno: 0}},
+			changed: make(chan struct{}),
+			streams: make(map[*dcpStream]bool),
+		})
+	}
+	return b
+}
+
+// Name of the bucket.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// NumVbuckets in the bucket.
+func (b *Bucket) NumVbuckets() int {
+	return len(b.vbuckets)
+}
+
+// VbucketOf key, same as the CRC hash used by clients.
+func (b *Bucket) VbucketOf(key string) uint16 {
+	crc := crc32.ChecksumIEEE([]byte(key))
+	return uint16(((crc >> 16) & 0x7fff) & uint32(len(b.vbuckets)-1))
+}
+
+// Set document key to value, return the seqno of the mutation.
+func (b *Bucket) Set(key string, value []byte) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	it := b.mutateLocked(key, value, 0, 0, false)
+	return it.seqno, nil
+}
+
+// SetWithXattrs sets document key to value along with its extended
+// attributes, return the seqno of the mutation.
+func (b *Bucket) SetWithXattrs(
+	key string, value []byte, xattrs map[string][]byte) (uint64, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	it := b.mutateLocked(key, value, 0, 0, false)
+	it.xattrs = xattrs
+	return it.seqno, nil
+}
+
+// Delete document key, return the seqno of the deletion.
+func (b *Bucket) Delete(key string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb := b.vbuckets[b.VbucketOf(key)]
+	if it, ok := vb.items[key]; !ok || it.deleted {
+		return 0, fmt.Errorf("key %q not found", key)
+	}
+	it := b.mutateLocked(key, nil, 0, 0, true)
+	return it.seqno, nil
+}
+
+// Get document key.
+func (b *Bucket) Get(key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	it, ok := b.vbuckets[b.VbucketOf(key)].items[key]
+	if !ok || it.deleted {
+		return nil, false
+	}
+	return it.value, true
+}
+
+// Documents in the bucket, by key.
+func (b *Bucket) Documents() map[string][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	docs := make(map[string][]byte)
+	for _, vb := range b.vbuckets {
+		for key, it := range vb.items {
+			if !it.deleted {
+				docs[key] = it.value
+			}
+		}
+	}
+	return docs
+}
+
+// HighSeqno of vbucket vbno.
+func (b *Bucket) HighSeqno(vbno uint16) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) {
+		return 0
+	}
+	return b.vbuckets[vbno].high
+}
+
+// FailoverLog of vbucket vbno, newest entry first.
+func (b *Bucket) FailoverLog(vbno uint16) []FailoverEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) {
+		return nil
+	}
+	flog := make([]FailoverEntry, len(b.vbuckets[vbno].flog))
+	copy(flog, b.vbuckets[vbno].flog)
+	return flog
+}
+
+// Owner is the index of the node hosting the active copy of vbno.
+func (b *Bucket) Owner(vbno uint16) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.vbuckets[vbno].node
+}
+
+// ActiveVbuckets on node, sorted.
+func (b *Bucket) ActiveVbuckets(node int) []uint16 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vbnos := make([]uint16, 0)
+	for _, vb := range b.vbuckets {
+		if vb.node == node {
+			vbnos = append(vbnos, vb.vbno)
+		}
+	}
+	return vbnos
+}
+
+// InjectRollback of vbucket vbno to seqno, as if the node failed over
+// to a replica that had seen mutations only till seqno. Mutations after
+// seqno are lost, a new failover entry is logged and active streams are
+// ended, so that clients re-requesting the stream with their last
+// vbuuid and seqno are asked to rollback.
+func (b *Bucket) InjectRollback(vbno uint16, seqno uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) {
+		return ErrorInvalidVbucket
+	}
+	vb := b.vbuckets[vbno]
+	if seqno > vb.high {
+		return ErrorInvalidSeqno
+	}
+
+	history := make([]*item, 0, len(vb.history))
+	for _, it := range vb.history {
+		if it.seqno <= seqno {
+			history = append(history, it)
+		}
+	}
+	vb.history = history
+	vb.items = make(map[string]*item)
+	for _, it := range vb.history {
+		vb.items[it.key] = it
+	}
+	vb.high = seqno
+
+	flog := make([]FailoverEntry, 0, len(vb.flog))
+	for _, entry := range vb.flog {
+		if entry.Seqno <= seqno {
+			flog = append(flog, entry)
+		}
+	}
+	vb.flog = append([]FailoverEntry{{newVbuuid(), seqno}}, flog...)
+	b.endStreamsLocked(vb, dcpStreamEndStateChanged)
+	logging.Infof("%v bucket %v vb %v rolled back to %v\n",
+		b.cluster.logPrefix, b.name, vbno, seqno)
+	return nil
+}
+
+// Takeover vbucket vbno by node, as if it was rebalanced. A new
+// failover entry is logged, streams on the old node are ended and the
+// vbucket map is updated.
+func (b *Bucket) Takeover(vbno uint16, node int) error {
+	if node < 0 || node >= len(b.cluster.nodes) {
+		return ErrorInvalidNode
+	}
+	b.mu.Lock()
+	if int(vbno) >= len(b.vbuckets) {
+		b.mu.Unlock()
+		return ErrorInvalidVbucket
+	}
+	vb := b.vbuckets[vbno]
+	vb.node = node
+	vb.flog = append([]FailoverEntry{{newVbuuid(), vb.high}}, vb.flog...)
+	b.endStreamsLocked(vb, dcpStreamEndStateChanged)
+	b.mu.Unlock()
+
+	logging.Infof("%v bucket %v vb %v taken over by node %v\n",
+		b.cluster.logPrefix, b.name, vbno, node)
+	b.cluster.notifyChange()
+	return nil
+}
+
+func (b *Bucket) mutateLocked(
+	key string, value []byte, flags, expiry uint32, deleted bool) *item {
+
+	vb := b.vbuckets[b.VbucketOf(key)]
+	vb.high++
+	it := &item{
+		key:     key,
+		value:   value,
+		flags:   flags,
+		expiry:  expiry,
+		cas:     vb.high,
+		seqno:   vb.high,
+		deleted: deleted,
+	}
+	if old, ok := vb.items[key]; ok {
+		it.revSeqno = old.revSeqno + 1
+	} else {
+		it.revSeqno = 1
+	}
+	vb.items[key] = it
+	vb.history = append(vb.history, it)
+	close(vb.changed)
+	vb.changed = make(chan struct{})
+	return it
+}
+
+func (b *Bucket) vbucketMap() [][]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vbmap := make([][]int, 0, len(b.vbuckets))
+	for _, vb := range b.vbuckets {
+		vbmap = append(vbmap, []int{vb.node})
+	}
+	return vbmap
+}
+
+func (b *Bucket) endStreamsLocked(vb *vbucket, flags uint32) {
+	for stream := range vb.streams {
+		stream.end(flags)
+	}
+	vb.streams = make(map[*dcpStream]bool)
+}
+
+func (b *Bucket) closeStreams() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, vb := range b.vbuckets {
+		b.endStreamsLocked(vb, dcpStreamEndClosed)
+	}
+}
+
+//-----------
+// memcached
+//-----------
+
+// kvConn is a memcached connection, responses and DCP messages are
+// written by different routines.
+type kvConn struct {
+	node   *Node
+	conn   net.Conn
+	bucket *Bucket
+
+	wmu      sync.Mutex
+	dcp      *dcpProducer
+	features map[mc.Feature]bool // negotiated by HELLO
+}
+
+type kvHandler func(kc *kvConn, req *mc.MCRequest) *mc.MCResponse
+
+var kvHandlers = map[mc.CommandCode]kvHandler{
+	mc.HELLO:           (*kvConn).handleHello,
+	mc.SASL_LIST_MECHS: (*kvConn).handleSaslListMechs,
+	mc.SASL_AUTH:       (*kvConn).handleSaslAuth,
+	mc.SELECT_BUCKET:   (*kvConn).handleSelectBucket,
+	mc.GET:             (*kvConn).handleGet,
+	mc.SET:             (*kvConn).handleStore,
+	mc.ADD:             (*kvConn).handleStore,
+	mc.REPLACE:         (*kvConn).handleStore,
+	mc.DELETE:          (*kvConn).handleDelete,
+	mc.NOOP:            (*kvConn).handleNoop,
+}
+
+func (n *Node) serveKV() {
+	for {
+		conn, err := n.kv.Accept()
+		if err != nil {
+			logging.Debugf("%v node %v memcached: %v\n", n.cluster.logPrefix, n.index, err)
+			return
+		}
+		if !n.track(conn) {
+			conn.Close()
+			return
+		}
+		kc := &kvConn{node: n, conn: conn, bucket: n.cluster.Bucket("default")}
+		go kc.run()
+	}
+}
+
+func (kc *kvConn) run() {
+	defer func() {
+		kc.conn.Close() // unblock streams before closing them
+		kc.node.untrack(kc.conn)
+		if kc.dcp != nil {
+			kc.dcp.close()
+		}
+	}()
+
+	for {
+		req, err := mcd.ReadPacket(kc.conn)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			logging.Debugf("%v memcached read: %v\n", kc.node.cluster.logPrefix, err)
+			return
+		}
+
+		var res *mc.MCResponse
+		if handler, ok := kvHandlers[req.Opcode]; ok {
+			res = handler(kc, &req)
+		} else if isDcpOpcode(req.Opcode) {
+			res = kc.handleDcp(&req)
+		} else {
+			res = &mc.MCResponse{Status: mc.UNKNOWN_COMMAND}
+		}
+		if res == nil { // no response for this request
+			continue
+		}
+		res.Opcode, res.Opaque = req.Opcode, req.Opaque
+		if err := kc.transmit(res); err != nil {
+			return
+		}
+	}
+}
+
+// transmit a response or a DCP message.
+func (kc *kvConn) transmit(pkt interface {
+	Transmit(io.Writer) (int, error)
+}) error {
+	kc.wmu.Lock()
+	defer kc.wmu.Unlock()
+	_, err := pkt.Transmit(kc.conn)
+	return err
+}
+
+// handleHello enables the requested features supported by the cluster
+// and responds with the list of enabled features.
+func (kc *kvConn) handleHello(req *mc.MCRequest) *mc.MCResponse {
+	kc.features = make(map[mc.Feature]bool)
+	body := make([]byte, 0, len(req.Body))
+	for i := 0; i+2 <= len(req.Body); i += 2 {
+		feature := mc.Feature(binary.BigEndian.Uint16(req.Body[i:]))
+		switch feature {
+		case mc.FeatureJSON, mc.FeatureXattr, mc.FeatureSnappy:
+			kc.features[feature] = true
+			body = append(body, req.Body[i:i+2]...)
+		}
+	}
+	return &mc.MCResponse{Body: body}
+}
+
+func (kc *kvConn) handleSaslListMechs(req *mc.MCRequest) *mc.MCResponse {
+	return &mc.MCResponse{Body: []byte("PLAIN")}
+}
+
+// handleSaslAuth for administrator credentials, or bucket name as user
+// which also selects the bucket.
+func (kc *kvConn) handleSaslAuth(req *mc.MCRequest) *mc.MCResponse {
+	parts := splitPlain(req.Body)
+	if len(parts) != 3 {
+		return &mc.MCResponse{Status: statusAuthError}
+	}
+	user, pass := string(parts[1]), string(parts[2])
+	c := kc.node.cluster
+	if user == c.config.User && pass == c.config.Password {
+		return &mc.MCResponse{}
+	} else if b := c.Bucket(user); b != nil {
+		kc.bucket = b
+		return &mc.MCResponse{}
+	}
+	return &mc.MCResponse{Status: statusAuthError}
+}
+
+func (kc *kvConn) handleSelectBucket(req *mc.MCRequest) *mc.MCResponse {
+	b := kc.node.cluster.Bucket(string(req.Key))
+	if b == nil {
+		return &mc.MCResponse{Status: mc.KEY_ENOENT}
+	}
+	kc.bucket = b
+	return &mc.MCResponse{}
+}
+
+func (kc *kvConn) handleGet(req *mc.MCRequest) *mc.MCResponse {
+	b, res := kc.vbucketFor(req)
+	if res != nil {
+		return res
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	it, ok := b.vbuckets[req.VBucket].items[string(req.Key)]
+	if !ok || it.deleted {
+		return &mc.MCResponse{Status: mc.KEY_ENOENT}
+	}
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, it.flags)
+	return &mc.MCResponse{Cas: it.cas, Extras: extras, Body: it.value}
+}
+
+func (kc *kvConn) handleStore(req *mc.MCRequest) *mc.MCResponse {
+	b, res := kc.vbucketFor(req)
+	if res != nil {
+		return res
+	}
+	var flags, expiry uint32
+	if len(req.Extras) >= 8 {
+		flags = binary.BigEndian.Uint32(req.Extras[:4])
+		expiry = binary.BigEndian.Uint32(req.Extras[4:8])
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := string(req.Key)
+	old, ok := b.vbuckets[req.VBucket].items[key]
+	exists := ok && !old.deleted
+	switch {
+	case req.Opcode == mc.ADD && exists:
+		return &mc.MCResponse{Status: mc.KEY_EEXISTS}
+	case req.Opcode == mc.REPLACE && !exists:
+		return &mc.MCResponse{Status: mc.KEY_ENOENT}
+	case req.Cas != 0 && (!exists || old.cas != req.Cas):
+		return &mc.MCResponse{Status: mc.KEY_EEXISTS}
+	}
+	it := b.mutateLocked(key, req.Body, flags, expiry, false)
+	return &mc.MCResponse{Cas: it.cas}
+}
+
+func (kc *kvConn) handleDelete(req *mc.MCRequest) *mc.MCResponse {
+	b, res := kc.vbucketFor(req)
+	if res != nil {
+		return res
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := string(req.Key)
+	if it, ok := b.vbuckets[req.VBucket].items[key]; !ok || it.deleted {
+		return &mc.MCResponse{Status: mc.KEY_ENOENT}
+	}
+	it := b.mutateLocked(key, nil, 0, 0, true)
+	return &mc.MCResponse{Cas: it.cas}
+}
+
+func (kc *kvConn) handleNoop(req *mc.MCRequest) *mc.MCResponse {
+	return &mc.MCResponse{}
+}
+
+// vbucketFor request, returning an error response if the vbucket is not
+// active on this node or the key does not hash to it.
+func (kc *kvConn) vbucketFor(req *mc.MCRequest) (*Bucket, *mc.MCResponse) {
+	b := kc.bucket
+	if b == nil {
+		return nil, &mc.MCResponse{Status: mc.EINVAL}
+	}
+	if int(req.VBucket) >= len(b.vbuckets) || b.VbucketOf(string(req.Key)) != req.VBucket {
+		return nil, &mc.MCResponse{Status: mc.NOT_MY_VBUCKET}
+	}
+	if b.Owner(req.VBucket) != kc.node.index {
+		return nil, &mc.MCResponse{Status: mc.NOT_MY_VBUCKET}
+	}
+	return b, nil
+}
+
+// splitPlain SASL PLAIN message, authzid \0 authcid \0 passwd.
+func splitPlain(body []byte) [][]byte {
+	parts := make([][]byte, 0, 3)
+	start := 0
+	for i, ch := range body {
+		if ch == 0 {
+			parts = append(parts, body[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, body[start:])
+}
+
+func newUUID() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func newVbuuid() uint64 {
+	var buf [8]byte
+	rand.Read(buf[:])
+	return binary.BigEndian.Uint64(buf[:])
+}
@@ -0,0 +1,152 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/failpoint"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// Projector and indexer booted in-process cannot be restarted. To crash
+// and restart them on the same storage, they are run in a node process
+// instead, a child process re-executing the test binary, where Main boots
+// them from the boot configuration passed in its environment.
+
+// environment variable with the boot configuration of a node process.
+const envNodeProcess = "FAKECLUSTER_NODE"
+
+type nodeProcessConfig struct {
+	Boot        *bootConfig
+	StorageDir  string
+	StorageMode string
+}
+
+// NodeProcess runs projector and indexer of the first node.
+type NodeProcess struct {
+	cluster *Cluster
+	addr    string // indexer http address
+	cmd     *exec.Cmd
+	done    chan struct{} // closed when the process exits
+	status  int
+	err     error
+}
+
+// StartNodeProcess boots projector and indexer of the first node in a
+// child process, storing index files under storageDir. storageMode is
+// forestdb or memory_optimized, empty for the default. failpoints, like
+// the value of INDEXER_FAILPOINTS, are enabled in the child process. Use
+// WaitForIndexer to wait for it to become active.
+func (c *Cluster) StartNodeProcess(
+	storageDir, storageMode, failpoints string) (*NodeProcess, error) {
+
+	boot := c.bootConfig()
+	data, err := json.Marshal(&nodeProcessConfig{
+		Boot:        boot,
+		StorageDir:  storageDir,
+		StorageMode: storageMode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	env := make([]string, 0)
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if name != envRevrpcURL && name != envNodeProcess && name != failpoint.EnvFailpoints {
+			env = append(env, kv)
+		}
+	}
+	env = append(env,
+		envRevrpcURL+"="+revrpcURL(c.ClusterAddr(), c.config.User, c.config.Password),
+		envNodeProcess+"="+string(data),
+		failpoint.EnvFailpoints+"="+failpoints)
+
+	np := &NodeProcess{
+		cluster: c,
+		addr:    boot.serviceAddr("indexHttp"),
+		cmd:     exec.Command(os.Args[0]),
+		done:    make(chan struct{}),
+	}
+	np.cmd.Env = env
+	np.cmd.Stdout, np.cmd.Stderr = os.Stdout, os.Stderr
+	if err := np.cmd.Start(); err != nil {
+		return nil, err
+	}
+	logging.Infof("%v node process %v started, failpoints %q\n",
+		c.logPrefix, np.cmd.Process.Pid, failpoints)
+
+	go func() {
+		err := np.cmd.Wait()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitStatus(exitErr); ok {
+				np.status, err = status, nil
+			}
+		}
+		np.err = err
+		logging.Infof("%v node process %v exited with %v\n",
+			c.logPrefix, np.cmd.Process.Pid, np.status)
+		close(np.done)
+	}()
+	return np, nil
+}
+
+// runNodeProcess boots projector and indexer and never returns.
+func runNodeProcess(data string) {
+	var config nodeProcessConfig
+	err := json.Unmarshal([]byte(data), &config)
+	if err == nil {
+		b := config.Boot
+		err = b.startProjector(filepath.Join(config.StorageDir, "projector"))
+		if err == nil {
+			err = b.startIndexer(config.StorageDir, config.StorageMode)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fakecluster: node process: %v\n", err)
+		os.Exit(1)
+	}
+	select {}
+}
+
+// WaitForIndexer to become active, fails if the process exits before.
+func (np *NodeProcess) WaitForIndexer(timeout time.Duration) error {
+	errch := make(chan error, 1)
+	go func() {
+		errch <- np.cluster.waitForIndexer(np.addr, timeout)
+	}()
+	select {
+	case err := <-errch:
+		return err
+	case <-np.done:
+		return fmt.Errorf("node process exited with %v: %v", np.status, np.err)
+	}
+}
+
+// Done is closed when the process exits.
+func (np *NodeProcess) Done() <-chan struct{} {
+	return np.done
+}
+
+// ExitStatus of the process, waiting for it to exit. It is
+// failpoint.ExitCode if the process exited at a failpoint.
+func (np *NodeProcess) ExitStatus() (int, error) {
+	<-np.done
+	return np.status, np.err
+}
+
+// Kill the process, as if the node crashed, and wait for it to exit.
+func (np *NodeProcess) Kill() {
+	select {
+	case <-np.done:
+		return
+	default:
+	}
+	np.cmd.Process.Kill()
+	<-np.done
+}
@@ -0,0 +1,161 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/failpoint"
+	"github.com/couchbase/indexing/secondary/indexer"
+	"github.com/couchbase/indexing/secondary/tests/framework/secondaryindex"
+)
+
+func startNodeProcess(t *testing.T, cl *Cluster, dir, failpoints string) *NodeProcess {
+	np, err := cl.StartNodeProcess(dir, common.StorageMode(common.FORESTDB).String(), failpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return np
+}
+
+// waitForCrash of node process at a failpoint, loading documents
+// meanwhile.
+func waitForCrash(t *testing.T, np *NodeProcess, load func(n int)) {
+	timeout := time.After(2 * time.Minute)
+	for {
+		select {
+		case <-np.Done():
+			if status, err := np.ExitStatus(); err != nil || status != failpoint.ExitCode {
+				t.Fatalf("expected exit at failpoint, got %v: %v", status, err)
+			}
+			return
+		case <-timeout:
+			np.Kill()
+			t.Fatal("timeout waiting for node process to crash")
+		case <-time.After(100 * time.Millisecond):
+			load(10)
+		}
+	}
+}
+
+// verifyIndex has an entry for every document in the bucket, with its
+// age as key.
+func verifyIndex(t *testing.T, fb *Bucket, server string) {
+	expected := make(map[string]string)
+	for key, value := range fb.Documents() {
+		var doc struct {
+			Age int `json:"age"`
+		}
+		if err := json.Unmarshal(value, &doc); err != nil {
+			t.Fatal(err)
+		}
+		expected[key] = strconv.Itoa(doc.Age)
+	}
+
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		rows, err := secondaryindex.ScanAll("idx_age", "default", server, 0, common.SessionConsistency, nil)
+		if err != nil {
+			if time.Now().After(deadline) {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		for key, age := range expected {
+			if row, ok := rows[key]; !ok {
+				t.Fatalf("%v missing in index", key)
+			} else if len(row) != 1 || fmt.Sprint(row[0]) != age {
+				t.Fatalf("%v expected key %v, got %v", key, age, row)
+			}
+		}
+		if len(rows) != len(expected) {
+			t.Fatalf("expected %v rows, got %v", len(expected), len(rows))
+		}
+		return
+	}
+}
+
+// TestIndexerCrashRecovery crashes the indexer in a node process, at
+// failpoints and while KV rolls back, restarting it on the same storage
+// every time, and verifies that the recovered index matches the
+// documents in the bucket.
+func TestIndexerCrashRecovery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	cl, err := New(Config{NumVbuckets: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	dir, err := ioutil.TempDir("", "fakecluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fb, server := cl.Bucket("default"), cl.ClusterAddr()
+	seq := 0
+	load := func(n int) {
+		for i := 0; i < n; i++ {
+			fb.Set(fmt.Sprintf("doc%v", seq%150), []byte(fmt.Sprintf(`{"age":%v}`, seq)))
+			seq++
+		}
+	}
+
+	np := startNodeProcess(t, cl, dir, "")
+	defer func() { np.Kill() }()
+	if err := np.WaitForIndexer(BootTimeout); err != nil {
+		t.Fatal(err)
+	}
+	load(100)
+	err = secondaryindex.CreateSecondaryIndex(
+		"idx_age", "default", server, "", []string{"age"}, false, nil, true, 120, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyIndex(t, fb, server)
+	np.Kill()
+
+	scenarios := []struct {
+		name       string
+		failpoints string
+		rollback   bool // KV rolls back while indexer is down
+	}{
+		{"stream reader", indexer.FP_STREAM_READER + "=exit@20", false},
+		{"kv sender", indexer.FP_KV_SENDER_REQUEST + "=exit@1", false},
+		{"slice writer", indexer.FP_SLICE_WRITE + "=exit@50", false},
+		{"snapshot manifest", indexer.FP_SNAPSHOT_MANIFEST + "=exit@1", false},
+		{"kv rollback", "", true},
+		{"kv rollback and slice writer", indexer.FP_SLICE_WRITE + "=exit@10", true},
+	}
+	for _, s := range scenarios {
+		t.Logf("crash at %v", s.name)
+		if s.rollback {
+			vbno := fb.VbucketOf("doc0")
+			if err := fb.InjectRollback(vbno, fb.HighSeqno(vbno)/2); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s.failpoints != "" {
+			np = startNodeProcess(t, cl, dir, s.failpoints)
+			waitForCrash(t, np, load)
+		}
+
+		np = startNodeProcess(t, cl, dir, "")
+		if err := np.WaitForIndexer(BootTimeout); err != nil {
+			t.Fatalf("restart after %v: %v", s.name, err)
+		}
+		verifyIndex(t, fb, server)
+		load(50)
+		verifyIndex(t, fb, server)
+		np.Kill()
+	}
+}
@@ -0,0 +1,226 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// ns_server REST, only the subset used by dcp.Connect, bucket refresh,
+// ClusterInfoCache and the streaming observers in dcp/pools.go. Requests
+// are not authenticated, credentials are only checked by cbauth revrpc.
+
+var startTime = time.Now()
+
+// streaming endpoints separate objects with blank lines.
+const streamSeparator = "\n\n\n\n"
+
+// pool details, couchbase.Pool does not marshal to the ns_server format.
+type restPool struct {
+	Name    string            `json:"name"`
+	Nodes   []couchbase.Node  `json:"nodes"`
+	Buckets map[string]string `json:"buckets"`
+}
+
+func (n *Node) serveREST() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pools", n.handlePools)
+	mux.HandleFunc("/pools/default", n.handlePool)
+	mux.HandleFunc("/pools/default/buckets", n.handleBuckets)
+	mux.HandleFunc("/pools/default/buckets/", n.handleBucket)
+	mux.HandleFunc("/pools/default/b/", n.handleBucket)
+	mux.HandleFunc("/pools/default/nodeServices", n.handleNodeServices)
+	mux.HandleFunc("/poolsStreaming/default", n.handlePoolStreaming)
+	mux.HandleFunc("/pools/default/nodeServicesStreaming", n.handleNodeServicesStreaming)
+	mux.HandleFunc("/_metakv/", n.cluster.metakv.handle)
+	mux.HandleFunc("/_cbauth", n.handleRevrpc)
+	mux.HandleFunc("/_cbauth/checkAuth", n.handleCheckAuth)
+
+	server := &http.Server{Handler: mux, ConnState: n.restConnState}
+	if err := server.Serve(n.rest); err != nil {
+		logging.Debugf("%v node %v REST: %v\n", n.cluster.logPrefix, n.index, err)
+	}
+}
+
+func (n *Node) restConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		if !n.track(conn) {
+			conn.Close()
+		}
+	case http.StateHijacked, http.StateClosed:
+		n.untrack(conn)
+	}
+}
+
+func (n *Node) handlePools(w http.ResponseWriter, r *http.Request) {
+	pools := couchbase.Pools{
+		ImplementationVersion: "fakecluster",
+		IsAdmin:               true,
+		UUID:                  n.cluster.uuid,
+		Pools: []couchbase.RestPool{{
+			Name:         "default",
+			URI:          "/pools/default",
+			StreamingURI: "/poolsStreaming/default",
+		}},
+	}
+	writeJSON(w, pools)
+}
+
+func (n *Node) handlePool(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, n.pool())
+}
+
+func (n *Node) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets := make([]*couchbase.Bucket, 0)
+	for _, b := range n.cluster.bucketList() {
+		buckets = append(buckets, n.bucketInfo(b))
+	}
+	writeJSON(w, buckets)
+}
+
+func (n *Node) handleBucket(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	b := n.cluster.Bucket(name)
+	if b == nil {
+		http.Error(w, "Requested resource not found.", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, n.bucketInfo(b))
+}
+
+func (n *Node) handleNodeServices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, n.poolServices())
+}
+
+func (n *Node) handlePoolStreaming(w http.ResponseWriter, r *http.Request) {
+	n.stream(w, r, func() interface{} { return n.pool() })
+}
+
+func (n *Node) handleNodeServicesStreaming(w http.ResponseWriter, r *http.Request) {
+	n.stream(w, r, func() interface{} { return n.poolServices() })
+}
+
+// stream object returned by fn, once to begin with and again on every
+// topology change, till the client goes away or the cluster is closed.
+func (n *Node) stream(w http.ResponseWriter, r *http.Request, fn func() interface{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	var gone <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		gone = cn.CloseNotify()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	for {
+		changed, closed := n.cluster.changeCh()
+		if closed {
+			return
+		}
+		if err := enc.Encode(fn()); err != nil {
+			return
+		}
+		w.Write([]byte(streamSeparator))
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-gone:
+			return
+		}
+	}
+}
+
+func (n *Node) pool() *restPool {
+	return &restPool{
+		Name:  "default",
+		Nodes: n.nodesInfo(),
+		Buckets: map[string]string{
+			"uri":              "/pools/default/buckets",
+			"terseBucketsBase": "/pools/default/b/",
+		},
+	}
+}
+
+// nodesInfo as seen from this node, in the order of the server list in
+// vbucket maps.
+func (n *Node) nodesInfo() []couchbase.Node {
+	nodes := make([]couchbase.Node, 0, len(n.cluster.nodes))
+	for _, node := range n.cluster.nodes {
+		nodes = append(nodes, couchbase.Node{
+			ClusterCompatibility: 0x40000,
+			ClusterMembership:    "active",
+			CouchAPIBase:         "http://" + node.RestAddr() + "/",
+			Hostname:             node.RestAddr(),
+			Ports:                map[string]int{"direct": node.ServicePort("kv")},
+			Status:               "healthy",
+			Uptime:               int(time.Since(startTime).Seconds()),
+			Version:              "4.0.0-fakecluster",
+			ThisNode:             node == n,
+		})
+	}
+	return nodes
+}
+
+func (n *Node) bucketInfo(b *Bucket) *couchbase.Bucket {
+	serverList := make([]string, 0, len(n.cluster.nodes))
+	for _, node := range n.cluster.nodes {
+		serverList = append(serverList, node.KVAddr())
+	}
+	return &couchbase.Bucket{
+		AuthType:     "sasl",
+		Capabilities: []string{"cbhello", "touch", "couchapi", "dcp", "nodesExt"},
+		Type:         "membase",
+		Name:         b.name,
+		NodeLocator:  "vbucket",
+		URI:          "/pools/default/buckets/" + b.name,
+		StreamingURI: "/pools/default/bucketsStreaming/" + b.name,
+		UUID:         b.uuid,
+		VBSMJson: couchbase.VBucketServerMap{
+			HashAlgorithm: "CRC",
+			ServerList:    serverList,
+			VBucketMap:    b.vbucketMap(),
+		},
+		NodesJSON: n.nodesInfo(),
+	}
+}
+
+func (n *Node) poolServices() *couchbase.PoolServices {
+	n.cluster.mu.Lock()
+	rev := n.cluster.rev
+	n.cluster.mu.Unlock()
+
+	ps := &couchbase.PoolServices{Rev: rev}
+	for _, node := range n.cluster.nodes {
+		services := make(map[string]int)
+		for srvc, port := range node.services {
+			services[srvc] = port
+		}
+		ps.NodesExt = append(ps.NodesExt, couchbase.NodeServices{
+			Services: services,
+			Hostname: "127.0.0.1",
+			ThisNode: node == n,
+		})
+	}
+	return ps
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
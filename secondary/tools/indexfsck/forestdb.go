@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/fdb"
+)
+
+//snapshot list in the meta store of a forestdb slice file,
+//see fdbSlice.updateSnapshotsMeta
+var snapshotMetaListKey = []byte("snapshots-list")
+
+var inMemSeq = forestdb.SeqNum(math.MaxUint64)
+
+//fdbSnapshotInfo is the persisted form of the snapshot info of a
+//forestdb slice.
+type fdbSnapshotInfo struct {
+	Ts        *c.TsVbuuid
+	MainSeq   forestdb.SeqNum
+	BackSeq   forestdb.SeqNum
+	MetaSeq   forestdb.SeqNum
+	Committed bool
+}
+
+type forestdbStore struct {
+	file   string
+	dbfile *forestdb.File
+	main   *forestdb.KVStore
+	back   *forestdb.KVStore
+	meta   *forestdb.KVStore
+}
+
+//openForestdbStore opens the data file of a slice read-only. As the
+//indexer does, the file with the lowest version is used.
+func openForestdbStore(dir string) (sliceStore, error) {
+	files, _ := filepath.Glob(filepath.Join(dir, "data.fdb.*"))
+	file := files[0]
+	for _, f := range files[1:] {
+		var v1, v2 int
+		fmt.Sscanf(filepath.Base(f), "data.fdb.%d", &v1)
+		fmt.Sscanf(filepath.Base(file), "data.fdb.%d", &v2)
+		if v1 < v2 {
+			file = f
+		}
+	}
+
+	config := forestdb.DefaultConfig()
+	config.SetOpenFlags(forestdb.OPEN_FLAG_RDONLY)
+	kvconfig := forestdb.DefaultKVStoreConfig()
+	kvconfig.SetCreateIfMissing(false)
+
+	var err error
+	s := &forestdbStore{file: file}
+	if s.dbfile, err = forestdb.Open(file, config); err != nil {
+		return nil, err
+	}
+	if s.main, err = s.dbfile.OpenKVStore("main", kvconfig); err != nil {
+		s.close()
+		return nil, err
+	}
+	if s.meta, err = s.dbfile.OpenKVStore("default", kvconfig); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	//primary indexes have no back index
+	if s.back, err = s.dbfile.OpenKVStore("back", kvconfig); err != nil {
+		s.back = nil
+		options.primary = true
+	}
+	return s, nil
+}
+
+func (s *forestdbStore) snapshots() ([]*snapshotInfo, error) {
+	data, err := s.meta.GetKV(snapshotMetaListKey)
+	if err == forestdb.FDB_RESULT_KEY_NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fdbInfos []*fdbSnapshotInfo
+	if err := json.Unmarshal(data, &fdbInfos); err != nil {
+		return nil, err
+	}
+
+	//stored oldest first
+	var infos []*snapshotInfo
+	for i := len(fdbInfos) - 1; i >= 0; i-- {
+		fdbInfo := fdbInfos[i]
+		infos = append(infos, &snapshotInfo{
+			name: fmt.Sprintf("%v@%v/%v", filepath.Base(s.file),
+				fdbInfo.MainSeq, fdbInfo.BackSeq),
+			ts:        fdbInfo.Ts,
+			committed: fdbInfo.Committed,
+			data:      fdbInfo,
+		})
+	}
+	return infos, nil
+}
+
+func (s *forestdbStore) open(info *snapshotInfo) (storeSnapshot, error) {
+	fdbInfo := info.data.(*fdbSnapshotInfo)
+
+	mainSeq, backSeq := fdbInfo.MainSeq, fdbInfo.BackSeq
+	if !fdbInfo.Committed {
+		mainSeq, backSeq = inMemSeq, inMemSeq
+	}
+
+	var err error
+	snap := &forestdbSnapshot{}
+	if snap.main, err = s.main.SnapshotOpen(mainSeq); err != nil {
+		return nil, err
+	}
+	if s.back != nil {
+		if snap.back, err = s.back.SnapshotOpen(backSeq); err != nil {
+			snap.close()
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+func (s *forestdbStore) salvage(dir string, info *snapshotInfo) (sliceWriter, error) {
+	return newForestdbWriter(filepath.Join(dir, "data.fdb.0"), s.back != nil)
+}
+
+func (s *forestdbStore) close() {
+	for _, kv := range []*forestdb.KVStore{s.main, s.back, s.meta} {
+		if kv != nil {
+			kv.Close()
+		}
+	}
+	if s.dbfile != nil {
+		s.dbfile.Close()
+	}
+}
+
+type forestdbSnapshot struct {
+	main *forestdb.KVStore
+	back *forestdb.KVStore
+}
+
+func (s *forestdbSnapshot) iterateMain(callb func(entry []byte) error) error {
+	return iterateKVStore(s.main, func(key, value []byte) error {
+		return callb(key)
+	})
+}
+
+func (s *forestdbSnapshot) mainCount() int64 {
+	return kvStoreCount(s.main)
+}
+
+func (s *forestdbSnapshot) hasBack() bool {
+	return s.back != nil
+}
+
+func (s *forestdbSnapshot) iterateBack(callb func(docid, entry []byte) error) error {
+	return iterateKVStore(s.back, callb)
+}
+
+func (s *forestdbSnapshot) backCount() int64 {
+	if s.back == nil {
+		return -1
+	}
+	return kvStoreCount(s.back)
+}
+
+func (s *forestdbSnapshot) lookupMain(entry []byte) (bool, error) {
+	_, err := s.main.GetKV(entry)
+	if err == forestdb.FDB_RESULT_KEY_NOT_FOUND {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *forestdbSnapshot) lookupBack(docid []byte) ([]byte, error) {
+	entry, err := s.back.GetKV(docid)
+	if err == forestdb.FDB_RESULT_KEY_NOT_FOUND {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func (s *forestdbSnapshot) close() {
+	if s.main != nil {
+		s.main.Close()
+	}
+	if s.back != nil {
+		s.back.Close()
+	}
+}
+
+func iterateKVStore(kv *forestdb.KVStore, callb func(key, value []byte) error) error {
+	it, err := kv.IteratorInit([]byte{}, nil, forestdb.ITR_NONE|forestdb.ITR_NO_DELETES)
+	if err != nil {
+		if err == forestdb.FDB_RESULT_ITERATOR_FAIL {
+			return nil
+		}
+		return err
+	}
+	defer it.Close()
+
+	for {
+		doc, err := it.Get()
+		if err == forestdb.FDB_RESULT_ITERATOR_FAIL {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = callb(doc.Key(), doc.Body())
+		doc.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := it.Next(); err == forestdb.FDB_RESULT_ITERATOR_FAIL {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func kvStoreCount(kv *forestdb.KVStore) int64 {
+	info, err := kv.Info()
+	if err != nil {
+		return -1
+	}
+	return int64(info.DocCount())
+}
+
+//forestdbWriter writes a salvaged forestdb slice file, with the same
+//kvstores as fdbSlice.
+type forestdbWriter struct {
+	dbfile *forestdb.File
+	main   *forestdb.KVStore
+	back   *forestdb.KVStore
+	meta   *forestdb.KVStore
+}
+
+func newForestdbWriter(file string, hasBack bool) (*forestdbWriter, error) {
+	config := forestdb.DefaultConfig()
+	kvconfig := forestdb.DefaultKVStoreConfig()
+
+	var err error
+	w := &forestdbWriter{}
+	if w.dbfile, err = forestdb.Open(file, config); err != nil {
+		return nil, err
+	}
+	if w.main, err = w.dbfile.OpenKVStore("main", kvconfig); err != nil {
+		w.close()
+		return nil, err
+	}
+	if hasBack {
+		if w.back, err = w.dbfile.OpenKVStore("back", kvconfig); err != nil {
+			w.close()
+			return nil, err
+		}
+	}
+	if w.meta, err = w.dbfile.OpenKVStore("default", kvconfig); err != nil {
+		w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *forestdbWriter) insertMain(entry []byte) error {
+	return w.main.SetKV(entry, nil)
+}
+
+func (w *forestdbWriter) insertBack(docid, entry []byte) error {
+	return w.back.SetKV(docid, entry)
+}
+
+func (w *forestdbWriter) lookupMain(entry []byte) (bool, error) {
+	_, err := w.main.GetKV(entry)
+	if err == forestdb.FDB_RESULT_KEY_NOT_FOUND {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//commit writes the snapshot list with a single committed snapshot,
+//the way fdbSlice.NewSnapshot does, and commits the file.
+func (w *forestdbWriter) commit(ts *c.TsVbuuid) error {
+	info := &fdbSnapshotInfo{Ts: ts, Committed: true}
+
+	mainInfo, err := w.main.Info()
+	if err != nil {
+		return err
+	}
+	info.MainSeq = mainInfo.LastSeqNum()
+
+	if w.back != nil {
+		backInfo, err := w.back.Info()
+		if err != nil {
+			return err
+		}
+		info.BackSeq = backInfo.LastSeqNum()
+	}
+
+	metaInfo, err := w.meta.Info()
+	if err != nil {
+		return err
+	}
+	info.MetaSeq = metaInfo.LastSeqNum() + 1
+
+	data, err := json.Marshal([]*fdbSnapshotInfo{info})
+	if err != nil {
+		return err
+	}
+	if err := w.meta.SetKV(snapshotMetaListKey, data); err != nil {
+		return err
+	}
+	return w.dbfile.Commit(forestdb.COMMIT_MANUAL_WAL_FLUSH)
+}
+
+func (w *forestdbWriter) close() {
+	for _, kv := range []*forestdb.KVStore{w.main, w.back, w.meta} {
+		if kv != nil {
+			kv.Close()
+		}
+	}
+	if w.dbfile != nil {
+		w.dbfile.Close()
+	}
+}
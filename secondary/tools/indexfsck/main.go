@@ -0,0 +1,511 @@
+// indexfsck inspects the on-disk files of an index slice without starting
+// the indexer. It recognises forestdb slice directories (data.fdb.N) and
+// memdb slice directories (snapshot.*/manifest.json).
+//
+//	indexfsck -list <slice-dir>
+//	indexfsck -dump -limit 100 <slice-dir>
+//	indexfsck -check -snapshot 1 <slice-dir>
+//	indexfsck -salvage <new-slice-dir> <slice-dir>
+//
+// Snapshots are numbered from the latest, 0. A salvaged slice directory
+// holds a single snapshot with the readable entries of the selected
+// snapshot, and can be put in place of the original slice directory while
+// the indexer is stopped.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/indexer"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+var options struct {
+	list     bool
+	dump     bool
+	check    bool
+	salvage  string
+	snapshot int
+	limit    int
+	primary  bool
+	array    bool
+	verbose  bool
+}
+
+var errEmptySlice = errors.New("no snapshots found")
+
+func argParse() string {
+	flag.BoolVar(&options.list, "list", false,
+		"list snapshots and their timestamps")
+	flag.BoolVar(&options.dump, "dump", false,
+		"dump and decode main index entries of the snapshot")
+	flag.BoolVar(&options.check, "check", false,
+		"check key ordering, item counts and main/back index consistency")
+	flag.StringVar(&options.salvage, "salvage", "",
+		"copy readable entries of the snapshot into a new slice directory")
+	flag.IntVar(&options.snapshot, "snapshot", 0,
+		"snapshot to inspect, 0 for the latest")
+	flag.IntVar(&options.limit, "limit", 0,
+		"maximum number of entries dumped or problems listed, 0 for no limit")
+	flag.BoolVar(&options.primary, "primary", false,
+		"slice belongs to a primary index, detected for forestdb")
+	flag.BoolVar(&options.array, "array", false,
+		"slice belongs to an array index")
+	flag.BoolVar(&options.verbose, "verbose", false,
+		"print vbucket seqnos of every snapshot")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <slice-dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !options.dump && !options.check && options.salvage == "" {
+		options.list = true
+	}
+	return args[0]
+}
+
+func main() {
+	logging.SetLogLevel(logging.Warn)
+	dir := argParse()
+
+	store, err := openStore(dir)
+	if err != nil {
+		fatalf("Error opening %v: %v", dir, err)
+	}
+	defer store.close()
+
+	infos, err := store.snapshots()
+	if err != nil {
+		fatalf("Error reading snapshots of %v: %v", dir, err)
+	}
+	if options.list {
+		listSnapshots(infos)
+	}
+	if !options.dump && !options.check && options.salvage == "" {
+		return
+	}
+
+	if len(infos) == 0 {
+		fatalf("Error: %v", errEmptySlice)
+	} else if options.snapshot < 0 || options.snapshot >= len(infos) {
+		fatalf("Error: snapshot %v not found, %v snapshots", options.snapshot, len(infos))
+	}
+
+	info := infos[options.snapshot]
+	snap, err := store.open(info)
+	if err != nil {
+		fatalf("Error opening snapshot %v: %v", info.name, err)
+	}
+	defer snap.close()
+
+	failed := false
+	if options.dump {
+		if err := dumpEntries(snap); err != nil {
+			fatalf("Error dumping snapshot %v: %v", info.name, err)
+		}
+	}
+	if options.check {
+		report, err := checkSnapshot(snap)
+		if err != nil {
+			fatalf("Error checking snapshot %v: %v", info.name, err)
+		}
+		report.print(info)
+		failed = !report.ok()
+	}
+	if options.salvage != "" {
+		if err := salvage(store, snap, info, options.salvage); err != nil {
+			fatalf("Error salvaging snapshot %v: %v", info.name, err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+//sliceStore is a slice directory of a storage type.
+type sliceStore interface {
+	//snapshots of the slice, latest first
+	snapshots() ([]*snapshotInfo, error)
+	open(info *snapshotInfo) (storeSnapshot, error)
+	//salvage returns a writer for a new slice in dir
+	salvage(dir string, info *snapshotInfo) (sliceWriter, error)
+	close()
+}
+
+//storeSnapshot reads a snapshot of a slice.
+type storeSnapshot interface {
+	iterateMain(callb func(entry []byte) error) error
+	//mainCount is the item count stored with the snapshot, -1 if unknown
+	mainCount() int64
+	hasBack() bool
+	iterateBack(callb func(docid, entry []byte) error) error
+	backCount() int64
+	lookupMain(entry []byte) (bool, error)
+	lookupBack(docid []byte) ([]byte, error)
+	close()
+}
+
+//sliceWriter writes a salvaged slice.
+type sliceWriter interface {
+	insertMain(entry []byte) error
+	insertBack(docid, entry []byte) error
+	lookupMain(entry []byte) (bool, error)
+	//commit the entries as a snapshot at ts
+	commit(ts *c.TsVbuuid) error
+	close()
+}
+
+type snapshotInfo struct {
+	name      string
+	ts        *c.TsVbuuid
+	committed bool
+	data      interface{} //storage specific
+}
+
+func openStore(dir string) (sliceStore, error) {
+	if files, _ := filepath.Glob(filepath.Join(dir, "data.fdb.*")); len(files) > 0 {
+		return openForestdbStore(dir)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*", "manifest.json")); len(files) > 0 {
+		return openMemdbStore(dir)
+	}
+	return nil, fmt.Errorf("%v is not a forestdb or memdb slice directory", dir)
+}
+
+func listSnapshots(infos []*snapshotInfo) {
+	fmt.Printf("%v snapshots\n", len(infos))
+	for i, info := range infos {
+		if info.ts == nil {
+			fmt.Printf("%3d %v committed:%v ts: nil\n", i, info.name, info.committed)
+			continue
+		}
+		vbnos := info.ts.GetVbnos()
+		var seqnos uint64
+		for _, vbno := range vbnos {
+			seqnos += info.ts.Seqnos[vbno]
+		}
+		fmt.Printf("%3d %v committed:%v bucket:%v vbuckets:%v seqnos:%v crc64:%v\n",
+			i, info.name, info.committed, info.ts.Bucket, len(vbnos), seqnos, info.ts.Crc64)
+		if options.verbose {
+			fmt.Print(info.ts.String())
+		}
+	}
+}
+
+var codec = collatejson.NewCodec(16)
+
+//decodeEntry returns the docid and the JSON secondary key of a main index
+//entry. Entries that cannot be decoded return an error instead of panic.
+func decodeEntry(entry []byte) (docid, key []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("corrupt entry (%v)", r)
+		}
+	}()
+
+	if options.primary {
+		e, _ := indexer.BytesToPrimaryIndexEntry(entry)
+		docid, err = e.ReadDocId(nil)
+		return docid, nil, err
+	}
+
+	if len(entry) < 2 {
+		return nil, nil, errors.New("corrupt entry, too short")
+	}
+	e, _ := indexer.BytesToSecondaryIndexEntry(entry)
+	if docid, err = e.ReadDocId(nil); err != nil {
+		return nil, nil, err
+	}
+
+	trailer := 2
+	if e.Count() > 1 {
+		trailer = 4
+	}
+	encoded := entry[:len(entry)-len(docid)-trailer]
+	buf := make([]byte, 0, len(encoded)*3+collatejson.MinBufferSize)
+	if key, err = codec.Decode(encoded, buf); err != nil {
+		return nil, nil, err
+	}
+	return docid, key, nil
+}
+
+func dumpEntries(snap storeSnapshot) error {
+	var n int
+	errStop := errors.New("stop")
+
+	err := snap.iterateMain(func(entry []byte) error {
+		if options.limit > 0 && n >= options.limit {
+			return errStop
+		}
+		n++
+
+		docid, key, err := decodeEntry(entry)
+		if err != nil {
+			fmt.Printf("%v: %v %x\n", n, err, entry)
+		} else if options.primary {
+			fmt.Printf("%v: %s\n", n, docid)
+		} else {
+			e, _ := indexer.BytesToSecondaryIndexEntry(entry)
+			fmt.Printf("%v: %s docid:%s count:%v\n", n, key, docid, e.Count())
+		}
+		return nil
+	})
+	if err == errStop {
+		err = nil
+	}
+	return err
+}
+
+type checkReport struct {
+	mainEntries int64
+	backEntries int64
+	mainCount   int64
+	backCount   int64
+	checkedBack bool
+
+	corrupt     int64
+	outOfOrder  int64
+	duplicates  int64
+	missingBack int64
+	missingMain int64
+	mismatched  int64
+	countErrors int64
+
+	problems []string
+}
+
+func (r *checkReport) addProblem(counter *int64, format string, args ...interface{}) {
+	*counter++
+	if options.limit == 0 || len(r.problems) < options.limit {
+		r.problems = append(r.problems, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *checkReport) ok() bool {
+	return r.corrupt == 0 && r.outOfOrder == 0 && r.duplicates == 0 &&
+		r.missingBack == 0 && r.missingMain == 0 && r.mismatched == 0 &&
+		r.countErrors == 0
+}
+
+func (r *checkReport) print(info *snapshotInfo) {
+	for _, problem := range r.problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("snapshot %v: main entries %v (stored count %v), back entries %v (stored count %v)\n",
+		info.name, r.mainEntries, r.mainCount, r.backEntries, r.backCount)
+	fmt.Printf("corrupt %v, out of order %v, duplicate docids %v, missing in back index %v, "+
+		"missing in main index %v, mismatched %v, count errors %v\n",
+		r.corrupt, r.outOfOrder, r.duplicates, r.missingBack, r.missingMain,
+		r.mismatched, r.countErrors)
+	if !r.checkedBack && !options.primary {
+		fmt.Println("back index not persisted, checked docid uniqueness instead")
+	}
+	if r.ok() {
+		fmt.Println("OK")
+	} else {
+		fmt.Println("FAILED")
+	}
+}
+
+//checkSnapshot checks that main index entries decode and are in order, that
+//item counts match the counts stored with the snapshot and, if the back
+//index is persisted, that main and back index agree. For array indexes the
+//back index holds the whole array key, so only docids are compared.
+func checkSnapshot(snap storeSnapshot) (*checkReport, error) {
+	r := &checkReport{
+		mainCount:   snap.mainCount(),
+		backCount:   snap.backCount(),
+		checkedBack: snap.hasBack() && !options.primary,
+	}
+
+	var prev []byte
+	docids := make(map[string]bool)
+
+	err := snap.iterateMain(func(entry []byte) error {
+		r.mainEntries++
+		if prev != nil && bytes.Compare(prev, entry) >= 0 {
+			r.addProblem(&r.outOfOrder, "main entry %v out of order: %x after %x",
+				r.mainEntries, entry, prev)
+		}
+		prev = append(prev[:0], entry...)
+
+		docid, _, err := decodeEntry(entry)
+		if err != nil {
+			r.addProblem(&r.corrupt, "main entry %v: %v %x", r.mainEntries, err, entry)
+			return nil
+		} else if options.primary {
+			return nil
+		}
+
+		if r.checkedBack {
+			back, err := snap.lookupBack(docid)
+			if err != nil {
+				return err
+			} else if back == nil {
+				r.addProblem(&r.missingBack, "docid %s missing in back index", docid)
+			} else if !options.array && !bytes.Equal(back, entry) {
+				r.addProblem(&r.mismatched, "docid %s main entry %x back entry %x",
+					docid, entry, back)
+			}
+			if options.array {
+				docids[string(docid)] = true
+			}
+		} else if !options.array {
+			if docids[string(docid)] {
+				r.addProblem(&r.duplicates, "docid %s has more than one entry", docid)
+			}
+			docids[string(docid)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.checkedBack {
+		err := snap.iterateBack(func(docid, entry []byte) error {
+			r.backEntries++
+
+			edocid, _, err := decodeEntry(entry)
+			if err != nil {
+				r.addProblem(&r.corrupt, "back entry of docid %s: %v %x", docid, err, entry)
+				return nil
+			} else if !bytes.Equal(edocid, docid) {
+				r.addProblem(&r.mismatched, "back entry of docid %s has docid %s", docid, edocid)
+				return nil
+			}
+
+			if options.array {
+				if !docids[string(docid)] {
+					r.addProblem(&r.missingMain, "docid %s missing in main index", docid)
+				}
+			} else if found, err := snap.lookupMain(entry); err != nil {
+				return err
+			} else if !found {
+				r.addProblem(&r.missingMain, "docid %s entry %x missing in main index", docid, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.mainCount >= 0 && r.mainCount != r.mainEntries {
+		r.addProblem(&r.countErrors, "main index has %v entries, stored count %v",
+			r.mainEntries, r.mainCount)
+	}
+	if r.checkedBack && r.backCount >= 0 && r.backCount != r.backEntries {
+		r.addProblem(&r.countErrors, "back index has %v entries, stored count %v",
+			r.backEntries, r.backCount)
+	}
+	if r.checkedBack && !options.array && r.mainEntries != r.backEntries {
+		r.addProblem(&r.countErrors, "main index has %v entries, back index %v",
+			r.mainEntries, r.backEntries)
+	}
+	return r, nil
+}
+
+//salvage copies the entries of snap that decode and are in order into a
+//new slice directory. Back index entries are copied if their main index
+//entries were.
+func salvage(store sliceStore, snap storeSnapshot, info *snapshotInfo, dir string) error {
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) > 0 {
+		return fmt.Errorf("%v is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	w, err := store.salvage(dir, info)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	var prev []byte
+	var copied, dropped int64
+	docids := make(map[string]bool)
+
+	err = snap.iterateMain(func(entry []byte) error {
+		docid, _, err := decodeEntry(entry)
+		if err != nil || (prev != nil && bytes.Compare(prev, entry) >= 0) {
+			dropped++
+			return nil
+		}
+		if !options.primary && !options.array && docids[string(docid)] {
+			dropped++
+			return nil
+		}
+		prev = append(prev[:0], entry...)
+		docids[string(docid)] = true
+
+		copied++
+		return w.insertMain(entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	var backCopied, backDropped int64
+	if snap.hasBack() && !options.primary {
+		err = snap.iterateBack(func(docid, entry []byte) error {
+			edocid, _, err := decodeEntry(entry)
+			if err != nil || !bytes.Equal(edocid, docid) {
+				backDropped++
+				return nil
+			}
+
+			if options.array {
+				if !docids[string(docid)] {
+					backDropped++
+					return nil
+				}
+			} else if found, err := w.lookupMain(entry); err != nil {
+				return err
+			} else if !found {
+				backDropped++
+				return nil
+			}
+
+			backCopied++
+			return w.insertBack(docid, entry)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.commit(info.ts); err != nil {
+		return err
+	}
+
+	fmt.Printf("salvaged snapshot %v into %v: main entries copied %v dropped %v, "+
+		"back entries copied %v dropped %v\n", info.name, dir, copied, dropped,
+		backCopied, backDropped)
+	if dropped > 0 || backDropped > 0 {
+		fmt.Println("entries were dropped, the index should be rebuilt " +
+			"once the indexer is running")
+	}
+	return nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/memdb"
+)
+
+const memdbTmpDirName = ".tmp"
+
+//memdbManifest is the manifest.json of a memdb disk snapshot,
+//see memdbSlice.doPersistSnapshot
+type memdbManifest struct {
+	Ts *c.TsVbuuid
+}
+
+type memdbStore struct {
+	dir string
+}
+
+func openMemdbStore(dir string) (sliceStore, error) {
+	return &memdbStore{dir: dir}, nil
+}
+
+func (s *memdbStore) snapshots() ([]*snapshotInfo, error) {
+	var manifests []string
+	all, _ := filepath.Glob(filepath.Join(s.dir, "*", "manifest.json"))
+	for _, f := range all {
+		if !strings.Contains(f, memdbTmpDirName) {
+			manifests = append(manifests, f)
+		}
+	}
+	sort.Strings(manifests)
+
+	var infos []*snapshotInfo
+	for i := len(manifests) - 1; i >= 0; i-- {
+		bs, err := ioutil.ReadFile(manifests[i])
+		if err != nil {
+			return nil, err
+		}
+		manifest := &memdbManifest{}
+		if err := json.Unmarshal(bs, manifest); err != nil {
+			return nil, err
+		}
+
+		dataPath := filepath.Dir(manifests[i])
+		infos = append(infos, &snapshotInfo{
+			name:      filepath.Base(dataPath),
+			ts:        manifest.Ts,
+			committed: true,
+			data:      dataPath,
+		})
+	}
+	return infos, nil
+}
+
+func newMemdb(useDelta bool) *memdb.MemDB {
+	cfg := memdb.DefaultConfig()
+	if useDelta {
+		cfg.UseDeltaInterleaving()
+	}
+	cfg.SetKeyComparator(bytes.Compare)
+	return memdb.NewWithConfig(cfg)
+}
+
+func (s *memdbStore) open(info *snapshotInfo) (storeSnapshot, error) {
+	dataPath := info.data.(string)
+	_, err := os.Stat(filepath.Join(dataPath, "delta", "files.json"))
+	db := newMemdb(err == nil)
+
+	snap, err := db.LoadFromDisk(dataPath, runtime.NumCPU(), nil)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &memdbSnapshot{db: db, snap: snap}, nil
+}
+
+func (s *memdbStore) salvage(dir string, info *snapshotInfo) (sliceWriter, error) {
+	db := newMemdb(false)
+	return &memdbWriter{dir: dir, db: db, w: db.NewWriter()}, nil
+}
+
+func (s *memdbStore) close() {
+}
+
+//memdbSnapshot is a disk snapshot loaded in memory. The back index of
+//memdb slices is not persisted, it is rebuilt from docids on load.
+type memdbSnapshot struct {
+	db   *memdb.MemDB
+	snap *memdb.Snapshot
+}
+
+func (s *memdbSnapshot) iterateMain(callb func(entry []byte) error) error {
+	it := s.snap.NewIterator()
+	defer it.Close()
+
+	for it.SeekFirst(); it.Valid(); it.Next() {
+		if err := callb(it.Get()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memdbSnapshot) mainCount() int64 {
+	return s.db.ItemsCount()
+}
+
+func (s *memdbSnapshot) hasBack() bool {
+	return false
+}
+
+func (s *memdbSnapshot) iterateBack(callb func(docid, entry []byte) error) error {
+	return nil
+}
+
+func (s *memdbSnapshot) backCount() int64 {
+	return -1
+}
+
+func (s *memdbSnapshot) lookupMain(entry []byte) (bool, error) {
+	return false, nil
+}
+
+func (s *memdbSnapshot) lookupBack(docid []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *memdbSnapshot) close() {
+	s.snap.Close()
+	s.db.Close()
+}
+
+//memdbWriter writes a salvaged memdb slice with a single disk snapshot.
+type memdbWriter struct {
+	dir string
+	db  *memdb.MemDB
+	w   *memdb.Writer
+}
+
+func (w *memdbWriter) insertMain(entry []byte) error {
+	w.w.Put(entry)
+	return nil
+}
+
+func (w *memdbWriter) insertBack(docid, entry []byte) error {
+	return nil
+}
+
+func (w *memdbWriter) lookupMain(entry []byte) (bool, error) {
+	return false, nil
+}
+
+//commit stores the entries to disk the way memdbSlice.doPersistSnapshot
+//does, in a temporary directory renamed once the manifest is written.
+func (w *memdbWriter) commit(ts *c.TsVbuuid) error {
+	snap, err := w.db.NewSnapshot()
+	if err != nil {
+		return err
+	}
+
+	tmpdir := filepath.Join(w.dir, memdbTmpDirName)
+	if err := w.db.StoreToDisk(tmpdir, snap, runtime.NumCPU(), nil); err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(&memdbManifest{Ts: ts})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "manifest.json"), bs, 0755); err != nil {
+		return err
+	}
+
+	name := time.Now().Format("snapshot.2006-01-02.15:04:05.000")
+	name = strings.Replace(name, ":", "", -1)
+	return os.Rename(tmpdir, filepath.Join(w.dir, name))
+}
+
+func (w *memdbWriter) close() {
+	w.db.Close()
+}
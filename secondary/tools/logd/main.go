@@ -11,6 +11,9 @@ import "io/ioutil"
 var options struct {
 	show    []string
 	session int
+	query   string
+	level   string
+	groupby string
 }
 
 func argParse() []string {
@@ -18,6 +21,12 @@ func argParse() []string {
 
 	flag.StringVar(&show, "show", "", "log lines to show")
 	flag.IntVar(&options.session, "session", 0, "session to analyse")
+	flag.StringVar(&options.query, "query", "",
+		"query json log records, comma separated field=value")
+	flag.StringVar(&options.level, "level", "",
+		"query json log records at or above level")
+	flag.StringVar(&options.groupby, "groupby", "",
+		"group queried json log records by field, eg. requestId")
 
 	flag.Parse()
 
@@ -43,6 +52,10 @@ func argParse() []string {
 
 func main() {
 	args := argParse()
+	if options.query != "" || options.level != "" || options.groupby != "" {
+		queryLog(args[0])
+		return
+	}
 	analyseLog(args[0])
 }
 
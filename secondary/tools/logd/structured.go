@@ -0,0 +1,141 @@
+package main
+
+import "encoding/json"
+import "fmt"
+import "log"
+import "sort"
+import "strings"
+
+import "github.com/couchbase/indexing/secondary/logging"
+
+// queries on structured (json) log records, logged with
+// indexer.settings.log_format / projector.settings.log_format as json.
+
+type LogRecord map[string]interface{}
+
+func (rec LogRecord) field(name string) string {
+	v, ok := rec[name]
+	if !ok {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func (rec LogRecord) String() string {
+	s := fmt.Sprintf("%s [%s] %s", rec.field("ts"), rec.field("level"), rec.field("msg"))
+	keys := make([]string, 0, len(rec))
+	for k := range rec {
+		if k != "ts" && k != "level" && k != "msg" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s += fmt.Sprintf(" %s=%s", k, rec.field(k))
+	}
+	return s
+}
+
+// parseQuery parses "field=value,field=value".
+func parseQuery(query string) map[string]string {
+	m := make(map[string]string)
+	for _, term := range strings.Split(query, ",") {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 {
+			log.Fatalf("invalid query term %q", term)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
+
+func (rec LogRecord) matches(query map[string]string, level logging.LogLevel) bool {
+	if options.level != "" && logging.Level(rec.field("level")) > level {
+		return false
+	}
+	for k, v := range query {
+		if rec.field(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRecord decodes numbers as json.Number, so that fields are matched
+// and printed as logged, large integers like seqnos and vbuuids would
+// otherwise turn into float64.
+func parseRecord(line string) (LogRecord, error) {
+	var rec LogRecord
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func readRecords(logfile string) ([]LogRecord, []string) {
+	records, skipped := make([]LogRecord, 0), make([]string, 0)
+	for _, line := range readLines(logfile) {
+		if !strings.HasPrefix(line, "{") {
+			skipped = append(skipped, line)
+		} else if rec, err := parseRecord(line); err != nil {
+			skipped = append(skipped, line)
+		} else {
+			records = append(records, rec)
+		}
+	}
+	return records, skipped
+}
+
+func queryLog(logfile string) {
+	query := parseQuery(options.query)
+	level := logging.Level(options.level)
+
+	records, skipped := readRecords(logfile)
+	matched := make([]LogRecord, 0)
+	for _, rec := range records {
+		if rec.matches(query, level) {
+			matched = append(matched, rec)
+		}
+	}
+
+	fmt.Printf("Number of records: %d\n", len(records))
+	fmt.Printf("Number of matching records: %d\n", len(matched))
+	fmt.Printf("Lines skipped: %d\n", len(skipped))
+
+	if options.groupby == "" {
+		for _, rec := range matched {
+			fmt.Println(rec)
+		}
+		return
+	}
+
+	// group records by field value, preserving the order of first record
+	// of every group.
+	groups := make(map[string][]LogRecord)
+	order := make([]string, 0)
+	for _, rec := range matched {
+		key := rec.field(options.groupby)
+		if key == "" {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], rec)
+	}
+	for _, key := range order {
+		recs := groups[key]
+		fmt.Printf("%s=%s, %d records\n", options.groupby, key, len(recs))
+		for _, rec := range recs {
+			fmt.Printf("    %v\n", rec)
+		}
+	}
+}
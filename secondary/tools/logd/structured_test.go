@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestLogRecordField(t *testing.T) {
+	line := `{"ts":"2017-01-02T10:11:12.131+05:30","level":"Info","msg":"rollback",` +
+		`"vbuuid":18446744073709551615,"seqno":12345678901234567,"ratio":0.25,` +
+		`"bucket":"default","ok":true}`
+	rec, err := parseRecord(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := map[string]string{
+		"vbuuid": "18446744073709551615",
+		"seqno":  "12345678901234567",
+		"ratio":  "0.25",
+		"bucket": "default",
+		"ok":     "true",
+		"none":   "",
+	}
+	for name, expected := range fields {
+		if v := rec.field(name); v != expected {
+			t.Errorf("expected %v to be %q, got %q", name, expected, v)
+		}
+	}
+
+	query := parseQuery("bucket=default, seqno=12345678901234567")
+	if !rec.matches(query, 0) {
+		t.Errorf("expected record to match %v", query)
+	}
+	if rec.matches(parseQuery("seqno=12345678901234568"), 0) {
+		t.Errorf("expected record not to match a different seqno")
+	}
+
+	expected := "2017-01-02T10:11:12.131+05:30 [Info] rollback bucket=default ok=true " +
+		"ratio=0.25 seqno=12345678901234567 vbuuid=18446744073709551615"
+	if s := rec.String(); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}